@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"connect-four-backend/internal/auth"
+	"connect-four-backend/internal/config"
+
+	"github.com/gorilla/mux"
+)
+
+// AuthConfig says who may use the metrics API and which pages may call it.
+// Without API keys or a JWT secret the API is open, as it used to be.
+type AuthConfig struct {
+	APIKeys        map[string]auth.Role // role of each key
+	JWTSecret      string               // verifies role tokens, see -issue-token
+	AllowedOrigins []string             // pages allowed to call the API, "*" for any
+}
+
+// NewAuthConfig reads the consumer's metrics API settings. The API keys are a
+// list of key:role pairs like "k1:read,k2:admin".
+func NewAuthConfig(settings config.ConsumerConfig) (AuthConfig, error) {
+	config := AuthConfig{
+		APIKeys:        make(map[string]auth.Role),
+		JWTSecret:      settings.MetricsJWTSecret,
+		AllowedOrigins: settings.MetricsCORSOrigins,
+	}
+
+	for _, entry := range strings.Split(settings.MetricsAPIKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		separator := strings.LastIndex(entry, ":")
+		if separator <= 0 {
+			return config, errors.New("API key without a role, expected key:role")
+		}
+		role, err := auth.ParseRole(entry[separator+1:])
+		if err != nil {
+			return config, err
+		}
+		config.APIKeys[entry[:separator]] = role
+	}
+	return config, nil
+}
+
+// Enabled reports whether clients have to authenticate
+func (c AuthConfig) Enabled() bool {
+	return len(c.APIKeys) > 0 || c.JWTSecret != ""
+}
+
+// apiAuth finds the role of a request's API key or role token
+type apiAuth struct {
+	enabled bool
+	keys    map[[sha256.Size]byte]auth.Role // by hash, so finding a key takes the same time whatever it shares with a real one
+	tokens  *auth.RoleTokens                // nil without a JWT secret
+}
+
+func newAPIAuth(config AuthConfig) *apiAuth {
+	a := &apiAuth{
+		enabled: config.Enabled(),
+		keys:    make(map[[sha256.Size]byte]auth.Role),
+	}
+	for key, role := range config.APIKeys {
+		a.keys[sha256.Sum256([]byte(key))] = role
+	}
+	if config.JWTSecret != "" {
+		a.tokens = auth.NewRoleTokens([]byte(config.JWTSecret))
+	}
+	if !a.enabled {
+		log.Println("METRICS_API_KEYS and METRICS_JWT_SECRET not set, the metrics API is open to anyone")
+	}
+	return a
+}
+
+// authenticate returns the role granted by the request's credentials: an
+// "Authorization: Bearer" API key or token, an X-API-Key header, or, for
+// WebSockets which browsers open without headers, an access_token parameter
+func (a *apiAuth) authenticate(r *http.Request) (auth.Role, error) {
+	credential := r.Header.Get("X-API-Key")
+	if value := r.Header.Get("Authorization"); strings.HasPrefix(value, "Bearer ") {
+		credential = strings.TrimPrefix(value, "Bearer ")
+	}
+	if credential == "" {
+		credential = r.URL.Query().Get("access_token")
+	}
+	if credential == "" {
+		return "", auth.ErrMissingToken
+	}
+
+	if role, ok := a.keys[sha256.Sum256([]byte(credential))]; ok {
+		return role, nil
+	}
+	if a.tokens != nil && strings.Count(credential, ".") == 2 {
+		claims, err := a.tokens.Verify(credential)
+		if err != nil {
+			return "", err
+		}
+		return claims.Role, nil
+	}
+	return "", auth.ErrInvalidToken
+}
+
+// requireRole rejects requests without credentials granting the role
+func (ms *MetricsServer) requireRole(role auth.Role) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ms.auth.enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			granted, err := ms.auth.authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				switch {
+				case errors.Is(err, auth.ErrMissingToken):
+					ms.writeError(w, http.StatusUnauthorized, "An API key or token is required")
+				case errors.Is(err, auth.ErrTokenExpired):
+					ms.writeError(w, http.StatusUnauthorized, "Token has expired")
+				default:
+					ms.writeError(w, http.StatusUnauthorized, "Invalid API key or token")
+				}
+				return
+			}
+			if !granted.Allows(role) {
+				ms.writeError(w, http.StatusForbidden, "The "+string(role)+" role is required")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsPolicy lets pages on the allowed origins call the API
+type corsPolicy struct {
+	origins map[string]bool
+	any     bool
+}
+
+func newCORSPolicy(origins []string) *corsPolicy {
+	p := &corsPolicy{origins: make(map[string]bool)}
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "*" {
+			p.any = true
+		} else if origin != "" {
+			p.origins[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+	return p
+}
+
+// checkOrigin accepts WebSockets from the allowed origins and from clients
+// that aren't browsers, which send no Origin
+func (p *corsPolicy) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || p.any || p.origins[origin]
+}
+
+// handler adds the CORS headers for allowed origins and answers preflight
+// requests. It wraps the router rather than being its middleware, because
+// the router only runs middleware for requests matching a route, and no
+// route takes OPTIONS.
+func (p *corsPolicy) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && p.checkOrigin(r) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
+		}
+		w.Header().Add("Vary", "Origin")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExportLimit = 100
+	maxExportLimit     = 10000
+)
+
+// exportFormat writes a table for download in one file format
+type exportFormat struct {
+	extension   string
+	contentType string
+	write       func(w io.Writer, sheet string, header []string, rows [][]interface{}) error
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":  {".csv", "text/csv; charset=utf-8", writeCSV},
+	"xlsx": {".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", writeXLSX},
+}
+
+func (ms *MetricsServer) handleHourlyExport(w http.ResponseWriter, r *http.Request) {
+	format, from, to, err := exportRange(r, hourlyRange)
+	if err != nil {
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows := [][]interface{}{}
+	for _, point := range ms.consumer.GetHourlySeries(from, to) {
+		rows = append(rows, []interface{}{point.Hour, point.Games, point.Moves, point.Players, point.AverageDuration})
+	}
+	writeExport(w, format, "hourly",
+		[]string{"hour", "games", "moves", "players", "average_duration"}, rows)
+}
+
+func (ms *MetricsServer) handleDailyExport(w http.ResponseWriter, r *http.Request) {
+	format, from, to, err := exportRange(r, dailyRange)
+	if err != nil {
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows := [][]interface{}{}
+	for _, point := range ms.consumer.GetDailySeries(from, to) {
+		rows = append(rows, []interface{}{point.Day, point.Games, point.Moves, point.Players, point.NewPlayers, point.AverageDuration})
+	}
+	writeExport(w, format, "daily",
+		[]string{"day", "games", "moves", "players", "new_players", "average_duration"}, rows)
+}
+
+func (ms *MetricsServer) handleTopPlayersExport(w http.ResponseWriter, r *http.Request) {
+	format, limit, offset, err := exportPage(r)
+	if err != nil {
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows := [][]interface{}{}
+	for i, player := range ms.consumer.GetTopPlayers(limit, offset).Players {
+		rows = append(rows, []interface{}{
+			offset + i + 1, player.Name, player.GamesPlayed, player.GamesWon, player.GamesLost, player.GamesDrawn,
+			player.WinRate, player.TotalMoves, player.AverageGameTime, player.CurrentStreak, player.LongestStreak,
+			player.Disconnections, player.Reconnections, player.FirstSeen, player.LastSeen,
+		})
+	}
+	writeExport(w, format, "top-players", []string{
+		"rank", "name", "games_played", "games_won", "games_lost", "games_drawn",
+		"win_rate", "total_moves", "average_game_time", "current_streak", "longest_streak",
+		"disconnections", "reconnections", "first_seen", "last_seen",
+	}, rows)
+}
+
+func (ms *MetricsServer) handleWinnersExport(w http.ResponseWriter, r *http.Request) {
+	format, limit, offset, err := exportPage(r)
+	if err != nil {
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows := [][]interface{}{}
+	for i, winner := range ms.consumer.GetWinners(limit, offset).Winners {
+		rows = append(rows, []interface{}{offset + i + 1, winner.Name, winner.Wins})
+	}
+	writeExport(w, format, "winners", []string{"rank", "name", "wins"}, rows)
+}
+
+// exportRange reads the format and the range of an hourly or daily export
+func exportRange(r *http.Request, rangeOf func(*http.Request) (time.Time, time.Time, error)) (format exportFormat, from, to time.Time, err error) {
+	if format, err = formatParam(r); err != nil {
+		return format, from, to, err
+	}
+	from, to, err = rangeOf(r)
+	return format, from, to, err
+}
+
+// exportPage reads the format, the limit, 100 by default and at most 10000,
+// and the offset of a leaderboard export
+func exportPage(r *http.Request) (format exportFormat, limit, offset int, err error) {
+	if format, err = formatParam(r); err != nil {
+		return format, 0, 0, err
+	}
+
+	query := r.URL.Query()
+	limit = defaultExportLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxExportLimit {
+			return format, 0, 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxExportLimit))
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return format, 0, 0, errors.New("offset must be zero or more")
+		}
+	}
+	return format, limit, offset, nil
+}
+
+// formatParam reads the format, csv by default
+func formatParam(r *http.Request) (exportFormat, error) {
+	name := strings.ToLower(r.URL.Query().Get("format"))
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		return exportFormat{}, errors.New("format must be csv or xlsx")
+	}
+	return format, nil
+}
+
+// writeExport sends the table as an attachment named after it and the time
+// of the export
+func writeExport(w http.ResponseWriter, format exportFormat, name string, header []string, rows [][]interface{}) {
+	filename := name + "-" + time.Now().Format("20060102-150405") + format.extension
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure can only be logged
+	if err := format.write(w, name, header, rows); err != nil {
+		log.Printf("Failed to write %s: %v", filename, err)
+	}
+}
+
+func writeCSV(w io.Writer, _ string, header []string, rows [][]interface{}) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			record[i] = formatCell(cell)
+			// Player names are user input, and a spreadsheet would run one
+			// that looks like a formula
+			if value, isString := cell.(string); isString && value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+				record[i] = "'" + value
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeXLSX writes a workbook with the table as its only sheet. Numbers are
+// numeric cells, everything else inline strings, so no shared strings or
+// styles are needed.
+func writeXLSX(w io.Writer, sheet string, header []string, rows [][]interface{}) error {
+	archive := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", strings.Replace(xlsxWorkbook, "{sheet}", sheet, 1)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, xml.Header+part.content); err != nil {
+			return err
+		}
+	}
+
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	b := bufio.NewWriter(file)
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	headerRow := make([]interface{}, len(header))
+	for i, name := range header {
+		headerRow[i] = name
+	}
+	for _, row := range append([][]interface{}{headerRow}, rows...) {
+		b.WriteString("<row>")
+		for _, cell := range row {
+			switch cell.(type) {
+			case int, int64, float64:
+				b.WriteString("<c><v>" + formatCell(cell) + "</v></c>")
+			default:
+				b.WriteString(`<c t="inlineStr"><is><t>`)
+				xml.EscapeText(b, []byte(formatCell(cell)))
+				b.WriteString("</t></is></c>")
+			}
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData></worksheet>")
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func formatCell(cell interface{}) string {
+	switch value := cell.(type) {
+	case string:
+		return value
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	default:
+		return ""
+	}
+}
+
+const (
+	xlsxContentTypes = `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRootRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="{sheet}" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+	xlsxWorkbookRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+)
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xlsxCell is a cell of a worksheet, read back from its XML: a number in
+// V, or an inline string in InlineText
+type xlsxCell struct {
+	Type       string `xml:"t,attr"`
+	Value      string `xml:"v"`
+	InlineText string `xml:"is>t"`
+	Formula    string `xml:"f"`
+}
+
+type xlsxWorksheet struct {
+	XMLName xml.Name `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main worksheet"`
+	Rows    []struct {
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX reopens a workbook, returning its parts by name
+func readXLSX(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string][]byte)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[file.Name] = content
+	}
+	return parts
+}
+
+func TestWriteXLSX(t *testing.T) {
+	seen := time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC)
+	rows := [][]interface{}{
+		{1, "alice", int64(42), 0.625, seen},
+		{2, "=HYPERLINK(\"http://evil\")", int64(0), 0.0, time.Time{}},
+		{3, "<b>&amp;</b>", int64(-7), 1e21, nil},
+	}
+	var b bytes.Buffer
+	if err := writeXLSX(&b, "top-players", []string{"rank", "name", "games", "win_rate", "last_seen"}, rows); err != nil {
+		t.Fatal(err)
+	}
+	parts := readXLSX(t, b.Bytes())
+
+	var names []string
+	for name := range parts {
+		names = append(names, name)
+	}
+	wantParts := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}
+	if len(names) != len(wantParts) {
+		t.Errorf("the workbook has parts %v, want %v", names, wantParts)
+	}
+	for _, name := range wantParts {
+		content, ok := parts[name]
+		if !ok {
+			t.Errorf("the workbook has no %s", name)
+			continue
+		}
+		if !strings.HasPrefix(string(content), xml.Header) {
+			t.Errorf("%s has no XML declaration", name)
+		}
+		var root struct{ XMLName xml.Name }
+		if err := xml.Unmarshal(content, &root); err != nil {
+			t.Errorf("%s isn't XML: %v", name, err)
+		}
+	}
+
+	// Each part is declared and linked, and the cells don't refer to a
+	// shared strings part that isn't there
+	var contentTypes struct {
+		Overrides []struct {
+			PartName string `xml:"PartName,attr"`
+		} `xml:"Override"`
+	}
+	if err := xml.Unmarshal(parts["[Content_Types].xml"], &contentTypes); err != nil {
+		t.Fatal(err)
+	}
+	for _, override := range contentTypes.Overrides {
+		if _, ok := parts[strings.TrimPrefix(override.PartName, "/")]; !ok {
+			t.Errorf("[Content_Types].xml declares %s, which is missing", override.PartName)
+		}
+	}
+	for rels, dir := range map[string]string{"_rels/.rels": "", "xl/_rels/workbook.xml.rels": "xl/"} {
+		var relationships struct {
+			Relationships []struct {
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+		if err := xml.Unmarshal(parts[rels], &relationships); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range relationships.Relationships {
+			if _, ok := parts[dir+r.Target]; !ok {
+				t.Errorf("%s links %s, which is missing", rels, r.Target)
+			}
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &workbook); err != nil {
+		t.Fatal(err)
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != "top-players" {
+		t.Errorf("the workbook's sheets are %+v", workbook.Sheets)
+	}
+
+	var sheet xlsxWorksheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	text := func(s string) xlsxCell { return xlsxCell{Type: "inlineStr", InlineText: s} }
+	number := func(s string) xlsxCell { return xlsxCell{Value: s} }
+	want := [][]xlsxCell{
+		{text("rank"), text("name"), text("games"), text("win_rate"), text("last_seen")},
+		{number("1"), text("alice"), number("42"), number("0.625"), text("2024-01-02T15:04:05Z")},
+		// A name that looks like a formula stays a string
+		{number("2"), text(`=HYPERLINK("http://evil")`), number("0"), number("0"), text("")},
+		{number("3"), text("<b>&amp;</b>"), number("-7"), number("1000000000000000000000"), text("")},
+	}
+	var got [][]xlsxCell
+	for _, row := range sheet.Rows {
+		got = append(got, row.Cells)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("the sheet's cells are\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestWriteExportHeaders(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writeExport(recorder, exportFormats["xlsx"], "winners", []string{"rank", "name", "wins"}, [][]interface{}{{1, "alice", int64(3)}})
+
+	if got := recorder.Header().Get("Content-Type"); got != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Errorf("Content-Type is %q", got)
+	}
+	if got := recorder.Header().Get("Content-Disposition"); !strings.HasPrefix(got, `attachment; filename="winners-`) || !strings.HasSuffix(got, `.xlsx"`) {
+		t.Errorf("Content-Disposition is %q", got)
+	}
+	if parts := readXLSX(t, recorder.Body.Bytes()); !strings.Contains(string(parts["xl/worksheets/sheet1.xml"]), "<c><v>3</v></c>") {
+		t.Errorf("the sheet is %s", parts["xl/worksheets/sheet1.xml"])
+	}
+}
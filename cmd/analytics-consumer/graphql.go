@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/graphql"
+	"connect-four-backend/internal/kafka"
+)
+
+// newGraphQLSchema serves the consumer's aggregates to /graphql. The field
+// names are the ones the REST endpoints use in their JSON.
+func newGraphQLSchema(consumer *kafka.Consumer) *graphql.Schema {
+	winTypeCount := &graphql.Object{Name: "WinTypeCount", Fields: []*graphql.Field{
+		{Name: "win_type", Type: graphql.NonNullOf(graphql.String)},
+		{Name: "count", Type: graphql.NonNullOf(graphql.Int)},
+	}}
+	gameSummary := &graphql.Object{Name: "GameSummary", Fields: []*graphql.Field{
+		{Name: "total_games", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "completed_games", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "average_game_duration", Type: graphql.NonNullOf(graphql.Float), Description: "In seconds"},
+		{Name: "draw_count", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "bot_games", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "human_games", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "win_types", Type: nonNullList(winTypeCount), Description: "Games won each way, the most common first",
+			Resolve: func(_ context.Context, source interface{}, _ graphql.Args) (interface{}, error) {
+				return winTypeCounts(source.(kafka.GameSummary).WinTypeDistribution), nil
+			}},
+	}}
+
+	game := &graphql.Object{Name: "Game", Fields: []*graphql.Field{
+		{Name: "game_id", Type: graphql.NonNullOf(graphql.ID)},
+		{Name: "players", Type: nonNullList(graphql.String)},
+		{Name: "start_time", Type: graphql.NonNullOf(graphql.String)},
+		{Name: "end_time", Type: graphql.String},
+		{Name: "winner", Type: graphql.String, Description: "Null for a draw or a game in progress",
+			Resolve: func(_ context.Context, source interface{}, _ graphql.Args) (interface{}, error) {
+				if winner := source.(*kafka.ActiveGame).Winner; winner != "" {
+					return winner, nil
+				}
+				return nil, nil
+			}},
+		{Name: "duration", Type: graphql.NonNullOf(graphql.Int), Description: "In seconds, once completed"},
+		{Name: "move_count", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "last_move", Type: graphql.String},
+		{Name: "is_completed", Type: graphql.NonNullOf(graphql.Boolean)},
+	}}
+	gamePage := pageObject("GamePage", "games", game)
+
+	player := &graphql.Object{Name: "Player", Fields: []*graphql.Field{
+		{Name: "name", Type: graphql.NonNullOf(graphql.String)},
+		{Name: "games_played", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "games_won", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "games_lost", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "games_drawn", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "win_rate", Type: graphql.NonNullOf(graphql.Float)},
+		{Name: "total_moves", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "total_game_time", Type: graphql.NonNullOf(graphql.Int), Description: "In seconds"},
+		{Name: "average_game_time", Type: graphql.NonNullOf(graphql.Float), Description: "In seconds"},
+		{Name: "disconnections", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "reconnections", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "total_offline_time", Type: graphql.NonNullOf(graphql.Float), Description: "In seconds",
+			Resolve: func(_ context.Context, source interface{}, _ graphql.Args) (interface{}, error) {
+				return source.(kafka.PlayerStats).TotalOfflineTime.Seconds(), nil
+			}},
+		{Name: "first_seen", Type: graphql.NonNullOf(graphql.String)},
+		{Name: "last_seen", Type: graphql.NonNullOf(graphql.String)},
+		{Name: "is_active", Type: graphql.NonNullOf(graphql.Boolean), Description: "Seen in the last day"},
+		{Name: "current_streak", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "longest_streak", Type: graphql.NonNullOf(graphql.Int)},
+	}}
+	playerPage := pageObject("PlayerPage", "players", player)
+	playerSummary := &graphql.Object{Name: "PlayerSummary", Fields: []*graphql.Field{
+		{Name: "total_players", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "active_players", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "new_players_today", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "total_moves", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "total_disconnections", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "total_reconnections", Type: graphql.NonNullOf(graphql.Int)},
+	}}
+
+	winner := &graphql.Object{Name: "Winner", Fields: []*graphql.Field{
+		{Name: "name", Type: graphql.NonNullOf(graphql.String)},
+		{Name: "wins", Type: graphql.NonNullOf(graphql.Int)},
+	}}
+	winnerPage := pageObject("WinnerPage", "winners", winner)
+	streak := &graphql.Object{Name: "Streak", Fields: []*graphql.Field{
+		{Name: "player", Type: graphql.NonNullOf(graphql.String)},
+		{Name: "streak", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "games_played", Type: graphql.NonNullOf(graphql.Int)},
+	}}
+	streakLeaderboard := &graphql.Object{Name: "StreakLeaderboard", Fields: []*graphql.Field{
+		{Name: "current", Type: nonNullList(streak), Description: "Ranked by the streak players are on"},
+		{Name: "longest", Type: nonNullList(streak), Description: "Ranked by the longest streak players had"},
+	}}
+
+	hourlyPoint := &graphql.Object{Name: "HourlyPoint", Fields: []*graphql.Field{
+		{Name: "hour", Type: graphql.NonNullOf(graphql.String), Description: "Like 2024-01-01-15"},
+		{Name: "games", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "moves", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "players", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "average_duration", Type: graphql.NonNullOf(graphql.Float)},
+	}}
+	dailyPoint := &graphql.Object{Name: "DailyPoint", Fields: []*graphql.Field{
+		{Name: "day", Type: graphql.NonNullOf(graphql.String), Description: "Like 2024-01-01"},
+		{Name: "games", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "moves", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "players", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "new_players", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "average_duration", Type: graphql.NonNullOf(graphql.Float)},
+	}}
+
+	gameStatus := &graphql.Enum{Name: "GameStatus", Values: []string{"ACTIVE", "COMPLETED"}}
+	playerOrder := &graphql.Enum{Name: "PlayerOrder", Description: "Ties go to more wins, then to the name",
+		Values: []string{"WINS", "WIN_RATE", "GAMES_PLAYED", "LONGEST_STREAK", "LAST_SEEN"}}
+
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{Name: "game_summary", Type: graphql.NonNullOf(gameSummary),
+			Resolve: func(context.Context, interface{}, graphql.Args) (interface{}, error) {
+				return consumer.GetGameSummary(), nil
+			}},
+		{Name: "games", Type: graphql.NonNullOf(gamePage), Description: "Games still tracked, the latest started first",
+			Args: append([]*graphql.Arg{
+				{Name: "status", Type: gameStatus},
+				{Name: "player", Type: graphql.String, Description: "Only the games the player is in"},
+			}, pageArgs()...),
+			Resolve: func(_ context.Context, _ interface{}, args graphql.Args) (interface{}, error) {
+				limit, offset, err := pageOfArgs(args)
+				if err != nil {
+					return nil, err
+				}
+				var filter kafka.GameFilter
+				filter.Player, _ = args.String("player")
+				if status, ok := args.String("status"); ok {
+					completed := status == "COMPLETED"
+					filter.Completed = &completed
+				}
+				return consumer.FindGames(filter, limit, offset), nil
+			}},
+		{Name: "game", Type: game, Args: []*graphql.Arg{{Name: "id", Type: graphql.NonNullOf(graphql.ID)}},
+			Resolve: func(_ context.Context, _ interface{}, args graphql.Args) (interface{}, error) {
+				id, _ := args.String("id")
+				if game, found := consumer.GetGame(id); found {
+					return game, nil
+				}
+				return nil, nil
+			}},
+		{Name: "player_summary", Type: graphql.NonNullOf(playerSummary),
+			Resolve: func(context.Context, interface{}, graphql.Args) (interface{}, error) {
+				return consumer.GetPlayerSummary(), nil
+			}},
+		{Name: "player", Type: player, Description: "Null for a player not in memory",
+			Args: []*graphql.Arg{{Name: "name", Type: graphql.NonNullOf(graphql.String)}},
+			Resolve: func(_ context.Context, _ interface{}, args graphql.Args) (interface{}, error) {
+				name, _ := args.String("name")
+				if stats, found := consumer.GetPlayerStats(name); found {
+					return stats, nil
+				}
+				return nil, nil
+			}},
+		{Name: "players", Type: graphql.NonNullOf(playerPage),
+			Args: append([]*graphql.Arg{
+				{Name: "order_by", Type: playerOrder, Default: "WINS"},
+				{Name: "name_prefix", Type: graphql.String},
+				{Name: "min_games", Type: graphql.Int},
+				{Name: "active", Type: graphql.Boolean},
+			}, pageArgs()...),
+			Resolve: func(_ context.Context, _ interface{}, args graphql.Args) (interface{}, error) {
+				limit, offset, err := pageOfArgs(args)
+				if err != nil {
+					return nil, err
+				}
+				var filter kafka.PlayerFilter
+				order, _ := args.String("order_by")
+				filter.OrderBy = kafka.PlayerOrder(strings.ToLower(order))
+				filter.NamePrefix, _ = args.String("name_prefix")
+				minGames, _ := args.Int("min_games")
+				filter.MinGames = int64(minGames)
+				if active, ok := args.Bool("active"); ok {
+					filter.Active = &active
+				}
+				return consumer.FindPlayers(filter, limit, offset), nil
+			}},
+		{Name: "winners", Type: graphql.NonNullOf(winnerPage), Description: "Players ranked by games won",
+			Args: pageArgs(),
+			Resolve: func(_ context.Context, _ interface{}, args graphql.Args) (interface{}, error) {
+				limit, offset, err := pageOfArgs(args)
+				if err != nil {
+					return nil, err
+				}
+				return consumer.GetWinners(limit, offset), nil
+			}},
+		{Name: "streaks", Type: graphql.NonNullOf(streakLeaderboard),
+			Args: []*graphql.Arg{{Name: "limit", Type: graphql.Int, Default: defaultPageLimit}},
+			Resolve: func(_ context.Context, _ interface{}, args graphql.Args) (interface{}, error) {
+				limit, _ := args.Int("limit")
+				if limit <= 0 || limit > maxPageLimit {
+					return nil, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+				}
+				return consumer.GetStreakLeaderboard(limit), nil
+			}},
+		{Name: "hourly", Type: nonNullList(hourlyPoint), Description: "Every hour in the range, newest first",
+			Args: seriesArgs("hours", 24, "2024-01-01-15"),
+			Resolve: func(_ context.Context, _ interface{}, args graphql.Args) (interface{}, error) {
+				from, to, err := seriesRange(args, "hours", hourLayout, time.Hour)
+				if err != nil {
+					return nil, err
+				}
+				return consumer.GetHourlySeries(from, to), nil
+			}},
+		{Name: "daily", Type: nonNullList(dailyPoint), Description: "Every day in the range, newest first",
+			Args: seriesArgs("days", 7, "2024-01-01"),
+			Resolve: func(_ context.Context, _ interface{}, args graphql.Args) (interface{}, error) {
+				from, to, err := seriesRange(args, "days", dayLayout, 24*time.Hour)
+				if err != nil {
+					return nil, err
+				}
+				return consumer.GetDailySeries(from, to), nil
+			}},
+	}}
+
+	schema, err := graphql.NewSchema(query)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+func nonNullList(item graphql.Type) graphql.Type {
+	return graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(item)))
+}
+
+// pageObject is a page of items, like kafka.PlayerPage, under the key
+func pageObject(name, key string, item *graphql.Object) *graphql.Object {
+	return &graphql.Object{Name: name, Fields: []*graphql.Field{
+		{Name: key, Type: nonNullList(item)},
+		{Name: "total", Type: graphql.NonNullOf(graphql.Int), Description: "Items on every page"},
+		{Name: "limit", Type: graphql.NonNullOf(graphql.Int)},
+		{Name: "offset", Type: graphql.NonNullOf(graphql.Int)},
+	}}
+}
+
+func pageArgs() []*graphql.Arg {
+	return []*graphql.Arg{
+		{Name: "limit", Type: graphql.Int, Default: defaultPageLimit, Description: "At most 100"},
+		{Name: "offset", Type: graphql.Int, Default: 0},
+	}
+}
+
+// pageOfArgs reads the limit and offset with the bounds pageParams has
+func pageOfArgs(args graphql.Args) (limit, offset int, err error) {
+	limit, _ = args.Int("limit")
+	offset, _ = args.Int("offset")
+	if limit <= 0 || limit > maxPageLimit {
+		return 0, 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+	}
+	if offset < 0 {
+		return 0, 0, errors.New("offset must be zero or more")
+	}
+	return limit, offset, nil
+}
+
+func seriesArgs(count string, defaultCount int, example string) []*graphql.Arg {
+	return []*graphql.Arg{
+		{Name: "from", Type: graphql.String, Description: "An RFC 3339 time or a key like " + example},
+		{Name: "to", Type: graphql.String, Description: "Now by default"},
+		{Name: count, Type: graphql.Int, Default: defaultCount, Description: "How many before to, without from"},
+	}
+}
+
+// seriesRange reads the range of an hourly or daily series like timeRange
+func seriesRange(args graphql.Args, count, layout string, unit time.Duration) (from, to time.Time, err error) {
+	n, _ := args.Int(count)
+	if n <= 0 {
+		return from, to, errors.New(count + " must be more than zero")
+	}
+	fromValue, _ := args.String("from")
+	toValue, _ := args.String("to")
+	return parseRange(fromValue, toValue, layout, time.Duration(n-1)*unit)
+}
+
+// winTypeCounts lists the win types, the most common first
+func winTypeCounts(distribution map[string]int64) []map[string]interface{} {
+	counts := make([]map[string]interface{}, 0, len(distribution))
+	for winType, count := range distribution {
+		counts = append(counts, map[string]interface{}{"win_type": winType, "count": count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i]["count"].(int64) != counts[j]["count"].(int64) {
+			return counts[i]["count"].(int64) > counts[j]["count"].(int64)
+		}
+		return counts[i]["win_type"].(string) < counts[j]["win_type"].(string)
+	})
+	return counts
+}
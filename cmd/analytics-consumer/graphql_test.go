@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"connect-four-backend/internal/graphql"
+	"connect-four-backend/internal/kafka"
+)
+
+// newTestConsumer is a consumer that hasn't read any events, it is never started
+func newTestConsumer(t *testing.T) *kafka.Consumer {
+	config := kafka.DefaultConsumerConfig([]string{"localhost:9092"})
+	config.GroupID = ""
+	config.DeadLetterTopic = ""
+	consumer, err := kafka.NewConsumer(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consumer
+}
+
+func TestGraphQLSchema(t *testing.T) {
+	schema := newGraphQLSchema(newTestConsumer(t))
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		want      string
+	}{
+		{"the README's example",
+			`{ players(order_by: WIN_RATE, min_games: 10, limit: 5) { total players { name win_rate } } game_summary { total_games } }`, nil,
+			`{"data":{"players":{"total":0,"players":[]},"game_summary":{"total_games":0}}}`},
+		{"page defaults", `{ games { total limit offset } winners(offset: 20) { limit offset } }`, nil,
+			`{"data":{"games":{"total":0,"limit":10,"offset":0},"winners":{"limit":10,"offset":20}}}`},
+		{"variables and fragments",
+			`query ($status: GameStatus, $player: String) { games(status: $status, player: $player) { ...Page } }
+fragment Page on GamePage { total games { game_id winner } }`,
+			map[string]interface{}{"status": "COMPLETED", "player": "alice"},
+			`{"data":{"games":{"total":0,"games":[]}}}`},
+		{"a game or player not in memory", `{ game(id: "g1") { game_id } player(name: "alice") { name } }`, nil,
+			`{"data":{"game":null,"player":null}}`},
+		{"the streak leaderboard", `{ streaks(limit: 3) { current { player } longest { player } } }`, nil,
+			`{"data":{"streaks":{"current":[],"longest":[]}}}`},
+		{"a limit out of range nulls the root", `{ winners(limit: 500) { total } player_summary { total_players } }`, nil,
+			`{"data":null,"errors":[{"message":"limit must be between 1 and 100","locations":[{"line":1,"column":3}],"path":["winners"]}]}`},
+		{"a series with no range", `{ hourly(hours: 0) { hour } }`, nil,
+			`{"data":null,"errors":[{"message":"hours must be more than zero","locations":[{"line":1,"column":3}],"path":["hourly"]}]}`},
+		{"an unknown order", `{ players(order_by: LOSSES) { total } }`, nil,
+			`{"errors":[{"message":"Argument \"order_by\" of \"players\" has an invalid value: expected one of WINS, WIN_RATE, GAMES_PLAYED, LONGEST_STREAK, LAST_SEEN, got LOSSES","locations":[{"line":1,"column":11}]}]}`},
+		{"a REST name that isn't a field", `{ game_summary { win_type_distribution } }`, nil,
+			`{"errors":[{"message":"Cannot query field \"win_type_distribution\" on type GameSummary","locations":[{"line":1,"column":18}]}]}`},
+		{"a variable of the wrong type", `query ($limit: Int) { players(limit: $limit) { total } }`, map[string]interface{}{"limit": "5"},
+			`{"errors":[{"message":"Variable $limit got an invalid value: expected Int, got \"5\"","locations":[{"line":1,"column":8}]}]}`},
+	}
+	for _, tt := range tests {
+		response := schema.Execute(context.Background(), graphql.Request{Query: tt.query, Variables: tt.variables})
+		got, err := json.Marshal(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGraphQLSchemaSDL(t *testing.T) {
+	sdl := newGraphQLSchema(newTestConsumer(t)).SDL()
+	for _, want := range []string{
+		"  games(status: GameStatus, player: String, limit: Int = 10, offset: Int = 0): GamePage!\n",
+		"  players(order_by: PlayerOrder = WINS, name_prefix: String, min_games: Int, active: Boolean, limit: Int = 10, offset: Int = 0): PlayerPage!\n",
+		"  hourly(from: String, to: String, hours: Int = 24): [HourlyPoint!]!\n",
+		"enum GameStatus {\n  ACTIVE\n  COMPLETED\n}\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("SDL is missing %q:\n%s", want, sdl)
+		}
+	}
+}
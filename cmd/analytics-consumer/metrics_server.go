@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"connect-four-backend/internal/auth"
+	"connect-four-backend/internal/graphql"
 	"connect-four-backend/internal/kafka"
+	"connect-four-backend/internal/metrics"
 
 	"github.com/gorilla/mux"
 )
@@ -17,8 +21,12 @@ import (
 // MetricsServer provides HTTP API for analytics metrics
 type MetricsServer struct {
 	consumer *kafka.Consumer
+	registry *metrics.Registry
 	server   *http.Server
 	router   *mux.Router
+	stream   *metricsStream
+	auth     *apiAuth
+	graphql  *graphql.Schema
 }
 
 // MetricsResponse represents the structure of metrics API responses
@@ -29,13 +37,16 @@ type MetricsResponse struct {
 	Error     string      `json:"error,omitempty"`
 }
 
-// NewMetricsServer creates a new metrics API server
-func NewMetricsServer(consumer *kafka.Consumer, addr string) *MetricsServer {
+// NewMetricsServer creates a new metrics API server, serving the registry's
+// metrics to Prometheus and pushing live metrics to WebSocket clients every
+// pushInterval. Clients authenticate and call it from pages as authConfig says.
+func NewMetricsServer(consumer *kafka.Consumer, registry *metrics.Registry, addr string, pushInterval time.Duration, authConfig AuthConfig) *MetricsServer {
 	router := mux.NewRouter()
+	cors := newCORSPolicy(authConfig.AllowedOrigins)
 	
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      router,
+		Handler:      cors.handler(router),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -43,8 +54,12 @@ func NewMetricsServer(consumer *kafka.Consumer, addr string) *MetricsServer {
 
 	ms := &MetricsServer{
 		consumer: consumer,
+		registry: registry,
 		server:   server,
 		router:   router,
+		stream:   newMetricsStream(consumer, pushInterval, cors.checkOrigin),
+		auth:     newAPIAuth(authConfig),
+		graphql:  newGraphQLSchema(consumer),
 	}
 
 	ms.setupRoutes()
@@ -54,6 +69,7 @@ func NewMetricsServer(consumer *kafka.Consumer, addr string) *MetricsServer {
 // Start starts the metrics server
 func (ms *MetricsServer) Start() error {
 	log.Printf("Starting metrics API server on %s", ms.server.Addr)
+	go ms.stream.run()
 	return ms.server.ListenAndServe()
 }
 
@@ -61,59 +77,81 @@ func (ms *MetricsServer) Start() error {
 func (ms *MetricsServer) Stop() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	// Shutdown doesn't wait for hijacked connections
+	ms.stream.close()
 	return ms.server.Shutdown(ctx)
 }
 
-// setupRoutes configures all API routes
+// setupRoutes configures all API routes. The health check is open, the
+// metrics need the read role and reviewing flagged players the admin role.
 func (ms *MetricsServer) setupRoutes() {
-	// Add CORS middleware
-	ms.router.Use(ms.corsMiddleware)
 	ms.router.Use(ms.loggingMiddleware)
 
 	// Health check
 	ms.router.HandleFunc("/health", ms.handleHealth).Methods("GET")
 
+	read := ms.router.NewRoute().Subrouter()
+	read.Use(ms.requireRole(auth.RoleRead))
+	admin := ms.router.NewRoute().Subrouter()
+	admin.Use(ms.requireRole(auth.RoleAdmin))
+
 	// Consumer statistics
-	ms.router.HandleFunc("/api/consumer/stats", ms.handleConsumerStats).Methods("GET")
+	read.HandleFunc("/api/consumer/stats", ms.handleConsumerStats).Methods("GET")
+	read.HandleFunc("/api/consumer/lag", ms.handleConsumerLag).Methods("GET")
+	read.HandleFunc("/api/consumer/memory", ms.handleConsumerMemory).Methods("GET")
+
+	// Alerts firing on the consumer's metrics
+	read.HandleFunc("/api/alerts", ms.handleAlerts).Methods("GET")
 
 	// Game metrics
-	ms.router.HandleFunc("/api/metrics/games", ms.handleGameMetrics).Methods("GET")
-	ms.router.HandleFunc("/api/metrics/games/winners", ms.handleTopWinners).Methods("GET")
-	ms.router.HandleFunc("/api/metrics/games/duration", ms.handleGameDuration).Methods("GET")
+	read.HandleFunc("/api/metrics/games", ms.handleGameMetrics).Methods("GET")
+	read.HandleFunc("/api/metrics/games/winners", ms.handleTopWinners).Methods("GET")
+	read.HandleFunc("/api/metrics/games/duration", ms.handleGameDuration).Methods("GET")
+	read.HandleFunc("/api/metrics/games/winners/export", ms.handleWinnersExport).Methods("GET")
 
 	// Player metrics
-	ms.router.HandleFunc("/api/metrics/players", ms.handlePlayerMetrics).Methods("GET")
-	ms.router.HandleFunc("/api/metrics/players/top", ms.handleTopPlayers).Methods("GET")
-	ms.router.HandleFunc("/api/metrics/players/{name}", ms.handlePlayerStats).Methods("GET")
+	read.HandleFunc("/api/metrics/players", ms.handlePlayerMetrics).Methods("GET")
+	read.HandleFunc("/api/metrics/players/top", ms.handleTopPlayers).Methods("GET")
+	read.HandleFunc("/api/metrics/players/top/export", ms.handleTopPlayersExport).Methods("GET")
+	read.HandleFunc("/api/metrics/players/{name}", ms.handlePlayerStats).Methods("GET")
 
 	// Time-based metrics
-	ms.router.HandleFunc("/api/metrics/hourly", ms.handleHourlyMetrics).Methods("GET")
-	ms.router.HandleFunc("/api/metrics/daily", ms.handleDailyMetrics).Methods("GET")
+	read.HandleFunc("/api/metrics/hourly", ms.handleHourlyMetrics).Methods("GET")
+	read.HandleFunc("/api/metrics/daily", ms.handleDailyMetrics).Methods("GET")
+	read.HandleFunc("/api/metrics/hourly/export", ms.handleHourlyExport).Methods("GET")
+	read.HandleFunc("/api/metrics/daily/export", ms.handleDailyExport).Methods("GET")
+
+	// Matchmaking queue depth and wait times
+	read.HandleFunc("/api/metrics/queues", ms.handleQueueMetrics).Methods("GET")
+	read.HandleFunc("/api/metrics/distributions", ms.handleDistributions).Methods("GET")
+	read.HandleFunc("/api/metrics/heatmap", ms.handleHeatmap).Methods("GET")
+	read.HandleFunc("/api/metrics/openings", ms.handleOpenings).Methods("GET")
+	read.HandleFunc("/api/metrics/retention", ms.handleRetention).Methods("GET")
+	read.HandleFunc("/api/metrics/concurrency", ms.handleConcurrency).Methods("GET")
+	read.HandleFunc("/api/metrics/streaks", ms.handleStreaks).Methods("GET")
+	read.HandleFunc("/api/metrics/global", ms.handleGlobalMetrics).Methods("GET")
+
+	// Review of players flagged for cheating
+	admin.HandleFunc("/api/review/flags", ms.handlePlayerFlags).Methods("GET")
+	admin.HandleFunc("/api/review/flags/{id}", ms.handleReviewFlag).Methods("POST")
+
+	// Prometheus scrape endpoint
+	read.Handle("/metrics", ms.registry.Handler()).Methods("GET")
 
 	// Real-time metrics
-	ms.router.HandleFunc("/api/metrics/realtime", ms.handleRealtimeMetrics).Methods("GET")
+	read.HandleFunc("/api/metrics/realtime", ms.handleRealtimeMetrics).Methods("GET")
+	read.HandleFunc("/ws/metrics", ms.stream.handle).Methods("GET")
 
 	// Dashboard data
-	ms.router.HandleFunc("/api/dashboard", ms.handleDashboard).Methods("GET")
+	read.HandleFunc("/api/dashboard", ms.handleDashboard).Methods("GET")
+
+	// GraphQL queries over the same metrics
+	read.Handle("/graphql", ms.graphql.Handler()).Methods("GET", "POST")
+	read.HandleFunc("/graphql/schema", ms.handleGraphQLSchema).Methods("GET")
 }
 
 // Middleware
 
-func (ms *MetricsServer) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (ms *MetricsServer) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -127,12 +165,19 @@ func (ms *MetricsServer) loggingMiddleware(next http.Handler) http.Handler {
 func (ms *MetricsServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	stats := ms.consumer.GetStats()
 	
+	// Still serving, but falling behind the events being written
+	status := "healthy"
+	if stats.LagExceeded {
+		status = "degraded"
+	}
+
 	health := map[string]interface{}{
-		"status":             "healthy",
+		"status":             status,
 		"uptime":             stats.Uptime.String(),
 		"messages_processed": stats.MessagesProcessed,
 		"messages_errored":   stats.MessagesErrored,
 		"last_message":       stats.LastMessageTime,
+		"lag":                stats.TotalLag,
 	}
 
 	ms.writeResponse(w, http.StatusOK, health)
@@ -143,248 +188,229 @@ func (ms *MetricsServer) handleConsumerStats(w http.ResponseWriter, r *http.Requ
 	ms.writeResponse(w, http.StatusOK, stats)
 }
 
-func (ms *MetricsServer) handleGameMetrics(w http.ResponseWriter, r *http.Request) {
-	// This would need access to the processor's aggregator
-	// For now, return mock data structure
-	gameMetrics := map[string]interface{}{
-		"total_games":          1000,
-		"completed_games":      950,
-		"average_duration":     180.5,
-		"draw_count":          95,
-		"bot_games":           300,
-		"human_games":         700,
-		"win_type_distribution": map[string]int{
-			"horizontal": 400,
-			"vertical":   300,
-			"diagonal":   250,
-		},
-	}
+func (ms *MetricsServer) handleConsumerLag(w http.ResponseWriter, r *http.Request) {
+	stats := ms.consumer.GetStats()
+	ms.writeResponse(w, http.StatusOK, map[string]interface{}{
+		"total_lag":  stats.TotalLag,
+		"exceeded":   stats.LagExceeded,
+		"checked_at": stats.LagCheckedAt,
+		"partitions": stats.Partitions,
+	})
+}
 
-	ms.writeResponse(w, http.StatusOK, gameMetrics)
+func (ms *MetricsServer) handleConsumerMemory(w http.ResponseWriter, r *http.Request) {
+	stats := ms.consumer.GetMemoryStats()
+	ms.writeResponse(w, http.StatusOK, &stats)
 }
 
-func (ms *MetricsServer) handleTopWinners(w http.ResponseWriter, r *http.Request) {
-	limitStr := r.URL.Query().Get("limit")
-	limit := 10
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
-	}
+func (ms *MetricsServer) handleQueueMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := ms.consumer.GetQueueMetrics()
+	ms.writeResponse(w, http.StatusOK, metrics.Queues)
+}
 
-	// Mock data - in real implementation, get from aggregator
-	topWinners := []map[string]interface{}{
-		{"name": "Alice", "wins": 45, "games": 60, "win_rate": 75.0},
-		{"name": "Bob", "wins": 38, "games": 55, "win_rate": 69.1},
-		{"name": "Charlie", "wins": 32, "games": 50, "win_rate": 64.0},
-		{"name": "Diana", "wins": 28, "games": 45, "win_rate": 62.2},
-		{"name": "Eve", "wins": 25, "games": 42, "win_rate": 59.5},
-	}
+func (ms *MetricsServer) handleDistributions(w http.ResponseWriter, r *http.Request) {
+	ms.writeResponse(w, http.StatusOK, ms.consumer.GetDistributions())
+}
 
-	if len(topWinners) > limit {
-		topWinners = topWinners[:limit]
-	}
+func (ms *MetricsServer) handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	metrics := ms.consumer.GetColumnMetrics()
+	ms.writeResponse(w, http.StatusOK, &metrics)
+}
 
-	ms.writeResponse(w, http.StatusOK, topWinners)
+func (ms *MetricsServer) handleOpenings(w http.ResponseWriter, r *http.Request) {
+	metrics := ms.consumer.GetOpeningMetrics()
+	ms.writeResponse(w, http.StatusOK, &metrics)
 }
 
-func (ms *MetricsServer) handleGameDuration(w http.ResponseWriter, r *http.Request) {
-	durationStats := map[string]interface{}{
-		"average_duration":    180.5,
-		"median_duration":     165.0,
-		"min_duration":        45.0,
-		"max_duration":        600.0,
-		"duration_buckets": map[string]int{
-			"0-60s":    50,
-			"60-120s":  200,
-			"120-180s": 300,
-			"180-300s": 250,
-			"300s+":    150,
-		},
-	}
+func (ms *MetricsServer) handleRetention(w http.ResponseWriter, r *http.Request) {
+	metrics := ms.consumer.GetRetentionMetrics()
+	ms.writeResponse(w, http.StatusOK, &metrics)
+}
 
-	ms.writeResponse(w, http.StatusOK, durationStats)
+func (ms *MetricsServer) handleConcurrency(w http.ResponseWriter, r *http.Request) {
+	metrics := ms.consumer.GetConcurrencyMetrics()
+	ms.writeResponse(w, http.StatusOK, &metrics)
 }
 
-func (ms *MetricsServer) handlePlayerMetrics(w http.ResponseWriter, r *http.Request) {
-	playerMetrics := map[string]interface{}{
-		"total_players":        500,
-		"active_players":       150,
-		"new_players_today":    25,
-		"total_moves":          50000,
-		"total_disconnections": 200,
-		"total_reconnections":  180,
-		"average_session_time": 1200.0,
+func (ms *MetricsServer) handleStreaks(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
 	}
 
-	ms.writeResponse(w, http.StatusOK, playerMetrics)
+	leaderboard := ms.consumer.GetStreakLeaderboard(limit)
+	ms.writeResponse(w, http.StatusOK, &leaderboard)
 }
 
-func (ms *MetricsServer) handleTopPlayers(w http.ResponseWriter, r *http.Request) {
-	limitStr := r.URL.Query().Get("limit")
-	limit := 10
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
-	}
+func (ms *MetricsServer) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := ms.consumer.GetAlerts()
+	ms.writeResponse(w, http.StatusOK, &alerts)
+}
 
-	// Mock data - in real implementation, get from player tracker
-	topPlayers := []map[string]interface{}{
-		{
-			"name":           "Alice",
-			"games_played":   60,
-			"games_won":      45,
-			"win_rate":       75.0,
-			"total_moves":    1200,
-			"avg_game_time":  180.0,
-			"is_online":      true,
-		},
-		{
-			"name":           "Bob",
-			"games_played":   55,
-			"games_won":      38,
-			"win_rate":       69.1,
-			"total_moves":    1100,
-			"avg_game_time":  175.0,
-			"is_online":      false,
-		},
+func (ms *MetricsServer) handlePlayerFlags(w http.ResponseWriter, r *http.Request) {
+	flags := ms.consumer.GetPlayerFlags(r.URL.Query().Get("status"))
+	ms.writeResponse(w, http.StatusOK, flags)
+}
+
+func (ms *MetricsServer) handleGlobalMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics, err := ms.consumer.GetGlobalMetrics()
+	switch {
+	case errors.Is(err, kafka.ErrSharedCountersDisabled):
+		ms.writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		ms.writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		ms.writeResponse(w, http.StatusOK, &metrics)
 	}
+}
 
-	if len(topPlayers) > limit {
-		topPlayers = topPlayers[:limit]
+func (ms *MetricsServer) handleReviewFlag(w http.ResponseWriter, r *http.Request) {
+	var review struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		ms.writeError(w, http.StatusBadRequest, "Invalid review: "+err.Error())
+		return
 	}
 
-	ms.writeResponse(w, http.StatusOK, topPlayers)
+	flag, err := ms.consumer.ReviewPlayerFlag(mux.Vars(r)["id"], review.Status, review.Note)
+	switch {
+	case errors.Is(err, kafka.ErrFlagNotFound):
+		ms.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, kafka.ErrInvalidFlagStatus):
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		ms.writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		ms.writeResponse(w, http.StatusOK, &flag)
+	}
 }
 
-func (ms *MetricsServer) handlePlayerStats(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	playerName := vars["name"]
-
-	// Mock data - in real implementation, get from player tracker
-	playerStats := map[string]interface{}{
-		"name":              playerName,
-		"games_played":      60,
-		"games_won":         45,
-		"games_lost":        12,
-		"games_drawn":       3,
-		"win_rate":          75.0,
-		"total_moves":       1200,
-		"avg_game_time":     180.0,
-		"total_game_time":   10800,
-		"disconnections":    5,
-		"reconnections":     4,
-		"total_offline_time": "2m30s",
-		"first_seen":        "2024-01-01T10:00:00Z",
-		"last_seen":         "2024-01-04T15:30:00Z",
-		"is_online":         true,
+// handleGraphQLSchema serves the schema of /graphql, which doesn't answer
+// introspection queries
+func (ms *MetricsServer) handleGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := io.WriteString(w, ms.graphql.SDL()); err != nil {
+		log.Printf("Failed to write GraphQL schema: %v", err)
 	}
+}
 
-	ms.writeResponse(w, http.StatusOK, playerStats)
+func (ms *MetricsServer) handleGameMetrics(w http.ResponseWriter, r *http.Request) {
+	summary := ms.consumer.GetGameSummary()
+	ms.writeResponse(w, http.StatusOK, &summary)
 }
 
-func (ms *MetricsServer) handleHourlyMetrics(w http.ResponseWriter, r *http.Request) {
-	hoursStr := r.URL.Query().Get("hours")
-	hours := 24
-	if hoursStr != "" {
-		if h, err := strconv.Atoi(hoursStr); err == nil && h > 0 {
-			hours = h
-		}
+func (ms *MetricsServer) handleTopWinners(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Mock hourly data
-	hourlyMetrics := make([]map[string]interface{}, hours)
-	now := time.Now()
-	
-	for i := 0; i < hours; i++ {
-		hourTime := now.Add(-time.Duration(i) * time.Hour)
-		hourlyMetrics[i] = map[string]interface{}{
-			"hour":             hourTime.Format("2006-01-02-15"),
-			"games_started":    10 + i%5,
-			"games_completed":  8 + i%4,
-			"total_moves":      200 + i*10,
-			"unique_players":   15 + i%3,
-			"avg_duration":     180.0 + float64(i%30),
-		}
-	}
+	winners := ms.consumer.GetWinners(limit, offset)
+	ms.writeResponse(w, http.StatusOK, &winners)
+}
 
-	ms.writeResponse(w, http.StatusOK, hourlyMetrics)
+func (ms *MetricsServer) handleGameDuration(w http.ResponseWriter, r *http.Request) {
+	games := ms.consumer.GetGameSummary()
+	durations := ms.consumer.GetDistributions().GameDuration
+
+	// In seconds, the percentiles interpolated within the histogram's buckets
+	ms.writeResponse(w, http.StatusOK, map[string]interface{}{
+		"completed_games":  games.CompletedGames,
+		"average_duration": games.AverageGameDuration,
+		"median_duration":  durations.P50,
+		"p90_duration":     durations.P90,
+		"p99_duration":     durations.P99,
+		"duration_buckets": durations.Buckets,
+	})
 }
 
-func (ms *MetricsServer) handleDailyMetrics(w http.ResponseWriter, r *http.Request) {
-	daysStr := r.URL.Query().Get("days")
-	days := 7
-	if daysStr != "" {
-		if d, err := strconv.Atoi(daysStr); err == nil && d > 0 {
-			days = d
-		}
+func (ms *MetricsServer) handlePlayerMetrics(w http.ResponseWriter, r *http.Request) {
+	summary := ms.consumer.GetPlayerSummary()
+	ms.writeResponse(w, http.StatusOK, &summary)
+}
+
+func (ms *MetricsServer) handleTopPlayers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// Mock daily data
-	dailyMetrics := make([]map[string]interface{}, days)
-	now := time.Now()
-	
-	for i := 0; i < days; i++ {
-		dayTime := now.Add(-time.Duration(i) * 24 * time.Hour)
-		dailyMetrics[i] = map[string]interface{}{
-			"day":              dayTime.Format("2006-01-02"),
-			"games_started":    200 + i*20,
-			"games_completed":  180 + i*18,
-			"total_moves":      4000 + i*400,
-			"unique_players":   100 + i*10,
-			"new_players":      20 + i*2,
-			"avg_duration":     185.0 + float64(i*5),
-		}
+	players := ms.consumer.GetTopPlayers(limit, offset)
+	ms.writeResponse(w, http.StatusOK, &players)
+}
+
+func (ms *MetricsServer) handlePlayerStats(w http.ResponseWriter, r *http.Request) {
+	playerName := mux.Vars(r)["name"]
+
+	stats, found := ms.consumer.GetPlayerStats(playerName)
+	if !found {
+		ms.writeError(w, http.StatusNotFound, "Player not found: "+playerName)
+		return
 	}
+	ms.writeResponse(w, http.StatusOK, &stats)
+}
 
-	ms.writeResponse(w, http.StatusOK, dailyMetrics)
+func (ms *MetricsServer) handleHourlyMetrics(w http.ResponseWriter, r *http.Request) {
+	from, to, err := hourlyRange(r)
+	if err != nil {
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ms.writeResponse(w, http.StatusOK, ms.consumer.GetHourlySeries(from, to))
 }
 
-func (ms *MetricsServer) handleRealtimeMetrics(w http.ResponseWriter, r *http.Request) {
-	realtimeMetrics := map[string]interface{}{
-		"active_games":       25,
-		"online_players":     75,
-		"games_this_hour":    12,
-		"moves_this_hour":    240,
-		"avg_response_time":  150.0,
-		"server_uptime":      "2d 14h 30m",
-		"last_updated":       time.Now(),
+func (ms *MetricsServer) handleDailyMetrics(w http.ResponseWriter, r *http.Request) {
+	from, to, err := dailyRange(r)
+	if err != nil {
+		ms.writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	ms.writeResponse(w, http.StatusOK, ms.consumer.GetDailySeries(from, to))
+}
 
-	ms.writeResponse(w, http.StatusOK, realtimeMetrics)
+func (ms *MetricsServer) handleRealtimeMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := ms.consumer.GetLiveMetrics()
+	ms.writeResponse(w, http.StatusOK, &metrics)
 }
 
 func (ms *MetricsServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	live := ms.consumer.GetLiveMetrics()
+	games := ms.consumer.GetGameSummary()
+	players := ms.consumer.GetPlayerSummary()
+
+	recentActivity := []map[string]interface{}{}
+	for _, game := range ms.consumer.GetRecentGames(10) {
+		recentActivity = append(recentActivity, map[string]interface{}{
+			"type":      "game_completed",
+			"game_id":   game.GameID,
+			"players":   game.Players,
+			"winner":    game.Winner,
+			"duration":  game.Duration,
+			"timestamp": game.EndTime,
+		})
+	}
+
+	hourlyGames := make([]int64, len(live.RecentHours))
+	for i, hour := range live.RecentHours {
+		hourlyGames[i] = hour.Games
+	}
+
 	dashboard := map[string]interface{}{
 		"overview": map[string]interface{}{
-			"total_games":      1000,
-			"active_games":     25,
-			"total_players":    500,
-			"online_players":   75,
-			"games_today":      120,
-			"avg_duration":     180.5,
-		},
-		"recent_activity": []map[string]interface{}{
-			{
-				"type":      "game_completed",
-				"players":   []string{"Alice", "Bob"},
-				"winner":    "Alice",
-				"duration":  165,
-				"timestamp": time.Now().Add(-5 * time.Minute),
-			},
-			{
-				"type":      "player_joined",
-				"player":    "Charlie",
-				"timestamp": time.Now().Add(-10 * time.Minute),
-			},
+			"total_games":    games.TotalGames,
+			"active_games":   live.ActiveGames,
+			"total_players":  players.TotalPlayers,
+			"online_players": live.OnlinePlayers,
+			"games_today":    live.GamesToday,
+			"avg_duration":   games.AverageGameDuration,
 		},
-		"top_players": []map[string]interface{}{
-			{"name": "Alice", "wins": 45, "win_rate": 75.0},
-			{"name": "Bob", "wins": 38, "win_rate": 69.1},
-			{"name": "Charlie", "wins": 32, "win_rate": 64.0},
-		},
-		"hourly_games": []int{8, 12, 15, 18, 22, 25, 20, 16, 14, 10, 8, 12},
+		"recent_activity": recentActivity,
+		"top_players":     ms.consumer.GetTopPlayers(5, 0).Players,
+		"hourly_games":    hourlyGames, // the last 12 hours, oldest first
 	}
 
 	ms.writeResponse(w, http.StatusOK, dashboard)
@@ -417,4 +443,85 @@ func (ms *MetricsServer) writeResponse(w http.ResponseWriter, status int, data i
 
 func (ms *MetricsServer) writeError(w http.ResponseWriter, status int, message string) {
 	ms.writeResponse(w, status, message)
-}
\ No newline at end of file
+}
+
+const (
+	hourLayout = "2006-01-02-15"
+	dayLayout  = "2006-01-02"
+
+	defaultPageLimit = 10
+	maxPageLimit     = 100
+)
+
+// pageParams reads the limit, 10 by default and at most 100, and the offset
+func pageParams(r *http.Request) (limit, offset int, err error) {
+	query := r.URL.Query()
+	limit = defaultPageLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			return 0, 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be zero or more")
+		}
+	}
+	return limit, offset, nil
+}
+
+// hourlyRange reads the range of hours, the last hours (24 by default)
+// unless from or to is given
+func hourlyRange(r *http.Request) (from, to time.Time, err error) {
+	hours := 24
+	if h, err := strconv.Atoi(r.URL.Query().Get("hours")); err == nil && h > 0 {
+		hours = h
+	}
+	return timeRange(r, hourLayout, time.Duration(hours-1)*time.Hour)
+}
+
+// dailyRange reads the range of days, the last days (7 by default) unless
+// from or to is given
+func dailyRange(r *http.Request) (from, to time.Time, err error) {
+	days := 7
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && d > 0 {
+		days = d
+	}
+	return timeRange(r, dayLayout, time.Duration(days-1)*24*time.Hour)
+}
+
+// timeRange reads from and to, each an RFC 3339 time or a key in layout.
+// to defaults to now, and from to span before to.
+func timeRange(r *http.Request, layout string, span time.Duration) (from, to time.Time, err error) {
+	query := r.URL.Query()
+	return parseRange(query.Get("from"), query.Get("to"), layout, span)
+}
+
+// parseRange parses from and to like timeRange, either can be empty
+func parseRange(fromValue, toValue, layout string, span time.Duration) (from, to time.Time, err error) {
+	to = time.Now()
+	if toValue != "" {
+		if to, err = parseTime(toValue, layout); err != nil {
+			return from, to, errors.New("invalid to: " + toValue)
+		}
+	}
+	from = to.Add(-span)
+	if fromValue != "" {
+		if from, err = parseTime(fromValue, layout); err != nil {
+			return from, to, errors.New("invalid from: " + fromValue)
+		}
+	}
+	if from.After(to) {
+		return from, to, errors.New("from must not be after to")
+	}
+	return from, to, nil
+}
+
+func parseTime(value, layout string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Local(), nil
+	}
+	return time.ParseInLocation(layout, value, time.Local)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/kafka"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamWriteWait  = 10 * time.Second
+	streamPongWait   = 60 * time.Second
+	streamPingPeriod = streamPongWait * 9 / 10
+)
+
+// metricsStream pushes the live metrics to every /ws/metrics client. The
+// metrics are taken once per tick whatever the number of clients, and a
+// client still sending the last push skips the next rather than holding up
+// the others.
+type metricsStream struct {
+	consumer *kafka.Consumer
+	interval time.Duration
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	clients map[*streamClient]struct{}
+	stop    chan struct{}
+}
+
+// streamClient is a dashboard connected to /ws/metrics
+type streamClient struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMetricsStream(consumer *kafka.Consumer, interval time.Duration, checkOrigin func(*http.Request) bool) *metricsStream {
+	return &metricsStream{
+		consumer: consumer,
+		interval: interval,
+		upgrader: websocket.Upgrader{
+			// The same pages as the rest of the metrics API
+			CheckOrigin: checkOrigin,
+		},
+		clients: make(map[*streamClient]struct{}),
+		stop:    make(chan struct{}),
+	}
+}
+
+// run pushes the live metrics every interval until the stream is closed
+func (s *metricsStream) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			idle := len(s.clients) == 0
+			s.mu.Unlock()
+			if idle {
+				continue
+			}
+
+			data, err := s.message()
+			if err != nil {
+				log.Printf("Error encoding live metrics: %v", err)
+				continue
+			}
+			s.mu.Lock()
+			for client := range s.clients {
+				select {
+				case client.send <- data:
+				default:
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// message encodes the live metrics the way the REST API responds
+func (s *metricsStream) message() ([]byte, error) {
+	return json.Marshal(MetricsResponse{
+		Status:    "success",
+		Timestamp: time.Now(),
+		Data:      s.consumer.GetLiveMetrics(),
+	})
+}
+
+// handle upgrades the request and pushes to it from now on, starting with
+// the current metrics so the dashboard doesn't wait for the next tick
+func (s *metricsStream) handle(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Metrics stream upgrade failed: %v", err)
+		return
+	}
+
+	client := &streamClient{
+		conn: conn,
+		send: make(chan []byte, 1),
+		done: make(chan struct{}),
+	}
+	if data, err := s.message(); err == nil {
+		client.send <- data
+	}
+
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+		s.mu.Unlock()
+		conn.Close()
+		return
+	default:
+	}
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+
+	go client.writePump()
+	client.readPump()
+
+	s.mu.Lock()
+	delete(s.clients, client)
+	s.mu.Unlock()
+	client.close()
+	conn.Close()
+}
+
+// close disconnects every client and stops pushing
+func (s *metricsStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+	close(s.stop)
+	for client := range s.clients {
+		client.close()
+	}
+}
+
+// readPump discards what the client sends, it only reads to see pongs and
+// the connection closing
+func (c *streamClient) readPump() {
+	c.conn.SetReadLimit(512)
+	c.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writePump sends the pushes and pings until the client is closed or a
+// write fails, then closes the connection, which ends the read pump
+func (c *streamClient) writePump() {
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(streamWriteWait))
+			c.conn.Close()
+			return
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// close has the write pump say goodbye and close the connection
+func (c *streamClient) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
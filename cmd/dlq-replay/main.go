@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"connect-four-backend/internal/config"
+	"connect-four-backend/internal/kafka"
+)
+
+// dlq-replay publishes messages from the analytics dead-letter queue back to
+// the topics they came from, so the analytics consumer processes them again
+// once whatever made them fail is fixed.
+func main() {
+	// The server's config file and environment give the defaults, the flags
+	// override them
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		brokers = flag.String("brokers", strings.Join(cfg.Kafka.Brokers, ","), "Kafka broker addresses")
+		topic   = flag.String("topic", cfg.Kafka.DeadLetterTopic, "Dead-letter topic to replay")
+		groupID = flag.String("group", cfg.Kafka.DLQReplayGroupID, "Consumer group remembering what was replayed")
+		idle    = flag.Duration("idle", 10*time.Second, "Stop after the dead-letter topic has been idle this long")
+		max     = flag.Int("max", 0, "Replay at most this many messages, 0 for all")
+		dryRun  = flag.Bool("dry-run", false, "Only list the dead-lettered messages")
+	)
+	flag.Parse()
+
+	config := kafka.DefaultReplayConfig(strings.Split(*brokers, ","), *topic)
+	config.GroupID = *groupID
+	config.IdleTimeout = *idle
+	config.MaxMessages = *max
+	config.DryRun = *dryRun
+	config.Security = kafka.SecurityConfigFromEnv()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	log.Printf("Replaying dead letters from %s", config.Topic)
+	stats, err := kafka.ReplayDeadLetters(ctx, config)
+	log.Printf("Replayed %d messages, skipped %d", stats.Replayed, stats.Failed)
+	if err != nil {
+		log.Fatalf("Replay stopped: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"connect-four-backend/internal/config"
+	"connect-four-backend/internal/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// event-replayer reads historical analytics events back, from Kafka between
+// two times or from an archive it exported earlier, and runs them through a
+// fresh EventProcessor to rebuild the aggregates after a bug fix or schema
+// change.
+func main() {
+	// The server's config file and environment give the defaults, the flags
+	// override them
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		brokers  = flag.String("brokers", strings.Join(cfg.Kafka.Brokers, ","), "Kafka broker addresses")
+		topic    = flag.String("topic", cfg.Kafka.Topic, "Kafka topics to read, comma separated")
+		routes   = flag.String("routes", cfg.Kafka.TopicRoutes, "The server's topic routes, their topics are read too")
+		from     = flag.String("from", "", "Read events written from this time on (RFC 3339), the oldest retained by default")
+		to       = flag.String("to", "", "Read events written up to this time (RFC 3339), up to now by default")
+		archive  = flag.String("archive", "", "Read events from this archive instead of Kafka")
+		export   = flag.String("export", "", "Write the events read from Kafka to this archive instead of processing them, gzipped for .gz")
+		out      = flag.String("out", "", "Write the rebuilt aggregates here as JSON, stdout by default")
+		registry = flag.String("schema-registry", cfg.Kafka.SchemaRegistryURL, "Schema registry URL, needed to read Avro events")
+	)
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// Every event passes through handle, which either archives or processes it
+	var handle func(kafkago.Message) error
+	var read, failed int
+	var processor *kafka.EventProcessor
+
+	if *export != "" {
+		if *archive != "" {
+			log.Fatalf("-export writes events read from Kafka, it can't be used with -archive")
+		}
+		writer, err := kafka.NewArchiveWriter(*export)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err := writer.Close(); err != nil {
+				log.Fatalf("Failed to finish archive: %v", err)
+			}
+		}()
+		handle = func(message kafkago.Message) error {
+			read++
+			return writer.Write(message)
+		}
+	} else {
+		// Without a repository only duplicates within the replay are skipped,
+		// not the events the analytics consumer already processed
+		config := kafka.DefaultConsumerConfig(nil)
+		config.SchemaRegistryURL = *registry
+
+		processor, err = kafka.NewConfiguredEventProcessor(config, nil)
+		if err != nil {
+			log.Fatalf("Failed to create event processor: %v", err)
+		}
+		handle = func(message kafkago.Message) error {
+			read++
+			if err := processor.ProcessMessage(message); err != nil {
+				failed++
+				log.Printf("Failed to process %s@%d: %v", message.Topic, message.Offset, err)
+			}
+			return ctx.Err()
+		}
+	}
+
+	start := time.Now()
+	if *archive != "" {
+		log.Printf("Replaying events from %s", *archive)
+		if err := kafka.ReadArchive(*archive, handle); err != nil {
+			log.Fatalf("Replay stopped after %d events: %v", read, err)
+		}
+	} else {
+		config := kafka.EventRangeConfig{
+			Brokers:  strings.Split(*brokers, ","),
+			Topics:   readTopics(*topic, *routes),
+			Start:    parseTime("-from", *from),
+			End:      parseTime("-to", *to),
+			Security: kafka.SecurityConfigFromEnv(),
+		}
+		log.Printf("Reading events from %s", strings.Join(config.Topics, ", "))
+		if err := kafka.ReadEventRange(ctx, config, handle); err != nil {
+			log.Fatalf("Replay stopped after %d events: %v", read, err)
+		}
+	}
+	log.Printf("Read %d events in %v, %d failed to process", read, time.Since(start).Round(time.Millisecond), failed)
+
+	if processor == nil {
+		log.Printf("Archived to %s", *export)
+		return
+	}
+
+	var output io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *out, err)
+		}
+		defer file.Close()
+		output = file
+	}
+	if err := processor.WriteAggregates(output); err != nil {
+		log.Fatalf("Failed to write aggregates: %v", err)
+	}
+}
+
+// readTopics returns the topics and every topic the routes send events to
+func readTopics(topic, routes string) []string {
+	topicRoutes, err := kafka.ParseTopicRoutes(routes)
+	if err != nil {
+		log.Fatalf("Invalid topic routes: %v", err)
+	}
+
+	topics := strings.Split(topic, ",")
+	seen := make(map[string]bool)
+	for _, t := range topics {
+		seen[t] = true
+	}
+	for _, routed := range (kafka.TopicRouter{Default: topics[0], Routes: topicRoutes}).Topics() {
+		if !seen[routed] {
+			seen[routed] = true
+			topics = append(topics, routed)
+		}
+	}
+	return topics
+}
+
+func parseTime(flagName, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("Invalid %s time %q, expected RFC 3339 like 2024-01-02T15:04:05Z", flagName, value)
+	}
+	return t
+}
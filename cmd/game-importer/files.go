@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Formats of game files
+const (
+	formatJSONL = "jsonl" // a replay document per line, as GET /api/games/{id}/replay serves them
+	formatCSV   = "csv"   // a game per row, its moves in the compact notation
+)
+
+// csvHeader are the columns of CSV game files. Only the players, result,
+// moves and times are needed to import a game. final_board, the board as the
+// games table kept it, is checked against the board the moves leave.
+var csvHeader = []string{
+	"game_id", "queue_type",
+	"red", "red_id", "red_is_bot", "red_teammate", "red_teammate_id",
+	"yellow", "yellow_id", "yellow_is_bot", "yellow_teammate", "yellow_teammate_id",
+	"result", "method", "moves", "started_at", "finished_at", "final_board",
+}
+
+// timeLayouts are the layouts times are read in: RFC 3339, and the text
+// Postgres exports timestamps as, in UTC without a zone
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// invalidGameError is a game in a file that can't be imported, which is
+// skipped
+type invalidGameError struct {
+	line int
+	err  error
+}
+
+func (e *invalidGameError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+// gameReader reads games from a file until io.EOF, returning an
+// *invalidGameError for a game it can't import and carrying on after it
+type gameReader interface {
+	Read() (*models.Game, error)
+}
+
+// gameWriter writes games to a file, finishing it on Close
+type gameWriter interface {
+	Write(game *models.Game) error
+	Close() error
+}
+
+// fileFormat returns the format, or the one the file's extension implies
+func fileFormat(path, format string) (string, error) {
+	switch format {
+	case formatJSONL, formatCSV:
+		return format, nil
+	case "":
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			return formatCSV, nil
+		}
+		return formatJSONL, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, use %s or %s", format, formatJSONL, formatCSV)
+	}
+}
+
+// openGameReader opens the file to read games from in the format
+func openGameReader(path, format string) (gameReader, io.Closer, error) {
+	format, err := fileFormat(path, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open games: %w", err)
+	}
+
+	if format == formatJSONL {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		return &jsonlReader{scanner: scanner}, file, nil
+	}
+	reader, err := newCSVReader(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// createGameWriter creates the file to write games to in the format
+func createGameWriter(path, format string) (gameWriter, error) {
+	format, err := fileFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create games file: %w", err)
+	}
+
+	buffered := bufio.NewWriter(file)
+	if format == formatJSONL {
+		return &jsonlWriter{file: file, buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	}
+	writer := csv.NewWriter(buffered)
+	if err := writer.Write(csvHeader); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write games file: %w", err)
+	}
+	return &csvWriter{file: file, buffered: buffered, writer: writer}, nil
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *jsonlReader) Read() (*models.Game, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := strings.TrimSpace(r.scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var replay models.Replay
+		if err := json.Unmarshal([]byte(data), &replay); err != nil {
+			return nil, &invalidGameError{line: r.line, err: err}
+		}
+		game, err := gameFromReplay(&replay)
+		if err != nil {
+			return nil, &invalidGameError{line: r.line, err: err}
+		}
+		return game, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read games: %w", err)
+	}
+	return nil, io.EOF
+}
+
+type jsonlWriter struct {
+	file     *os.File
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (w *jsonlWriter) Write(game *models.Game) error {
+	if err := w.encoder.Encode(game.Replay()); err != nil {
+		return fmt.Errorf("failed to write game %s: %w", game.ID, err)
+	}
+	return nil
+}
+
+func (w *jsonlWriter) Close() error {
+	return finishFile(w.file, w.buffered.Flush())
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCSVReader reads the header, which may list the columns in any order
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"red", "yellow", "result", "moves", "started_at", "finished_at"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header has no %s column", name)
+		}
+	}
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvReader) Read() (*models.Game, error) {
+	row, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	line, _ := r.reader.FieldPos(0)
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+		return nil, &invalidGameError{line: parseErr.Line, err: parseErr.Err}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read games: %w", err)
+	}
+
+	game, err := r.game(row)
+	if err != nil {
+		return nil, &invalidGameError{line: line, err: err}
+	}
+	return game, nil
+}
+
+// game rebuilds the game of a row, as a replay written by its columns
+func (r *csvReader) game(row []string) (*models.Game, error) {
+	field := func(name string) string {
+		if i, ok := r.columns[name]; ok {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	replay := &models.Replay{
+		Settings: models.ReplaySettings{QueueType: models.QueueType(field("queue_type"))},
+		Notation: field("moves"),
+		Result:   models.ReplayResult{Method: field("method")},
+	}
+
+	var err error
+	if replay.GameID, err = parseID(field("game_id")); err != nil {
+		return nil, fmt.Errorf("invalid game_id: %w", err)
+	}
+	for _, color := range []string{"red", "yellow"} {
+		for _, seat := range []string{color, color + "_teammate"} {
+			if field(seat) == "" {
+				continue
+			}
+			id, err := parseID(field(seat + "_id"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s_id: %w", seat, err)
+			}
+			isBot := false
+			if value := field(seat + "_is_bot"); value != "" {
+				if isBot, err = strconv.ParseBool(value); err != nil {
+					return nil, fmt.Errorf("invalid %s_is_bot: %q", seat, value)
+				}
+			}
+			replay.Players = append(replay.Players, models.ReplayPlayer{ID: id, Name: field(seat), Color: color, IsBot: isBot})
+		}
+	}
+
+	switch result := strings.ToLower(field("result")); result {
+	case "red", "yellow":
+		replay.Result.Winner = result
+	case "draw":
+		replay.Result.IsDraw = true
+	default:
+		return nil, fmt.Errorf("result %q isn't red, yellow or draw", result)
+	}
+
+	if replay.StartedAt, err = parseTime(field("started_at")); err != nil {
+		return nil, fmt.Errorf("invalid started_at: %w", err)
+	}
+	if replay.FinishedAt, err = parseTime(field("finished_at")); err != nil {
+		return nil, fmt.Errorf("invalid finished_at: %w", err)
+	}
+
+	game, err := gameFromReplay(replay)
+	if err != nil {
+		return nil, err
+	}
+
+	if value := field("final_board"); value != "" {
+		var board [6][7]int
+		if err := json.Unmarshal([]byte(value), &board); err != nil {
+			return nil, fmt.Errorf("invalid final_board: %w", err)
+		}
+		if board != game.Board {
+			return nil, fmt.Errorf("final_board isn't the board the moves leave")
+		}
+	}
+	return game, nil
+}
+
+type csvWriter struct {
+	file     *os.File
+	buffered *bufio.Writer
+	writer   *csv.Writer
+}
+
+func (w *csvWriter) Write(game *models.Game) error {
+	replay := game.Replay()
+
+	result := "draw"
+	if replay.Result.Winner != "" {
+		result = replay.Result.Winner
+	}
+	board, err := json.Marshal(game.Board)
+	if err != nil {
+		return fmt.Errorf("failed to encode board of game %s: %w", game.ID, err)
+	}
+
+	row := []string{game.ID.String(), string(game.QueueType)}
+	for _, color := range []models.PlayerColor{models.PlayerRed, models.PlayerYellow} {
+		player := game.Players[color]
+		row = append(row, player.Name, player.ID.String(), strconv.FormatBool(player.IsBot))
+		if teammate := game.Teammates[color]; teammate != nil {
+			row = append(row, teammate.Name, teammate.ID.String())
+		} else {
+			row = append(row, "", "")
+		}
+	}
+	row = append(row, result, replay.Result.Method, replay.Notation,
+		replay.StartedAt.UTC().Format(time.RFC3339Nano), replay.FinishedAt.UTC().Format(time.RFC3339Nano), string(board))
+
+	if err := w.writer.Write(row); err != nil {
+		return fmt.Errorf("failed to write game %s: %w", game.ID, err)
+	}
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	err := w.writer.Error()
+	if err == nil {
+		err = w.buffered.Flush()
+	}
+	return finishFile(w.file, err)
+}
+
+// finishFile closes the file, returning the error of writing its end if
+// there was one
+func finishFile(file *os.File, err error) error {
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish games file: %w", err)
+	}
+	return nil
+}
+
+// parseID parses a UUID, the nil UUID when empty
+func parseID(value string) (uuid.UUID, error) {
+	if value == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(value)
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q isn't a time like 2006-01-02T15:04:05Z", value)
+}
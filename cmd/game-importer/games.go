@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// queueTypes are the queue types a game can be imported with
+var queueTypes = map[models.QueueType]bool{
+	models.QueueTypeCasual:     true,
+	models.QueueTypeRanked:     true,
+	models.QueueTypePrivate:    true,
+	models.QueueTypeTeam:       true,
+	models.QueueTypeTournament: true,
+}
+
+// playerNamespace derives the IDs of players imported without one from their
+// names, so a player keeps the same ID across the games of a file and across
+// imports
+var playerNamespace = uuid.MustParse("6f2a4c1e-8d3b-4e5f-9a7c-2b1d0e3f4a5b")
+
+// gameFromReplay rebuilds a finished game from its replay by playing every
+// move on an empty board, refusing games that couldn't have been played or
+// whose result doesn't follow from their moves
+func gameFromReplay(replay *models.Replay) (*models.Game, error) {
+	if replay.Format != "" && replay.Format != models.ReplayFormat {
+		return nil, fmt.Errorf("format %q isn't %s", replay.Format, models.ReplayFormat)
+	}
+	if replay.Version > models.ReplayFormatVersion {
+		return nil, fmt.Errorf("replay version %d is newer than %d", replay.Version, models.ReplayFormatVersion)
+	}
+	if rows, columns := replay.Settings.Rows, replay.Settings.Columns; (rows != 0 && rows != 6) || (columns != 0 && columns != 7) {
+		return nil, fmt.Errorf("board of %d rows and %d columns isn't 6 by 7", rows, columns)
+	}
+	if replay.StartedAt.IsZero() || replay.FinishedAt.IsZero() {
+		return nil, fmt.Errorf("start and finish times are required")
+	}
+	if replay.FinishedAt.Before(replay.StartedAt) {
+		return nil, fmt.Errorf("finished at %s, before it started at %s",
+			replay.FinishedAt.Format(time.RFC3339), replay.StartedAt.Format(time.RFC3339))
+	}
+
+	game := &models.Game{
+		ID:                replay.GameID,
+		State:             models.GameStatePlaying,
+		CurrentTurn:       models.PlayerRed,
+		CurrentTurnNumber: 1,
+		CreatedAt:         replay.StartedAt,
+		TurnStartedAt:     replay.StartedAt,
+		QueueType:         replay.Settings.QueueType,
+		TurnTimeLimit:     replay.Settings.TurnTimeLimit,
+	}
+	if game.ID == uuid.Nil {
+		game.ID = uuid.New()
+	}
+	if game.QueueType == "" {
+		game.QueueType = models.QueueTypeCasual
+	}
+	if !queueTypes[game.QueueType] {
+		return nil, fmt.Errorf("unknown queue type %q", game.QueueType)
+	}
+	if err := seatPlayers(game, replay.Players); err != nil {
+		return nil, err
+	}
+
+	moves, err := replayMoves(replay)
+	if err != nil {
+		return nil, err
+	}
+	previous := replay.StartedAt
+	for i, move := range moves {
+		number := i + 1
+		if game.State == models.GameStateFinished {
+			return nil, fmt.Errorf("move %d is played after the game ended", number)
+		}
+		if move.Color != "" && move.Color != colorName(game.CurrentTurn) {
+			return nil, fmt.Errorf("move %d is %s's, but it is %s's turn", number, move.Color, colorName(game.CurrentTurn))
+		}
+		if player := game.PlayerToMove(); move.PlayerID != uuid.Nil && move.PlayerID != player.ID {
+			return nil, fmt.Errorf("move %d is played by %s, but it is %s's turn", number, move.PlayerID, player.Name)
+		}
+
+		// Moves without a time are spread evenly between the start and finish
+		playedAt := move.PlayedAt
+		if playedAt.IsZero() {
+			playedAt = replay.StartedAt.Add(replay.FinishedAt.Sub(replay.StartedAt) * time.Duration(number) / time.Duration(len(moves)+1))
+		}
+		if playedAt.Before(previous) || playedAt.After(replay.FinishedAt) {
+			return nil, fmt.Errorf("move %d is played at %s, outside the game or before the move before it", number, playedAt.Format(time.RFC3339))
+		}
+		previous = playedAt
+
+		played := play(game, move.Column, playedAt)
+		if played == nil {
+			return nil, fmt.Errorf("move %d is in column %d, which is full or off the board", number, move.Column+1)
+		}
+		if move.Row >= 0 && move.Row != played.Row {
+			return nil, fmt.Errorf("move %d lands on row %d, not row %d", number, played.Row, move.Row)
+		}
+	}
+
+	claimed, err := claimedWinner(game, replay.Result)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case game.Winner != nil:
+		if claimed == nil || *claimed != *game.Winner {
+			return nil, fmt.Errorf("the board has four in a row for %s, but the result doesn't", colorName(*game.Winner))
+		}
+	case game.IsBoardFull():
+		if claimed != nil {
+			return nil, fmt.Errorf("the board filled without four in a row, but the result is a win for %s", colorName(*claimed))
+		}
+	default:
+		// A game ended before it was won or the board filled was forfeited,
+		// or adjudicated a draw
+		game.Winner = claimed
+	}
+
+	game.State = models.GameStateFinished
+	finishedAt := replay.FinishedAt
+	game.FinishedAt = &finishedAt
+
+	if method := game.Replay().Result.Method; replay.Result.Method != "" && replay.Result.Method != method {
+		return nil, fmt.Errorf("the game ended by %s, but its method is %s", method, replay.Result.Method)
+	}
+	return game, nil
+}
+
+// play drops a piece of the player to move in the column at the time, ending
+// the game on four in a row or a full board. It returns nil when the column
+// is full or off the board.
+func play(game *models.Game, column int, at time.Time) *models.Move {
+	player := game.PlayerToMove()
+	move := game.MakeMove(column, game.CurrentTurn)
+	if move == nil {
+		return nil
+	}
+	move.PlayerID = player.ID
+	move.Timestamp = at
+	game.Moves = append(game.Moves, move)
+	game.TurnStartedAt = at
+	game.Version++
+
+	if winner := game.CheckWinner(); winner != nil {
+		game.Winner = winner
+		game.State = models.GameStateFinished
+	} else if game.IsBoardFull() {
+		game.State = models.GameStateFinished
+	} else if game.CurrentTurn == models.PlayerRed {
+		game.CurrentTurn = models.PlayerYellow
+		game.CurrentTurnNumber = 2
+	} else {
+		game.CurrentTurn = models.PlayerRed
+		game.CurrentTurnNumber = 1
+	}
+	return move
+}
+
+// seatPlayers gives the game one player of each color, or two in a team game
+func seatPlayers(game *models.Game, players []models.ReplayPlayer) error {
+	var seats [2][]*models.Player
+	names := make(map[string]bool)
+	for _, replayPlayer := range players {
+		color, err := parseColor(replayPlayer.Color)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSpace(replayPlayer.Name)
+		if name == "" {
+			return fmt.Errorf("a %s player has no name", colorName(color))
+		}
+		if names[name] {
+			return fmt.Errorf("%s plays twice", name)
+		}
+		names[name] = true
+
+		id := replayPlayer.ID
+		if id == uuid.Nil {
+			id = uuid.NewSHA1(playerNamespace, []byte(name))
+		}
+		seats[color] = append(seats[color], &models.Player{
+			ID:     id,
+			Name:   name,
+			Color:  color,
+			Number: int(color) + 1,
+			IsBot:  replayPlayer.IsBot,
+		})
+	}
+
+	red, yellow := len(seats[models.PlayerRed]), len(seats[models.PlayerYellow])
+	switch {
+	case red == 1 && yellow == 1:
+	case red == 2 && yellow == 2:
+		game.Teammates = [2]*models.Player{seats[models.PlayerRed][1], seats[models.PlayerYellow][1]}
+	default:
+		return fmt.Errorf("%d red and %d yellow players, a game has one of each or two in a team game", red, yellow)
+	}
+	game.Players = [2]*models.Player{seats[models.PlayerRed][0], seats[models.PlayerYellow][0]}
+	return nil
+}
+
+// replayMoves returns the replay's moves, read from its notation when it
+// lists none. Moves read from the notation have no row, -1.
+func replayMoves(replay *models.Replay) ([]models.ReplayMove, error) {
+	if len(replay.Moves) > 0 {
+		var notation strings.Builder
+		for _, move := range replay.Moves {
+			notation.WriteString(fmt.Sprint(move.Column + 1))
+		}
+		if replay.Notation != "" && replay.Notation != notation.String() {
+			return nil, fmt.Errorf("notation %s doesn't match the moves, %s", replay.Notation, notation.String())
+		}
+		return replay.Moves, nil
+	}
+
+	moves := make([]models.ReplayMove, 0, len(replay.Notation))
+	for i, column := range replay.Notation {
+		if column < '1' || column > '7' {
+			return nil, fmt.Errorf("move %d of the notation, %q, isn't a column from 1 to 7", i+1, column)
+		}
+		moves = append(moves, models.ReplayMove{Number: i + 1, Column: int(column - '1'), Row: -1})
+	}
+	return moves, nil
+}
+
+// claimedWinner returns the color the result says won, nil for a draw
+func claimedWinner(game *models.Game, result models.ReplayResult) (*models.PlayerColor, error) {
+	var winner *models.PlayerColor
+	if result.Winner != "" {
+		color, err := parseColor(result.Winner)
+		if err != nil {
+			return nil, err
+		}
+		winner = &color
+	}
+	if result.WinnerID != nil {
+		var color *models.PlayerColor
+		for _, player := range game.Players {
+			if player.ID == *result.WinnerID {
+				color = &player.Color
+			}
+		}
+		if color == nil {
+			return nil, fmt.Errorf("winner %s isn't a player of the game", *result.WinnerID)
+		}
+		if winner != nil && *winner != *color {
+			return nil, fmt.Errorf("winner %s doesn't play %s", *result.WinnerID, result.Winner)
+		}
+		winner = color
+	}
+	if winner != nil && result.IsDraw {
+		return nil, fmt.Errorf("the result is both a draw and a win for %s", colorName(*winner))
+	}
+	return winner, nil
+}
+
+func parseColor(name string) (models.PlayerColor, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "red":
+		return models.PlayerRed, nil
+	case "yellow":
+		return models.PlayerYellow, nil
+	default:
+		return 0, fmt.Errorf("color %q isn't red or yellow", name)
+	}
+}
+
+// colorName is how replays write a color
+func colorName(color models.PlayerColor) string {
+	if color == models.PlayerRed {
+		return "red"
+	}
+	return "yellow"
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"connect-four-backend/internal/config"
+	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/models"
+)
+
+// exportPageSize is how many finished games an export reads at a time
+const exportPageSize = 200
+
+// game-importer bulk loads finished games from CSV or JSONL files into the
+// game history and leaderboard, exports them in the same formats, and seeds
+// databases with randomly played games. Every game is played out move by
+// move before it is saved, so games that couldn't have been played are
+// skipped instead of corrupting the standings.
+func main() {
+	// The server's config file and environment give the defaults, the flags
+	// override them
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		dbURL       = flag.String("db", cfg.Database.URL, "Database URL")
+		importPath  = flag.String("import", "", "Import the games in this file")
+		exportPath  = flag.String("export", "", "Export the finished games to this file, or write the seeded games to it instead of the database")
+		format      = flag.String("format", "", "File format, jsonl or csv, by the file's extension by default")
+		dryRun      = flag.Bool("dry-run", false, "Only check the games to import, without connecting to the database")
+		from        = flag.String("from", "", "Export games finished from this time on (RFC 3339)")
+		to          = flag.String("to", "", "Export games finished before this time (RFC 3339), now by default")
+		player      = flag.String("player", "", "Only export the games the player played in")
+		seed        = flag.Int("seed", 0, "Seed this many randomly played games")
+		seedPlayers = flag.Int("seed-players", 12, "Players to seed games between, besides the bot")
+		seedDays    = flag.Int("seed-days", 30, "Start seeded games over this many past days")
+	)
+	flag.Parse()
+
+	switch {
+	case *importPath != "":
+		if *exportPath != "" || *seed > 0 {
+			log.Fatalf("-import can't be used with -export or -seed")
+		}
+		reader, file, err := openGameReader(*importPath, *format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+
+		var store database.Store
+		if !*dryRun {
+			store = openStore(*dbURL)
+			defer store.Close()
+		}
+		if invalid := importGames(reader, store); invalid > 0 {
+			log.Fatalf("Skipped %d invalid games", invalid)
+		}
+
+	case *seed > 0:
+		if *seedPlayers < 1 || *seedDays < 1 {
+			log.Fatalf("-seed-players and -seed-days must be at least 1")
+		}
+		games := seedGames(rand.New(rand.NewSource(time.Now().UnixNano())), *seed, *seedPlayers, *seedDays)
+		if *exportPath != "" {
+			writer, err := createGameWriter(*exportPath, *format)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, game := range games {
+				if err := writer.Write(game); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Wrote %d seeded games to %s", len(games), *exportPath)
+			return
+		}
+
+		store := openStore(*dbURL)
+		defer store.Close()
+		importGames(&sliceReader{games: games}, store)
+
+	case *exportPath != "":
+		query := database.GameQuery{Player: *player}
+		var err error
+		if query.From, err = parseFlagTime(*from); err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+		if query.To, err = parseFlagTime(*to); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+
+		store := openStore(*dbURL)
+		defer store.Close()
+		writer, err := createGameWriter(*exportPath, *format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exported, err := exportGames(store, query, writer)
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			log.Fatalf("Export stopped after %d games: %v", exported, err)
+		}
+		log.Printf("Exported %d games to %s", exported, *exportPath)
+
+	default:
+		log.Fatalf("Give -import, -export or -seed")
+	}
+}
+
+func openStore(dbURL string) database.Store {
+	store, err := database.New(dbURL, database.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	return store
+}
+
+// importGames saves the games the reader reads, or only checks them without
+// a store, and rebuilds the leaderboard from the games table once they're
+// in. Saving a game already in the history leaves it as it was, so an
+// import can be run again after it stopped. Ratings aren't changed, games
+// from the past would apply out of order. It returns how many games were
+// invalid and skipped.
+func importGames(reader gameReader, store database.Store) int {
+	var imported, invalid int
+	for {
+		game, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var invalidErr *invalidGameError
+		if errors.As(err, &invalidErr) {
+			invalid++
+			log.Printf("Skipped invalid game at %v", err)
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Import stopped after %d games: %v", imported, err)
+		}
+
+		if store != nil {
+			if err := store.SaveGameResult(game, nil); err != nil {
+				log.Fatalf("Import stopped after %d games: %v", imported, err)
+			}
+		}
+		imported++
+		if imported%1000 == 0 {
+			log.Printf("Imported %d games", imported)
+		}
+	}
+
+	if store == nil {
+		log.Printf("Checked %d valid games, %d invalid", imported, invalid)
+		return invalid
+	}
+	if imported > 0 {
+		if err := store.RefreshLeaderboard(); err != nil {
+			log.Fatalf("Imported %d games, but failed to rebuild the leaderboard: %v", imported, err)
+		}
+	}
+	log.Printf("Imported %d games, skipped %d invalid", imported, invalid)
+	return invalid
+}
+
+// exportGames writes the finished games the query picks, oldest first
+func exportGames(store database.Store, query database.GameQuery, writer gameWriter) (int, error) {
+	query.Sort = database.GameSortFinishedAt
+	query.Descending = false
+	query.Limit = exportPageSize
+	if query.To.IsZero() {
+		// Games finishing during the export would shift the pages
+		query.To = time.Now()
+	}
+
+	exported := 0
+	for {
+		page, err := store.FindFinishedGames(query)
+		if err != nil {
+			return exported, err
+		}
+		for _, record := range page.Games {
+			game, err := store.GetFinishedGame(record.ID)
+			if err != nil {
+				return exported, err
+			}
+			if game == nil {
+				continue // erased since the page was read
+			}
+			game.ID = record.ID
+			if err := writer.Write(game); err != nil {
+				return exported, err
+			}
+			exported++
+		}
+
+		query.Offset += len(page.Games)
+		if len(page.Games) < query.Limit || query.Offset >= page.Total {
+			return exported, nil
+		}
+	}
+}
+
+// sliceReader reads games already in memory
+type sliceReader struct {
+	games []*models.Game
+}
+
+func (r *sliceReader) Read() (*models.Game, error) {
+	if len(r.games) == 0 {
+		return nil, io.EOF
+	}
+	game := r.games[0]
+	r.games = r.games[1:]
+	return game, nil
+}
+
+func parseFlagTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"connect-four-backend/internal/bot"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// seedNames are the players seeded games are played between, the first
+// -seed-players of them
+var seedNames = []string{
+	"Alice", "Bob", "Charlie", "Diana", "Eve", "Frank", "Grace", "Heidi", "Ivan", "Judy",
+	"Mallory", "Niaj", "Olivia", "Peggy", "Rupert", "Sybil", "Trent", "Victor", "Walter", "Zoe",
+}
+
+// Seeded games are against the bot this often, and a seeded move is a
+// player's last before they forfeit this often
+const (
+	seedBotShare    = 0.25
+	seedForfeitRate = 0.003
+)
+
+// seedPlayer is a player of seeded games, who plays the bot's move with the
+// probability of their skill and a random one otherwise
+type seedPlayer struct {
+	player *models.Player
+	skill  float64
+}
+
+// seedGames plays count games between the first players of seedNames and the
+// bot, started at random over the last days. Players are given random skills,
+// so the leaderboard spreads out the way it does in play.
+func seedGames(rng *rand.Rand, count, players, days int) []*models.Game {
+	if players > len(seedNames) {
+		players = len(seedNames)
+	}
+	humans := make([]seedPlayer, players)
+	for i := range humans {
+		humans[i] = seedPlayer{
+			player: &models.Player{ID: uuid.NewSHA1(playerNamespace, []byte(seedNames[i])), Name: seedNames[i]},
+			skill:  0.2 + 0.7*rng.Float64(),
+		}
+	}
+	connectBot := bot.NewBot()
+	connectBot.ID = uuid.NewSHA1(playerNamespace, []byte(connectBot.Name))
+	botPlayer := seedPlayer{player: connectBot, skill: 0.8}
+
+	now := time.Now()
+	games := make([]*models.Game, 0, count)
+	for len(games) < count {
+		red := humans[rng.Intn(len(humans))]
+		var yellow seedPlayer
+		queueType := models.QueueTypeCasual
+		if rng.Float64() < seedBotShare || len(humans) < 2 {
+			yellow = botPlayer
+		} else {
+			yellow = humans[rng.Intn(len(humans))]
+			if yellow.player == red.player {
+				continue
+			}
+			if rng.Intn(2) == 0 {
+				queueType = models.QueueTypeRanked
+			}
+		}
+		if rng.Intn(2) == 0 {
+			red, yellow = yellow, red
+		}
+
+		startedAt := now.Add(-time.Duration(rng.Int63n(int64(time.Duration(days) * 24 * time.Hour))))
+		games = append(games, playSeedGame(rng, [2]seedPlayer{red, yellow}, queueType, startedAt))
+	}
+	return games
+}
+
+// playSeedGame plays a game between the players to its end, or until one of
+// them forfeits
+func playSeedGame(rng *rand.Rand, players [2]seedPlayer, queueType models.QueueType, startedAt time.Time) *models.Game {
+	game := &models.Game{
+		ID:                uuid.New(),
+		State:             models.GameStatePlaying,
+		CurrentTurn:       models.PlayerRed,
+		CurrentTurnNumber: 1,
+		CreatedAt:         startedAt,
+		TurnStartedAt:     startedAt,
+		QueueType:         queueType,
+	}
+	for color, seat := range players {
+		player := *seat.player
+		player.Color = models.PlayerColor(color)
+		player.Number = color + 1
+		game.Players[color] = &player
+	}
+
+	at := startedAt
+	for game.State == models.GameStatePlaying {
+		seat := players[game.CurrentTurn]
+		if len(game.Moves) > 0 && rng.Float64() < seedForfeitRate {
+			winner := models.PlayerRed
+			if game.CurrentTurn == models.PlayerRed {
+				winner = models.PlayerYellow
+			}
+			game.Winner = &winner
+			break
+		}
+
+		thinkTime := time.Second + time.Duration(rng.Int63n(int64(12*time.Second)))
+		if seat.player.IsBot {
+			thinkTime = time.Second
+		}
+		at = at.Add(thinkTime)
+		play(game, seedColumn(rng, game, seat.skill), at)
+	}
+
+	game.State = models.GameStateFinished
+	finishedAt := at.Add(time.Second)
+	game.FinishedAt = &finishedAt
+	return game
+}
+
+// seedColumn picks the bot's move with the probability of the skill, and a
+// random column with room otherwise
+func seedColumn(rng *rand.Rand, game *models.Game, skill float64) int {
+	if rng.Float64() < skill {
+		return bot.GetBestMove(game, game.CurrentTurn)
+	}
+	columns := make([]int, 0, 7)
+	for column := 0; column < 7; column++ {
+		if game.IsValidMove(column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns[rng.Intn(len(columns))]
+}
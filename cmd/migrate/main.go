@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"connect-four-backend/internal/config"
+	"connect-four-backend/internal/database"
+)
+
+// migrate applies or rolls back the database migrations. The server and the
+// analytics consumer apply pending migrations when they start, so this is for
+// migrating ahead of a deploy, rolling back and checking what a database has.
+func main() {
+	// The server's config file and environment give the defaults, the flags
+	// override them
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		dbURL  = flag.String("db", cfg.Database.URL, "Database URL")
+		down   = flag.Int("down", 0, "Roll back this many of the latest migrations instead of applying pending ones")
+		status = flag.Bool("status", false, "Only list the migrations and when they were applied")
+	)
+	flag.Parse()
+
+	repo, err := database.Open(*dbURL, database.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer repo.Close()
+
+	switch {
+	case *status:
+		states, err := repo.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Failed to read migrations: %v", err)
+		}
+		for _, state := range states {
+			if state.AppliedAt == nil {
+				log.Printf("%04d_%s: pending", state.Version, state.Name)
+			} else {
+				log.Printf("%04d_%s: applied %s", state.Version, state.Name, state.AppliedAt.Format("2006-01-02 15:04:05"))
+			}
+		}
+
+	case *down > 0:
+		undone, err := repo.MigrateDown(*down)
+		for _, migration := range undone {
+			log.Printf("Rolled back %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Rollback stopped: %v", err)
+		}
+		log.Printf("Rolled back %d migrations", len(undone))
+
+	default:
+		applied, err := repo.MigrateUp()
+		for _, migration := range applied {
+			log.Printf("Applied %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration stopped: %v", err)
+		}
+		log.Printf("Applied %d migrations", len(applied))
+	}
+}
@@ -2,82 +2,458 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"syscall"
-	"time"
 
+	"connect-four-backend/internal/accounts"
+	"connect-four-backend/internal/auth"
+	"connect-four-backend/internal/bus"
+	"connect-four-backend/internal/chat"
 	"connect-four-backend/internal/config"
 	"connect-four-backend/internal/database"
 	"connect-four-backend/internal/game"
 	"connect-four-backend/internal/handlers"
 	"connect-four-backend/internal/kafka"
+	"connect-four-backend/internal/logging"
 	"connect-four-backend/internal/matchmaking"
+	"connect-four-backend/internal/metrics"
+	"connect-four-backend/internal/models"
+	"connect-four-backend/internal/rating"
+	"connect-four-backend/internal/retention"
+	"connect-four-backend/internal/season"
 	"connect-four-backend/internal/server"
+	"connect-four-backend/internal/tournament"
+	"connect-four-backend/internal/tracing"
+	"connect-four-backend/internal/webhooks"
 
 	"github.com/joho/godotenv"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version string
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
 
-	cfg := config.Load()
+	// Settings come from the file, overridden by the environment
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file, the defaults and environment only when empty")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *configPath != "" {
+		log.Printf("Loaded configuration from %s", *configPath)
+	}
+	logLevel, err := logging.ParseLevel(cfg.Server.LogLevel)
+	if err != nil {
+		log.Fatal("Invalid log level:", err)
+	}
+	logging.SetLevel(logLevel)
 
 	// Initialize database
-	db, err := database.NewPostgresDB(cfg.DatabaseURL)
+	dbConfig := cfg.Database.Pool()
+	store, err := database.New(cfg.Database.URL, dbConfig)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
+	db := database.Instrument(store, dbConfig.SlowQueryThreshold)
 	defer db.Close()
 
 	// Initialize Kafka producer
-	kafkaConfig := kafka.DefaultProducerConfig(cfg.KafkaBrokers)
-	kafkaProducer, err := kafka.NewProducer(kafkaConfig)
+	kafkaConfig, err := cfg.Kafka.Producer()
+	if err != nil {
+		log.Fatal("Invalid Kafka topic routes:", err)
+	}
+	sampling, err := kafka.ParseSamplingConfig(cfg.Analytics.Sampling)
 	if err != nil {
-		log.Fatal("Failed to create Kafka producer:", err)
+		log.Fatal("Invalid analytics sampling:", err)
+	}
+	kafkaConfig.Backpressure.QueueSize = cfg.Analytics.QueueSize
+
+	// Analytics events go to Kafka unless another message bus is configured
+	var analyticsService *kafka.AnalyticsService
+	if cfg.Analytics.MessageBus == bus.DriverKafka {
+		kafkaProducer, err := kafka.NewProducer(kafkaConfig)
+		if err != nil {
+			log.Fatal("Failed to create Kafka producer:", err)
+		}
+		defer kafkaProducer.Close()
+		analyticsService = kafka.NewAnalyticsService(kafkaProducer, cfg.Analytics.Enabled)
+	} else {
+		messageBus, err := bus.Open(cfg.Analytics.Bus())
+		if err != nil {
+			log.Fatal("Failed to open message bus:", err)
+		}
+		defer messageBus.Close()
+		analyticsService, err = kafka.NewBusAnalyticsService(messageBus, kafkaConfig, cfg.Analytics.Enabled)
+		if err != nil {
+			log.Fatal("Failed to create analytics service:", err)
+		}
+	}
+	analyticsService.SetSampling(sampling)
+	serverVersion := cfg.Analytics.Version
+	if serverVersion == "" {
+		serverVersion = buildVersion()
+	}
+	analyticsService.SetInstance(cfg.Analytics.ServerID, serverVersion, cfg.Analytics.Environment)
+
+	// Trace messages and moves through to the analytics consumer
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Endpoint != "" {
+		tracingConfig := cfg.Tracing.Tracer("connect-four-server")
+		tracingConfig.ServiceVersion = serverVersion
+		tracer, err = tracing.NewTracer(tracingConfig)
+		if err != nil {
+			log.Fatal("Invalid tracing configuration:", err)
+		}
+		tracing.SetTracer(tracer)
+		log.Printf("Exporting traces to %s", cfg.Tracing.Endpoint)
 	}
-	defer kafkaProducer.Close()
 
 	// Initialize services
 	gameManager := game.NewManager()
-	matchmaker := matchmaking.NewMatchmaker(gameManager)
-	analyticsService := kafka.NewAnalyticsService(kafkaProducer, true)
+	disconnectConfig, err := game.ParseDisconnectConfig(cfg.Game.DisconnectPolicy, cfg.Game.DisconnectPolicyOverrides)
+	if err != nil {
+		log.Fatal("Invalid disconnect policy:", err)
+	}
+	gameManager.SetDisconnectConfig(disconnectConfig)
+	gameManager.SetRankedTurnTimeLimit(cfg.Game.RankedTurnTimeLimit)
+
+	// Share games with the other instances, so players connected to any of
+	// them can play the games this one hosts
+	if cfg.Cluster.RedisURL != "" {
+		cluster, err := game.NewRedisCluster(cfg.Cluster.RedisURL, cfg.Cluster.Prefix, cfg.Cluster.NodeID)
+		if err != nil {
+			log.Fatal("Failed to connect to cluster Redis:", err)
+		}
+		defer cluster.Close()
+		gameManager.SetCluster(cluster)
+		log.Printf("Sharing games through Redis as node %s", cfg.Cluster.NodeID)
+	}
+	gameCreator := matchmaking.NewGameManagerCreator(gameManager)
+	matchEvents := matchmaking.NewDefaultEventPublisher()
+	matchmaker := matchmaking.NewMatchmakingService(
+		context.Background(),
+		cfg.Matchmaking.Service(),
+		gameCreator,
+		&matchmaking.DefaultBotProvider{},
+		matchEvents,
+	)
+
+	// Record every match so the rating range curve can be tuned
+	matchEvents.OnMatchFound(func(match *matchmaking.Match) {
+		gameInstance, exists := gameManager.GetGame(match.GameID)
+		if !exists {
+			return
+		}
+		ratings := [2]int{match.Player1.Rating, match.Player2.Rating}
+		if err := analyticsService.EmitMatchFound(gameInstance, ratings, match.RatingGap, match.RatingRange, match.WaitTime, match.QueueSize, kafka.Metadata{}); err != nil {
+			log.Printf("Failed to emit match found event for %s: %v", match.GameID, err)
+		}
+	})
+
+	// Queue depth and wait times, and how often players end up against bots
+	matchEvents.OnPlayerJoined(func(event matchmaking.QueueEvent) {
+		if err := analyticsService.EmitQueueJoined(event.PlayerID, event.Username, event.QueueType, event.Rating, event.QueueSize, handlers.EventMetadata(event.Conn)); err != nil {
+			log.Printf("Failed to emit queue joined event for %s: %v", event.Username, err)
+		}
+	})
+	matchEvents.OnPlayerLeft(func(event matchmaking.QueueEvent) {
+		if err := analyticsService.EmitQueueLeft(event.PlayerID, event.Username, event.QueueType, event.Rating, event.QueueSize, event.WaitTime, event.Reason, handlers.EventMetadata(event.Conn)); err != nil {
+			log.Printf("Failed to emit queue left event for %s: %v", event.Username, err)
+		}
+	})
+	matchEvents.OnBotActivated(func(match *matchmaking.Match) {
+		gameInstance, exists := gameManager.GetGame(match.GameID)
+		if !exists {
+			return
+		}
+		if err := analyticsService.EmitBotActivated(gameInstance, match.WaitTime, handlers.EventMetadata(match.Player1.Conn)); err != nil {
+			log.Printf("Failed to emit bot activated event for %s: %v", match.GameID, err)
+		}
+	})
+
+	// Rate players after every finished game and match them by rating
+	ratingConfig := rating.DefaultConfig()
+	ratingService := rating.NewService(ratingConfig, db)
+	matchmaker.SetRatingProvider(ratingService)
+
+	// Keep the queue and games in progress across restarts
+	matchmaker.SetQueueStore(db)
+	gameManager.SetGameStore(db)
+	restoredGames, err := gameManager.RestoreGames()
+	if err != nil {
+		log.Printf("Failed to restore games in progress: %v", err)
+	}
+	for _, restored := range restoredGames {
+		gameCreator.ResumeGame(restored)
+	}
+
+	// Keep every finished game with its moves for replays, and its result for
+	// the leaderboard with the ratings it changed, saved together in the
+	// background and retried
+	recorder := game.NewRecorder(game.DefaultRecorderConfig(), db)
+	recorder.SetRater(ratingService)
+	recorder.Start()
+	gameManager.OnGameEnd(recorder.Record)
+
+	// Players who abandon games get escalating queue cooldowns. Only games
+	// adjudicated for a disconnect count, and only for the players still
+	// away when they ended, not those who leave after a normal finish.
+	matchmaker.SetPenaltyStore(db)
+	gameManager.OnGameEnd(func(g *models.Game) {
+		if g.EndReason != models.EndReasonDisconnect {
+			return
+		}
+		for _, player := range g.AllPlayers() {
+			if player.IsBot || player.Connected {
+				continue
+			}
+			if _, err := matchmaker.RecordAbandon(player.Name); err != nil {
+				log.Printf("Failed to record abandoned game %s for %s: %v", g.ID, player.Name, err)
+			}
+		}
+	})
+
+	// Operators can register webhooks for finished games and tournaments
+	webhookService := webhooks.NewService(webhooks.DefaultConfig(), db)
+	if err := webhookService.Start(); err != nil {
+		log.Fatal("Failed to start webhook service:", err)
+	}
+	defer webhookService.Stop()
+	gameManager.OnGameEnd(func(g *models.Game) {
+		webhookService.Publish(webhooks.EventGameEnded, webhooks.NewGameEnded(g))
+	})
+
+	// Tournaments are seeded by rating and report their lifecycle to Kafka
+	tournaments := tournament.NewService(tournament.DefaultConfig(), gameManager)
+	tournaments.SetRatingProvider(ratingService)
+	tournaments.OnEvent(func(event tournament.Event) {
+		if err := analyticsService.EmitTournamentEvent(kafka.EventType(event.Type), event.Tournament, event.Match, kafka.Metadata{}); err != nil {
+			log.Printf("Failed to emit %s event for tournament %s: %v", event.Type, event.Tournament.ID, err)
+		}
+
+		switch event.Type {
+		case tournament.EventStarted:
+			webhookService.Publish(webhooks.EventTournamentStarted, webhooks.NewTournamentUpdate(event.Tournament))
+		case tournament.EventFinished:
+			webhookService.Publish(webhooks.EventTournamentFinished, webhooks.NewTournamentUpdate(event.Tournament))
+		}
+	})
+
+	// Recurring tournaments open registration and start on their own
+	scheduler, err := tournament.NewScheduler(tournament.DefaultSchedulerConfig(), tournaments)
+	if err != nil {
+		log.Fatal("Failed to create tournament scheduler:", err)
+	}
+
+	// Session tokens tie clients to the player IDs they were given
+	sessions := auth.NewSessions(auth.DefaultConfig(cfg.Server.SessionSecret))
+	accountService := accounts.NewService(accounts.DefaultConfig(), db)
+
+	// Claimed guest ratings were renamed in the database, reload them
+	accountService.OnGuestClaimed(func(account *models.Account, claim *models.GuestClaim) {
+		ratingService.Forget(append(claim.GuestNames, account.Username)...)
+	})
+
+	// Erased players' cached ratings are gone, and the analytics consumer
+	// forgets them once it reads the player_erased event
+	accountService.OnErased(func(erasure *models.PlayerErasure) {
+		ratingService.Forget(erasure.PlayerName)
+		if err := analyticsService.EmitPlayerErased(erasure.PlayerName); err != nil {
+			log.Printf("Failed to emit erasure of %s: %v", erasure.PlayerName, err)
+		}
+	})
+
+	// Game chat masks the configured words and keeps its history a while after the game
+	chatService := chat.NewService(chat.DefaultConfig())
+	chatService.AddFilter(chat.WordFilter(cfg.Server.ChatBlockedWords))
+	gameManager.OnGameEnd(func(g *models.Game) {
+		chatService.EndGame(g.ID)
+	})
 
 	// Initialize handlers
-	gameHandler := handlers.NewGameHandler(gameManager, matchmaker, analyticsService)
+	gameHandler := handlers.NewGameHandler(gameManager, matchmaker, tournaments, analyticsService, sessions, accountService, chatService)
+	gameHandler.SetAllowedOrigins(cfg.Server.AllowedOrigins, cfg.Server.AllowAllOrigins)
+	if cfg.Server.AllowAllOrigins {
+		log.Println("ALLOW_ALL_ORIGINS is set, WebSocket origins are not checked")
+	}
+	gameHandler.SetGameHistory(db)
 	leaderboardHandler := handlers.NewLeaderboardHandler(db)
+	if cfg.Game.LeaderboardRefreshInterval > 0 {
+		leaderboardHandler.StartRefresh(cfg.Game.LeaderboardRefreshInterval)
+		defer leaderboardHandler.Stop()
+	}
+	// Seasons end on their own, keeping standings and resetting ratings
+	if cfg.Game.SeasonLength > 0 {
+		seasons, err := season.NewService(season.DefaultConfig(cfg.Game.SeasonLength, ratingConfig.InitialRating), db, ratingService)
+		if err != nil {
+			log.Fatal("Failed to create season service:", err)
+		}
+		seasons.Start()
+		defer seasons.Stop()
+		leaderboardHandler.SetSeasons(seasons)
+	}
+	// Raw moves are only kept for the retention period
+	if cfg.Game.MoveRetention > 0 {
+		purger, err := retention.NewPurger(retention.DefaultConfig(cfg.Game.MoveRetention), db)
+		if err != nil {
+			log.Fatal("Failed to create move purger:", err)
+		}
+		purger.Start()
+		defer purger.Stop()
+	}
+	tournamentHandler := handlers.NewTournamentHandler(tournaments, scheduler)
+	accountHandler := handlers.NewAccountHandler(accountService, sessions, db)
+	adminHandler := handlers.NewAdminHandler(gameHandler, accountService, webhookService, cfg.Server.AdminUsernames)
+
+	// Some settings can be changed without a restart, by reloading the
+	// config on SIGHUP or from the admin API
+	reloader := config.NewReloader(*configPath, cfg)
+	reloader.OnChange("matchmaking.bot_match_timeout", func(c *config.Config) error {
+		return matchmaker.SetBotMatchTimeout(c.Matchmaking.BotMatchTimeout)
+	})
+	reloader.OnChange("game.ranked_turn_time_limit", func(c *config.Config) error {
+		gameManager.SetRankedTurnTimeLimit(c.Game.RankedTurnTimeLimit)
+		return nil
+	})
+	reloader.OnChange("analytics.sampling", func(c *config.Config) error {
+		sampling, err := kafka.ParseSamplingConfig(c.Analytics.Sampling)
+		if err != nil {
+			return err
+		}
+		return analyticsService.SetSampling(sampling)
+	})
+	reloader.OnChange("server.log_level", func(c *config.Config) error {
+		level, err := logging.ParseLevel(c.Server.LogLevel)
+		if err != nil {
+			return err
+		}
+		logging.SetLevel(level)
+		return nil
+	})
+	adminHandler.SetReloader(reloader)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			log.Println("Reloading configuration on SIGHUP")
+			reloader.Reload()
+		}
+	}()
+
+	// Metrics for Prometheus, read from the services' stats when scraped
+	registry := metrics.NewRegistry()
+	gameHandler.RegisterMetrics(registry)
+	analyticsService.RegisterMetrics(registry)
+	registry.DBStats(db.Stats)
+	db.RegisterMetrics(registry)
+	if tracer != nil {
+		tracer.RegisterMetrics(registry)
+	}
 
 	// Initialize server
-	srv := server.NewServer(cfg, gameHandler, leaderboardHandler)
+	srv := server.NewServer(cfg, sessions, gameHandler, leaderboardHandler, tournamentHandler, accountHandler, adminHandler, registry.Handler())
 
 	// Start matchmaker
-	go matchmaker.Start()
+	if err := matchmaker.Start(); err != nil {
+		log.Fatal("Failed to start matchmaking service:", err)
+	}
+	defer matchmaker.Stop()
+
+	// Start after the handlers so announcements reach connected players
+	scheduler.Start()
+	defer scheduler.Stop()
 
 	// Start server
 	go func() {
-		log.Printf("Server starting on port %s", cfg.Port)
+		log.Printf("Server starting on port %s", cfg.Server.Port)
 		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
 			log.Fatal("Server failed to start:", err)
 		}
 	}()
 
-	// Graceful shutdown
+	// Graceful shutdown, on a signal or when an admin drains the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case <-gameHandler.DrainRequested():
+	}
+
+	// Let the games in progress finish first, a second signal stops waiting
+	if cfg.Server.DrainTimeout > 0 {
+		log.Printf("Draining server for up to %s...", cfg.Server.DrainTimeout)
+		scheduler.Stop()
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Server.DrainTimeout)
+		go func() {
+			select {
+			case <-quit:
+				cancelDrain()
+			case <-drainCtx.Done():
+			}
+		}()
+		if err := gameHandler.Drain(drainCtx); err != nil {
+			log.Printf("Games still in progress are paused and saved: %v", err)
+		}
+		cancelDrain()
+	}
 
 	log.Println("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
+	// WebSockets aren't closed by the HTTP server, games are saved for the restart
+	if err := gameHandler.Shutdown(ctx); err != nil {
+		log.Printf("WebSocket connections forced to close: %v", err)
+	}
+
+	// Before the deferred database close
+	if err := recorder.Close(ctx); err != nil {
+		log.Printf("Failed to save finished games: %v", err)
+	}
+
+	// Before the deferred producer and bus closes, which would drop them
+	if err := analyticsService.Close(ctx); err != nil {
+		log.Printf("Failed to publish analytics events: %v", err)
+	}
+
+	// The last spans, from the shutdown itself
+	if tracer != nil {
+		if err := tracer.Shutdown(ctx); err != nil {
+			log.Printf("Failed to export traces: %v", err)
+		}
+	}
+
 	log.Println("Server exited")
-}
\ No newline at end of file
+}
+
+// buildVersion returns the version set at build time, or the commit the
+// binary was built from
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+				return setting.Value[:12]
+			}
+		}
+	}
+	return "dev"
+}
@@ -0,0 +1,14 @@
+package accounts
+
+import "errors"
+
+var (
+	ErrInvalidUsername    = errors.New("username must be 3 to 20 letters, digits, '_' or '-'")
+	ErrWeakPassword       = errors.New("password is too short")
+	ErrUsernameTaken      = errors.New("username is already registered")
+	ErrNameHasHistory     = errors.New("username has been played under, only the guest who played can register it")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrAccountNotFound    = errors.New("account not found")
+	ErrNotGuest           = errors.New("player is not a guest")
+	ErrInvalidErasureMode = errors.New("erasure mode must be 'anonymize' or 'delete'")
+)
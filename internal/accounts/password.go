@@ -0,0 +1,58 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	passwordSaltSize = 16
+	passwordKeySize  = 32
+)
+
+// hashPassword derives a PBKDF2-HMAC-SHA256 key from the password, encoded as
+// "pbkdf2-sha256$<iterations>$<salt>$<key>"
+func hashPassword(password string, iterations int) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate password salt: %w", err)
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, iterations, passwordKeySize, sha256.New)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether the password matches an encoded hash. A key
+// shorter than hashPassword makes matches no password, an empty one would
+// otherwise be matched by any.
+func checkPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) < passwordKeySize {
+		return false
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, iterations, len(expected), sha256.New)
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
@@ -0,0 +1,89 @@
+package accounts
+
+import (
+	"strings"
+	"testing"
+)
+
+// PBKDF2-HMAC-SHA256 test vectors from RFC 7914 section 11, in the encoding
+// hashPassword uses
+const (
+	rfc7914Vector1 = "pbkdf2-sha256$1$c2FsdA$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLxJypzM8Xm2RZkWZLOdd+8xfHG4RbHjC9UJESBB06GXgw"
+	rfc7914Vector2 = "pbkdf2-sha256$80000$TmFDbA$TdzY9guYviGDDO5e8icB+WQaRBjQTAQUrv8Ih2s0q1ah1CWhIlgzVJrbhBtRybMXaicr3ruh0HhHj2Kzl/M8jQ"
+)
+
+func TestCheckPasswordVectors(t *testing.T) {
+	tests := []struct {
+		password string
+		encoded  string
+		want     bool
+	}{
+		{"passwd", rfc7914Vector1, true},
+		{"Password", rfc7914Vector2, true},
+		{"password", rfc7914Vector2, false},
+		{"", rfc7914Vector1, false},
+	}
+	for _, tt := range tests {
+		if got := checkPassword(tt.password, tt.encoded); got != tt.want {
+			t.Errorf("checkPassword(%q, %.30s...) = %v, want %v", tt.password, tt.encoded, got, tt.want)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	encoded, err := hashPassword("correct horse", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "pbkdf2-sha256$1000$") {
+		t.Errorf("hash %q doesn't name the algorithm and iterations", encoded)
+	}
+	if !checkPassword("correct horse", encoded) {
+		t.Error("the password doesn't match its own hash")
+	}
+	if checkPassword("correct horse!", encoded) {
+		t.Error("another password matches the hash")
+	}
+
+	// Each hash gets its own salt
+	again, err := hashPassword("correct horse", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == encoded {
+		t.Error("hashing the password twice gave the same hash")
+	}
+}
+
+func TestCheckPasswordRejectsMalformedHashes(t *testing.T) {
+	encoded, err := hashPassword("correct horse", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(encoded, "$")
+	salt, key := parts[2], parts[3]
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"empty key", "pbkdf2-sha256$1000$" + salt + "$"},
+		{"short key", "pbkdf2-sha256$1000$" + salt + "$" + key[:20]},
+		{"no key", "pbkdf2-sha256$1000$" + salt},
+		{"other algorithm", "pbkdf2-sha1$1000$" + salt + "$" + key},
+		{"zero iterations", "pbkdf2-sha256$0$" + salt + "$" + key},
+		{"negative iterations", "pbkdf2-sha256$-1$" + salt + "$" + key},
+		{"bad salt", "pbkdf2-sha256$1000$!!$" + key},
+		{"bad key", "pbkdf2-sha256$1000$" + salt + "$" + key + "!"},
+		{"extra field", encoded + "$"},
+	}
+	for _, tt := range tests {
+		// Neither the right password nor an empty one gets in
+		for _, password := range []string{"correct horse", ""} {
+			if checkPassword(password, tt.encoded) {
+				t.Errorf("%s: %q matched %q", tt.name, password, tt.encoded)
+			}
+		}
+	}
+}
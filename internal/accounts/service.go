@@ -0,0 +1,277 @@
+package accounts
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Store persists accounts. Usernames are unique regardless of case.
+type Store interface {
+	CreateAccount(account *models.Account) error
+	// GetAccount and GetAccountByUsername return nil without an error for unknown accounts
+	GetAccount(accountID uuid.UUID) (*models.Account, error)
+	GetAccountByUsername(username string) (*models.Account, error)
+	// GetNameHistory returns the players who played under a name and whether it is rated
+	GetNameHistory(username string) (*models.NameHistory, error)
+	UpdateAccountLogin(accountID uuid.UUID, loginAt time.Time) error
+	// MergeGuestPlayer moves a guest's games, and rating if the account has none, to the account
+	MergeGuestPlayer(guestID uuid.UUID, account *models.Account) (*models.GuestClaim, error)
+	// ErasePlayer renames the player's games to the alias and deletes the rest
+	// of their data, and their account when deleteAccount is set
+	ErasePlayer(account *models.Account, alias string, deleteAccount bool) (*models.PlayerErasure, error)
+}
+
+// Config holds account rules
+type Config struct {
+	MinPasswordLength  int `json:"min_password_length"`
+	PasswordIterations int `json:"password_iterations"` // PBKDF2 rounds for new password hashes
+}
+
+// DefaultConfig returns passwords of at least 8 characters, hashed with
+// 100,000 PBKDF2 rounds
+func DefaultConfig() Config {
+	return Config{
+		MinPasswordLength:  8,
+		PasswordIterations: 100000,
+	}
+}
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,20}$`)
+
+// Service registers players and checks their credentials
+type Service struct {
+	config Config
+	store  Store
+
+	claimListeners   []func(account *models.Account, claim *models.GuestClaim)
+	erasureListeners []func(erasure *models.PlayerErasure)
+	mutex            sync.RWMutex
+}
+
+// NewService creates a new account service
+func NewService(config Config, store Store) *Service {
+	return &Service{
+		config: config,
+		store:  store,
+	}
+}
+
+// Register creates an account for a new username. Ratings and stats are
+// kept by name, so names guests have played under are refused, the guest
+// registers them with RegisterGuest.
+func (s *Service) Register(username, password string) (*models.Account, error) {
+	return s.register(username, password, uuid.Nil)
+}
+
+// RegisterGuest creates an account for a guest, who may take a name only they
+// have played under, and moves their games and rating to it as ClaimGuest does.
+// A failed claim still returns the account, the claim can be tried again.
+func (s *Service) RegisterGuest(guestID uuid.UUID, username, password string) (*models.Account, *models.GuestClaim, error) {
+	account, err := s.register(username, password, guestID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claim, err := s.ClaimGuest(account.ID, guestID)
+	if err != nil {
+		return account, nil, err
+	}
+	return account, claim, nil
+}
+
+func (s *Service) register(username, password string, guestID uuid.UUID) (*models.Account, error) {
+	username = strings.TrimSpace(username)
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if len(password) < s.config.MinPasswordLength {
+		return nil, ErrWeakPassword
+	}
+
+	existing, err := s.store.GetAccountByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrUsernameTaken
+	}
+
+	if guestID != uuid.Nil {
+		other, err := s.store.GetAccount(guestID)
+		if err != nil {
+			return nil, err
+		}
+		if other != nil {
+			return nil, ErrNotGuest
+		}
+	}
+
+	history, err := s.store.GetNameHistory(username)
+	if err != nil {
+		return nil, err
+	}
+	if !history.Empty() && !playedOnlyBy(history, guestID) {
+		return nil, ErrNameHasHistory
+	}
+
+	passwordHash, err := hashPassword(password, s.config.PasswordIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &models.Account{
+		ID:           uuid.New(),
+		Username:     username,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.store.CreateAccount(account); err != nil {
+		return nil, fmt.Errorf("failed to register %s: %w", username, err)
+	}
+
+	return account, nil
+}
+
+// playedOnlyBy reports whether every game under the name was the guest's
+func playedOnlyBy(history *models.NameHistory, guestID uuid.UUID) bool {
+	if guestID == uuid.Nil || len(history.PlayerIDs) == 0 {
+		return false
+	}
+	for _, playerID := range history.PlayerIDs {
+		if playerID != guestID {
+			return false
+		}
+	}
+	return true
+}
+
+// Login checks a player's credentials and records the login
+func (s *Service) Login(username, password string) (*models.Account, error) {
+	account, err := s.store.GetAccountByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || !checkPassword(password, account.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if err := s.store.UpdateAccountLogin(account.ID, now); err != nil {
+		return nil, err
+	}
+	account.LastLoginAt = &now
+
+	return account, nil
+}
+
+// Get returns the account with the given ID
+func (s *Service) Get(accountID uuid.UUID) (*models.Account, error) {
+	account, err := s.store.GetAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// IsRegistered reports whether the username belongs to an account, so guests
+// can't play under a registered player's name
+func (s *Service) IsRegistered(username string) (bool, error) {
+	account, err := s.store.GetAccountByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return false, err
+	}
+	return account != nil, nil
+}
+
+// ClaimGuest merges the history of a guest player ID into the account, so
+// players who register after playing as a guest keep their games and rating
+func (s *Service) ClaimGuest(accountID, guestID uuid.UUID) (*models.GuestClaim, error) {
+	account, err := s.Get(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Accounts can't be claimed, that includes the account claiming itself
+	other, err := s.store.GetAccount(guestID)
+	if err != nil {
+		return nil, err
+	}
+	if other != nil {
+		return nil, ErrNotGuest
+	}
+
+	claim, err := s.store.MergeGuestPlayer(guestID, account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim guest %s for %s: %w", guestID, account.Username, err)
+	}
+
+	s.mutex.RLock()
+	listeners := s.claimListeners
+	s.mutex.RUnlock()
+
+	for _, listener := range listeners {
+		listener(account, claim)
+	}
+
+	return claim, nil
+}
+
+// OnGuestClaimed registers a listener called after a guest's history moves to an account
+func (s *Service) OnGuestClaimed(listener func(account *models.Account, claim *models.GuestClaim)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.claimListeners = append(s.claimListeners, listener)
+}
+
+// Erase erases the logged in player's data at their request, after checking
+// their password. Their finished games stay for their opponents under an
+// alias, the rest of their data is deleted, and with ErasureDelete so is
+// their account.
+func (s *Service) Erase(accountID uuid.UUID, password, mode string) (*models.PlayerErasure, error) {
+	if mode != models.ErasureAnonymize && mode != models.ErasureDelete {
+		return nil, ErrInvalidErasureMode
+	}
+
+	account, err := s.Get(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !checkPassword(password, account.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+
+	alias := "deleted-" + uuid.New().String()[:8]
+	erasure, err := s.store.ErasePlayer(account, alias, mode == models.ErasureDelete)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase %s: %w", account.Username, err)
+	}
+
+	s.mutex.RLock()
+	listeners := s.erasureListeners
+	s.mutex.RUnlock()
+
+	for _, listener := range listeners {
+		listener(erasure)
+	}
+
+	return erasure, nil
+}
+
+// OnErased registers a listener called after a player's data is erased
+func (s *Service) OnErased(listener func(erasure *models.PlayerErasure)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.erasureListeners = append(s.erasureListeners, listener)
+}
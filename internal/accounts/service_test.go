@@ -0,0 +1,152 @@
+package accounts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryStore keeps accounts, and the players who played under each name, in maps
+type memoryStore struct {
+	accounts map[uuid.UUID]*models.Account
+	played   map[string][]uuid.UUID // by lower case name
+	rated    map[string]bool
+	merged   []uuid.UUID // guests merged into accounts
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		accounts: make(map[uuid.UUID]*models.Account),
+		played:   make(map[string][]uuid.UUID),
+		rated:    make(map[string]bool),
+	}
+}
+
+func (m *memoryStore) play(name string, playerID uuid.UUID) {
+	m.played[strings.ToLower(name)] = append(m.played[strings.ToLower(name)], playerID)
+	m.rated[strings.ToLower(name)] = true
+}
+
+func (m *memoryStore) CreateAccount(account *models.Account) error {
+	m.accounts[account.ID] = account
+	return nil
+}
+
+func (m *memoryStore) GetAccount(accountID uuid.UUID) (*models.Account, error) {
+	return m.accounts[accountID], nil
+}
+
+func (m *memoryStore) GetAccountByUsername(username string) (*models.Account, error) {
+	for _, account := range m.accounts {
+		if strings.EqualFold(account.Username, username) {
+			return account, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) GetNameHistory(username string) (*models.NameHistory, error) {
+	name := strings.ToLower(username)
+	return &models.NameHistory{PlayerIDs: m.played[name], Rated: m.rated[name]}, nil
+}
+
+func (m *memoryStore) UpdateAccountLogin(accountID uuid.UUID, loginAt time.Time) error {
+	m.accounts[accountID].LastLoginAt = &loginAt
+	return nil
+}
+
+func (m *memoryStore) MergeGuestPlayer(guestID uuid.UUID, account *models.Account) (*models.GuestClaim, error) {
+	m.merged = append(m.merged, guestID)
+	return &models.GuestClaim{GuestID: guestID, GuestNames: []string{}}, nil
+}
+
+func (m *memoryStore) ErasePlayer(account *models.Account, alias string, deleteAccount bool) (*models.PlayerErasure, error) {
+	return &models.PlayerErasure{PlayerName: account.Username, Alias: alias, AccountDeleted: deleteAccount}, nil
+}
+
+func newTestService(store Store) *Service {
+	config := DefaultConfig()
+	config.PasswordIterations = 1000
+	return NewService(config, store)
+}
+
+func TestRegister(t *testing.T) {
+	store := newMemoryStore()
+	s := newTestService(store)
+	store.play("guest", uuid.New())
+
+	account, err := s.Register(" alice ", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Username != "alice" {
+		t.Errorf("registered %q, want the name trimmed", account.Username)
+	}
+	if _, err := s.Login("alice", "correct horse"); err != nil {
+		t.Errorf("Login after Register: %v", err)
+	}
+
+	tests := []struct {
+		username, password string
+		want               error
+	}{
+		{"al", "correct horse", ErrInvalidUsername},
+		{"alice bob", "correct horse", ErrInvalidUsername},
+		{"bob", "short", ErrWeakPassword},
+		{"ALICE", "correct horse", ErrUsernameTaken},
+		{"guest", "correct horse", ErrNameHasHistory},
+		{"Guest", "correct horse", ErrNameHasHistory},
+	}
+	for _, tt := range tests {
+		if _, err := s.Register(tt.username, tt.password); err != tt.want {
+			t.Errorf("Register(%q, %q) = %v, want %v", tt.username, tt.password, err, tt.want)
+		}
+	}
+}
+
+func TestRegisterGuest(t *testing.T) {
+	store := newMemoryStore()
+	s := newTestService(store)
+	guest, other := uuid.New(), uuid.New()
+	store.play("carol", guest)
+	store.play("shared", guest)
+	store.play("shared", other)
+	store.rated["rated"] = true
+
+	account, claim, err := s.RegisterGuest(guest, "carol", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Username != "carol" || claim == nil || claim.GuestID != guest {
+		t.Errorf("RegisterGuest returned %+v, %+v", account, claim)
+	}
+	if len(store.merged) != 1 || store.merged[0] != guest {
+		t.Errorf("merged guests %v, want the registering guest's history", store.merged)
+	}
+
+	// A fresh name needs no history, the guest's games still move to the account
+	if _, _, err := s.RegisterGuest(uuid.New(), "dave", "correct horse"); err != nil {
+		t.Errorf("RegisterGuest of a new name: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		guestID  uuid.UUID
+		username string
+		want     error
+	}{
+		{"another guest's name", other, "carol", ErrUsernameTaken},
+		{"a name two guests played under", guest, "shared", ErrNameHasHistory},
+		{"a rating without the guest's games", guest, "rated", ErrNameHasHistory},
+		{"an account's token", account.ID, "erin", ErrNotGuest},
+	}
+	for _, tt := range tests {
+		if _, _, err := s.RegisterGuest(tt.guestID, tt.username, "correct horse"); err != tt.want {
+			t.Errorf("%s: RegisterGuest = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Package apierror writes the JSON error envelope every REST endpoint returns,
+// so clients can tell errors apart by code instead of parsing messages.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"connect-four-backend/internal/models"
+)
+
+// Codes shared by every endpoint. Domain errors use their own codes, named
+// like the WebSocket error codes (GAME_NOT_FOUND, NOT_YOUR_TURN, ...).
+const (
+	CodeInvalidRequest = "INVALID_REQUEST"
+	CodeUnauthorized   = "UNAUTHORIZED"
+	CodeForbidden      = "FORBIDDEN"
+	CodeNotFound       = "NOT_FOUND"
+	CodeUnavailable    = "UNAVAILABLE"
+	CodeInternal       = "INTERNAL_ERROR"
+)
+
+// ErrorResponse is the body of an error response, the error itself has the same
+// shape as WebSocket error payloads
+type ErrorResponse struct {
+	Error  models.ErrorPayload `json:"error"`
+	Status int                 `json:"status"`
+}
+
+// Write sends an error response with the status and code
+func Write(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: models.ErrorPayload{
+			Code:    code,
+			Message: message,
+		},
+		Status: status,
+	})
+}
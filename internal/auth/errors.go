@@ -0,0 +1,10 @@
+package auth
+
+import "errors"
+
+var (
+	ErrMissingToken = errors.New("session token is required")
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrTokenExpired = errors.New("session token has expired")
+	ErrUnknownRole  = errors.New("unknown role")
+)
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/apierror"
+
+	"github.com/google/uuid"
+)
+
+// Config holds session token settings
+type Config struct {
+	Secret []byte        `json:"-"`
+	TTL    time.Duration `json:"ttl"`
+}
+
+// DefaultConfig returns sessions signed with the secret that last a day.
+// Without a secret a random one is generated, so sessions don't survive a
+// restart.
+func DefaultConfig(secret string) Config {
+	config := Config{
+		Secret: []byte(secret),
+		TTL:    24 * time.Hour,
+	}
+
+	if secret == "" {
+		config.Secret = make([]byte, 32)
+		if _, err := rand.Read(config.Secret); err != nil {
+			log.Fatal("Failed to generate session secret:", err)
+		}
+		log.Println("SESSION_SECRET not set, using a random secret")
+	}
+
+	return config
+}
+
+// Sessions issues and verifies signed session tokens (HS256 JWTs) that bind a
+// client to the player ID the server assigned it
+type Sessions struct {
+	config Config
+}
+
+// Claims are the verified contents of a session token
+type Claims struct {
+	PlayerID  uuid.UUID `json:"sub"`
+	IssuedAt  int64     `json:"iat"`
+	ExpiresAt int64     `json:"exp"`
+}
+
+type contextKey struct{}
+
+// tokenHeader is the same for every token, only HS256 is accepted
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// NewSessions creates a session token issuer
+func NewSessions(config Config) *Sessions {
+	return &Sessions{config: config}
+}
+
+// Issue creates a session token for the player
+func (s *Sessions) Issue(playerID uuid.UUID) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.config.TTL)
+
+	claims, err := json.Marshal(Claims{
+		PlayerID:  playerID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to encode session claims: %w", err)
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return unsigned + "." + s.sign(unsigned), expiresAt, nil
+}
+
+// Verify checks the token's signature and expiry and returns its claims
+func (s *Sessions) Verify(token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+
+	unsigned := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(unsigned))) {
+		return nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.PlayerID == uuid.Nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// VerifyPlayer checks that the token is valid and was issued to the player
+func (s *Sessions) VerifyPlayer(token string, playerID uuid.UUID) error {
+	claims, err := s.Verify(token)
+	if err != nil {
+		return err
+	}
+	if claims.PlayerID != playerID {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RequireSession rejects requests without a valid "Authorization: Bearer"
+// session token. The player ID is available to handlers via PlayerIDFromContext.
+func (s *Sessions) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		claims, err := s.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, claims.PlayerID)))
+	})
+}
+
+// PlayerIDFromContext returns the player ID of an authenticated request
+func PlayerIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	playerID, ok := ctx.Value(contextKey{}).(uuid.UUID)
+	return playerID, ok
+}
+
+func (s *Sessions) sign(unsigned string) string {
+	return signHS256(s.config.Secret, unsigned)
+}
+
+func signHS256(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/apierror"
+
+	"github.com/google/uuid"
+)
+
+var testSecret = []byte("test-secret")
+
+func newTestSessions() *Sessions {
+	return NewSessions(Config{Secret: testSecret, TTL: time.Hour})
+}
+
+// signedToken builds a token from its header and claims, signed with the secret
+func signedToken(secret []byte, header string, claims interface{}) string {
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signHS256(secret, unsigned)
+}
+
+// tamper changes the first character of s
+func tamper(s string) string {
+	if s[0] == 'A' {
+		return "B" + s[1:]
+	}
+	return "A" + s[1:]
+}
+
+func TestVerify(t *testing.T) {
+	s := newTestSessions()
+	playerID := uuid.New()
+	valid, expiresAt, err := s.Issue(playerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(expiresAt); until <= 59*time.Minute || until > time.Hour {
+		t.Errorf("Issue returned a token expiring in %v, want the TTL", until)
+	}
+
+	const header = `{"alg":"HS256","typ":"JWT"}`
+	now := time.Now().Unix()
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"a token Issue made", valid, nil},
+		{"no token", "", ErrMissingToken},
+		{"a tampered signature", parts[0] + "." + parts[1] + "." + tamper(parts[2]), ErrInvalidToken},
+		{"no signature", parts[0] + "." + parts[1] + ".", ErrInvalidToken},
+		{"another player's claims under the signature",
+			parts[0] + "." + strings.Split(signedToken(testSecret, header, Claims{PlayerID: uuid.New(), ExpiresAt: now + 60}), ".")[1] + "." + parts[2],
+			ErrInvalidToken},
+		{"another secret", signedToken([]byte("other-secret"), header, Claims{PlayerID: playerID, ExpiresAt: now + 60}), ErrInvalidToken},
+		{"alg none", signedToken(testSecret, `{"alg":"none","typ":"JWT"}`, Claims{PlayerID: playerID, ExpiresAt: now + 60}), ErrInvalidToken},
+		{"alg HS512", signedToken(testSecret, `{"alg":"HS512","typ":"JWT"}`, Claims{PlayerID: playerID, ExpiresAt: now + 60}), ErrInvalidToken},
+		{"the header respaced", signedToken(testSecret, `{"alg": "HS256", "typ": "JWT"}`, Claims{PlayerID: playerID, ExpiresAt: now + 60}), ErrInvalidToken},
+		{"expired", signedToken(testSecret, header, Claims{PlayerID: playerID, IssuedAt: now - 120, ExpiresAt: now - 60}), ErrTokenExpired},
+		{"expiring now", signedToken(testSecret, header, Claims{PlayerID: playerID, ExpiresAt: now}), ErrTokenExpired},
+		{"no expiry", signedToken(testSecret, header, Claims{PlayerID: playerID}), ErrTokenExpired},
+		{"no player", signedToken(testSecret, header, Claims{ExpiresAt: now + 60}), ErrInvalidToken},
+		{"claims that aren't JSON", signedToken(testSecret, header, "not claims"), ErrInvalidToken},
+		{"two segments", parts[0] + "." + parts[1], ErrInvalidToken},
+		{"four segments", valid + "." + parts[2], ErrInvalidToken},
+		{"one segment", parts[1], ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		claims, err := s.Verify(tt.token)
+		if err != tt.want {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err == nil && (claims.PlayerID != playerID || claims.ExpiresAt != expiresAt.Unix()) {
+			t.Errorf("%s: Verify returned %+v", tt.name, claims)
+		}
+	}
+}
+
+func TestVerifyPlayer(t *testing.T) {
+	s := newTestSessions()
+	playerID := uuid.New()
+	token, _, err := s.Issue(playerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := signedToken(testSecret, `{"alg":"HS256","typ":"JWT"}`, Claims{PlayerID: playerID, ExpiresAt: time.Now().Unix() - 1})
+
+	tests := []struct {
+		name     string
+		token    string
+		playerID uuid.UUID
+		want     error
+	}{
+		{"the token's player", token, playerID, nil},
+		{"another player", token, uuid.New(), ErrInvalidToken},
+		{"no player", token, uuid.Nil, ErrInvalidToken},
+		{"an expired token", expired, playerID, ErrTokenExpired},
+		{"no token", "", playerID, ErrMissingToken},
+	}
+	for _, tt := range tests {
+		if err := s.VerifyPlayer(tt.token, tt.playerID); err != tt.want {
+			t.Errorf("%s: VerifyPlayer = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	s := newTestSessions()
+	playerID := uuid.New()
+	token, _, err := s.Issue(playerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reached uuid.UUID
+	handler := s.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached, _ = PlayerIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantMessage   string // empty when the request is let through
+	}{
+		{"a valid token", "Bearer " + token, ""},
+		{"no header", "", ErrMissingToken.Error()},
+		{"a bare bearer", "Bearer ", ErrMissingToken.Error()},
+		{"another scheme", "Basic " + token, ErrInvalidToken.Error()},
+		{"a tampered token", "Bearer " + token + "x", ErrInvalidToken.Error()},
+		{"an expired token", "Bearer " + signedToken(testSecret, `{"alg":"HS256","typ":"JWT"}`,
+			Claims{PlayerID: playerID, ExpiresAt: time.Now().Unix() - 1}), ErrTokenExpired.Error()},
+	}
+	for _, tt := range tests {
+		reached = uuid.Nil
+		request := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+		if tt.authorization != "" {
+			request.Header.Set("Authorization", tt.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if tt.wantMessage == "" {
+			if recorder.Code != http.StatusOK || reached != playerID {
+				t.Errorf("%s: returned %d and the handler saw player %v", tt.name, recorder.Code, reached)
+			}
+			continue
+		}
+
+		var body apierror.ErrorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Code != http.StatusUnauthorized || body.Error.Code != apierror.CodeUnauthorized || body.Error.Message != tt.wantMessage {
+			t.Errorf("%s: returned %d %s, want 401 %q", tt.name, recorder.Code, recorder.Body, tt.wantMessage)
+		}
+		if recorder.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: no WWW-Authenticate challenge", tt.name)
+		}
+		if reached != uuid.Nil {
+			t.Errorf("%s: the handler ran", tt.name)
+		}
+	}
+}
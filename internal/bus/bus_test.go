@@ -0,0 +1,63 @@
+package bus
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	b, err := Open(DefaultConfig(DriverMemory, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.(*MemoryBus); !ok {
+		t.Errorf("Open of the memory driver returned a %T", b)
+	}
+
+	if _, err := Open(DefaultConfig("carrier-pigeon", "")); !errors.Is(err, ErrUnknownDriver) {
+		t.Errorf("Open of an unknown driver = %v, want %v", err, ErrUnknownDriver)
+	}
+	for _, config := range []Config{
+		DefaultConfig(DriverNATS, "http://localhost:4222"),
+		DefaultConfig(DriverRabbitMQ, "http://localhost:5672"),
+	} {
+		if _, err := Open(config); err == nil {
+			t.Errorf("Open of %s at %s succeeded", config.Driver, config.URL)
+		}
+	}
+}
+
+// closedAddress is a local address nothing listens on
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestDialUnreachableBroker(t *testing.T) {
+	if _, err := DialNATS("nats://"+closedAddress(t), "CONNECT_FOUR"); err == nil {
+		t.Error("DialNATS of a closed port succeeded")
+	}
+	if _, err := DialRabbitMQ("amqp://guest:guest@"+closedAddress(t)+"/", "connect-four"); err == nil {
+		t.Error("DialRabbitMQ of a closed port succeeded")
+	}
+}
+
+func TestNATSName(t *testing.T) {
+	for name, want := range map[string]string{
+		"analytics_connect-four-moves": "analytics_connect-four-moves",
+		"analytics_games.*.moves":      "analytics_games___moves",
+		"analytics_games.>":            "analytics_games__",
+		"event processor_moves":        "event_processor_moves",
+	} {
+		if got := natsName(name); got != want {
+			t.Errorf("natsName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package bus
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+)
+
+// MemoryBus delivers messages within the process, for tests and deployments
+// that run everything in one binary. Nothing is kept: messages published
+// while no group subscribes to their topic are dropped, and a failed message
+// is logged rather than delivered again.
+type MemoryBus struct {
+	mu     sync.RWMutex
+	groups map[string]*memoryGroup // by group name
+	closed bool
+}
+
+// memoryGroup is the subscribers of one group, messages are spread over them
+// by key so a key's messages stay in order
+type memoryGroup struct {
+	topics      map[string]bool
+	subscribers []*memorySubscriber
+}
+
+type memorySubscriber struct {
+	queue chan Message
+	done  chan struct{} // closed when the subscriber stops reading
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{groups: make(map[string]*memoryGroup)}
+}
+
+// Publish hands the message to one subscriber of every group reading its
+// topic, waiting while a subscriber's queue is full
+func (b *MemoryBus) Publish(ctx context.Context, message Message) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	for _, group := range b.groups {
+		if !group.topics[message.Topic] || len(group.subscribers) == 0 {
+			continue
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(message.Key))
+		subscriber := group.subscribers[hash.Sum32()%uint32(len(group.subscribers))]
+
+		select {
+		case subscriber.queue <- message:
+		case <-subscriber.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe handles the topics' messages until the context is done
+func (b *MemoryBus) Subscribe(ctx context.Context, group string, topics []string, handler Handler) error {
+	subscriber := &memorySubscriber{
+		queue: make(chan Message, 256),
+		done:  make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	g, ok := b.groups[group]
+	if !ok {
+		g = &memoryGroup{topics: make(map[string]bool)}
+		b.groups[group] = g
+	}
+	for _, topic := range topics {
+		g.topics[topic] = true
+	}
+	g.subscribers = append(g.subscribers, subscriber)
+	b.mu.Unlock()
+
+	defer b.unsubscribe(group, subscriber)
+	defer close(subscriber.done) // first, so publishers waiting on this subscriber let go
+
+	for {
+		select {
+		case message := <-subscriber.queue:
+			if err := handler(ctx, message); err != nil {
+				log.Printf("Memory bus: dropping %s message %s: %v", message.Topic, message.Key, err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *MemoryBus) unsubscribe(group string, subscriber *memorySubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, ok := b.groups[group]
+	if !ok {
+		return
+	}
+	for i, s := range g.subscribers {
+		if s == subscriber {
+			g.subscribers = append(g.subscribers[:i], g.subscribers[i+1:]...)
+			break
+		}
+	}
+	if len(g.subscribers) == 0 {
+		delete(b.groups, group)
+	}
+}
+
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
@@ -0,0 +1,277 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// subscribe runs a subscriber of the group until the test ends, sending what
+// it handles to the returned channel
+func subscribe(t *testing.T, b *MemoryBus, group string, topics ...string) <-chan Message {
+	t.Helper()
+	handled := make(chan Message, 1024)
+	subscribers := subscriberCount(b, group)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		b.Subscribe(ctx, group, topics, func(ctx context.Context, message Message) error {
+			handled <- message
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	waitForSubscribers(t, b, group, subscribers+1)
+	return handled
+}
+
+func subscriberCount(b *MemoryBus, group string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if g, ok := b.groups[group]; ok {
+		return len(g.subscribers)
+	}
+	return 0
+}
+
+// waitForSubscribers waits until the group has that many subscribers
+func waitForSubscribers(t *testing.T, b *MemoryBus, group string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for subscriberCount(b, group) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("group %s never got %d subscribers", group, count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, handled <-chan Message) Message {
+	t.Helper()
+	select {
+	case message := <-handled:
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message delivered")
+		return Message{}
+	}
+}
+
+func expectNothing(t *testing.T, handled <-chan Message) {
+	t.Helper()
+	select {
+	case message := <-handled:
+		t.Errorf("unexpected %s message %s", message.Topic, message.Key)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestMemoryBusDelivers(t *testing.T) {
+	b := NewMemoryBus()
+	handled := subscribe(t, b, "analytics", "moves", "lifecycle")
+
+	sent := Message{Topic: "moves", Key: "game-1", Value: []byte(`{"column":3}`), Headers: map[string]string{"event_type": "move_played"}}
+	if err := b.Publish(context.Background(), sent); err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, handled)
+	if got.Topic != sent.Topic || got.Key != sent.Key || string(got.Value) != string(sent.Value) || got.Headers["event_type"] != "move_played" {
+		t.Errorf("handled %+v, want %+v", got, sent)
+	}
+
+	// Topics the group doesn't read aren't delivered
+	if err := b.Publish(context.Background(), Message{Topic: "chat", Key: "game-1"}); err != nil {
+		t.Fatal(err)
+	}
+	expectNothing(t, handled)
+}
+
+func TestMemoryBusEveryGroupGetsMessages(t *testing.T) {
+	b := NewMemoryBus()
+	analytics := subscribe(t, b, "analytics", "moves")
+	archive := subscribe(t, b, "archive", "moves")
+
+	if err := b.Publish(context.Background(), Message{Topic: "moves", Key: "game-1"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, analytics)
+	receive(t, archive)
+}
+
+func TestMemoryBusGroupSplitsByKey(t *testing.T) {
+	b := NewMemoryBus()
+	first := subscribe(t, b, "analytics", "moves")
+	second := subscribe(t, b, "analytics", "moves")
+
+	const games, moves = 20, 10
+	for move := 0; move < moves; move++ {
+		for game := 0; game < games; game++ {
+			message := Message{Topic: "moves", Key: fmt.Sprintf("game-%d", game), Value: []byte{byte(move)}}
+			if err := b.Publish(context.Background(), message); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Each message is handled once, and all of a key's messages by one
+	// subscriber, in the order they were published
+	handledBy := make(map[string]int)
+	next := make(map[string]byte)
+	for i := 0; i < games*moves; i++ {
+		var message Message
+		var subscriber int
+		select {
+		case message = <-first:
+			subscriber = 1
+		case message = <-second:
+			subscriber = 2
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%d of %d messages delivered", i, games*moves)
+		}
+
+		if by, ok := handledBy[message.Key]; ok && by != subscriber {
+			t.Errorf("%s was handled by both subscribers", message.Key)
+		}
+		handledBy[message.Key] = subscriber
+		if message.Value[0] != next[message.Key] {
+			t.Errorf("%s move %d handled when move %d was next", message.Key, message.Value[0], next[message.Key])
+		}
+		next[message.Key] = message.Value[0] + 1
+	}
+	expectNothing(t, first)
+	expectNothing(t, second)
+
+	bySubscriber := make(map[int]int)
+	for _, subscriber := range handledBy {
+		bySubscriber[subscriber]++
+	}
+	if bySubscriber[1] == 0 || bySubscriber[2] == 0 {
+		t.Errorf("games were split %v between the subscribers, want both used", bySubscriber)
+	}
+}
+
+func TestMemoryBusDropsWithoutSubscribers(t *testing.T) {
+	b := NewMemoryBus()
+	if err := b.Publish(context.Background(), Message{Topic: "moves", Key: "game-1"}); err != nil {
+		t.Fatalf("Publish with nobody subscribed: %v", err)
+	}
+
+	// Nothing was kept for a group subscribing later
+	handled := subscribe(t, b, "analytics", "moves")
+	expectNothing(t, handled)
+}
+
+func TestMemoryBusHandlerErrorDrops(t *testing.T) {
+	b := NewMemoryBus()
+	var mu sync.Mutex
+	var calls []string
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Subscribe(ctx, "analytics", []string{"moves"}, func(ctx context.Context, message Message) error {
+		mu.Lock()
+		calls = append(calls, message.Key)
+		mu.Unlock()
+		if message.Key == "bad" {
+			return errors.New("malformed event")
+		}
+		return nil
+	})
+	waitForSubscribers(t, b, "analytics", 1)
+
+	for _, key := range []string{"bad", "good"} {
+		if err := b.Publish(context.Background(), Message{Topic: "moves", Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		got := append([]string(nil), calls...)
+		mu.Unlock()
+		if len(got) >= 2 {
+			if len(got) != 2 || got[0] != "bad" || got[1] != "good" {
+				t.Errorf("handler was called for %v, want the failed message once and then the next", got)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handler was called for %v", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMemoryBusSubscribeStops(t *testing.T) {
+	b := NewMemoryBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- b.Subscribe(ctx, "analytics", []string{"moves"}, func(ctx context.Context, message Message) error { return nil })
+	}()
+	waitForSubscribers(t, b, "analytics", 1)
+
+	cancel()
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Subscribe returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe kept running after its context was cancelled")
+	}
+
+	b.mu.RLock()
+	groups := len(b.groups)
+	b.mu.RUnlock()
+	if groups != 0 {
+		t.Errorf("%d groups left after the last subscriber stopped", groups)
+	}
+}
+
+func TestMemoryBusPublishWaitsForFullQueue(t *testing.T) {
+	b := NewMemoryBus()
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Subscribe(ctx, "analytics", []string{"moves"}, func(ctx context.Context, message Message) error {
+		<-release
+		return nil
+	})
+	waitForSubscribers(t, b, "analytics", 1)
+	defer close(release)
+
+	// One message is being handled and the queue holds 256 more
+	for i := 0; i < 257; i++ {
+		if err := b.Publish(context.Background(), Message{Topic: "moves", Key: "game-1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publishCtx, cancelPublish := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelPublish()
+	if err := b.Publish(publishCtx, Message{Topic: "moves", Key: "game-1"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Publish to a full queue = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMemoryBusClosed(t *testing.T) {
+	b := NewMemoryBus()
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(context.Background(), Message{Topic: "moves"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish after Close = %v, want %v", err, ErrClosed)
+	}
+	err := b.Subscribe(context.Background(), "analytics", []string{"moves"}, func(ctx context.Context, message Message) error { return nil })
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe after Close = %v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,12 @@
+package chat
+
+import "errors"
+
+var (
+	ErrEmptyMessage    = errors.New("chat message is empty")
+	ErrMessageTooLong  = errors.New("chat message is too long")
+	ErrRateLimited     = errors.New("sending chat messages too quickly")
+	ErrMessageRejected = errors.New("chat message was rejected")
+	ErrUnknownEmote    = errors.New("unknown emote")
+	ErrEmoteCooldown   = errors.New("emote is cooling down")
+)
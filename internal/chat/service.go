@@ -0,0 +1,244 @@
+package chat
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Config holds chat limits
+type Config struct {
+	MaxMessageLength int           `json:"max_message_length"` // in characters
+	HistorySize      int           `json:"history_size"`       // messages kept per game for reconnects
+	HistoryRetention time.Duration `json:"history_retention"`  // how long history outlives its game
+	RateLimit        int           `json:"rate_limit"`         // messages a sender may post per window
+	RateWindow       time.Duration `json:"rate_window"`
+	EmoteCooldown    time.Duration `json:"emote_cooldown"` // between two emotes from the same sender
+}
+
+// DefaultConfig returns chat limits that let a player post 5 messages of up
+// to 200 characters every 10 seconds and an emote every 3, with the last 50
+// messages of a game replayed to reconnecting players
+func DefaultConfig() Config {
+	return Config{
+		MaxMessageLength: 200,
+		HistorySize:      50,
+		HistoryRetention: 5 * time.Minute,
+		RateLimit:        5,
+		RateWindow:       10 * time.Second,
+		EmoteCooldown:    3 * time.Second,
+	}
+}
+
+// Emotes are the quick reactions that can be sent in a game, by ID. Unlike
+// chat they need no filtering and aren't kept in the history.
+var Emotes = []string{"gg", "good_luck", "nice_move", "well_played", "oops", "thinking", "wow", "thanks"}
+
+// Filter inspects a message before it is sent. It returns the text to send,
+// masked if need be, or ErrMessageRejected to drop the message.
+type Filter func(senderName, text string) (string, error)
+
+// Service validates, filters and rate limits game chat and keeps each game's
+// recent messages so reconnecting players and new spectators can catch up
+type Service struct {
+	config  Config
+	filters []Filter
+
+	history map[uuid.UUID][]*models.ChatMessage
+	sent    map[uuid.UUID][]time.Time // recent send times per sender
+	emoted  map[uuid.UUID]time.Time   // last emote per sender
+	mutex   sync.Mutex
+}
+
+// NewService creates a new chat service
+func NewService(config Config) *Service {
+	return &Service{
+		config:  config,
+		history: make(map[uuid.UUID][]*models.ChatMessage),
+		sent:    make(map[uuid.UUID][]time.Time),
+		emoted:  make(map[uuid.UUID]time.Time),
+	}
+}
+
+// AddFilter registers a filter run on every message, in the order added
+func (s *Service) AddFilter(filter Filter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.filters = append(s.filters, filter)
+}
+
+// Post checks a message from a player or spectator and adds it to the game's
+// history. The caller broadcasts the returned message.
+func (s *Service) Post(gameID, senderID uuid.UUID, senderName string, role models.ChatRole, text string) (*models.ChatMessage, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmptyMessage
+	}
+	if utf8.RuneCountInString(text) > s.config.MaxMessageLength {
+		return nil, ErrMessageTooLong
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if !s.allow(senderID, now) {
+		return nil, ErrRateLimited
+	}
+
+	filtered := text
+	for _, filter := range s.filters {
+		var err error
+		if filtered, err = filter(senderName, filtered); err != nil {
+			return nil, err
+		}
+	}
+
+	message := &models.ChatMessage{
+		ID:         uuid.New(),
+		GameID:     gameID,
+		SenderID:   senderID,
+		SenderName: senderName,
+		Role:       role,
+		Text:       filtered,
+		Filtered:   filtered != text,
+		SentAt:     now,
+	}
+
+	history := append(s.history[gameID], message)
+	if len(history) > s.config.HistorySize {
+		history = history[len(history)-s.config.HistorySize:]
+	}
+	s.history[gameID] = history
+
+	return message, nil
+}
+
+// Emote checks a quick reaction against the emote list and the sender's
+// cooldown. The caller broadcasts the returned emote.
+func (s *Service) Emote(gameID, senderID uuid.UUID, senderName string, role models.ChatRole, emote string) (*models.Emote, error) {
+	if !isEmote(emote) {
+		return nil, ErrUnknownEmote
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if last, exists := s.emoted[senderID]; exists && now.Sub(last) < s.config.EmoteCooldown {
+		return nil, ErrEmoteCooldown
+	}
+	s.emoted[senderID] = now
+
+	return &models.Emote{
+		GameID:     gameID,
+		SenderID:   senderID,
+		SenderName: senderName,
+		Role:       role,
+		Emote:      emote,
+		SentAt:     now,
+	}, nil
+}
+
+// History returns the game's recent messages, oldest first
+func (s *Service) History(gameID uuid.UUID) []*models.ChatMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	history := s.history[gameID]
+	copied := make([]*models.ChatMessage, len(history))
+	copy(copied, history)
+	return copied
+}
+
+// EndGame drops the game's history once HistoryRetention has passed, leaving
+// time for post-game messages and late reconnects
+func (s *Service) EndGame(gameID uuid.UUID) {
+	time.AfterFunc(s.config.HistoryRetention, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		delete(s.history, gameID)
+
+		// Senders who have gone quiet no longer need their send times
+		cutoff := time.Now().Add(-s.config.RateWindow)
+		for senderID, recent := range s.sent {
+			if len(recent) == 0 || !recent[len(recent)-1].After(cutoff) {
+				delete(s.sent, senderID)
+			}
+		}
+		for senderID, last := range s.emoted {
+			if time.Since(last) >= s.config.EmoteCooldown {
+				delete(s.emoted, senderID)
+			}
+		}
+	})
+}
+
+// allow records a send if the sender is within the rate limit; callers must hold the mutex
+func (s *Service) allow(senderID uuid.UUID, now time.Time) bool {
+	cutoff := now.Add(-s.config.RateWindow)
+
+	recent := s.sent[senderID]
+	for len(recent) > 0 && !recent[0].After(cutoff) {
+		recent = recent[1:]
+	}
+
+	if len(recent) >= s.config.RateLimit {
+		s.sent[senderID] = recent
+		return false
+	}
+
+	s.sent[senderID] = append(recent, now)
+	return true
+}
+
+func isEmote(emote string) bool {
+	for _, known := range Emotes {
+		if emote == known {
+			return true
+		}
+	}
+	return false
+}
+
+// WordFilter masks the given words, matched without regard to case, with
+// asterisks. It is the hook for a profanity list.
+func WordFilter(words []string) Filter {
+	blocked := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			blocked = append(blocked, word)
+		}
+	}
+
+	return func(senderName, text string) (string, error) {
+		if len(blocked) == 0 {
+			return text, nil
+		}
+
+		fields := strings.Fields(text)
+		masked := false
+		for i, field := range fields {
+			word := strings.ToLower(strings.Trim(field, ".,!?;:'\"()"))
+			for _, b := range blocked {
+				if word == b {
+					fields[i] = strings.Repeat("*", utf8.RuneCountInString(field))
+					masked = true
+					break
+				}
+			}
+		}
+
+		if !masked {
+			return text, nil
+		}
+		return strings.Join(fields, " "), nil
+	}
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file for the test and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := Default(); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Load(\"\") = %+v, want the defaults %+v", cfg, want)
+	}
+}
+
+func TestLoadExampleFile(t *testing.T) {
+	// The example lists the defaults, so it must load and change nothing.
+	// Printed, so the file's empty lists equal the defaults' nil ones.
+	cfg, err := Load("../../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, want := fmt.Sprintf("%+v", *cfg), fmt.Sprintf("%+v", *Default())
+	if got != want {
+		t.Errorf("config.example.yaml differs from the defaults:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, `---
+# Comments are skipped
+server:
+  port: 9090                    # numbers set string settings as written
+  session_secret: "has # and: in it"
+  allowed_origins: [https://a.example, 'https://b.example']
+  admin_usernames:
+  - alice
+  - bob
+  log_level: debug
+
+timeouts: &timeouts
+  bot_match_timeout: 20s
+  max_bot_match_timeout: 3m
+matchmaking:
+  <<: *timeouts
+  max_bot_match_timeout: 4m     # overrides the merged value
+  penalty_cooldowns:
+    - 2m
+    - 10m
+  rating_range:
+    step: 25
+
+kafka:
+  brokers: [kafka-1:9092, kafka-2:9092]
+  topic_routes: >-
+    moves=game-moves,
+    lifecycle=game-lifecycle
+  spool_dir: ~
+
+tracing:
+  sample_rate: 0.25
+`)
+
+	// timeouts isn't a section of the config, so drop it after anchoring
+	data, _ := os.ReadFile(path)
+	document, err := parseYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(document, "timeouts")
+	cfg := Default()
+	if err := decodeYAML(cfg, document); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		setting   string
+		got, want interface{}
+	}{
+		{"server.port", cfg.Server.Port, "9090"},
+		{"server.session_secret", cfg.Server.SessionSecret, "has # and: in it"},
+		{"server.allowed_origins", cfg.Server.AllowedOrigins, []string{"https://a.example", "https://b.example"}},
+		{"server.admin_usernames", cfg.Server.AdminUsernames, []string{"alice", "bob"}},
+		{"server.log_level", cfg.Server.LogLevel, "debug"},
+		{"server.read_timeout", cfg.Server.ReadTimeout, 15 * time.Second},
+		{"matchmaking.bot_match_timeout", cfg.Matchmaking.BotMatchTimeout, 20 * time.Second},
+		{"matchmaking.max_bot_match_timeout", cfg.Matchmaking.MaxBotMatchTimeout, 4 * time.Minute},
+		{"matchmaking.penalty_cooldowns", cfg.Matchmaking.PenaltyCooldowns, []time.Duration{2 * time.Minute, 10 * time.Minute}},
+		{"matchmaking.rating_range.step", cfg.Matchmaking.RatingRange.Step, 25},
+		{"matchmaking.rating_range.initial", cfg.Matchmaking.RatingRange.Initial, Default().Matchmaking.RatingRange.Initial},
+		{"kafka.brokers", cfg.Kafka.Brokers, []string{"kafka-1:9092", "kafka-2:9092"}},
+		{"kafka.topic_routes", cfg.Kafka.TopicRoutes, "moves=game-moves, lifecycle=game-lifecycle"},
+		{"kafka.spool_dir", cfg.Kafka.SpoolDir, ""},
+		{"tracing.sample_rate", cfg.Tracing.SampleRate, 0.25},
+	}
+	for _, check := range checks {
+		if !reflect.DeepEqual(check.got, check.want) {
+			t.Errorf("%s = %#v, want %#v", check.setting, check.got, check.want)
+		}
+	}
+}
+
+func TestLoadEnvironmentOverridesFile(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  port: "9090"
+consumer:
+  workers: 4
+  batch_size: 50
+`)
+	t.Setenv("PORT", "7070")
+	t.Setenv("CONSUMER_WORKERS", "16")
+	t.Setenv("METRICS_CORS_ORIGINS", "https://a.example, https://b.example")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != "7070" || cfg.Consumer.Workers != 16 {
+		t.Errorf("port %s and workers %d, want the environment's 7070 and 16", cfg.Server.Port, cfg.Consumer.Workers)
+	}
+	if cfg.Consumer.BatchSize != 50 {
+		t.Errorf("batch size %d, want the file's 50", cfg.Consumer.BatchSize)
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !reflect.DeepEqual(cfg.Consumer.MetricsCORSOrigins, want) {
+		t.Errorf("CORS origins %v, want %v", cfg.Consumer.MetricsCORSOrigins, want)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		want    string
+	}{
+		{"unknown setting", "server:\n  prot: 8080\n", nil, "server.prot: unknown setting"},
+		{"unknown section", "servers:\n  port: 8080\n", nil, "servers: unknown setting"},
+		{"bad duration", "server:\n  read_timeout: 15\n", nil, `server.read_timeout: "15" isn't a duration`},
+		{"bad number", "consumer:\n  workers: many\n", nil, `consumer.workers: "many" isn't a whole number`},
+		{"bad bool", "analytics:\n  enabled: sometimes\n", nil, `analytics.enabled: "sometimes" isn't true or false`},
+		{"list for a value", "server:\n  port: [8080]\n", nil, "server.port: expected a single value, not a list"},
+		{"section for a value", "server:\n  port:\n    number: 8080\n", nil, "server.port: expected a value, not a section"},
+		{"value for a section", "server: 8080\n", nil, "server: expected a section of settings"},
+		{"set twice", "server:\n  port: 8080\n  port: 9090\n", nil, "line 3: port is set twice"},
+		{"not a mapping", "- server\n", nil, "the file must be a mapping of sections"},
+		{"invalid YAML", "server:\n  port: [8080\n", nil, "yaml:"},
+		{"bad environment", "", map[string]string{"CONSUMER_BATCH_SIZE": "lots"}, `invalid CONSUMER_BATCH_SIZE: "lots" isn't a whole number`},
+		{"invalid value", "consumer:\n  workers: 0\n", nil, "consumer.workers must be positive"},
+		{"negative duration", "consumer:\n  metrics_push_interval: -5s\n", nil, "consumer.metrics_push_interval can't be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := Load(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEmptyFile(t *testing.T) {
+	for _, content := range []string{"", "# nothing set\n", "---\n", "~\n"} {
+		cfg, err := Load(writeConfig(t, content))
+		if err != nil {
+			t.Errorf("Load(%q) = %v", content, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, Default()) {
+			t.Errorf("Load(%q) changed the defaults", content)
+		}
+	}
+}
+
+func TestKafkaConsumer(t *testing.T) {
+	t.Setenv("KAFKA_SASL_MECHANISM", "scram-sha-512")
+	t.Setenv("ARCHIVE_MAX_EVENTS", "500")
+	t.Setenv("SNAPSHOT_INTERVAL", "2m")
+	cfg, err := Load(writeConfig(t, `
+kafka:
+  brokers: [kafka-1:9092]
+  group_id: analytics-test
+consumer:
+  batch_size: 25
+  workers: 2
+  lag_warning: 0
+  archive_url: s3://events/raw
+  snapshot_path: /var/lib/consumer/state.json
+  shared_counters: postgres
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := cfg.KafkaConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.Brokers, []string{"kafka-1:9092"}) || config.GroupID != "analytics-test" {
+		t.Errorf("brokers %v and group %s, want the file's", config.Brokers, config.GroupID)
+	}
+	if config.BatchSize != 25 || config.Workers != 2 || config.LagWarningThreshold != 0 {
+		t.Errorf("batch size %d, workers %d and lag warning %d, want 25, 2 and 0", config.BatchSize, config.Workers, config.LagWarningThreshold)
+	}
+	if config.Archive.URL != "s3://events/raw" || config.Archive.MaxEvents != 500 {
+		t.Errorf("archive %s of %d events, want the file's URL and the environment's size", config.Archive.URL, config.Archive.MaxEvents)
+	}
+	if config.Snapshot.Path != "/var/lib/consumer/state.json" || config.Snapshot.Interval != 2*time.Minute {
+		t.Errorf("snapshot %s every %v", config.Snapshot.Path, config.Snapshot.Interval)
+	}
+	if config.SharedCounters.URL != "postgres" {
+		t.Errorf("shared counters %q, want postgres", config.SharedCounters.URL)
+	}
+	if config.Security.SASLMechanism != "SCRAM-SHA-512" {
+		t.Errorf("SASL mechanism %q, want the environment's", config.Security.SASLMechanism)
+	}
+}
+
+func TestTracerServiceName(t *testing.T) {
+	tracing := TracingConfig{Endpoint: "http://jaeger:4318", SampleRate: 0.5}
+	if config := tracing.Tracer("connect-four-analytics-consumer"); config.ServiceName != "connect-four-analytics-consumer" || config.SampleRate != 0.5 {
+		t.Errorf("tracer config %+v, want the process's own name", config)
+	}
+	tracing.ServiceName = "analytics-eu"
+	if config := tracing.Tracer("connect-four-analytics-consumer"); config.ServiceName != "analytics-eu" {
+		t.Errorf("service name %s, want the configured analytics-eu", config.ServiceName)
+	}
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeYAML sets the settings of the parsed file on cfg. Settings the file
+// doesn't name keep their value, unknown ones are an error so typos don't go
+// unnoticed.
+func decodeYAML(cfg *Config, document map[string]interface{}) error {
+	return decodeNode(reflect.ValueOf(cfg).Elem(), document, "")
+}
+
+func decodeNode(value reflect.Value, node interface{}, path string) error {
+	if node == nil {
+		return nil
+	}
+
+	if value.Kind() == reflect.Struct && value.Type() != durationType {
+		settings, ok := node.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected a section of settings", path)
+		}
+		fields := make(map[string]reflect.Value)
+		for i := 0; i < value.NumField(); i++ {
+			if name := value.Type().Field(i).Tag.Get("yaml"); name != "" {
+				fields[name] = value.Field(i)
+			}
+		}
+
+		// Sorted, so the same file always reports the same first error
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			field, exists := fields[name]
+			if !exists {
+				return fmt.Errorf("%s: unknown setting", joinPath(path, name))
+			}
+			if err := decodeNode(field, settings[name], joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch node := node.(type) {
+	case string:
+		if err := setValue(value, node); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case []interface{}:
+		if value.Kind() != reflect.Slice {
+			return fmt.Errorf("%s: expected a single value, not a list", path)
+		}
+		items := reflect.MakeSlice(value.Type(), 0, len(node))
+		for i, item := range node {
+			text, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%s[%d]: expected a value", path, i)
+			}
+			element := reflect.New(value.Type().Elem()).Elem()
+			if err := setValue(element, text); err != nil {
+				return fmt.Errorf("%s[%d]: %w", path, i, err)
+			}
+			items = reflect.Append(items, element)
+		}
+		value.Set(items)
+	default:
+		return fmt.Errorf("%s: expected a value, not a section", path)
+	}
+	return nil
+}
+
+// decodeEnv overrides the settings whose environment variable is set and not empty
+func decodeEnv(cfg *Config) error {
+	return walkSettings(reflect.ValueOf(cfg).Elem(), "", func(value reflect.Value, path string, field reflect.StructField) error {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return nil
+		}
+		text := os.Getenv(name)
+		if text == "" {
+			return nil
+		}
+		if err := setValue(value, text); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// walkSettings calls visit for every setting below value, with its path in the file
+func walkSettings(value reflect.Value, path string, visit func(value reflect.Value, path string, field reflect.StructField) error) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		fieldPath := joinPath(path, field.Tag.Get("yaml"))
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			if err := walkSettings(value.Field(i), fieldPath, visit); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := visit(value.Field(i), fieldPath, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setValue parses text into the setting. Lists are comma separated.
+func setValue(value reflect.Value, text string) error {
+	text = strings.TrimSpace(text)
+
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("%q isn't a duration like 30s or 5m", text)
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		flag, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%q isn't true or false", text)
+		}
+		value.SetBool(flag)
+	case reflect.Int, reflect.Int64:
+		number, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q isn't a whole number", text)
+		}
+		value.SetInt(number)
+	case reflect.Float64:
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", text)
+		}
+		value.SetFloat(number)
+	case reflect.Slice:
+		items := reflect.MakeSlice(value.Type(), 0, 0)
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			element := reflect.New(value.Type().Elem()).Elem()
+			if err := setValue(element, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, element)
+		}
+		value.Set(items)
+	default:
+		return fmt.Errorf("settings of type %s can't be set", value.Type())
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
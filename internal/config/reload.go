@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Change is a setting a reload found changed. Applied is false for the
+// settings that only take effect on a restart, and for those whose change
+// failed to apply.
+type Change struct {
+	Setting string `json:"setting"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ReloadStatus is the settings that can be reloaded, as they are running,
+// and the outcome of the last reload
+type ReloadStatus struct {
+	Path        string            `json:"path,omitempty"`
+	Settings    map[string]string `json:"settings"`
+	Reloads     int               `json:"reloads"`
+	LastReload  *time.Time        `json:"last_reload,omitempty"`
+	LastError   string            `json:"last_error,omitempty"`
+	LastChanges []Change          `json:"last_changes"`
+}
+
+// Reloader loads the configuration again while the server runs, on SIGHUP or
+// an admin's request. The new configuration is validated as a whole and
+// thrown away if any setting is invalid. Of the settings it changes, those
+// with an OnChange function are applied, the others are logged as waiting
+// for a restart and keep their running value.
+type Reloader struct {
+	path string
+
+	mutex    sync.Mutex
+	current  *Config
+	appliers map[string]func(*Config) error
+	status   ReloadStatus
+}
+
+// NewReloader reloads the file at path, or only the environment when it is
+// empty, over cfg, the configuration the server started with
+func NewReloader(path string, cfg *Config) *Reloader {
+	return &Reloader{
+		path:     path,
+		current:  cfg,
+		appliers: make(map[string]func(*Config) error),
+		status:   ReloadStatus{Path: path, LastChanges: []Change{}},
+	}
+}
+
+// OnChange makes a setting reloadable, apply is called with the new
+// configuration when a reload changes it
+func (r *Reloader) OnChange(setting string, apply func(*Config) error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := indexSettings(r.current)[setting]; !exists {
+		panic(fmt.Sprintf("config: no setting %s to reload", setting))
+	}
+	r.appliers[setting] = apply
+}
+
+// Reload loads and validates the configuration, then applies the reloadable
+// settings it changes. Every change is logged and returned. An error means
+// the configuration couldn't be loaded and nothing was changed.
+func (r *Reloader) Reload() ([]Change, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.status.Reloads++
+	r.status.LastReload = &now
+
+	loaded, err := Load(r.path)
+	if err != nil {
+		r.status.LastError = err.Error()
+		r.status.LastChanges = []Change{}
+		log.Printf("Config reload failed, keeping the running settings: %v", err)
+		return nil, err
+	}
+
+	// The running configuration only takes the changes that were applied
+	next := *r.current
+	loadedSettings := indexSettings(loaded)
+
+	changes := []Change{}
+	for _, running := range listSettings(&next) {
+		value := loadedSettings[running.path]
+		if reflect.DeepEqual(running.value.Interface(), value.value.Interface()) {
+			continue
+		}
+
+		change := Change{Setting: running.path, From: running.String(), To: value.String()}
+		apply, reloadable := r.appliers[running.path]
+		if !reloadable {
+			log.Printf("Config reload: %s changed from %s to %s, restart the server to apply it", change.Setting, change.From, change.To)
+		} else if err := apply(loaded); err != nil {
+			change.Error = err.Error()
+			log.Printf("Config reload: failed to change %s from %s to %s: %v", change.Setting, change.From, change.To, err)
+		} else {
+			change.Applied = true
+			running.value.Set(value.value)
+			log.Printf("Config reload: %s changed from %s to %s", change.Setting, change.From, change.To)
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) == 0 {
+		log.Println("Config reload: no settings changed")
+	}
+
+	r.current = &next
+	r.status.LastError = ""
+	r.status.LastChanges = changes
+	return changes, nil
+}
+
+// Status returns the running reloadable settings and the last reload's outcome
+func (r *Reloader) Status() ReloadStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := r.status
+	status.Settings = make(map[string]string, len(r.appliers))
+	settings := indexSettings(r.current)
+	for path := range r.appliers {
+		status.Settings[path] = settings[path].String()
+	}
+	status.LastChanges = append([]Change{}, r.status.LastChanges...)
+	return status
+}
+
+// setting is a setting's value in a configuration, and whether it is too
+// sensitive to log
+type setting struct {
+	path   string
+	value  reflect.Value
+	secret bool
+}
+
+func (s setting) String() string {
+	if s.secret {
+		return "(hidden)"
+	}
+	if s.value.Kind() == reflect.String {
+		return fmt.Sprintf("%q", s.value.String())
+	}
+	return fmt.Sprint(s.value.Interface())
+}
+
+// listSettings returns the settings of cfg in the order of the file
+func listSettings(cfg *Config) []setting {
+	var settings []setting
+	walkSettings(reflect.ValueOf(cfg).Elem(), "", func(value reflect.Value, path string, field reflect.StructField) error {
+		settings = append(settings, setting{path: path, value: value, secret: field.Tag.Get("secret") == "true"})
+		return nil
+	})
+	return settings
+}
+
+// indexSettings returns the settings of cfg by their path
+func indexSettings(cfg *Config) map[string]setting {
+	index := make(map[string]setting)
+	for _, s := range listSettings(cfg) {
+		index[s.path] = s
+	}
+	return index
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rewriteConfig replaces the content of the config file at path
+func rewriteConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeConfig(t, "server:\n  log_level: info\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := Default()
+
+	// log_level and the turn time limit are reloadable, the bot timeout's
+	// change fails to apply, the port and secret need a restart
+	applied := make(map[string]interface{})
+	r := NewReloader(path, cfg)
+	r.OnChange("server.log_level", func(c *Config) error {
+		applied["server.log_level"] = c.Server.LogLevel
+		return nil
+	})
+	r.OnChange("game.ranked_turn_time_limit", func(c *Config) error {
+		applied["game.ranked_turn_time_limit"] = c.Game.RankedTurnTimeLimit
+		return nil
+	})
+	r.OnChange("matchmaking.bot_match_timeout", func(c *Config) error {
+		return errors.New("bot match timeout too short")
+	})
+
+	changes, err := r.Reload()
+	if err != nil || len(changes) != 0 || len(applied) != 0 {
+		t.Fatalf("reloading the unchanged file = %+v, %v and applied %v, want no changes", changes, err, applied)
+	}
+
+	rewriteConfig(t, path, `server:
+  port: 9090
+  session_secret: rotated
+  log_level: debug
+game:
+  ranked_turn_time_limit: 45s
+matchmaking:
+  bot_match_timeout: 1s
+`)
+	changes, err = r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Setting: "server.port", From: `"8080"`, To: `"9090"`},
+		{Setting: "server.session_secret", From: "(hidden)", To: "(hidden)"},
+		{Setting: "server.log_level", From: `"info"`, To: `"debug"`, Applied: true},
+		{Setting: "game.ranked_turn_time_limit", From: fmt.Sprint(defaults.Game.RankedTurnTimeLimit), To: "45s", Applied: true},
+		{Setting: "matchmaking.bot_match_timeout", From: fmt.Sprint(defaults.Matchmaking.BotMatchTimeout), To: "1s", Error: "bot match timeout too short"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Reload = %+v, want %+v", changes, want)
+	}
+	wantApplied := map[string]interface{}{"server.log_level": "debug", "game.ranked_turn_time_limit": 45 * time.Second}
+	if !reflect.DeepEqual(applied, wantApplied) {
+		t.Errorf("applied %v, want %v", applied, wantApplied)
+	}
+
+	// Only the applied changes are running
+	status := r.Status()
+	wantSettings := map[string]string{
+		"server.log_level":              `"debug"`,
+		"game.ranked_turn_time_limit":   "45s",
+		"matchmaking.bot_match_timeout": fmt.Sprint(defaults.Matchmaking.BotMatchTimeout),
+	}
+	if !reflect.DeepEqual(status.Settings, wantSettings) || status.Path != path || status.Reloads != 2 ||
+		status.LastReload == nil || status.LastError != "" || !reflect.DeepEqual(status.LastChanges, want) {
+		t.Errorf("Status = %+v", status)
+	}
+	if cfg.Server.LogLevel != "info" || cfg.Server.Port != "8080" {
+		t.Error("the reload changed the configuration the server started with")
+	}
+
+	// The settings that weren't applied are still found changed
+	for key := range applied {
+		delete(applied, key)
+	}
+	changes, err = r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, []Change{want[0], want[1], want[4]}) || len(applied) != 0 {
+		t.Errorf("reloading again = %+v and applied %v, want the changes that weren't applied", changes, applied)
+	}
+}
+
+func TestReloadInvalidFile(t *testing.T) {
+	path := writeConfig(t, "server:\n  log_level: info\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := false
+	r := NewReloader(path, cfg)
+	r.OnChange("server.log_level", func(c *Config) error {
+		applied = true
+		return nil
+	})
+
+	// One invalid setting throws the whole file away
+	rewriteConfig(t, path, "server:\n  log_level: debug\nconsumer:\n  workers: 0\n")
+	changes, err := r.Reload()
+	if err == nil || !strings.Contains(err.Error(), "consumer.workers must be positive") || changes != nil {
+		t.Fatalf("Reload = %+v, %v, want the invalid setting rejected", changes, err)
+	}
+	if applied {
+		t.Error("a setting of the invalid file was applied")
+	}
+	status := r.Status()
+	if status.Settings["server.log_level"] != `"info"` || status.LastError != err.Error() || len(status.LastChanges) != 0 || status.Reloads != 1 {
+		t.Errorf("Status = %+v", status)
+	}
+
+	// Once fixed, the file reloads
+	rewriteConfig(t, path, "server:\n  log_level: debug\n")
+	if changes, err := r.Reload(); err != nil || len(changes) != 1 || !applied {
+		t.Errorf("reloading the fixed file = %+v, %v", changes, err)
+	}
+	if status := r.Status(); status.Settings["server.log_level"] != `"debug"` || status.LastError != "" {
+		t.Errorf("Status = %+v", status)
+	}
+}
+
+func TestOnChangeUnknownSetting(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("OnChange accepted a setting that doesn't exist")
+		}
+	}()
+	NewReloader("", Default()).OnChange("server.prot", func(*Config) error { return nil })
+}
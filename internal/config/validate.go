@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"connect-four-backend/internal/bus"
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/kafka"
+	"connect-four-backend/internal/logging"
+)
+
+// Validate checks every setting, reporting all the invalid ones at once
+func (c *Config) Validate() error {
+	var problems []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	// No duration is meaningful below zero
+	walkSettings(reflect.ValueOf(c).Elem(), "", func(value reflect.Value, path string, field reflect.StructField) error {
+		if value.Type() == durationType {
+			check(value.Int() >= 0, "%s can't be negative", path)
+		}
+		if value.Type() == reflect.TypeOf([]time.Duration(nil)) {
+			for _, duration := range value.Interface().([]time.Duration) {
+				check(duration > 0, "%s must all be positive", path)
+			}
+		}
+		return nil
+	})
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "server.port %q isn't a port number", c.Server.Port)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	_, err = logging.ParseLevel(c.Server.LogLevel)
+	check(err == nil, "server.log_level: %v", err)
+
+	limit := c.Game.RankedTurnTimeLimit
+	check(limit == 0 || (limit >= time.Second && limit%time.Second == 0), "game.ranked_turn_time_limit must be whole seconds, or 0 for no timer")
+	_, err = game.ParseDisconnectConfig(c.Game.DisconnectPolicy, c.Game.DisconnectPolicyOverrides)
+	check(err == nil, "game.disconnect_policy: %v", err)
+
+	m := c.Matchmaking
+	check(m.BotMatchTimeout > 0, "matchmaking.bot_match_timeout must be positive")
+	check(m.MaxBotMatchTimeout >= m.BotMatchTimeout, "matchmaking.max_bot_match_timeout can't be shorter than bot_match_timeout")
+	check(m.MatchCheckInterval > 0, "matchmaking.match_check_interval must be positive")
+	check(m.QueueUpdateInterval > 0, "matchmaking.queue_update_interval must be positive")
+	check(m.MaxQueueSize > 0, "matchmaking.max_queue_size must be positive")
+	check(m.PrivateRoomTTL > 0, "matchmaking.private_room_ttl must be positive")
+	check(m.RatingRange.Initial >= 0 && m.RatingRange.Step >= 0, "matchmaking.rating_range can't be negative")
+	check(m.RatingRange.Max >= m.RatingRange.Initial, "matchmaking.rating_range.max can't be below initial")
+	check(m.RatingRange.Step == 0 || m.RatingRange.Interval > 0, "matchmaking.rating_range.interval must be positive to widen the range")
+	check(m.RecentOpponents >= 0 && m.RecentOpponentMinQueue >= 0, "matchmaking.recent_opponents can't be negative")
+
+	k := c.Kafka
+	check(c.Analytics.MessageBus != bus.DriverKafka || len(k.Brokers) > 0, "kafka.brokers can't be empty")
+	check(k.Topic != "", "kafka.topic can't be empty")
+	_, err = kafka.ParseTopicRoutes(k.TopicRoutes)
+	check(err == nil, "kafka.topic_routes: %v", err)
+	switch k.Serialization {
+	case "json":
+	case "avro":
+		check(k.SchemaRegistryURL != "", "kafka.schema_registry_url is needed for avro")
+	default:
+		check(false, "kafka.serialization %q isn't json or avro", k.Serialization)
+	}
+	switch k.Compression {
+	case "gzip", "snappy", "lz4", "zstd":
+	default:
+		check(false, "kafka.compression %q isn't gzip, snappy, lz4 or zstd", k.Compression)
+	}
+	check(k.BatchSize > 0, "kafka.batch_size must be positive")
+	check(k.Retries >= 0, "kafka.retries can't be negative")
+	check(k.RequiredAcks >= -1 && k.RequiredAcks <= 1, "kafka.required_acks must be -1 (all), 0 or 1")
+	check(k.SpoolMaxBytes > 0, "kafka.spool_max_bytes must be positive")
+	check(k.GroupID != "", "kafka.group_id can't be empty")
+	check(k.FlushInterval > 0, "kafka.flush_interval must be positive")
+
+	d := c.Database
+	check(d.URL != "", "database.url can't be empty")
+	check(d.MaxOpenConns >= 0 && d.MaxIdleConns >= 0, "database connection counts can't be negative")
+
+	a := c.Analytics
+	_, err = kafka.ParseSamplingConfig(a.Sampling)
+	check(err == nil, "analytics.sampling: %v", err)
+	check(a.QueueSize > 0, "analytics.queue_size must be positive")
+	switch a.MessageBus {
+	case bus.DriverKafka, bus.DriverMemory:
+	case bus.DriverNATS, bus.DriverRabbitMQ:
+		check(a.MessageBusURL != "", "analytics.message_bus_url is needed for %s", a.MessageBus)
+	default:
+		check(false, "analytics.message_bus %q isn't kafka, nats, rabbitmq or memory", a.MessageBus)
+	}
+
+	check(c.Cluster.RedisURL == "" || (c.Cluster.NodeID != "" && c.Cluster.Prefix != ""), "cluster.node_id and cluster.prefix can't be empty")
+
+	check(c.Tracing.SampleRate >= 0 && c.Tracing.SampleRate <= 1, "tracing.sample_rate must be between 0 and 1")
+
+	check(c.Consumer.BatchSize > 0, "consumer.batch_size must be positive")
+	check(c.Consumer.Workers > 0, "consumer.workers must be positive")
+	check(c.Consumer.LagWarning >= 0, "consumer.lag_warning can't be negative")
+	check(c.Consumer.MetricsPushInterval > 0, "consumer.metrics_push_interval must be positive")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML parses the file with yaml.v3 into maps, lists and strings, the
+// shape decodeYAML takes. Scalars are kept as the text they were written as
+// and parsed for the setting they are decoded into, so "8080" and 8080 set a
+// port alike. Nulls and empty values are nil. Anchors and aliases, quoting
+// and multi-line values work as YAML has them.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	var file yaml.Node
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	// An empty file has no document
+	if len(file.Content) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	root := file.Content[0]
+	if root.Kind != yaml.MappingNode {
+		if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+			return map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("line %d: the file must be a mapping of sections", root.Line)
+	}
+	document, err := yamlValue(root)
+	if err != nil {
+		return nil, err
+	}
+	return document.(map[string]interface{}), nil
+}
+
+// yamlValue converts a node into a map, a list, a string or nil
+func yamlValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return nil, nil
+		}
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			item, err := yamlValue(child)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case yaml.MappingNode:
+		values := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			// Merge keys, <<: *defaults, set what the mapping doesn't
+			if key.Tag == "!!merge" {
+				if err := mergeYAML(values, value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if key.Kind != yaml.ScalarNode || key.Value == "" {
+				return nil, fmt.Errorf("line %d: expected a setting name", key.Line)
+			}
+			if _, exists := values[key.Value]; exists && !mergedYAML(node, i, key.Value) {
+				return nil, fmt.Errorf("line %d: %s is set twice", key.Line, key.Value)
+			}
+			converted, err := yamlValue(value)
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = converted
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("line %d: unexpected YAML node", node.Line)
+}
+
+// mergeYAML adds the mappings a merge key names to values, without replacing
+// what values already has
+func mergeYAML(values map[string]interface{}, node *yaml.Node) error {
+	sources := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		sources = node.Content
+	}
+	for _, source := range sources {
+		merged, err := yamlValue(source)
+		if err != nil {
+			return err
+		}
+		settings, ok := merged.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("line %d: only mappings can be merged", source.Line)
+		}
+		for key, value := range settings {
+			if _, exists := values[key]; !exists {
+				values[key] = value
+			}
+		}
+	}
+	return nil
+}
+
+// mergedYAML reports whether the key at index i of the mapping was only set
+// by a merge key before it, which the mapping's own setting overrides
+func mergedYAML(mapping *yaml.Node, i int, key string) bool {
+	for j := 0; j < i; j += 2 {
+		if mapping.Content[j].Tag != "!!merge" && mapping.Content[j].Value == key {
+			return false
+		}
+	}
+	return true
+}
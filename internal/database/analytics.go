@@ -0,0 +1,330 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AnalyticsAggregates are the analytics consumer's aggregated metrics, kept
+// so a restart carries on from them
+type AnalyticsAggregates struct {
+	Game    *GameTotals
+	Hourly  []HourlyStats
+	Daily   []DailyStats
+	Players []AggregatedPlayerStats
+}
+
+// GameTotals are the game counters over all time
+type GameTotals struct {
+	TotalGames        int64
+	CompletedGames    int64
+	TotalGameDuration int64 // seconds
+	DrawCount         int64
+	BotGames          int64
+	HumanGames        int64
+	WinTypes          map[string]int64
+}
+
+// HourlyStats are the games of one hour, keyed "2024-01-01-15"
+type HourlyStats struct {
+	Hour            string
+	Games           int64
+	Moves           int64
+	Players         int64
+	AverageDuration float64
+}
+
+// DailyStats are the games of one day, keyed "2024-01-01"
+type DailyStats struct {
+	Day             string
+	Games           int64
+	Moves           int64
+	Players         int64
+	NewPlayers      int64
+	AverageDuration float64
+}
+
+// AggregatedPlayerStats are a player's counters as the analytics consumer sees them
+type AggregatedPlayerStats struct {
+	Name             string
+	GamesPlayed      int64
+	GamesWon         int64
+	GamesLost        int64
+	GamesDrawn       int64
+	TotalMoves       int64
+	TotalGameTime    int64 // seconds
+	Disconnections   int64
+	Reconnections    int64
+	TotalOfflineTime time.Duration
+	FirstSeen        time.Time
+	LastSeen         time.Time
+	CurrentStreak    int64 // games won in a row
+	LongestStreak    int64
+}
+
+// SaveAnalyticsAggregates upserts the aggregates in one transaction. The
+// values replace what is stored, so saving the same aggregates twice is harmless.
+func (r *Repository) SaveAnalyticsAggregates(aggregates *AnalyticsAggregates) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin saving aggregates: %w", err)
+	}
+	defer tx.Rollback()
+
+	if game := aggregates.Game; game != nil {
+		winTypes, err := json.Marshal(game.WinTypes)
+		if err != nil {
+			return fmt.Errorf("failed to encode win types: %w", err)
+		}
+		_, err = r.exec(tx, `
+			INSERT INTO game_stats (id, total_games, completed_games, total_game_duration,
+				draw_count, bot_games, human_games, win_types, updated_at)
+			VALUES (1, $1, $2, $3, $4, $5, $6, $7, NOW())
+			ON CONFLICT (id) DO UPDATE SET
+				total_games = EXCLUDED.total_games,
+				completed_games = EXCLUDED.completed_games,
+				total_game_duration = EXCLUDED.total_game_duration,
+				draw_count = EXCLUDED.draw_count,
+				bot_games = EXCLUDED.bot_games,
+				human_games = EXCLUDED.human_games,
+				win_types = EXCLUDED.win_types,
+				updated_at = EXCLUDED.updated_at
+		`, game.TotalGames, game.CompletedGames, game.TotalGameDuration,
+			game.DrawCount, game.BotGames, game.HumanGames, winTypes)
+		if err != nil {
+			return fmt.Errorf("failed to save game totals: %w", err)
+		}
+	}
+
+	for _, hour := range aggregates.Hourly {
+		_, err := r.exec(tx, `
+			INSERT INTO hourly_stats (hour, games, moves, players, average_duration, updated_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())
+			ON CONFLICT (hour) DO UPDATE SET
+				games = EXCLUDED.games,
+				moves = EXCLUDED.moves,
+				players = EXCLUDED.players,
+				average_duration = EXCLUDED.average_duration,
+				updated_at = EXCLUDED.updated_at
+		`, hour.Hour, hour.Games, hour.Moves, hour.Players, hour.AverageDuration)
+		if err != nil {
+			return fmt.Errorf("failed to save hourly stats of %s: %w", hour.Hour, err)
+		}
+	}
+
+	for _, day := range aggregates.Daily {
+		_, err := r.exec(tx, `
+			INSERT INTO daily_stats (day, games, moves, players, new_players, average_duration, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NOW())
+			ON CONFLICT (day) DO UPDATE SET
+				games = EXCLUDED.games,
+				moves = EXCLUDED.moves,
+				players = EXCLUDED.players,
+				new_players = EXCLUDED.new_players,
+				average_duration = EXCLUDED.average_duration,
+				updated_at = EXCLUDED.updated_at
+		`, day.Day, day.Games, day.Moves, day.Players, day.NewPlayers, day.AverageDuration)
+		if err != nil {
+			return fmt.Errorf("failed to save daily stats of %s: %w", day.Day, err)
+		}
+	}
+
+	for _, player := range aggregates.Players {
+		_, err := r.exec(tx, `
+			INSERT INTO player_stats (player_name, games_played, games_won, games_lost, games_drawn,
+				total_moves, total_game_time, disconnections, reconnections, total_offline_ms,
+				first_seen, last_seen, current_streak, longest_streak)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			ON CONFLICT (player_name) DO UPDATE SET
+				games_played = EXCLUDED.games_played,
+				games_won = EXCLUDED.games_won,
+				games_lost = EXCLUDED.games_lost,
+				games_drawn = EXCLUDED.games_drawn,
+				total_moves = EXCLUDED.total_moves,
+				total_game_time = EXCLUDED.total_game_time,
+				disconnections = EXCLUDED.disconnections,
+				reconnections = EXCLUDED.reconnections,
+				total_offline_ms = EXCLUDED.total_offline_ms,
+				first_seen = EXCLUDED.first_seen,
+				last_seen = EXCLUDED.last_seen,
+				current_streak = EXCLUDED.current_streak,
+				longest_streak = EXCLUDED.longest_streak
+		`, player.Name, player.GamesPlayed, player.GamesWon, player.GamesLost, player.GamesDrawn,
+			player.TotalMoves, player.TotalGameTime, player.Disconnections, player.Reconnections,
+			player.TotalOfflineTime.Milliseconds(), player.FirstSeen, player.LastSeen,
+			player.CurrentStreak, player.LongestStreak)
+		if err != nil {
+			return fmt.Errorf("failed to save player stats of %s: %w", player.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit aggregates: %w", err)
+	}
+
+	return nil
+}
+
+// LoadAnalyticsAggregates returns the saved game totals, every player, and
+// the hours and days from the given keys on
+func (r *Repository) LoadAnalyticsAggregates(fromHour, fromDay string) (*AnalyticsAggregates, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	aggregates := &AnalyticsAggregates{}
+
+	var game GameTotals
+	var winTypes []byte
+	err := r.db.QueryRowContext(ctx, `
+		SELECT total_games, completed_games, total_game_duration, draw_count, bot_games, human_games, win_types
+		FROM game_stats WHERE id = 1
+	`).Scan(&game.TotalGames, &game.CompletedGames, &game.TotalGameDuration,
+		&game.DrawCount, &game.BotGames, &game.HumanGames, &winTypes)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, fmt.Errorf("failed to load game totals: %w", err)
+	default:
+		if err := json.Unmarshal(winTypes, &game.WinTypes); err != nil {
+			return nil, fmt.Errorf("failed to decode win types: %w", err)
+		}
+		aggregates.Game = &game
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT hour, games, moves, players, average_duration FROM hourly_stats WHERE hour >= $1
+	`, fromHour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hourly stats: %w", err)
+	}
+	for rows.Next() {
+		var hour HourlyStats
+		if err := rows.Scan(&hour.Hour, &hour.Games, &hour.Moves, &hour.Players, &hour.AverageDuration); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan hourly stats: %w", err)
+		}
+		aggregates.Hourly = append(aggregates.Hourly, hour)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating hourly stats rows: %w", err)
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT day, games, moves, players, new_players, average_duration FROM daily_stats WHERE day >= $1
+	`, fromDay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load daily stats: %w", err)
+	}
+	for rows.Next() {
+		var day DailyStats
+		if err := rows.Scan(&day.Day, &day.Games, &day.Moves, &day.Players, &day.NewPlayers, &day.AverageDuration); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan daily stats: %w", err)
+		}
+		aggregates.Daily = append(aggregates.Daily, day)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating daily stats rows: %w", err)
+	}
+
+	rows, err = r.db.QueryContext(ctx, `SELECT `+playerStatsColumns+` FROM player_stats`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load player stats: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		player, err := scanPlayerStats(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan player stats: %w", err)
+		}
+		aggregates.Players = append(aggregates.Players, player)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating player stats rows: %w", err)
+	}
+
+	return aggregates, nil
+}
+
+// LoadPlayerStats returns one player's saved counters, nil if none were saved
+func (r *Repository) LoadPlayerStats(name string) (*AggregatedPlayerStats, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+playerStatsColumns+` FROM player_stats WHERE player_name = $1`, name)
+	player, err := scanPlayerStats(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load player stats of %s: %w", name, err)
+	}
+	return &player, nil
+}
+
+// playerStatsColumns are the player_stats columns scanPlayerStats reads
+const playerStatsColumns = `player_name, games_played, games_won, games_lost, games_drawn, total_moves,
+	total_game_time, disconnections, reconnections, total_offline_ms, first_seen, last_seen,
+	current_streak, longest_streak`
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPlayerStats scans a row of playerStatsColumns
+func scanPlayerStats(row rowScanner) (AggregatedPlayerStats, error) {
+	var player AggregatedPlayerStats
+	var offlineMs int64
+	err := row.Scan(&player.Name, &player.GamesPlayed, &player.GamesWon, &player.GamesLost, &player.GamesDrawn,
+		&player.TotalMoves, &player.TotalGameTime, &player.Disconnections, &player.Reconnections,
+		&offlineMs, &player.FirstSeen, &player.LastSeen, &player.CurrentStreak, &player.LongestStreak)
+	player.TotalOfflineTime = time.Duration(offlineMs) * time.Millisecond
+	return player, err
+}
+
+// RetentionCohort is how many of the players first seen on Day came back
+type RetentionCohort struct {
+	Day         string
+	Players     int64
+	ReturnedD1  int64
+	ReturnedD7  int64
+	ReturnedD30 int64
+	Churned     int64
+}
+
+// SaveRetentionCohorts upserts the cohorts in one transaction
+func (r *Repository) SaveRetentionCohorts(cohorts []RetentionCohort) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin saving retention cohorts: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, cohort := range cohorts {
+		_, err := r.exec(tx, `
+			INSERT INTO retention_cohorts (cohort_day, players, returned_d1, returned_d7, returned_d30, churned, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NOW())
+			ON CONFLICT (cohort_day) DO UPDATE SET
+				players = EXCLUDED.players,
+				returned_d1 = EXCLUDED.returned_d1,
+				returned_d7 = EXCLUDED.returned_d7,
+				returned_d30 = EXCLUDED.returned_d30,
+				churned = EXCLUDED.churned,
+				updated_at = EXCLUDED.updated_at
+		`, cohort.Day, cohort.Players, cohort.ReturnedD1, cohort.ReturnedD7, cohort.ReturnedD30, cohort.Churned)
+		if err != nil {
+			return fmt.Errorf("failed to save retention cohort %s: %w", cohort.Day, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit retention cohorts: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the connection pool's limits and how long a query may run
+type Config struct {
+	MaxOpenConns    int           `json:"max_open_conns"`    // 0 for no limit
+	MaxIdleConns    int           `json:"max_idle_conns"`    // 0 to close connections once they're idle
+	ConnMaxLifetime time.Duration `json:"conn_max_lifetime"` // 0 to keep connections open for good
+	QueryTimeout    time.Duration `json:"query_timeout"`     // for each statement, 0 for no limit
+
+	// Calls to the store that take this long or longer are logged, 0 to log none
+	SlowQueryThreshold time.Duration `json:"slow_query_threshold"`
+
+	// Postgres replica the leaderboard, stats and history queries read from,
+	// empty to read everything from the primary. Its pool has the same limits.
+	ReplicaURL           string        `json:"-"`
+	ReplicaRetryInterval time.Duration `json:"replica_retry_interval"` // reads stay on the primary this long after the replica fails
+}
+
+// DefaultConfig returns the configuration used unless the environment sets
+// another one
+func DefaultConfig() Config {
+	return Config{
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 5 * time.Minute,
+		QueryTimeout:    10 * time.Second,
+
+		SlowQueryThreshold: 500 * time.Millisecond,
+
+		ReplicaRetryInterval: 30 * time.Second,
+	}
+}
+
+// ConfigFromEnv reads DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS,
+// DB_CONN_MAX_LIFETIME, DB_QUERY_TIMEOUT, DB_SLOW_QUERY_THRESHOLD,
+// DATABASE_REPLICA_URL and DB_REPLICA_RETRY_INTERVAL, using the defaults for those that aren't set
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig()
+	config.ReplicaURL = os.Getenv("DATABASE_REPLICA_URL")
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"DB_MAX_OPEN_CONNS", &config.MaxOpenConns},
+		{"DB_MAX_IDLE_CONNS", &config.MaxIdleConns},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 0 {
+				return config, fmt.Errorf("invalid %s: %q isn't a count of connections", setting.name, value)
+			}
+			*setting.value = count
+		}
+	}
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"DB_CONN_MAX_LIFETIME", &config.ConnMaxLifetime},
+		{"DB_QUERY_TIMEOUT", &config.QueryTimeout},
+		{"DB_SLOW_QUERY_THRESHOLD", &config.SlowQueryThreshold},
+		{"DB_REPLICA_RETRY_INTERVAL", &config.ReplicaRetryInterval},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration < 0 {
+				return config, fmt.Errorf("invalid %s: %q isn't a duration", setting.name, value)
+			}
+			*setting.value = duration
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// AddCounters adds the deltas to the shared counters in one transaction, so
+// every analytics consumer instance counts into the same totals. Deltas are
+// by counter name, then field.
+func (r *Repository) AddCounters(deltas map[string]map[string]int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin adding counters: %w", err)
+	}
+	defer tx.Rollback()
+
+	for name, fields := range deltas {
+		for field, delta := range fields {
+			_, err := r.exec(tx, `
+				INSERT INTO analytics_counters (name, field, value, updated_at)
+				VALUES ($1, $2, $3, NOW())
+				ON CONFLICT (name, field) DO UPDATE SET
+					value = analytics_counters.value + EXCLUDED.value,
+					updated_at = NOW()
+			`, name, field, delta)
+			if err != nil {
+				return fmt.Errorf("failed to add to counter %s %s: %w", name, field, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit counters: %w", err)
+	}
+	return nil
+}
+
+// LoadCounters returns the fields of the named shared counters
+func (r *Repository) LoadCounters(names []string) (map[string]map[string]int64, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT name, field, value FROM analytics_counters WHERE name = ANY($1)
+	`, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load counters: %w", err)
+	}
+	defer rows.Close()
+
+	counters := make(map[string]map[string]int64)
+	for rows.Next() {
+		var name, field string
+		var value int64
+		if err := rows.Scan(&name, &field, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan counter: %w", err)
+		}
+		if counters[name] == nil {
+			counters[name] = make(map[string]int64)
+		}
+		counters[name][field] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating counter rows: %w", err)
+	}
+
+	return counters, nil
+}
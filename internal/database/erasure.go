@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// playerTable is a table with rows about a player, named in column
+type playerTable struct {
+	table  string
+	column string
+}
+
+// postgresPlayerTables are the tables ErasePlayer deletes a player's rows from
+var postgresPlayerTables = []playerTable{
+	{"leaderboard", "username"},
+	{"leaderboard_periods", "username"},
+	{"player_ratings", "player_name"},
+	{"rating_history", "player_name"},
+	{"season_standings", "player_name"},
+	{"queue_penalties", "player_name"},
+	{"player_stats", "player_name"},
+	{"player_flags", "player_name"},
+}
+
+// ErasePlayer erases a player's data in one transaction: their games, moves
+// and replays are renamed to the alias, their ratings, standings and stats
+// are deleted, and so is their account when deleteAccount is set
+func (r *Repository) ErasePlayer(account *models.Account, alias string, deleteAccount bool) (*models.PlayerErasure, error) {
+	return erasePlayer(r.db, postgresHistory, r.exec, r.queryContext, postgresPlayerTables, account, alias, deleteAccount)
+}
+
+// DeleteGameMovesBefore deletes up to limit game_moves rows played before the
+// cutoff, returning how many it deleted
+func (r *Repository) DeleteGameMovesBefore(cutoff time.Time, limit int) (int64, error) {
+	return deleteGameMovesBefore(r.db, postgresHistory, r.exec, cutoff, limit)
+}
+
+// DeletePlayerAnalytics deletes the analytics consumer's stats and flags of a player
+func (r *Repository) DeletePlayerAnalytics(playerName string) error {
+	return deletePlayerAnalytics(r.db, postgresHistory, r.exec, playerName)
+}
+
+func erasePlayer(db *sql.DB, dialect historyDialect, exec func(execer, string, ...interface{}) (sql.Result, error),
+	queryContext func() (context.Context, context.CancelFunc), tables []playerTable,
+	account *models.Account, alias string, deleteAccount bool) (*models.PlayerErasure, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin erasing %s: %w", account.Username, err)
+	}
+	defer tx.Rollback()
+
+	erasure := &models.PlayerErasure{
+		PlayerName:     account.Username,
+		Alias:          alias,
+		AccountDeleted: deleteAccount,
+		ErasedAt:       time.Now(),
+	}
+	aliasID := uuid.New()
+
+	// Games are the player's by their account ID, or by their name for
+	// those played before they registered it
+	if erasure.GamesRenamed, err = renameGameHistory(tx, dialect, exec, queryContext, account, aliasID, alias); err != nil {
+		return nil, err
+	}
+	statements := []string{
+		`UPDATE games SET winner_id = ?, winner_name = ? WHERE winner_id = ? OR winner_name = ?`,
+		`UPDATE games SET player1_id = ?, player1_name = ? WHERE player1_id = ? OR player1_name = ?`,
+		`UPDATE games SET player2_id = ?, player2_name = ? WHERE player2_id = ? OR player2_name = ?`,
+		`UPDATE game_moves SET player_id = ?, player_name = ? WHERE player_id = ? OR player_name = ?`,
+	}
+	for _, statement := range statements {
+		if _, err := exec(tx, bindArgs(dialect, statement), aliasID, alias, account.ID, account.Username); err != nil {
+			return nil, fmt.Errorf("failed to rename games of %s: %w", account.Username, err)
+		}
+	}
+
+	for _, table := range tables {
+		_, err := exec(tx, bindArgs(dialect, fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, table.table, table.column)), account.Username)
+		if err != nil {
+			return nil, fmt.Errorf("failed to erase %s of %s: %w", table.table, account.Username, err)
+		}
+	}
+
+	if deleteAccount {
+		if _, err := exec(tx, bindArgs(dialect, `DELETE FROM accounts WHERE id = ?`), account.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete account %s: %w", account.Username, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit erasing %s: %w", account.Username, err)
+	}
+	return erasure, nil
+}
+
+// renameGameHistory renames the player in the finished games kept for
+// replays, returning how many they played in
+func renameGameHistory(tx *sql.Tx, dialect historyDialect, exec func(execer, string, ...interface{}) (sql.Result, error),
+	queryContext func() (context.Context, context.CancelFunc), account *models.Account, aliasID uuid.UUID, alias string) (int, error) {
+	games, err := readPlayerHistory(tx, dialect, queryContext, account.Username)
+	if err != nil {
+		return 0, err
+	}
+
+	renamed := 0
+	for _, game := range games {
+		if !renamePlayer(game, account, aliasID, alias) {
+			continue
+		}
+		data, err := json.Marshal(game)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode game %s: %w", game.ID, err)
+		}
+		columns := newHistoryColumns(game)
+		_, err = exec(tx, bindArgs(dialect, `UPDATE game_history SET game = ?, player_names = ?, winner_names = ? WHERE game_id = ?`),
+			data, dialect.array(columns.playerNames), dialect.array(columns.winnerNames), game.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to rename finished game %s: %w", game.ID, err)
+		}
+		renamed++
+	}
+	return renamed, nil
+}
+
+// readPlayerHistory reads the finished games a player played in, all of them
+// before any is updated in the transaction
+func readPlayerHistory(tx *sql.Tx, dialect historyDialect, queryContext func() (context.Context, context.CancelFunc), playerName string) ([]*models.Game, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, bindArgs(dialect, `SELECT game_id, game FROM game_history WHERE `+dialect.contains("player_names")), playerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query finished games of %s: %w", playerName, err)
+	}
+	defer rows.Close()
+
+	var games []*models.Game
+	for rows.Next() {
+		var gameID uuid.UUID
+		var data []byte
+		if err := rows.Scan(&gameID, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan finished game: %w", err)
+		}
+		var game models.Game
+		if err := json.Unmarshal(data, &game); err != nil {
+			return nil, fmt.Errorf("failed to decode finished game %s: %w", gameID, err)
+		}
+		game.ID = gameID
+		games = append(games, &game)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating finished games: %w", err)
+	}
+	return games, nil
+}
+
+// renamePlayer gives the account's player in a game, and their moves, the
+// alias, reporting whether they played in it
+func renamePlayer(game *models.Game, account *models.Account, aliasID uuid.UUID, alias string) bool {
+	renamed := false
+	for _, player := range game.AllPlayers() {
+		if player.ID != account.ID && player.Name != account.Username {
+			continue
+		}
+		for _, move := range append(game.Moves, game.LastMove) {
+			if move != nil && move.PlayerID == player.ID {
+				move.PlayerID = aliasID
+			}
+		}
+		player.ID, player.Name = aliasID, alias
+		renamed = true
+	}
+	return renamed
+}
+
+func deleteGameMovesBefore(db *sql.DB, dialect historyDialect, exec func(execer, string, ...interface{}) (sql.Result, error), cutoff time.Time, limit int) (int64, error) {
+	result, err := exec(db, bindArgs(dialect, `
+		DELETE FROM game_moves WHERE id IN (
+			SELECT id FROM game_moves WHERE move_timestamp < ? LIMIT ?
+		)
+	`), dialect.time(cutoff), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete game moves: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func deletePlayerAnalytics(db *sql.DB, dialect historyDialect, exec func(execer, string, ...interface{}) (sql.Result, error), playerName string) error {
+	for _, table := range []string{"player_stats", "player_flags"} {
+		if _, err := exec(db, bindArgs(dialect, fmt.Sprintf(`DELETE FROM %s WHERE player_name = ?`, table)), playerName); err != nil {
+			return fmt.Errorf("failed to delete %s of %s: %w", table, playerName, err)
+		}
+	}
+	return nil
+}
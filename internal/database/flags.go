@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PlayerFlag is a player the analytics consumer suspects of cheating, kept
+// until a moderator reviews it
+type PlayerFlag struct {
+	ID         string
+	PlayerName string
+	Reason     string
+	Detail     string
+	Value      float64
+	Threshold  float64
+	Status     string
+	FlaggedAt  time.Time
+	ReviewedAt *time.Time
+	ReviewNote string
+}
+
+// SavePlayerFlag inserts the flag or updates its review
+func (r *Repository) SavePlayerFlag(flag *PlayerFlag) error {
+	_, err := r.exec(r.db, `
+		INSERT INTO player_flags (id, player_name, reason, detail, value, threshold, status,
+			flagged_at, reviewed_at, review_note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			reviewed_at = EXCLUDED.reviewed_at,
+			review_note = EXCLUDED.review_note
+	`, flag.ID, flag.PlayerName, flag.Reason, flag.Detail, flag.Value, flag.Threshold, flag.Status,
+		flag.FlaggedAt, flag.ReviewedAt, flag.ReviewNote)
+	if err != nil {
+		return fmt.Errorf("failed to save flag of %s: %w", flag.PlayerName, err)
+	}
+	return nil
+}
+
+// LoadPlayerFlags returns every flag, oldest first
+func (r *Repository) LoadPlayerFlags() ([]PlayerFlag, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, player_name, reason, detail, value, threshold, status, flagged_at, reviewed_at, review_note
+		FROM player_flags ORDER BY flagged_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load player flags: %w", err)
+	}
+	defer rows.Close()
+
+	var flags []PlayerFlag
+	for rows.Next() {
+		var flag PlayerFlag
+		var reviewedAt sql.NullTime
+		err := rows.Scan(&flag.ID, &flag.PlayerName, &flag.Reason, &flag.Detail, &flag.Value, &flag.Threshold,
+			&flag.Status, &flag.FlaggedAt, &reviewedAt, &flag.ReviewNote)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan player flag: %w", err)
+		}
+		if reviewedAt.Valid {
+			flag.ReviewedAt = &reviewedAt.Time
+		}
+		flags = append(flags, flag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating player flag rows: %w", err)
+	}
+
+	return flags, nil
+}
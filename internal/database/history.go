@@ -0,0 +1,319 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Results a game history query filters on. Wins and losses are the player's.
+const (
+	GameResultWin  = "win"
+	GameResultLoss = "loss"
+	GameResultDraw = "draw"
+)
+
+// Opponent types a game history query filters on
+const (
+	OpponentBot   = "bot"   // games with a bot in them
+	OpponentHuman = "human" // games between humans
+)
+
+// Orders of game history query results
+const (
+	GameSortFinishedAt = "finished_at"
+	GameSortDuration   = "duration"
+	GameSortMoves      = "moves"
+)
+
+// gameSortColumns maps the orders to their columns
+var gameSortColumns = map[string]string{
+	GameSortFinishedAt: "finished_at",
+	GameSortDuration:   "duration_seconds",
+	GameSortMoves:      "total_moves",
+}
+
+// GameQuery picks finished games from the history. The zero value of a
+// filter doesn't filter.
+type GameQuery struct {
+	Player   string    // games the player played in, as either color or a teammate
+	From     time.Time // finished at or after
+	To       time.Time // finished before
+	Result   string    // GameResultWin or GameResultLoss need Player
+	WinType  string    // models.WinTypeHorizontal and the others
+	Opponent string    // OpponentBot or OpponentHuman
+
+	Sort       string // GameSortFinishedAt when empty
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+// GameRecord is a finished game without its moves
+type GameRecord struct {
+	ID         uuid.UUID             `json:"id"`
+	QueueType  models.QueueType      `json:"queue_type"`
+	Players    []models.ReplayPlayer `json:"players"`
+	Result     models.ReplayResult   `json:"result"`
+	WinType    string                `json:"win_type,omitempty"`
+	TotalMoves int                   `json:"total_moves"`
+	Duration   int64                 `json:"duration_seconds"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt time.Time             `json:"finished_at"`
+}
+
+// GamePage is a page of the finished games a query picked
+type GamePage struct {
+	Games  []GameRecord `json:"games"`
+	Total  int          `json:"total"` // games the query picked, on every page
+	Limit  int          `json:"limit"`
+	Offset int          `json:"offset"`
+}
+
+// historyColumns are the columns of game_history that queries filter and
+// sort on, taken from the game itself
+type historyColumns struct {
+	playerNames []string
+	winnerNames []string
+	isDraw      bool
+	winType     sql.NullString
+	hasBot      bool
+	totalMoves  int
+	duration    int64
+	startedAt   time.Time
+}
+
+func newHistoryColumns(game *models.Game) historyColumns {
+	columns := historyColumns{
+		isDraw:     game.Winner == nil,
+		totalMoves: len(game.Moves),
+		startedAt:  game.CreatedAt,
+	}
+	if game.FinishedAt != nil {
+		columns.duration = int64(game.FinishedAt.Sub(game.CreatedAt).Seconds())
+	}
+	if winType := game.WinType(); winType != "" {
+		columns.winType = sql.NullString{String: winType, Valid: true}
+	}
+	for _, player := range game.AllPlayers() {
+		columns.playerNames = append(columns.playerNames, player.Name)
+		if game.Winner != nil && player.Color == *game.Winner {
+			columns.winnerNames = append(columns.winnerNames, player.Name)
+		}
+		columns.hasBot = columns.hasBot || player.IsBot
+	}
+	return columns
+}
+
+// updateHistoryColumns fills in the query columns of a game saved without them
+func (r *Repository) updateHistoryColumns(gameID uuid.UUID, columns historyColumns) error {
+	_, err := r.exec(r.db, `
+		UPDATE game_history SET player_names = $2, winner_names = $3, is_draw = $4, win_type = $5,
+			has_bot = $6, total_moves = $7, duration_seconds = $8, started_at = $9
+		WHERE game_id = $1
+	`, gameID, pq.Array(columns.playerNames), pq.Array(columns.winnerNames), columns.isDraw, columns.winType,
+		columns.hasBot, columns.totalMoves, columns.duration, columns.startedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update finished game %s: %w", gameID, err)
+	}
+	return nil
+}
+
+// backfillGameHistory fills in the query columns of games saved before
+// game_history had them, a batch at a time
+func (r *Repository) backfillGameHistory() error {
+	const batchSize = 500
+	after := uuid.Nil
+	for {
+		games, err := r.readBackfillBatch(after, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, game := range games {
+			if err := r.updateHistoryColumns(game.ID, newHistoryColumns(game)); err != nil {
+				return err
+			}
+		}
+		if len(games) < batchSize {
+			return nil
+		}
+		after = games[len(games)-1].ID
+	}
+}
+
+// readBackfillBatch reads the next games after the given one whose query
+// columns need filling in
+func (r *Repository) readBackfillBatch(after uuid.UUID, batchSize int) ([]*models.Game, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT game_id, game FROM game_history
+		WHERE total_moves IS NULL AND game_id > $1
+		ORDER BY game_id LIMIT $2
+	`, after, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read finished games to backfill: %w", err)
+	}
+	defer rows.Close()
+
+	var games []*models.Game
+	for rows.Next() {
+		var gameID uuid.UUID
+		var data []byte
+		if err := rows.Scan(&gameID, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan finished game: %w", err)
+		}
+		var game models.Game
+		if err := json.Unmarshal(data, &game); err != nil {
+			return nil, fmt.Errorf("failed to decode finished game %s: %w", gameID, err)
+		}
+		game.ID = gameID
+		games = append(games, &game)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating finished games: %w", err)
+	}
+	return games, nil
+}
+
+// historyDialect is how a backend writes the SQL of game history queries
+type historyDialect struct {
+	placeholder func(n int) string                // the nth argument
+	contains    func(column string) string        // the array column holds the ? argument
+	time        func(t time.Time) time.Time       // a time as the backend compares it
+	array       func(values []string) interface{} // an array column's argument
+}
+
+var postgresHistory = historyDialect{
+	placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	contains:    func(column string) string { return column + " @> ARRAY[?]::TEXT[]" },
+	time:        func(t time.Time) time.Time { return t },
+	array:       func(values []string) interface{} { return pq.Array(values) },
+}
+
+// FindFinishedGames returns the page of finished games the query picks, the
+// most recently finished first unless it sorts otherwise
+func (r *Repository) FindFinishedGames(query GameQuery) (*GamePage, error) {
+	var page *GamePage
+	err := r.read(func(ctx context.Context, db *sql.DB) (err error) {
+		page, err = findFinishedGames(ctx, db, postgresHistory, query)
+		return err
+	})
+	return page, err
+}
+
+// findFinishedGames runs a game history query in the backend's dialect
+func findFinishedGames(ctx context.Context, db *sql.DB, dialect historyDialect, query GameQuery) (*GamePage, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, values ...interface{}) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", dialect.placeholder(len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if query.Player != "" {
+		where(dialect.contains("player_names"), query.Player)
+	}
+	if !query.From.IsZero() {
+		where("finished_at >= ?", dialect.time(query.From))
+	}
+	if !query.To.IsZero() {
+		where("finished_at < ?", dialect.time(query.To))
+	}
+	switch query.Result {
+	case GameResultWin:
+		where(dialect.contains("winner_names"), query.Player)
+	case GameResultLoss:
+		where("NOT is_draw AND NOT "+dialect.contains("winner_names"), query.Player)
+	case GameResultDraw:
+		where("is_draw")
+	}
+	if query.WinType != "" {
+		where("win_type = ?", query.WinType)
+	}
+	switch query.Opponent {
+	case OpponentBot:
+		where("has_bot")
+	case OpponentHuman:
+		where("NOT has_bot")
+	}
+
+	filter := ""
+	if len(conditions) > 0 {
+		filter = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	page := &GamePage{Games: []GameRecord{}, Limit: query.Limit, Offset: query.Offset}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM game_history `+filter, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count finished games: %w", err)
+	}
+	if page.Total <= query.Offset {
+		return page, nil
+	}
+
+	column, ok := gameSortColumns[query.Sort]
+	if !ok {
+		column = gameSortColumns[GameSortFinishedAt]
+	}
+	direction := "ASC"
+	if query.Descending {
+		direction = "DESC"
+	}
+	// The game ID breaks ties, so pages don't overlap
+	order := fmt.Sprintf("ORDER BY %s %s, game_id %s", column, direction, direction)
+
+	args = append(args, query.Limit, query.Offset)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT game_id, game FROM game_history %s %s LIMIT %s OFFSET %s`,
+		filter, order, dialect.placeholder(len(args)-1), dialect.placeholder(len(args))), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query finished games: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var gameID uuid.UUID
+		var data []byte
+		if err := rows.Scan(&gameID, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan finished game: %w", err)
+		}
+		var game models.Game
+		if err := json.Unmarshal(data, &game); err != nil {
+			return nil, fmt.Errorf("failed to decode finished game %s: %w", gameID, err)
+		}
+		game.ID = gameID
+		page.Games = append(page.Games, newGameRecord(&game))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating finished games: %w", err)
+	}
+
+	return page, nil
+}
+
+func newGameRecord(game *models.Game) GameRecord {
+	replay := game.Replay()
+	return GameRecord{
+		ID:         game.ID,
+		QueueType:  game.QueueType,
+		Players:    replay.Players,
+		Result:     replay.Result,
+		WinType:    game.WinType(),
+		TotalMoves: len(game.Moves),
+		Duration:   int64(replay.FinishedAt.Sub(replay.StartedAt).Seconds()),
+		StartedAt:  replay.StartedAt,
+		FinishedAt: replay.FinishedAt,
+	}
+}
@@ -0,0 +1,520 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/metrics"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Classes of errors a database call fails with, as exported to Prometheus
+const (
+	errorConnection = "connection" // the database couldn't be reached
+	errorConstraint = "constraint" // a row broke a unique, foreign key or check constraint
+	errorTimeout    = "timeout"    // the query ran past its timeout
+	errorConflict   = "conflict"   // a serializable transaction conflicted with another
+	errorOther      = "other"
+)
+
+// InstrumentedStore times every call to the store it wraps, counts the calls
+// that fail by the class of their error, and logs those slower than the slow
+// query threshold. Migrations and the connection's stats aren't timed.
+type InstrumentedStore struct {
+	Store
+	slowQueryThreshold time.Duration // 0 to log no slow queries
+
+	durations *prometheus.HistogramVec // seconds, by query
+
+	mu     sync.Mutex
+	errors map[queryError]int64
+	slow   map[string]int64 // by query
+}
+
+// queryError is a query and the class of error it failed with
+type queryError struct {
+	query string
+	class string
+}
+
+// Instrument wraps the store so its calls are timed, their errors counted and
+// those slower than the threshold logged
+func Instrument(store Store, slowQueryThreshold time.Duration) *InstrumentedStore {
+	return &InstrumentedStore{
+		Store:              store,
+		slowQueryThreshold: slowQueryThreshold,
+		durations:          metrics.NewHistogramVec("connect_four_db_query_seconds", "Time database calls took, by query", "query", metrics.DefaultLatencyBuckets),
+		errors:             make(map[queryError]int64),
+		slow:               make(map[string]int64),
+	}
+}
+
+// RegisterMetrics adds the call durations, errors and slow queries to the registry
+func (s *InstrumentedStore) RegisterMetrics(registry *metrics.Registry) {
+	registry.Register(s.durations)
+	registry.LabeledFunc("connect_four_db_query_errors_total", "Database calls that failed, by query and class of error",
+		metrics.KindCounter, s.errorSamples)
+	registry.LabeledFunc("connect_four_db_slow_queries_total", "Database calls slower than the slow query threshold, by query",
+		metrics.KindCounter, s.slowSamples)
+}
+
+// observe records a call to the query that started at start and failed with
+// err, if it isn't nil
+func (s *InstrumentedStore) observe(query string, start time.Time, err error) {
+	duration := time.Since(start)
+	s.durations.WithLabelValues(query).Observe(duration.Seconds())
+
+	slow := s.slowQueryThreshold > 0 && duration >= s.slowQueryThreshold
+	if err == nil && !slow {
+		return
+	}
+
+	s.mu.Lock()
+	if err != nil {
+		s.errors[queryError{query: query, class: classifyError(err)}]++
+	}
+	if slow {
+		s.slow[query]++
+	}
+	s.mu.Unlock()
+
+	if slow {
+		attrs := []any{"query", query, "duration_ms", duration.Milliseconds(), "threshold_ms", s.slowQueryThreshold.Milliseconds()}
+		if err != nil {
+			attrs = append(attrs, "error", err.Error())
+		}
+		slog.Warn("Slow database query", attrs...)
+	}
+}
+
+func (s *InstrumentedStore) errorSamples() []metrics.Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := make([]metrics.Sample, 0, len(s.errors))
+	for key, count := range s.errors {
+		samples = append(samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "query", Value: key.query}, {Name: "class", Value: key.class}},
+			Value:  float64(count),
+		})
+	}
+	sortSamples(samples)
+	return samples
+}
+
+func (s *InstrumentedStore) slowSamples() []metrics.Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := make([]metrics.Sample, 0, len(s.slow))
+	for query, count := range s.slow {
+		samples = append(samples, metrics.Sample{
+			Labels: []metrics.Label{{Name: "query", Value: query}},
+			Value:  float64(count),
+		})
+	}
+	sortSamples(samples)
+	return samples
+}
+
+// sortSamples orders samples by their label values, so scrapes list them alike
+func sortSamples(samples []metrics.Sample) {
+	key := func(sample metrics.Sample) string {
+		values := make([]string, len(sample.Labels))
+		for i, label := range sample.Labels {
+			values[i] = label.Value
+		}
+		return strings.Join(values, "\x00")
+	}
+	sort.Slice(samples, func(i, j int) bool { return key(samples[i]) < key(samples[j]) })
+}
+
+// classifyError tells why a database call failed, from the Postgres error
+// code or, for SQLite, the error's message
+func classifyError(err error) string {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorTimeout
+	case errors.As(err, &pqErr) && pqErr.Code == "57014": // query_canceled, as by the statement timeout
+		return errorTimeout
+	case errors.As(err, &pqErr) && pqErr.Code.Class() == "23": // integrity_constraint_violation
+		return errorConstraint
+	case isSerializationFailure(err):
+		return errorConflict
+	case unavailable(err):
+		return errorConnection
+	case strings.Contains(err.Error(), "constraint failed"):
+		return errorConstraint
+	case strings.Contains(err.Error(), "database is locked"):
+		return errorConflict
+	default:
+		return errorOther
+	}
+}
+
+func (s *InstrumentedStore) GetLeaderboard(query LeaderboardQuery) ([]LeaderboardEntry, error) {
+	start := time.Now()
+	result, err := s.Store.GetLeaderboard(query)
+	s.observe("GetLeaderboard", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) GetLeaderboardAround(query LeaderboardQuery, playerName string) ([]LeaderboardEntry, error) {
+	start := time.Now()
+	result, err := s.Store.GetLeaderboardAround(query, playerName)
+	s.observe("GetLeaderboardAround", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) RefreshLeaderboard() error {
+	start := time.Now()
+	err := s.Store.RefreshLeaderboard()
+	s.observe("RefreshLeaderboard", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetPlayerStats(playerName string) (*PlayerStats, error) {
+	start := time.Now()
+	result, err := s.Store.GetPlayerStats(playerName)
+	s.observe("GetPlayerStats", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) GetPlayerRating(playerName string) (*models.PlayerRating, error) {
+	start := time.Now()
+	result, err := s.Store.GetPlayerRating(playerName)
+	s.observe("GetPlayerRating", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) SavePlayerRating(rating *models.PlayerRating) error {
+	start := time.Now()
+	err := s.Store.SavePlayerRating(rating)
+	s.observe("SavePlayerRating", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetRatingHistory(playerName string, limit int) ([]RatingHistoryPoint, error) {
+	start := time.Now()
+	result, err := s.Store.GetRatingHistory(playerName, limit)
+	s.observe("GetRatingHistory", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) GetOpeningColumns(playerName string) (OpeningColumns, error) {
+	start := time.Now()
+	result, err := s.Store.GetOpeningColumns(playerName)
+	s.observe("GetOpeningColumns", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) GetCurrentSeason() (*models.Season, error) {
+	start := time.Now()
+	result, err := s.Store.GetCurrentSeason()
+	s.observe("GetCurrentSeason", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) ListSeasons() ([]*models.Season, error) {
+	start := time.Now()
+	result, err := s.Store.ListSeasons()
+	s.observe("ListSeasons", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) StartSeason(season *models.Season) (bool, error) {
+	start := time.Now()
+	result, err := s.Store.StartSeason(season)
+	s.observe("StartSeason", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) EndSeason(ended, next *models.Season, rewards []models.SeasonReward, reset models.RatingReset) (bool, error) {
+	start := time.Now()
+	result, err := s.Store.EndSeason(ended, next, rewards, reset)
+	s.observe("EndSeason", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) GetSeasonStandings(number, limit, offset int) ([]models.SeasonStanding, error) {
+	start := time.Now()
+	result, err := s.Store.GetSeasonStandings(number, limit, offset)
+	s.observe("GetSeasonStandings", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) GetQueuePenalty(playerName string) (*models.QueuePenalty, error) {
+	start := time.Now()
+	result, err := s.Store.GetQueuePenalty(playerName)
+	s.observe("GetQueuePenalty", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) SaveQueuePenalty(penalty *models.QueuePenalty) error {
+	start := time.Now()
+	err := s.Store.SaveQueuePenalty(penalty)
+	s.observe("SaveQueuePenalty", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SaveQueueSnapshot(players []*models.QueuedPlayer) error {
+	start := time.Now()
+	err := s.Store.SaveQueueSnapshot(players)
+	s.observe("SaveQueueSnapshot", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) LoadQueueSnapshot() ([]*models.QueuedPlayer, error) {
+	start := time.Now()
+	result, err := s.Store.LoadQueueSnapshot()
+	s.observe("LoadQueueSnapshot", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) SaveGameSnapshot(games []*models.Game) error {
+	start := time.Now()
+	err := s.Store.SaveGameSnapshot(games)
+	s.observe("SaveGameSnapshot", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) LoadGameSnapshot() ([]*models.Game, error) {
+	start := time.Now()
+	result, err := s.Store.LoadGameSnapshot()
+	s.observe("LoadGameSnapshot", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) SaveCompletedGame(game *models.Game) error {
+	start := time.Now()
+	err := s.Store.SaveCompletedGame(game)
+	s.observe("SaveCompletedGame", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SaveFinishedGame(game *models.Game) error {
+	start := time.Now()
+	err := s.Store.SaveFinishedGame(game)
+	s.observe("SaveFinishedGame", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SaveGameResult(game *models.Game, ratings []*models.PlayerRating) error {
+	start := time.Now()
+	err := s.Store.SaveGameResult(game, ratings)
+	s.observe("SaveGameResult", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetFinishedGame(gameID uuid.UUID) (*models.Game, error) {
+	start := time.Now()
+	result, err := s.Store.GetFinishedGame(gameID)
+	s.observe("GetFinishedGame", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) FindFinishedGames(query GameQuery) (*GamePage, error) {
+	start := time.Now()
+	result, err := s.Store.FindFinishedGames(query)
+	s.observe("FindFinishedGames", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) DeleteGameMovesBefore(cutoff time.Time, limit int) (int64, error) {
+	start := time.Now()
+	result, err := s.Store.DeleteGameMovesBefore(cutoff, limit)
+	s.observe("DeleteGameMovesBefore", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) CreateWebhook(webhook *models.Webhook) error {
+	start := time.Now()
+	err := s.Store.CreateWebhook(webhook)
+	s.observe("CreateWebhook", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) ListWebhooks() ([]*models.Webhook, error) {
+	start := time.Now()
+	result, err := s.Store.ListWebhooks()
+	s.observe("ListWebhooks", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) DeleteWebhook(webhookID uuid.UUID) (bool, error) {
+	start := time.Now()
+	result, err := s.Store.DeleteWebhook(webhookID)
+	s.observe("DeleteWebhook", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) SaveWebhookDeadLetter(letter *models.WebhookDeadLetter) error {
+	start := time.Now()
+	err := s.Store.SaveWebhookDeadLetter(letter)
+	s.observe("SaveWebhookDeadLetter", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) ListWebhookDeadLetters(limit int) ([]*models.WebhookDeadLetter, error) {
+	start := time.Now()
+	result, err := s.Store.ListWebhookDeadLetters(limit)
+	s.observe("ListWebhookDeadLetters", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) CreateAccount(account *models.Account) error {
+	start := time.Now()
+	err := s.Store.CreateAccount(account)
+	s.observe("CreateAccount", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetAccount(accountID uuid.UUID) (*models.Account, error) {
+	start := time.Now()
+	result, err := s.Store.GetAccount(accountID)
+	s.observe("GetAccount", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) GetAccountByUsername(username string) (*models.Account, error) {
+	start := time.Now()
+	result, err := s.Store.GetAccountByUsername(username)
+	s.observe("GetAccountByUsername", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) GetNameHistory(username string) (*models.NameHistory, error) {
+	start := time.Now()
+	result, err := s.Store.GetNameHistory(username)
+	s.observe("GetNameHistory", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) UpdateAccountLogin(accountID uuid.UUID, loginAt time.Time) error {
+	start := time.Now()
+	err := s.Store.UpdateAccountLogin(accountID, loginAt)
+	s.observe("UpdateAccountLogin", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) MergeGuestPlayer(guestID uuid.UUID, account *models.Account) (*models.GuestClaim, error) {
+	start := time.Now()
+	result, err := s.Store.MergeGuestPlayer(guestID, account)
+	s.observe("MergeGuestPlayer", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) ErasePlayer(account *models.Account, alias string, deleteAccount bool) (*models.PlayerErasure, error) {
+	start := time.Now()
+	result, err := s.Store.ErasePlayer(account, alias, deleteAccount)
+	s.observe("ErasePlayer", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) SaveAnalyticsAggregates(aggregates *AnalyticsAggregates) error {
+	start := time.Now()
+	err := s.Store.SaveAnalyticsAggregates(aggregates)
+	s.observe("SaveAnalyticsAggregates", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) LoadAnalyticsAggregates(fromHour, fromDay string) (*AnalyticsAggregates, error) {
+	start := time.Now()
+	result, err := s.Store.LoadAnalyticsAggregates(fromHour, fromDay)
+	s.observe("LoadAnalyticsAggregates", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) LoadPlayerStats(name string) (*AggregatedPlayerStats, error) {
+	start := time.Now()
+	result, err := s.Store.LoadPlayerStats(name)
+	s.observe("LoadPlayerStats", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) DeletePlayerAnalytics(playerName string) error {
+	start := time.Now()
+	err := s.Store.DeletePlayerAnalytics(playerName)
+	s.observe("DeletePlayerAnalytics", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SaveRetentionCohorts(cohorts []RetentionCohort) error {
+	start := time.Now()
+	err := s.Store.SaveRetentionCohorts(cohorts)
+	s.observe("SaveRetentionCohorts", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) AddCounters(deltas map[string]map[string]int64) error {
+	start := time.Now()
+	err := s.Store.AddCounters(deltas)
+	s.observe("AddCounters", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) LoadCounters(names []string) (map[string]map[string]int64, error) {
+	start := time.Now()
+	result, err := s.Store.LoadCounters(names)
+	s.observe("LoadCounters", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) SavePlayerFlag(flag *PlayerFlag) error {
+	start := time.Now()
+	err := s.Store.SavePlayerFlag(flag)
+	s.observe("SavePlayerFlag", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) LoadPlayerFlags() ([]PlayerFlag, error) {
+	start := time.Now()
+	result, err := s.Store.LoadPlayerFlags()
+	s.observe("LoadPlayerFlags", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) EventProcessed(eventID string) (bool, error) {
+	start := time.Now()
+	result, err := s.Store.EventProcessed(eventID)
+	s.observe("EventProcessed", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) MarkEventProcessed(eventID, eventType string, processedAt time.Time) error {
+	start := time.Now()
+	err := s.Store.MarkEventProcessed(eventID, eventType, processedAt)
+	s.observe("MarkEventProcessed", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) DeleteProcessedEventsBefore(cutoff time.Time) (int64, error) {
+	start := time.Now()
+	result, err := s.Store.DeleteProcessedEventsBefore(cutoff)
+	s.observe("DeleteProcessedEventsBefore", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) DeleteProcessedEventsAfter(cutoff time.Time) (int64, error) {
+	start := time.Now()
+	result, err := s.Store.DeleteProcessedEventsAfter(cutoff)
+	s.observe("DeleteProcessedEventsAfter", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStore) HealthCheck() error {
+	start := time.Now()
+	err := s.Store.HealthCheck()
+	s.observe("HealthCheck", start, err)
+	return err
+}
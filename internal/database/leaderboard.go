@@ -0,0 +1,78 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Orders of a leaderboard
+const (
+	LeaderboardSortWinRate = "win_rate" // then wins, then games played
+	LeaderboardSortRating  = "rating"
+)
+
+// LeaderboardQuery picks a leaderboard and the page of it to read
+type LeaderboardQuery struct {
+	Period string    // LeaderboardDay and the others, all time when empty
+	At     time.Time // in the period, now when zero
+	Sort   string    // LeaderboardSortWinRate when empty, rating is all time only
+	Search string    // names containing it, ignoring case; players keep their ranks
+
+	Limit  int
+	Offset int
+}
+
+// check returns an error for a query of a leaderboard there isn't
+func (q LeaderboardQuery) check() error {
+	switch q.Sort {
+	case "", LeaderboardSortWinRate:
+	case LeaderboardSortRating:
+		if q.Period != "" {
+			return fmt.Errorf("the rating leaderboard has no %s period", q.Period)
+		}
+	default:
+		return fmt.Errorf("unknown leaderboard sort %q", q.Sort)
+	}
+	return nil
+}
+
+// period returns the start and end of the query's period
+func (q LeaderboardQuery) period() (start, end time.Time, err error) {
+	at := q.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	return LeaderboardPeriod(q.Period, at)
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// rankedLeaderboard wraps a query of a leaderboard's rows, ranked in the
+// leaderboard_rank column, to read the page the query picks or, for a player,
+// the query's limit of rows starting half of them above the player. No rows
+// are read for a player who isn't on the leaderboard.
+func rankedLeaderboard(dialect historyDialect, ranked string, args []interface{}, query LeaderboardQuery, player string) (string, []interface{}) {
+	bind := func(sql string, values ...interface{}) string {
+		for _, value := range values {
+			args = append(args, value)
+			sql = strings.Replace(sql, "?", dialect.placeholder(len(args)), 1)
+		}
+		return sql
+	}
+
+	filter := ""
+	switch {
+	case player != "":
+		filter = bind("WHERE leaderboard_rank >= (SELECT leaderboard_rank - ? FROM ranked WHERE username = ?)", query.Limit/2, player)
+	case query.Search != "":
+		filter = bind(`WHERE LOWER(username) LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(strings.ToLower(query.Search))+"%")
+	}
+	page := bind("LIMIT ?", query.Limit)
+	if player == "" {
+		page += bind(" OFFSET ?", query.Offset)
+	}
+
+	return fmt.Sprintf("WITH ranked AS (%s) SELECT * FROM ranked %s ORDER BY leaderboard_rank %s", ranked, filter, page), args
+}
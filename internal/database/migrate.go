@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migrations are SQL files in migrations/, named <version>_<name>.up.sql with
+// a <version>_<name>.down.sql undoing them, and in migrations/sqlite/ for
+// SQLite. Each runs in a transaction, so it can't use statements like CREATE
+// INDEX CONCURRENTLY.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLockID keys the advisory lock held while migrating, so a server and
+// a consumer starting together don't migrate at the same time
+const migrationLockID = 0x4334
+
+// migrator applies one backend's migrations and records them in
+// schema_migrations
+type migrator struct {
+	db     *sql.DB
+	files  fs.FS  // the migrations directory
+	lock   string // takes the migration lock for the connection, empty if there's none
+	unlock string
+	table  string // creates schema_migrations
+	record string // records a migration from its version, name and when it was applied
+	forget string // forgets a migration from its version
+}
+
+// migrator returns the migrator of the Postgres schema
+func (r *Repository) migrator() *migrator {
+	files, _ := fs.Sub(migrationFiles, "migrations")
+	return &migrator{
+		db:     r.db,
+		files:  files,
+		lock:   fmt.Sprintf(`SELECT pg_advisory_lock(%d)`, migrationLockID),
+		unlock: fmt.Sprintf(`SELECT pg_advisory_unlock(%d)`, migrationLockID),
+		table: `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name VARCHAR(255) NOT NULL,
+				applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+			)
+		`,
+		record: `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		forget: `DELETE FROM schema_migrations WHERE version = $1`,
+	}
+}
+
+// MigrateUp applies the migrations the database doesn't have, oldest first,
+// and returns them
+func (r *Repository) MigrateUp() ([]Migration, error) {
+	return r.migrator().up()
+}
+
+// MigrateDown undoes the latest migrations the database has, at most steps of
+// them, newest first, and returns them
+func (r *Repository) MigrateDown(steps int) ([]Migration, error) {
+	return r.migrator().down(steps)
+}
+
+// MigrationStatus returns every migration, oldest first, with when the
+// database got it
+func (r *Repository) MigrationStatus() ([]MigrationState, error) {
+	return r.migrator().status()
+}
+
+// Migration is a versioned change to the schema
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationState is a migration and when the database got it
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time // nil if the migration is pending
+}
+
+// loadMigrations reads the backend's embedded migrations, oldest first
+func (m *migrator) loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(m.files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s isn't named <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(m.files, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", migration.Name, match[2], version)
+		}
+		if match[3] == "up" {
+			migration.up = string(data)
+		} else {
+			migration.down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func (m *migrator) up() ([]Migration, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, migration.up,
+				m.record, migration.Version, migration.Name, time.Now()); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func (m *migrator) down(steps int) ([]Migration, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]Migration, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	var undone []Migration
+	err = m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions {
+			if len(undone) == steps {
+				break
+			}
+			migration, ok := known[version]
+			if !ok {
+				return fmt.Errorf("migration %d was applied by a newer version and can't be undone by this one", version)
+			}
+			if err := runMigration(ctx, conn, migration.down, m.forget, migration.Version); err != nil {
+				return fmt.Errorf("failed to undo migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			undone = append(undone, migration)
+		}
+		return nil
+	})
+	return undone, err
+}
+
+func (m *migrator) status() ([]MigrationState, error) {
+	migrations, err := m.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	err = m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			state := MigrationState{Migration: migration}
+			if appliedAt, ok := done[migration.Version]; ok {
+				state.AppliedAt = &appliedAt
+			}
+			states = append(states, state)
+		}
+		return nil
+	})
+	return states, err
+}
+
+// withLock calls fn on a connection holding the migration lock, once the
+// table recording applied migrations exists
+func (m *migrator) withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a connection: %w", err)
+	}
+	defer conn.Close()
+
+	if m.lock != "" {
+		if _, err := conn.ExecContext(ctx, m.lock); err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, m.unlock)
+	}
+
+	if _, err := conn.ExecContext(ctx, m.table); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(ctx, conn)
+}
+
+// appliedMigrations returns when each migration the database has was applied
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schema migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// runMigration runs a migration's SQL and records it in one transaction
+func runMigration(ctx context.Context, conn *sql.Conn, migration, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,28 @@
+-- Drops everything the initial migration creates, data included
+
+DROP TRIGGER IF EXISTS trigger_update_leaderboard ON games;
+DROP FUNCTION IF EXISTS recalculate_leaderboard_stats();
+DROP FUNCTION IF EXISTS update_leaderboard_stats();
+
+DROP VIEW IF EXISTS leaderboard_ranking;
+DROP VIEW IF EXISTS player_game_history;
+
+DROP TABLE IF EXISTS analytics_counters;
+DROP TABLE IF EXISTS player_flags;
+DROP TABLE IF EXISTS retention_cohorts;
+DROP TABLE IF EXISTS player_stats;
+DROP TABLE IF EXISTS daily_stats;
+DROP TABLE IF EXISTS hourly_stats;
+DROP TABLE IF EXISTS game_stats;
+DROP TABLE IF EXISTS processed_events;
+DROP TABLE IF EXISTS game_moves;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS queue_penalties;
+DROP TABLE IF EXISTS webhook_dead_letters;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS game_history;
+DROP TABLE IF EXISTS game_snapshot;
+DROP TABLE IF EXISTS queue_snapshot;
+DROP TABLE IF EXISTS player_ratings;
+DROP TABLE IF EXISTS leaderboard;
+DROP TABLE IF EXISTS games;
@@ -1,5 +1,7 @@
--- Connect Four Database Schema
--- PostgreSQL version 12+
+-- Connect Four database schema, PostgreSQL 12+
+--
+-- Databases created before migrations were versioned already have some or
+-- all of this, so every statement must be safe to run on them.
 
 -- Enable UUID extension
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
@@ -98,6 +100,83 @@ CREATE TABLE IF NOT EXISTS leaderboard (
     )
 );
 
+-- Player ratings table - ELO rating per player
+CREATE TABLE IF NOT EXISTS player_ratings (
+    player_name VARCHAR(255) PRIMARY KEY,
+    rating DOUBLE PRECISION NOT NULL,
+    peak_rating DOUBLE PRECISION NOT NULL,
+    games_played INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Queue snapshot table - matchmaking queue saved across server restarts
+CREATE TABLE IF NOT EXISTS queue_snapshot (
+    player_id UUID PRIMARY KEY,
+    player_name VARCHAR(255) NOT NULL,
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    queue_type VARCHAR(20) NOT NULL,
+    party_id VARCHAR(255) NOT NULL DEFAULT '',
+    allow_bots BOOLEAN NOT NULL DEFAULT TRUE,
+    skill_level INTEGER NOT NULL DEFAULT 5,
+    max_wait_time INTEGER NOT NULL DEFAULT 0,
+    rating INTEGER NOT NULL DEFAULT 0,
+    priority INTEGER NOT NULL DEFAULT 0
+);
+
+-- Game snapshot table - in-progress games paused across server restarts
+CREATE TABLE IF NOT EXISTS game_snapshot (
+    game_id UUID PRIMARY KEY,
+    game JSONB NOT NULL,
+    saved_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Game history table - finished games with their moves, replays are generated from it
+CREATE TABLE IF NOT EXISTS game_history (
+    game_id UUID PRIMARY KEY,
+    game JSONB NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Webhooks table - URLs that receive signed game and tournament events
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY,
+    url TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Webhook dead letters table - deliveries that failed every attempt
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    failed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Queue penalties table - escalating cooldowns for players who abandon games
+CREATE TABLE IF NOT EXISTS queue_penalties (
+    player_name VARCHAR(255) PRIMARY KEY,
+    offenses INTEGER NOT NULL DEFAULT 0,
+    last_offense_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    banned_until TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Accounts table - registered players, whose account ID is their player ID
+CREATE TABLE IF NOT EXISTS accounts (
+    id UUID PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_login_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_username ON accounts(LOWER(username));
+
 -- Game moves table - detailed move history (optional, for analytics)
 CREATE TABLE IF NOT EXISTS game_moves (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -128,9 +207,118 @@ CREATE TABLE IF NOT EXISTS game_moves (
     UNIQUE(game_id, move_number)
 );
 
+-- Processed events table - analytics events the consumer has already counted,
+-- so redelivered events are skipped
+CREATE TABLE IF NOT EXISTS processed_events (
+    event_id VARCHAR(64) PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Analytics aggregate tables - the analytics consumer's metrics, upserted on
+-- every flush and loaded on startup so restarts carry on from them.
+-- game_stats holds a single row of all-time game counters.
+CREATE TABLE IF NOT EXISTS game_stats (
+    id SMALLINT PRIMARY KEY,
+    total_games BIGINT NOT NULL DEFAULT 0,
+    completed_games BIGINT NOT NULL DEFAULT 0,
+    total_game_duration BIGINT NOT NULL DEFAULT 0,
+    draw_count BIGINT NOT NULL DEFAULT 0,
+    bot_games BIGINT NOT NULL DEFAULT 0,
+    human_games BIGINT NOT NULL DEFAULT 0,
+    win_types JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS hourly_stats (
+    hour VARCHAR(13) PRIMARY KEY, -- 2024-01-01-15
+    games BIGINT NOT NULL DEFAULT 0,
+    moves BIGINT NOT NULL DEFAULT 0,
+    players BIGINT NOT NULL DEFAULT 0,
+    average_duration DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS daily_stats (
+    day VARCHAR(10) PRIMARY KEY, -- 2024-01-01
+    games BIGINT NOT NULL DEFAULT 0,
+    moves BIGINT NOT NULL DEFAULT 0,
+    players BIGINT NOT NULL DEFAULT 0,
+    new_players BIGINT NOT NULL DEFAULT 0,
+    average_duration DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS player_stats (
+    player_name VARCHAR(255) PRIMARY KEY,
+    games_played BIGINT NOT NULL DEFAULT 0,
+    games_won BIGINT NOT NULL DEFAULT 0,
+    games_lost BIGINT NOT NULL DEFAULT 0,
+    games_drawn BIGINT NOT NULL DEFAULT 0,
+    total_moves BIGINT NOT NULL DEFAULT 0,
+    total_game_time BIGINT NOT NULL DEFAULT 0, -- seconds
+    disconnections BIGINT NOT NULL DEFAULT 0,
+    reconnections BIGINT NOT NULL DEFAULT 0,
+    total_offline_ms BIGINT NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    current_streak BIGINT NOT NULL DEFAULT 0, -- games won in a row
+    longest_streak BIGINT NOT NULL DEFAULT 0
+);
+
+-- Players by the day they were first seen and how many came back, saved daily
+CREATE TABLE IF NOT EXISTS retention_cohorts (
+    cohort_day VARCHAR(10) PRIMARY KEY, -- 2024-01-01
+    players BIGINT NOT NULL DEFAULT 0,
+    returned_d1 BIGINT NOT NULL DEFAULT 0,
+    returned_d7 BIGINT NOT NULL DEFAULT 0,
+    returned_d30 BIGINT NOT NULL DEFAULT 0,
+    churned BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Players the analytics consumer suspects of cheating, until reviewed
+CREATE TABLE IF NOT EXISTS player_flags (
+    id VARCHAR(36) PRIMARY KEY,
+    player_name VARCHAR(255) NOT NULL,
+    reason VARCHAR(50) NOT NULL, -- solver_accuracy, robotic_timing or same_opponent_wins
+    detail TEXT NOT NULL DEFAULT '',
+    value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, dismissed or confirmed
+    flagged_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    review_note TEXT NOT NULL DEFAULT ''
+);
+
+-- Counters every analytics consumer instance adds to, in shared counter mode
+CREATE TABLE IF NOT EXISTS analytics_counters (
+    name VARCHAR(100) NOT NULL, -- e.g. games or games_per_hour
+    field VARCHAR(255) NOT NULL, -- e.g. completed or 2024-01-01-13
+    value BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (name, field)
+);
+
+-- Columns added to tables before migrations were versioned
+
+ALTER TABLE games ADD COLUMN IF NOT EXISTS player1_is_bot BOOLEAN DEFAULT FALSE;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS player2_is_bot BOOLEAN DEFAULT FALSE;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS winner_name VARCHAR(255);
+ALTER TABLE games ADD COLUMN IF NOT EXISTS win_type VARCHAR(50);
+ALTER TABLE games ADD COLUMN IF NOT EXISTS final_board JSONB;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS started_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS current_streak BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS longest_streak BIGINT NOT NULL DEFAULT 0;
+
 -- Indexes for performance
 
--- Games table indexes
+-- Games table indexes, the server used to create the first three as
+-- idx_games_player1, idx_games_player2 and idx_games_winner
+DROP INDEX IF EXISTS idx_games_player1;
+DROP INDEX IF EXISTS idx_games_player2;
+DROP INDEX IF EXISTS idx_games_winner;
 CREATE INDEX IF NOT EXISTS idx_games_player1_id ON games(player1_id);
 CREATE INDEX IF NOT EXISTS idx_games_player2_id ON games(player2_id);
 CREATE INDEX IF NOT EXISTS idx_games_winner_id ON games(winner_id);
@@ -139,6 +327,9 @@ CREATE INDEX IF NOT EXISTS idx_games_duration ON games(duration_seconds);
 CREATE INDEX IF NOT EXISTS idx_games_created_at ON games(created_at);
 CREATE INDEX IF NOT EXISTS idx_games_player_names ON games(player1_name, player2_name);
 
+-- Player ratings indexes
+CREATE INDEX IF NOT EXISTS idx_player_ratings_rating ON player_ratings(rating DESC);
+
 -- Leaderboard table indexes
 CREATE INDEX IF NOT EXISTS idx_leaderboard_username ON leaderboard(username);
 CREATE INDEX IF NOT EXISTS idx_leaderboard_wins ON leaderboard(wins DESC);
@@ -151,6 +342,12 @@ CREATE INDEX IF NOT EXISTS idx_game_moves_game_id ON game_moves(game_id);
 CREATE INDEX IF NOT EXISTS idx_game_moves_player_id ON game_moves(player_id);
 CREATE INDEX IF NOT EXISTS idx_game_moves_timestamp ON game_moves(move_timestamp);
 
+-- Processed events indexes
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events(processed_at);
+
+-- Webhook dead letters indexes
+CREATE INDEX IF NOT EXISTS idx_webhook_dead_letters_failed_at ON webhook_dead_letters(failed_at DESC);
+
 -- Composite indexes for common queries
 CREATE INDEX IF NOT EXISTS idx_games_player_outcome ON games(player1_name, winner_name, finished_at);
 CREATE INDEX IF NOT EXISTS idx_leaderboard_ranking ON leaderboard(win_rate DESC, wins DESC, total_games DESC);
@@ -315,6 +512,7 @@ END;
 $$ LANGUAGE plpgsql;
 
 -- Trigger to automatically update leaderboard
+DROP TRIGGER IF EXISTS trigger_update_leaderboard ON games;
 CREATE TRIGGER trigger_update_leaderboard
     AFTER INSERT ON games
     FOR EACH ROW
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS idx_game_history_total_moves;
+DROP INDEX IF EXISTS idx_game_history_duration;
+DROP INDEX IF EXISTS idx_game_history_has_bot;
+DROP INDEX IF EXISTS idx_game_history_win_type;
+DROP INDEX IF EXISTS idx_game_history_player_names;
+DROP INDEX IF EXISTS idx_game_history_finished_at;
+
+ALTER TABLE game_history
+    DROP COLUMN IF EXISTS started_at,
+    DROP COLUMN IF EXISTS duration_seconds,
+    DROP COLUMN IF EXISTS total_moves,
+    DROP COLUMN IF EXISTS has_bot,
+    DROP COLUMN IF EXISTS win_type,
+    DROP COLUMN IF EXISTS is_draw,
+    DROP COLUMN IF EXISTS winner_names,
+    DROP COLUMN IF EXISTS player_names;
@@ -0,0 +1,18 @@
+-- Columns taken from the game for the /api/games queries. The server fills
+-- them in on startup for games saved without them.
+
+ALTER TABLE game_history ADD COLUMN IF NOT EXISTS player_names TEXT[]; -- both colors and teammates
+ALTER TABLE game_history ADD COLUMN IF NOT EXISTS winner_names TEXT[]; -- the winning color and teammate, empty for a draw
+ALTER TABLE game_history ADD COLUMN IF NOT EXISTS is_draw BOOLEAN;
+ALTER TABLE game_history ADD COLUMN IF NOT EXISTS win_type VARCHAR(50); -- 'horizontal', 'vertical', 'diagonal_positive', 'diagonal_negative', 'forfeit', NULL for draw
+ALTER TABLE game_history ADD COLUMN IF NOT EXISTS has_bot BOOLEAN;
+ALTER TABLE game_history ADD COLUMN IF NOT EXISTS total_moves INTEGER;
+ALTER TABLE game_history ADD COLUMN IF NOT EXISTS duration_seconds INTEGER;
+ALTER TABLE game_history ADD COLUMN IF NOT EXISTS started_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_game_history_finished_at ON game_history(finished_at DESC);
+CREATE INDEX IF NOT EXISTS idx_game_history_player_names ON game_history USING GIN (player_names);
+CREATE INDEX IF NOT EXISTS idx_game_history_win_type ON game_history(win_type, finished_at DESC);
+CREATE INDEX IF NOT EXISTS idx_game_history_has_bot ON game_history(has_bot, finished_at DESC);
+CREATE INDEX IF NOT EXISTS idx_game_history_duration ON game_history(duration_seconds);
+CREATE INDEX IF NOT EXISTS idx_game_history_total_moves ON game_history(total_moves);
@@ -0,0 +1,6 @@
+-- Moves of games that aren't in the games table are lost
+
+ALTER TABLE game_moves DROP CONSTRAINT IF EXISTS game_moves_game_id_fkey;
+DELETE FROM game_moves WHERE game_id NOT IN (SELECT id FROM games);
+ALTER TABLE game_moves ADD CONSTRAINT game_moves_game_id_fkey
+    FOREIGN KEY (game_id) REFERENCES games(id) ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+-- Moves are saved with the finished game in game_history, which the server
+-- keeps, rather than with the games table, which it doesn't write
+
+ALTER TABLE game_moves DROP CONSTRAINT IF EXISTS game_moves_game_id_fkey;
+ALTER TABLE game_moves ADD CONSTRAINT game_moves_game_id_fkey
+    FOREIGN KEY (game_id) REFERENCES game_history(game_id) ON DELETE CASCADE;
@@ -0,0 +1,132 @@
+-- Puts back the leaderboard functions of the initial migration, which don't
+-- keep streaks. The rows are left as they are.
+
+CREATE OR REPLACE FUNCTION update_leaderboard_stats()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Update player1 stats
+    INSERT INTO leaderboard (username, player_id, total_games, wins, losses, draws, first_game_at, last_game_at)
+    VALUES (
+        NEW.player1_name, 
+        NEW.player1_id, 
+        1,
+        CASE WHEN NEW.winner_name = NEW.player1_name THEN 1 ELSE 0 END,
+        CASE WHEN NEW.winner_name != NEW.player1_name AND NOT NEW.is_draw THEN 1 ELSE 0 END,
+        CASE WHEN NEW.is_draw THEN 1 ELSE 0 END,
+        NEW.finished_at,
+        NEW.finished_at
+    )
+    ON CONFLICT (username) DO UPDATE SET
+        total_games = leaderboard.total_games + 1,
+        wins = leaderboard.wins + CASE WHEN NEW.winner_name = NEW.player1_name THEN 1 ELSE 0 END,
+        losses = leaderboard.losses + CASE WHEN NEW.winner_name != NEW.player1_name AND NOT NEW.is_draw THEN 1 ELSE 0 END,
+        draws = leaderboard.draws + CASE WHEN NEW.is_draw THEN 1 ELSE 0 END,
+        win_rate = CASE 
+            WHEN (leaderboard.total_games + 1) > 0 
+            THEN ROUND((leaderboard.wins + CASE WHEN NEW.winner_name = NEW.player1_name THEN 1 ELSE 0 END) * 100.0 / (leaderboard.total_games + 1), 2)
+            ELSE 0.00 
+        END,
+        total_playtime_seconds = leaderboard.total_playtime_seconds + NEW.duration_seconds,
+        average_game_duration = ROUND((leaderboard.total_playtime_seconds + NEW.duration_seconds) / (leaderboard.total_games + 1.0), 2),
+        last_game_at = NEW.finished_at,
+        updated_at = NOW(),
+        
+        -- Update win type counters
+        horizontal_wins = leaderboard.horizontal_wins + CASE WHEN NEW.winner_name = NEW.player1_name AND NEW.win_type = 'horizontal' THEN 1 ELSE 0 END,
+        vertical_wins = leaderboard.vertical_wins + CASE WHEN NEW.winner_name = NEW.player1_name AND NEW.win_type = 'vertical' THEN 1 ELSE 0 END,
+        diagonal_wins = leaderboard.diagonal_wins + CASE WHEN NEW.winner_name = NEW.player1_name AND NEW.win_type LIKE 'diagonal%' THEN 1 ELSE 0 END,
+        forfeit_wins = leaderboard.forfeit_wins + CASE WHEN NEW.winner_name = NEW.player1_name AND NEW.win_type = 'forfeit' THEN 1 ELSE 0 END,
+        
+        -- Update opponent type counters
+        wins_vs_humans = leaderboard.wins_vs_humans + CASE WHEN NEW.winner_name = NEW.player1_name AND NOT NEW.player2_is_bot THEN 1 ELSE 0 END,
+        wins_vs_bots = leaderboard.wins_vs_bots + CASE WHEN NEW.winner_name = NEW.player1_name AND NEW.player2_is_bot THEN 1 ELSE 0 END,
+        losses_vs_humans = leaderboard.losses_vs_humans + CASE WHEN NEW.winner_name != NEW.player1_name AND NOT NEW.is_draw AND NOT NEW.player2_is_bot THEN 1 ELSE 0 END,
+        losses_vs_bots = leaderboard.losses_vs_bots + CASE WHEN NEW.winner_name != NEW.player1_name AND NOT NEW.is_draw AND NEW.player2_is_bot THEN 1 ELSE 0 END;
+
+    -- Update player2 stats
+    INSERT INTO leaderboard (username, player_id, total_games, wins, losses, draws, first_game_at, last_game_at)
+    VALUES (
+        NEW.player2_name, 
+        NEW.player2_id, 
+        1,
+        CASE WHEN NEW.winner_name = NEW.player2_name THEN 1 ELSE 0 END,
+        CASE WHEN NEW.winner_name != NEW.player2_name AND NOT NEW.is_draw THEN 1 ELSE 0 END,
+        CASE WHEN NEW.is_draw THEN 1 ELSE 0 END,
+        NEW.finished_at,
+        NEW.finished_at
+    )
+    ON CONFLICT (username) DO UPDATE SET
+        total_games = leaderboard.total_games + 1,
+        wins = leaderboard.wins + CASE WHEN NEW.winner_name = NEW.player2_name THEN 1 ELSE 0 END,
+        losses = leaderboard.losses + CASE WHEN NEW.winner_name != NEW.player2_name AND NOT NEW.is_draw THEN 1 ELSE 0 END,
+        draws = leaderboard.draws + CASE WHEN NEW.is_draw THEN 1 ELSE 0 END,
+        win_rate = CASE 
+            WHEN (leaderboard.total_games + 1) > 0 
+            THEN ROUND((leaderboard.wins + CASE WHEN NEW.winner_name = NEW.player2_name THEN 1 ELSE 0 END) * 100.0 / (leaderboard.total_games + 1), 2)
+            ELSE 0.00 
+        END,
+        total_playtime_seconds = leaderboard.total_playtime_seconds + NEW.duration_seconds,
+        average_game_duration = ROUND((leaderboard.total_playtime_seconds + NEW.duration_seconds) / (leaderboard.total_games + 1.0), 2),
+        last_game_at = NEW.finished_at,
+        updated_at = NOW(),
+        
+        -- Update win type counters
+        horizontal_wins = leaderboard.horizontal_wins + CASE WHEN NEW.winner_name = NEW.player2_name AND NEW.win_type = 'horizontal' THEN 1 ELSE 0 END,
+        vertical_wins = leaderboard.vertical_wins + CASE WHEN NEW.winner_name = NEW.player2_name AND NEW.win_type = 'vertical' THEN 1 ELSE 0 END,
+        diagonal_wins = leaderboard.diagonal_wins + CASE WHEN NEW.winner_name = NEW.player2_name AND NEW.win_type LIKE 'diagonal%' THEN 1 ELSE 0 END,
+        forfeit_wins = leaderboard.forfeit_wins + CASE WHEN NEW.winner_name = NEW.player2_name AND NEW.win_type = 'forfeit' THEN 1 ELSE 0 END,
+        
+        -- Update opponent type counters
+        wins_vs_humans = leaderboard.wins_vs_humans + CASE WHEN NEW.winner_name = NEW.player2_name AND NOT NEW.player1_is_bot THEN 1 ELSE 0 END,
+        wins_vs_bots = leaderboard.wins_vs_bots + CASE WHEN NEW.winner_name = NEW.player2_name AND NEW.player1_is_bot THEN 1 ELSE 0 END,
+        losses_vs_humans = leaderboard.losses_vs_humans + CASE WHEN NEW.winner_name != NEW.player2_name AND NOT NEW.is_draw AND NOT NEW.player1_is_bot THEN 1 ELSE 0 END,
+        losses_vs_bots = leaderboard.losses_vs_bots + CASE WHEN NEW.winner_name != NEW.player2_name AND NOT NEW.is_draw AND NEW.player1_is_bot THEN 1 ELSE 0 END;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION recalculate_leaderboard_stats()
+RETURNS void AS $$
+BEGIN
+    -- Clear existing leaderboard
+    DELETE FROM leaderboard;
+    
+    -- Recalculate from games table
+    INSERT INTO leaderboard (
+        username, player_id, total_games, wins, losses, draws, 
+        win_rate, total_playtime_seconds, average_game_duration,
+        horizontal_wins, vertical_wins, diagonal_wins, forfeit_wins,
+        wins_vs_humans, wins_vs_bots, losses_vs_humans, losses_vs_bots,
+        first_game_at, last_game_at
+    )
+    SELECT 
+        player_name,
+        player_id,
+        COUNT(*) as total_games,
+        SUM(CASE WHEN outcome = 'win' THEN 1 ELSE 0 END) as wins,
+        SUM(CASE WHEN outcome = 'loss' THEN 1 ELSE 0 END) as losses,
+        SUM(CASE WHEN outcome = 'draw' THEN 1 ELSE 0 END) as draws,
+        CASE 
+            WHEN COUNT(*) > 0 
+            THEN ROUND(SUM(CASE WHEN outcome = 'win' THEN 1 ELSE 0 END) * 100.0 / COUNT(*), 2)
+            ELSE 0.00 
+        END as win_rate,
+        SUM(duration_seconds) as total_playtime_seconds,
+        ROUND(AVG(duration_seconds), 2) as average_game_duration,
+        SUM(CASE WHEN outcome = 'win' AND win_type = 'horizontal' THEN 1 ELSE 0 END) as horizontal_wins,
+        SUM(CASE WHEN outcome = 'win' AND win_type = 'vertical' THEN 1 ELSE 0 END) as vertical_wins,
+        SUM(CASE WHEN outcome = 'win' AND win_type LIKE 'diagonal%' THEN 1 ELSE 0 END) as diagonal_wins,
+        SUM(CASE WHEN outcome = 'win' AND win_type = 'forfeit' THEN 1 ELSE 0 END) as forfeit_wins,
+        SUM(CASE WHEN outcome = 'win' AND NOT opponent_is_bot THEN 1 ELSE 0 END) as wins_vs_humans,
+        SUM(CASE WHEN outcome = 'win' AND opponent_is_bot THEN 1 ELSE 0 END) as wins_vs_bots,
+        SUM(CASE WHEN outcome = 'loss' AND NOT opponent_is_bot THEN 1 ELSE 0 END) as losses_vs_humans,
+        SUM(CASE WHEN outcome = 'loss' AND opponent_is_bot THEN 1 ELSE 0 END) as losses_vs_bots,
+        MIN(finished_at) as first_game_at,
+        MAX(finished_at) as last_game_at
+    FROM player_game_history
+    GROUP BY player_name, player_id;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS update_leaderboard_player(VARCHAR, UUID, BOOLEAN, games);
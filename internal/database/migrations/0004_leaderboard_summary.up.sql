@@ -0,0 +1,149 @@
+-- The leaderboard table is what GET /api/leaderboard reads, kept up to date
+-- by the games trigger and rebuilt on a schedule. The trigger now keeps the
+-- streaks and first game too, and winners are matched by ID, so a guest's
+-- games merged into an account count once the leaderboard is rebuilt.
+
+-- Adds a game to one of its players' rows
+CREATE OR REPLACE FUNCTION update_leaderboard_player(
+    p_name VARCHAR, p_id UUID, p_opponent_is_bot BOOLEAN, game games
+) RETURNS void AS $$
+DECLARE
+    won BOOLEAN := COALESCE(game.winner_id = p_id, FALSE);
+    lost BOOLEAN := NOT game.is_draw AND NOT COALESCE(game.winner_id = p_id, FALSE);
+    win_type VARCHAR := COALESCE(game.win_type, '');
+BEGIN
+    INSERT INTO leaderboard AS l (
+        username, player_id, total_games, wins, losses, draws,
+        win_rate, total_playtime_seconds, average_game_duration,
+        horizontal_wins, vertical_wins, diagonal_wins, forfeit_wins,
+        wins_vs_humans, wins_vs_bots, losses_vs_humans, losses_vs_bots,
+        current_win_streak, longest_win_streak, current_loss_streak,
+        first_game_at, last_game_at
+    )
+    VALUES (
+        p_name, p_id, 1, won::INTEGER, lost::INTEGER, game.is_draw::INTEGER,
+        won::INTEGER * 100, game.duration_seconds, game.duration_seconds,
+        (won AND win_type = 'horizontal')::INTEGER,
+        (won AND win_type = 'vertical')::INTEGER,
+        (won AND win_type LIKE 'diagonal%')::INTEGER,
+        (won AND win_type = 'forfeit')::INTEGER,
+        (won AND NOT p_opponent_is_bot)::INTEGER,
+        (won AND p_opponent_is_bot)::INTEGER,
+        (lost AND NOT p_opponent_is_bot)::INTEGER,
+        (lost AND p_opponent_is_bot)::INTEGER,
+        won::INTEGER, won::INTEGER, lost::INTEGER,
+        game.finished_at, game.finished_at
+    )
+    ON CONFLICT (username) DO UPDATE SET
+        player_id = EXCLUDED.player_id,
+        total_games = l.total_games + 1,
+        wins = l.wins + EXCLUDED.wins,
+        losses = l.losses + EXCLUDED.losses,
+        draws = l.draws + EXCLUDED.draws,
+        win_rate = ROUND((l.wins + EXCLUDED.wins) * 100.0 / (l.total_games + 1), 2),
+        total_playtime_seconds = l.total_playtime_seconds + EXCLUDED.total_playtime_seconds,
+        average_game_duration = ROUND((l.total_playtime_seconds + EXCLUDED.total_playtime_seconds) / (l.total_games + 1.0), 2),
+        horizontal_wins = l.horizontal_wins + EXCLUDED.horizontal_wins,
+        vertical_wins = l.vertical_wins + EXCLUDED.vertical_wins,
+        diagonal_wins = l.diagonal_wins + EXCLUDED.diagonal_wins,
+        forfeit_wins = l.forfeit_wins + EXCLUDED.forfeit_wins,
+        wins_vs_humans = l.wins_vs_humans + EXCLUDED.wins_vs_humans,
+        wins_vs_bots = l.wins_vs_bots + EXCLUDED.wins_vs_bots,
+        losses_vs_humans = l.losses_vs_humans + EXCLUDED.losses_vs_humans,
+        losses_vs_bots = l.losses_vs_bots + EXCLUDED.losses_vs_bots,
+        current_win_streak = CASE WHEN won THEN l.current_win_streak + 1 ELSE 0 END,
+        longest_win_streak = GREATEST(l.longest_win_streak, CASE WHEN won THEN l.current_win_streak + 1 ELSE 0 END),
+        current_loss_streak = CASE WHEN lost THEN l.current_loss_streak + 1 ELSE 0 END,
+        first_game_at = LEAST(l.first_game_at, EXCLUDED.first_game_at),
+        last_game_at = GREATEST(l.last_game_at, EXCLUDED.last_game_at),
+        updated_at = NOW();
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION update_leaderboard_stats()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM update_leaderboard_player(NEW.player1_name, NEW.player1_id, NEW.player2_is_bot, NEW);
+    PERFORM update_leaderboard_player(NEW.player2_name, NEW.player2_id, NEW.player1_is_bot, NEW);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Rebuilds the leaderboard from the games table in one transaction, readers
+-- see the old rows until it commits. One row per player name, with the ID
+-- of their latest game.
+CREATE OR REPLACE FUNCTION recalculate_leaderboard_stats()
+RETURNS void AS $$
+BEGIN
+    DELETE FROM leaderboard;
+
+    INSERT INTO leaderboard (
+        username, player_id, total_games, wins, losses, draws,
+        win_rate, total_playtime_seconds, average_game_duration,
+        horizontal_wins, vertical_wins, diagonal_wins, forfeit_wins,
+        wins_vs_humans, wins_vs_bots, losses_vs_humans, losses_vs_bots,
+        current_win_streak, longest_win_streak, current_loss_streak,
+        first_game_at, last_game_at
+    )
+    WITH results AS (
+        SELECT g.id, g.finished_at, g.duration_seconds, g.win_type, p.name, p.player_id, p.opponent_is_bot,
+            CASE WHEN g.is_draw THEN 'draw' WHEN g.winner_id = p.player_id THEN 'win' ELSE 'loss' END AS outcome
+        FROM games g
+        CROSS JOIN LATERAL (VALUES
+            (g.player1_name, g.player1_id, g.player2_is_bot),
+            (g.player2_name, g.player2_id, g.player1_is_bot)
+        ) AS p(name, player_id, opponent_is_bot)
+    ),
+    -- A streak is a run of games between two games that end it, numbered by
+    -- how many games ended a streak before it
+    runs AS (
+        SELECT *,
+            COUNT(*) FILTER (WHERE outcome <> 'win') OVER player_games AS win_run,
+            COUNT(*) FILTER (WHERE outcome <> 'loss') OVER player_games AS loss_run
+        FROM results
+        WINDOW player_games AS (PARTITION BY name ORDER BY finished_at, id)
+    ),
+    latest_runs AS (
+        SELECT *,
+            MAX(win_run) OVER (PARTITION BY name) AS latest_win_run,
+            MAX(loss_run) OVER (PARTITION BY name) AS latest_loss_run
+        FROM runs
+    ),
+    longest_streaks AS (
+        SELECT name, MAX(wins) AS longest_win_streak
+        FROM (
+            SELECT name, COUNT(*) FILTER (WHERE outcome = 'win') AS wins
+            FROM runs GROUP BY name, win_run
+        ) win_streaks
+        GROUP BY name
+    )
+    SELECT
+        r.name,
+        (ARRAY_AGG(r.player_id ORDER BY r.finished_at DESC))[1],
+        COUNT(*),
+        COUNT(*) FILTER (WHERE r.outcome = 'win'),
+        COUNT(*) FILTER (WHERE r.outcome = 'loss'),
+        COUNT(*) FILTER (WHERE r.outcome = 'draw'),
+        ROUND(COUNT(*) FILTER (WHERE r.outcome = 'win') * 100.0 / COUNT(*), 2),
+        SUM(r.duration_seconds),
+        ROUND(AVG(r.duration_seconds), 2),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_type = 'horizontal'),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_type = 'vertical'),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_type LIKE 'diagonal%'),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_type = 'forfeit'),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND NOT r.opponent_is_bot),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.opponent_is_bot),
+        COUNT(*) FILTER (WHERE r.outcome = 'loss' AND NOT r.opponent_is_bot),
+        COUNT(*) FILTER (WHERE r.outcome = 'loss' AND r.opponent_is_bot),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_run = r.latest_win_run),
+        s.longest_win_streak,
+        COUNT(*) FILTER (WHERE r.outcome = 'loss' AND r.loss_run = r.latest_loss_run),
+        MIN(r.finished_at),
+        MAX(r.finished_at)
+    FROM latest_runs r
+    JOIN longest_streaks s ON s.name = r.name
+    GROUP BY r.name, s.longest_win_streak;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT recalculate_leaderboard_stats();
@@ -0,0 +1,8 @@
+-- The period leaderboards are dropped, the all-time one is kept
+
+DROP TRIGGER IF EXISTS trigger_update_leaderboard_periods ON games;
+DROP FUNCTION IF EXISTS recalculate_leaderboard_periods();
+DROP FUNCTION IF EXISTS update_leaderboard_periods();
+DROP FUNCTION IF EXISTS leaderboard_period_start(VARCHAR, TIMESTAMP WITH TIME ZONE);
+
+DROP TABLE IF EXISTS leaderboard_periods;
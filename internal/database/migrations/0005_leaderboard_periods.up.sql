@@ -0,0 +1,149 @@
+-- Leaderboards of a day, a week, a month or a season, a calendar quarter,
+-- each kept in its own partition. Periods start at midnight UTC, weeks on
+-- Monday. A trigger on games adds every game to its periods like the
+-- all-time leaderboard, and the same schedule rebuilds them.
+
+CREATE TABLE IF NOT EXISTS leaderboard_periods (
+    period VARCHAR(10) NOT NULL, -- day, week, month or season
+    period_start DATE NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    player_id UUID,
+    total_games INTEGER NOT NULL DEFAULT 0,
+    wins INTEGER NOT NULL DEFAULT 0,
+    losses INTEGER NOT NULL DEFAULT 0,
+    draws INTEGER NOT NULL DEFAULT 0,
+    total_playtime_seconds BIGINT NOT NULL DEFAULT 0,
+    horizontal_wins INTEGER NOT NULL DEFAULT 0,
+    vertical_wins INTEGER NOT NULL DEFAULT 0,
+    diagonal_wins INTEGER NOT NULL DEFAULT 0,
+    forfeit_wins INTEGER NOT NULL DEFAULT 0,
+    wins_vs_humans INTEGER NOT NULL DEFAULT 0,
+    wins_vs_bots INTEGER NOT NULL DEFAULT 0,
+    losses_vs_humans INTEGER NOT NULL DEFAULT 0,
+    losses_vs_bots INTEGER NOT NULL DEFAULT 0,
+    first_game_at TIMESTAMP WITH TIME ZONE,
+    last_game_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (period, period_start, username)
+) PARTITION BY LIST (period);
+
+CREATE TABLE IF NOT EXISTS leaderboard_daily PARTITION OF leaderboard_periods FOR VALUES IN ('day');
+CREATE TABLE IF NOT EXISTS leaderboard_weekly PARTITION OF leaderboard_periods FOR VALUES IN ('week');
+CREATE TABLE IF NOT EXISTS leaderboard_monthly PARTITION OF leaderboard_periods FOR VALUES IN ('month');
+CREATE TABLE IF NOT EXISTS leaderboard_seasonal PARTITION OF leaderboard_periods FOR VALUES IN ('season');
+
+CREATE INDEX IF NOT EXISTS idx_leaderboard_periods_ranking ON leaderboard_periods(period, period_start, wins DESC);
+
+-- The start of the period a time falls in
+CREATE OR REPLACE FUNCTION leaderboard_period_start(period VARCHAR, at TIMESTAMP WITH TIME ZONE)
+RETURNS DATE AS $$
+    SELECT date_trunc(CASE period WHEN 'season' THEN 'quarter' ELSE period END, at AT TIME ZONE 'UTC')::DATE;
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Adds a game inserted into games to both players' rows of every period
+CREATE OR REPLACE FUNCTION update_leaderboard_periods()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO leaderboard_periods AS l (
+        period, period_start, username, player_id, total_games, wins, losses, draws, total_playtime_seconds,
+        horizontal_wins, vertical_wins, diagonal_wins, forfeit_wins,
+        wins_vs_humans, wins_vs_bots, losses_vs_humans, losses_vs_bots,
+        first_game_at, last_game_at
+    )
+    SELECT
+        periods.period, leaderboard_period_start(periods.period, NEW.finished_at), p.name, p.id,
+        1, r.won::INTEGER, r.lost::INTEGER, NEW.is_draw::INTEGER, NEW.duration_seconds,
+        (r.won AND r.win_type = 'horizontal')::INTEGER,
+        (r.won AND r.win_type = 'vertical')::INTEGER,
+        (r.won AND r.win_type LIKE 'diagonal%')::INTEGER,
+        (r.won AND r.win_type = 'forfeit')::INTEGER,
+        (r.won AND NOT p.opponent_is_bot)::INTEGER,
+        (r.won AND p.opponent_is_bot)::INTEGER,
+        (r.lost AND NOT p.opponent_is_bot)::INTEGER,
+        (r.lost AND p.opponent_is_bot)::INTEGER,
+        NEW.finished_at, NEW.finished_at
+    FROM (VALUES
+        (NEW.player1_name, NEW.player1_id, NEW.player2_is_bot),
+        (NEW.player2_name, NEW.player2_id, NEW.player1_is_bot)
+    ) AS p(name, id, opponent_is_bot)
+    CROSS JOIN LATERAL (
+        SELECT COALESCE(NEW.winner_id = p.id, FALSE) AS won,
+            NOT NEW.is_draw AND NOT COALESCE(NEW.winner_id = p.id, FALSE) AS lost,
+            COALESCE(NEW.win_type, '') AS win_type
+    ) AS r
+    CROSS JOIN (VALUES ('day'), ('week'), ('month'), ('season')) AS periods(period)
+    ON CONFLICT (period, period_start, username) DO UPDATE SET
+        player_id = EXCLUDED.player_id,
+        total_games = l.total_games + 1,
+        wins = l.wins + EXCLUDED.wins,
+        losses = l.losses + EXCLUDED.losses,
+        draws = l.draws + EXCLUDED.draws,
+        total_playtime_seconds = l.total_playtime_seconds + EXCLUDED.total_playtime_seconds,
+        horizontal_wins = l.horizontal_wins + EXCLUDED.horizontal_wins,
+        vertical_wins = l.vertical_wins + EXCLUDED.vertical_wins,
+        diagonal_wins = l.diagonal_wins + EXCLUDED.diagonal_wins,
+        forfeit_wins = l.forfeit_wins + EXCLUDED.forfeit_wins,
+        wins_vs_humans = l.wins_vs_humans + EXCLUDED.wins_vs_humans,
+        wins_vs_bots = l.wins_vs_bots + EXCLUDED.wins_vs_bots,
+        losses_vs_humans = l.losses_vs_humans + EXCLUDED.losses_vs_humans,
+        losses_vs_bots = l.losses_vs_bots + EXCLUDED.losses_vs_bots,
+        first_game_at = LEAST(l.first_game_at, EXCLUDED.first_game_at),
+        last_game_at = GREATEST(l.last_game_at, EXCLUDED.last_game_at);
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_update_leaderboard_periods ON games;
+CREATE TRIGGER trigger_update_leaderboard_periods
+    AFTER INSERT ON games
+    FOR EACH ROW
+    EXECUTE FUNCTION update_leaderboard_periods();
+
+-- Rebuilds every period from the games table in one transaction
+CREATE OR REPLACE FUNCTION recalculate_leaderboard_periods()
+RETURNS void AS $$
+BEGIN
+    DELETE FROM leaderboard_periods;
+
+    INSERT INTO leaderboard_periods (
+        period, period_start, username, player_id, total_games, wins, losses, draws, total_playtime_seconds,
+        horizontal_wins, vertical_wins, diagonal_wins, forfeit_wins,
+        wins_vs_humans, wins_vs_bots, losses_vs_humans, losses_vs_bots,
+        first_game_at, last_game_at
+    )
+    WITH results AS (
+        SELECT g.finished_at, g.duration_seconds, g.win_type, p.name, p.player_id, p.opponent_is_bot,
+            CASE WHEN g.is_draw THEN 'draw' WHEN g.winner_id = p.player_id THEN 'win' ELSE 'loss' END AS outcome
+        FROM games g
+        CROSS JOIN LATERAL (VALUES
+            (g.player1_name, g.player1_id, g.player2_is_bot),
+            (g.player2_name, g.player2_id, g.player1_is_bot)
+        ) AS p(name, player_id, opponent_is_bot)
+    )
+    SELECT
+        periods.period,
+        leaderboard_period_start(periods.period, r.finished_at) AS period_start,
+        r.name,
+        (ARRAY_AGG(r.player_id ORDER BY r.finished_at DESC))[1],
+        COUNT(*),
+        COUNT(*) FILTER (WHERE r.outcome = 'win'),
+        COUNT(*) FILTER (WHERE r.outcome = 'loss'),
+        COUNT(*) FILTER (WHERE r.outcome = 'draw'),
+        SUM(r.duration_seconds),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_type = 'horizontal'),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_type = 'vertical'),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_type LIKE 'diagonal%'),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.win_type = 'forfeit'),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND NOT r.opponent_is_bot),
+        COUNT(*) FILTER (WHERE r.outcome = 'win' AND r.opponent_is_bot),
+        COUNT(*) FILTER (WHERE r.outcome = 'loss' AND NOT r.opponent_is_bot),
+        COUNT(*) FILTER (WHERE r.outcome = 'loss' AND r.opponent_is_bot),
+        MIN(r.finished_at),
+        MAX(r.finished_at)
+    FROM results r
+    CROSS JOIN (VALUES ('day'), ('week'), ('month'), ('season')) AS periods(period)
+    GROUP BY periods.period, period_start, r.name;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT recalculate_leaderboard_periods();
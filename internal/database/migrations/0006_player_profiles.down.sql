@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trigger_record_rating_history ON player_ratings;
+DROP FUNCTION IF EXISTS record_rating_history();
+DROP INDEX IF EXISTS idx_game_moves_player_name;
+DROP TABLE IF EXISTS rating_history;
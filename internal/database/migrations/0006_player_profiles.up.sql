@@ -0,0 +1,38 @@
+-- What player profiles read: every rating a player has had, recorded by a
+-- trigger whenever player_ratings changes, and the moves by player name for
+-- the columns a player opens in.
+
+CREATE TABLE IF NOT EXISTS rating_history (
+    id BIGSERIAL PRIMARY KEY,
+    player_name VARCHAR(255) NOT NULL,
+    rating DOUBLE PRECISION NOT NULL,
+    games_played INTEGER NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rating_history_player ON rating_history(player_name, recorded_at DESC);
+CREATE INDEX IF NOT EXISTS idx_game_moves_player_name ON game_moves(player_name, game_id, move_number);
+
+-- Records a player's new rating, renaming a rating isn't a change
+CREATE OR REPLACE FUNCTION record_rating_history()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.rating IS DISTINCT FROM OLD.rating THEN
+        INSERT INTO rating_history (player_name, rating, games_played, recorded_at)
+        VALUES (NEW.player_name, NEW.rating, NEW.games_played, COALESCE(NEW.updated_at, NOW()));
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_record_rating_history ON player_ratings;
+CREATE TRIGGER trigger_record_rating_history
+    AFTER INSERT OR UPDATE ON player_ratings
+    FOR EACH ROW
+    EXECUTE FUNCTION record_rating_history();
+
+-- Ratings from before the history start with their current value
+INSERT INTO rating_history (player_name, rating, games_played, recorded_at)
+SELECT player_name, rating, games_played, COALESCE(updated_at, NOW())
+FROM player_ratings
+WHERE NOT EXISTS (SELECT 1 FROM rating_history h WHERE h.player_name = player_ratings.player_name);
@@ -0,0 +1,24 @@
+-- Seasons of rated play and where players finished them. At most one season
+-- runs at a time, the one without ended_at.
+
+CREATE TABLE IF NOT EXISTS seasons (
+    number INTEGER PRIMARY KEY,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seasons_running ON seasons((ended_at IS NULL)) WHERE ended_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS season_standings (
+    season_number INTEGER NOT NULL REFERENCES seasons(number) ON DELETE CASCADE,
+    rank INTEGER NOT NULL,
+    player_name VARCHAR(255) NOT NULL,
+    rating DOUBLE PRECISION NOT NULL,
+    games_played INTEGER NOT NULL, -- rated games in the season
+    reward VARCHAR(50),
+    PRIMARY KEY (season_number, player_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_season_standings_rank ON season_standings(season_number, rank);
+CREATE INDEX IF NOT EXISTS idx_season_standings_player ON season_standings(player_name);
@@ -0,0 +1,20 @@
+-- Drops everything the initial migration creates, data included
+
+DROP TABLE IF EXISTS analytics_counters;
+DROP TABLE IF EXISTS player_flags;
+DROP TABLE IF EXISTS retention_cohorts;
+DROP TABLE IF EXISTS player_stats;
+DROP TABLE IF EXISTS daily_stats;
+DROP TABLE IF EXISTS hourly_stats;
+DROP TABLE IF EXISTS game_stats;
+DROP TABLE IF EXISTS processed_events;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS queue_penalties;
+DROP TABLE IF EXISTS webhook_dead_letters;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS game_moves;
+DROP TABLE IF EXISTS game_history;
+DROP TABLE IF EXISTS game_snapshot;
+DROP TABLE IF EXISTS queue_snapshot;
+DROP TABLE IF EXISTS player_ratings;
+DROP TABLE IF EXISTS games;
@@ -0,0 +1,237 @@
+-- Connect Four database schema for SQLite, the tables of the Postgres schema
+-- the server and the analytics consumer use. Arrays are JSON arrays, times
+-- are TIMESTAMP so the driver reads them back as times, kept in UTC so they
+-- sort as text.
+
+-- Completed games, the leaderboard and player stats are counted from them
+CREATE TABLE games (
+    id TEXT PRIMARY KEY,
+    player1_id TEXT NOT NULL,
+    player1_name TEXT NOT NULL,
+    player1_is_bot BOOLEAN DEFAULT FALSE,
+    player2_id TEXT NOT NULL,
+    player2_name TEXT NOT NULL,
+    player2_is_bot BOOLEAN DEFAULT FALSE,
+    winner_id TEXT, -- NULL for draws
+    winner_name TEXT,
+    is_draw BOOLEAN DEFAULT FALSE,
+    total_moves INTEGER NOT NULL DEFAULT 0,
+    duration_seconds INTEGER NOT NULL DEFAULT 0,
+    win_type TEXT, -- 'horizontal', 'vertical', 'diagonal_positive', 'diagonal_negative', 'forfeit', NULL for draw
+    created_at TIMESTAMP,
+    finished_at TIMESTAMP NOT NULL,
+    CHECK ((winner_id IS NULL AND is_draw) OR (winner_id IS NOT NULL AND NOT is_draw)),
+    CHECK (duration_seconds >= 0),
+    CHECK (total_moves >= 0),
+    CHECK (player1_id != player2_id)
+);
+
+CREATE INDEX idx_games_player1_id ON games(player1_id);
+CREATE INDEX idx_games_player2_id ON games(player2_id);
+CREATE INDEX idx_games_winner_id ON games(winner_id);
+CREATE INDEX idx_games_player1_name ON games(player1_name);
+CREATE INDEX idx_games_player2_name ON games(player2_name);
+
+CREATE TABLE player_ratings (
+    player_name TEXT PRIMARY KEY,
+    rating REAL NOT NULL,
+    peak_rating REAL NOT NULL,
+    games_played INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP
+);
+
+CREATE INDEX idx_player_ratings_rating ON player_ratings(rating DESC);
+
+-- Matchmaking queue saved across server restarts
+CREATE TABLE queue_snapshot (
+    player_id TEXT PRIMARY KEY,
+    player_name TEXT NOT NULL,
+    joined_at TIMESTAMP NOT NULL,
+    queue_type TEXT NOT NULL,
+    party_id TEXT NOT NULL DEFAULT '',
+    allow_bots BOOLEAN NOT NULL DEFAULT TRUE,
+    skill_level INTEGER NOT NULL DEFAULT 5,
+    max_wait_time INTEGER NOT NULL DEFAULT 0,
+    rating INTEGER NOT NULL DEFAULT 0,
+    priority INTEGER NOT NULL DEFAULT 0
+);
+
+-- In-progress games paused across server restarts
+CREATE TABLE game_snapshot (
+    game_id TEXT PRIMARY KEY,
+    game BLOB NOT NULL,
+    saved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Finished games with their moves, replays are generated from them, and the
+-- columns of the /api/games queries
+CREATE TABLE game_history (
+    game_id TEXT PRIMARY KEY,
+    game BLOB NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    player_names TEXT, -- JSON array, both colors and teammates
+    winner_names TEXT, -- JSON array, the winning color and teammate, empty for a draw
+    is_draw BOOLEAN,
+    win_type TEXT,
+    has_bot BOOLEAN,
+    total_moves INTEGER,
+    duration_seconds INTEGER,
+    started_at TIMESTAMP
+);
+
+CREATE INDEX idx_game_history_finished_at ON game_history(finished_at DESC);
+CREATE INDEX idx_game_history_win_type ON game_history(win_type, finished_at DESC);
+CREATE INDEX idx_game_history_has_bot ON game_history(has_bot, finished_at DESC);
+CREATE INDEX idx_game_history_duration ON game_history(duration_seconds);
+CREATE INDEX idx_game_history_total_moves ON game_history(total_moves);
+
+CREATE TABLE game_moves (
+    id TEXT PRIMARY KEY,
+    game_id TEXT NOT NULL REFERENCES game_history(game_id) ON DELETE CASCADE,
+    player_id TEXT NOT NULL,
+    player_name TEXT NOT NULL,
+    player_number INTEGER NOT NULL CHECK (player_number IN (1, 2)),
+    move_number INTEGER NOT NULL,
+    column_played INTEGER NOT NULL CHECK (column_played >= 0 AND column_played <= 6),
+    row_landed INTEGER NOT NULL CHECK (row_landed >= 0 AND row_landed <= 5),
+    is_bot_move BOOLEAN DEFAULT FALSE,
+    move_timestamp TIMESTAMP,
+    time_taken_ms INTEGER DEFAULT 0,
+    UNIQUE (game_id, move_number)
+);
+
+CREATE INDEX idx_game_moves_player_id ON game_moves(player_id);
+CREATE INDEX idx_game_moves_timestamp ON game_moves(move_timestamp);
+
+-- URLs that receive signed game and tournament events
+CREATE TABLE webhooks (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    events TEXT NOT NULL, -- JSON array
+    secret TEXT NOT NULL,
+    created_at TIMESTAMP
+);
+
+-- Webhook deliveries that failed every attempt
+CREATE TABLE webhook_dead_letters (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    event TEXT NOT NULL,
+    payload BLOB NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    failed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_webhook_dead_letters_failed_at ON webhook_dead_letters(failed_at DESC);
+
+-- Escalating cooldowns for players who abandon games
+CREATE TABLE queue_penalties (
+    player_name TEXT PRIMARY KEY,
+    offenses INTEGER NOT NULL DEFAULT 0,
+    last_offense_at TIMESTAMP NOT NULL,
+    banned_until TIMESTAMP NOT NULL
+);
+
+-- Registered players, whose account ID is their player ID
+CREATE TABLE accounts (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP,
+    last_login_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_accounts_username ON accounts(LOWER(username));
+
+-- Analytics events the consumer has already counted
+CREATE TABLE processed_events (
+    event_id TEXT PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    processed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_processed_events_processed_at ON processed_events(processed_at);
+
+-- The analytics consumer's aggregates, game_stats holds a single row
+CREATE TABLE game_stats (
+    id INTEGER PRIMARY KEY,
+    total_games INTEGER NOT NULL DEFAULT 0,
+    completed_games INTEGER NOT NULL DEFAULT 0,
+    total_game_duration INTEGER NOT NULL DEFAULT 0,
+    draw_count INTEGER NOT NULL DEFAULT 0,
+    bot_games INTEGER NOT NULL DEFAULT 0,
+    human_games INTEGER NOT NULL DEFAULT 0,
+    win_types TEXT NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP
+);
+
+CREATE TABLE hourly_stats (
+    hour TEXT PRIMARY KEY, -- 2024-01-01-15
+    games INTEGER NOT NULL DEFAULT 0,
+    moves INTEGER NOT NULL DEFAULT 0,
+    players INTEGER NOT NULL DEFAULT 0,
+    average_duration REAL NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP
+);
+
+CREATE TABLE daily_stats (
+    day TEXT PRIMARY KEY, -- 2024-01-01
+    games INTEGER NOT NULL DEFAULT 0,
+    moves INTEGER NOT NULL DEFAULT 0,
+    players INTEGER NOT NULL DEFAULT 0,
+    new_players INTEGER NOT NULL DEFAULT 0,
+    average_duration REAL NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP
+);
+
+CREATE TABLE player_stats (
+    player_name TEXT PRIMARY KEY,
+    games_played INTEGER NOT NULL DEFAULT 0,
+    games_won INTEGER NOT NULL DEFAULT 0,
+    games_lost INTEGER NOT NULL DEFAULT 0,
+    games_drawn INTEGER NOT NULL DEFAULT 0,
+    total_moves INTEGER NOT NULL DEFAULT 0,
+    total_game_time INTEGER NOT NULL DEFAULT 0, -- seconds
+    disconnections INTEGER NOT NULL DEFAULT 0,
+    reconnections INTEGER NOT NULL DEFAULT 0,
+    total_offline_ms INTEGER NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL,
+    current_streak INTEGER NOT NULL DEFAULT 0, -- games won in a row
+    longest_streak INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE retention_cohorts (
+    cohort_day TEXT PRIMARY KEY, -- 2024-01-01
+    players INTEGER NOT NULL DEFAULT 0,
+    returned_d1 INTEGER NOT NULL DEFAULT 0,
+    returned_d7 INTEGER NOT NULL DEFAULT 0,
+    returned_d30 INTEGER NOT NULL DEFAULT 0,
+    churned INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP
+);
+
+-- Players the analytics consumer suspects of cheating, until reviewed
+CREATE TABLE player_flags (
+    id TEXT PRIMARY KEY,
+    player_name TEXT NOT NULL,
+    reason TEXT NOT NULL, -- solver_accuracy, robotic_timing or same_opponent_wins
+    detail TEXT NOT NULL DEFAULT '',
+    value REAL NOT NULL DEFAULT 0,
+    threshold REAL NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'open', -- open, dismissed or confirmed
+    flagged_at TIMESTAMP NOT NULL,
+    reviewed_at TIMESTAMP,
+    review_note TEXT NOT NULL DEFAULT ''
+);
+
+-- Counters every analytics consumer instance adds to, in shared counter mode
+CREATE TABLE analytics_counters (
+    name TEXT NOT NULL,
+    field TEXT NOT NULL,
+    value INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP,
+    PRIMARY KEY (name, field)
+);
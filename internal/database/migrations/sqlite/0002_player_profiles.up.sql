@@ -0,0 +1,34 @@
+-- Every rating a player has had, recorded by triggers whenever
+-- player_ratings changes, and the moves by player name for the columns a
+-- player opens in. Renaming a rating isn't a change.
+
+CREATE TABLE rating_history (
+    id INTEGER PRIMARY KEY,
+    player_name TEXT NOT NULL,
+    rating REAL NOT NULL,
+    games_played INTEGER NOT NULL,
+    recorded_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_rating_history_player ON rating_history(player_name, recorded_at DESC);
+CREATE INDEX idx_game_moves_player_name ON game_moves(player_name, game_id, move_number);
+
+CREATE TRIGGER trigger_record_rating_insert
+    AFTER INSERT ON player_ratings
+BEGIN
+    INSERT INTO rating_history (player_name, rating, games_played, recorded_at)
+    VALUES (NEW.player_name, NEW.rating, NEW.games_played, COALESCE(NEW.updated_at, CURRENT_TIMESTAMP));
+END;
+
+CREATE TRIGGER trigger_record_rating_update
+    AFTER UPDATE OF rating ON player_ratings
+    WHEN NEW.rating <> OLD.rating
+BEGIN
+    INSERT INTO rating_history (player_name, rating, games_played, recorded_at)
+    VALUES (NEW.player_name, NEW.rating, NEW.games_played, COALESCE(NEW.updated_at, CURRENT_TIMESTAMP));
+END;
+
+-- Ratings from before the history start with their current value
+INSERT INTO rating_history (player_name, rating, games_played, recorded_at)
+SELECT player_name, rating, games_played, COALESCE(updated_at, CURRENT_TIMESTAMP)
+FROM player_ratings;
@@ -0,0 +1,24 @@
+-- Seasons of rated play and where players finished them. At most one season
+-- runs at a time, the one without ended_at.
+
+CREATE TABLE seasons (
+    number INTEGER PRIMARY KEY,
+    started_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_seasons_running ON seasons((ended_at IS NULL)) WHERE ended_at IS NULL;
+
+CREATE TABLE season_standings (
+    season_number INTEGER NOT NULL REFERENCES seasons(number) ON DELETE CASCADE,
+    rank INTEGER NOT NULL,
+    player_name TEXT NOT NULL,
+    rating REAL NOT NULL,
+    games_played INTEGER NOT NULL,
+    reward TEXT,
+    PRIMARY KEY (season_number, player_name)
+);
+
+CREATE INDEX idx_season_standings_rank ON season_standings(season_number, rank);
+CREATE INDEX idx_season_standings_player ON season_standings(player_name);
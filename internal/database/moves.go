@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// gameMoveColumns are the game_moves columns saveGameMoves fills in
+var gameMoveColumns = []string{
+	"id", "game_id", "player_id", "player_name", "player_number", "move_number",
+	"column_played", "row_landed", "is_bot_move", "move_timestamp", "time_taken_ms",
+}
+
+// saveGameMoves replaces a finished game's moves in game_moves, copying them in
+// one batch
+func (r *Repository) saveGameMoves(tx *sql.Tx, game *models.Game) error {
+	if _, err := r.exec(tx, `DELETE FROM game_moves WHERE game_id = $1`, game.ID); err != nil {
+		return fmt.Errorf("failed to clear moves of game %s: %w", game.ID, err)
+	}
+	moves := newGameMoves(game)
+	if len(moves) == 0 {
+		return nil
+	}
+
+	// The copy is one statement, so one timeout covers it
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("game_moves", gameMoveColumns...))
+	if err != nil {
+		return fmt.Errorf("failed to prepare moves of game %s: %w", game.ID, err)
+	}
+	defer stmt.Close()
+
+	for i, move := range moves {
+		if _, err := stmt.ExecContext(ctx, move...); err != nil {
+			return fmt.Errorf("failed to copy move %d of game %s: %w", i+1, game.ID, err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to save moves of game %s: %w", game.ID, err)
+	}
+	return nil
+}
+
+// newGameMoves returns a finished game's game_moves rows, their values in the
+// order of gameMoveColumns. A move's think time runs from the move before it,
+// or from the start of the game for the first.
+func newGameMoves(game *models.Game) [][]interface{} {
+	players := make(map[uuid.UUID]*models.Player)
+	for _, player := range game.AllPlayers() {
+		players[player.ID] = player
+	}
+
+	moves := make([][]interface{}, 0, len(game.Moves))
+	previous := game.CreatedAt
+	for i, move := range game.Moves {
+		var name string
+		var isBot bool
+		if player, ok := players[move.PlayerID]; ok {
+			name, isBot = player.Name, player.IsBot
+		}
+		thinkTime := move.Timestamp.Sub(previous).Milliseconds()
+		if thinkTime < 0 {
+			thinkTime = 0
+		}
+		previous = move.Timestamp
+
+		moves = append(moves, []interface{}{uuid.New(), game.ID, move.PlayerID, name, int(move.Color) + 1, i + 1,
+			move.Column, move.Row, isBot, move.Timestamp, thinkTime})
+	}
+	return moves
+}
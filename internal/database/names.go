@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// GetNameHistory returns the players who finished games under the name,
+// regardless of case, and whether it has a rating
+func (r *Repository) GetNameHistory(username string) (*models.NameHistory, error) {
+	return getNameHistory(r.db, postgresHistory, r.queryContext, username)
+}
+
+// GetNameHistory returns the players who finished games under the name,
+// regardless of case, and whether it has a rating
+func (r *SQLiteRepository) GetNameHistory(username string) (*models.NameHistory, error) {
+	return getNameHistory(r.db, sqliteHistory, r.queryContext, username)
+}
+
+func getNameHistory(db *sql.DB, dialect historyDialect, queryContext func() (context.Context, context.CancelFunc), username string) (*models.NameHistory, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	history := &models.NameHistory{}
+	rows, err := db.QueryContext(ctx, bindArgs(dialect, `
+		SELECT player1_id FROM games WHERE LOWER(player1_name) = LOWER(?)
+		UNION
+		SELECT player2_id FROM games WHERE LOWER(player2_name) = LOWER(?)
+	`), username, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query players named %s: %w", username, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var playerID uuid.UUID
+		if err := rows.Scan(&playerID); err != nil {
+			return nil, fmt.Errorf("failed to scan player ID: %w", err)
+		}
+		history.PlayerIDs = append(history.PlayerIDs, playerID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating players named %s: %w", username, err)
+	}
+
+	err = db.QueryRowContext(ctx, bindArgs(dialect, `
+		SELECT EXISTS (SELECT 1 FROM player_ratings WHERE LOWER(player_name) = LOWER(?))
+	`), username).Scan(&history.Rated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rating of %s: %w", username, err)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Periods a leaderboard can cover besides all time. They start at midnight
+// UTC, weeks on Monday, and a season is a calendar quarter.
+const (
+	LeaderboardDay    = "day"
+	LeaderboardWeek   = "week"
+	LeaderboardMonth  = "month"
+	LeaderboardSeason = "season"
+)
+
+// LeaderboardPeriod returns the start and end of the period the time falls in
+func LeaderboardPeriod(period string, at time.Time) (start, end time.Time, err error) {
+	at = at.UTC()
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case LeaderboardDay:
+		return day, day.AddDate(0, 0, 1), nil
+	case LeaderboardWeek:
+		start = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return start, start.AddDate(0, 0, 7), nil
+	case LeaderboardMonth:
+		start = time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0), nil
+	case LeaderboardSeason:
+		start = time.Date(at.Year(), at.Month()-(at.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 3, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown leaderboard period %q", period)
+}
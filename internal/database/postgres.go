@@ -1,23 +1,19 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"connect-four-backend/internal/models"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-// PostgresDB provides legacy database operations (deprecated - use Repository instead)
-// This is kept for backward compatibility
-type PostgresDB struct {
-	db *sql.DB
-}
-
-// Legacy types for backward compatibility
+// LeaderboardEntry is a player's row on a leaderboard
 type LeaderboardEntry struct {
 	Rank                    int        `json:"rank"`
 	Username                string     `json:"username"`
@@ -41,8 +37,10 @@ type LeaderboardEntry struct {
 	LongestWinStreak        int        `json:"longest_win_streak"`
 	FirstGameAt             *time.Time `json:"first_game_at,omitempty"`
 	LastGameAt              *time.Time `json:"last_game_at,omitempty"`
+	Rating                  float64    `json:"rating,omitempty"`
 }
 
+// PlayerStats are a player's results over the games table
 type PlayerStats struct {
 	PlayerName          string  `json:"player_name"`
 	TotalGames          int     `json:"total_games"`
@@ -51,194 +49,823 @@ type PlayerStats struct {
 	Draws               int     `json:"draws"`
 	WinRate             float64 `json:"win_rate"`
 	AverageGameDuration float64 `json:"average_game_duration"`
+	Rating              float64 `json:"rating,omitempty"`
+}
+
+// GetLeaderboard returns the page of a leaderboard the query picks, read from
+// the tables the games triggers keep up to date
+func (r *Repository) GetLeaderboard(query LeaderboardQuery) ([]LeaderboardEntry, error) {
+	return r.readLeaderboard(query, "")
+}
+
+// GetLeaderboardAround returns the query's limit of a leaderboard's rows
+// starting half of them above the player, none when the player isn't on it
+func (r *Repository) GetLeaderboardAround(query LeaderboardQuery, playerName string) ([]LeaderboardEntry, error) {
+	return r.readLeaderboard(query, playerName)
 }
 
-// NewPostgresDB creates a new PostgresDB instance (deprecated - use NewRepository instead)
-func NewPostgresDB(databaseURL string) (*PostgresDB, error) {
-	db, err := sql.Open("postgres", databaseURL)
+func (r *Repository) readLeaderboard(query LeaderboardQuery, player string) ([]LeaderboardEntry, error) {
+	ranked, args, err := leaderboardSource(query)
+	if err != nil {
+		return nil, err
+	}
+	statement, args := rankedLeaderboard(postgresHistory, ranked, args, query, player)
+
+	var leaderboard []LeaderboardEntry
+	err = r.read(func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, statement, args...)
+		if err != nil {
+			return fmt.Errorf("failed to query leaderboard: %w", err)
+		}
+		defer rows.Close()
+
+		leaderboard = nil
+		for rows.Next() {
+			entry, err := scanLeaderboardEntry(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan leaderboard entry: %w", err)
+			}
+			leaderboard = append(leaderboard, entry)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating leaderboard rows: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
+	}
+
+	return leaderboard, nil
+}
+
+// leaderboardSource returns the query of every row of the query's leaderboard,
+// ranked. Names break ties, so pages don't overlap.
+func leaderboardSource(query LeaderboardQuery) (string, []interface{}, error) {
+	if err := query.check(); err != nil {
+		return "", nil, err
 	}
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	if query.Sort == LeaderboardSortRating {
+		return `
+			SELECT
+				pr.player_name AS username, COALESCE(l.total_games, 0), COALESCE(l.wins, 0), COALESCE(l.losses, 0), COALESCE(l.draws, 0),
+				COALESCE(l.win_rate, 0), COALESCE(l.average_game_duration, 0), COALESCE(l.total_playtime_seconds, 0),
+				COALESCE(l.horizontal_wins, 0), COALESCE(l.vertical_wins, 0), COALESCE(l.diagonal_wins, 0), COALESCE(l.forfeit_wins, 0),
+				COALESCE(l.wins_vs_humans, 0), COALESCE(l.wins_vs_bots, 0), COALESCE(l.losses_vs_humans, 0), COALESCE(l.losses_vs_bots, 0),
+				COALESCE(l.current_win_streak, 0), COALESCE(l.longest_win_streak, 0), l.first_game_at, l.last_game_at,
+				pr.rating,
+				ROW_NUMBER() OVER (ORDER BY pr.rating DESC, pr.player_name) AS leaderboard_rank
+			FROM player_ratings pr
+			LEFT JOIN leaderboard l ON l.username = pr.player_name
+		`, nil, nil
 	}
 
-	pgDB := &PostgresDB{db: db}
-	if err := pgDB.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	if query.Period == "" {
+		return `
+			SELECT
+				l.username, l.total_games, l.wins, l.losses, l.draws, l.win_rate,
+				l.average_game_duration, l.total_playtime_seconds,
+				l.horizontal_wins, l.vertical_wins, l.diagonal_wins, l.forfeit_wins,
+				l.wins_vs_humans, l.wins_vs_bots, l.losses_vs_humans, l.losses_vs_bots,
+				l.current_win_streak, l.longest_win_streak, l.first_game_at, l.last_game_at,
+				COALESCE(pr.rating, 0) as rating,
+				ROW_NUMBER() OVER (ORDER BY l.win_rate DESC, l.wins DESC, l.total_games DESC, l.username) AS leaderboard_rank
+			FROM leaderboard l
+			LEFT JOIN player_ratings pr ON pr.player_name = l.username
+			WHERE l.total_games > 0
+		`, nil, nil
 	}
 
-	return pgDB, nil
+	// A period's rows leave out streaks
+	start, _, err := query.period()
+	if err != nil {
+		return "", nil, err
+	}
+	return `
+		SELECT
+			l.username, l.total_games, l.wins, l.losses, l.draws,
+			ROUND(l.wins * 100.0 / l.total_games, 2) AS win_rate,
+			ROUND(l.total_playtime_seconds::numeric / l.total_games, 2), l.total_playtime_seconds,
+			l.horizontal_wins, l.vertical_wins, l.diagonal_wins, l.forfeit_wins,
+			l.wins_vs_humans, l.wins_vs_bots, l.losses_vs_humans, l.losses_vs_bots,
+			0, 0, l.first_game_at, l.last_game_at,
+			COALESCE(pr.rating, 0),
+			ROW_NUMBER() OVER (ORDER BY l.wins * 1.0 / l.total_games DESC, l.wins DESC, l.total_games DESC, l.username) AS leaderboard_rank
+		FROM leaderboard_periods l
+		LEFT JOIN player_ratings pr ON pr.player_name = l.username
+		WHERE l.period = $1 AND l.period_start = $2 AND l.total_games > 0
+	`, []interface{}{query.Period, start.Format("2006-01-02")}, nil
+}
+
+// scanLeaderboardEntry scans a row of the columns leaderboardSource selects
+func scanLeaderboardEntry(row rowScanner) (LeaderboardEntry, error) {
+	var entry LeaderboardEntry
+	err := row.Scan(
+		&entry.Username, &entry.TotalGames, &entry.Wins, &entry.Losses, &entry.Draws, &entry.WinRate,
+		&entry.AverageGameDuration, &entry.TotalPlaytimeSeconds,
+		&entry.HorizontalWins, &entry.VerticalWins, &entry.DiagonalWins, &entry.ForfeitWins,
+		&entry.WinsVsHumans, &entry.WinsVsBots, &entry.LossesVsHumans, &entry.LossesVsBots,
+		&entry.CurrentWinStreak, &entry.LongestWinStreak, &entry.FirstGameAt, &entry.LastGameAt,
+		&entry.Rating, &entry.Rank,
+	)
+	entry.PlayerName = entry.Username
+	return entry, err
 }
 
-func (p *PostgresDB) Close() error {
-	return p.db.Close()
+// RefreshLeaderboard rebuilds the leaderboard and leaderboard_periods tables
+// from the games table, catching them up with changes the triggers don't see,
+// like guest games merged into an account
+func (r *Repository) RefreshLeaderboard() error {
+	// The rebuild reads every game, so it isn't bounded by the query timeout
+	query := `SELECT recalculate_leaderboard_stats(), recalculate_leaderboard_periods()`
+	if _, err := r.db.ExecContext(context.Background(), query); err != nil {
+		return fmt.Errorf("failed to refresh leaderboard: %w", err)
+	}
+	return nil
 }
 
-// createTables creates basic tables (simplified version)
-func (p *PostgresDB) createTables() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS games (
-			id UUID PRIMARY KEY,
-			player1_id UUID NOT NULL,
-			player1_name VARCHAR(255) NOT NULL,
-			player2_id UUID NOT NULL,
-			player2_name VARCHAR(255) NOT NULL,
-			winner_id UUID,
-			is_draw BOOLEAN DEFAULT FALSE,
-			duration_seconds INTEGER NOT NULL,
-			total_moves INTEGER NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			finished_at TIMESTAMP WITH TIME ZONE NOT NULL
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_games_player1 ON games(player1_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_games_player2 ON games(player2_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_games_winner ON games(winner_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_games_created_at ON games(created_at)`,
+// GetPlayerStats retrieves player statistics (simplified version)
+func (r *Repository) GetPlayerStats(playerName string) (*PlayerStats, error) {
+	query := `
+		WITH player_games AS (
+			SELECT 
+				CASE WHEN winner_id = player1_id THEN player1_name
+					 WHEN winner_id = player2_id THEN player2_name
+					 ELSE NULL END as winner_name,
+				is_draw,
+				duration_seconds
+			FROM games
+			WHERE player1_name = $1 OR player2_name = $1
+		)
+		SELECT 
+			COUNT(*) as total_games,
+			SUM(CASE WHEN winner_name = $1 THEN 1 ELSE 0 END) as wins,
+			SUM(CASE WHEN winner_name != $1 AND NOT is_draw THEN 1 ELSE 0 END) as losses,
+			SUM(CASE WHEN is_draw THEN 1 ELSE 0 END) as draws,
+			CASE WHEN COUNT(*) > 0 THEN ROUND((SUM(CASE WHEN winner_name = $1 THEN 1 ELSE 0 END)::float / COUNT(*)::float) * 100, 2) ELSE 0 END as win_rate,
+			CASE WHEN COUNT(*) > 0 THEN ROUND(AVG(duration_seconds), 2) ELSE 0 END as avg_duration,
+			COALESCE((SELECT rating FROM player_ratings WHERE player_name = $1), 0) as rating
+		FROM player_games
+	`
+
+	var stats PlayerStats
+	stats.PlayerName = playerName
+
+	err := r.read(func(ctx context.Context, db *sql.DB) error {
+		return db.QueryRowContext(ctx, query, playerName).Scan(
+			&stats.TotalGames,
+			&stats.Wins,
+			&stats.Losses,
+			&stats.Draws,
+			&stats.WinRate,
+			&stats.AverageGameDuration,
+			&stats.Rating,
+		)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("player not found: %s", playerName)
+		}
+		return nil, fmt.Errorf("failed to get player stats: %w", err)
 	}
 
-	for _, query := range queries {
-		if _, err := p.db.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query: %w", err)
+	return &stats, nil
+}
+
+// GetPlayerRating retrieves a player's rating, returning nil if the player is unrated
+func (r *Repository) GetPlayerRating(playerName string) (*models.PlayerRating, error) {
+	query := `
+		SELECT player_name, rating, peak_rating, games_played, updated_at
+		FROM player_ratings
+		WHERE player_name = $1
+	`
+
+	var rating models.PlayerRating
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, playerName).Scan(
+		&rating.PlayerName,
+		&rating.Rating,
+		&rating.PeakRating,
+		&rating.GamesPlayed,
+		&rating.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("failed to get player rating: %w", err)
+	}
+
+	return &rating, nil
+}
+
+// SavePlayerRating inserts or updates a player's rating
+func (r *Repository) SavePlayerRating(rating *models.PlayerRating) error {
+	return r.savePlayerRating(r.db, rating)
+}
+
+func (r *Repository) savePlayerRating(q execer, rating *models.PlayerRating) error {
+	query := `
+		INSERT INTO player_ratings (player_name, rating, peak_rating, games_played, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (player_name) DO UPDATE SET
+			rating = EXCLUDED.rating,
+			peak_rating = EXCLUDED.peak_rating,
+			games_played = EXCLUDED.games_played,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.exec(q, query,
+		rating.PlayerName,
+		rating.Rating,
+		rating.PeakRating,
+		rating.GamesPlayed,
+		rating.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save player rating: %w", err)
 	}
 
 	return nil
 }
 
-// SaveGameResult saves a game result (simplified version)
-func (p *PostgresDB) SaveGameResult(result *models.GameResult) error {
+// GetQueuePenalty retrieves a player's queue penalty, returning nil if the player has none
+func (r *Repository) GetQueuePenalty(playerName string) (*models.QueuePenalty, error) {
 	query := `
-		INSERT INTO games (id, player1_id, player1_name, player2_id, player2_name, winner_id, is_draw, duration_seconds, total_moves, created_at, finished_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		SELECT player_name, offenses, last_offense_at, banned_until
+		FROM queue_penalties
+		WHERE player_name = $1
+	`
+
+	var penalty models.QueuePenalty
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, playerName).Scan(
+		&penalty.PlayerName,
+		&penalty.Offenses,
+		&penalty.LastOffenseAt,
+		&penalty.BannedUntil,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get queue penalty: %w", err)
+	}
+
+	return &penalty, nil
+}
+
+// SaveQueuePenalty inserts or updates a player's queue penalty
+func (r *Repository) SaveQueuePenalty(penalty *models.QueuePenalty) error {
+	query := `
+		INSERT INTO queue_penalties (player_name, offenses, last_offense_at, banned_until)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (player_name) DO UPDATE SET
+			offenses = EXCLUDED.offenses,
+			last_offense_at = EXCLUDED.last_offense_at,
+			banned_until = EXCLUDED.banned_until
 	`
 
-	// Note: This is a simplified version for backward compatibility
-	// For full functionality, use the Repository instead
-	_, err := p.db.Exec(query,
-		result.GameID,
-		uuid.New(), // placeholder - you'd get this from the game
-		"Player1",  // placeholder - you'd get this from the game
-		uuid.New(), // placeholder - you'd get this from the game
-		"Player2",  // placeholder - you'd get this from the game
-		result.WinnerID,
-		result.IsDraw,
-		result.Duration,
-		result.TotalMoves,
-		result.CreatedAt,
-		time.Now(),
+	_, err := r.exec(r.db, query,
+		penalty.PlayerName,
+		penalty.Offenses,
+		penalty.LastOffenseAt,
+		penalty.BannedUntil,
 	)
 
 	if err != nil {
-		return fmt.Errorf("failed to save game result: %w", err)
+		return fmt.Errorf("failed to save queue penalty: %w", err)
 	}
 
 	return nil
 }
 
-// GetLeaderboard retrieves leaderboard (simplified version)
-func (p *PostgresDB) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
+// SaveQueueSnapshot replaces the saved matchmaking queue
+func (r *Repository) SaveQueueSnapshot(players []*models.QueuedPlayer) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin queue snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := r.exec(tx, `DELETE FROM queue_snapshot`); err != nil {
+		return fmt.Errorf("failed to clear queue snapshot: %w", err)
+	}
+
 	query := `
-		WITH player_stats AS (
-			SELECT 
-				player_name,
-				COUNT(*) as total_games,
-				SUM(CASE WHEN winner_name = player_name THEN 1 ELSE 0 END) as wins,
-				SUM(CASE WHEN winner_name != player_name AND NOT is_draw THEN 1 ELSE 0 END) as losses,
-				SUM(CASE WHEN is_draw THEN 1 ELSE 0 END) as draws
-			FROM (
-				SELECT player1_name as player_name, 
-					   CASE WHEN winner_id = player1_id THEN player1_name
-							WHEN winner_id = player2_id THEN player2_name
-							ELSE NULL END as winner_name,
-					   is_draw
-				FROM games
-				UNION ALL
-				SELECT player2_name as player_name,
-					   CASE WHEN winner_id = player1_id THEN player1_name
-							WHEN winner_id = player2_id THEN player2_name
-							ELSE NULL END as winner_name,
-					   is_draw
-				FROM games
-			) all_games
-			GROUP BY player_name
+		INSERT INTO queue_snapshot (player_id, player_name, joined_at, queue_type, party_id,
+			allow_bots, skill_level, max_wait_time, rating, priority)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	for _, player := range players {
+		_, err := r.exec(tx, query,
+			player.PlayerID,
+			player.PlayerName,
+			player.JoinedAt,
+			string(player.QueueType),
+			player.PartyID,
+			player.AllowBots,
+			player.SkillLevel,
+			player.MaxWaitTime,
+			player.Rating,
+			player.Priority,
 		)
-		SELECT 
-			player_name,
-			wins,
-			losses,
-			draws,
-			CASE WHEN total_games > 0 THEN ROUND((wins::numeric / total_games::numeric) * 100, 2) ELSE 0 END as win_rate
-		FROM player_stats
-		WHERE total_games >= 1  -- Only show players with at least 1 game
-		ORDER BY win_rate DESC, wins DESC
-		LIMIT $1
+		if err != nil {
+			return fmt.Errorf("failed to save queued player %s: %w", player.PlayerName, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit queue snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// LoadQueueSnapshot returns the saved matchmaking queue and clears it so it is only restored once
+func (r *Repository) LoadQueueSnapshot() ([]*models.QueuedPlayer, error) {
+	query := `
+		DELETE FROM queue_snapshot
+		RETURNING player_id, player_name, joined_at, queue_type, party_id,
+			allow_bots, skill_level, max_wait_time, rating, priority
 	`
 
-	rows, err := p.db.Query(query, limit)
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query leaderboard: %w", err)
+		return nil, fmt.Errorf("failed to load queue snapshot: %w", err)
 	}
 	defer rows.Close()
 
-	var leaderboard []LeaderboardEntry
+	var players []*models.QueuedPlayer
 	for rows.Next() {
-		var entry LeaderboardEntry
-		if err := rows.Scan(&entry.PlayerName, &entry.Wins, &entry.Losses, &entry.Draws, &entry.WinRate); err != nil {
-			return nil, fmt.Errorf("failed to scan leaderboard entry: %w", err)
+		var player models.QueuedPlayer
+		var queueType string
+		err := rows.Scan(
+			&player.PlayerID,
+			&player.PlayerName,
+			&player.JoinedAt,
+			&queueType,
+			&player.PartyID,
+			&player.AllowBots,
+			&player.SkillLevel,
+			&player.MaxWaitTime,
+			&player.Rating,
+			&player.Priority,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan queued player: %w", err)
 		}
-		leaderboard = append(leaderboard, entry)
+		player.QueueType = models.QueueType(queueType)
+		players = append(players, &player)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating leaderboard rows: %w", err)
+		return nil, fmt.Errorf("error iterating queue snapshot rows: %w", err)
 	}
 
-	return leaderboard, nil
+	return players, nil
 }
 
-// GetPlayerStats retrieves player statistics (simplified version)
-func (p *PostgresDB) GetPlayerStats(playerName string) (*PlayerStats, error) {
+// SaveGameSnapshot replaces the saved in-progress games
+func (r *Repository) SaveGameSnapshot(games []*models.Game) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin game snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := r.exec(tx, `DELETE FROM game_snapshot`); err != nil {
+		return fmt.Errorf("failed to clear game snapshot: %w", err)
+	}
+
+	for _, game := range games {
+		data, err := json.Marshal(game)
+		if err != nil {
+			return fmt.Errorf("failed to encode game %s: %w", game.ID, err)
+		}
+
+		if _, err := r.exec(tx, `INSERT INTO game_snapshot (game_id, game) VALUES ($1, $2)`, game.ID, data); err != nil {
+			return fmt.Errorf("failed to save game %s: %w", game.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit game snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// LoadGameSnapshot returns the saved in-progress games and clears them so they are only restored once
+func (r *Repository) LoadGameSnapshot() ([]*models.Game, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `DELETE FROM game_snapshot RETURNING game`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load game snapshot: %w", err)
+	}
+	defer rows.Close()
+
+	var games []*models.Game
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan saved game: %w", err)
+		}
+
+		var game models.Game
+		if err := json.Unmarshal(data, &game); err != nil {
+			return nil, fmt.Errorf("failed to decode saved game: %w", err)
+		}
+		games = append(games, &game)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating game snapshot rows: %w", err)
+	}
+
+	return games, nil
+}
+
+// SaveFinishedGame keeps a finished game with its move history, replays are
+// generated from it. Its moves are also saved a row each in game_moves, for
+// move-level queries.
+func (r *Repository) SaveFinishedGame(game *models.Game) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin finished game %s: %w", game.ID, err)
+	}
+	defer tx.Rollback()
+
+	if err := r.saveFinishedGame(tx, game); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit finished game %s: %w", game.ID, err)
+	}
+
+	return nil
+}
+
+// saveFinishedGame saves the game to game_history and its moves to game_moves
+// in the transaction
+func (r *Repository) saveFinishedGame(tx *sql.Tx, game *models.Game) error {
+	if game.FinishedAt == nil {
+		return fmt.Errorf("game %s is not finished", game.ID)
+	}
+
+	data, err := json.Marshal(game)
+	if err != nil {
+		return fmt.Errorf("failed to encode game %s: %w", game.ID, err)
+	}
+
+	columns := newHistoryColumns(game)
 	query := `
-		WITH player_games AS (
-			SELECT 
-				CASE WHEN winner_id = player1_id THEN player1_name
-					 WHEN winner_id = player2_id THEN player2_name
-					 ELSE NULL END as winner_name,
-				is_draw,
-				duration_seconds
-			FROM games
-			WHERE player1_name = $1 OR player2_name = $1
-		)
-		SELECT 
-			COUNT(*) as total_games,
-			SUM(CASE WHEN winner_name = $1 THEN 1 ELSE 0 END) as wins,
-			SUM(CASE WHEN winner_name != $1 AND NOT is_draw THEN 1 ELSE 0 END) as losses,
-			SUM(CASE WHEN is_draw THEN 1 ELSE 0 END) as draws,
-			CASE WHEN COUNT(*) > 0 THEN ROUND((SUM(CASE WHEN winner_name = $1 THEN 1 ELSE 0 END)::float / COUNT(*)::float) * 100, 2) ELSE 0 END as win_rate,
-			CASE WHEN COUNT(*) > 0 THEN ROUND(AVG(duration_seconds), 2) ELSE 0 END as avg_duration
-		FROM player_games
+		INSERT INTO game_history (game_id, game, finished_at, player_names, winner_names, is_draw, win_type,
+			has_bot, total_moves, duration_seconds, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (game_id) DO UPDATE SET game = EXCLUDED.game, finished_at = EXCLUDED.finished_at,
+			player_names = EXCLUDED.player_names, winner_names = EXCLUDED.winner_names,
+			is_draw = EXCLUDED.is_draw, win_type = EXCLUDED.win_type, has_bot = EXCLUDED.has_bot,
+			total_moves = EXCLUDED.total_moves, duration_seconds = EXCLUDED.duration_seconds,
+			started_at = EXCLUDED.started_at
 	`
+	_, err = r.exec(tx, query, game.ID, data, *game.FinishedAt, pq.Array(columns.playerNames), pq.Array(columns.winnerNames),
+		columns.isDraw, columns.winType, columns.hasBot, columns.totalMoves, columns.duration, columns.startedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save finished game %s: %w", game.ID, err)
+	}
+	return r.saveGameMoves(tx, game)
+}
 
-	var stats PlayerStats
-	stats.PlayerName = playerName
+// GetFinishedGame returns a finished game with its move history, or nil if it isn't kept
+func (r *Repository) GetFinishedGame(gameID uuid.UUID) (*models.Game, error) {
+	var data []byte
+
+	err := r.read(func(ctx context.Context, db *sql.DB) error {
+		return db.QueryRowContext(ctx, `SELECT game FROM game_history WHERE game_id = $1`, gameID).Scan(&data)
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get finished game %s: %w", gameID, err)
+	}
 
-	err := p.db.QueryRow(query, playerName).Scan(
-		&stats.TotalGames,
-		&stats.Wins,
-		&stats.Losses,
-		&stats.Draws,
-		&stats.WinRate,
-		&stats.AverageGameDuration,
+	var game models.Game
+	if err := json.Unmarshal(data, &game); err != nil {
+		return nil, fmt.Errorf("failed to decode finished game %s: %w", gameID, err)
+	}
+
+	return &game, nil
+}
+
+// CreateWebhook stores a registered webhook
+func (r *Repository) CreateWebhook(webhook *models.Webhook) error {
+	query := `
+		INSERT INTO webhooks (id, url, events, secret, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := r.exec(r.db, query, webhook.ID, webhook.URL, pq.Array(webhook.Events), webhook.Secret, webhook.CreatedAt); err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return nil
+}
+
+// ListWebhooks returns every registered webhook, secrets included
+func (r *Repository) ListWebhooks() ([]*models.Webhook, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, url, events, secret, created_at FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Secret, &webhook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook and reports whether it existed
+func (r *Repository) DeleteWebhook(webhookID uuid.UUID) (bool, error) {
+	result, err := r.exec(r.db, `DELETE FROM webhooks WHERE id = $1`, webhookID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete webhook %s: %w", webhookID, err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return deleted > 0, nil
+}
+
+// SaveWebhookDeadLetter records a delivery that ran out of attempts
+func (r *Repository) SaveWebhookDeadLetter(letter *models.WebhookDeadLetter) error {
+	query := `
+		INSERT INTO webhook_dead_letters (id, webhook_id, url, event, payload, attempts, last_error, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.exec(r.db, query,
+		letter.ID,
+		letter.WebhookID,
+		letter.URL,
+		letter.Event,
+		[]byte(letter.Payload),
+		letter.Attempts,
+		letter.LastError,
+		letter.FailedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save webhook dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// ListWebhookDeadLetters returns the most recent failed deliveries
+func (r *Repository) ListWebhookDeadLetters(limit int) ([]*models.WebhookDeadLetter, error) {
+	query := `
+		SELECT id, webhook_id, url, event, payload, attempts, last_error, failed_at
+		FROM webhook_dead_letters
+		ORDER BY failed_at DESC
+		LIMIT $1
+	`
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []*models.WebhookDeadLetter
+	for rows.Next() {
+		var letter models.WebhookDeadLetter
+		var payload []byte
+		if err := rows.Scan(&letter.ID, &letter.WebhookID, &letter.URL, &letter.Event, &payload, &letter.Attempts, &letter.LastError, &letter.FailedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook dead letter: %w", err)
+		}
+		letter.Payload = payload
+		letters = append(letters, &letter)
+	}
+
+	return letters, rows.Err()
+}
+
+// CreateAccount inserts a new account
+func (r *Repository) CreateAccount(account *models.Account) error {
+	query := `
+		INSERT INTO accounts (id, username, password_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err := r.exec(r.db, query,
+		account.ID,
+		account.Username,
+		account.PasswordHash,
+		account.CreatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create account: %w", err)
+	}
+
+	return nil
+}
+
+// GetAccount retrieves an account by ID, returning nil if it doesn't exist
+func (r *Repository) GetAccount(accountID uuid.UUID) (*models.Account, error) {
+	query := `
+		SELECT id, username, password_hash, created_at, last_login_at
+		FROM accounts
+		WHERE id = $1
+	`
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return scanAccount(r.db.QueryRowContext(ctx, query, accountID))
+}
+
+// GetAccountByUsername retrieves an account by username regardless of case,
+// returning nil if it doesn't exist
+func (r *Repository) GetAccountByUsername(username string) (*models.Account, error) {
+	query := `
+		SELECT id, username, password_hash, created_at, last_login_at
+		FROM accounts
+		WHERE LOWER(username) = LOWER($1)
+	`
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return scanAccount(r.db.QueryRowContext(ctx, query, username))
+}
+
+// UpdateAccountLogin records when the account last logged in
+func (r *Repository) UpdateAccountLogin(accountID uuid.UUID, loginAt time.Time) error {
+	query := `UPDATE accounts SET last_login_at = $2 WHERE id = $1`
+
+	if _, err := r.exec(r.db, query, accountID, loginAt); err != nil {
+		return fmt.Errorf("failed to update account login: %w", err)
+	}
+
+	return nil
+}
+
+// scanAccount scans an account row, nil if there is none
+func scanAccount(row *sql.Row) (*models.Account, error) {
+	var account models.Account
+	err := row.Scan(
+		&account.ID,
+		&account.Username,
+		&account.PasswordHash,
+		&account.CreatedAt,
+		&account.LastLoginAt,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("player not found: %s", playerName)
+			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to get player stats: %w", err)
+		return nil, fmt.Errorf("failed to get account: %w", err)
 	}
 
-	return &stats, nil
-}
\ No newline at end of file
+	return &account, nil
+}
+
+// MergeGuestPlayer moves a guest player's games to the account in a single
+// transaction. The guest's rating is carried over only when the account has
+// none of its own, an established account rating is never overwritten.
+func (r *Repository) MergeGuestPlayer(guestID uuid.UUID, account *models.Account) (*models.GuestClaim, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin guest merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	claim := &models.GuestClaim{GuestID: guestID, GuestNames: []string{}}
+
+	// Bounds the reads, each update gets its own timeout
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT player1_name FROM games WHERE player1_id = $1
+		UNION
+		SELECT player2_name FROM games WHERE player2_id = $1
+	`, guestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query guest names: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan guest name: %w", err)
+		}
+		if name != account.Username {
+			claim.GuestNames = append(claim.GuestNames, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read guest names: %w", err)
+	}
+
+	for _, column := range []string{"player1", "player2"} {
+		result, err := r.exec(tx, fmt.Sprintf(
+			`UPDATE games SET %[1]s_id = $1, %[1]s_name = $2 WHERE %[1]s_id = $3`, column),
+			account.ID, account.Username, guestID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move guest games: %w", err)
+		}
+		moved, _ := result.RowsAffected()
+		claim.GamesClaimed += int(moved)
+	}
+
+	if _, err := r.exec(tx, `UPDATE games SET winner_id = $1 WHERE winner_id = $2`, account.ID, guestID); err != nil {
+		return nil, fmt.Errorf("failed to move guest wins: %w", err)
+	}
+
+	var accountRated bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM player_ratings WHERE player_name = $1)`, account.Username).Scan(&accountRated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check account rating: %w", err)
+	}
+
+	if !accountRated {
+		// Carry over the rating of the name the guest played most rated games under
+		var guestRating *models.PlayerRating
+		for _, name := range claim.GuestNames {
+			var rating models.PlayerRating
+			err := tx.QueryRowContext(ctx, `
+				SELECT player_name, rating, peak_rating, games_played, updated_at
+				FROM player_ratings
+				WHERE player_name = $1
+			`, name).Scan(
+				&rating.PlayerName,
+				&rating.Rating,
+				&rating.PeakRating,
+				&rating.GamesPlayed,
+				&rating.UpdatedAt,
+			)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get guest rating: %w", err)
+			}
+			if guestRating == nil || rating.GamesPlayed > guestRating.GamesPlayed {
+				guestRating = &rating
+			}
+		}
+
+		if guestRating != nil {
+			_, err := r.exec(tx, `UPDATE player_ratings SET player_name = $1 WHERE player_name = $2`, account.Username, guestRating.PlayerName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transfer guest rating: %w", err)
+			}
+			_, err = r.exec(tx, `UPDATE rating_history SET player_name = $1 WHERE player_name = $2`, account.Username, guestRating.PlayerName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transfer guest rating history: %w", err)
+			}
+			claim.RatingTransferred = true
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit guest merge: %w", err)
+	}
+
+	return claim, nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RatingHistoryPoint is a rating a player had from when it was recorded until
+// the next one
+type RatingHistoryPoint struct {
+	Rating      float64   `json:"rating"`
+	GamesPlayed int       `json:"games_played"`
+	RecordedAt  time.Time `json:"recorded_at"`
+}
+
+// OpeningColumns counts a player's games by the column of their first move
+type OpeningColumns [7]int
+
+// Favorite returns the column the player opened in most, the lowest of those
+// tied, and false before their first move
+func (o OpeningColumns) Favorite() (int, bool) {
+	favorite := 0
+	for column, games := range o {
+		if games > o[favorite] {
+			favorite = column
+		}
+	}
+	return favorite, o[favorite] > 0
+}
+
+// GetRatingHistory returns a player's latest ratings, oldest first
+func (r *Repository) GetRatingHistory(playerName string, limit int) ([]RatingHistoryPoint, error) {
+	query := `
+		SELECT rating, games_played, recorded_at FROM (
+			SELECT id, rating, games_played, recorded_at FROM rating_history
+			WHERE player_name = $1
+			ORDER BY recorded_at DESC, id DESC
+			LIMIT $2
+		) latest
+		ORDER BY recorded_at, id
+	`
+
+	var history []RatingHistoryPoint
+	err := r.read(func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, query, playerName, limit)
+		if err != nil {
+			return fmt.Errorf("failed to query rating history: %w", err)
+		}
+		defer rows.Close()
+
+		history = []RatingHistoryPoint{}
+		for rows.Next() {
+			var point RatingHistoryPoint
+			if err := rows.Scan(&point.Rating, &point.GamesPlayed, &point.RecordedAt); err != nil {
+				return fmt.Errorf("failed to scan rating history: %w", err)
+			}
+			history = append(history, point)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating rating history rows: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// GetOpeningColumns counts the games in game_moves by the column the player
+// first played in
+func (r *Repository) GetOpeningColumns(playerName string) (OpeningColumns, error) {
+	query := `
+		SELECT column_played, COUNT(*) FROM (
+			SELECT DISTINCT ON (game_id) column_played FROM game_moves
+			WHERE player_name = $1
+			ORDER BY game_id, move_number
+		) openings
+		GROUP BY column_played
+	`
+
+	var openings OpeningColumns
+	err := r.read(func(ctx context.Context, db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, query, playerName)
+		if err != nil {
+			return fmt.Errorf("failed to query opening columns: %w", err)
+		}
+		defer rows.Close()
+
+		openings, err = scanOpeningColumns(rows)
+		return err
+	})
+	return openings, err
+}
+
+// scanOpeningColumns reads rows of a column and its count of games
+func scanOpeningColumns(rows *sql.Rows) (OpeningColumns, error) {
+	var openings OpeningColumns
+	for rows.Next() {
+		var column, games int
+		if err := rows.Scan(&column, &games); err != nil {
+			return openings, fmt.Errorf("failed to scan opening column: %w", err)
+		}
+		if column >= 0 && column < len(openings) {
+			openings[column] = games
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return openings, fmt.Errorf("error iterating opening column rows: %w", err)
+	}
+
+	return openings, nil
+}
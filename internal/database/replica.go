@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// replica is a read-only copy of the primary the leaderboard, stats and
+// history queries read from. When it can't be reached reads go to the
+// primary, and the replica is tried again after the retry interval.
+type replica struct {
+	db            *sql.DB
+	retryInterval time.Duration
+
+	mu        sync.Mutex
+	downUntil time.Time // zero while it is up
+}
+
+func openReplica(databaseURL string, config Config) (*replica, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open read replica: %w", err)
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	return &replica{db: db, retryInterval: config.ReplicaRetryInterval}, nil
+}
+
+// up reports whether reads should try the replica. Once the retry interval
+// has passed the next read tries it again.
+func (rep *replica) up() bool {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if rep.downUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(rep.downUntil) {
+		return false
+	}
+	rep.downUntil = time.Time{}
+	return true
+}
+
+// down sends reads to the primary for the retry interval
+func (rep *replica) down(err error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if rep.downUntil.IsZero() {
+		log.Printf("Read replica unavailable, reading from the primary for %s: %v", rep.retryInterval, err)
+	}
+	rep.downUntil = time.Now().Add(rep.retryInterval)
+}
+
+// read runs a query on the read replica, or on the primary without one or
+// while it is down. A query the replica couldn't answer runs again on the
+// primary. Each attempt gets its own query timeout.
+func (r *Repository) read(query func(ctx context.Context, db *sql.DB) error) error {
+	attempt := func(db *sql.DB) error {
+		ctx, cancel := r.queryContext()
+		defer cancel()
+		return query(ctx, db)
+	}
+
+	if r.replica == nil || !r.replica.up() {
+		return attempt(r.db)
+	}
+	err := attempt(r.replica.db)
+	if err == nil || !unavailable(err) {
+		return err
+	}
+	r.replica.down(err)
+	return attempt(r.db)
+}
+
+// unavailable reports whether the query failed because the database couldn't
+// be reached, rather than because of the query
+func unavailable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// connection_exception, or the server shutting down or starting up
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
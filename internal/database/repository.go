@@ -1,8 +1,10 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"connect-four-backend/internal/models"
 
@@ -10,20 +12,102 @@ import (
 	_ "github.com/lib/pq"
 )
 
-// Repository provides database operations
+// Repository provides database operations for the server and the analytics
+// consumer
 type Repository struct {
-	db *sql.DB
+	db      *sql.DB
+	replica *replica // nil to read from the primary
+	config  Config
 }
 
-// NewRepository creates a new repository
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+// NewRepository connects to the database and migrates it to the latest schema
+func NewRepository(databaseURL string, config Config) (*Repository, error) {
+	repo, err := OpenRepository(databaseURL, config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.MigrateUp(); err != nil {
+		repo.Close()
+		return nil, err
+	}
+	if err := repo.backfillGameHistory(); err != nil {
+		repo.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// OpenRepository connects to the database without migrating it
+func OpenRepository(databaseURL string, config Config) (*Repository, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	repo := &Repository{db: db, config: config}
+	if err := repo.HealthCheck(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// The replica isn't checked, reads fall back to the primary while it's down
+	if config.ReplicaURL != "" {
+		if repo.replica, err = openReplica(config.ReplicaURL, config); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// HealthCheck pings the database
+func (r *Repository) HealthCheck() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
+
+// execer runs statements on the pool or in a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
-// SaveCompletedGame saves a completed game to the database
+// queryContext bounds a query by the query timeout. Rows read with it must be
+// closed before it is cancelled.
+func (r *Repository) queryContext() (context.Context, context.CancelFunc) {
+	if r.config.QueryTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), r.config.QueryTimeout)
+}
+
+// exec runs a statement bounded by the query timeout, so each statement of a
+// transaction gets the whole timeout
+func (r *Repository) exec(q execer, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+	return q.ExecContext(ctx, query, args...)
+}
+
+// SaveCompletedGame saves a completed game to the games table, which keeps the
+// leaderboard table up to date. Saving it again does nothing.
 func (r *Repository) SaveCompletedGame(game *models.Game) error {
-	if game == nil || game.State != models.GameStateFinished {
-		return fmt.Errorf("invalid game state")
+	_, err := r.saveCompletedGame(r.db, game)
+	return err
+}
+
+// saveCompletedGame inserts the game into the games table, reporting whether
+// it wasn't there yet
+func (r *Repository) saveCompletedGame(q execer, game *models.Game) (bool, error) {
+	if game == nil || game.State != models.GameStateFinished || game.Players[0] == nil || game.Players[1] == nil {
+		return false, fmt.Errorf("invalid game state")
 	}
 
 	// Count moves on the board
@@ -51,6 +135,11 @@ func (r *Repository) SaveCompletedGame(game *models.Game) error {
 		}
 	}
 
+	var winType sql.NullString
+	if !isDraw {
+		winType = sql.NullString{String: game.WinType(), Valid: true}
+	}
+
 	duration := int(game.FinishedAt.Sub(game.CreatedAt).Seconds())
 
 	query := `
@@ -58,53 +147,78 @@ func (r *Repository) SaveCompletedGame(game *models.Game) error {
 			id, player1_id, player1_name, player1_is_bot,
 			player2_id, player2_name, player2_is_bot,
 			winner_id, winner_name, is_draw,
-			total_moves, duration_seconds,
+			total_moves, duration_seconds, win_type,
 			created_at, finished_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (id) DO NOTHING
 	`
 
-	_, err := r.db.Exec(query,
+	result, err := r.exec(q, query,
 		game.ID,
 		game.Players[0].ID, game.Players[0].Name, game.Players[0].IsBot,
 		game.Players[1].ID, game.Players[1].Name, game.Players[1].IsBot,
 		winnerID, winnerName, isDraw,
-		totalMoves, duration,
+		totalMoves, duration, winType,
 		game.CreatedAt, game.FinishedAt,
 	)
+	if err != nil {
+		return false, fmt.Errorf("failed to save completed game %s: %w", game.ID, err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to save completed game %s: %w", game.ID, err)
+	}
+	return inserted > 0, nil
+}
+
+// EventProcessed reports whether the analytics event was already processed
+func (r *Repository) EventProcessed(eventID string) (bool, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
 
+	var processed bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM processed_events WHERE event_id = $1)`, eventID).Scan(&processed)
+	return processed, err
+}
+
+// MarkEventProcessed records the analytics event as processed, marking it again does nothing
+func (r *Repository) MarkEventProcessed(eventID, eventType string, processedAt time.Time) error {
+	_, err := r.exec(r.db, `
+		INSERT INTO processed_events (event_id, event_type, processed_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (event_id) DO NOTHING
+	`, eventID, eventType, processedAt)
 	return err
 }
 
-// GetLeaderboard returns the current leaderboard
-func (r *Repository) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
-	query := `SELECT * FROM leaderboard ORDER BY wins DESC, win_rate DESC LIMIT $1`
-	
-	rows, err := r.db.Query(query, limit)
+// DeleteProcessedEventsBefore forgets events processed before the cutoff
+func (r *Repository) DeleteProcessedEventsBefore(cutoff time.Time) (int64, error) {
+	result, err := r.exec(r.db, `DELETE FROM processed_events WHERE processed_at < $1`, cutoff)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var entries []LeaderboardEntry
-	for rows.Next() {
-		var entry LeaderboardEntry
-		err := rows.Scan(
-			&entry.Rank, &entry.Username, &entry.PlayerName,
-			&entry.TotalGames, &entry.Wins, &entry.Losses, &entry.Draws,
-			&entry.WinRate, &entry.AverageGameDuration, &entry.TotalPlaytimeSeconds,
-			&entry.HorizontalWins, &entry.VerticalWins, &entry.DiagonalWins,
-			&entry.LastGameAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		entries = append(entries, entry)
+		return 0, err
 	}
+	return result.RowsAffected()
+}
 
-	return entries, nil
+// DeleteProcessedEventsAfter forgets events processed after the cutoff
+func (r *Repository) DeleteProcessedEventsAfter(cutoff time.Time) (int64, error) {
+	result, err := r.exec(r.db, `DELETE FROM processed_events WHERE processed_at > $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-// Close closes the database connection
+// Close closes the database connection, and the read replica's
 func (r *Repository) Close() error {
+	if r.replica != nil {
+		r.replica.db.Close()
+	}
 	return r.db.Close()
-}
\ No newline at end of file
+}
+
+// Stats returns the connection pool's statistics
+func (r *Repository) Stats() sql.DBStats {
+	return r.db.Stats()
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Serializable transactions aborted for conflicting with another are run
+// again this many times in all, waiting serializationBackoff before the first
+// retry and twice as long before each one after
+const (
+	serializableAttempts = 5
+	serializationBackoff = 20 * time.Millisecond
+)
+
+// SaveGameResult saves a finished game, its result the leaderboard triggers
+// count and the ratings it changed in one serializable transaction, so a
+// crash or a conflicting game never leaves standings that disagree with the
+// games. Saving the game again keeps it once and leaves the ratings alone,
+// later games may have changed them since.
+func (r *Repository) SaveGameResult(game *models.Game, ratings []*models.PlayerRating) error {
+	for attempt := 1; ; attempt++ {
+		err := r.saveGameResult(game, ratings)
+		if err == nil || !isSerializationFailure(err) || attempt >= serializableAttempts {
+			return err
+		}
+		time.Sleep(serializationBackoff << (attempt - 1))
+	}
+}
+
+func (r *Repository) saveGameResult(game *models.Game, ratings []*models.PlayerRating) error {
+	tx, err := r.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin result of game %s: %w", game.ID, err)
+	}
+	defer tx.Rollback()
+
+	if err := r.saveFinishedGame(tx, game); err != nil {
+		return err
+	}
+	saved, err := r.saveCompletedGame(tx, game)
+	if err != nil {
+		return err
+	}
+	if saved {
+		for _, rating := range ratings {
+			if err := r.savePlayerRating(tx, rating); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit result of game %s: %w", game.ID, err)
+	}
+	return nil
+}
+
+// isSerializationFailure reports whether Postgres aborted the transaction for
+// conflicting with a concurrent one, which running it again resolves
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01" // serialization_failure, deadlock_detected
+}
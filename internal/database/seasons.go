@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"connect-four-backend/internal/models"
+)
+
+// bindArgs writes the ? placeholders of a statement in the backend's dialect
+func bindArgs(dialect historyDialect, query string) string {
+	var bound strings.Builder
+	for n, part := range strings.Split(query, "?") {
+		if n > 0 {
+			bound.WriteString(dialect.placeholder(n))
+		}
+		bound.WriteString(part)
+	}
+	return bound.String()
+}
+
+// GetCurrentSeason returns the season being played, nil when there is none
+func (r *Repository) GetCurrentSeason() (*models.Season, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return getCurrentSeason(ctx, r.db)
+}
+
+// ListSeasons returns every season, the latest first
+func (r *Repository) ListSeasons() ([]*models.Season, error) {
+	var seasons []*models.Season
+	err := r.read(func(ctx context.Context, db *sql.DB) (err error) {
+		seasons, err = listSeasons(ctx, db)
+		return err
+	})
+	return seasons, err
+}
+
+// StartSeason adds a season, returning false when another is running or one
+// with its number exists, as when another server started it first
+func (r *Repository) StartSeason(season *models.Season) (bool, error) {
+	return startSeason(r.db, postgresHistory, r.exec, season)
+}
+
+// EndSeason ends a season and starts the next in one transaction: the players
+// who played rated games in it are ranked by rating, given the best reward
+// they earned and kept in season_standings, then every rating is reset.
+// It returns false, changing nothing, when the season has already ended.
+func (r *Repository) EndSeason(ended, next *models.Season, rewards []models.SeasonReward, reset models.RatingReset) (bool, error) {
+	return endSeason(r.db, postgresHistory, r.exec, ended, next, rewards, reset)
+}
+
+// GetSeasonStandings returns a page of a season's standings, best first
+func (r *Repository) GetSeasonStandings(number, limit, offset int) ([]models.SeasonStanding, error) {
+	var standings []models.SeasonStanding
+	err := r.read(func(ctx context.Context, db *sql.DB) (err error) {
+		standings, err = getSeasonStandings(ctx, db, postgresHistory, number, limit, offset)
+		return err
+	})
+	return standings, err
+}
+
+func getCurrentSeason(ctx context.Context, db *sql.DB) (*models.Season, error) {
+	var season models.Season
+	err := db.QueryRowContext(ctx, `
+		SELECT number, started_at, ends_at FROM seasons WHERE ended_at IS NULL
+	`).Scan(&season.Number, &season.StartedAt, &season.EndsAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current season: %w", err)
+	}
+	return &season, nil
+}
+
+func listSeasons(ctx context.Context, db *sql.DB) ([]*models.Season, error) {
+	rows, err := db.QueryContext(ctx, `SELECT number, started_at, ends_at, ended_at FROM seasons ORDER BY number DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query seasons: %w", err)
+	}
+	defer rows.Close()
+
+	seasons := []*models.Season{}
+	for rows.Next() {
+		var season models.Season
+		if err := rows.Scan(&season.Number, &season.StartedAt, &season.EndsAt, &season.EndedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan season: %w", err)
+		}
+		seasons = append(seasons, &season)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating season rows: %w", err)
+	}
+	return seasons, nil
+}
+
+func startSeason(db *sql.DB, dialect historyDialect, exec func(execer, string, ...interface{}) (sql.Result, error), season *models.Season) (bool, error) {
+	// Another running season conflicts on idx_seasons_running
+	result, err := exec(db, bindArgs(dialect, `
+		INSERT INTO seasons (number, started_at, ends_at) VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`), season.Number, dialect.time(season.StartedAt), dialect.time(season.EndsAt))
+	if err != nil {
+		return false, fmt.Errorf("failed to start season %d: %w", season.Number, err)
+	}
+	started, _ := result.RowsAffected()
+	return started > 0, nil
+}
+
+func endSeason(db *sql.DB, dialect historyDialect, exec func(execer, string, ...interface{}) (sql.Result, error),
+	ended, next *models.Season, rewards []models.SeasonReward, reset models.RatingReset) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin season end: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := exec(tx, bindArgs(dialect, `UPDATE seasons SET ended_at = ? WHERE number = ? AND ended_at IS NULL`),
+		dialect.time(*ended.EndedAt), ended.Number)
+	if err != nil {
+		return false, fmt.Errorf("failed to end season %d: %w", ended.Number, err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+
+	// A player's games in the season are those rated since their last
+	// rating before it started
+	reward := "NULL"
+	args := []interface{}{ended.Number}
+	if len(rewards) > 0 {
+		reward = "CASE"
+		for _, tier := range rewards {
+			reward += " WHEN s.rating >= ? AND s.games >= ? THEN ?"
+			args = append(args, tier.MinRating, tier.MinGames, tier.Name)
+		}
+		reward += " END"
+	}
+	args = append(args, dialect.time(ended.StartedAt))
+	_, err = exec(tx, bindArgs(dialect, `
+		INSERT INTO season_standings (season_number, rank, player_name, rating, games_played, reward)
+		SELECT CAST(? AS INTEGER), ROW_NUMBER() OVER (ORDER BY s.rating DESC, s.player_name), s.player_name, s.rating, s.games, `+reward+`
+		FROM (
+			SELECT pr.player_name, pr.rating, pr.games_played - COALESCE((
+				SELECT h.games_played FROM rating_history h
+				WHERE h.player_name = pr.player_name AND h.recorded_at < ?
+				ORDER BY h.recorded_at DESC, h.id DESC
+				LIMIT 1
+			), 0) AS games
+			FROM player_ratings pr
+		) s
+		WHERE s.games > 0
+	`), args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to save season %d standings: %w", ended.Number, err)
+	}
+
+	_, err = exec(tx, bindArgs(dialect, `UPDATE player_ratings SET rating = ? + (rating - ?) * ?, updated_at = ?`),
+		reset.Toward, reset.Toward, reset.Carryover, dialect.time(*ended.EndedAt))
+	if err != nil {
+		return false, fmt.Errorf("failed to reset ratings: %w", err)
+	}
+
+	_, err = exec(tx, bindArgs(dialect, `INSERT INTO seasons (number, started_at, ends_at) VALUES (?, ?, ?)`),
+		next.Number, dialect.time(next.StartedAt), dialect.time(next.EndsAt))
+	if err != nil {
+		return false, fmt.Errorf("failed to start season %d: %w", next.Number, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit season end: %w", err)
+	}
+	return true, nil
+}
+
+func getSeasonStandings(ctx context.Context, db *sql.DB, dialect historyDialect, number, limit, offset int) ([]models.SeasonStanding, error) {
+	rows, err := db.QueryContext(ctx, bindArgs(dialect, `
+		SELECT season_number, rank, player_name, rating, games_played, COALESCE(reward, '')
+		FROM season_standings
+		WHERE season_number = ?
+		ORDER BY rank
+		LIMIT ? OFFSET ?
+	`), number, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query season standings: %w", err)
+	}
+	defer rows.Close()
+
+	standings := []models.SeasonStanding{}
+	for rows.Next() {
+		var standing models.SeasonStanding
+		err := rows.Scan(&standing.Season, &standing.Rank, &standing.PlayerName, &standing.Rating, &standing.GamesPlayed, &standing.Reward)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan season standing: %w", err)
+		}
+		standings = append(standings, standing)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating season standing rows: %w", err)
+	}
+	return standings, nil
+}
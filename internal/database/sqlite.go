@@ -0,0 +1,1144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// SQLiteRepository keeps everything Repository does in a SQLite file, for
+// development and deployments too small to need Postgres. There is no
+// leaderboard table, leaderboards are counted from the games table.
+type SQLiteRepository struct {
+	db     *sql.DB
+	config Config
+}
+
+var sqliteHistory = historyDialect{
+	placeholder: func(int) string { return "?" },
+	contains: func(column string) string {
+		return "EXISTS (SELECT 1 FROM json_each(" + column + ") WHERE value = ?)"
+	},
+	time: func(t time.Time) time.Time { return t.UTC() },
+	array: func(values []string) interface{} {
+		encoded, _ := json.Marshal(values)
+		return string(encoded)
+	},
+}
+
+// sqliteTimeFormat is how the driver writes times
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// sqliteTime scans a time the driver may read as text, as it does the
+// results of expressions like MIN(finished_at)
+type sqliteTime struct {
+	sql.NullTime
+}
+
+func (t *sqliteTime) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case string:
+		parsed, err := time.Parse(sqliteTimeFormat, value)
+		if err != nil {
+			return err
+		}
+		t.Time, t.Valid = parsed, true
+		return nil
+	case []byte:
+		return t.Scan(string(value))
+	default:
+		return t.NullTime.Scan(value)
+	}
+}
+
+// ptr returns the time, nil if it was NULL
+func (t sqliteTime) ptr() *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// NewSQLiteRepository opens the SQLite file, creating it if it doesn't
+// exist, and migrates it to the latest schema
+func NewSQLiteRepository(path string, config Config) (*SQLiteRepository, error) {
+	repo, err := OpenSQLiteRepository(path, config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.MigrateUp(); err != nil {
+		repo.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// OpenSQLiteRepository opens the SQLite file without migrating it
+func OpenSQLiteRepository(path string, config Config) (*SQLiteRepository, error) {
+	if sqliteDriver == "" {
+		return nil, fmt.Errorf("failed to open %s: this build has no SQLite driver, build it with -tags sqlite", path)
+	}
+	if config.ReplicaURL != "" {
+		return nil, fmt.Errorf("failed to open %s: read replicas need Postgres, unset DATABASE_REPLICA_URL", path)
+	}
+	db, err := sql.Open(sqliteDriver, sqliteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	repo := &SQLiteRepository{db: db, config: config}
+	if err := repo.HealthCheck(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// migrator returns the migrator of the SQLite schema. SQLite takes no
+// migration lock, each migration's transaction holds the write lock.
+func (r *SQLiteRepository) migrator() *migrator {
+	files, _ := fs.Sub(sqliteMigrationFiles, "migrations/sqlite")
+	return &migrator{
+		db:    r.db,
+		files: files,
+		table: `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at TIMESTAMP NOT NULL
+			)
+		`,
+		record: `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		forget: `DELETE FROM schema_migrations WHERE version = ?`,
+	}
+}
+
+// MigrateUp applies the migrations the database doesn't have, oldest first,
+// and returns them
+func (r *SQLiteRepository) MigrateUp() ([]Migration, error) {
+	return r.migrator().up()
+}
+
+// MigrateDown undoes the latest migrations the database has, at most steps of
+// them, newest first, and returns them
+func (r *SQLiteRepository) MigrateDown(steps int) ([]Migration, error) {
+	return r.migrator().down(steps)
+}
+
+// MigrationStatus returns every migration, oldest first, with when the
+// database got it
+func (r *SQLiteRepository) MigrationStatus() ([]MigrationState, error) {
+	return r.migrator().status()
+}
+
+// HealthCheck checks the database file can be read
+func (r *SQLiteRepository) HealthCheck() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
+
+// queryContext bounds a query by the query timeout. Rows read with it must be
+// closed before it is cancelled.
+func (r *SQLiteRepository) queryContext() (context.Context, context.CancelFunc) {
+	if r.config.QueryTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), r.config.QueryTimeout)
+}
+
+// exec runs a statement bounded by the query timeout
+func (r *SQLiteRepository) exec(q execer, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+	return q.ExecContext(ctx, query, args...)
+}
+
+// GetLeaderboard returns the page of a leaderboard the query picks, counted
+// from the games table on every read
+func (r *SQLiteRepository) GetLeaderboard(query LeaderboardQuery) ([]LeaderboardEntry, error) {
+	return r.readLeaderboard(query, "")
+}
+
+// GetLeaderboardAround returns the query's limit of a leaderboard's rows
+// starting half of them above the player, none when the player isn't on it
+func (r *SQLiteRepository) GetLeaderboardAround(query LeaderboardQuery, playerName string) ([]LeaderboardEntry, error) {
+	return r.readLeaderboard(query, playerName)
+}
+
+func (r *SQLiteRepository) readLeaderboard(query LeaderboardQuery, player string) ([]LeaderboardEntry, error) {
+	ranked, args, err := sqliteLeaderboardSource(query)
+	if err != nil {
+		return nil, err
+	}
+	statement, args := rankedLeaderboard(sqliteHistory, ranked, args, query, player)
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query leaderboard: %w", err)
+	}
+	defer rows.Close()
+
+	var leaderboard []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		var firstGameAt, lastGameAt sqliteTime // aggregates, which the driver reads as text
+		err := rows.Scan(
+			&entry.Username, &entry.TotalGames, &entry.Wins, &entry.Losses, &entry.Draws, &entry.WinRate,
+			&entry.AverageGameDuration, &entry.TotalPlaytimeSeconds,
+			&entry.HorizontalWins, &entry.VerticalWins, &entry.DiagonalWins, &entry.ForfeitWins,
+			&entry.WinsVsHumans, &entry.WinsVsBots, &entry.LossesVsHumans, &entry.LossesVsBots,
+			&entry.CurrentWinStreak, &entry.LongestWinStreak, &firstGameAt, &lastGameAt,
+			&entry.Rating, &entry.Rank,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard entry: %w", err)
+		}
+		entry.PlayerName = entry.Username
+		entry.FirstGameAt, entry.LastGameAt = firstGameAt.ptr(), lastGameAt.ptr()
+		leaderboard = append(leaderboard, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating leaderboard rows: %w", err)
+	}
+
+	return leaderboard, nil
+}
+
+// sqliteLeaderboardSource returns the query of every row of the query's
+// leaderboard, ranked, counting the games of its period. Names break ties, so
+// pages don't overlap.
+func sqliteLeaderboardSource(query LeaderboardQuery) (string, []interface{}, error) {
+	if err := query.check(); err != nil {
+		return "", nil, err
+	}
+
+	games, streaks := "games", "p.current_win_streak, p.longest_win_streak"
+	var args []interface{}
+	if query.Period != "" {
+		start, end, err := query.period()
+		if err != nil {
+			return "", nil, err
+		}
+		// A period's rows leave out streaks, as in Postgres
+		games, streaks = "games WHERE finished_at >= ? AND finished_at < ?", "0, 0"
+		args = []interface{}{start, end, start, end}
+	}
+
+	players := `
+		WITH results AS (
+			SELECT id, finished_at, duration_seconds, win_type, player1_name AS name, player2_is_bot AS opponent_is_bot,
+				CASE WHEN is_draw THEN 'draw' WHEN winner_id = player1_id THEN 'win' ELSE 'loss' END AS outcome
+			FROM ` + games + `
+			UNION ALL
+			SELECT id, finished_at, duration_seconds, win_type, player2_name, player1_is_bot,
+				CASE WHEN is_draw THEN 'draw' WHEN winner_id = player2_id THEN 'win' ELSE 'loss' END
+			FROM ` + games + `
+		),
+		-- A streak is a run of games between two games that end it, numbered
+		-- by how many games ended a streak before it
+		runs AS (
+			SELECT *,
+				SUM(CASE WHEN outcome <> 'win' THEN 1 ELSE 0 END) OVER player_games AS win_run,
+				SUM(CASE WHEN outcome <> 'loss' THEN 1 ELSE 0 END) OVER player_games AS loss_run
+			FROM results
+			WINDOW player_games AS (PARTITION BY name ORDER BY finished_at, id)
+		),
+		latest_runs AS (
+			SELECT *, MAX(win_run) OVER (PARTITION BY name) AS latest_win_run FROM runs
+		),
+		longest_streaks AS (
+			SELECT name, MAX(wins) AS longest_win_streak
+			FROM (
+				SELECT name, SUM(CASE WHEN outcome = 'win' THEN 1 ELSE 0 END) AS wins
+				FROM runs GROUP BY name, win_run
+			)
+			GROUP BY name
+		),
+		players AS (
+			SELECT r.name,
+				COUNT(*) AS total_games,
+				SUM(CASE WHEN outcome = 'win' THEN 1 ELSE 0 END) AS wins,
+				SUM(CASE WHEN outcome = 'loss' THEN 1 ELSE 0 END) AS losses,
+				SUM(CASE WHEN outcome = 'draw' THEN 1 ELSE 0 END) AS draws,
+				ROUND(CAST(SUM(CASE WHEN outcome = 'win' THEN 1 ELSE 0 END) AS REAL) * 100 / COUNT(*), 2) AS win_rate,
+				ROUND(AVG(duration_seconds), 2) AS average_game_duration,
+				SUM(duration_seconds) AS total_playtime_seconds,
+				SUM(CASE WHEN outcome = 'win' AND win_type = 'horizontal' THEN 1 ELSE 0 END) AS horizontal_wins,
+				SUM(CASE WHEN outcome = 'win' AND win_type = 'vertical' THEN 1 ELSE 0 END) AS vertical_wins,
+				SUM(CASE WHEN outcome = 'win' AND win_type LIKE 'diagonal%' THEN 1 ELSE 0 END) AS diagonal_wins,
+				SUM(CASE WHEN outcome = 'win' AND win_type = 'forfeit' THEN 1 ELSE 0 END) AS forfeit_wins,
+				SUM(CASE WHEN outcome = 'win' AND NOT opponent_is_bot THEN 1 ELSE 0 END) AS wins_vs_humans,
+				SUM(CASE WHEN outcome = 'win' AND opponent_is_bot THEN 1 ELSE 0 END) AS wins_vs_bots,
+				SUM(CASE WHEN outcome = 'loss' AND NOT opponent_is_bot THEN 1 ELSE 0 END) AS losses_vs_humans,
+				SUM(CASE WHEN outcome = 'loss' AND opponent_is_bot THEN 1 ELSE 0 END) AS losses_vs_bots,
+				SUM(CASE WHEN outcome = 'win' AND win_run = latest_win_run THEN 1 ELSE 0 END) AS current_win_streak,
+				s.longest_win_streak,
+				MIN(finished_at) AS first_game_at,
+				MAX(finished_at) AS last_game_at
+			FROM latest_runs r
+			JOIN longest_streaks s ON s.name = r.name
+			GROUP BY r.name
+		)
+	`
+
+	if query.Sort == LeaderboardSortRating {
+		return players + `
+			SELECT pr.player_name AS username, COALESCE(p.total_games, 0), COALESCE(p.wins, 0), COALESCE(p.losses, 0), COALESCE(p.draws, 0),
+				COALESCE(p.win_rate, 0), COALESCE(p.average_game_duration, 0), COALESCE(p.total_playtime_seconds, 0),
+				COALESCE(p.horizontal_wins, 0), COALESCE(p.vertical_wins, 0), COALESCE(p.diagonal_wins, 0), COALESCE(p.forfeit_wins, 0),
+				COALESCE(p.wins_vs_humans, 0), COALESCE(p.wins_vs_bots, 0), COALESCE(p.losses_vs_humans, 0), COALESCE(p.losses_vs_bots, 0),
+				COALESCE(p.current_win_streak, 0), COALESCE(p.longest_win_streak, 0), p.first_game_at, p.last_game_at,
+				pr.rating,
+				ROW_NUMBER() OVER (ORDER BY pr.rating DESC, pr.player_name) AS leaderboard_rank
+			FROM player_ratings pr
+			LEFT JOIN players p ON p.name = pr.player_name
+		`, args, nil
+	}
+
+	return players + `
+		SELECT p.name AS username, p.total_games, p.wins, p.losses, p.draws, p.win_rate,
+			p.average_game_duration, p.total_playtime_seconds,
+			p.horizontal_wins, p.vertical_wins, p.diagonal_wins, p.forfeit_wins,
+			p.wins_vs_humans, p.wins_vs_bots, p.losses_vs_humans, p.losses_vs_bots,
+			` + streaks + `, p.first_game_at, p.last_game_at,
+			COALESCE(pr.rating, 0),
+			ROW_NUMBER() OVER (ORDER BY p.win_rate DESC, p.wins DESC, p.total_games DESC, p.name) AS leaderboard_rank
+		FROM players p
+		LEFT JOIN player_ratings pr ON pr.player_name = p.name
+	`, args, nil
+}
+
+// RefreshLeaderboard does nothing, the leaderboard is counted on every read
+func (r *SQLiteRepository) RefreshLeaderboard() error {
+	return nil
+}
+
+// GetPlayerStats returns a player's results over the games table
+func (r *SQLiteRepository) GetPlayerStats(playerName string) (*PlayerStats, error) {
+	query := `
+		WITH player_games AS (
+			SELECT CASE WHEN winner_id = player1_id THEN player1_name
+					WHEN winner_id = player2_id THEN player2_name END AS winner_name,
+				is_draw, duration_seconds
+			FROM games
+			WHERE player1_name = ?1 OR player2_name = ?1
+		)
+		SELECT COUNT(*),
+			SUM(CASE WHEN winner_name = ?1 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN winner_name != ?1 AND NOT is_draw THEN 1 ELSE 0 END),
+			SUM(CASE WHEN is_draw THEN 1 ELSE 0 END),
+			CASE WHEN COUNT(*) > 0 THEN ROUND(CAST(SUM(CASE WHEN winner_name = ?1 THEN 1 ELSE 0 END) AS REAL) / COUNT(*) * 100, 2) ELSE 0 END,
+			CASE WHEN COUNT(*) > 0 THEN ROUND(AVG(duration_seconds), 2) ELSE 0 END,
+			COALESCE((SELECT rating FROM player_ratings WHERE player_name = ?1), 0)
+		FROM player_games
+	`
+
+	stats := PlayerStats{PlayerName: playerName}
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	var wins, losses, draws sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, playerName).Scan(
+		&stats.TotalGames,
+		&wins,
+		&losses,
+		&draws,
+		&stats.WinRate,
+		&stats.AverageGameDuration,
+		&stats.Rating,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get player stats: %w", err)
+	}
+	if stats.TotalGames == 0 {
+		return nil, fmt.Errorf("player not found: %s", playerName)
+	}
+	stats.Wins, stats.Losses, stats.Draws = int(wins.Int64), int(losses.Int64), int(draws.Int64)
+
+	return &stats, nil
+}
+
+// GetPlayerRating returns a player's rating, nil if the player is unrated
+func (r *SQLiteRepository) GetPlayerRating(playerName string) (*models.PlayerRating, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	var rating models.PlayerRating
+	err := r.db.QueryRowContext(ctx, `
+		SELECT player_name, rating, peak_rating, games_played, updated_at
+		FROM player_ratings WHERE player_name = ?
+	`, playerName).Scan(&rating.PlayerName, &rating.Rating, &rating.PeakRating, &rating.GamesPlayed, &rating.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get player rating: %w", err)
+	}
+
+	return &rating, nil
+}
+
+// SavePlayerRating inserts or updates a player's rating
+func (r *SQLiteRepository) SavePlayerRating(rating *models.PlayerRating) error {
+	return r.savePlayerRating(r.db, rating)
+}
+
+func (r *SQLiteRepository) savePlayerRating(q execer, rating *models.PlayerRating) error {
+	_, err := r.exec(q, `
+		INSERT INTO player_ratings (player_name, rating, peak_rating, games_played, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (player_name) DO UPDATE SET
+			rating = excluded.rating,
+			peak_rating = excluded.peak_rating,
+			games_played = excluded.games_played,
+			updated_at = excluded.updated_at
+	`, rating.PlayerName, rating.Rating, rating.PeakRating, rating.GamesPlayed, rating.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save player rating: %w", err)
+	}
+
+	return nil
+}
+
+// GetRatingHistory returns a player's latest ratings, oldest first
+func (r *SQLiteRepository) GetRatingHistory(playerName string, limit int) ([]RatingHistoryPoint, error) {
+	query := `
+		SELECT rating, games_played, recorded_at FROM (
+			SELECT id, rating, games_played, recorded_at FROM rating_history
+			WHERE player_name = ?
+			ORDER BY recorded_at DESC, id DESC
+			LIMIT ?
+		)
+		ORDER BY recorded_at, id
+	`
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, playerName, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rating history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []RatingHistoryPoint{}
+	for rows.Next() {
+		var point RatingHistoryPoint
+		if err := rows.Scan(&point.Rating, &point.GamesPlayed, &point.RecordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan rating history: %w", err)
+		}
+		history = append(history, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rating history rows: %w", err)
+	}
+
+	return history, nil
+}
+
+// GetOpeningColumns counts the games in game_moves by the column the player
+// first played in
+func (r *SQLiteRepository) GetOpeningColumns(playerName string) (OpeningColumns, error) {
+	query := `
+		SELECT m.column_played, COUNT(*) FROM game_moves m
+		WHERE m.player_name = ?1 AND m.move_number = (
+			SELECT MIN(move_number) FROM game_moves WHERE game_id = m.game_id AND player_name = ?1
+		)
+		GROUP BY m.column_played
+	`
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, playerName)
+	if err != nil {
+		return OpeningColumns{}, fmt.Errorf("failed to query opening columns: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOpeningColumns(rows)
+}
+
+// GetCurrentSeason returns the season being played, nil when there is none
+func (r *SQLiteRepository) GetCurrentSeason() (*models.Season, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return getCurrentSeason(ctx, r.db)
+}
+
+// ListSeasons returns every season, the latest first
+func (r *SQLiteRepository) ListSeasons() ([]*models.Season, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return listSeasons(ctx, r.db)
+}
+
+// StartSeason adds a season, returning false when another is running or one
+// with its number exists
+func (r *SQLiteRepository) StartSeason(season *models.Season) (bool, error) {
+	return startSeason(r.db, sqliteHistory, r.exec, season)
+}
+
+// EndSeason ends a season, keeps its standings, resets ratings and starts the
+// next season in one transaction, returning false when it has already ended
+func (r *SQLiteRepository) EndSeason(ended, next *models.Season, rewards []models.SeasonReward, reset models.RatingReset) (bool, error) {
+	return endSeason(r.db, sqliteHistory, r.exec, ended, next, rewards, reset)
+}
+
+// GetSeasonStandings returns a page of a season's standings, best first
+func (r *SQLiteRepository) GetSeasonStandings(number, limit, offset int) ([]models.SeasonStanding, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return getSeasonStandings(ctx, r.db, sqliteHistory, number, limit, offset)
+}
+
+// sqlitePlayerTables are the tables ErasePlayer deletes a player's rows
+// from, the leaderboard is counted from the games
+var sqlitePlayerTables = []playerTable{
+	{"player_ratings", "player_name"},
+	{"rating_history", "player_name"},
+	{"season_standings", "player_name"},
+	{"queue_penalties", "player_name"},
+	{"player_stats", "player_name"},
+	{"player_flags", "player_name"},
+}
+
+// ErasePlayer erases a player's data in one transaction: their games, moves
+// and replays are renamed to the alias, their ratings, standings and stats
+// are deleted, and so is their account when deleteAccount is set
+func (r *SQLiteRepository) ErasePlayer(account *models.Account, alias string, deleteAccount bool) (*models.PlayerErasure, error) {
+	return erasePlayer(r.db, sqliteHistory, r.exec, r.queryContext, sqlitePlayerTables, account, alias, deleteAccount)
+}
+
+// DeleteGameMovesBefore deletes up to limit game_moves rows played before the
+// cutoff, returning how many it deleted
+func (r *SQLiteRepository) DeleteGameMovesBefore(cutoff time.Time, limit int) (int64, error) {
+	return deleteGameMovesBefore(r.db, sqliteHistory, r.exec, cutoff, limit)
+}
+
+// DeletePlayerAnalytics deletes the analytics consumer's stats and flags of a player
+func (r *SQLiteRepository) DeletePlayerAnalytics(playerName string) error {
+	return deletePlayerAnalytics(r.db, sqliteHistory, r.exec, playerName)
+}
+
+// GetQueuePenalty returns a player's queue penalty, nil if the player has none
+func (r *SQLiteRepository) GetQueuePenalty(playerName string) (*models.QueuePenalty, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	var penalty models.QueuePenalty
+	err := r.db.QueryRowContext(ctx, `
+		SELECT player_name, offenses, last_offense_at, banned_until
+		FROM queue_penalties WHERE player_name = ?
+	`, playerName).Scan(&penalty.PlayerName, &penalty.Offenses, &penalty.LastOffenseAt, &penalty.BannedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue penalty: %w", err)
+	}
+
+	return &penalty, nil
+}
+
+// SaveQueuePenalty inserts or updates a player's queue penalty
+func (r *SQLiteRepository) SaveQueuePenalty(penalty *models.QueuePenalty) error {
+	_, err := r.exec(r.db, `
+		INSERT INTO queue_penalties (player_name, offenses, last_offense_at, banned_until)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (player_name) DO UPDATE SET
+			offenses = excluded.offenses,
+			last_offense_at = excluded.last_offense_at,
+			banned_until = excluded.banned_until
+	`, penalty.PlayerName, penalty.Offenses, penalty.LastOffenseAt, penalty.BannedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to save queue penalty: %w", err)
+	}
+
+	return nil
+}
+
+// SaveQueueSnapshot replaces the saved matchmaking queue
+func (r *SQLiteRepository) SaveQueueSnapshot(players []*models.QueuedPlayer) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin queue snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := r.exec(tx, `DELETE FROM queue_snapshot`); err != nil {
+		return fmt.Errorf("failed to clear queue snapshot: %w", err)
+	}
+
+	for _, player := range players {
+		_, err := r.exec(tx, `
+			INSERT INTO queue_snapshot (player_id, player_name, joined_at, queue_type, party_id,
+				allow_bots, skill_level, max_wait_time, rating, priority)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, player.PlayerID, player.PlayerName, player.JoinedAt, string(player.QueueType), player.PartyID,
+			player.AllowBots, player.SkillLevel, player.MaxWaitTime, player.Rating, player.Priority)
+		if err != nil {
+			return fmt.Errorf("failed to save queued player %s: %w", player.PlayerName, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit queue snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// LoadQueueSnapshot returns the saved matchmaking queue and clears it so it is only restored once
+func (r *SQLiteRepository) LoadQueueSnapshot() ([]*models.QueuedPlayer, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		DELETE FROM queue_snapshot
+		RETURNING player_id, player_name, joined_at, queue_type, party_id,
+			allow_bots, skill_level, max_wait_time, rating, priority
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load queue snapshot: %w", err)
+	}
+	defer rows.Close()
+
+	var players []*models.QueuedPlayer
+	for rows.Next() {
+		var player models.QueuedPlayer
+		var queueType string
+		err := rows.Scan(&player.PlayerID, &player.PlayerName, &player.JoinedAt, &queueType, &player.PartyID,
+			&player.AllowBots, &player.SkillLevel, &player.MaxWaitTime, &player.Rating, &player.Priority)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan queued player: %w", err)
+		}
+		player.QueueType = models.QueueType(queueType)
+		players = append(players, &player)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating queue snapshot rows: %w", err)
+	}
+
+	return players, nil
+}
+
+// SaveGameSnapshot replaces the saved in-progress games
+func (r *SQLiteRepository) SaveGameSnapshot(games []*models.Game) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin game snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := r.exec(tx, `DELETE FROM game_snapshot`); err != nil {
+		return fmt.Errorf("failed to clear game snapshot: %w", err)
+	}
+
+	for _, game := range games {
+		data, err := json.Marshal(game)
+		if err != nil {
+			return fmt.Errorf("failed to encode game %s: %w", game.ID, err)
+		}
+		if _, err := r.exec(tx, `INSERT INTO game_snapshot (game_id, game) VALUES (?, ?)`, game.ID, data); err != nil {
+			return fmt.Errorf("failed to save game %s: %w", game.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit game snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// LoadGameSnapshot returns the saved in-progress games and clears them so they are only restored once
+func (r *SQLiteRepository) LoadGameSnapshot() ([]*models.Game, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `DELETE FROM game_snapshot RETURNING game`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load game snapshot: %w", err)
+	}
+	defer rows.Close()
+
+	var games []*models.Game
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan saved game: %w", err)
+		}
+		var game models.Game
+		if err := json.Unmarshal(data, &game); err != nil {
+			return nil, fmt.Errorf("failed to decode saved game: %w", err)
+		}
+		games = append(games, &game)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating game snapshot rows: %w", err)
+	}
+
+	return games, nil
+}
+
+// SaveCompletedGame saves a completed game to the games table, the
+// leaderboard is counted from. Saving it again does nothing.
+func (r *SQLiteRepository) SaveCompletedGame(game *models.Game) error {
+	_, err := r.saveCompletedGame(r.db, game)
+	return err
+}
+
+// saveCompletedGame inserts the game into the games table, reporting whether
+// it wasn't there yet
+func (r *SQLiteRepository) saveCompletedGame(q execer, game *models.Game) (bool, error) {
+	if game == nil || game.State != models.GameStateFinished || game.Players[0] == nil || game.Players[1] == nil {
+		return false, fmt.Errorf("invalid game state")
+	}
+
+	totalMoves := 0
+	for i := 0; i < 6; i++ {
+		for j := 0; j < 7; j++ {
+			if game.Board[i][j] != 0 {
+				totalMoves++
+			}
+		}
+	}
+
+	var winnerID *uuid.UUID
+	var winnerName *string
+	var winType sql.NullString
+	if game.Winner != nil {
+		winner := game.Players[0]
+		if *game.Winner != models.PlayerRed {
+			winner = game.Players[1]
+		}
+		winnerID, winnerName = &winner.ID, &winner.Name
+		winType = sql.NullString{String: game.WinType(), Valid: true}
+	}
+
+	result, err := r.exec(q, `
+		INSERT INTO games (
+			id, player1_id, player1_name, player1_is_bot,
+			player2_id, player2_name, player2_is_bot,
+			winner_id, winner_name, is_draw,
+			total_moves, duration_seconds, win_type,
+			created_at, finished_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`,
+		game.ID,
+		game.Players[0].ID, game.Players[0].Name, game.Players[0].IsBot,
+		game.Players[1].ID, game.Players[1].Name, game.Players[1].IsBot,
+		winnerID, winnerName, game.Winner == nil,
+		totalMoves, int(game.FinishedAt.Sub(game.CreatedAt).Seconds()), winType,
+		game.CreatedAt.UTC(), game.FinishedAt.UTC(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to save completed game %s: %w", game.ID, err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to save completed game %s: %w", game.ID, err)
+	}
+	return inserted > 0, nil
+}
+
+// SaveFinishedGame keeps a finished game with its move history, replays are
+// generated from it. Its moves are also saved a row each in game_moves.
+func (r *SQLiteRepository) SaveFinishedGame(game *models.Game) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin finished game %s: %w", game.ID, err)
+	}
+	defer tx.Rollback()
+
+	if err := r.saveFinishedGame(tx, game); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit finished game %s: %w", game.ID, err)
+	}
+
+	return nil
+}
+
+// SaveGameResult saves a finished game, its result and the ratings it changed
+// in one transaction. SQLite runs one writer at a time, so it never conflicts
+// with another game's. Saving the game again keeps it once and leaves the
+// ratings alone.
+func (r *SQLiteRepository) SaveGameResult(game *models.Game, ratings []*models.PlayerRating) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin result of game %s: %w", game.ID, err)
+	}
+	defer tx.Rollback()
+
+	if err := r.saveFinishedGame(tx, game); err != nil {
+		return err
+	}
+	saved, err := r.saveCompletedGame(tx, game)
+	if err != nil {
+		return err
+	}
+	if saved {
+		for _, rating := range ratings {
+			if err := r.savePlayerRating(tx, rating); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit result of game %s: %w", game.ID, err)
+	}
+	return nil
+}
+
+// saveFinishedGame saves the game to game_history and its moves to game_moves
+// in the transaction
+func (r *SQLiteRepository) saveFinishedGame(tx *sql.Tx, game *models.Game) error {
+	if game.FinishedAt == nil {
+		return fmt.Errorf("game %s is not finished", game.ID)
+	}
+
+	data, err := json.Marshal(game)
+	if err != nil {
+		return fmt.Errorf("failed to encode game %s: %w", game.ID, err)
+	}
+	columns := newHistoryColumns(game)
+	playerNames, _ := json.Marshal(columns.playerNames)
+	winnerNames, _ := json.Marshal(columns.winnerNames)
+
+	_, err = r.exec(tx, `
+		INSERT INTO game_history (game_id, game, finished_at, player_names, winner_names, is_draw, win_type,
+			has_bot, total_moves, duration_seconds, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (game_id) DO UPDATE SET game = excluded.game, finished_at = excluded.finished_at,
+			player_names = excluded.player_names, winner_names = excluded.winner_names,
+			is_draw = excluded.is_draw, win_type = excluded.win_type, has_bot = excluded.has_bot,
+			total_moves = excluded.total_moves, duration_seconds = excluded.duration_seconds,
+			started_at = excluded.started_at
+	`, game.ID, data, game.FinishedAt.UTC(), string(playerNames), string(winnerNames), columns.isDraw, columns.winType,
+		columns.hasBot, columns.totalMoves, columns.duration, columns.startedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save finished game %s: %w", game.ID, err)
+	}
+
+	if _, err := r.exec(tx, `DELETE FROM game_moves WHERE game_id = ?`, game.ID); err != nil {
+		return fmt.Errorf("failed to clear moves of game %s: %w", game.ID, err)
+	}
+	for i, move := range newGameMoves(game) {
+		_, err := r.exec(tx, `
+			INSERT INTO game_moves (id, game_id, player_id, player_name, player_number, move_number,
+				column_played, row_landed, is_bot_move, move_timestamp, time_taken_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, move...)
+		if err != nil {
+			return fmt.Errorf("failed to save move %d of game %s: %w", i+1, game.ID, err)
+		}
+	}
+	return nil
+}
+
+// GetFinishedGame returns a finished game with its move history, or nil if it isn't kept
+func (r *SQLiteRepository) GetFinishedGame(gameID uuid.UUID) (*models.Game, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	var data []byte
+	err := r.db.QueryRowContext(ctx, `SELECT game FROM game_history WHERE game_id = ?`, gameID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get finished game %s: %w", gameID, err)
+	}
+
+	var game models.Game
+	if err := json.Unmarshal(data, &game); err != nil {
+		return nil, fmt.Errorf("failed to decode finished game %s: %w", gameID, err)
+	}
+
+	return &game, nil
+}
+
+// FindFinishedGames returns the page of finished games the query picks, the
+// most recently finished first unless it sorts otherwise
+func (r *SQLiteRepository) FindFinishedGames(query GameQuery) (*GamePage, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return findFinishedGames(ctx, r.db, sqliteHistory, query)
+}
+
+// CreateWebhook stores a registered webhook
+func (r *SQLiteRepository) CreateWebhook(webhook *models.Webhook) error {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook events: %w", err)
+	}
+	_, err = r.exec(r.db, `INSERT INTO webhooks (id, url, events, secret, created_at) VALUES (?, ?, ?, ?, ?)`,
+		webhook.ID, webhook.URL, string(events), webhook.Secret, webhook.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return nil
+}
+
+// ListWebhooks returns every registered webhook, secrets included
+func (r *SQLiteRepository) ListWebhooks() ([]*models.Webhook, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, url, events, secret, created_at FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		var webhook models.Webhook
+		var events string
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &events, &webhook.Secret, &webhook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		if err := json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+			return nil, fmt.Errorf("failed to decode events of webhook %s: %w", webhook.ID, err)
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook and reports whether it existed
+func (r *SQLiteRepository) DeleteWebhook(webhookID uuid.UUID) (bool, error) {
+	result, err := r.exec(r.db, `DELETE FROM webhooks WHERE id = ?`, webhookID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete webhook %s: %w", webhookID, err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return deleted > 0, nil
+}
+
+// SaveWebhookDeadLetter records a delivery that ran out of attempts
+func (r *SQLiteRepository) SaveWebhookDeadLetter(letter *models.WebhookDeadLetter) error {
+	_, err := r.exec(r.db, `
+		INSERT INTO webhook_dead_letters (id, webhook_id, url, event, payload, attempts, last_error, failed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, letter.ID, letter.WebhookID, letter.URL, letter.Event, []byte(letter.Payload), letter.Attempts,
+		letter.LastError, letter.FailedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save webhook dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// ListWebhookDeadLetters returns the most recent failed deliveries
+func (r *SQLiteRepository) ListWebhookDeadLetters(limit int) ([]*models.WebhookDeadLetter, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, webhook_id, url, event, payload, attempts, last_error, failed_at
+		FROM webhook_dead_letters
+		ORDER BY failed_at DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []*models.WebhookDeadLetter
+	for rows.Next() {
+		var letter models.WebhookDeadLetter
+		var payload []byte
+		if err := rows.Scan(&letter.ID, &letter.WebhookID, &letter.URL, &letter.Event, &payload, &letter.Attempts, &letter.LastError, &letter.FailedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook dead letter: %w", err)
+		}
+		letter.Payload = payload
+		letters = append(letters, &letter)
+	}
+
+	return letters, rows.Err()
+}
+
+// CreateAccount inserts a new account
+func (r *SQLiteRepository) CreateAccount(account *models.Account) error {
+	_, err := r.exec(r.db, `INSERT INTO accounts (id, username, password_hash, created_at) VALUES (?, ?, ?, ?)`,
+		account.ID, account.Username, account.PasswordHash, account.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create account: %w", err)
+	}
+
+	return nil
+}
+
+// GetAccount returns an account by ID, nil if it doesn't exist
+func (r *SQLiteRepository) GetAccount(accountID uuid.UUID) (*models.Account, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return scanAccount(r.db.QueryRowContext(ctx, `
+		SELECT id, username, password_hash, created_at, last_login_at FROM accounts WHERE id = ?
+	`, accountID))
+}
+
+// GetAccountByUsername returns an account by username regardless of case,
+// nil if it doesn't exist
+func (r *SQLiteRepository) GetAccountByUsername(username string) (*models.Account, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	return scanAccount(r.db.QueryRowContext(ctx, `
+		SELECT id, username, password_hash, created_at, last_login_at FROM accounts WHERE LOWER(username) = LOWER(?)
+	`, username))
+}
+
+// UpdateAccountLogin records when the account last logged in
+func (r *SQLiteRepository) UpdateAccountLogin(accountID uuid.UUID, loginAt time.Time) error {
+	if _, err := r.exec(r.db, `UPDATE accounts SET last_login_at = ? WHERE id = ?`, loginAt, accountID); err != nil {
+		return fmt.Errorf("failed to update account login: %w", err)
+	}
+
+	return nil
+}
+
+// MergeGuestPlayer moves a guest player's games to the account in a single
+// transaction. The guest's rating is carried over only when the account has
+// none of its own, an established account rating is never overwritten.
+func (r *SQLiteRepository) MergeGuestPlayer(guestID uuid.UUID, account *models.Account) (*models.GuestClaim, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin guest merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	claim := &models.GuestClaim{GuestID: guestID, GuestNames: []string{}}
+
+	// Bounds the reads, each update gets its own timeout
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT player1_name FROM games WHERE player1_id = ?1
+		UNION
+		SELECT player2_name FROM games WHERE player2_id = ?1
+	`, guestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query guest names: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan guest name: %w", err)
+		}
+		if name != account.Username {
+			claim.GuestNames = append(claim.GuestNames, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read guest names: %w", err)
+	}
+
+	for _, column := range []string{"player1", "player2"} {
+		result, err := r.exec(tx, fmt.Sprintf(
+			`UPDATE games SET %[1]s_id = ?, %[1]s_name = ? WHERE %[1]s_id = ?`, column),
+			account.ID, account.Username, guestID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move guest games: %w", err)
+		}
+		moved, _ := result.RowsAffected()
+		claim.GamesClaimed += int(moved)
+	}
+
+	if _, err := r.exec(tx, `UPDATE games SET winner_id = ? WHERE winner_id = ?`, account.ID, guestID); err != nil {
+		return nil, fmt.Errorf("failed to move guest wins: %w", err)
+	}
+
+	var accountRated bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM player_ratings WHERE player_name = ?)`, account.Username).Scan(&accountRated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check account rating: %w", err)
+	}
+
+	if !accountRated {
+		// Carry over the rating of the name the guest played most rated games under
+		var guestName string
+		var guestGames int
+		for _, name := range claim.GuestNames {
+			var games int
+			err := tx.QueryRowContext(ctx, `SELECT games_played FROM player_ratings WHERE player_name = ?`, name).Scan(&games)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get guest rating: %w", err)
+			}
+			if guestName == "" || games > guestGames {
+				guestName, guestGames = name, games
+			}
+		}
+
+		if guestName != "" {
+			_, err := r.exec(tx, `UPDATE player_ratings SET player_name = ? WHERE player_name = ?`, account.Username, guestName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transfer guest rating: %w", err)
+			}
+			_, err = r.exec(tx, `UPDATE rating_history SET player_name = ? WHERE player_name = ?`, account.Username, guestName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transfer guest rating history: %w", err)
+			}
+			claim.RatingTransferred = true
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit guest merge: %w", err)
+	}
+
+	return claim, nil
+}
+
+// Close closes the database
+func (r *SQLiteRepository) Close() error {
+	return r.db.Close()
+}
+
+// Stats returns the connection pool's statistics
+func (r *SQLiteRepository) Stats() sql.DBStats {
+	return r.db.Stats()
+}
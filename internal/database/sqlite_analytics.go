@@ -0,0 +1,400 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SaveAnalyticsAggregates upserts the aggregates in one transaction. The
+// values replace what is stored, so saving the same aggregates twice is harmless.
+func (r *SQLiteRepository) SaveAnalyticsAggregates(aggregates *AnalyticsAggregates) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin saving aggregates: %w", err)
+	}
+	defer tx.Rollback()
+
+	if game := aggregates.Game; game != nil {
+		winTypes, err := json.Marshal(game.WinTypes)
+		if err != nil {
+			return fmt.Errorf("failed to encode win types: %w", err)
+		}
+		_, err = r.exec(tx, `
+			INSERT INTO game_stats (id, total_games, completed_games, total_game_duration,
+				draw_count, bot_games, human_games, win_types, updated_at)
+			VALUES (1, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT (id) DO UPDATE SET
+				total_games = excluded.total_games,
+				completed_games = excluded.completed_games,
+				total_game_duration = excluded.total_game_duration,
+				draw_count = excluded.draw_count,
+				bot_games = excluded.bot_games,
+				human_games = excluded.human_games,
+				win_types = excluded.win_types,
+				updated_at = excluded.updated_at
+		`, game.TotalGames, game.CompletedGames, game.TotalGameDuration,
+			game.DrawCount, game.BotGames, game.HumanGames, string(winTypes))
+		if err != nil {
+			return fmt.Errorf("failed to save game totals: %w", err)
+		}
+	}
+
+	for _, hour := range aggregates.Hourly {
+		_, err := r.exec(tx, `
+			INSERT INTO hourly_stats (hour, games, moves, players, average_duration, updated_at)
+			VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT (hour) DO UPDATE SET
+				games = excluded.games,
+				moves = excluded.moves,
+				players = excluded.players,
+				average_duration = excluded.average_duration,
+				updated_at = excluded.updated_at
+		`, hour.Hour, hour.Games, hour.Moves, hour.Players, hour.AverageDuration)
+		if err != nil {
+			return fmt.Errorf("failed to save hourly stats of %s: %w", hour.Hour, err)
+		}
+	}
+
+	for _, day := range aggregates.Daily {
+		_, err := r.exec(tx, `
+			INSERT INTO daily_stats (day, games, moves, players, new_players, average_duration, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT (day) DO UPDATE SET
+				games = excluded.games,
+				moves = excluded.moves,
+				players = excluded.players,
+				new_players = excluded.new_players,
+				average_duration = excluded.average_duration,
+				updated_at = excluded.updated_at
+		`, day.Day, day.Games, day.Moves, day.Players, day.NewPlayers, day.AverageDuration)
+		if err != nil {
+			return fmt.Errorf("failed to save daily stats of %s: %w", day.Day, err)
+		}
+	}
+
+	for _, player := range aggregates.Players {
+		_, err := r.exec(tx, `
+			INSERT INTO player_stats (player_name, games_played, games_won, games_lost, games_drawn,
+				total_moves, total_game_time, disconnections, reconnections, total_offline_ms,
+				first_seen, last_seen, current_streak, longest_streak)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (player_name) DO UPDATE SET
+				games_played = excluded.games_played,
+				games_won = excluded.games_won,
+				games_lost = excluded.games_lost,
+				games_drawn = excluded.games_drawn,
+				total_moves = excluded.total_moves,
+				total_game_time = excluded.total_game_time,
+				disconnections = excluded.disconnections,
+				reconnections = excluded.reconnections,
+				total_offline_ms = excluded.total_offline_ms,
+				first_seen = excluded.first_seen,
+				last_seen = excluded.last_seen,
+				current_streak = excluded.current_streak,
+				longest_streak = excluded.longest_streak
+		`, player.Name, player.GamesPlayed, player.GamesWon, player.GamesLost, player.GamesDrawn,
+			player.TotalMoves, player.TotalGameTime, player.Disconnections, player.Reconnections,
+			player.TotalOfflineTime.Milliseconds(), player.FirstSeen, player.LastSeen,
+			player.CurrentStreak, player.LongestStreak)
+		if err != nil {
+			return fmt.Errorf("failed to save player stats of %s: %w", player.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit aggregates: %w", err)
+	}
+
+	return nil
+}
+
+// LoadAnalyticsAggregates returns the saved game totals, every player, and
+// the hours and days from the given keys on
+func (r *SQLiteRepository) LoadAnalyticsAggregates(fromHour, fromDay string) (*AnalyticsAggregates, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	aggregates := &AnalyticsAggregates{}
+
+	var game GameTotals
+	var winTypes string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT total_games, completed_games, total_game_duration, draw_count, bot_games, human_games, win_types
+		FROM game_stats WHERE id = 1
+	`).Scan(&game.TotalGames, &game.CompletedGames, &game.TotalGameDuration,
+		&game.DrawCount, &game.BotGames, &game.HumanGames, &winTypes)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, fmt.Errorf("failed to load game totals: %w", err)
+	default:
+		if err := json.Unmarshal([]byte(winTypes), &game.WinTypes); err != nil {
+			return nil, fmt.Errorf("failed to decode win types: %w", err)
+		}
+		aggregates.Game = &game
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT hour, games, moves, players, average_duration FROM hourly_stats WHERE hour >= ?
+	`, fromHour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hourly stats: %w", err)
+	}
+	for rows.Next() {
+		var hour HourlyStats
+		if err := rows.Scan(&hour.Hour, &hour.Games, &hour.Moves, &hour.Players, &hour.AverageDuration); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan hourly stats: %w", err)
+		}
+		aggregates.Hourly = append(aggregates.Hourly, hour)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating hourly stats rows: %w", err)
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT day, games, moves, players, new_players, average_duration FROM daily_stats WHERE day >= ?
+	`, fromDay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load daily stats: %w", err)
+	}
+	for rows.Next() {
+		var day DailyStats
+		if err := rows.Scan(&day.Day, &day.Games, &day.Moves, &day.Players, &day.NewPlayers, &day.AverageDuration); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan daily stats: %w", err)
+		}
+		aggregates.Daily = append(aggregates.Daily, day)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating daily stats rows: %w", err)
+	}
+
+	rows, err = r.db.QueryContext(ctx, `SELECT `+playerStatsColumns+` FROM player_stats`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load player stats: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		player, err := scanPlayerStats(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan player stats: %w", err)
+		}
+		aggregates.Players = append(aggregates.Players, player)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating player stats rows: %w", err)
+	}
+
+	return aggregates, nil
+}
+
+// LoadPlayerStats returns one player's saved counters, nil if none were saved
+func (r *SQLiteRepository) LoadPlayerStats(name string) (*AggregatedPlayerStats, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+playerStatsColumns+` FROM player_stats WHERE player_name = ?`, name)
+	player, err := scanPlayerStats(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load player stats of %s: %w", name, err)
+	}
+	return &player, nil
+}
+
+// SaveRetentionCohorts upserts the cohorts in one transaction
+func (r *SQLiteRepository) SaveRetentionCohorts(cohorts []RetentionCohort) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin saving retention cohorts: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, cohort := range cohorts {
+		_, err := r.exec(tx, `
+			INSERT INTO retention_cohorts (cohort_day, players, returned_d1, returned_d7, returned_d30, churned, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT (cohort_day) DO UPDATE SET
+				players = excluded.players,
+				returned_d1 = excluded.returned_d1,
+				returned_d7 = excluded.returned_d7,
+				returned_d30 = excluded.returned_d30,
+				churned = excluded.churned,
+				updated_at = excluded.updated_at
+		`, cohort.Day, cohort.Players, cohort.ReturnedD1, cohort.ReturnedD7, cohort.ReturnedD30, cohort.Churned)
+		if err != nil {
+			return fmt.Errorf("failed to save retention cohort %s: %w", cohort.Day, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit retention cohorts: %w", err)
+	}
+
+	return nil
+}
+
+// AddCounters adds the deltas to the shared counters in one transaction.
+// Deltas are by counter name, then field.
+func (r *SQLiteRepository) AddCounters(deltas map[string]map[string]int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin adding counters: %w", err)
+	}
+	defer tx.Rollback()
+
+	for name, fields := range deltas {
+		for field, delta := range fields {
+			_, err := r.exec(tx, `
+				INSERT INTO analytics_counters (name, field, value, updated_at)
+				VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+				ON CONFLICT (name, field) DO UPDATE SET
+					value = analytics_counters.value + excluded.value,
+					updated_at = CURRENT_TIMESTAMP
+			`, name, field, delta)
+			if err != nil {
+				return fmt.Errorf("failed to add to counter %s %s: %w", name, field, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit counters: %w", err)
+	}
+	return nil
+}
+
+// LoadCounters returns the fields of the named shared counters
+func (r *SQLiteRepository) LoadCounters(names []string) (map[string]map[string]int64, error) {
+	list, err := json.Marshal(names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode counter names: %w", err)
+	}
+
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT name, field, value FROM analytics_counters WHERE name IN (SELECT value FROM json_each(?))
+	`, string(list))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load counters: %w", err)
+	}
+	defer rows.Close()
+
+	counters := make(map[string]map[string]int64)
+	for rows.Next() {
+		var name, field string
+		var value int64
+		if err := rows.Scan(&name, &field, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan counter: %w", err)
+		}
+		if counters[name] == nil {
+			counters[name] = make(map[string]int64)
+		}
+		counters[name][field] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating counter rows: %w", err)
+	}
+
+	return counters, nil
+}
+
+// SavePlayerFlag inserts the flag or updates its review
+func (r *SQLiteRepository) SavePlayerFlag(flag *PlayerFlag) error {
+	_, err := r.exec(r.db, `
+		INSERT INTO player_flags (id, player_name, reason, detail, value, threshold, status,
+			flagged_at, reviewed_at, review_note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			status = excluded.status,
+			reviewed_at = excluded.reviewed_at,
+			review_note = excluded.review_note
+	`, flag.ID, flag.PlayerName, flag.Reason, flag.Detail, flag.Value, flag.Threshold, flag.Status,
+		flag.FlaggedAt.UTC(), flag.ReviewedAt, flag.ReviewNote)
+	if err != nil {
+		return fmt.Errorf("failed to save flag of %s: %w", flag.PlayerName, err)
+	}
+	return nil
+}
+
+// LoadPlayerFlags returns every flag, oldest first
+func (r *SQLiteRepository) LoadPlayerFlags() ([]PlayerFlag, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, player_name, reason, detail, value, threshold, status, flagged_at, reviewed_at, review_note
+		FROM player_flags ORDER BY flagged_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load player flags: %w", err)
+	}
+	defer rows.Close()
+
+	var flags []PlayerFlag
+	for rows.Next() {
+		var flag PlayerFlag
+		var reviewedAt sql.NullTime
+		err := rows.Scan(&flag.ID, &flag.PlayerName, &flag.Reason, &flag.Detail, &flag.Value, &flag.Threshold,
+			&flag.Status, &flag.FlaggedAt, &reviewedAt, &flag.ReviewNote)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan player flag: %w", err)
+		}
+		if reviewedAt.Valid {
+			flag.ReviewedAt = &reviewedAt.Time
+		}
+		flags = append(flags, flag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating player flag rows: %w", err)
+	}
+
+	return flags, nil
+}
+
+// EventProcessed reports whether the analytics event was already processed
+func (r *SQLiteRepository) EventProcessed(eventID string) (bool, error) {
+	ctx, cancel := r.queryContext()
+	defer cancel()
+
+	var processed bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM processed_events WHERE event_id = ?)`, eventID).Scan(&processed)
+	return processed, err
+}
+
+// MarkEventProcessed records the analytics event as processed, marking it again does nothing
+func (r *SQLiteRepository) MarkEventProcessed(eventID, eventType string, processedAt time.Time) error {
+	_, err := r.exec(r.db, `
+		INSERT INTO processed_events (event_id, event_type, processed_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (event_id) DO NOTHING
+	`, eventID, eventType, processedAt.UTC())
+	return err
+}
+
+// DeleteProcessedEventsBefore forgets events processed before the cutoff
+func (r *SQLiteRepository) DeleteProcessedEventsBefore(cutoff time.Time) (int64, error) {
+	result, err := r.exec(r.db, `DELETE FROM processed_events WHERE processed_at < ?`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteProcessedEventsAfter forgets events processed after the cutoff
+func (r *SQLiteRepository) DeleteProcessedEventsAfter(cutoff time.Time) (int64, error) {
+	result, err := r.exec(r.db, `DELETE FROM processed_events WHERE processed_at > ?`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
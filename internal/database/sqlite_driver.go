@@ -0,0 +1,19 @@
+//go:build sqlite
+
+package database
+
+import (
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDriver is the database/sql driver SQLite files are opened with
+const sqliteDriver = "sqlite"
+
+// sqliteDSN opens the file with foreign keys on, in WAL mode so reads don't
+// wait on writes, and with transactions taking the write lock when they
+// begin, so two of them never deadlock upgrading theirs. Times are written
+// in SQLite's own format.
+func sqliteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)" +
+		"&_txlock=immediate&_time_format=sqlite"
+}
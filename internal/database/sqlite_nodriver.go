@@ -0,0 +1,11 @@
+//go:build !sqlite
+
+package database
+
+// sqliteDriver is empty in builds without the SQLite driver, opening a
+// SQLite database fails in them
+const sqliteDriver = ""
+
+func sqliteDSN(path string) string {
+	return path
+}
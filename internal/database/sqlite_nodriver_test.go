@@ -0,0 +1,16 @@
+//go:build !sqlite
+
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQLiteNeedsDriver(t *testing.T) {
+	_, err := New("sqlite://"+filepath.Join(t.TempDir(), "connect_four.db"), DefaultConfig())
+	if err == nil || !strings.Contains(err.Error(), "-tags sqlite") {
+		t.Errorf("New of a sqlite:// URL without the driver = %v, want an error naming the build tag", err)
+	}
+}
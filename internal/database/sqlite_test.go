@@ -0,0 +1,316 @@
+//go:build sqlite
+
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func newTestSQLite(t *testing.T) *SQLiteRepository {
+	t.Helper()
+	repo, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "connect_four.db"), DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// finishedGame is a game red won across the bottom row
+func finishedGame(red, yellow string) *models.Game {
+	createdAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	finishedAt := createdAt.Add(40 * time.Second)
+	winner := models.PlayerRed
+	game := &models.Game{
+		ID:         uuid.New(),
+		Players:    [2]*models.Player{{ID: uuid.New(), Name: red}, {ID: uuid.New(), Name: yellow}},
+		State:      models.GameStateFinished,
+		Winner:     &winner,
+		EndReason:  models.EndReasonConnectFour,
+		CreatedAt:  createdAt,
+		FinishedAt: &finishedAt,
+	}
+	for i, column := range []int{0, 0, 1, 1, 2, 2, 3} {
+		color, row := models.PlayerRed, 5
+		if i%2 == 1 {
+			color, row = models.PlayerYellow, 4
+		}
+		game.Board[row][column] = int(color) + 1
+		game.Moves = append(game.Moves, &models.Move{
+			PlayerID:  game.Players[color].ID,
+			Color:     color,
+			Column:    column,
+			Row:       row,
+			Timestamp: createdAt.Add(time.Duration(i+1) * 5 * time.Second),
+		})
+	}
+	return game
+}
+
+func TestSQLiteOpen(t *testing.T) {
+	if _, err := New("sqlite://"+filepath.Join(t.TempDir(), "connect_four.db"), DefaultConfig()); err != nil {
+		t.Fatalf("New of a sqlite:// URL: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.ReplicaURL = "postgres://replica"
+	if _, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "connect_four.db"), config); err == nil {
+		t.Error("SQLite opened with a read replica")
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	repo := newTestSQLite(t)
+
+	states, err := repo.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			t.Errorf("migration %d %s is pending after NewSQLiteRepository", state.Version, state.Name)
+		}
+	}
+
+	reverted, err := repo.MigrateDown(len(states))
+	if err != nil {
+		t.Fatalf("MigrateDown(%d): %v", len(states), err)
+	}
+	if len(reverted) != len(states) {
+		t.Errorf("MigrateDown reverted %d migrations, want %d", len(reverted), len(states))
+	}
+	applied, err := repo.MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp after reverting them all: %v", err)
+	}
+	if len(applied) != len(states) {
+		t.Errorf("MigrateUp applied %d migrations, want %d", len(applied), len(states))
+	}
+}
+
+func TestSQLiteGameResult(t *testing.T) {
+	repo := newTestSQLite(t)
+	game := finishedGame("alice", "bob")
+	ratings := []*models.PlayerRating{
+		{PlayerName: "alice", Rating: 1216, PeakRating: 1216, GamesPlayed: 1, UpdatedAt: time.Now().UTC()},
+		{PlayerName: "bob", Rating: 1184, PeakRating: 1200, GamesPlayed: 1, UpdatedAt: time.Now().UTC()},
+	}
+
+	if err := repo.SaveGameResult(game, ratings); err != nil {
+		t.Fatal(err)
+	}
+	// Saving it again keeps one game and leaves the ratings alone
+	again := []*models.PlayerRating{{PlayerName: "alice", Rating: 1232, PeakRating: 1232, GamesPlayed: 2, UpdatedAt: time.Now().UTC()}}
+	if err := repo.SaveGameResult(game, again); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := repo.GetPlayerStats("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalGames != 1 || stats.Wins != 1 || stats.Losses != 0 || stats.Rating != 1216 {
+		t.Errorf("alice's stats are %+v, want one win at 1216", stats)
+	}
+	rating, err := repo.GetPlayerRating("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rating == nil || rating.Rating != 1184 || rating.PeakRating != 1200 {
+		t.Errorf("bob's rating is %+v, want 1184 peaking at 1200", rating)
+	}
+	if rating, err := repo.GetPlayerRating("carol"); err != nil || rating != nil {
+		t.Errorf("GetPlayerRating of an unrated player = %v, %v", rating, err)
+	}
+
+	saved, err := repo.GetFinishedGame(game.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved == nil || len(saved.Moves) != len(game.Moves) || saved.EndReason != models.EndReasonConnectFour {
+		t.Fatalf("GetFinishedGame returned %+v", saved)
+	}
+	if missing, err := repo.GetFinishedGame(uuid.New()); err != nil || missing != nil {
+		t.Errorf("GetFinishedGame of a game never saved = %v, %v", missing, err)
+	}
+
+	leaderboard, err := repo.GetLeaderboard(LeaderboardQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard) != 2 || leaderboard[0].Username != "alice" || leaderboard[0].Rank != 1 || leaderboard[0].Wins != 1 {
+		t.Errorf("leaderboard is %+v, want alice first with a win", leaderboard)
+	}
+	rated, err := repo.GetLeaderboard(LeaderboardQuery{Sort: LeaderboardSortRating, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rated) != 2 || rated[0].Username != "alice" {
+		t.Errorf("rating leaderboard is %+v, want alice first", rated)
+	}
+
+	page, err := repo.FindFinishedGames(GameQuery{Player: "bob", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Games) != 1 || page.Games[0].ID != game.ID {
+		t.Errorf("bob's games are %+v, want the one he lost", page.Games)
+	}
+}
+
+func TestSQLiteRejectsUnfinishedGame(t *testing.T) {
+	repo := newTestSQLite(t)
+	game := finishedGame("alice", "bob")
+	game.State = models.GameStatePlaying
+	if err := repo.SaveCompletedGame(game); err == nil {
+		t.Error("SaveCompletedGame saved a game still being played")
+	}
+}
+
+func TestSQLiteGameSnapshot(t *testing.T) {
+	repo := newTestSQLite(t)
+	game := finishedGame("alice", "bob")
+	game.State, game.Winner, game.FinishedAt = models.GameStatePlaying, nil, nil
+
+	if err := repo.SaveGameSnapshot([]*models.Game{game}); err != nil {
+		t.Fatal(err)
+	}
+	games, err := repo.LoadGameSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 1 || games[0].ID != game.ID || games[0].Board != game.Board {
+		t.Fatalf("LoadGameSnapshot returned %+v, want the saved game", games)
+	}
+
+	// A snapshot replaces the last one
+	if err := repo.SaveGameSnapshot(nil); err != nil {
+		t.Fatal(err)
+	}
+	if games, err := repo.LoadGameSnapshot(); err != nil || len(games) != 0 {
+		t.Errorf("LoadGameSnapshot after an empty snapshot = %d games, %v", len(games), err)
+	}
+}
+
+func TestSQLiteAccounts(t *testing.T) {
+	repo := newTestSQLite(t)
+	account := &models.Account{ID: uuid.New(), Username: "alice", PasswordHash: "hash", CreatedAt: time.Now().UTC()}
+	if err := repo.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateAccount(&models.Account{ID: uuid.New(), Username: "alice", CreatedAt: time.Now().UTC()}); err == nil {
+		t.Error("two accounts were created with one username")
+	}
+
+	found, err := repo.GetAccountByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.ID != account.ID || found.PasswordHash != "hash" {
+		t.Fatalf("GetAccountByUsername returned %+v", found)
+	}
+
+	loginAt := time.Now().UTC().Truncate(time.Second)
+	if err := repo.UpdateAccountLogin(account.ID, loginAt); err != nil {
+		t.Fatal(err)
+	}
+	found, err = repo.GetAccount(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.LastLoginAt == nil || !found.LastLoginAt.Equal(loginAt) {
+		t.Errorf("last login is %v, want %v", found.LastLoginAt, loginAt)
+	}
+}
+
+func TestSQLiteNameHistory(t *testing.T) {
+	repo := newTestSQLite(t)
+	game := finishedGame("alice", "bob")
+	ratings := []*models.PlayerRating{{PlayerName: "alice", Rating: 1216, PeakRating: 1216, GamesPlayed: 1, UpdatedAt: time.Now().UTC()}}
+	if err := repo.SaveGameResult(game, ratings); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := repo.GetNameHistory("ALICE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.PlayerIDs) != 1 || history.PlayerIDs[0] != game.Players[0].ID || !history.Rated {
+		t.Errorf("alice's history is %+v, want her player ID and a rating", history)
+	}
+	if history, err := repo.GetNameHistory("bob"); err != nil || len(history.PlayerIDs) != 1 || history.Rated {
+		t.Errorf("bob's history is %+v, %v, want his player ID and no rating", history, err)
+	}
+	if history, err := repo.GetNameHistory("carol"); err != nil || !history.Empty() {
+		t.Errorf("history of a name never played = %+v, %v", history, err)
+	}
+}
+
+func TestSQLiteWebhooks(t *testing.T) {
+	repo := newTestSQLite(t)
+	webhook := &models.Webhook{ID: uuid.New(), URL: "https://example.com/hook", Events: []string{"game.finished"}, CreatedAt: time.Now().UTC()}
+	if err := repo.CreateWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	webhooks, err := repo.ListWebhooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webhooks) != 1 || webhooks[0].URL != webhook.URL || len(webhooks[0].Events) != 1 {
+		t.Fatalf("ListWebhooks returned %+v", webhooks)
+	}
+
+	if deleted, err := repo.DeleteWebhook(webhook.ID); err != nil || !deleted {
+		t.Errorf("DeleteWebhook = %v, %v", deleted, err)
+	}
+	if deleted, err := repo.DeleteWebhook(webhook.ID); err != nil || deleted {
+		t.Errorf("DeleteWebhook of a deleted webhook = %v, %v", deleted, err)
+	}
+}
+
+func TestSQLiteCounters(t *testing.T) {
+	repo := newTestSQLite(t)
+	deltas := map[string]map[string]int64{"games": {"casual": 2, "ranked": 1}}
+	if err := repo.AddCounters(deltas); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddCounters(deltas); err != nil {
+		t.Fatal(err)
+	}
+
+	counters, err := repo.LoadCounters([]string{"games"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counters["games"]["casual"] != 4 || counters["games"]["ranked"] != 2 {
+		t.Errorf("counters are %v, want casual 4 and ranked 2", counters)
+	}
+}
+
+func TestSQLiteProcessedEvents(t *testing.T) {
+	repo := newTestSQLite(t)
+	if processed, err := repo.EventProcessed("event-1"); err != nil || processed {
+		t.Fatalf("EventProcessed of a new event = %v, %v", processed, err)
+	}
+	if err := repo.MarkEventProcessed("event-1", "game_ended", time.Now().UTC().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if processed, err := repo.EventProcessed("event-1"); err != nil || !processed {
+		t.Errorf("EventProcessed of a marked event = %v, %v", processed, err)
+	}
+
+	deleted, err := repo.DeleteProcessedEventsBefore(time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteProcessedEventsBefore deleted %d events, want 1", deleted)
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Store is the database layer the server and the analytics consumer share,
+// kept in Postgres by Repository or in SQLite by SQLiteRepository
+type Store interface {
+	// Leaderboards and player statistics
+	GetLeaderboard(query LeaderboardQuery) ([]LeaderboardEntry, error)
+	GetLeaderboardAround(query LeaderboardQuery, playerName string) ([]LeaderboardEntry, error)
+	RefreshLeaderboard() error
+	GetPlayerStats(playerName string) (*PlayerStats, error)
+	GetPlayerRating(playerName string) (*models.PlayerRating, error)
+	SavePlayerRating(rating *models.PlayerRating) error
+	GetRatingHistory(playerName string, limit int) ([]RatingHistoryPoint, error)
+	GetOpeningColumns(playerName string) (OpeningColumns, error)
+
+	// Seasons and where players finished them
+	GetCurrentSeason() (*models.Season, error)
+	ListSeasons() ([]*models.Season, error)
+	StartSeason(season *models.Season) (bool, error)
+	EndSeason(ended, next *models.Season, rewards []models.SeasonReward, reset models.RatingReset) (bool, error)
+	GetSeasonStandings(number, limit, offset int) ([]models.SeasonStanding, error)
+
+	// Matchmaking and in-progress games kept across restarts
+	GetQueuePenalty(playerName string) (*models.QueuePenalty, error)
+	SaveQueuePenalty(penalty *models.QueuePenalty) error
+	SaveQueueSnapshot(players []*models.QueuedPlayer) error
+	LoadQueueSnapshot() ([]*models.QueuedPlayer, error)
+	SaveGameSnapshot(games []*models.Game) error
+	LoadGameSnapshot() ([]*models.Game, error)
+
+	// Finished games
+	SaveCompletedGame(game *models.Game) error
+	SaveFinishedGame(game *models.Game) error
+	SaveGameResult(game *models.Game, ratings []*models.PlayerRating) error
+	GetFinishedGame(gameID uuid.UUID) (*models.Game, error)
+	FindFinishedGames(query GameQuery) (*GamePage, error)
+	DeleteGameMovesBefore(cutoff time.Time, limit int) (int64, error)
+
+	// Webhooks
+	CreateWebhook(webhook *models.Webhook) error
+	ListWebhooks() ([]*models.Webhook, error)
+	DeleteWebhook(webhookID uuid.UUID) (bool, error)
+	SaveWebhookDeadLetter(letter *models.WebhookDeadLetter) error
+	ListWebhookDeadLetters(limit int) ([]*models.WebhookDeadLetter, error)
+
+	// Accounts
+	CreateAccount(account *models.Account) error
+	GetAccount(accountID uuid.UUID) (*models.Account, error)
+	GetAccountByUsername(username string) (*models.Account, error)
+	GetNameHistory(username string) (*models.NameHistory, error)
+	UpdateAccountLogin(accountID uuid.UUID, loginAt time.Time) error
+	MergeGuestPlayer(guestID uuid.UUID, account *models.Account) (*models.GuestClaim, error)
+	ErasePlayer(account *models.Account, alias string, deleteAccount bool) (*models.PlayerErasure, error)
+
+	// The analytics consumer's aggregates, counters, flags and processed events
+	SaveAnalyticsAggregates(aggregates *AnalyticsAggregates) error
+	LoadAnalyticsAggregates(fromHour, fromDay string) (*AnalyticsAggregates, error)
+	LoadPlayerStats(name string) (*AggregatedPlayerStats, error)
+	DeletePlayerAnalytics(playerName string) error
+	SaveRetentionCohorts(cohorts []RetentionCohort) error
+	AddCounters(deltas map[string]map[string]int64) error
+	LoadCounters(names []string) (map[string]map[string]int64, error)
+	SavePlayerFlag(flag *PlayerFlag) error
+	LoadPlayerFlags() ([]PlayerFlag, error)
+	EventProcessed(eventID string) (bool, error)
+	MarkEventProcessed(eventID, eventType string, processedAt time.Time) error
+	DeleteProcessedEventsBefore(cutoff time.Time) (int64, error)
+	DeleteProcessedEventsAfter(cutoff time.Time) (int64, error)
+
+	// Migrations and the connection
+	MigrateUp() ([]Migration, error)
+	MigrateDown(steps int) ([]Migration, error)
+	MigrationStatus() ([]MigrationState, error)
+	HealthCheck() error
+	Stats() sql.DBStats
+	Close() error
+}
+
+var (
+	_ Store = (*Repository)(nil)
+	_ Store = (*SQLiteRepository)(nil)
+	_ Store = (*InstrumentedStore)(nil)
+)
+
+// New connects to the database the URL points to and migrates it to the
+// latest schema. sqlite:// URLs open a SQLite file, any other URL Postgres.
+func New(databaseURL string, config Config) (Store, error) {
+	var store Store
+	var err error
+	if path, ok := sqlitePath(databaseURL); ok {
+		store, err = NewSQLiteRepository(path, config)
+	} else {
+		store, err = NewRepository(databaseURL, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Open connects to the database the URL points to without migrating it
+func Open(databaseURL string, config Config) (Store, error) {
+	var store Store
+	var err error
+	if path, ok := sqlitePath(databaseURL); ok {
+		store, err = OpenSQLiteRepository(path, config)
+	} else {
+		store, err = OpenRepository(databaseURL, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// sqlitePath returns the file a sqlite:// URL points to, like
+// sqlite://connect_four.db or sqlite:///var/lib/connect-four/data.db
+func sqlitePath(databaseURL string) (string, bool) {
+	for _, prefix := range []string{"sqlite://", "sqlite3://"} {
+		if strings.HasPrefix(databaseURL, prefix) {
+			return strings.TrimPrefix(databaseURL, prefix), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,167 @@
+package game
+
+import (
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// AnalyzeGame replays a finished game and grades every recorded move.
+// Positions small enough to solve are graded against perfect play, earlier
+// positions are graded tactically against the heuristic bot engine.
+func AnalyzeGame(g *models.Game) *models.GameAnalysis {
+	analysis := &models.GameAnalysis{
+		GameID:    g.ID,
+		Moves:     make([]models.MoveAnalysis, 0, len(g.Moves)),
+		CreatedAt: time.Now(),
+	}
+
+	replay := &models.Game{}
+	solver := NewSolver()
+
+	for i, move := range g.Moves {
+		moveAnalysis := models.MoveAnalysis{
+			MoveNumber: i + 1,
+			PlayerID:   move.PlayerID,
+			Color:      move.Color,
+			Column:     move.Column,
+		}
+
+		if CountEmptyCells(replay) <= SolverEmptyCellThreshold {
+			gradeWithSolver(solver, replay, move, &moveAnalysis)
+		} else {
+			gradeWithHeuristics(replay, move, &moveAnalysis)
+		}
+
+		analysis.Moves = append(analysis.Moves, moveAnalysis)
+
+		if replay.MakeMove(move.Column, move.Color) == nil {
+			// History no longer matches the board, stop grading here
+			break
+		}
+	}
+
+	analysis.Players = summarizeAnalysis(g, analysis.Moves)
+	return analysis
+}
+
+// gradeWithSolver compares the played move against the exact score of the best move
+func gradeWithSolver(solver *Solver, position *models.Game, move *models.Move, result *models.MoveAnalysis) {
+	scores := solver.ScoreMoves(position, move.Color)
+
+	best := -1
+	for col, score := range scores {
+		if score != nil && (best == -1 || *score > *scores[best]) {
+			best = col
+		}
+	}
+
+	result.BestColumn = best
+	result.Solved = true
+
+	played := scores[move.Column]
+	if best == -1 || played == nil {
+		result.Quality = models.MoveQualityGood
+		return
+	}
+
+	bestScore, playedScore := *scores[best], *played
+	bestResult := newSolverResult(best, bestScore, 0)
+	playedResult := newSolverResult(move.Column, playedScore, 0)
+
+	switch {
+	case playedScore == bestScore:
+		result.Quality = models.MoveQualityBest
+	case playedResult.Outcome == bestResult.Outcome:
+		result.Quality = models.MoveQualityGood
+		result.Comment = "Slower than the best move"
+	case playedResult.Outcome == "loss":
+		result.Quality = models.MoveQualityBlunder
+		result.Comment = "Turns the position into a forced loss"
+	default:
+		result.Quality = models.MoveQualityInaccuracy
+		result.Comment = "Gives away a forced win"
+	}
+}
+
+// gradeWithHeuristics checks the played move for tactical mistakes
+func gradeWithHeuristics(position *models.Game, move *models.Move, result *models.MoveAnalysis) {
+	decision := heuristicDecision(position, move.Color)
+	result.BestColumn = decision.Column
+
+	opponent := models.PlayerRed
+	if move.Color == models.PlayerRed {
+		opponent = models.PlayerYellow
+	}
+
+	if win := findWinningMove(position, move.Color); win != -1 && win != move.Column {
+		result.Quality = models.MoveQualityBlunder
+		result.Comment = "Missed a winning move"
+		return
+	}
+
+	if block := findWinningMove(position, opponent); block != -1 && block != move.Column {
+		result.Quality = models.MoveQualityBlunder
+		result.Comment = "Failed to block the opponent's winning move"
+		return
+	}
+
+	after := *position
+	if after.MakeMove(move.Column, move.Color) != nil && after.CheckWinner() == nil {
+		if findWinningMove(&after, opponent) != -1 {
+			result.Quality = models.MoveQualityInaccuracy
+			result.Comment = "Allows the opponent a winning reply"
+			return
+		}
+	}
+
+	if move.Column == decision.Column {
+		result.Quality = models.MoveQualityBest
+	} else {
+		result.Quality = models.MoveQualityGood
+	}
+}
+
+// summarizeAnalysis aggregates move grades per player
+func summarizeAnalysis(g *models.Game, moves []models.MoveAnalysis) []models.PlayerAnalysisSummary {
+	players := g.AllPlayers()
+	summaries := make([]models.PlayerAnalysisSummary, 0, len(players))
+
+	for _, player := range players {
+		if player == nil {
+			continue
+		}
+
+		summary := models.PlayerAnalysisSummary{
+			PlayerID:   player.ID,
+			PlayerName: player.Name,
+		}
+
+		total := 0
+		for _, move := range moves {
+			if move.PlayerID != player.ID {
+				continue
+			}
+
+			total++
+			switch move.Quality {
+			case models.MoveQualityBest:
+				summary.Best++
+			case models.MoveQualityGood:
+				summary.Good++
+			case models.MoveQualityInaccuracy:
+				summary.Inaccuracy++
+			case models.MoveQualityBlunder:
+				summary.Blunder++
+			}
+		}
+
+		if total > 0 {
+			summary.Accuracy = float64(summary.Best+summary.Good) / float64(total) * 100
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
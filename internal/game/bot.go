@@ -1,6 +1,7 @@
 package game
 
 import (
+	"fmt"
 	"math/rand"
 	"time"
 
@@ -24,8 +25,58 @@ func NewBot() *models.Player {
 	}
 }
 
+// BotDifficulty controls how strong a bot plays
+type BotDifficulty string
+
+const (
+	BotDifficultyEasy   BotDifficulty = "easy"
+	BotDifficultyMedium BotDifficulty = "medium"
+	BotDifficultyExpert BotDifficulty = "expert"
+)
+
+// DefaultBotDifficulty is used for bots created by matchmaking
+const DefaultBotDifficulty = BotDifficultyExpert
+
+// BotDecision describes the move a bot picked and why
+type BotDecision struct {
+	Column     int
+	Reasoning  string
+	Confidence int
+}
+
+// DecideMove picks a move for the bot according to its difficulty
+func DecideMove(game *models.Game, botColor models.PlayerColor, difficulty BotDifficulty) BotDecision {
+	switch difficulty {
+	case BotDifficultyEasy:
+		// Easy bots only take immediate wins, otherwise play randomly
+		if move := findWinningMove(game, botColor); move != -1 {
+			return BotDecision{Column: move, Reasoning: "Winning move", Confidence: 100}
+		}
+		return BotDecision{Column: randomValidMove(game), Reasoning: "Random move", Confidence: 10}
+
+	case BotDifficultyExpert:
+		// Expert bots play perfectly once the endgame is small enough to solve
+		if CountEmptyCells(game) <= SolverEmptyCellThreshold {
+			result, err := NewSolver().Solve(game, botColor)
+			if err == nil {
+				return BotDecision{
+					Column:     result.Column,
+					Reasoning:  fmt.Sprintf("Solver: %s", result),
+					Confidence: 100,
+				}
+			}
+		}
+	}
+
+	return heuristicDecision(game, botColor)
+}
+
 // GetBestMove implements a simple AI strategy
 func GetBestMove(game *models.Game, botColor models.PlayerColor) int {
+	return heuristicDecision(game, botColor).Column
+}
+
+func heuristicDecision(game *models.Game, botColor models.PlayerColor) BotDecision {
 	// Strategy priority:
 	// 1. Win if possible
 	// 2. Block opponent from winning
@@ -34,7 +85,7 @@ func GetBestMove(game *models.Game, botColor models.PlayerColor) int {
 
 	// Check for winning move
 	if move := findWinningMove(game, botColor); move != -1 {
-		return move
+		return BotDecision{Column: move, Reasoning: "Winning move", Confidence: 100}
 	}
 
 	// Check for blocking move
@@ -43,18 +94,22 @@ func GetBestMove(game *models.Game, botColor models.PlayerColor) int {
 		opponentColor = models.PlayerYellow
 	}
 	if move := findWinningMove(game, opponentColor); move != -1 {
-		return move
+		return BotDecision{Column: move, Reasoning: "Blocking opponent's winning move", Confidence: 90}
 	}
 
 	// Prefer center columns
 	centerColumns := []int{3, 2, 4, 1, 5, 0, 6}
 	for _, col := range centerColumns {
 		if game.IsValidMove(col) {
-			return col
+			return BotDecision{Column: col, Reasoning: "Prefer center columns", Confidence: 50}
 		}
 	}
 
 	// Fallback to random valid move
+	return BotDecision{Column: randomValidMove(game), Reasoning: "Random move", Confidence: 10}
+}
+
+func randomValidMove(game *models.Game) int {
 	validMoves := make([]int, 0)
 	for col := 0; col < 7; col++ {
 		if game.IsValidMove(col) {
@@ -0,0 +1,681 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Cluster connects the game managers of several server instances, each a
+// node of the cluster. A game is hosted by the node that created it, which
+// plays its moves, runs its timers and mirrors it to the cluster after every
+// change. Players and spectators may be connected to any node: the others
+// read the mirror, forward what players do to the host and deliver the
+// game's broadcasts to their own connections. A node follows the games it
+// hosts or holds connections to, and only gets the broadcasts of those.
+type Cluster interface {
+	// Node is this instance's ID, unique in the cluster
+	Node() string
+	// SaveGame mirrors a game hosted by this node, and records it as the
+	// game of each of its players
+	SaveGame(game *models.Game) error
+	// LoadGame returns the mirror of a game and the node hosting it, nil when
+	// no node hosts it
+	LoadGame(gameID uuid.UUID) (*models.Game, string, error)
+	// PlayerGame returns the game the player last played, uuid.Nil when none
+	PlayerGame(playerID uuid.UUID) (uuid.UUID, error)
+	// Publish sends a message to the node
+	Publish(node string, message []byte) error
+	// PublishGame sends a message to the nodes following the game
+	PublishGame(gameID uuid.UUID, message []byte) error
+	// Follow and Unfollow start and stop receiving the game's messages
+	Follow(gameID uuid.UUID) error
+	Unfollow(gameID uuid.UUID) error
+	// Listen calls the handler with every message sent to this node or to
+	// the games it follows, one at a time
+	Listen(handler func(message []byte))
+}
+
+// ClusterRequestTimeout is how long a node waits for the host of a game to
+// answer a forwarded move or connection
+const ClusterRequestTimeout = 5 * time.Second
+
+// ErrHostUnavailable is returned when the node hosting a game doesn't answer
+var ErrHostUnavailable = errors.New("the server hosting the game is unavailable")
+
+// Kinds of message between nodes
+const (
+	clusterBroadcast  = "broadcast"  // a message for the game's connections on every node
+	clusterMove       = "move"       // a move for the host to play
+	clusterConnect    = "connect"    // a player connected to the game through another node
+	clusterDisconnect = "disconnect" // the player's last device on that node left
+	clusterLatency    = "latency"    // the latency measured to a player's device
+	clusterEnd        = "end"        // the game ended without being played out
+	clusterHandoff    = "handoff"    // the player now plays the game through another node
+	clusterReply      = "reply"      // the host's answer to a request
+)
+
+// clusterMessage is a message between nodes
+type clusterMessage struct {
+	Kind    string `json:"kind"`
+	From    string `json:"from"`              // the node sending it, replies go there
+	Request string `json:"request,omitempty"` // ID of a request, given back with its reply
+
+	GameID     uuid.UUID           `json:"game_id"`
+	PlayerID   uuid.UUID           `json:"player_id,omitempty"`
+	Column     int                 `json:"column,omitempty"`
+	LatencyMs  int                 `json:"latency_ms,omitempty"`
+	Winner     *models.PlayerColor `json:"winner,omitempty"`
+	KeepMissed bool                `json:"keep_missed,omitempty"`
+
+	// The broadcast message, or what a request returned
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// clusterErrors are the errors a host replies with that keep their identity
+// on the node that forwarded the request
+var clusterErrors = []error{
+	ErrGameNotFound, ErrGameNotActive, ErrPlayerNotInGame, ErrNotPlayerTurn,
+	ErrInvalidMove, ErrGamePaused,
+}
+
+// clusterState is what a manager keeps to work in a cluster
+type clusterState struct {
+	cluster Cluster
+
+	// Players of hosted games connected through another node, to that node
+	elsewhere map[uuid.UUID]string
+
+	// Games whose broadcasts this node receives
+	following map[uuid.UUID]bool
+
+	requestsMutex sync.Mutex
+	requests      map[string]chan clusterMessage
+}
+
+// SetCluster shares the manager's games with the other nodes of the cluster
+// and starts handling their messages. It must be called before any game is
+// created.
+func (m *Manager) SetCluster(cluster Cluster) {
+	m.mutex.Lock()
+	m.clusterState = &clusterState{
+		cluster:   cluster,
+		elsewhere: make(map[uuid.UUID]string),
+		following: make(map[uuid.UUID]bool),
+		requests:  make(map[string]chan clusterMessage),
+	}
+	m.mutex.Unlock()
+
+	cluster.Listen(m.handleClusterMessage)
+}
+
+// hostedElsewhere reports whether the game is hosted by another node
+func (m *Manager) hostedElsewhere(gameID uuid.UUID) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, hosted := m.games[gameID]
+	return m.clusterState != nil && !hosted
+}
+
+// remoteGame returns the mirror of a game hosted by another node and that
+// node, nil when no other node hosts it
+func (m *Manager) remoteGame(gameID uuid.UUID) (*models.Game, string) {
+	game, node, err := m.clusterState.cluster.LoadGame(gameID)
+	if err != nil {
+		log.Printf("Failed to load game %s from the cluster: %v", gameID, err)
+		return nil, ""
+	}
+	if game == nil || node == m.clusterState.cluster.Node() {
+		// Hosted here before a restart, and gone with it
+		return nil, ""
+	}
+	return game, node
+}
+
+// mirrorLocked mirrors a hosted game to the cluster after it changed;
+// callers must hold the mutex. The host stays authoritative, so a failure
+// only leaves the other nodes a step behind. A finished game is followed
+// for as long as messages are kept for its players.
+func (m *Manager) mirrorLocked(game *models.Game) {
+	if m.clusterState == nil {
+		return
+	}
+	m.followLocked(game.ID)
+	if err := m.clusterState.cluster.SaveGame(game); err != nil {
+		log.Printf("Failed to mirror game %s to the cluster: %v", game.ID, err)
+	}
+
+	if game.State == models.GameStateFinished {
+		gameID := game.ID
+		time.AfterFunc(MissedMessageTTL, func() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			m.unfollowLocked(gameID)
+		})
+	}
+}
+
+// followLocked starts receiving the game's broadcasts; callers must hold the
+// mutex
+func (m *Manager) followLocked(gameID uuid.UUID) {
+	if m.clusterState == nil || m.clusterState.following[gameID] {
+		return
+	}
+	if err := m.clusterState.cluster.Follow(gameID); err != nil {
+		log.Printf("Failed to follow game %s in the cluster: %v", gameID, err)
+		return
+	}
+	m.clusterState.following[gameID] = true
+}
+
+// unfollowLocked stops receiving the game's broadcasts once it's neither
+// being played here nor has connections on this node; callers must hold the
+// mutex
+func (m *Manager) unfollowLocked(gameID uuid.UUID) {
+	if m.clusterState == nil || !m.clusterState.following[gameID] {
+		return
+	}
+	if game, hosted := m.games[gameID]; hosted && game.State == models.GameStatePlaying {
+		return
+	}
+	if len(m.spectators[gameID]) > 0 {
+		return
+	}
+	for _, playerConn := range m.players {
+		if playerConn.GameID == gameID {
+			return
+		}
+	}
+
+	if err := m.clusterState.cluster.Unfollow(gameID); err != nil {
+		log.Printf("Failed to unfollow game %s in the cluster: %v", gameID, err)
+	}
+	delete(m.clusterState.following, gameID)
+}
+
+// publish sends a message to the node
+func (m *Manager) publish(node string, message clusterMessage) error {
+	message.From = m.clusterState.cluster.Node()
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return m.clusterState.cluster.Publish(node, data)
+}
+
+// request sends a message to the host of its game and waits for the reply
+func (m *Manager) request(node string, message clusterMessage) (json.RawMessage, error) {
+	state := m.clusterState
+	message.Request = uuid.NewString()
+	reply := make(chan clusterMessage, 1)
+
+	state.requestsMutex.Lock()
+	state.requests[message.Request] = reply
+	state.requestsMutex.Unlock()
+	defer func() {
+		state.requestsMutex.Lock()
+		delete(state.requests, message.Request)
+		state.requestsMutex.Unlock()
+	}()
+
+	if err := m.publish(node, message); err != nil {
+		log.Printf("Failed to send %s of game %s to node %s: %v", message.Kind, message.GameID, node, err)
+		return nil, ErrHostUnavailable
+	}
+
+	select {
+	case answer := <-reply:
+		if answer.Error != "" {
+			return nil, clusterError(answer.Error)
+		}
+		return answer.Data, nil
+	case <-time.After(ClusterRequestTimeout):
+		return nil, ErrHostUnavailable
+	}
+}
+
+// clusterError turns an error replied by a host back into the error it was
+func clusterError(message string) error {
+	for _, err := range clusterErrors {
+		if err.Error() == message {
+			return err
+		}
+	}
+	return errors.New(message)
+}
+
+// handleClusterMessage handles a message from another node
+func (m *Manager) handleClusterMessage(data []byte) {
+	var message clusterMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		log.Printf("Failed to decode cluster message: %v", err)
+		return
+	}
+	if message.From == m.clusterState.cluster.Node() {
+		return // our own broadcast
+	}
+
+	var result interface{}
+	var err error
+	switch message.Kind {
+	case clusterReply:
+		m.clusterState.requestsMutex.Lock()
+		reply, waiting := m.clusterState.requests[message.Request]
+		m.clusterState.requestsMutex.Unlock()
+		if waiting {
+			reply <- message
+		}
+		return
+	case clusterBroadcast:
+		m.deliverBroadcast(message)
+		return
+	case clusterLatency:
+		m.setHostedLatency(message.GameID, message.PlayerID, message.LatencyMs)
+		return
+	case clusterDisconnect:
+		m.disconnectHostedPlayer(message.GameID, message.PlayerID, message.From)
+		return
+	case clusterHandoff:
+		m.handOff(message.GameID, message.PlayerID)
+		return
+	case clusterMove:
+		result, err = m.playMove(message.GameID, message.PlayerID, message.Column)
+	case clusterConnect:
+		result, err = m.connectHostedPlayer(message.GameID, message.PlayerID, message.From)
+	case clusterEnd:
+		result, err = m.endGame(message.GameID, message.Winner)
+	default:
+		log.Printf("Ignoring cluster message of unknown kind %q", message.Kind)
+		return
+	}
+
+	reply := clusterMessage{Kind: clusterReply, Request: message.Request, GameID: message.GameID}
+	if err != nil {
+		reply.Error = err.Error()
+	} else if reply.Data, err = json.Marshal(result); err != nil {
+		reply.Error = err.Error()
+	}
+	if err := m.publish(message.From, reply); err != nil {
+		log.Printf("Failed to reply to %s of game %s from node %s: %v", message.Kind, message.GameID, message.From, err)
+	}
+}
+
+// publishBroadcast sends a game's message to the other nodes following it,
+// for their connections to the game
+func (m *Manager) publishBroadcast(gameID uuid.UUID, message interface{}, keepMissed bool) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to encode game %s message for the cluster: %v", gameID, err)
+		return
+	}
+	broadcast := clusterMessage{Kind: clusterBroadcast, From: m.clusterState.cluster.Node(), GameID: gameID, KeepMissed: keepMissed, Data: data}
+	if data, err = json.Marshal(broadcast); err == nil {
+		err = m.clusterState.cluster.PublishGame(gameID, data)
+	}
+	if err != nil {
+		log.Printf("Failed to broadcast game %s message to the cluster: %v", gameID, err)
+	}
+}
+
+// deliverBroadcast sends a message another node broadcast to the game's
+// connections on this node. The host also keeps it for disconnected players.
+func (m *Manager) deliverBroadcast(message clusterMessage) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if game, hosted := m.games[message.GameID]; hosted {
+		m.sendLocked(game, message.Data, message.KeepMissed)
+		return
+	}
+	m.sendConnectionsLocked(message.GameID, message.Data)
+}
+
+// sendConnectionsLocked sends a message to the spectators and players
+// connected to a game hosted elsewhere through this node; callers must hold
+// the mutex
+func (m *Manager) sendConnectionsLocked(gameID uuid.UUID, message interface{}) {
+	for conn := range m.spectators[gameID] {
+		conn.WriteJSON(message)
+	}
+	for _, playerConn := range m.players {
+		if playerConn.GameID != gameID {
+			continue
+		}
+		for _, device := range playerConn.Devices() {
+			device.WriteJSON(message)
+		}
+	}
+}
+
+// playRemoteMove has the host of the game play the move
+func (m *Manager) playRemoteMove(gameID, playerID uuid.UUID, column int) (*models.GameDeltaPayload, error) {
+	_, node := m.remoteGame(gameID)
+	if node == "" {
+		return nil, ErrGameNotFound
+	}
+	data, err := m.request(node, clusterMessage{Kind: clusterMove, GameID: gameID, PlayerID: playerID, Column: column})
+	if err != nil {
+		return nil, err
+	}
+
+	var delta models.GameDeltaPayload
+	if err := json.Unmarshal(data, &delta); err != nil {
+		return nil, err
+	}
+	return &delta, nil
+}
+
+// endRemoteGame has the host of the game end it
+func (m *Manager) endRemoteGame(gameID uuid.UUID, winner *models.PlayerColor) (*models.Game, error) {
+	_, node := m.remoteGame(gameID)
+	if node == "" {
+		return nil, ErrGameNotFound
+	}
+	data, err := m.request(node, clusterMessage{Kind: clusterEnd, GameID: gameID, Winner: winner})
+	if err != nil {
+		return nil, err
+	}
+
+	var game models.Game
+	if err := json.Unmarshal(data, &game); err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+// reconnectRemotePlayer connects a player to a game hosted by another node,
+// which takes the game over from the node the player played it through
+// before and hands over the messages they missed. Broadcasts sent between
+// the host's reply and the connection being added here are lost, the client
+// catches up from the game versions.
+func (m *Manager) reconnectRemotePlayer(playerID, gameID uuid.UUID, conn WSConnection, greeting func(missed int, readOnly bool) interface{}) int {
+	m.mutex.Lock()
+	if existing, exists := m.players[playerID]; exists && existing.GameID == gameID && existing.Conn != nil && existing.Conn != conn {
+		if existing.follower(conn) < 0 {
+			existing.Followers = append(existing.Followers, conn)
+		}
+		m.mutex.Unlock()
+		conn.WriteJSON(greeting(0, true))
+		return 0
+	}
+	m.followLocked(gameID)
+	m.mutex.Unlock()
+
+	missed, err := m.connectRemotePlayer(gameID, playerID)
+	if err != nil {
+		log.Printf("Failed to connect player %s to game %s: %v", playerID, gameID, err)
+	}
+
+	conn.WriteJSON(greeting(len(missed), false))
+	for _, message := range missed {
+		conn.WriteJSON(message)
+	}
+
+	m.mutex.Lock()
+	m.takeMissedMessages(playerID)
+	m.addPlayerConnection(playerID, gameID, conn)
+	m.mutex.Unlock()
+	return len(missed)
+}
+
+// connectRemotePlayer tells the host of a game that the player now plays it
+// through this node, returning the messages they missed
+func (m *Manager) connectRemotePlayer(gameID, playerID uuid.UUID) ([]json.RawMessage, error) {
+	_, node := m.remoteGame(gameID)
+	if node == "" {
+		return nil, ErrGameNotFound
+	}
+	data, err := m.request(node, clusterMessage{Kind: clusterConnect, GameID: gameID, PlayerID: playerID})
+	if err != nil {
+		return nil, err
+	}
+
+	var missed []json.RawMessage
+	if err := json.Unmarshal(data, &missed); err != nil {
+		return nil, err
+	}
+	return missed, nil
+}
+
+// takeBackControl has a game played through this node again when the
+// player's devices here follow it played through another
+func (m *Manager) takeBackControl(playerID, gameID uuid.UUID) error {
+	m.mutex.Lock()
+	playerConn, exists := m.players[playerID]
+	if m.clusterState == nil || !exists || playerConn.GameID != gameID || playerConn.Conn != nil {
+		m.mutex.Unlock()
+		return nil
+	}
+	if _, hosted := m.games[gameID]; hosted {
+		m.handOffLocked(gameID, playerID, "")
+		m.mutex.Unlock()
+		return nil
+	}
+	m.mutex.Unlock()
+
+	// The player was connected all along, so nothing was kept for them
+	_, err := m.connectRemotePlayer(gameID, playerID)
+	return err
+}
+
+// handOff makes the player's devices on this node follow their game
+// read-only, now that they play it through another node
+func (m *Manager) handOff(gameID, playerID uuid.UUID) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if playerConn, exists := m.players[playerID]; exists && playerConn.GameID == gameID {
+		m.demoteLocked(playerConn)
+	}
+}
+
+// handOffLocked takes a hosted game's player over from the node they played
+// it through, for the node they now play it through, this one when empty;
+// callers must hold the mutex
+func (m *Manager) handOffLocked(gameID, playerID uuid.UUID, node string) {
+	if m.clusterState == nil {
+		return
+	}
+	if previous := m.clusterState.elsewhere[playerID]; previous != "" && previous != node {
+		err := m.publish(previous, clusterMessage{Kind: clusterHandoff, GameID: gameID, PlayerID: playerID})
+		if err != nil {
+			log.Printf("Failed to hand player %s of game %s over from node %s: %v", playerID, gameID, previous, err)
+		}
+	}
+	delete(m.clusterState.elsewhere, playerID)
+
+	if playerConn, exists := m.players[playerID]; exists && playerConn.GameID == gameID && node != "" {
+		m.demoteLocked(playerConn)
+	}
+}
+
+// demoteLocked makes the player's devices on this node follow their game
+// read-only; callers must hold the mutex
+func (m *Manager) demoteLocked(playerConn *PlayerConnection) {
+	if playerConn.Conn == nil {
+		return
+	}
+	playerConn.Followers = playerConn.Devices()
+	playerConn.Conn = nil
+
+	message := controlChanged(playerConn, false, "You reconnected to this game on another server, following it read-only here")
+	for _, device := range playerConn.Followers {
+		device.WriteJSON(message)
+	}
+}
+
+// leaveRemoteGame drops the player's connection when the device is the last
+// of theirs on this node and their game is hosted by another node, returning
+// the game
+func (m *Manager) leaveRemoteGame(playerID uuid.UUID, device WSConnection) (uuid.UUID, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.clusterState == nil {
+		return uuid.Nil, false
+	}
+	conn, exists := m.players[playerID]
+	if !exists || conn.Conn != device || len(conn.Followers) > 0 {
+		return uuid.Nil, false
+	}
+	if _, hosted := m.games[conn.GameID]; hosted {
+		return uuid.Nil, false
+	}
+	delete(m.players, playerID)
+	m.unfollowLocked(conn.GameID)
+	return conn.GameID, true
+}
+
+// disconnectRemotePlayer tells the host of the game that the player's last
+// device on this node left, returning the game and player when they dropped
+// out of a game still being played
+func (m *Manager) disconnectRemotePlayer(gameID, playerID uuid.UUID) (*models.Game, *models.Player) {
+	game, node := m.remoteGame(gameID)
+	if node == "" {
+		return nil, nil
+	}
+	if err := m.publish(node, clusterMessage{Kind: clusterDisconnect, GameID: gameID, PlayerID: playerID}); err != nil {
+		log.Printf("Failed to tell node %s that player %s left game %s: %v", node, playerID, gameID, err)
+	}
+
+	for _, player := range game.AllPlayers() {
+		if player.ID == playerID {
+			player.Connected = false
+			player.LastSeen = time.Now()
+			if game.State == models.GameStatePlaying {
+				return game, player
+			}
+			break
+		}
+	}
+	return nil, nil
+}
+
+// updateRemoteLatency sends the latency measured to a player's device to
+// the host of their game
+func (m *Manager) updateRemoteLatency(gameID, playerID uuid.UUID, latency time.Duration) (*models.Game, *models.Player, time.Duration) {
+	game, node := m.remoteGame(gameID)
+	if node == "" || game.State != models.GameStatePlaying {
+		return nil, nil, 0
+	}
+
+	for _, player := range game.AllPlayers() {
+		if player.ID != playerID {
+			continue
+		}
+		err := m.publish(node, clusterMessage{Kind: clusterLatency, GameID: gameID, PlayerID: playerID, LatencyMs: int(latency.Milliseconds())})
+		if err != nil {
+			log.Printf("Failed to send latency of player %s to node %s: %v", playerID, node, err)
+		}
+		previous := time.Duration(player.LatencyMs) * time.Millisecond
+		player.LatencyMs = int(latency.Milliseconds())
+		return game, player, previous
+	}
+	return nil, nil, 0
+}
+
+// remoteGameEvents returns the version of a game hosted by another node. Its
+// changes are only kept by the host, so they're never complete.
+func (m *Manager) remoteGameEvents(gameID uuid.UUID, since int) (*models.GameEvents, error) {
+	game, _ := m.remoteGame(gameID)
+	if game == nil {
+		return nil, ErrGameNotFound
+	}
+	return &models.GameEvents{
+		GameID:   gameID,
+		Version:  game.Version,
+		Events:   []*models.GameDeltaPayload{},
+		Complete: since >= game.Version,
+	}, nil
+}
+
+// connectHostedPlayer marks a player of a hosted game connected through
+// another node, taking the game over from where they played it before, and
+// returns the messages they missed
+func (m *Manager) connectHostedPlayer(gameID, playerID uuid.UUID, node string) ([]json.RawMessage, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	game, exists := m.games[gameID]
+	if !exists {
+		return nil, ErrGameNotFound
+	}
+	if !inGame(game, playerID) {
+		return nil, ErrPlayerNotInGame
+	}
+
+	missed := []json.RawMessage{}
+	for _, message := range m.takeMissedMessages(playerID) {
+		missed = append(missed, message.data)
+	}
+	m.handOffLocked(gameID, playerID, node)
+	m.clusterState.elsewhere[playerID] = node
+	m.markConnectedLocked(game, playerID)
+	return missed, nil
+}
+
+// disconnectHostedPlayer marks a player of a hosted game disconnected once
+// the node they were connected through loses them, unless they have since
+// connected through another node or this one
+func (m *Manager) disconnectHostedPlayer(gameID, playerID uuid.UUID, node string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.clusterState.elsewhere[playerID] != node {
+		return
+	}
+	delete(m.clusterState.elsewhere, playerID)
+	if _, connected := m.players[playerID]; connected {
+		return
+	}
+
+	game, exists := m.games[gameID]
+	if !exists {
+		return
+	}
+	for _, player := range game.AllPlayers() {
+		if player.ID == playerID {
+			player.Connected = false
+			player.LastSeen = time.Now()
+			m.mirrorLocked(game)
+			return
+		}
+	}
+}
+
+// setHostedLatency records the latency measured by another node to a
+// player's device
+func (m *Manager) setHostedLatency(gameID, playerID uuid.UUID, latencyMs int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	game, exists := m.games[gameID]
+	if !exists || game.State != models.GameStatePlaying {
+		return
+	}
+	for _, player := range game.AllPlayers() {
+		if player.ID == playerID {
+			player.LatencyMs = latencyMs
+			m.mirrorLocked(game)
+			return
+		}
+	}
+}
+
+// inGame reports whether the player plays in the game
+func inGame(game *models.Game, playerID uuid.UUID) bool {
+	for _, player := range game.AllPlayers() {
+		if player.ID == playerID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// Adjudication decides what happens to a game once a disconnected player's
+// grace period runs out
+type Adjudication string
+
+const (
+	AdjudicateWin   Adjudication = "win"   // the players still connected win
+	AdjudicateDraw  Adjudication = "draw"  // the game ends without a winner
+	AdjudicatePause Adjudication = "pause" // the game waits until everyone is back
+)
+
+// DisconnectPolicy is how long a disconnected player has to come back and
+// what happens to the game when they don't
+type DisconnectPolicy struct {
+	GracePeriod  time.Duration
+	Adjudication Adjudication
+}
+
+// DisconnectConfig holds the policy for every game, with overrides per queue type
+type DisconnectConfig struct {
+	Default    DisconnectPolicy
+	QueueTypes map[models.QueueType]DisconnectPolicy
+}
+
+// DefaultDisconnectConfig forfeits games to the connected player after
+// DisconnectGracePeriod, whatever the queue
+func DefaultDisconnectConfig() DisconnectConfig {
+	return DisconnectConfig{
+		Default: DisconnectPolicy{
+			GracePeriod:  DisconnectGracePeriod,
+			Adjudication: AdjudicateWin,
+		},
+		QueueTypes: make(map[models.QueueType]DisconnectPolicy),
+	}
+}
+
+// Policy returns the policy for games of the queue type
+func (c DisconnectConfig) Policy(queueType models.QueueType) DisconnectPolicy {
+	if policy, exists := c.QueueTypes[queueType]; exists {
+		return policy
+	}
+	return c.Default
+}
+
+// ParseDisconnectPolicy reads a policy written as "<grace period>:<adjudication>",
+// e.g. "30s:win". Either part may be left out to keep the fallback's.
+func ParseDisconnectPolicy(spec string, fallback DisconnectPolicy) (DisconnectPolicy, error) {
+	policy := fallback
+
+	gracePeriod, adjudication, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	if gracePeriod != "" {
+		duration, err := time.ParseDuration(gracePeriod)
+		if err != nil || duration <= 0 {
+			return policy, fmt.Errorf("invalid disconnect grace period %q", gracePeriod)
+		}
+		policy.GracePeriod = duration
+	}
+
+	switch Adjudication(adjudication) {
+	case "":
+	case AdjudicateWin, AdjudicateDraw, AdjudicatePause:
+		policy.Adjudication = Adjudication(adjudication)
+	default:
+		return policy, fmt.Errorf("invalid disconnect adjudication %q, expected win, draw or pause", adjudication)
+	}
+
+	return policy, nil
+}
+
+// ParseDisconnectConfig builds a config from a default policy and per queue
+// type overrides written as "ranked=60s:win,casual=:draw". Overrides fill in
+// what they leave out from the default.
+func ParseDisconnectConfig(defaultSpec, overrides string) (DisconnectConfig, error) {
+	config := DefaultDisconnectConfig()
+
+	policy, err := ParseDisconnectPolicy(defaultSpec, config.Default)
+	if err != nil {
+		return config, err
+	}
+	config.Default = policy
+
+	for _, override := range strings.Split(overrides, ",") {
+		if override = strings.TrimSpace(override); override == "" {
+			continue
+		}
+
+		queueType, spec, found := strings.Cut(override, "=")
+		if !found {
+			return config, fmt.Errorf("invalid disconnect policy override %q, expected <queue type>=<policy>", override)
+		}
+
+		policy, err := ParseDisconnectPolicy(spec, config.Default)
+		if err != nil {
+			return config, fmt.Errorf("queue type %s: %w", queueType, err)
+		}
+		config.QueueTypes[models.QueueType(strings.TrimSpace(queueType))] = policy
+	}
+
+	return config, nil
+}
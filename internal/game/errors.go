@@ -8,4 +8,7 @@ var (
 	ErrPlayerNotInGame  = errors.New("player not in game")
 	ErrNotPlayerTurn    = errors.New("not player's turn")
 	ErrInvalidMove      = errors.New("invalid move")
+	ErrGameNotFinished  = errors.New("game is not finished")
+	ErrGamePaused       = errors.New("game is paused while the server restarts")
+	ErrNotPlayerDevice  = errors.New("connection is not one of the player's devices")
 )
\ No newline at end of file
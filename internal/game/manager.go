@@ -1,26 +1,117 @@
 package game
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"sync"
 	"time"
 
+	"connect-four-backend/internal/logging"
 	"connect-four-backend/internal/models"
 
 	"github.com/google/uuid"
 )
 
 type Manager struct {
-	games   map[uuid.UUID]*models.Game
-	players map[uuid.UUID]*PlayerConnection
-	mutex   sync.RWMutex
+	games    map[uuid.UUID]*models.Game
+	players  map[uuid.UUID]*PlayerConnection
+	analyses map[uuid.UUID]*models.GameAnalysis
+	mutex    sync.RWMutex
+
+	// Read-only connections watching a game
+	spectators map[uuid.UUID]map[WSConnection]bool
+
+	// Listeners invoked (asynchronously) with a copy of every game that finishes
+	gameEndListeners []func(*models.Game)
+
+	// Game messages broadcast while a player was disconnected, replayed when they reconnect
+	missed      map[uuid.UUID][]missedMessage
+	missedMutex sync.Mutex
+
+	// Keeps games in progress across restarts
+	gameStore GameStore
+
+	// What happens to games whose players disconnect, and the last countdown
+	// step sent for each disconnected player
+	disconnectConfig DisconnectConfig
+	countdowns       map[uuid.UUID]int
+
+	// Time to move in ranked games, 0 to play them untimed
+	rankedTurnTimeLimit time.Duration
+
+	// Every change to each game, for clients polling with GameEvents
+	events map[uuid.UUID][]*models.GameDeltaPayload
+
+	// Shares games with the other server instances, nil on a single one
+	clusterState *clusterState
+}
+
+// GameStore persists games in progress while the server restarts
+type GameStore interface {
+	SaveGameSnapshot(games []*models.Game) error
+	// LoadGameSnapshot returns the saved games and clears them
+	LoadGameSnapshot() ([]*models.Game, error)
+}
+
+// Limits for the messages kept for disconnected players
+const (
+	MaxMissedMessages = 50
+	MissedMessageTTL  = 2 * time.Minute
+)
+
+// Finished games are kept this long after they end, with their changes and
+// analysis, for players reconnecting to them and for rematches. It outlasts
+// MissedMessageTTL, so no message kept for a player names a game that is gone.
+const FinishedGameTTL = 10 * time.Minute
+
+// missedMessage is a broadcast encoded when it was sent, so it replays the
+// game as it was at that moment
+type missedMessage struct {
+	data     json.RawMessage
+	queuedAt time.Time
 }
 
+// DisconnectGracePeriod is how long a disconnected player has to come back
+// before they forfeit the game, unless the DisconnectConfig says otherwise
+const DisconnectGracePeriod = 30 * time.Second
+
+// HighLatency is the round trip time above which a player's connection is
+// reported as lagging
+const HighLatency = 300 * time.Millisecond
+
+// RankedTurnTimeLimit is the mandatory time a player has to move in ranked
+// games, unless SetRankedTurnTimeLimit says otherwise
+const RankedTurnTimeLimit = 30 * time.Second
+
+// PlayerConnection is a player's devices in a game. Conn controls the game,
+// the player's other devices follow it read-only until one takes control.
+// Conn is nil while the player plays the game through another node.
 type PlayerConnection struct {
-	PlayerID uuid.UUID
-	GameID   uuid.UUID
-	Conn     WSConnection
-	LastSeen time.Time
+	PlayerID  uuid.UUID
+	GameID    uuid.UUID
+	Conn      WSConnection
+	Followers []WSConnection
+	LastSeen  time.Time
+}
+
+// Devices returns the controlling connection followed by the read-only ones
+func (pc *PlayerConnection) Devices() []WSConnection {
+	if pc.Conn == nil {
+		return pc.Followers
+	}
+	return append([]WSConnection{pc.Conn}, pc.Followers...)
+}
+
+// follower returns the index of conn among the followers, or -1
+func (pc *PlayerConnection) follower(conn WSConnection) int {
+	for i, follower := range pc.Followers {
+		if follower == conn {
+			return i
+		}
+	}
+	return -1
 }
 
 type WSConnection interface {
@@ -30,17 +121,30 @@ type WSConnection interface {
 
 func NewManager() *Manager {
 	manager := &Manager{
-		games:   make(map[uuid.UUID]*models.Game),
-		players: make(map[uuid.UUID]*PlayerConnection),
+		games:    make(map[uuid.UUID]*models.Game),
+		players:  make(map[uuid.UUID]*PlayerConnection),
+		analyses: make(map[uuid.UUID]*models.GameAnalysis),
+		missed:   make(map[uuid.UUID][]missedMessage),
+		events:   make(map[uuid.UUID][]*models.GameDeltaPayload),
+
+		disconnectConfig: DefaultDisconnectConfig(),
+		countdowns:       make(map[uuid.UUID]int),
+
+		rankedTurnTimeLimit: RankedTurnTimeLimit,
+
+		spectators: make(map[uuid.UUID]map[WSConnection]bool),
 	}
 
 	// Start cleanup routine for disconnected players
 	go manager.cleanupRoutine()
 
+	// Start turn timer routine for timed games
+	go manager.turnTimerRoutine()
+
 	return manager
 }
 
-func (m *Manager) CreateGame(player1, player2 *models.Player) *models.Game {
+func (m *Manager) CreateGame(player1, player2 *models.Player, queueType models.QueueType) *models.Game {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -51,6 +155,13 @@ func (m *Manager) CreateGame(player1, player2 *models.Player) *models.Game {
 		CurrentTurn: models.PlayerRed, // Red always starts
 		CurrentTurnNumber: 1, // Red = 1
 		CreatedAt:   time.Now(),
+		QueueType:   queueType,
+	}
+	game.TurnStartedAt = game.CreatedAt
+
+	// Ranked games are played on a mandatory turn timer
+	if queueType == models.QueueTypeRanked {
+		game.TurnTimeLimit = int(m.rankedTurnTimeLimit.Seconds())
 	}
 
 	// Assign colors and numbers
@@ -59,23 +170,104 @@ func (m *Manager) CreateGame(player1, player2 *models.Player) *models.Game {
 	game.Players[1].Color = models.PlayerYellow
 	game.Players[1].Number = 2 // Yellow = 2
 
-	log.Printf("DEBUG: Game created. Player1: %s (Color: %d, Number: %d), Player2: %s (Color: %d, Number: %d)", 
+	logging.Debugf("Game created. Player1: %s (Color: %d, Number: %d), Player2: %s (Color: %d, Number: %d)", 
 		game.Players[0].Name, game.Players[0].Color, game.Players[0].Number,
 		game.Players[1].Name, game.Players[1].Color, game.Players[1].Number)
 
 	m.games[game.ID] = game
+	m.mirrorLocked(game)
+	return game
+}
+
+// CreateTeamGame creates a 2v2 game; team members alternate moves for their color
+func (m *Manager) CreateTeamGame(team1, team2 [2]*models.Player) *models.Game {
+	game := m.CreateGame(team1[0], team2[0], models.QueueTypeTeam)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	team1[1].Color = models.PlayerRed
+	team1[1].Number = 1
+	team2[1].Color = models.PlayerYellow
+	team2[1].Number = 2
+	game.Teammates = [2]*models.Player{team1[1], team2[1]}
+	m.mirrorLocked(game)
+
 	return game
 }
 
+// GetGame returns a copy of a game taken under the lock, so it can be read
+// while moves are played, or the copy mirrored to the cluster when another
+// node hosts it
 func (m *Manager) GetGame(gameID uuid.UUID) (*models.Game, bool) {
 	m.mutex.RLock()
-	defer m.mutex.RUnlock()
-
 	game, exists := m.games[gameID]
+	if exists {
+		game = game.Clone()
+	}
+	m.mutex.RUnlock()
+
+	if !exists && m.clusterState != nil {
+		game, _ = m.remoteGame(gameID)
+		exists = game != nil
+	}
 	return game, exists
 }
 
+// PlayerGame returns the game being played the player is in, whichever node
+// hosts it
+func (m *Manager) PlayerGame(playerID uuid.UUID) (uuid.UUID, bool) {
+	m.mutex.RLock()
+	var latest *models.Game
+	for _, game := range m.games {
+		if game.State == models.GameStatePlaying && inGame(game, playerID) &&
+			(latest == nil || game.CreatedAt.After(latest.CreatedAt)) {
+			latest = game
+		}
+	}
+	m.mutex.RUnlock()
+
+	if latest != nil {
+		return latest.ID, true
+	}
+	if m.clusterState == nil {
+		return uuid.Nil, false
+	}
+
+	gameID, err := m.clusterState.cluster.PlayerGame(playerID)
+	if err != nil {
+		log.Printf("Failed to look up the game of player %s in the cluster: %v", playerID, err)
+		return uuid.Nil, false
+	}
+	if gameID == uuid.Nil {
+		return uuid.Nil, false
+	}
+	game, _ := m.remoteGame(gameID)
+	if game == nil || game.State != models.GameStatePlaying {
+		return uuid.Nil, false
+	}
+	return gameID, true
+}
+
 func (m *Manager) MakeMove(gameID uuid.UUID, playerID uuid.UUID, column int) (*models.Move, error) {
+	delta, err := m.PlayMove(gameID, playerID, column)
+	if err != nil {
+		return nil, err
+	}
+	return delta.Move, nil
+}
+
+// PlayMove makes a move and returns the resulting change to the game, taken
+// under the lock so it matches the game version exactly
+func (m *Manager) PlayMove(gameID uuid.UUID, playerID uuid.UUID, column int) (*models.GameDeltaPayload, error) {
+	if m.hostedElsewhere(gameID) {
+		return m.playRemoteMove(gameID, playerID, column)
+	}
+	return m.playMove(gameID, playerID, column)
+}
+
+// playMove makes a move in a game hosted by this node
+func (m *Manager) playMove(gameID uuid.UUID, playerID uuid.UUID, column int) (*models.GameDeltaPayload, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -87,10 +279,13 @@ func (m *Manager) MakeMove(gameID uuid.UUID, playerID uuid.UUID, column int) (*m
 	if game.State != models.GameStatePlaying {
 		return nil, ErrGameNotActive
 	}
+	if game.Paused {
+		return nil, ErrGamePaused
+	}
 
 	// Find player and check if it's their turn
 	var player *models.Player
-	for _, p := range game.Players {
+	for _, p := range game.AllPlayers() {
 		if p.ID == playerID {
 			player = p
 			break
@@ -102,10 +297,10 @@ func (m *Manager) MakeMove(gameID uuid.UUID, playerID uuid.UUID, column int) (*m
 	}
 
 	// Debug logging
-	log.Printf("DEBUG: Player %s (Color: %d, Number: %d) trying to move. Current turn: %d (Number: %d)", 
+	logging.Debugf("Player %s (Color: %d, Number: %d) trying to move. Current turn: %d (Number: %d)", 
 		player.Name, player.Color, player.Number, game.CurrentTurn, game.CurrentTurnNumber)
 
-	if player.Color != game.CurrentTurn {
+	if player.Color != game.CurrentTurn || game.PlayerToMove().ID != playerID {
 		return nil, ErrNotPlayerTurn
 	}
 
@@ -116,16 +311,19 @@ func (m *Manager) MakeMove(gameID uuid.UUID, playerID uuid.UUID, column int) (*m
 	}
 
 	move.PlayerID = playerID
+	game.Moves = append(game.Moves, move)
 
 	// Check if someone won
 	if winner := game.CheckWinner(); winner != nil {
 		game.Winner = winner
 		game.State = models.GameStateFinished
+		game.EndReason = models.EndReasonConnectFour
 		now := time.Now()
 		game.FinishedAt = &now
 	} else if game.IsBoardFull() {
 		// It's a draw
 		game.State = models.GameStateFinished
+		game.EndReason = models.EndReasonBoardFull
 		now := time.Now()
 		game.FinishedAt = &now
 	} else {
@@ -137,52 +335,503 @@ func (m *Manager) MakeMove(gameID uuid.UUID, playerID uuid.UUID, column int) (*m
 			game.CurrentTurn = models.PlayerRed
 			game.CurrentTurnNumber = 1
 		}
+		game.TurnStartedAt = time.Now()
+	}
+
+	delta := m.recordChange(game, move)
+	if game.State == models.GameStateFinished {
+		m.notifyGameEnd(game)
 	}
+	return delta, nil
+}
 
-	return move, nil
+// recordChange bumps the game version, logs the change for GameEvents and
+// mirrors the game to the cluster; callers must hold the mutex
+func (m *Manager) recordChange(game *models.Game, move *models.Move) *models.GameDeltaPayload {
+	game.Version++
+	delta := game.Delta(move)
+	m.events[game.ID] = append(m.events[game.ID], delta)
+	m.mirrorLocked(game)
+	return delta
+}
+
+// GameEvents returns the changes to a game after version since, oldest first.
+// The changes right after since may no longer be known, as for games restored
+// after a restart, in which case the result is not complete.
+func (m *Manager) GameEvents(gameID uuid.UUID, since int) (*models.GameEvents, error) {
+	if m.hostedElsewhere(gameID) {
+		return m.remoteGameEvents(gameID, since)
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	game, exists := m.games[gameID]
+	if !exists {
+		return nil, ErrGameNotFound
+	}
+
+	result := &models.GameEvents{
+		GameID:   gameID,
+		Version:  game.Version,
+		Events:   []*models.GameDeltaPayload{},
+		Complete: true,
+	}
+	if since >= game.Version {
+		return result, nil
+	}
+
+	for _, delta := range m.events[gameID] {
+		if delta.Version > since {
+			result.Events = append(result.Events, delta)
+		}
+	}
+	result.Complete = len(result.Events) > 0 && result.Events[0].Version == since+1
+	return result, nil
+}
+
+// ActiveGames returns copies of the games being played, taken under the lock
+func (m *Manager) ActiveGames() []*models.Game {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	games := make([]*models.Game, 0, len(m.games))
+	for _, game := range m.games {
+		if game.State == models.GameStatePlaying {
+			games = append(games, game.Clone())
+		}
+	}
+	return games
+}
+
+// ActiveGameCount returns how many games are being played
+func (m *Manager) ActiveGameCount() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	count := 0
+	for _, game := range m.games {
+		if game.State == models.GameStatePlaying {
+			count++
+		}
+	}
+	return count
+}
+
+// DrainCounts returns the games in progress a drain waits for, and the paused
+// ones it doesn't: they wait on players who may not come back, and are saved
+// by PauseGames for the restart instead
+func (m *Manager) DrainCounts() (playing, paused int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, game := range m.games {
+		if game.State != models.GameStatePlaying {
+			continue
+		}
+		if game.Paused {
+			paused++
+		} else {
+			playing++
+		}
+	}
+	return playing, paused
+}
+
+// GameConnections returns how many devices each connected player of a game
+// has and how many spectators are watching, on this node for a game hosted
+// by another
+func (m *Manager) GameConnections(gameID uuid.UUID) (map[uuid.UUID]int, int, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, exists := m.games[gameID]
+	if !exists && m.clusterState == nil {
+		return nil, 0, ErrGameNotFound
+	}
+
+	devices := make(map[uuid.UUID]int)
+	for playerID, playerConn := range m.players {
+		if playerConn.GameID == gameID {
+			devices[playerID] = len(playerConn.Devices())
+		}
+	}
+	return devices, len(m.spectators[gameID]), nil
+}
+
+// EndGame finishes a game in progress without it being played out, won by
+// the given color or drawn when winner is nil
+func (m *Manager) EndGame(gameID uuid.UUID, winner *models.PlayerColor) (*models.Game, error) {
+	if m.hostedElsewhere(gameID) {
+		return m.endRemoteGame(gameID, winner)
+	}
+	return m.endGame(gameID, winner)
+}
+
+// endGame finishes a game hosted by this node
+func (m *Manager) endGame(gameID uuid.UUID, winner *models.PlayerColor) (*models.Game, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	game, exists := m.games[gameID]
+	if !exists {
+		return nil, ErrGameNotFound
+	}
+	if game.State != models.GameStatePlaying {
+		return nil, ErrGameNotActive
+	}
+
+	game.Winner = winner
+	game.State = models.GameStateFinished
+	game.EndReason = models.EndReasonAdmin
+	now := time.Now()
+	game.FinishedAt = &now
+	game.Paused = false
+	m.recordChange(game, nil)
+	m.notifyGameEnd(game)
+
+	return game, nil
+}
+
+// OnGameEnd registers a listener that is called whenever a game finishes,
+// with a copy of the game as it ended. Listeners run on goroutines of their
+// own, each with a copy it may keep.
+func (m *Manager) OnGameEnd(listener func(*models.Game)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.gameEndListeners = append(m.gameEndListeners, listener)
+}
+
+// notifyGameEnd hands each listener a copy of the finished game, taken once
+// its final version is recorded; callers must hold the mutex
+func (m *Manager) notifyGameEnd(game *models.Game) {
+	for _, listener := range m.gameEndListeners {
+		go listener(game.Clone())
+	}
+}
+
+// AnalyzeGame grades every move of a finished game and stores the report
+func (m *Manager) AnalyzeGame(gameID uuid.UUID) (*models.GameAnalysis, error) {
+	// The analysis runs outside the lock, on a copy
+	m.mutex.RLock()
+	var game *models.Game
+	if live, exists := m.games[gameID]; exists {
+		game = live.Clone()
+	}
+	m.mutex.RUnlock()
+
+	if game == nil {
+		return nil, ErrGameNotFound
+	}
+	if game.State != models.GameStateFinished {
+		return nil, ErrGameNotFinished
+	}
+
+	analysis := AnalyzeGame(game)
+
+	m.mutex.Lock()
+	m.analyses[gameID] = analysis
+	m.mutex.Unlock()
+
+	return analysis, nil
+}
+
+// GetAnalysis returns the stored analysis for a finished game
+func (m *Manager) GetAnalysis(gameID uuid.UUID) (*models.GameAnalysis, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	analysis, exists := m.analyses[gameID]
+	return analysis, exists
 }
 
 func (m *Manager) AddPlayerConnection(playerID, gameID uuid.UUID, conn WSConnection) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	m.players[playerID] = &PlayerConnection{
-		PlayerID: playerID,
-		GameID:   gameID,
-		Conn:     conn,
-		LastSeen: time.Now(),
+	// Anything missed from an earlier game is no longer relevant
+	m.takeMissedMessages(playerID)
+	m.addPlayerConnection(playerID, gameID, conn)
+}
+
+// ReconnectPlayer re-establishes a player's connection and replays the game
+// messages they missed while disconnected. The greeting, built from the number
+// of missed messages and whether the connection only follows the game, is sent
+// first and nothing broadcast meanwhile can arrive out of order. When the
+// player is already connected to the game from another device, the connection
+// joins it read-only rather than replacing it. It returns the number of
+// replayed messages.
+func (m *Manager) ReconnectPlayer(playerID, gameID uuid.UUID, conn WSConnection, greeting func(missed int, readOnly bool) interface{}) int {
+	if m.hostedElsewhere(gameID) {
+		return m.reconnectRemotePlayer(playerID, gameID, conn, greeting)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// A player playing the game through another node takes it back here
+	m.handOffLocked(gameID, playerID, "")
+
+	if existing, exists := m.players[playerID]; exists && existing.GameID == gameID && existing.Conn != nil && existing.Conn != conn {
+		if existing.follower(conn) < 0 {
+			existing.Followers = append(existing.Followers, conn)
+		}
+		conn.WriteJSON(greeting(0, true))
+		return 0
+	}
+
+	missed := m.takeMissedMessages(playerID)
+	conn.WriteJSON(greeting(len(missed), false))
+	for _, message := range missed {
+		conn.WriteJSON(message.data)
+	}
+
+	m.addPlayerConnection(playerID, gameID, conn)
+	return len(missed)
+}
+
+// TakeControl makes one of the player's read-only devices the one that plays
+// the game, the device in control until now follows it instead. Both are told
+// with a control_changed message. A game played through another node is
+// taken back from it.
+func (m *Manager) TakeControl(playerID, gameID uuid.UUID, conn WSConnection) error {
+	if err := m.takeBackControl(playerID, gameID); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	playerConn, exists := m.players[playerID]
+	if !exists || playerConn.GameID != gameID {
+		return ErrNotPlayerDevice
+	}
+	if playerConn.Conn == conn {
+		return nil
+	}
+
+	i := playerConn.follower(conn)
+	if i < 0 {
+		return ErrNotPlayerDevice
+	}
+
+	previous := playerConn.Conn
+	followers := make([]WSConnection, 0, len(playerConn.Followers))
+	followers = append(followers, playerConn.Followers[:i]...)
+	followers = append(followers, playerConn.Followers[i+1:]...)
+	if previous != nil {
+		followers = append(followers, previous)
+	}
+	playerConn.Followers = followers
+	playerConn.Conn = conn
+
+	conn.WriteJSON(controlChanged(playerConn, true, "This device now controls the game"))
+	if previous != nil {
+		previous.WriteJSON(controlChanged(playerConn, false, "Another device took control, following the game read-only"))
+	}
+	return nil
+}
+
+// UpdateLatency records the latency measured to the player's device, which is
+// shown to everyone in the game. It returns the game and player, with the
+// latency recorded before, when the player is in a game being played.
+func (m *Manager) UpdateLatency(playerID uuid.UUID, latency time.Duration) (*models.Game, *models.Player, time.Duration) {
+	if playerConn, exists := m.GetPlayerConnection(playerID); exists && m.hostedElsewhere(playerConn.GameID) {
+		return m.updateRemoteLatency(playerConn.GameID, playerID, latency)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	playerConn, exists := m.players[playerID]
+	if !exists {
+		return nil, nil, 0
+	}
+
+	game, exists := m.games[playerConn.GameID]
+	if !exists || game.State != models.GameStatePlaying {
+		return nil, nil, 0
+	}
+
+	for _, player := range game.AllPlayers() {
+		if player.ID == playerID {
+			previous := time.Duration(player.LatencyMs) * time.Millisecond
+			player.LatencyMs = int(latency.Milliseconds())
+			m.mirrorLocked(game)
+			return game, player, previous
+		}
+	}
+	return nil, nil, 0
+}
+
+// IsFollower reports whether the connection is one of the player's read-only
+// devices, which can't play moves
+func (m *Manager) IsFollower(playerID uuid.UUID, conn WSConnection) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	playerConn, exists := m.players[playerID]
+	return exists && playerConn.follower(conn) >= 0
+}
+
+func controlChanged(playerConn *PlayerConnection, controller bool, message string) models.WSMessage {
+	return models.NewWSMessage(models.MsgControlChanged, models.ControlChangedPayload{
+		GameID:     playerConn.GameID,
+		PlayerID:   playerConn.PlayerID,
+		Controller: controller,
+		Message:    message,
+	})
+}
+
+// addPlayerConnection registers the connection; callers must hold the mutex
+func (m *Manager) addPlayerConnection(playerID, gameID uuid.UUID, conn WSConnection) {
+	existing, exists := m.players[playerID]
+	if exists && existing.GameID == gameID && existing.Conn == nil {
+		// The devices following the game played through another node keep
+		// following it
+		existing.Conn = conn
+		existing.LastSeen = time.Now()
+	} else {
+		m.players[playerID] = &PlayerConnection{
+			PlayerID: playerID,
+			GameID:   gameID,
+			Conn:     conn,
+			LastSeen: time.Now(),
+		}
+	}
+	if exists && existing.GameID != gameID {
+		m.unfollowLocked(existing.GameID)
 	}
 
 	// Update player connection status in game
 	if game, exists := m.games[gameID]; exists {
-		for _, player := range game.Players {
-			if player.ID == playerID {
-				player.Connected = true
-				player.LastSeen = time.Now()
-				break
-			}
+		if m.clusterState != nil {
+			delete(m.clusterState.elsewhere, playerID)
 		}
+		m.markConnectedLocked(game, playerID)
 	}
 }
 
-func (m *Manager) RemovePlayerConnection(playerID uuid.UUID) {
+// markConnectedLocked marks a player of a hosted game connected, resuming
+// the game if it was paused for them; callers must hold the mutex
+func (m *Manager) markConnectedLocked(game *models.Game, playerID uuid.UUID) {
+	delete(m.countdowns, playerID)
+
+	for _, player := range game.AllPlayers() {
+		if player.ID == playerID {
+			player.Connected = true
+			player.LastSeen = time.Now()
+			break
+		}
+	}
+
+	// A game paused for a disconnect resumes once everyone is back
+	if game.Paused && game.State == models.GameStatePlaying && allConnected(game) {
+		game.Paused = false
+		game.TurnStartedAt = time.Now()
+		delta := m.recordChange(game, nil)
+		m.broadcastLocked(game, models.NewWSMessage(models.MsgGameDelta, delta), true)
+		log.Printf("Resumed game %s, every player is back", game.ID)
+		return
+	}
+	m.mirrorLocked(game)
+}
+
+// allConnected reports whether every human player of the game is connected
+func allConnected(game *models.Game) bool {
+	for _, player := range game.AllPlayers() {
+		if !player.IsBot && !player.Connected {
+			return false
+		}
+	}
+	return true
+}
+
+// SetDisconnectConfig changes the grace period and adjudication of games
+// whose players disconnect
+func (m *Manager) SetDisconnectConfig(config DisconnectConfig) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	m.disconnectConfig = config
+}
+
+// SetRankedTurnTimeLimit changes the time players have to move in ranked
+// games created from now on, 0 to play them untimed
+func (m *Manager) SetRankedTurnTimeLimit(limit time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.rankedTurnTimeLimit = limit
+}
+
+// DisconnectPolicy returns the policy for games of the queue type
+func (m *Manager) DisconnectPolicy(queueType models.QueueType) DisconnectPolicy {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.disconnectConfig.Policy(queueType)
+}
+
+// RemovePlayerConnection drops one of the player's devices. A read-only
+// device just stops following; when the controlling device leaves, the
+// longest following one takes over. Only once the last device is gone is the
+// player marked disconnected, and then the game and player are returned if
+// they dropped out of a game still being played, so the opponent can be told.
+func (m *Manager) RemovePlayerConnection(playerID uuid.UUID, device WSConnection) (*models.Game, *models.Player) {
+	if gameID, left := m.leaveRemoteGame(playerID, device); left {
+		return m.disconnectRemotePlayer(gameID, playerID)
+	}
 
-	if conn, exists := m.players[playerID]; exists {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var activeGame *models.Game
+	var disconnected *models.Player
+
+	conn, exists := m.players[playerID]
+	if exists && conn.Conn != device {
+		// Not the controlling device, the player stays connected
+		if i := conn.follower(device); i >= 0 {
+			followers := make([]WSConnection, 0, len(conn.Followers)-1)
+			followers = append(followers, conn.Followers[:i]...)
+			conn.Followers = append(followers, conn.Followers[i+1:]...)
+		}
+		if conn.Conn == nil && len(conn.Followers) == 0 {
+			// The player plays the game through another node
+			delete(m.players, playerID)
+			m.unfollowLocked(conn.GameID)
+		}
+		return nil, nil
+	}
+	if exists && len(conn.Followers) > 0 {
+		conn.Conn = conn.Followers[0]
+		conn.Followers = conn.Followers[1:]
+		conn.Conn.WriteJSON(controlChanged(conn, true, "Your other device left, this device now controls the game"))
+		return nil, nil
+	}
+
+	if exists {
 		// Update player connection status in game
-		if game, exists := m.games[conn.GameID]; exists {
-			for _, player := range game.Players {
+		if game, exists := m.games[conn.GameID]; exists && !m.connectedElsewhere(playerID) {
+			for _, player := range game.AllPlayers() {
 				if player.ID == playerID {
 					player.Connected = false
 					player.LastSeen = time.Now()
+					m.mirrorLocked(game)
+
+					if game.State == models.GameStatePlaying {
+						activeGame = game
+						disconnected = player
+					}
 					break
 				}
 			}
 		}
 
 		delete(m.players, playerID)
+		m.unfollowLocked(conn.GameID)
 	}
+
+	return activeGame, disconnected
 }
 
 func (m *Manager) GetPlayerConnection(playerID uuid.UUID) (*PlayerConnection, bool) {
@@ -193,73 +842,407 @@ func (m *Manager) GetPlayerConnection(playerID uuid.UUID) (*PlayerConnection, bo
 	return conn, exists
 }
 
+// AddSpectator subscribes a connection to a game's broadcasts
+func (m *Manager) AddSpectator(gameID uuid.UUID, conn WSConnection) error {
+	if _, exists := m.GetGame(gameID); !exists {
+		return ErrGameNotFound
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.spectators[gameID] == nil {
+		m.spectators[gameID] = make(map[WSConnection]bool)
+	}
+	m.spectators[gameID][conn] = true
+	m.followLocked(gameID)
+	return nil
+}
+
+// RemoveSpectator stops sending a game's broadcasts to the connection
+func (m *Manager) RemoveSpectator(gameID uuid.UUID, conn WSConnection) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.spectators[gameID], conn)
+	if len(m.spectators[gameID]) == 0 {
+		delete(m.spectators, gameID)
+		m.unfollowLocked(gameID)
+	}
+}
+
+// BroadcastToGame sends a message to the game's players and spectators.
+// Disconnected players get it when they reconnect.
 func (m *Manager) BroadcastToGame(gameID uuid.UUID, message interface{}) {
+	m.broadcast(gameID, message, true)
+}
+
+// BroadcastToConnected sends a message to the game's connected players and
+// spectators only, for messages with their own history such as chat
+func (m *Manager) BroadcastToConnected(gameID uuid.UUID, message interface{}) {
+	m.broadcast(gameID, message, false)
+}
+
+func (m *Manager) broadcast(gameID uuid.UUID, message interface{}, keepMissed bool) {
 	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+	if game, exists := m.games[gameID]; exists {
+		m.sendLocked(game, message, keepMissed)
+	} else if m.clusterState != nil {
+		m.sendConnectionsLocked(gameID, message)
+	}
+	m.mutex.RUnlock()
 
-	game, exists := m.games[gameID]
-	if !exists {
-		return
+	if m.clusterState != nil {
+		m.publishBroadcast(gameID, message, keepMissed)
 	}
+}
+
+// broadcastLocked sends a message to the game's players and spectators on
+// every node; callers must hold the mutex
+func (m *Manager) broadcastLocked(game *models.Game, message interface{}, keepMissed bool) {
+	m.sendLocked(game, message, keepMissed)
+	if m.clusterState != nil {
+		m.publishBroadcast(game.ID, message, keepMissed)
+	}
+}
 
-	for _, player := range game.Players {
+// sendLocked sends a message to the players and spectators of a hosted game
+// connected to this node, keeping it for the players not connected to any;
+// callers must hold the mutex
+func (m *Manager) sendLocked(game *models.Game, message interface{}, keepMissed bool) {
+	gameID := game.ID
+	for conn := range m.spectators[gameID] {
+		conn.WriteJSON(message)
+	}
+
+	var data json.RawMessage
+	for _, player := range game.AllPlayers() {
 		if conn, exists := m.players[player.ID]; exists {
-			conn.Conn.WriteJSON(message)
+			for _, device := range conn.Devices() {
+				device.WriteJSON(message)
+			}
+			continue
+		}
+		if player.IsBot || !keepMissed || m.connectedElsewhere(player.ID) {
+			continue
+		}
+
+		// Keep the message for when the player reconnects
+		if data == nil {
+			encoded, err := json.Marshal(message)
+			if err != nil {
+				log.Printf("Failed to keep game %s message for disconnected players: %v", gameID, err)
+				return
+			}
+			data = encoded
+		}
+		m.queueMissedMessage(player.ID, data)
+	}
+}
+
+// connectedElsewhere reports whether a player of a hosted game is connected
+// through another node; callers must hold the mutex
+func (m *Manager) connectedElsewhere(playerID uuid.UUID) bool {
+	return m.clusterState != nil && m.clusterState.elsewhere[playerID] != ""
+}
+
+// queueMissedMessage keeps a message for a disconnected player, dropping the
+// oldest once MaxMissedMessages are waiting
+func (m *Manager) queueMissedMessage(playerID uuid.UUID, data json.RawMessage) {
+	m.missedMutex.Lock()
+	defer m.missedMutex.Unlock()
+
+	queued := append(m.missed[playerID], missedMessage{data: data, queuedAt: time.Now()})
+	if len(queued) > MaxMissedMessages {
+		queued = queued[len(queued)-MaxMissedMessages:]
+	}
+	m.missed[playerID] = queued
+}
+
+// takeMissedMessages removes and returns the player's messages that haven't expired
+func (m *Manager) takeMissedMessages(playerID uuid.UUID) []missedMessage {
+	m.missedMutex.Lock()
+	defer m.missedMutex.Unlock()
+
+	queued := m.missed[playerID]
+	delete(m.missed, playerID)
+
+	cutoff := time.Now().Add(-MissedMessageTTL)
+	for len(queued) > 0 && queued[0].queuedAt.Before(cutoff) {
+		queued = queued[1:]
+	}
+	return queued
+}
+
+// expireMissedMessages drops messages kept for players who never came back
+func (m *Manager) expireMissedMessages() {
+	m.missedMutex.Lock()
+	defer m.missedMutex.Unlock()
+
+	cutoff := time.Now().Add(-MissedMessageTTL)
+	for playerID, queued := range m.missed {
+		if queued[len(queued)-1].queuedAt.Before(cutoff) {
+			delete(m.missed, playerID)
 		}
 	}
 }
 
 func (m *Manager) cleanupRoutine() {
-	ticker := time.NewTicker(30 * time.Second)
+	// Every second, so grace periods end on time and the countdown keeps up
+	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for now := range ticker.C {
 		m.cleanupDisconnectedPlayers()
+		m.expireMissedMessages()
+		m.expireFinishedGames(now)
+	}
+}
+
+// expireFinishedGames forgets the games that finished FinishedGameTTL ago,
+// their changes, analyses and spectators. The game history keeps them.
+func (m *Manager) expireFinishedGames(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cutoff := now.Add(-FinishedGameTTL)
+	for gameID, game := range m.games {
+		if game.State != models.GameStateFinished || game.FinishedAt == nil || game.FinishedAt.After(cutoff) {
+			continue
+		}
+		delete(m.games, gameID)
+		delete(m.events, gameID)
+		delete(m.analyses, gameID)
+		delete(m.spectators, gameID)
 	}
 }
 
+// cleanupDisconnectedPlayers counts down the grace period of disconnected
+// players and adjudicates their games once it runs out
 func (m *Manager) cleanupDisconnectedPlayers() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	now := time.Now()
-	gracePeriod := 30 * time.Second
+	for _, game := range m.games {
+		if game.State != models.GameStatePlaying || game.Paused {
+			continue
+		}
 
-	for gameID, game := range m.games {
+		policy := m.disconnectConfig.Policy(game.QueueType)
+		for _, player := range game.AllPlayers() {
+			if player.IsBot || player.Connected {
+				continue
+			}
+
+			if remaining := policy.GracePeriod - now.Sub(player.LastSeen); remaining > 0 {
+				m.sendCountdown(game, player, remaining, policy)
+				continue
+			}
+
+			m.adjudicateDisconnect(game, player, policy)
+			break
+		}
+	}
+}
+
+// sendCountdown tells the players still connected how long a disconnected
+// player has left, every five seconds and then every second; callers must
+// hold the mutex
+func (m *Manager) sendCountdown(game *models.Game, player *models.Player, remaining time.Duration, policy DisconnectPolicy) {
+	seconds := int(math.Ceil(remaining.Seconds()))
+
+	step := seconds
+	if seconds > 5 {
+		step = (seconds + 4) / 5 * 5
+	}
+	if m.countdowns[player.ID] == step {
+		return
+	}
+	m.countdowns[player.ID] = step
+
+	m.broadcastLocked(game, models.NewWSMessage(models.MsgDisconnectTimer, models.DisconnectCountdownPayload{
+		GameID:           game.ID,
+		Player:           player,
+		RemainingSeconds: seconds,
+		Adjudication:     string(policy.Adjudication),
+	}), false)
+}
+
+// adjudicateDisconnect applies the policy to a game whose disconnected player
+// ran out of time; callers must hold the mutex
+func (m *Manager) adjudicateDisconnect(game *models.Game, disconnected *models.Player, policy DisconnectPolicy) {
+	for _, player := range game.AllPlayers() {
+		delete(m.countdowns, player.ID)
+	}
+
+	if policy.Adjudication == AdjudicatePause {
+		game.Paused = true
+		delta := m.recordChange(game, nil)
+		m.broadcastLocked(game, models.NewWSMessage(models.MsgGameDelta, delta), true)
+		log.Printf("Paused game %s until its disconnected players return", game.ID)
+		return
+	}
+
+	// A connected player of the other color wins, unless the policy calls it a draw
+	var winner *models.Player
+	if policy.Adjudication == AdjudicateWin {
+		for _, player := range game.AllPlayers() {
+			if player.Connected && player.Color != disconnected.Color {
+				winner = player
+				break
+			}
+		}
+	}
+
+	game.State = models.GameStateFinished
+	game.EndReason = models.EndReasonDisconnect
+	now := time.Now()
+	game.FinishedAt = &now
+	if winner != nil {
+		color := winner.Color
+		game.Winner = &color
+	}
+	m.recordChange(game, nil)
+	m.notifyGameEnd(game)
+
+	m.broadcastLocked(game, models.NewWSMessage(models.MsgGameEnd, models.GameEndPayload{
+		GameID:    game.ID,
+		GameState: game,
+		Winner:    winner,
+		Reason:    "Player disconnected",
+		Duration:  int(now.Sub(game.CreatedAt).Seconds()),
+		IsDraw:    winner == nil,
+	}), true)
+}
+
+func (m *Manager) turnTimerRoutine() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.expireTurnTimers()
+	}
+}
+
+// expireTurnTimers forfeits timed games whose current player ran out of time
+func (m *Manager) expireTurnTimers() {
+	m.mutex.Lock()
+
+	now := time.Now()
+	var expired []*models.Game
+
+	for _, game := range m.games {
+		if game.State != models.GameStatePlaying || game.Paused || game.TurnTimeLimit == 0 {
+			continue
+		}
+
+		if now.Sub(game.TurnStartedAt) < time.Duration(game.TurnTimeLimit)*time.Second {
+			continue
+		}
+
+		// The player who ran out of time loses
+		winner := models.PlayerRed
+		if game.CurrentTurn == models.PlayerRed {
+			winner = models.PlayerYellow
+		}
+
+		game.Winner = &winner
+		game.State = models.GameStateFinished
+		game.EndReason = models.EndReasonTurnTimer
+		finishedAt := now
+		game.FinishedAt = &finishedAt
+		m.recordChange(game, nil)
+		m.notifyGameEnd(game)
+
+		expired = append(expired, game)
+	}
+
+	m.mutex.Unlock()
+
+	// Broadcast outside the lock, BroadcastToGame acquires it itself
+	for _, game := range expired {
+		m.BroadcastToGame(game.ID, models.WSMessage{
+			Type: models.MsgGameEnd,
+			Payload: models.GameEndPayload{
+				GameID:    game.ID,
+				Winner:    game.Players[*game.Winner],
+				GameState: game,
+				Reason:    "Turn timer expired",
+				Duration:  int(game.FinishedAt.Sub(game.CreatedAt).Seconds()),
+				IsDraw:    false,
+			},
+		})
+	}
+}
+
+// SetGameStore sets where games in progress are saved by PauseGames and
+// restored from by RestoreGames
+func (m *Manager) SetGameStore(store GameStore) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.gameStore = store
+}
+
+// PauseGames stops every game in progress for a shutdown and saves them so
+// RestoreGames can pick them up after the restart. It returns the paused games.
+func (m *Manager) PauseGames() ([]*models.Game, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var paused []*models.Game
+	for _, game := range m.games {
 		if game.State != models.GameStatePlaying {
 			continue
 		}
+		game.Paused = true
+		paused = append(paused, game)
+	}
 
-		// Check if any player has been disconnected too long
-		for _, player := range game.Players {
-			if !player.Connected && now.Sub(player.LastSeen) > gracePeriod {
-				// End game due to disconnection
-				game.State = models.GameStateFinished
-				now := time.Now()
-				game.FinishedAt = &now
+	if m.gameStore == nil || len(paused) == 0 {
+		return paused, nil
+	}
 
-				// Determine winner (the connected player wins)
-				for _, p := range game.Players {
-					if p.Connected {
-						game.Winner = &p.Color
-						break
-					}
-				}
+	if err := m.gameStore.SaveGameSnapshot(paused); err != nil {
+		return paused, fmt.Errorf("failed to save games: %w", err)
+	}
 
-				// Broadcast game end
-				m.BroadcastToGame(gameID, models.WSMessage{
-					Type: models.MsgGameEnd,
-					Payload: models.GameEndPayload{
-						GameID:    gameID,
-						GameState: game,
-						Winner:    nil, // Will be set based on game.Winner
-						Reason:    "Player disconnected",
-						Duration:  0, // Calculate if needed
-						IsDraw:    false,
-					},
-				})
-				break
+	log.Printf("Saved %d games in progress", len(paused))
+	return paused, nil
+}
+
+// RestoreGames resumes the games saved before a restart. Human players start
+// out disconnected with a full grace period to reconnect, and the player to
+// move gets a fresh turn timer.
+func (m *Manager) RestoreGames() ([]*models.Game, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.gameStore == nil {
+		return nil, nil
+	}
+
+	games, err := m.gameStore.LoadGameSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore games: %w", err)
+	}
+
+	now := time.Now()
+	for _, game := range games {
+		game.Paused = false
+		game.TurnStartedAt = now
+		m.recordChange(game, nil)
+		for _, player := range game.AllPlayers() {
+			if !player.IsBot {
+				player.Connected = false
+				player.LastSeen = now
 			}
 		}
+		m.games[game.ID] = game
 	}
-}
\ No newline at end of file
+
+	if len(games) > 0 {
+		log.Printf("Restored %d games in progress", len(games))
+	}
+	return games, nil
+}
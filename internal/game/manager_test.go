@@ -0,0 +1,244 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// testConn is a connection that drops what it is sent
+type testConn struct{}
+
+func (testConn) WriteJSON(v interface{}) error { return nil }
+func (testConn) Close() error                  { return nil }
+
+func newTestGame(t *testing.T, m *Manager) (*models.Game, *models.Player, *models.Player) {
+	t.Helper()
+	red := &models.Player{ID: uuid.New(), Name: "red"}
+	yellow := &models.Player{ID: uuid.New(), Name: "yellow"}
+	game := m.CreateGame(red, yellow, models.QueueTypeCasual)
+	m.AddPlayerConnection(red.ID, game.ID, testConn{})
+	m.AddPlayerConnection(yellow.ID, game.ID, testConn{})
+	return game, red, yellow
+}
+
+// playColumns plays the columns in turn, red first
+func playColumns(t *testing.T, m *Manager, gameID uuid.UUID, red, yellow *models.Player, columns ...int) {
+	t.Helper()
+	for i, column := range columns {
+		player := red
+		if i%2 == 1 {
+			player = yellow
+		}
+		if _, err := m.PlayMove(gameID, player.ID, column); err != nil {
+			t.Fatalf("move %d in column %d: %v", i+1, column, err)
+		}
+	}
+}
+
+func waitForGame(t *testing.T, ended <-chan *models.Game) *models.Game {
+	t.Helper()
+	select {
+	case game := <-ended:
+		return game
+	case <-time.After(2 * time.Second):
+		t.Fatal("no game end notification")
+		return nil
+	}
+}
+
+func TestGameEndListenersGetFinalCopy(t *testing.T) {
+	m := NewManager()
+	ended := make(chan *models.Game, 1)
+	m.OnGameEnd(func(g *models.Game) {
+		// The recorder marshals the game while players disconnect
+		if _, err := json.Marshal(g); err != nil {
+			t.Error(err)
+		}
+		ended <- g
+	})
+
+	game, red, yellow := newTestGame(t, m)
+	playColumns(t, m, game.ID, red, yellow, 0, 1, 0, 1, 0, 1, 0)
+	m.RemovePlayerConnection(yellow.ID, testConn{})
+
+	finished := waitForGame(t, ended)
+	if finished == game {
+		t.Fatal("listener got the live game, not a copy")
+	}
+	if finished.State != models.GameStateFinished || finished.Winner == nil || *finished.Winner != models.PlayerRed {
+		t.Fatalf("listener got state %v winner %v, want red's win", finished.State, finished.Winner)
+	}
+
+	live, _ := m.GetGame(game.ID)
+	m.mutex.RLock()
+	version := live.Version
+	m.mutex.RUnlock()
+	if finished.Version != version {
+		t.Errorf("listener got version %d, the game ended at %d", finished.Version, version)
+	}
+	if len(finished.Moves) != 7 {
+		t.Errorf("listener got %d moves, want 7", len(finished.Moves))
+	}
+}
+
+func TestEndGameNotifiesAfterRecording(t *testing.T) {
+	m := NewManager()
+	ended := make(chan *models.Game, 1)
+	m.OnGameEnd(func(g *models.Game) { ended <- g })
+
+	game, _, _ := newTestGame(t, m)
+	if _, err := m.EndGame(game.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := waitForGame(t, ended)
+	if finished.Version != 1 {
+		t.Errorf("listener got version %d, want the ended game's 1", finished.Version)
+	}
+	if finished.Winner != nil {
+		t.Errorf("listener got winner %v for a draw", *finished.Winner)
+	}
+}
+
+func TestCloneSharesNothing(t *testing.T) {
+	winner := models.PlayerRed
+	finishedAt := time.Now()
+	move := &models.Move{Column: 3}
+	game := &models.Game{
+		Players:    [2]*models.Player{{Name: "red"}, {Name: "yellow"}},
+		Winner:     &winner,
+		FinishedAt: &finishedAt,
+		Moves:      []*models.Move{move},
+		LastMove:   move,
+	}
+
+	clone := game.Clone()
+	clone.Players[0].Connected = true
+	*clone.Winner = models.PlayerYellow
+	clone.Moves[0].Column = 4
+	clone.LastMove.Column = 5
+	clone.Board[0][0] = 1
+
+	if game.Players[0].Connected || *game.Winner != models.PlayerRed || move.Column != 3 || game.Board[0][0] != 0 {
+		t.Error("changing the clone changed the game")
+	}
+	if clone.Teammates[0] != nil {
+		t.Error("clone has teammates the game doesn't")
+	}
+}
+
+func TestEndReasons(t *testing.T) {
+	m := NewManager()
+	ended := make(chan *models.Game, 1)
+	m.OnGameEnd(func(g *models.Game) { ended <- g })
+
+	game, red, yellow := newTestGame(t, m)
+	playColumns(t, m, game.ID, red, yellow, 0, 1, 0, 1, 0, 1, 0)
+	if finished := waitForGame(t, ended); finished.EndReason != models.EndReasonConnectFour {
+		t.Errorf("a won game ended for %q", finished.EndReason)
+	}
+
+	game, _, _ = newTestGame(t, m)
+	m.EndGame(game.ID, nil)
+	if finished := waitForGame(t, ended); finished.EndReason != models.EndReasonAdmin {
+		t.Errorf("a game ended by an admin ended for %q", finished.EndReason)
+	}
+}
+
+func TestDisconnectAdjudicationSnapshot(t *testing.T) {
+	m := NewManager()
+	config := DefaultDisconnectConfig()
+	config.Default.GracePeriod = 0
+	m.SetDisconnectConfig(config)
+	ended := make(chan *models.Game, 1)
+	m.OnGameEnd(func(g *models.Game) { ended <- g })
+
+	game, red, yellow := newTestGame(t, m)
+	playColumns(t, m, game.ID, red, yellow, 3)
+	m.RemovePlayerConnection(yellow.ID, testConn{})
+	m.cleanupDisconnectedPlayers()
+
+	finished := waitForGame(t, ended)
+	if finished.EndReason != models.EndReasonDisconnect {
+		t.Fatalf("an adjudicated game ended for %q", finished.EndReason)
+	}
+	if finished.Players[models.PlayerYellow].Connected || !finished.Players[models.PlayerRed].Connected {
+		t.Error("the copy doesn't show who was connected when the game ended")
+	}
+	if finished.Winner == nil || *finished.Winner != models.PlayerRed {
+		t.Error("the connected player didn't win")
+	}
+
+	// Leaving after the game ended doesn't change the copy
+	m.RemovePlayerConnection(red.ID, testConn{})
+	if !finished.Players[models.PlayerRed].Connected {
+		t.Error("the copy changed after the game ended")
+	}
+}
+
+func TestDrainCountsSkipPausedGames(t *testing.T) {
+	m := NewManager()
+	config := DefaultDisconnectConfig()
+	config.Default.GracePeriod = 0
+	config.Default.Adjudication = AdjudicatePause
+	m.SetDisconnectConfig(config)
+
+	newTestGame(t, m)
+	_, _, yellow := newTestGame(t, m)
+	m.RemovePlayerConnection(yellow.ID, testConn{})
+	m.cleanupDisconnectedPlayers()
+
+	if playing, paused := m.DrainCounts(); playing != 1 || paused != 1 {
+		t.Errorf("DrainCounts = %d playing and %d paused, want 1 of each", playing, paused)
+	}
+	if active := m.ActiveGameCount(); active != 2 {
+		t.Errorf("ActiveGameCount = %d, want both games", active)
+	}
+}
+
+func TestExpireFinishedGames(t *testing.T) {
+	m := NewManager()
+	finished, _, _ := newTestGame(t, m)
+	playing, _, _ := newTestGame(t, m)
+	if _, err := m.EndGame(finished.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AnalyzeGame(finished.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Kept while players may still reconnect to it
+	m.expireFinishedGames(time.Now())
+	if _, exists := m.GetAnalysis(finished.ID); !exists {
+		t.Fatal("the analysis was dropped as soon as the game finished")
+	}
+	if events, err := m.GameEvents(finished.ID, 0); err != nil || len(events.Events) == 0 {
+		t.Fatalf("GameEvents of a game that just finished = %v, %v", events, err)
+	}
+
+	m.expireFinishedGames(time.Now().Add(FinishedGameTTL + time.Second))
+	if _, exists := m.GetGame(finished.ID); exists {
+		t.Error("the finished game was kept past FinishedGameTTL")
+	}
+	if _, exists := m.GetAnalysis(finished.ID); exists {
+		t.Error("the analysis was kept past FinishedGameTTL")
+	}
+	if _, err := m.GameEvents(finished.ID, 0); err != ErrGameNotFound {
+		t.Errorf("GameEvents of an expired game = %v, want %v", err, ErrGameNotFound)
+	}
+	m.mutex.RLock()
+	_, eventsKept := m.events[finished.ID]
+	m.mutex.RUnlock()
+	if eventsKept {
+		t.Error("the events of the expired game were kept")
+	}
+
+	if _, exists := m.GetGame(playing.ID); !exists {
+		t.Error("a game being played was expired")
+	}
+}
@@ -0,0 +1,161 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// HistoryStore keeps finished games. Failed saves are retried, so saving a
+// game again must not keep it twice.
+type HistoryStore interface {
+	// SaveGameResult keeps the game with its moves for replays, and records
+	// its result for the leaderboard with the ratings it changed, all or none
+	SaveGameResult(game *models.Game, ratings []*models.PlayerRating) error
+}
+
+// Rater rates finished games, handing the new ratings to save so they are
+// written with the game
+type Rater interface {
+	RecordGameWith(game *models.Game, save func(ratings []*models.PlayerRating) error) ([]models.RatingChange, error)
+}
+
+// RecorderConfig holds the limits of the finished game queue
+type RecorderConfig struct {
+	QueueSize    int           `json:"queue_size"`
+	Workers      int           `json:"workers"`
+	MaxAttempts  int           `json:"max_attempts"`  // before a game is given up on
+	RetryBackoff time.Duration `json:"retry_backoff"` // wait before the first retry, doubled for each one after
+}
+
+// DefaultRecorderConfig returns the configuration used by the game server
+func DefaultRecorderConfig() RecorderConfig {
+	return RecorderConfig{
+		QueueSize:    1000,
+		Workers:      2,
+		MaxAttempts:  5,
+		RetryBackoff: time.Second,
+	}
+}
+
+// Recorder saves finished games in the background, so ending a game never
+// waits on the database. Failed saves are retried with backoff.
+type Recorder struct {
+	config RecorderConfig
+	store  HistoryStore
+	rater  Rater // nil to save games without rating them
+
+	queue    chan *models.Game
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRecorder creates a recorder, Start begins saving the games it is given
+func NewRecorder(config RecorderConfig, store HistoryStore) *Recorder {
+	return &Recorder{
+		config:   config,
+		store:    store,
+		queue:    make(chan *models.Game, config.QueueSize),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// SetRater has the games rated as they are saved, call it before Start
+func (r *Recorder) SetRater(rater Rater) {
+	r.rater = rater
+}
+
+// Start starts the workers saving queued games
+func (r *Recorder) Start() {
+	for i := 0; i < r.config.Workers; i++ {
+		r.wg.Add(1)
+		go r.worker()
+	}
+}
+
+// Record queues a finished game to be saved. It waits while the queue is
+// full, so call it off the game loop, like OnGameEnd listeners are.
+func (r *Recorder) Record(game *models.Game) {
+	select {
+	case <-r.stopChan:
+		log.Printf("Finished game %s not saved, the recorder is closed", game.ID)
+		return
+	default:
+	}
+
+	select {
+	case r.queue <- game:
+	case <-r.stopChan:
+		log.Printf("Finished game %s not saved, the recorder is closed", game.ID)
+	}
+}
+
+// Close stops the workers and saves the games still queued, without waiting
+// between retries, until the context is done
+func (r *Recorder) Close(ctx context.Context) error {
+	close(r.stopChan)
+	r.wg.Wait()
+
+	for {
+		select {
+		case game := <-r.queue:
+			if ctx.Err() != nil {
+				return fmt.Errorf("finished games left unsaved: %w", ctx.Err())
+			}
+			r.save(game)
+		default:
+			return nil
+		}
+	}
+}
+
+func (r *Recorder) worker() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case game := <-r.queue:
+			r.save(game)
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// save saves the game, retrying until it runs out of attempts
+func (r *Recorder) save(game *models.Game) {
+	for attempt := 1; ; attempt++ {
+		err := r.saveResult(game)
+		if err == nil {
+			return
+		}
+
+		if attempt >= r.config.MaxAttempts {
+			log.Printf("Gave up saving finished game %s after %d attempts: %v", game.ID, attempt, err)
+			return
+		}
+		log.Printf("Failed to save finished game %s, retrying: %v", game.ID, err)
+
+		// Shutting down, the remaining attempts are made straight away
+		select {
+		case <-time.After(r.config.RetryBackoff << (attempt - 1)):
+		case <-r.stopChan:
+		}
+	}
+}
+
+// saveResult saves the game with the ratings it changed, or none without a rater
+func (r *Recorder) saveResult(game *models.Game) error {
+	save := func(ratings []*models.PlayerRating) error {
+		return r.store.SaveGameResult(game, ratings)
+	}
+	if r.rater == nil {
+		return save(nil)
+	}
+	_, err := r.rater.RecordGameWith(game, save)
+	return err
+}
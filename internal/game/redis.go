@@ -0,0 +1,249 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// How long mirrored games are kept in Redis: games being played as long as a
+// game could last, finished ones long enough for their players to see the end
+const (
+	mirrorPlayingTTL  = 24 * time.Hour
+	mirrorFinishedTTL = 10 * time.Minute
+)
+
+// RedisRetryInterval is how long a cluster fails fast after losing Redis
+// before trying it again
+const RedisRetryInterval = 5 * time.Second
+
+// RedisCluster is a Cluster sharing games through Redis. Games are mirrored
+// under prefix:game:<id> with the node hosting them, and prefix:player:<id>
+// holds the ID of each player's last game. Messages for a node are published
+// on prefix:node:<id>, those for the nodes following a game on
+// prefix:broadcast:<id>.
+type RedisCluster struct {
+	client *redis.Client
+	prefix string
+	node   string
+
+	subscription *redis.PubSub
+	listening    chan struct{} // closed once the subscription's messages are handled
+
+	mu        sync.Mutex
+	downUntil time.Time // zero while Redis is up
+}
+
+// mirroredGame is a game as it is kept in Redis
+type mirroredGame struct {
+	Node string       `json:"node"`
+	Game *models.Game `json:"game"`
+}
+
+// NewRedisCluster connects to the Redis server in the URL, given as
+// redis[s]://[user:password@]host:6379[/db], as the node with the ID.
+// Commands share the client's pool of connections, which are opened again
+// when they drop.
+func NewRedisCluster(rawURL, prefix, node string) (*RedisCluster, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", options.Addr, err)
+	}
+	return &RedisCluster{client: client, prefix: prefix, node: node}, nil
+}
+
+func (rc *RedisCluster) Node() string {
+	return rc.node
+}
+
+func (rc *RedisCluster) gameKey(gameID uuid.UUID) string {
+	return rc.prefix + ":game:" + gameID.String()
+}
+
+func (rc *RedisCluster) playerKey(playerID uuid.UUID) string {
+	return rc.prefix + ":player:" + playerID.String()
+}
+
+func (rc *RedisCluster) nodeChannel(node string) string {
+	return rc.prefix + ":node:" + node
+}
+
+func (rc *RedisCluster) gameChannel(gameID uuid.UUID) string {
+	return rc.prefix + ":broadcast:" + gameID.String()
+}
+
+// SaveGame mirrors the game and points its human players to it with SET,
+// expiring once it can't be played anymore
+func (rc *RedisCluster) SaveGame(game *models.Game) error {
+	data, err := json.Marshal(mirroredGame{Node: rc.node, Game: game})
+	if err != nil {
+		return fmt.Errorf("failed to encode game: %w", err)
+	}
+
+	ttl := mirrorPlayingTTL
+	if game.State == models.GameStateFinished {
+		ttl = mirrorFinishedTTL
+	}
+	return rc.do(func(ctx context.Context) error {
+		_, err := rc.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, rc.gameKey(game.ID), data, ttl)
+			for _, player := range game.AllPlayers() {
+				if !player.IsBot {
+					pipe.Set(ctx, rc.playerKey(player.ID), game.ID.String(), ttl)
+				}
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// LoadGame returns the mirrored game and its node, nil when it isn't kept
+func (rc *RedisCluster) LoadGame(gameID uuid.UUID) (*models.Game, string, error) {
+	data, err := rc.get(rc.gameKey(gameID))
+	if err != nil || data == nil {
+		return nil, "", err
+	}
+
+	var mirrored mirroredGame
+	if err := json.Unmarshal(data, &mirrored); err != nil {
+		return nil, "", fmt.Errorf("failed to decode game %s: %w", gameID, err)
+	}
+	return mirrored.Game, mirrored.Node, nil
+}
+
+// PlayerGame returns the ID the player's key holds
+func (rc *RedisCluster) PlayerGame(playerID uuid.UUID) (uuid.UUID, error) {
+	data, err := rc.get(rc.playerKey(playerID))
+	if err != nil || data == nil {
+		return uuid.Nil, err
+	}
+	return uuid.ParseBytes(data)
+}
+
+// get returns the key's value with GET, nil when it isn't set
+func (rc *RedisCluster) get(key string) ([]byte, error) {
+	var data []byte
+	err := rc.do(func(ctx context.Context) error {
+		var err error
+		data, err = rc.client.Get(ctx, key).Bytes()
+		return err
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Publish sends the message with PUBLISH on the node's channel
+func (rc *RedisCluster) Publish(node string, message []byte) error {
+	return rc.do(func(ctx context.Context) error {
+		return rc.client.Publish(ctx, rc.nodeChannel(node), message).Err()
+	})
+}
+
+// PublishGame sends the message with PUBLISH on the game's channel
+func (rc *RedisCluster) PublishGame(gameID uuid.UUID, message []byte) error {
+	return rc.do(func(ctx context.Context) error {
+		return rc.client.Publish(ctx, rc.gameChannel(gameID), message).Err()
+	})
+}
+
+// Follow subscribes to the game's channel
+func (rc *RedisCluster) Follow(gameID uuid.UUID) error {
+	if rc.subscription == nil {
+		return errors.New("the cluster isn't listening")
+	}
+	return rc.subscription.Subscribe(context.Background(), rc.gameChannel(gameID))
+}
+
+// Unfollow unsubscribes from the game's channel
+func (rc *RedisCluster) Unfollow(gameID uuid.UUID) error {
+	if rc.subscription == nil {
+		return errors.New("the cluster isn't listening")
+	}
+	return rc.subscription.Unsubscribe(context.Background(), rc.gameChannel(gameID))
+}
+
+// Listen subscribes to this node's channel until the cluster is closed, and
+// calls the handler with each message, one at a time. The subscription has a
+// connection of its own and subscribes again when it drops. Messages
+// published while it is down are lost.
+func (rc *RedisCluster) Listen(handler func(message []byte)) {
+	rc.subscription = rc.client.Subscribe(context.Background(), rc.nodeChannel(rc.node))
+	rc.listening = make(chan struct{})
+	messages := rc.subscription.Channel()
+
+	go func() {
+		defer close(rc.listening)
+		for message := range messages {
+			handler([]byte(message.Payload))
+		}
+	}()
+}
+
+// Close stops listening and closes the connections
+func (rc *RedisCluster) Close() error {
+	if rc.subscription != nil {
+		rc.subscription.Close()
+		<-rc.listening
+	}
+	return rc.client.Close()
+}
+
+// do runs the commands unless Redis was lost less than RedisRetryInterval
+// ago, so games on this node don't each wait out the timeouts. Error replies
+// and missing keys don't count as losing it.
+func (rc *RedisCluster) do(commands func(ctx context.Context) error) error {
+	if !rc.up() {
+		return errors.New("redis is unavailable")
+	}
+
+	err := commands(context.Background())
+	var reply redis.Error
+	if err != nil && !errors.As(err, &reply) {
+		rc.down(err)
+	}
+	return err
+}
+
+// up reports whether Redis should be tried. Once the retry interval has
+// passed the next command tries it again.
+func (rc *RedisCluster) up() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.downUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(rc.downUntil) {
+		return false
+	}
+	rc.downUntil = time.Time{}
+	return true
+}
+
+// down fails commands fast for the retry interval
+func (rc *RedisCluster) down(err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.downUntil.IsZero() {
+		log.Printf("Cluster Redis unavailable, games hosted elsewhere can't be reached for %s: %v", RedisRetryInterval, err)
+	}
+	rc.downUntil = time.Now().Add(RedisRetryInterval)
+}
@@ -0,0 +1,164 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// newTestCluster starts a Redis server for the test and connects a node to it
+func newTestCluster(t *testing.T, node string) (*RedisCluster, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	return connectTestCluster(t, server, node), server
+}
+
+func connectTestCluster(t *testing.T, server *miniredis.Miniredis, node string) *RedisCluster {
+	t.Helper()
+	cluster, err := NewRedisCluster("redis://"+server.Addr()+"/0", "connect-four:test", node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cluster.Close() })
+	return cluster
+}
+
+func TestRedisClusterMirrorsGames(t *testing.T) {
+	cluster, server := newTestCluster(t, "node-a")
+
+	red := &models.Player{ID: uuid.New(), Name: "red"}
+	bot := &models.Player{ID: uuid.New(), Name: "bot", IsBot: true}
+	game := &models.Game{ID: uuid.New(), State: models.GameStatePlaying, Players: [2]*models.Player{red, bot}}
+	if err := cluster.SaveGame(game); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, node, err := cluster.LoadGame(game.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded == nil || loaded.ID != game.ID || node != "node-a" {
+		t.Fatalf("LoadGame = %v on %q, want the game on node-a", loaded, node)
+	}
+	if ttl := server.TTL(cluster.gameKey(game.ID)); ttl != mirrorPlayingTTL {
+		t.Errorf("game expires in %v, want %v", ttl, mirrorPlayingTTL)
+	}
+
+	playerGame, err := cluster.PlayerGame(red.ID)
+	if err != nil || playerGame != game.ID {
+		t.Errorf("PlayerGame(red) = %v, %v, want %v", playerGame, err, game.ID)
+	}
+	if server.Exists(cluster.playerKey(bot.ID)) {
+		t.Error("the bot's game was recorded")
+	}
+
+	// A finished game is kept a short while
+	game.State = models.GameStateFinished
+	if err := cluster.SaveGame(game); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL(cluster.gameKey(game.ID)); ttl != mirrorFinishedTTL {
+		t.Errorf("finished game expires in %v, want %v", ttl, mirrorFinishedTTL)
+	}
+}
+
+func TestRedisClusterMissingKeys(t *testing.T) {
+	cluster, _ := newTestCluster(t, "node-a")
+
+	game, node, err := cluster.LoadGame(uuid.New())
+	if game != nil || node != "" || err != nil {
+		t.Errorf("LoadGame of an unknown game = %v, %q, %v, want nothing", game, node, err)
+	}
+	gameID, err := cluster.PlayerGame(uuid.New())
+	if gameID != uuid.Nil || err != nil {
+		t.Errorf("PlayerGame of an unknown player = %v, %v, want nothing", gameID, err)
+	}
+	if !cluster.up() {
+		t.Error("missing keys took Redis down")
+	}
+}
+
+func TestRedisClusterPubSub(t *testing.T) {
+	server := miniredis.RunT(t)
+	a := connectTestCluster(t, server, "node-a")
+	b := connectTestCluster(t, server, "node-b")
+
+	if err := a.Follow(uuid.New()); err == nil {
+		t.Error("Follow before Listen succeeded")
+	}
+
+	received := make(chan string, 4)
+	b.Listen(func(message []byte) { received <- string(message) })
+	gameID := uuid.New()
+	if err := b.Follow(gameID); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the game's channel to be subscribed", func() bool {
+		return server.PubSubNumSub(b.gameChannel(gameID))[b.gameChannel(gameID)] > 0
+	})
+
+	if err := a.Publish("node-b", []byte("forwarded move")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.PublishGame(gameID, []byte("broadcast")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"forwarded move", "broadcast"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("received %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%q wasn't received", want)
+		}
+	}
+
+	if err := b.Unfollow(gameID); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the game's channel to be unsubscribed", func() bool {
+		return len(server.PubSubChannels(b.prefix+":broadcast:*")) == 0
+	})
+}
+
+// eventually waits for the condition, as Follow and Unfollow return before
+// the server has confirmed them
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisClusterFailsFastAndReconnects(t *testing.T) {
+	cluster, server := newTestCluster(t, "node-a")
+	game := &models.Game{ID: uuid.New(), State: models.GameStatePlaying}
+
+	server.Close()
+	if err := cluster.SaveGame(game); err == nil {
+		t.Fatal("SaveGame succeeded with Redis down")
+	}
+	if cluster.up() {
+		t.Fatal("losing Redis didn't fail the next commands fast")
+	}
+
+	// Once the retry interval has passed the pool connects again
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	cluster.mu.Lock()
+	cluster.downUntil = time.Now().Add(-time.Second)
+	cluster.mu.Unlock()
+	if err := cluster.SaveGame(game); err != nil {
+		t.Fatalf("SaveGame after Redis came back: %v", err)
+	}
+}
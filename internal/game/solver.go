@@ -0,0 +1,327 @@
+package game
+
+import (
+	"fmt"
+
+	"connect-four-backend/internal/models"
+)
+
+// Board dimensions used by the bitboard solver
+const (
+	solverWidth  = 7
+	solverHeight = 6
+
+	// SolverEmptyCellThreshold is the number of empty cells at or below which
+	// Expert bots switch from heuristics to the perfect-play solver
+	SolverEmptyCellThreshold = 16
+
+	solverMinScore = -(solverWidth*solverHeight)/2 + 3
+)
+
+// bitboard encodes a position with one 7-bit column per board column
+// (6 playable cells plus a sentinel bit). position holds the stones of the
+// player to move, mask holds every stone on the board.
+type bitboard struct {
+	position uint64
+	mask     uint64
+	moves    int
+}
+
+// SolverResult describes the theoretical outcome of a position for the side to move
+type SolverResult struct {
+	Column  int    `json:"column"`
+	Score   int    `json:"score"`
+	Outcome string `json:"outcome"` // "win", "loss" or "draw"
+	// MovesToEnd is the number of moves the side to move still has to play
+	// before the game is decided with perfect play (0 for draws)
+	MovesToEnd int `json:"moves_to_end"`
+}
+
+// String renders the result in the form used for bot reasoning
+func (r SolverResult) String() string {
+	switch r.Outcome {
+	case "win":
+		return fmt.Sprintf("forced win in %d moves", r.MovesToEnd)
+	case "loss":
+		return fmt.Sprintf("forced loss in %d moves", r.MovesToEnd)
+	default:
+		return "theoretical draw"
+	}
+}
+
+// Solver performs exact negamax search with alpha-beta pruning over bitboards
+type Solver struct {
+	table       map[uint64]int8
+	nodeCount   int64
+	columnOrder [solverWidth]int
+}
+
+// NewSolver creates a new perfect-play solver
+func NewSolver() *Solver {
+	s := &Solver{
+		table: make(map[uint64]int8),
+	}
+
+	// Explore center columns first, they are statistically the strongest
+	for i := 0; i < solverWidth; i++ {
+		s.columnOrder[i] = solverWidth/2 + (1-2*(i%2))*(i+1)/2
+	}
+
+	return s
+}
+
+// CountEmptyCells returns the number of empty cells on the board
+func CountEmptyCells(g *models.Game) int {
+	empty := 0
+	for row := 0; row < solverHeight; row++ {
+		for col := 0; col < solverWidth; col++ {
+			if g.Board[row][col] == 0 {
+				empty++
+			}
+		}
+	}
+	return empty
+}
+
+// Solve returns the best column and its theoretical result for the given color
+func (s *Solver) Solve(g *models.Game, color models.PlayerColor) (SolverResult, error) {
+	b := newBitboard(g, color)
+	if b.moves >= solverWidth*solverHeight {
+		return SolverResult{}, ErrInvalidMove
+	}
+
+	bestColumn := -1
+	bestScore := solverMinScore - 1
+
+	for _, col := range s.columnOrder {
+		if !b.canPlay(col) {
+			continue
+		}
+
+		var score int
+		if b.isWinningMove(col) {
+			score = (solverWidth*solverHeight + 1 - b.moves) / 2
+		} else {
+			next := b
+			next.play(col)
+			score = -s.solve(next)
+		}
+
+		if score > bestScore {
+			bestScore = score
+			bestColumn = col
+		}
+	}
+
+	if bestColumn == -1 {
+		return SolverResult{}, ErrInvalidMove
+	}
+
+	return newSolverResult(bestColumn, bestScore, b.moves), nil
+}
+
+// ScoreMoves returns the exact score of every playable column (nil for full columns)
+func (s *Solver) ScoreMoves(g *models.Game, color models.PlayerColor) [solverWidth]*int {
+	var scores [solverWidth]*int
+	b := newBitboard(g, color)
+
+	for col := 0; col < solverWidth; col++ {
+		if !b.canPlay(col) {
+			continue
+		}
+
+		var score int
+		if b.isWinningMove(col) {
+			score = (solverWidth*solverHeight + 1 - b.moves) / 2
+		} else {
+			next := b
+			next.play(col)
+			score = -s.solve(next)
+		}
+		scores[col] = &score
+	}
+
+	return scores
+}
+
+// NodeCount returns the number of positions explored since the solver was created
+func (s *Solver) NodeCount() int64 {
+	return s.nodeCount
+}
+
+// solve computes the exact score using a null-window iterative search
+func (s *Solver) solve(b bitboard) int {
+	min := -(solverWidth*solverHeight - b.moves) / 2
+	max := (solverWidth*solverHeight + 1 - b.moves) / 2
+
+	for min < max {
+		med := min + (max-min)/2
+		if med <= 0 && min/2 < med {
+			med = min / 2
+		} else if med >= 0 && max/2 > med {
+			med = max / 2
+		}
+
+		r := s.negamax(b, med, med+1)
+		if r <= med {
+			max = r
+		} else {
+			min = r
+		}
+	}
+
+	return min
+}
+
+// negamax returns the score of a position within the [alpha, beta] window
+func (s *Solver) negamax(b bitboard, alpha, beta int) int {
+	s.nodeCount++
+
+	if b.moves == solverWidth*solverHeight {
+		return 0
+	}
+
+	for col := 0; col < solverWidth; col++ {
+		if b.canPlay(col) && b.isWinningMove(col) {
+			return (solverWidth*solverHeight + 1 - b.moves) / 2
+		}
+	}
+
+	max := (solverWidth*solverHeight - 1 - b.moves) / 2
+	if val, ok := s.table[b.key()]; ok {
+		max = int(val) + solverMinScore - 1
+	}
+
+	if beta > max {
+		beta = max
+		if alpha >= beta {
+			return beta
+		}
+	}
+
+	for _, col := range s.columnOrder {
+		if !b.canPlay(col) {
+			continue
+		}
+
+		next := b
+		next.play(col)
+		score := -s.negamax(next, -beta, -alpha)
+
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	s.table[b.key()] = int8(alpha - solverMinScore + 1)
+	return alpha
+}
+
+// newBitboard converts a game board into a bitboard from color's point of view
+func newBitboard(g *models.Game, color models.PlayerColor) bitboard {
+	var b bitboard
+	own := int(color) + 1
+
+	for col := 0; col < solverWidth; col++ {
+		for row := solverHeight - 1; row >= 0; row-- {
+			cell := g.Board[row][col]
+			if cell == 0 {
+				break
+			}
+
+			bit := uint64(1) << uint(col*(solverHeight+1)+(solverHeight-1-row))
+			b.mask |= bit
+			if cell == own {
+				b.position |= bit
+			}
+			b.moves++
+		}
+	}
+
+	return b
+}
+
+func (b *bitboard) canPlay(col int) bool {
+	return b.mask&topMask(col) == 0
+}
+
+func (b *bitboard) play(col int) {
+	b.position ^= b.mask
+	b.mask |= b.mask + bottomMask(col)
+	b.moves++
+}
+
+func (b *bitboard) isWinningMove(col int) bool {
+	pos := b.position
+	pos |= (b.mask + bottomMask(col)) & columnMask(col)
+	return alignment(pos)
+}
+
+func (b *bitboard) key() uint64 {
+	return b.position + b.mask
+}
+
+// alignment reports whether the given stones contain four in a row
+func alignment(pos uint64) bool {
+	// horizontal
+	m := pos & (pos >> (solverHeight + 1))
+	if m&(m>>(2*(solverHeight+1))) != 0 {
+		return true
+	}
+
+	// diagonal 1
+	m = pos & (pos >> solverHeight)
+	if m&(m>>(2*solverHeight)) != 0 {
+		return true
+	}
+
+	// diagonal 2
+	m = pos & (pos >> (solverHeight + 2))
+	if m&(m>>(2*(solverHeight+2))) != 0 {
+		return true
+	}
+
+	// vertical
+	m = pos & (pos >> 1)
+	return m&(m>>2) != 0
+}
+
+func topMask(col int) uint64 {
+	return (uint64(1) << (solverHeight - 1)) << uint(col*(solverHeight+1))
+}
+
+func bottomMask(col int) uint64 {
+	return uint64(1) << uint(col*(solverHeight+1))
+}
+
+func columnMask(col int) uint64 {
+	return ((uint64(1) << solverHeight) - 1) << uint(col*(solverHeight+1))
+}
+
+// newSolverResult converts a raw negamax score into a SolverResult
+func newSolverResult(column, score, moves int) SolverResult {
+	result := SolverResult{
+		Column: column,
+		Score:  score,
+	}
+
+	// A positive score s means the side to move wins with its (22 - s)th stone,
+	// a negative score means the opponent wins with its (22 + s)th stone
+	lastStone := solverWidth*solverHeight/2 + 1
+	ownStones := moves / 2
+	switch {
+	case score > 0:
+		result.Outcome = "win"
+		result.MovesToEnd = lastStone - score - ownStones
+	case score < 0:
+		result.Outcome = "loss"
+		result.MovesToEnd = lastStone + score - (moves - ownStones)
+	default:
+		result.Outcome = "draw"
+	}
+
+	return result
+}
@@ -0,0 +1,217 @@
+package game
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"connect-four-backend/internal/models"
+)
+
+// boardGame returns a game with the rows drawn top to bottom, R and Y for
+// the stones of each color and . for empty cells
+func boardGame(rows ...string) *models.Game {
+	game := &models.Game{}
+	for row, line := range rows {
+		for col, cell := range line {
+			switch cell {
+			case 'R':
+				game.Board[row][col] = int(models.PlayerRed) + 1
+			case 'Y':
+				game.Board[row][col] = int(models.PlayerYellow) + 1
+			}
+		}
+	}
+	return game
+}
+
+// randomEndgame plays random moves until empty cells are left, starting over
+// whenever a player connects four
+func randomEndgame(rng *rand.Rand, empty int) (*models.Game, models.PlayerColor) {
+	for {
+		game := &models.Game{}
+		color := models.PlayerRed
+		for CountEmptyCells(game) > empty && game.CheckWinner() == nil {
+			column := rng.Intn(solverWidth)
+			if game.MakeMove(column, color) != nil {
+				color = 1 - color
+			}
+		}
+		if game.CheckWinner() == nil {
+			return game, color
+		}
+	}
+}
+
+// bruteForceScore scores the position by trying every line of play on the
+// game's own board, scoring a win as the solver does: higher the sooner it
+// comes
+func bruteForceScore(game *models.Game, color models.PlayerColor) int {
+	moves := solverWidth*solverHeight - CountEmptyCells(game)
+	if moves == solverWidth*solverHeight {
+		return 0
+	}
+	best := solverMinScore - 1
+	for column := 0; column < solverWidth; column++ {
+		if score, ok := bruteForceMoveScore(game, color, column); ok && score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+func bruteForceMoveScore(game *models.Game, color models.PlayerColor, column int) (int, bool) {
+	moves := solverWidth*solverHeight - CountEmptyCells(game)
+	next := *game
+	if next.MakeMove(column, color) == nil {
+		return 0, false
+	}
+	if next.CheckWinner() != nil {
+		return (solverWidth*solverHeight + 1 - moves) / 2, true
+	}
+	return -bruteForceScore(&next, 1-color), true
+}
+
+func TestSolverTakesImmediateWin(t *testing.T) {
+	game := boardGame(
+		"....YRY",
+		"Y...RYR",
+		"Y..RRYR",
+		"RY.YRRR",
+		"YRYRYYY",
+		"YRRRYRY",
+	)
+	result, err := NewSolver().Solve(game, models.PlayerRed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Outcome != "win" || result.MovesToEnd != 1 || result.String() != "forced win in 1 moves" {
+		t.Fatalf("Solve = %+v, want a win with the next move", result)
+	}
+	game.MakeMove(result.Column, models.PlayerRed)
+	if winner := game.CheckWinner(); winner == nil || *winner != models.PlayerRed {
+		t.Errorf("column %d doesn't connect four", result.Column)
+	}
+}
+
+func TestSolverSeesForcedLoss(t *testing.T) {
+	game := boardGame(
+		"RYR...R",
+		"YYY..RY",
+		"RRR..RY",
+		"RRY..YY",
+		"RYRYRYR",
+		"YRYYRRY",
+	)
+	result, err := NewSolver().Solve(game, models.PlayerYellow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Outcome != "loss" || result.MovesToEnd != 1 || result.String() != "forced loss in 1 moves" {
+		t.Fatalf("Solve = %+v, want a loss after one more move", result)
+	}
+	// Whatever yellow plays, red connects four next
+	for column := 0; column < solverWidth; column++ {
+		next := *game
+		if next.MakeMove(column, models.PlayerYellow) == nil {
+			continue
+		}
+		if next.CheckWinner() != nil || findWinningMove(&next, models.PlayerRed) == -1 {
+			t.Errorf("yellow escapes by playing column %d", column)
+		}
+	}
+}
+
+func TestSolverFindsDraw(t *testing.T) {
+	game := boardGame(
+		"...YR..",
+		"..YYRY.",
+		"R.RRRYR",
+		"R.YYYRY",
+		"YYYRYRR",
+		"RYRRYYR",
+	)
+	result, err := NewSolver().Solve(game, models.PlayerRed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Outcome != "draw" || result.MovesToEnd != 0 || result.String() != "theoretical draw" {
+		t.Errorf("Solve = %+v, want a draw", result)
+	}
+	if want := bruteForceScore(game, models.PlayerRed); result.Score != want {
+		t.Errorf("Solve scored %d, want %d", result.Score, want)
+	}
+}
+
+func TestSolverRejectsFullBoard(t *testing.T) {
+	game := boardGame(
+		"RRYRYYR",
+		"YYRYRRY",
+		"RRYRYYR",
+		"YYRYRRY",
+		"RRYRYYR",
+		"YYRYRRY",
+	)
+	if _, err := NewSolver().Solve(game, models.PlayerYellow); err != ErrInvalidMove {
+		t.Errorf("Solve on a full board = %v, want ErrInvalidMove", err)
+	}
+}
+
+func TestSolverMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(4031))
+	for i := 0; i < 20; i++ {
+		// Both colors get to move
+		game, color := randomEndgame(rng, 9+i%2)
+		solver := NewSolver()
+
+		scores := solver.ScoreMoves(game, color)
+		for column, score := range scores {
+			want, playable := bruteForceMoveScore(game, color, column)
+			switch {
+			case !playable && score != nil:
+				t.Errorf("position %d: full column %d scored %d", i, column, *score)
+			case playable && score == nil:
+				t.Errorf("position %d: column %d wasn't scored", i, column)
+			case playable && *score != want:
+				t.Errorf("position %d: column %d scored %d, want %d", i, column, *score, want)
+			}
+		}
+
+		result, err := solver.Solve(game, color)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := bruteForceScore(game, color); result.Score != want {
+			t.Errorf("position %d: Solve scored %d, want %d", i, result.Score, want)
+		}
+		if best := scores[result.Column]; best == nil || *best != result.Score {
+			t.Errorf("position %d: Solve picked column %d, which doesn't score %d", i, result.Column, result.Score)
+		}
+		if solver.NodeCount() == 0 {
+			t.Errorf("position %d: no positions explored", i)
+		}
+	}
+}
+
+func TestExpertBotUsesSolverInEndgame(t *testing.T) {
+	rng := rand.New(rand.NewSource(4031))
+	game, color := randomEndgame(rng, SolverEmptyCellThreshold)
+
+	decision := DecideMove(game, color, BotDifficultyExpert)
+	if !strings.HasPrefix(decision.Reasoning, "Solver: ") || decision.Confidence != 100 {
+		t.Errorf("expert decision = %+v, want the solver's", decision)
+	}
+	result, err := NewSolver().Solve(game, color)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Column != result.Column {
+		t.Errorf("expert played column %d, the solver's best is %d", decision.Column, result.Column)
+	}
+
+	// Earlier in the game it plays on heuristics
+	opening := &models.Game{}
+	if decision := DecideMove(opening, models.PlayerRed, BotDifficultyExpert); strings.HasPrefix(decision.Reasoning, "Solver: ") {
+		t.Errorf("expert solved the opening: %+v", decision)
+	}
+}
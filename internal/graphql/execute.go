@@ -0,0 +1,519 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Request is a GraphQL request, as POSTed by clients
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Response is the data the query selected and the errors met. Data is
+// missing when the query couldn't run at all.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// nullData is the data of a query whose root turned null, kept apart from
+// no data at all
+var nullData = json.RawMessage("null")
+
+// Execute runs the request's query. Each root field is resolved only when
+// selected, so clients pay for what they ask for.
+func (s *Schema) Execute(ctx context.Context, request Request) *Response {
+	doc, err := parse(request.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+
+	op, err := selectOperation(doc, request.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	if errs := validate(s, request.Query, doc, op); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	variables, errs := s.coerceVariables(request.Query, op, request.Variables)
+	if len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	e := &executor{ctx: ctx, source: request.Query, doc: doc, variables: variables}
+	data, ok := e.selectionSet(s.query, nil, op.selections, []interface{}{})
+	response := &Response{Data: nullData, Errors: e.errors}
+	if ok {
+		response.Data = data
+	}
+	return response
+}
+
+func selectOperation(doc *document, name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, errors.New("operationName is required when the document has several operations")
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown operation %q", name)
+}
+
+// coerceVariables coerces the variables given to the types the operation
+// declares, filling in defaults
+func (s *Schema) coerceVariables(source string, op *operation, given map[string]interface{}) (map[string]interface{}, []*Error) {
+	variables := make(map[string]interface{})
+	var errs []*Error
+	for _, definition := range op.variables {
+		t := s.resolveTypeRef(definition.typ)
+		value, provided := given[definition.name]
+
+		var err error
+		switch {
+		case provided:
+			variables[definition.name], err = coerceValue(t, value)
+		case definition.defaultValue != nil:
+			variables[definition.name], err = coerceLiteral(t, definition.defaultValue, nil)
+		default:
+			if _, required := t.(*NonNull); required {
+				err = fmt.Errorf("a value of type %s is required", t)
+			}
+		}
+		if err != nil {
+			errs = append(errs, &Error{
+				Message:   fmt.Sprintf("Variable $%s got an invalid value: %v", definition.name, err),
+				Locations: []Location{locate(source, definition.pos)},
+			})
+		}
+	}
+	return variables, errs
+}
+
+// coerceValue coerces a variable's value, as decoded from JSON, to t
+func coerceValue(t Type, value interface{}) (interface{}, error) {
+	if nonNull, ok := t.(*NonNull); ok {
+		if value == nil {
+			return nil, fmt.Errorf("expected a non-null %s", nonNull.Of)
+		}
+		return coerceValue(nonNull.Of, value)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		values, isList := value.([]interface{})
+		if !isList {
+			values = []interface{}{value}
+		}
+		coerced := make([]interface{}, len(values))
+		for i, item := range values {
+			var err error
+			if coerced[i], err = coerceValue(t.Of, item); err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	case *Scalar:
+		coerced, ok := t.coerce(value)
+		if !ok {
+			return nil, fmt.Errorf("expected %s, got %s", t.Name, describe(value))
+		}
+		return coerced, nil
+	case *Enum:
+		name, _ := value.(string)
+		if !t.has(name) {
+			return nil, fmt.Errorf("expected one of %s, got %s", strings.Join(t.Values, ", "), describe(value))
+		}
+		return name, nil
+	}
+	return nil, fmt.Errorf("%s isn't an input type", t)
+}
+
+// coerceLiteral coerces a value written in the query to t, looking up the
+// variables it uses
+func coerceLiteral(t Type, v *value, variables map[string]interface{}) (interface{}, error) {
+	if v.kind == valueVariable {
+		return coerceValue(t, variables[v.raw])
+	}
+	if nonNull, ok := t.(*NonNull); ok {
+		if v.kind == valueNull {
+			return nil, fmt.Errorf("expected a non-null %s", nonNull.Of)
+		}
+		return coerceLiteral(nonNull.Of, v, variables)
+	}
+	if v.kind == valueNull {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		items := []*value{v}
+		if v.kind == valueList {
+			items = v.list
+		}
+		coerced := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if coerced[i], err = coerceLiteral(t.Of, item, variables); err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	case *Scalar:
+		var literal interface{}
+		switch v.kind {
+		case valueInt:
+			n, err := strconv.ParseInt(v.raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s is out of range", v.raw)
+			}
+			literal = n
+		case valueFloat:
+			f, err := strconv.ParseFloat(v.raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s is out of range", v.raw)
+			}
+			literal = f
+		case valueString:
+			literal = v.raw
+		case valueBoolean:
+			literal = v.raw == "true"
+		}
+		coerced, ok := t.coerce(literal)
+		if literal == nil || !ok {
+			return nil, fmt.Errorf("expected %s, got %s", t.Name, v)
+		}
+		return coerced, nil
+	case *Enum:
+		if v.kind != valueEnum || !t.has(v.raw) {
+			return nil, fmt.Errorf("expected one of %s, got %s", strings.Join(t.Values, ", "), v)
+		}
+		return v.raw, nil
+	}
+	return nil, fmt.Errorf("%s isn't an input type", t)
+}
+
+func (t *Enum) has(name string) bool {
+	for _, value := range t.Values {
+		if value == name {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%T", value)
+	}
+	return string(data)
+}
+
+// executor resolves the fields an operation selects. A field that errors
+// is null and the error is reported with its path. A field that can't be
+// null makes its parent null instead.
+type executor struct {
+	ctx       context.Context
+	source    string
+	doc       *document
+	variables map[string]interface{}
+	errors    []*Error
+}
+
+// selectionSet resolves the selected fields of source, false when one that
+// can't be null is
+func (e *executor) selectionSet(object *Object, source interface{}, selections []selection, path []interface{}) (*orderedMap, bool) {
+	result := &orderedMap{values: make(map[string]interface{})}
+	for _, group := range e.collectFields(object, selections, nil) {
+		fieldPath := append(path[:len(path):len(path)], group.key)
+		value, ok := e.field(object, source, group.fields, fieldPath)
+		if !ok {
+			return nil, false
+		}
+		result.set(group.key, value)
+	}
+	return result, true
+}
+
+// fieldGroup is the fields selected under one response key, merged
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+// collectFields flattens the fragments of the selections, in order, leaving
+// out those skipped by @include and @skip
+func (e *executor) collectFields(object *Object, selections []selection, groups []*fieldGroup) []*fieldGroup {
+	for _, s := range selections {
+		switch s := s.(type) {
+		case *field:
+			if !e.included(s.directives) {
+				continue
+			}
+			merged := false
+			for _, group := range groups {
+				if group.key == s.responseKey() {
+					group.fields = append(group.fields, s)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				groups = append(groups, &fieldGroup{key: s.responseKey(), fields: []*field{s}})
+			}
+		case *fragmentSpread:
+			frag := e.doc.fragments[s.name]
+			if e.included(s.directives) && e.included(frag.directives) {
+				groups = e.collectFields(object, frag.selections, groups)
+			}
+		case *inlineFragment:
+			if e.included(s.directives) {
+				groups = e.collectFields(object, s.selections, groups)
+			}
+		}
+	}
+	return groups
+}
+
+func (e *executor) included(directives []*directive) bool {
+	for _, d := range directives {
+		condition, _ := coerceLiteral(Boolean, d.arguments[0].value, e.variables)
+		if (d.name == "include") != (condition == true) {
+			return false
+		}
+	}
+	return true
+}
+
+// field resolves a field and completes its value, false when it is null
+// but can't be
+func (e *executor) field(object *Object, source interface{}, fields []*field, path []interface{}) (interface{}, bool) {
+	f := fields[0]
+	if f.name == "__typename" {
+		return object.Name, true
+	}
+	definition := object.field(f.name)
+	_, required := definition.Type.(*NonNull)
+
+	args, err := e.arguments(definition, f)
+	if err == nil {
+		var resolved interface{}
+		if resolved, err = e.resolve(definition, source, args); err == nil {
+			value, ok := e.complete(definition.Type, fields, resolved, path)
+			return value, ok || !required
+		}
+	}
+	e.errors = append(e.errors, &Error{
+		Message:   err.Error(),
+		Locations: []Location{locate(e.source, f.pos)},
+		Path:      path,
+	})
+	return nil, !required
+}
+
+func (e *executor) arguments(definition *Field, f *field) (Args, error) {
+	args := make(Args)
+	for _, arg := range definition.Args {
+		if arg.Default != nil {
+			args[arg.Name] = arg.Default
+		}
+	}
+	for _, given := range f.arguments {
+		// A variable that wasn't given leaves the argument to its default
+		if given.value.kind == valueVariable {
+			if _, provided := e.variables[given.value.raw]; !provided {
+				continue
+			}
+		}
+		definition := findArg(definition.Args, given.name)
+		value, err := coerceLiteral(definition.Type, given.value, e.variables)
+		if err != nil {
+			return nil, fmt.Errorf("Argument %q has an invalid value: %v", given.name, err)
+		}
+		if value == nil {
+			delete(args, given.name)
+			continue
+		}
+		args[given.name] = value
+	}
+	for _, arg := range definition.Args {
+		if _, required := arg.Type.(*NonNull); required && args[arg.Name] == nil {
+			return nil, fmt.Errorf("Argument %q of type %s is required", arg.Name, arg.Type)
+		}
+	}
+	return args, nil
+}
+
+// resolve runs the field's resolver, turning a panic into an error so one
+// bad field doesn't take down the server
+func (e *executor) resolve(definition *Field, source interface{}, args Args) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("graphql: resolver of %s panicked: %v", definition.Name, r)
+			err = errors.New("Internal error resolving " + definition.Name)
+		}
+	}()
+
+	if definition.Resolve != nil {
+		return definition.Resolve(e.ctx, source, args)
+	}
+	return defaultResolve(source, definition.Name)
+}
+
+// complete shapes a resolved value to the field's type, false when it is
+// null but can't be
+func (e *executor) complete(t Type, fields []*field, value interface{}, path []interface{}) (interface{}, bool) {
+	if nonNull, ok := t.(*NonNull); ok {
+		completed, ok := e.complete(nonNull.Of, fields, value, path)
+		if !ok {
+			return nil, false
+		}
+		if completed == nil {
+			e.errors = append(e.errors, &Error{
+				Message:   "Cannot return null for non-nullable field " + fields[0].name,
+				Locations: []Location{locate(e.source, fields[0].pos)},
+				Path:      path,
+			})
+			return nil, false
+		}
+		return completed, true
+	}
+	if isNil(value) {
+		return nil, true
+	}
+
+	switch t := t.(type) {
+	case *List:
+		items := reflect.ValueOf(value)
+		if items.Kind() != reflect.Slice && items.Kind() != reflect.Array {
+			e.errors = append(e.errors, &Error{
+				Message: fmt.Sprintf("Expected a list for %s, got %T", fields[0].name, value),
+				Path:    path,
+			})
+			return nil, true
+		}
+		_, itemRequired := t.Of.(*NonNull)
+		completed := make([]interface{}, items.Len())
+		for i := range completed {
+			itemPath := append(path[:len(path):len(path)], i)
+			item, ok := e.complete(t.Of, fields, items.Index(i).Interface(), itemPath)
+			if !ok && itemRequired {
+				return nil, false
+			}
+			completed[i] = item
+		}
+		return completed, true
+	case *Object:
+		var selections []selection
+		for _, f := range fields {
+			selections = append(selections, f.selections...)
+		}
+		result, ok := e.selectionSet(t, value, selections, path)
+		if !ok {
+			return nil, false
+		}
+		return result, true
+	default:
+		return value, true
+	}
+}
+
+// defaultResolve reads the field of a struct with the JSON name, or the key
+// of a map
+func defaultResolve(source interface{}, name string) (interface{}, error) {
+	if m, ok := source.(map[string]interface{}); ok {
+		return m[name], nil
+	}
+
+	v := reflect.ValueOf(source)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("no field %s on %T", name, source)
+	}
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		jsonName, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+		if jsonName == name || (jsonName == "" && structField.Name == name) {
+			return v.Field(i).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("no field %s on %T", name, source)
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func asError(err error) *Error {
+	var graphqlErr *Error
+	if errors.As(err, &graphqlErr) {
+		return graphqlErr
+	}
+	return &Error{Message: err.Error()}
+}
+
+// orderedMap is an object in the response, its keys in the order selected
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if _, exists := m.values[key]; !exists {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// MarshalJSON writes the keys in order
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		keyJSON, _ := json.Marshal(key)
+		b.Write(keyJSON)
+		b.WriteByte(':')
+		valueJSON, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(valueJSON)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
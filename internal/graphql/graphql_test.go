@@ -0,0 +1,424 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testPlayer struct {
+	Name     string   `json:"name"`
+	Wins     int      `json:"wins"`
+	Nickname *string  `json:"nickname,omitempty"`
+	Friends  []string `json:"-"`
+}
+
+var testPlayers = []*testPlayer{
+	{Name: "alice", Wins: 3, Friends: []string{"bob", "carol"}},
+	{Name: "bob", Wins: 2, Friends: []string{"alice"}},
+	{Name: "carol", Wins: 1},
+}
+
+func findTestPlayer(name string) *testPlayer {
+	for _, p := range testPlayers {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// newTestSchema serves testPlayers, with fields that fail in each way a
+// resolver can
+func newTestSchema(t *testing.T) *Schema {
+	order := &Enum{Name: "Order", Values: []string{"NAME", "WINS"}}
+	player := &Object{Name: "Player"}
+	player.Fields = []*Field{
+		{Name: "name", Type: NonNullOf(String)},
+		{Name: "wins", Type: NonNullOf(Int)},
+		{Name: "nickname", Type: String},
+		{Name: "friends", Type: NonNullOf(ListOf(NonNullOf(player))), Args: []*Arg{{Name: "first", Type: Int}},
+			Resolve: func(_ context.Context, source interface{}, args Args) (interface{}, error) {
+				friends := []*testPlayer{}
+				for _, name := range source.(*testPlayer).Friends {
+					friends = append(friends, findTestPlayer(name))
+				}
+				if first, ok := args.Int("first"); ok && first < len(friends) {
+					friends = friends[:first]
+				}
+				return friends, nil
+			}},
+		{Name: "rival", Type: NonNullOf(player), Description: "Never found, so the player is null",
+			Resolve: func(context.Context, interface{}, Args) (interface{}, error) {
+				return nil, nil
+			}},
+	}
+
+	query := &Object{Name: "Query", Fields: []*Field{
+		{Name: "player", Type: player, Args: []*Arg{{Name: "name", Type: NonNullOf(String)}},
+			Resolve: func(_ context.Context, _ interface{}, args Args) (interface{}, error) {
+				name, _ := args.String("name")
+				if p := findTestPlayer(name); p != nil {
+					return p, nil
+				}
+				return nil, nil
+			}},
+		{Name: "players", Type: NonNullOf(ListOf(NonNullOf(player))),
+			Args: []*Arg{{Name: "order", Type: order, Default: "NAME"}, {Name: "limit", Type: Int, Default: 10}},
+			Resolve: func(_ context.Context, _ interface{}, args Args) (interface{}, error) {
+				players := append([]*testPlayer(nil), testPlayers...)
+				if order, _ := args.String("order"); order == "NAME" {
+					players[0], players[len(players)-1] = players[len(players)-1], players[0]
+				}
+				if limit, ok := args.Int("limit"); ok && limit < len(players) {
+					players = players[:limit]
+				}
+				return players, nil
+			}},
+		{Name: "echo", Type: String, Args: []*Arg{
+			{Name: "int", Type: Int}, {Name: "float", Type: Float}, {Name: "id", Type: ID},
+			{Name: "list", Type: ListOf(Int)}, {Name: "ids", Type: ListOf(ID)}, {Name: "flag", Type: Boolean},
+		},
+			Resolve: func(_ context.Context, _ interface{}, args Args) (interface{}, error) {
+				data, err := json.Marshal(args)
+				return string(data), err
+			}},
+		{Name: "failing", Type: String,
+			Resolve: func(context.Context, interface{}, Args) (interface{}, error) {
+				return nil, errors.New("the store is down")
+			}},
+		{Name: "panicking", Type: String,
+			Resolve: func(context.Context, interface{}, Args) (interface{}, error) {
+				panic("resolver bug")
+			}},
+		{Name: "required", Type: NonNullOf(String),
+			Resolve: func(context.Context, interface{}, Args) (interface{}, error) {
+				return nil, errors.New("required but failed")
+			}},
+	}}
+
+	schema, err := NewSchema(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func execute(t *testing.T, schema *Schema, request Request) string {
+	t.Helper()
+	data, err := json.Marshal(schema.Execute(context.Background(), request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseErrors(t *testing.T) {
+	schema := newTestSchema(t)
+	tests := []struct {
+		query, want string
+	}{
+		{`{ player(name: "alice") { name }`,
+			`{"errors":[{"message":"Syntax error: unexpected end of query","locations":[{"line":1,"column":33}]}]}`},
+		{"{\n  players { name ^ }\n}",
+			`{"errors":[{"message":"Syntax error: unexpected character '^'","locations":[{"line":2,"column":18}]}]}`},
+		{`{ echo(id: "unterminated) }`,
+			`{"errors":[{"message":"Syntax error: unterminated string","locations":[{"line":1,"column":12}]}]}`},
+		{`{ echo(int: 1.) }`,
+			`{"errors":[{"message":"Syntax error: invalid number","locations":[{"line":1,"column":13}]}]}`},
+		{`{ echo() }`,
+			`{"errors":[{"message":"Syntax error: an argument list can't be empty","locations":[{"line":1,"column":8}]}]}`},
+		{`fragment F on Player { name }`,
+			`{"errors":[{"message":"Syntax error: the document has no operation","locations":[{"line":1,"column":1}]}]}`},
+		{`{ players { ...F } } fragment F on Player { name } fragment F on Player { wins }`,
+			`{"errors":[{"message":"Syntax error: there can be only one fragment named \"F\"","locations":[{"line":1,"column":52}]}]}`},
+	}
+	for _, tt := range tests {
+		if got := execute(t, schema, Request{Query: tt.query}); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	schema := newTestSchema(t)
+	tests := []struct {
+		query, want string
+	}{
+		{`{ players { name score } }`,
+			`{"errors":[{"message":"Cannot query field \"score\" on type Player","locations":[{"line":1,"column":18}]}]}`},
+		{`{ player(name: "alice", team: "red") { name } }`,
+			`{"errors":[{"message":"Unknown argument \"team\" on \"player\"","locations":[{"line":1,"column":25}]}]}`},
+		{`{ player { name } }`,
+			`{"errors":[{"message":"Argument \"name\" of type String! is required on \"player\"","locations":[{"line":1,"column":3}]}]}`},
+		{`{ player(name: 7) { name } }`,
+			`{"errors":[{"message":"Argument \"name\" of \"player\" has an invalid value: expected String, got 7","locations":[{"line":1,"column":10}]}]}`},
+		{`{ players(order: LOSSES) { name } }`,
+			`{"errors":[{"message":"Argument \"order\" of \"players\" has an invalid value: expected one of NAME, WINS, got LOSSES","locations":[{"line":1,"column":11}]}]}`},
+		{`{ echo(int: 3000000000) }`,
+			`{"errors":[{"message":"Argument \"int\" of \"echo\" has an invalid value: expected Int, got 3000000000","locations":[{"line":1,"column":8}]}]}`},
+		{`{ players }`,
+			`{"errors":[{"message":"Field \"players\" of type [Player!]! must have a selection of subfields","locations":[{"line":1,"column":3}]}]}`},
+		{`{ echo { name } }`,
+			`{"errors":[{"message":"Field \"echo\" of type String can't have a selection of subfields","locations":[{"line":1,"column":3}]}]}`},
+		{`{ players { ...Missing } }`,
+			`{"errors":[{"message":"Unknown fragment \"Missing\"","locations":[{"line":1,"column":13}]}]}`},
+		{`{ players { ...A } } fragment A on Player { ...B } fragment B on Player { ...A }`,
+			`{"errors":[{"message":"Fragment \"A\" spreads itself","locations":[{"line":1,"column":75}]}]}`},
+		{`{ ...P } fragment P on Player { name }`,
+			`{"errors":[{"message":"Fragment \"P\" on Player can't be spread on Query","locations":[{"line":1,"column":3}]}]}`},
+		{`{ ... on Player { name } }`,
+			`{"errors":[{"message":"A fragment on Player can't be spread on Query","locations":[{"line":1,"column":3}]}]}`},
+		{`{ players { name @deprecated } }`,
+			`{"errors":[{"message":"Unknown directive @deprecated","locations":[{"line":1,"column":18}]}]}`},
+		{`{ players { name @include } }`,
+			`{"errors":[{"message":"Argument \"if\" of type Boolean! is required on \"@include\"","locations":[{"line":1,"column":18}]}]}`},
+		{`{ player(name: $name) { name } }`,
+			`{"errors":[{"message":"Variable $name is not defined","locations":[{"line":1,"column":16}]}]}`},
+		{`query ($p: Player) { players { name } }`,
+			`{"errors":[{"message":"Variable $p can't be of type Player, which isn't a scalar or enum","locations":[{"line":1,"column":8}]}]}`},
+		{`query ($p: Team) { players { name } }`,
+			`{"errors":[{"message":"Unknown type Team of variable $p","locations":[{"line":1,"column":8}]}]}`},
+		{`query ($n: Int = "one") { echo(int: $n) }`,
+			`{"errors":[{"message":"Variable $n has an invalid default value: expected Int, got \"one\"","locations":[{"line":1,"column":8}]}]}`},
+		{`query A { players { name } } query B { players { wins } }`,
+			`{"errors":[{"message":"operationName is required when the document has several operations"}]}`},
+	}
+	for _, tt := range tests {
+		if got := execute(t, schema, Request{Query: tt.query}); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTooManySelections(t *testing.T) {
+	// Each spread of F doubles the fields selected
+	query := `{ players { ...F10 } }
+fragment F0 on Player { name wins }`
+	for i := 1; i <= 10; i++ {
+		query += "\nfragment F" + strconv.Itoa(i) + " on Player { ...F" + strconv.Itoa(i-1) + " ...F" + strconv.Itoa(i-1) + " }"
+	}
+	got := execute(t, newTestSchema(t), Request{Query: query})
+	if !strings.Contains(got, "The query selects more than 2000 fields") || strings.Contains(got, `"data"`) {
+		t.Errorf("a query expanding to 4,000 fields returned %s", got)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	schema := newTestSchema(t)
+	const query = `query ($name: String!, $limit: Int = 1, $ids: [ID], $flag: Boolean) {
+  player(name: $name) { name }
+  players(limit: $limit) { name }
+  echo(list: [1, 2], id: 7, flag: $flag, float: 2)
+  ids: echo(ids: $ids)
+}`
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		want      string
+	}{
+		{"defaults", query, map[string]interface{}{"name": "bob"},
+			`{"data":{"player":{"name":"bob"},"players":[{"name":"carol"}],"echo":"{\"float\":2,\"id\":\"7\",\"list\":[1,2]}","ids":"{}"}}`},
+		{"given", query, map[string]interface{}{"name": "alice", "limit": float64(2), "ids": []interface{}{"a", float64(5)}, "flag": true},
+			`{"data":{"player":{"name":"alice"},"players":[{"name":"carol"},{"name":"bob"}],"echo":"{\"flag\":true,\"float\":2,\"id\":\"7\",\"list\":[1,2]}","ids":"{\"ids\":[\"a\",\"5\"]}"}}`},
+		{"a single value for a list", query, map[string]interface{}{"name": "alice", "ids": "a"},
+			`{"data":{"player":{"name":"alice"},"players":[{"name":"carol"}],"echo":"{\"float\":2,\"id\":\"7\",\"list\":[1,2]}","ids":"{\"ids\":[\"a\"]}"}}`},
+		{"a null overriding the default", `query ($limit: Int) { players(limit: $limit) { name } }`, map[string]interface{}{"limit": nil},
+			`{"data":{"players":[{"name":"carol"},{"name":"bob"},{"name":"alice"}]}}`},
+		{"a required variable missing", query, nil,
+			`{"errors":[{"message":"Variable $name got an invalid value: a value of type String! is required","locations":[{"line":1,"column":8}]}]}`},
+		{"a required variable null", query, map[string]interface{}{"name": nil},
+			`{"errors":[{"message":"Variable $name got an invalid value: expected a non-null String","locations":[{"line":1,"column":8}]}]}`},
+		{"the wrong type", query, map[string]interface{}{"name": "bob", "limit": "ten", "flag": float64(1)},
+			`{"errors":[{"message":"Variable $limit got an invalid value: expected Int, got \"ten\"","locations":[{"line":1,"column":24}]},{"message":"Variable $flag got an invalid value: expected Boolean, got 1","locations":[{"line":1,"column":53}]}]}`},
+		{"a fraction for an Int", query, map[string]interface{}{"name": "bob", "limit": 1.5},
+			`{"errors":[{"message":"Variable $limit got an invalid value: expected Int, got 1.5","locations":[{"line":1,"column":24}]}]}`},
+		{"an enum", `query ($order: Order!) { players(order: $order, limit: 1) { name } }`, map[string]interface{}{"order": "WINS"},
+			`{"data":{"players":[{"name":"alice"}]}}`},
+		{"an unknown enum value", `query ($order: Order!) { players(order: $order) { name } }`, map[string]interface{}{"order": "LOSSES"},
+			`{"errors":[{"message":"Variable $order got an invalid value: expected one of NAME, WINS, got \"LOSSES\"","locations":[{"line":1,"column":8}]}]}`},
+	}
+	for _, tt := range tests {
+		if got := execute(t, schema, Request{Query: tt.query, Variables: tt.variables}); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFragmentsAndDirectives(t *testing.T) {
+	schema := newTestSchema(t)
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		variables     map[string]interface{}
+		want          string
+	}{
+		{"a named fragment", `{ player(name: "alice") { ...Stats } } fragment Stats on Player { name wins }`, "", nil,
+			`{"data":{"player":{"name":"alice","wins":3}}}`},
+		{"nested fragments", `{ player(name: "alice") { ...Outer } }
+fragment Outer on Player { name friends { ...Inner } }
+fragment Inner on Player { name __typename }`, "", nil,
+			`{"data":{"player":{"name":"alice","friends":[{"name":"bob","__typename":"Player"},{"name":"carol","__typename":"Player"}]}}}`},
+		{"an inline fragment", `{ player(name: "bob") { ... on Player { name } ... { wins } } }`, "", nil,
+			`{"data":{"player":{"name":"bob","wins":2}}}`},
+		{"merged fields", `{ player(name: "alice") { friends(first: 1) { name } ...F } } fragment F on Player { friends(first: 1) { wins } }`, "", nil,
+			`{"data":{"player":{"friends":[{"name":"bob","wins":2}]}}}`},
+		{"aliases", `{ a: player(name: "alice") { who: name } b: player(name: "bob") { who: name } }`, "", nil,
+			`{"data":{"a":{"who":"alice"},"b":{"who":"bob"}}}`},
+		{"@include and @skip", `query ($yes: Boolean!) {
+  player(name: "alice") { name @include(if: $yes) wins @skip(if: $yes) nickname @include(if: false) }
+}`, "", map[string]interface{}{"yes": true},
+			`{"data":{"player":{"name":"alice"}}}`},
+		{"directives on fragments", `query ($yes: Boolean!) { player(name: "bob") { ...F @skip(if: $yes) ... @include(if: $yes) { wins } } }
+fragment F on Player { name }`, "", map[string]interface{}{"yes": true},
+			`{"data":{"player":{"wins":2}}}`},
+		{"the named operation", `query A { player(name: "alice") { name } } query B { player(name: "bob") { name } }`, "B", nil,
+			`{"data":{"player":{"name":"bob"}}}`},
+	}
+	for _, tt := range tests {
+		request := Request{Query: tt.query, OperationName: tt.operationName, Variables: tt.variables}
+		if got := execute(t, schema, request); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+
+	got := execute(t, schema, Request{Query: `query A { players { name } }`, OperationName: "C"})
+	if want := `{"errors":[{"message":"Unknown operation \"C\""}]}`; got != want {
+		t.Errorf("an unknown operation:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestResolverErrors(t *testing.T) {
+	schema := newTestSchema(t)
+	tests := []struct {
+		name, query, want string
+	}{
+		{"an error nulls the field", `{ failing player(name: "bob") { name } }`,
+			`{"data":{"failing":null,"player":{"name":"bob"}},"errors":[{"message":"the store is down","locations":[{"line":1,"column":3}],"path":["failing"]}]}`},
+		{"a panic is an error", `{ panicking }`,
+			`{"data":{"panicking":null},"errors":[{"message":"Internal error resolving panicking","locations":[{"line":1,"column":3}],"path":["panicking"]}]}`},
+		{"a null non-null field nulls its parent", `{ player(name: "alice") { name friends { name rival { name } } } }`,
+			`{"data":{"player":null},"errors":[{"message":"Cannot return null for non-nullable field rival","locations":[{"line":1,"column":47}],"path":["player","friends",0,"rival"]}]}`},
+		{"up to the root", `{ players { name } required }`,
+			`{"data":null,"errors":[{"message":"required but failed","locations":[{"line":1,"column":20}],"path":["required"]}]}`},
+		{"a missing object is null", `{ player(name: "nobody") { name } }`,
+			`{"data":{"player":null}}`},
+		{"an unset pointer is null", `{ player(name: "carol") { nickname friends { name } } }`,
+			`{"data":{"player":{"nickname":null,"friends":[]}}}`},
+	}
+	for _, tt := range tests {
+		if got := execute(t, schema, Request{Query: tt.query}); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewSchemaErrors(t *testing.T) {
+	other := &Object{Name: "Player"}
+	tests := []struct {
+		name  string
+		query *Object
+		want  string
+	}{
+		{"two types with a name", &Object{Name: "Query", Fields: []*Field{
+			{Name: "a", Type: &Object{Name: "Player"}},
+			{Name: "b", Type: other},
+		}}, "graphql: two types are named Player"},
+		{"a field without a type", &Object{Name: "Query", Fields: []*Field{{Name: "a"}}},
+			"graphql: Query.a has no type"},
+		{"an object argument", &Object{Name: "Query", Fields: []*Field{
+			{Name: "a", Type: String, Args: []*Arg{{Name: "p", Type: other}}},
+		}}, "graphql: argument p of Query.a isn't a scalar or enum"},
+	}
+	for _, tt := range tests {
+		if _, err := NewSchema(tt.query); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: NewSchema = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSDL(t *testing.T) {
+	sdl := newTestSchema(t).SDL()
+	for _, want := range []string{
+		"type Query {\n  player(name: String!): Player\n",
+		"  players(order: Order = NAME, limit: Int = 10): [Player!]!\n",
+		"enum Order {\n  NAME\n  WINS\n}\n",
+		"  \"Never found, so the player is null\"\n  rival: Player!\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("SDL is missing %q:\n%s", want, sdl)
+		}
+	}
+	if strings.Contains(sdl, "scalar Int") {
+		t.Errorf("SDL declares a built-in scalar:\n%s", sdl)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(newTestSchema(t).Handler())
+	defer server.Close()
+
+	get := func(query, variables string) *http.Response {
+		params := url.Values{"query": {query}}
+		if variables != "" {
+			params.Set("variables", variables)
+		}
+		response, err := http.Get(server.URL + "?" + params.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	post := func(contentType, body string) *http.Response {
+		response, err := http.Post(server.URL, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	tests := []struct {
+		name       string
+		response   *http.Response
+		wantStatus int
+		want       string
+	}{
+		{"a JSON POST", post("application/json", `{"query":"query ($n: String!) { player(name: $n) { wins } }","variables":{"n":"bob"}}`),
+			http.StatusOK, `{"data":{"player":{"wins":2}}}`},
+		{"an application/graphql POST", post("application/graphql", `{ player(name: "carol") { wins } }`),
+			http.StatusOK, `{"data":{"player":{"wins":1}}}`},
+		{"a GET", get(`query ($n: String!) { player(name: $n) { name } }`, `{"n":"alice"}`),
+			http.StatusOK, `{"data":{"player":{"name":"alice"}}}`},
+		{"errors with data", post("application/graphql", `{ failing }`),
+			http.StatusOK, `{"data":{"failing":null},"errors":[{"message":"the store is down","locations":[{"line":1,"column":3}],"path":["failing"]}]}`},
+		{"an invalid query", post("application/graphql", `{ score }`),
+			http.StatusBadRequest, `{"errors":[{"message":"Cannot query field \"score\" on type Query","locations":[{"line":1,"column":3}]}]}`},
+		{"no query", post("application/json", `{"query":" "}`),
+			http.StatusBadRequest, `{"errors":[{"message":"A query is required"}]}`},
+		{"invalid JSON", post("application/json", `{"query":`),
+			http.StatusBadRequest, `{"errors":[{"message":"Invalid request: unexpected EOF"}]}`},
+		{"invalid variables", get(`{ players { name } }`, `{"n":`),
+			http.StatusBadRequest, `{"errors":[{"message":"Invalid variables: unexpected end of JSON input"}]}`},
+	}
+	for _, tt := range tests {
+		var body json.RawMessage
+		if err := json.NewDecoder(tt.response.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		tt.response.Body.Close()
+		if tt.response.StatusCode != tt.wantStatus || string(body) != tt.want {
+			t.Errorf("%s: returned %d %s, want %d %s", tt.name, tt.response.StatusCode, body, tt.wantStatus, tt.want)
+		}
+		if contentType := tt.response.Header.Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("%s: Content-Type is %q", tt.name, contentType)
+		}
+	}
+}
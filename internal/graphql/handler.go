@@ -0,0 +1,70 @@
+package graphql
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxRequestBytes caps the size of a POSTed request
+const maxRequestBytes = 1 << 20
+
+// Handler serves queries over HTTP: POSTed as JSON, or as the body of an
+// application/graphql request, or in the query, variables and operationName
+// parameters of a GET. A query that couldn't run is answered 400.
+func (s *Schema) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, err := readRequest(r)
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, &Response{Errors: []*Error{{Message: err.Error()}}})
+			return
+		}
+
+		response := s.Execute(r.Context(), request)
+		status := http.StatusOK
+		if response.Data == nil {
+			status = http.StatusBadRequest
+		}
+		writeResponse(w, status, response)
+	})
+}
+
+func readRequest(r *http.Request) (Request, error) {
+	var request Request
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		request.Query = query.Get("query")
+		request.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return request, &Error{Message: "Invalid variables: " + err.Error()}
+			}
+		}
+	} else {
+		body := http.MaxBytesReader(nil, r.Body, maxRequestBytes)
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			query, err := io.ReadAll(body)
+			if err != nil {
+				return request, &Error{Message: "Invalid request: " + err.Error()}
+			}
+			request.Query = string(query)
+		} else if err := json.NewDecoder(body).Decode(&request); err != nil {
+			return request, &Error{Message: "Invalid request: " + err.Error()}
+		}
+	}
+
+	if strings.TrimSpace(request.Query) == "" {
+		return request, &Error{Message: "A query is required"}
+	}
+	return request, nil
+}
+
+func writeResponse(w http.ResponseWriter, status int, response *Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write GraphQL response: %v", err)
+	}
+}
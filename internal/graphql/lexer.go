@@ -0,0 +1,210 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string // the punctuator, name, number or unescaped string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.value)
+	default:
+		return `"` + t.value + `"`
+	}
+}
+
+// lexer splits a query into tokens, skipping whitespace, commas and comments
+type lexer struct {
+	source string
+	pos    int
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	if l.pos >= len(l.source) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.source[l.pos]
+	switch {
+	case strings.HasPrefix(l.source[l.pos:], "..."):
+		l.pos += 3
+		return token{kind: tokenPunctuator, value: "...", pos: start}, nil
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunctuator, value: string(c), pos: start}, nil
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.source) && (l.source[l.pos] == '_' || isLetter(l.source[l.pos]) || isDigit(l.source[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, value: l.source[start:l.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return l.number()
+	case c == '"':
+		return l.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(l.source[l.pos:])
+		return token{}, l.errorf(start, "unexpected character %q", r)
+	}
+}
+
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.source) {
+		switch c := l.source[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case strings.HasPrefix(l.source[l.pos:], "\uFEFF"):
+			l.pos += len("\uFEFF")
+		case c == '#':
+			for l.pos < len(l.source) && l.source[l.pos] != '\n' && l.source[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	kind := tokenInt
+	if l.source[l.pos] == '-' {
+		l.pos++
+	}
+	if !l.digits() {
+		return token{}, l.errorf(start, "invalid number")
+	}
+	if l.pos < len(l.source) && l.source[l.pos] == '.' {
+		kind = tokenFloat
+		l.pos++
+		if !l.digits() {
+			return token{}, l.errorf(start, "invalid number")
+		}
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == 'e' || l.source[l.pos] == 'E') {
+		kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.source) && (l.source[l.pos] == '+' || l.source[l.pos] == '-') {
+			l.pos++
+		}
+		if !l.digits() {
+			return token{}, l.errorf(start, "invalid number")
+		}
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == '_' || isLetter(l.source[l.pos]) || l.source[l.pos] == '.') {
+		return token{}, l.errorf(start, "invalid number")
+	}
+	return token{kind: kind, value: l.source[start:l.pos], pos: start}, nil
+}
+
+func (l *lexer) digits() bool {
+	start := l.pos
+	for l.pos < len(l.source) && isDigit(l.source[l.pos]) {
+		l.pos++
+	}
+	return l.pos > start
+}
+
+// string reads a quoted string, block strings aren't supported
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	if strings.HasPrefix(l.source[l.pos:], `"""`) {
+		return token{}, l.errorf(start, "block strings are not supported")
+	}
+	l.pos++
+
+	var b strings.Builder
+	for l.pos < len(l.source) {
+		c := l.source[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return token{kind: tokenString, value: b.String(), pos: start}, nil
+		case c == '\n' || c == '\r':
+			return token{}, l.errorf(start, "unterminated string")
+		case c == '\\':
+			if l.pos+1 >= len(l.source) {
+				return token{}, l.errorf(start, "unterminated string")
+			}
+			escape := l.source[l.pos+1]
+			l.pos += 2
+			switch escape {
+			case '"', '\\', '/':
+				b.WriteByte(escape)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+4 > len(l.source) {
+					return token{}, l.errorf(start, "invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(l.source[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					return token{}, l.errorf(start, "invalid unicode escape")
+				}
+				b.WriteRune(rune(code))
+				l.pos += 4
+			default:
+				return token{}, l.errorf(start, "invalid escape \\%c", escape)
+			}
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, l.errorf(start, "unterminated string")
+}
+
+// errorf reports a syntax error at pos
+func (l *lexer) errorf(pos int, format string, args ...interface{}) error {
+	return &Error{
+		Message:   "Syntax error: " + fmt.Sprintf(format, args...),
+		Locations: []Location{locate(l.source, pos)},
+	}
+}
+
+// locate returns the line and column of the byte offset pos in source
+func locate(source string, pos int) Location {
+	return Location{
+		Line:   1 + strings.Count(source[:pos], "\n"),
+		Column: 1 + utf8.RuneCountInString(source[strings.LastIndex(source[:pos], "\n")+1:pos]),
+	}
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,589 @@
+package graphql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// document is a parsed query with its operations and fragments
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	name       string
+	variables  []*variableDefinition
+	directives []*directive
+	selections []selection
+	pos        int
+}
+
+type variableDefinition struct {
+	name         string
+	typ          *typeRef
+	defaultValue *value
+	pos          int
+}
+
+// typeRef is a type as written in a variable definition, a named type or a
+// list of elem, required when nonNull
+type typeRef struct {
+	name    string
+	elem    *typeRef
+	nonNull bool
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// selection is a *field, *fragmentSpread or *inlineFragment
+type selection interface{}
+
+type field struct {
+	alias      string
+	name       string
+	arguments  []*argument
+	directives []*directive
+	selections []selection
+	pos        int
+}
+
+// responseKey is the key the field's value is given under
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type argument struct {
+	name  string
+	value *value
+	pos   int
+}
+
+type directive struct {
+	name      string
+	arguments []*argument
+	pos       int
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+	pos        int
+}
+
+type inlineFragment struct {
+	typeCondition string // empty for the enclosing type
+	directives    []*directive
+	selections    []selection
+	pos           int
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+	pos           int
+}
+
+type valueKind int
+
+const (
+	valueVariable valueKind = iota
+	valueInt
+	valueFloat
+	valueString
+	valueBoolean
+	valueNull
+	valueEnum
+	valueList
+	valueObject
+)
+
+// value is a literal or variable in the query
+type value struct {
+	kind   valueKind
+	raw    string // variable name, number, string, "true", "false" or enum value
+	list   []*value
+	fields []*objectField
+	pos    int
+}
+
+type objectField struct {
+	name  string
+	value *value
+}
+
+// String writes the value as it would be in a query
+func (v *value) String() string {
+	switch v.kind {
+	case valueVariable:
+		return "$" + v.raw
+	case valueString:
+		return strconv.Quote(v.raw)
+	case valueList:
+		items := make([]string, len(v.list))
+		for i, item := range v.list {
+			items[i] = item.String()
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case valueObject:
+		fields := make([]string, len(v.fields))
+		for i, f := range v.fields {
+			fields[i] = f.name + ": " + f.value.String()
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	default:
+		return v.raw
+	}
+}
+
+// parser reads a document with one token of lookahead
+type parser struct {
+	lexer *lexer
+	token token
+}
+
+// parse parses the query into a document
+func parse(query string) (*document, error) {
+	p := &parser{lexer: &lexer{source: query}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.peek("{"):
+			pos := p.token.pos
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{selections: selections, pos: pos})
+		case p.peekName("query"), p.peekName("mutation"), p.peekName("subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peekName("fragment"):
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if doc.fragments[frag.name] != nil {
+				return nil, p.errorAt(frag.pos, "there can be only one fragment named %q", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, p.errorAt(0, "the document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{pos: p.token.pos}
+	if p.token.value != "query" {
+		return nil, &Error{
+			Message:   "Only queries are supported, not " + p.token.value + "s",
+			Locations: []Location{locate(p.lexer.source, op.pos)},
+		}
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.token.kind == tokenName {
+		op.name = p.token.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if op.variables, err = p.variableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+	if op.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinitions() ([]*variableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var definitions []*variableDefinition
+	for !p.peek(")") {
+		definition := &variableDefinition{pos: p.token.pos}
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		definition.name = name
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if definition.typ, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if p.peek("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if definition.defaultValue, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, p.expect(")")
+}
+
+func (p *parser) typeRef() (*typeRef, error) {
+	ref := &typeRef{}
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		elem, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		ref.elem = elem
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		ref.name = name
+	}
+
+	if p.peek("!") {
+		ref.nonNull = true
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return ref, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []selection
+	for !p.peek("}") {
+		var (
+			s   selection
+			err error
+		)
+		if p.peek("...") {
+			s, err = p.fragmentSelection()
+		} else {
+			s, err = p.field()
+		}
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorAt(p.token.pos, "a selection set can't be empty")
+	}
+	return selections, p.expect("}")
+}
+
+func (p *parser) field() (*field, error) {
+	f := &field{pos: p.token.pos}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f.name = name
+	if p.peek(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f.alias = name
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.arguments, err = p.arguments(); err != nil {
+		return nil, err
+	}
+	if f.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// fragmentSelection reads a fragment spread or an inline fragment
+func (p *parser) fragmentSelection() (selection, error) {
+	pos := p.token.pos
+	if err := p.expect("..."); err != nil {
+		return nil, err
+	}
+
+	if p.token.kind == tokenName && p.token.value != "on" {
+		spread := &fragmentSpread{name: p.token.value, pos: pos}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		spread.directives, err = p.directives()
+		return spread, err
+	}
+
+	inline := &inlineFragment{pos: pos}
+	var err error
+	if p.peekName("on") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if inline.typeCondition, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if inline.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if inline.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return inline, nil
+}
+
+func (p *parser) fragment() (*fragment, error) {
+	frag := &fragment{pos: p.token.pos}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if frag.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if frag.name == "on" {
+		return nil, p.errorAt(frag.pos, "a fragment can't be named \"on\"")
+	}
+	if !p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if frag.typeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if frag.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if frag.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+// arguments reads the arguments in parentheses, if any
+func (p *parser) arguments() ([]*argument, error) {
+	if !p.peek("(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var arguments []*argument
+	for !p.peek(")") {
+		arg := &argument{pos: p.token.pos}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		arg.name = name
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if arg.value, err = p.value(false); err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, arg)
+	}
+	if len(arguments) == 0 {
+		return nil, p.errorAt(p.token.pos, "an argument list can't be empty")
+	}
+	return arguments, p.expect(")")
+}
+
+func (p *parser) directives() ([]*directive, error) {
+	var directives []*directive
+	for p.peek("@") {
+		d := &directive{pos: p.token.pos}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		d.name = name
+		if d.arguments, err = p.arguments(); err != nil {
+			return nil, err
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+func (p *parser) value(constant bool) (*value, error) {
+	v := &value{pos: p.token.pos}
+	switch {
+	case p.peek("$"):
+		if constant {
+			return nil, p.errorAt(v.pos, "a default value can't use a variable")
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		v.kind, v.raw = valueVariable, name
+		return v, nil
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		v.kind = valueList
+		v.list = []*value{}
+		for !p.peek("]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			v.list = append(v.list, item)
+		}
+		return v, p.expect("]")
+	case p.peek("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		v.kind = valueObject
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			v.fields = append(v.fields, &objectField{name: name, value: item})
+		}
+		return v, p.expect("}")
+	}
+
+	switch p.token.kind {
+	case tokenInt:
+		v.kind = valueInt
+	case tokenFloat:
+		v.kind = valueFloat
+	case tokenString:
+		v.kind = valueString
+	case tokenName:
+		switch p.token.value {
+		case "true", "false":
+			v.kind = valueBoolean
+		case "null":
+			v.kind = valueNull
+		default:
+			v.kind = valueEnum
+		}
+	default:
+		return nil, p.unexpected()
+	}
+	v.raw = p.token.value
+	return v, p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.token.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+func (p *parser) advance() error {
+	t, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = t
+	return nil
+}
+
+func (p *parser) expect(punctuator string) error {
+	if !p.peek(punctuator) {
+		return p.errorAt(p.token.pos, "expected %q, found %s", punctuator, p.token)
+	}
+	return p.advance()
+}
+
+func (p *parser) peek(punctuator string) bool {
+	return p.token.kind == tokenPunctuator && p.token.value == punctuator
+}
+
+func (p *parser) peekName(name string) bool {
+	return p.token.kind == tokenName && p.token.value == name
+}
+
+func (p *parser) unexpected() error {
+	return p.errorAt(p.token.pos, "unexpected %s", p.token)
+}
+
+func (p *parser) errorAt(pos int, format string, args ...interface{}) error {
+	return p.lexer.errorf(pos, format, args...)
+}
@@ -0,0 +1,349 @@
+// Package graphql serves GraphQL queries against a schema of Go resolvers.
+// It covers what dashboards ask of an API: queries with arguments,
+// variables, aliases, fragments and the @include and @skip directives.
+// Mutations, subscriptions and introspection aren't supported, SDL prints
+// the schema for clients to read instead.
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Type is a *Scalar, *Enum, *Object, *List or *NonNull
+type Type interface {
+	String() string
+	isType()
+}
+
+// Scalar is a leaf value. Its values are returned as the resolvers give
+// them, arguments and variables are coerced to Go values by coerce.
+type Scalar struct {
+	Name        string
+	Description string
+	coerce      func(v interface{}) (interface{}, bool)
+}
+
+// Enum is a leaf value from a fixed set, given to and returned from
+// resolvers as a string
+type Enum struct {
+	Name        string
+	Description string
+	Values      []string
+}
+
+// Object is a type with fields, the only kind of composite type
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+// Field is a field of an object. Without Resolve its value is read from the
+// source: the field of a struct with the same JSON name, or the map key.
+type Field struct {
+	Name        string
+	Description string
+	Type        Type
+	Args        []*Arg
+	Resolve     ResolveFunc
+}
+
+// Arg is an argument of a field, Default is used when it isn't given
+type Arg struct {
+	Name        string
+	Description string
+	Type        Type
+	Default     interface{}
+}
+
+// List is a list of values of Of
+type List struct {
+	Of Type
+}
+
+// NonNull is a value of Of that is never null
+type NonNull struct {
+	Of Type
+}
+
+// ListOf returns a list of t
+func ListOf(t Type) *List { return &List{Of: t} }
+
+// NonNullOf returns t, never null
+func NonNullOf(t Type) *NonNull { return &NonNull{Of: t} }
+
+func (t *Scalar) String() string  { return t.Name }
+func (t *Enum) String() string    { return t.Name }
+func (t *Object) String() string  { return t.Name }
+func (t *List) String() string    { return "[" + t.Of.String() + "]" }
+func (t *NonNull) String() string { return t.Of.String() + "!" }
+
+func (*Scalar) isType()  {}
+func (*Enum) isType()    {}
+func (*Object) isType()  {}
+func (*List) isType()    {}
+func (*NonNull) isType() {}
+
+// field returns the object's field named name, nil when it has none
+func (t *Object) field(name string) *Field {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// ResolveFunc returns the value of a field of source, the parent object's
+// value (nil for the query's fields)
+type ResolveFunc func(ctx context.Context, source interface{}, args Args) (interface{}, error)
+
+// Args are a field's arguments, coerced to int, float64, string, bool or
+// []interface{}. Arguments not given and without a default are missing.
+type Args map[string]interface{}
+
+// Int returns the integer argument, false when it is missing or null
+func (a Args) Int(name string) (int, bool) {
+	value, ok := a[name].(int)
+	return value, ok
+}
+
+// Float returns the float argument, false when it is missing or null
+func (a Args) Float(name string) (float64, bool) {
+	value, ok := a[name].(float64)
+	return value, ok
+}
+
+// String returns the string, ID or enum argument, false when it is missing or null
+func (a Args) String(name string) (string, bool) {
+	value, ok := a[name].(string)
+	return value, ok
+}
+
+// Bool returns the boolean argument, false when it is missing or null
+func (a Args) Bool(name string) (value, ok bool) {
+	value, ok = a[name].(bool)
+	return value, ok
+}
+
+// The built-in scalars
+var (
+	Int = &Scalar{Name: "Int", Description: "A signed 32-bit integer", coerce: func(v interface{}) (interface{}, bool) {
+		switch n := v.(type) {
+		case int:
+			return n, n >= math.MinInt32 && n <= math.MaxInt32
+		case int64:
+			return int(n), n >= math.MinInt32 && n <= math.MaxInt32
+		case float64:
+			return int(n), n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32
+		}
+		return nil, false
+	}}
+	Float = &Scalar{Name: "Float", Description: "A double-precision floating point number", coerce: func(v interface{}) (interface{}, bool) {
+		switch n := v.(type) {
+		case int:
+			return float64(n), true
+		case int64:
+			return float64(n), true
+		case float64:
+			return n, !math.IsInf(n, 0) && !math.IsNaN(n)
+		}
+		return nil, false
+	}}
+	String = &Scalar{Name: "String", Description: "A UTF-8 string", coerce: func(v interface{}) (interface{}, bool) {
+		s, ok := v.(string)
+		return s, ok
+	}}
+	Boolean = &Scalar{Name: "Boolean", Description: "true or false", coerce: func(v interface{}) (interface{}, bool) {
+		b, ok := v.(bool)
+		return b, ok
+	}}
+	ID = &Scalar{Name: "ID", Description: "A unique identifier, given as a string or an integer", coerce: func(v interface{}) (interface{}, bool) {
+		switch id := v.(type) {
+		case string:
+			return id, true
+		case int:
+			return strconv.Itoa(id), true
+		case int64:
+			return strconv.FormatInt(id, 10), true
+		case float64:
+			return strconv.FormatFloat(id, 'f', -1, 64), id == math.Trunc(id)
+		}
+		return nil, false
+	}}
+)
+
+// Schema is the types reachable from the query type
+type Schema struct {
+	query *Object
+	types map[string]Type
+}
+
+// NewSchema creates a schema with query as the root type. Two types with
+// the same name or a field without a type are errors.
+func NewSchema(query *Object) (*Schema, error) {
+	s := &Schema{query: query, types: make(map[string]Type)}
+	for _, scalar := range []*Scalar{Int, Float, String, Boolean, ID} {
+		s.types[scalar.Name] = scalar
+	}
+	if err := s.addType(query); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) addType(t Type) error {
+	switch t := t.(type) {
+	case *List:
+		return s.addType(t.Of)
+	case *NonNull:
+		return s.addType(t.Of)
+	case nil:
+		return errors.New("graphql: a type is nil")
+	}
+
+	name := t.String()
+	if existing, ok := s.types[name]; ok {
+		if existing != t {
+			return fmt.Errorf("graphql: two types are named %s", name)
+		}
+		return nil
+	}
+	s.types[name] = t
+
+	object, ok := t.(*Object)
+	if !ok {
+		return nil
+	}
+	for _, f := range object.Fields {
+		if f.Type == nil {
+			return fmt.Errorf("graphql: %s.%s has no type", object.Name, f.Name)
+		}
+		if err := s.addType(f.Type); err != nil {
+			return err
+		}
+		for _, arg := range f.Args {
+			if _, isObject := namedType(arg.Type).(*Object); isObject || arg.Type == nil {
+				return fmt.Errorf("graphql: argument %s of %s.%s isn't a scalar or enum", arg.Name, object.Name, f.Name)
+			}
+			if err := s.addType(arg.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SDL prints the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	names := make([]string, 0, len(s.types))
+	for name := range s.types {
+		if name != s.query.Name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	writeType(&b, s.query)
+	for _, name := range names {
+		if scalar, isScalar := s.types[name].(*Scalar); isScalar && isBuiltIn(scalar) {
+			continue
+		}
+		b.WriteString("\n")
+		writeType(&b, s.types[name])
+	}
+	return b.String()
+}
+
+func writeType(b *strings.Builder, t Type) {
+	switch t := t.(type) {
+	case *Scalar:
+		writeDescription(b, "", t.Description)
+		b.WriteString("scalar " + t.Name + "\n")
+	case *Enum:
+		writeDescription(b, "", t.Description)
+		b.WriteString("enum " + t.Name + " {\n")
+		for _, value := range t.Values {
+			b.WriteString("  " + value + "\n")
+		}
+		b.WriteString("}\n")
+	case *Object:
+		writeDescription(b, "", t.Description)
+		b.WriteString("type " + t.Name + " {\n")
+		for _, f := range t.Fields {
+			writeDescription(b, "  ", f.Description)
+			b.WriteString("  " + f.Name)
+			if len(f.Args) > 0 {
+				args := make([]string, len(f.Args))
+				for i, arg := range f.Args {
+					args[i] = arg.Name + ": " + arg.Type.String()
+					if arg.Default != nil {
+						args[i] += " = " + formatDefault(arg.Type, arg.Default)
+					}
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.Type.String() + "\n")
+		}
+		b.WriteString("}\n")
+	}
+}
+
+func writeDescription(b *strings.Builder, indent, description string) {
+	if description != "" {
+		b.WriteString(indent + strconv.Quote(description) + "\n")
+	}
+}
+
+func formatDefault(t Type, value interface{}) string {
+	if _, isEnum := namedType(t).(*Enum); isEnum {
+		return fmt.Sprint(value)
+	}
+	if s, isString := value.(string); isString {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
+
+func isBuiltIn(scalar *Scalar) bool {
+	return scalar == Int || scalar == Float || scalar == String || scalar == Boolean || scalar == ID
+}
+
+// namedType returns the scalar, enum or object inside any lists and non-nulls
+func namedType(t Type) Type {
+	for {
+		switch wrapper := t.(type) {
+		case *List:
+			t = wrapper.Of
+		case *NonNull:
+			t = wrapper.Of
+		default:
+			return t
+		}
+	}
+}
+
+// Location is a line and column in the query, from 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is an error in the response, at the locations in the query and the
+// path in the data it applies to
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
@@ -0,0 +1,225 @@
+package graphql
+
+import "fmt"
+
+// maxSelections caps the fields a query selects, counting each fragment
+// every time it is spread, so a small query can't expand into a huge one
+const maxSelections = 2000
+
+// validator checks an operation against the schema before it runs, so a
+// query that can't run returns errors without any data
+type validator struct {
+	schema     *Schema
+	source     string
+	doc        *document
+	variables  map[string]*variableDefinition
+	spreading  map[string]bool // fragments being expanded, to catch cycles
+	selections int
+	errors     []*Error
+}
+
+func validate(schema *Schema, source string, doc *document, op *operation) []*Error {
+	v := &validator{
+		schema:    schema,
+		source:    source,
+		doc:       doc,
+		variables: make(map[string]*variableDefinition),
+		spreading: make(map[string]bool),
+	}
+
+	for _, definition := range op.variables {
+		if v.variables[definition.name] != nil {
+			v.errorf(definition.pos, "There can be only one variable named $%s", definition.name)
+			continue
+		}
+		v.variables[definition.name] = definition
+		t := schema.resolveTypeRef(definition.typ)
+		if t == nil {
+			v.errorf(definition.pos, "Unknown type %s of variable $%s", definition.typ, definition.name)
+			continue
+		}
+		if _, isObject := namedType(t).(*Object); isObject {
+			v.errorf(definition.pos, "Variable $%s can't be of type %s, which isn't a scalar or enum", definition.name, t)
+			continue
+		}
+		if definition.defaultValue != nil {
+			if _, err := coerceLiteral(t, definition.defaultValue, nil); err != nil {
+				v.errorf(definition.pos, "Variable $%s has an invalid default value: %v", definition.name, err)
+			}
+		}
+	}
+
+	v.directives(op.directives)
+	v.selectionSet(schema.query, op.selections)
+	return v.errors
+}
+
+func (v *validator) selectionSet(object *Object, selections []selection) {
+	for _, s := range selections {
+		if v.selections++; v.selections > maxSelections {
+			if v.selections == maxSelections+1 {
+				v.errorf(0, "The query selects more than %d fields", maxSelections)
+			}
+			return
+		}
+
+		switch s := s.(type) {
+		case *field:
+			v.field(object, s)
+		case *fragmentSpread:
+			v.directives(s.directives)
+			frag := v.doc.fragments[s.name]
+			if frag == nil {
+				v.errorf(s.pos, "Unknown fragment %q", s.name)
+				continue
+			}
+			if v.spreading[s.name] {
+				v.errorf(s.pos, "Fragment %q spreads itself", s.name)
+				continue
+			}
+			if frag.typeCondition != object.Name {
+				v.errorf(s.pos, "Fragment %q on %s can't be spread on %s", s.name, frag.typeCondition, object.Name)
+				continue
+			}
+			v.directives(frag.directives)
+			v.spreading[s.name] = true
+			v.selectionSet(object, frag.selections)
+			delete(v.spreading, s.name)
+		case *inlineFragment:
+			v.directives(s.directives)
+			if s.typeCondition != "" && s.typeCondition != object.Name {
+				v.errorf(s.pos, "A fragment on %s can't be spread on %s", s.typeCondition, object.Name)
+				continue
+			}
+			v.selectionSet(object, s.selections)
+		}
+	}
+}
+
+func (v *validator) field(object *Object, f *field) {
+	v.directives(f.directives)
+	if f.name == "__typename" {
+		if len(f.arguments) > 0 || f.selections != nil {
+			v.errorf(f.pos, "__typename takes no arguments or subfields")
+		}
+		return
+	}
+
+	definition := object.field(f.name)
+	if definition == nil {
+		v.errorf(f.pos, "Cannot query field %q on type %s", f.name, object.Name)
+		return
+	}
+	v.arguments(definition.Name, definition.Args, f.arguments, f.pos)
+
+	switch t := namedType(definition.Type).(type) {
+	case *Object:
+		if f.selections == nil {
+			v.errorf(f.pos, "Field %q of type %s must have a selection of subfields", f.name, definition.Type)
+			return
+		}
+		v.selectionSet(t, f.selections)
+	default:
+		if f.selections != nil {
+			v.errorf(f.pos, "Field %q of type %s can't have a selection of subfields", f.name, definition.Type)
+		}
+	}
+}
+
+// arguments checks that the arguments are defined, given once and, unless
+// they come from variables, valid, and that the required ones are given
+func (v *validator) arguments(owner string, definitions []*Arg, arguments []*argument, pos int) {
+	given := make(map[string]bool)
+	for _, arg := range arguments {
+		if given[arg.name] {
+			v.errorf(arg.pos, "There can be only one argument named %q", arg.name)
+			continue
+		}
+		given[arg.name] = true
+
+		definition := findArg(definitions, arg.name)
+		if definition == nil {
+			v.errorf(arg.pos, "Unknown argument %q on %q", arg.name, owner)
+			continue
+		}
+		if v.usesVariables(arg.value) {
+			continue
+		}
+		if _, err := coerceLiteral(definition.Type, arg.value, nil); err != nil {
+			v.errorf(arg.pos, "Argument %q of %q has an invalid value: %v", arg.name, owner, err)
+		}
+	}
+
+	for _, definition := range definitions {
+		if _, required := definition.Type.(*NonNull); required && definition.Default == nil && !given[definition.Name] {
+			v.errorf(pos, "Argument %q of type %s is required on %q", definition.Name, definition.Type, owner)
+		}
+	}
+}
+
+// usesVariables reports whether the value holds variables, checking they
+// are defined
+func (v *validator) usesVariables(value *value) bool {
+	switch value.kind {
+	case valueVariable:
+		if v.variables[value.raw] == nil {
+			v.errorf(value.pos, "Variable $%s is not defined", value.raw)
+		}
+		return true
+	case valueList:
+		uses := false
+		for _, item := range value.list {
+			uses = v.usesVariables(item) || uses
+		}
+		return uses
+	}
+	return false
+}
+
+func (v *validator) directives(directives []*directive) {
+	for _, d := range directives {
+		if d.name != "include" && d.name != "skip" {
+			v.errorf(d.pos, "Unknown directive @%s", d.name)
+			continue
+		}
+		v.arguments("@"+d.name, conditionArgs, d.arguments, d.pos)
+	}
+}
+
+// conditionArgs are the arguments of @include and @skip
+var conditionArgs = []*Arg{{Name: "if", Type: NonNullOf(Boolean)}}
+
+func (v *validator) errorf(pos int, format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: []Location{locate(v.source, pos)},
+	})
+}
+
+func findArg(definitions []*Arg, name string) *Arg {
+	for _, definition := range definitions {
+		if definition.Name == name {
+			return definition
+		}
+	}
+	return nil
+}
+
+// resolveTypeRef returns the schema type a variable is declared with, nil
+// for an unknown type
+func (s *Schema) resolveTypeRef(ref *typeRef) Type {
+	var t Type
+	if ref.elem != nil {
+		elem := s.resolveTypeRef(ref.elem)
+		if elem == nil {
+			return nil
+		}
+		t = ListOf(elem)
+	} else if t = s.types[ref.name]; t == nil {
+		return nil
+	}
+	if ref.nonNull {
+		t = NonNullOf(t)
+	}
+	return t
+}
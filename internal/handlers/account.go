@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"connect-four-backend/internal/accounts"
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/auth"
+	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/models"
+)
+
+type AccountHandler struct {
+	accounts *accounts.Service
+	sessions *auth.Sessions
+	db       database.Store
+}
+
+func NewAccountHandler(accountService *accounts.Service, sessions *auth.Sessions, db database.Store) *AccountHandler {
+	return &AccountHandler{
+		accounts: accountService,
+		sessions: sessions,
+		db:       db,
+	}
+}
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// registerRequest carries the session token a guest was given over the
+// WebSocket when they register the name they played under
+type registerRequest struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	GuestToken string `json:"guest_token,omitempty"`
+}
+
+// sessionResponse is returned on registration and login. The token is passed
+// as ?token= when opening the WebSocket and as a bearer token on REST calls.
+type sessionResponse struct {
+	Account   *models.Account    `json:"account"`
+	Token     string             `json:"token"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	Claim     *models.GuestClaim `json:"claim,omitempty"` // the guest history registration took over
+}
+
+type profileResponse struct {
+	Account *models.Account       `json:"account"`
+	Rating  *models.PlayerRating  `json:"rating,omitempty"` // nil until the first rated game
+	Stats   *database.PlayerStats `json:"stats,omitempty"`
+}
+
+// Register creates an account and logs it in. With a guest token the guest
+// can register the name they played under and keeps their games and rating.
+func (h *AccountHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var request registerRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if request.GuestToken == "" {
+		account, err := h.accounts.Register(request.Username, request.Password)
+		if err != nil {
+			status, code := accountError(err)
+			apierror.Write(w, status, code, err.Error())
+			return
+		}
+		h.sendSession(w, http.StatusCreated, account, nil)
+		return
+	}
+
+	guest, err := h.sessions.Verify(request.GuestToken)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "INVALID_GUEST_TOKEN", "Invalid guest token: "+err.Error())
+		return
+	}
+
+	account, claim, err := h.accounts.RegisterGuest(guest.PlayerID, request.Username, request.Password)
+	if account == nil {
+		status, code := accountError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Registered %s but failed to claim guest %s: %v", account.Username, guest.PlayerID, err)
+	}
+
+	h.sendSession(w, http.StatusCreated, account, claim)
+}
+
+// Login checks the credentials and issues a session token for the account
+func (h *AccountHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var request credentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	account, err := h.accounts.Login(request.Username, request.Password)
+	if err != nil {
+		status, code := accountError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	h.sendSession(w, http.StatusOK, account, nil)
+}
+
+// GetProfile returns the logged in player's account with their rating and stats
+func (h *AccountHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	playerID, _ := auth.PlayerIDFromContext(r.Context())
+
+	account, err := h.accounts.Get(playerID)
+	if err != nil {
+		status, code := accountError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	profile := profileResponse{Account: account}
+	if profile.Rating, err = h.db.GetPlayerRating(account.Username); err != nil {
+		log.Printf("Failed to load rating for %s: %v", account.Username, err)
+	}
+	if profile.Stats, err = h.db.GetPlayerStats(account.Username); err != nil {
+		log.Printf("Failed to load stats for %s: %v", account.Username, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// claimGuestRequest carries the session token the guest was given over the
+// WebSocket, proving the caller played as that guest
+type claimGuestRequest struct {
+	GuestToken string `json:"guest_token"`
+}
+
+// ClaimGuest moves a guest player's games and rating to the logged in account
+func (h *AccountHandler) ClaimGuest(w http.ResponseWriter, r *http.Request) {
+	playerID, _ := auth.PlayerIDFromContext(r.Context())
+
+	var request claimGuestRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	guest, err := h.sessions.Verify(request.GuestToken)
+	if err != nil {
+		apierror.Write(w, http.StatusUnauthorized, "INVALID_GUEST_TOKEN", "Invalid guest token: "+err.Error())
+		return
+	}
+
+	claim, err := h.accounts.ClaimGuest(playerID, guest.PlayerID)
+	if err != nil {
+		log.Printf("Failed to claim guest %s for %s: %v", guest.PlayerID, playerID, err)
+		status, code := accountError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(claim)
+}
+
+// eraseRequest confirms an erasure with the account's password. Mode is
+// models.ErasureAnonymize, the default, or models.ErasureDelete.
+type eraseRequest struct {
+	Password string `json:"password"`
+	Mode     string `json:"mode"`
+}
+
+// Erase erases the logged in player's data: their finished games are renamed
+// to an alias, their ratings, standings and stats are deleted, and their
+// account is too when the mode is delete
+func (h *AccountHandler) Erase(w http.ResponseWriter, r *http.Request) {
+	playerID, _ := auth.PlayerIDFromContext(r.Context())
+
+	var request eraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if request.Mode == "" {
+		request.Mode = models.ErasureAnonymize
+	}
+
+	erasure, err := h.accounts.Erase(playerID, request.Password, request.Mode)
+	if err != nil {
+		log.Printf("Failed to erase player %s: %v", playerID, err)
+		status, code := accountError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(erasure)
+}
+
+func (h *AccountHandler) sendSession(w http.ResponseWriter, status int, account *models.Account, claim *models.GuestClaim) {
+	token, expiresAt, err := h.sessions.Issue(account.ID)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create session")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sessionResponse{
+		Account:   account,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		Claim:     claim,
+	})
+}
+
+// accountError maps account errors to HTTP status and error codes
+func accountError(err error) (int, string) {
+	switch err {
+	case accounts.ErrInvalidUsername:
+		return http.StatusBadRequest, "INVALID_USERNAME"
+	case accounts.ErrWeakPassword:
+		return http.StatusBadRequest, "WEAK_PASSWORD"
+	case accounts.ErrUsernameTaken:
+		return http.StatusConflict, "USERNAME_TAKEN"
+	case accounts.ErrNameHasHistory:
+		return http.StatusConflict, "USERNAME_HAS_HISTORY"
+	case accounts.ErrNotGuest:
+		return http.StatusConflict, "NOT_GUEST"
+	case accounts.ErrInvalidErasureMode:
+		return http.StatusBadRequest, "INVALID_ERASURE_MODE"
+	case accounts.ErrInvalidCredentials:
+		return http.StatusUnauthorized, "INVALID_CREDENTIALS"
+	case accounts.ErrAccountNotFound:
+		return http.StatusNotFound, "ACCOUNT_NOT_FOUND"
+	default:
+		return http.StatusInternalServerError, apierror.CodeInternal
+	}
+}
@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/accounts"
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/auth"
+	"connect-four-backend/internal/config"
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/kafka"
+	"connect-four-backend/internal/models"
+	"connect-four-backend/internal/webhooks"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// AdminHandler lets operators watch and step into live games. Its routes sit
+// behind the session middleware, RequireAdmin then limits them to the
+// configured admin accounts.
+type AdminHandler struct {
+	games    *GameHandler
+	accounts *accounts.Service
+	webhooks *webhooks.Service
+	admins   map[string]bool
+	reloader *config.Reloader
+}
+
+func NewAdminHandler(gameHandler *GameHandler, accountService *accounts.Service, webhookService *webhooks.Service, adminUsernames []string) *AdminHandler {
+	admins := make(map[string]bool)
+	for _, username := range adminUsernames {
+		if username = strings.TrimSpace(username); username != "" {
+			admins[username] = true
+		}
+	}
+
+	return &AdminHandler{
+		games:    gameHandler,
+		accounts: accountService,
+		webhooks: webhookService,
+		admins:   admins,
+	}
+}
+
+// SetReloader lets admins reload the config
+func (h *AdminHandler) SetReloader(reloader *config.Reloader) {
+	h.reloader = reloader
+}
+
+type adminContextKey struct{}
+
+// RequireAdmin rejects requests whose session isn't one of an admin account
+func (h *AdminHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		playerID, ok := auth.PlayerIDFromContext(r.Context())
+		if !ok {
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+			return
+		}
+
+		account, err := h.accounts.Get(playerID)
+		if err == accounts.ErrAccountNotFound || (err == nil && !h.admins[account.Username]) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Admin access required")
+			return
+		}
+		if err != nil {
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to look up account")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, account.Username)))
+	})
+}
+
+// adminName is the admin making the request, for the audit log
+func adminName(r *http.Request) string {
+	username, _ := r.Context().Value(adminContextKey{}).(string)
+	return username
+}
+
+type adminGameSummary struct {
+	ID          uuid.UUID          `json:"id"`
+	QueueType   models.QueueType   `json:"queue_type"`
+	Players     []*models.Player   `json:"players"`
+	CurrentTurn models.PlayerColor `json:"current_turn"`
+	Moves       int                `json:"moves"`
+	Paused      bool               `json:"paused"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+type adminGameResponse struct {
+	Game          *models.Game      `json:"game"`
+	PlayerDevices map[uuid.UUID]int `json:"player_devices"` // open connections of each connected player
+	Spectators    int               `json:"spectators"`
+}
+
+type endGameRequest struct {
+	WinnerID *uuid.UUID `json:"winner_id,omitempty"` // omitted to end the game as a draw
+	Reason   string     `json:"reason"`
+}
+
+type kickRequest struct {
+	Reason string `json:"reason"`
+}
+
+type announcementRequest struct {
+	Message string `json:"message"`
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type analyticsSettings struct {
+	Enabled  bool                 `json:"enabled"`
+	Sampling kafka.SamplingConfig `json:"sampling"`
+	Stats    kafka.AnalyticsStats `json:"stats"`
+}
+
+type configReloadResponse struct {
+	Changes []config.Change `json:"changes"`
+}
+
+// analyticsSettingsRequest changes the settings it has, sampling is replaced as a whole
+type analyticsSettingsRequest struct {
+	Enabled  *bool                 `json:"enabled,omitempty"`
+	Sampling *kafka.SamplingConfig `json:"sampling,omitempty"`
+}
+
+// ListGames returns a summary of every game being played
+func (h *AdminHandler) ListGames(w http.ResponseWriter, r *http.Request) {
+	games := h.games.gameManager.ActiveGames()
+
+	summaries := make([]adminGameSummary, 0, len(games))
+	for _, g := range games {
+		summaries = append(summaries, adminGameSummary{
+			ID:          g.ID,
+			QueueType:   g.QueueType,
+			Players:     g.AllPlayers(),
+			CurrentTurn: g.CurrentTurn,
+			Moves:       len(g.Moves),
+			Paused:      g.Paused,
+			CreatedAt:   g.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// GetGame returns a game's full state and who is connected to it
+func (h *AdminHandler) GetGame(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid game ID")
+		return
+	}
+
+	gameInstance, exists := h.games.gameManager.GetGame(gameID)
+	if !exists {
+		apierror.Write(w, http.StatusNotFound, "GAME_NOT_FOUND", "Game not found")
+		return
+	}
+
+	devices, spectators, err := h.games.gameManager.GameConnections(gameID)
+	if err != nil {
+		status, code := gameError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminGameResponse{
+		Game:          gameInstance,
+		PlayerDevices: devices,
+		Spectators:    spectators,
+	})
+}
+
+// EndGame ends a game in progress, awarding it to a player or as a draw
+func (h *AdminHandler) EndGame(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid game ID")
+		return
+	}
+
+	var request endGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	gameInstance, exists := h.games.gameManager.GetGame(gameID)
+	if !exists {
+		apierror.Write(w, http.StatusNotFound, "GAME_NOT_FOUND", "Game not found")
+		return
+	}
+
+	var winner *models.Player
+	if request.WinnerID != nil {
+		for _, player := range gameInstance.AllPlayers() {
+			if player.ID == *request.WinnerID {
+				winner = player
+				break
+			}
+		}
+		if winner == nil {
+			apierror.Write(w, http.StatusBadRequest, "PLAYER_NOT_IN_GAME", game.ErrPlayerNotInGame.Error())
+			return
+		}
+	}
+
+	var winnerColor *models.PlayerColor
+	if winner != nil {
+		color := winner.Color
+		winnerColor = &color
+	}
+
+	ended, err := h.games.gameManager.EndGame(gameID, winnerColor)
+	if err != nil {
+		status, code := gameError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	reason := "Ended by an administrator"
+	if request.Reason != "" {
+		reason += ": " + request.Reason
+	}
+	log.Printf("Admin %s ended game %s (winner %v): %s", adminName(r), gameID, request.WinnerID, request.Reason)
+
+	h.games.gameManager.BroadcastToGame(gameID, models.NewWSMessage(models.MsgGameEnd, models.GameEndPayload{
+		GameID:    gameID,
+		Winner:    winner,
+		Reason:    reason,
+		GameState: ended,
+		Duration:  int(ended.FinishedAt.Sub(ended.CreatedAt).Seconds()),
+		IsDraw:    winner == nil,
+	}))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ended)
+}
+
+// KickPlayer closes every connection of a player. Like any disconnect, a
+// game they are playing waits out the grace period for them.
+func (h *AdminHandler) KickPlayer(w http.ResponseWriter, r *http.Request) {
+	playerID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid player ID")
+		return
+	}
+
+	var request kickRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	clients := h.games.hub.playerClients(playerID)
+	if len(clients) == 0 {
+		apierror.Write(w, http.StatusNotFound, "PLAYER_NOT_CONNECTED", "Player is not connected")
+		return
+	}
+
+	reason := request.Reason
+	if reason == "" {
+		reason = "removed by an administrator"
+	}
+	for _, conn := range clients {
+		conn.Kick(websocket.ClosePolicyViolation, reason)
+	}
+	log.Printf("Admin %s kicked player %s from %d connections: %s", adminName(r), playerID, len(clients), reason)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Announce sends a message to every connected player
+func (h *AdminHandler) Announce(w http.ResponseWriter, r *http.Request) {
+	var request announcementRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	message := strings.TrimSpace(request.Message)
+	if message == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Announcement message is required")
+		return
+	}
+
+	sent := h.games.hub.broadcast(models.NewWSMessage(models.MsgAnnouncement, models.AnnouncementPayload{
+		Message: message,
+		SentAt:  time.Now(),
+	}))
+	log.Printf("Admin %s announced to %d connections: %s", adminName(r), sent, message)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"recipients": sent})
+}
+
+// GetDrain returns whether the server is draining and the games it waits on
+func (h *AdminHandler) GetDrain(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.games.DrainStatus())
+}
+
+// Drain has the server stop taking new games, play out the games in progress
+// and shut down, as a SIGTERM does
+func (h *AdminHandler) Drain(w http.ResponseWriter, r *http.Request) {
+	if h.games.RequestDrain() {
+		log.Printf("Admin %s asked the server to drain", adminName(r))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(h.games.DrainStatus())
+}
+
+// ListWebhooks returns the registered webhooks, without their secrets
+func (h *AdminHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.webhooks.List())
+}
+
+// CreateWebhook registers a webhook. The response is the only time its
+// signing secret is shown.
+func (h *AdminHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	webhook, err := h.webhooks.Register(strings.TrimSpace(request.URL), request.Events)
+	if err != nil {
+		status, code := webhookError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+	log.Printf("Admin %s registered webhook %s to %s for %v", adminName(r), webhook.ID, webhook.URL, webhook.Events)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// DeleteWebhook removes a webhook
+func (h *AdminHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid webhook ID")
+		return
+	}
+
+	if err := h.webhooks.Delete(webhookID); err != nil {
+		status, code := webhookError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+	log.Printf("Admin %s deleted webhook %s", adminName(r), webhookID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeadLetters returns the most recent deliveries that failed every attempt
+func (h *AdminHandler) ListWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > 500 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
+			return
+		}
+	}
+
+	letters, err := h.webhooks.DeadLetters(limit)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch dead letters")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letters)
+}
+
+// GetAnalytics returns whether analytics events are emitted and their sample rates
+func (h *AdminHandler) GetAnalytics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.analyticsSettings())
+}
+
+// UpdateAnalytics turns analytics on or off and changes the sample rates, to
+// cut event volume under load without a restart
+func (h *AdminHandler) UpdateAnalytics(w http.ResponseWriter, r *http.Request) {
+	var request analyticsSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	analytics := h.games.analyticsService
+	if request.Sampling != nil {
+		if err := analytics.SetSampling(*request.Sampling); err != nil {
+			apierror.Write(w, http.StatusBadRequest, "INVALID_SAMPLING", err.Error())
+			return
+		}
+	}
+	if request.Enabled != nil {
+		analytics.SetEnabled(*request.Enabled)
+	}
+
+	settings := h.analyticsSettings()
+	log.Printf("Admin %s set analytics enabled=%t, sampling %v, board snapshots %v", adminName(r),
+		settings.Enabled, settings.Sampling.Rates, settings.Sampling.BoardSnapshots)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func (h *AdminHandler) analyticsSettings() analyticsSettings {
+	return analyticsSettings{
+		Enabled:  h.games.analyticsService.IsEnabled(),
+		Sampling: h.games.analyticsService.Sampling(),
+		Stats:    h.games.analyticsService.GetStats(),
+	}
+}
+
+// GetConfig returns the settings that can be reloaded and how the last reload went
+func (h *AdminHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	if h.reloader == nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Config reloading isn't enabled")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.reloader.Status())
+}
+
+// ReloadConfig loads the config file and environment again, as a SIGHUP does.
+// The bot match timeout, ranked turn timer, analytics sampling and log level
+// take effect, other changed settings wait for a restart.
+func (h *AdminHandler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	if h.reloader == nil {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Config reloading isn't enabled")
+		return
+	}
+
+	log.Printf("Admin %s asked the server to reload its config", adminName(r))
+	changes, err := h.reloader.Reload()
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, "INVALID_CONFIG", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(configReloadResponse{Changes: changes})
+}
+
+// webhookError maps webhook service errors to HTTP status and error codes
+func webhookError(err error) (int, string) {
+	switch {
+	case errors.Is(err, webhooks.ErrWebhookNotFound):
+		return http.StatusNotFound, "WEBHOOK_NOT_FOUND"
+	case errors.Is(err, webhooks.ErrInvalidURL):
+		return http.StatusBadRequest, "INVALID_WEBHOOK_URL"
+	case errors.Is(err, webhooks.ErrNoEvents):
+		return http.StatusBadRequest, "NO_WEBHOOK_EVENTS"
+	case errors.Is(err, webhooks.ErrUnknownEvent):
+		return http.StatusBadRequest, "UNKNOWN_WEBHOOK_EVENT"
+	default:
+		return http.StatusInternalServerError, apierror.CodeInternal
+	}
+}
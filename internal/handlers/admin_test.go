@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Run with -race: the admin routes read live games while moves change them
+func TestAdminReadsGamesWhileMovesArePlayed(t *testing.T) {
+	m := game.NewManager()
+	h := &AdminHandler{games: &GameHandler{gameManager: m}}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/admin/games", h.ListGames)
+	router.HandleFunc("/api/admin/games/{id}", h.GetGame)
+
+	// Each player pair plays game after game until the reads are done
+	done := make(chan struct{})
+	games := make(chan uuid.UUID, 100)
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				red := &models.Player{ID: uuid.New(), Name: "red"}
+				yellow := &models.Player{ID: uuid.New(), Name: "yellow"}
+				g := m.CreateGame(red, yellow, models.QueueTypeCasual)
+				select {
+				case games <- g.ID:
+				default:
+				}
+				playGame(m, g.ID, red, yellow)
+			}
+		}()
+	}
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 50; i++ {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/games", nil))
+		var summaries []adminGameSummary
+		if err := json.Unmarshal(recorder.Body.Bytes(), &summaries); err != nil {
+			t.Fatal(err)
+		}
+
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/games/"+(<-games).String(), nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET game returned %d: %s", recorder.Code, recorder.Body)
+		}
+		var response adminGameResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if got := response.Game; pieces(got.Board) != len(got.Moves) {
+			t.Fatalf("game has %d discs and %d moves", pieces(got.Board), len(got.Moves))
+		}
+	}
+}
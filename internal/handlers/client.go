@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Messages queued for a client before it is considered too slow and dropped
+	clientSendBuffer = 256
+
+	// How long a single write may take before the client is dropped
+	clientWriteWait = 10 * time.Second
+
+	// The server pings every client and drops those that miss three pongs in
+	// a row, so dead connections are noticed within seconds
+	clientPingPeriod = 2 * time.Second
+	clientPongWait   = 3 * clientPingPeriod
+
+	// Largest message a client may send. Moves, chat and every other client
+	// message fit in a fraction of it, bigger frames close the connection.
+	clientMaxMessageSize = 16 * 1024
+)
+
+var (
+	errClientClosed = errors.New("websocket client is closed")
+	errSlowClient   = errors.New("websocket client is not keeping up and was disconnected")
+)
+
+// Client wraps a WebSocket connection with a write pump. gorilla/websocket
+// allows only one writer at a time, and messages for a player come from the
+// read loop, game broadcasts, bot moves and matchmaking alike, so every write
+// is queued and a single goroutine sends them in order.
+type Client struct {
+	conn *websocket.Conn
+	send chan []byte
+	done chan struct{}
+
+	// Set when the client negotiated the MessagePack subprotocol
+	binary bool
+
+	// Set when the client connected with a logged in account's session token
+	account *models.Account
+
+	// Close frame sent when the client is closed, set by Kick and CloseAfterPending
+	closeCode int
+	closeText string
+	flush     bool // send queued messages before closing
+	closeOnce sync.Once
+
+	// Round trip time of the latest ping, in nanoseconds
+	latency atomic.Int64
+
+	// Tie the analytics events of the connection together. The trace ID is
+	// handed to the client with its session, so it can keep it across reconnects.
+	sessionID string
+	traceID   string
+}
+
+// newClient wraps the connection and starts its write pump
+func newClient(conn *websocket.Conn) *Client {
+	c := &Client{
+		conn: conn,
+		send: make(chan []byte, clientSendBuffer),
+		done: make(chan struct{}),
+
+		binary:    conn.Subprotocol() == subprotocolMsgpack,
+		closeCode: websocket.CloseNormalClosure,
+	}
+
+	conn.SetReadLimit(clientMaxMessageSize)
+
+	// Every pong extends the read deadline, a silent connection fails its next
+	// read. Pings carry their send time, so pongs also measure the round trip.
+	conn.SetReadDeadline(time.Now().Add(clientPongWait))
+	conn.SetPongHandler(func(appData string) error {
+		if sentAt, err := strconv.ParseInt(appData, 10, 64); err == nil {
+			c.latency.Store(time.Now().UnixNano() - sentAt)
+		}
+		return conn.SetReadDeadline(time.Now().Add(clientPongWait))
+	})
+
+	go c.writePump()
+
+	return c
+}
+
+// WriteJSON queues a message for the client. It never blocks: a client whose
+// buffer is full is disconnected rather than holding up the sender.
+func (c *Client) WriteJSON(v interface{}) error {
+	// Encode now, the payload may change once the caller moves on
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if c.binary {
+		if data, err = jsonToMsgpack(data); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-c.done:
+		return errClientClosed
+	default:
+	}
+
+	select {
+	case c.send <- data:
+		return nil
+	default:
+		log.Printf("Disconnecting WebSocket client %s: %d messages pending", c.conn.RemoteAddr(), len(c.send))
+		c.Close()
+		return errSlowClient
+	}
+}
+
+// ReadJSON reads the next message from the client. MessagePack clients may
+// still send JSON text frames.
+func (c *Client) ReadJSON(v interface{}) error {
+	if !c.binary {
+		return c.conn.ReadJSON(v)
+	}
+
+	messageType, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if messageType == websocket.BinaryMessage {
+		if data, err = msgpackToJSON(data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Latency is the round trip time to the client measured by the latest ping,
+// zero until the first pong arrives
+func (c *Client) Latency() time.Duration {
+	return time.Duration(c.latency.Load())
+}
+
+// Close stops the write pump, which closes the connection. Messages still
+// queued are dropped.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+// Kick closes the client with the given close code and reason
+func (c *Client) Kick(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = reason
+		close(c.done)
+	})
+}
+
+// CloseAfterPending closes the client with the given close code and reason
+// once the messages already queued have been sent
+func (c *Client) CloseAfterPending(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = reason
+		c.flush = true
+		close(c.done)
+	})
+}
+
+// writePump sends queued messages and pings until the client is closed or a
+// write fails
+func (c *Client) writePump() {
+	ticker := time.NewTicker(clientPingPeriod)
+	defer ticker.Stop()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(clientWriteWait))
+			sentAt := strconv.FormatInt(time.Now().UnixNano(), 10)
+			if err := c.conn.WriteMessage(websocket.PingMessage, []byte(sentAt)); err != nil {
+				log.Printf("WebSocket ping to %s failed: %v", c.conn.RemoteAddr(), err)
+				c.Close()
+				return
+			}
+
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(clientWriteWait))
+			if err := c.conn.WriteMessage(c.messageType(), data); err != nil {
+				log.Printf("WebSocket write to %s failed: %v", c.conn.RemoteAddr(), err)
+				c.Close()
+				return
+			}
+
+		case <-c.done:
+			if c.flush && !c.writePending() {
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(clientWriteWait))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText))
+			return
+		}
+	}
+}
+
+// writePending sends whatever is still queued, reporting false if a write fails
+func (c *Client) writePending() bool {
+	for {
+		select {
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(clientWriteWait))
+			if err := c.conn.WriteMessage(c.messageType(), data); err != nil {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// messageType is the frame type for the client's encoding
+func (c *Client) messageType() int {
+	if c.binary {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
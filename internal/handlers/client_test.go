@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connect-four-backend/internal/models"
+	"connect-four-backend/internal/msgpack"
+
+	"github.com/gorilla/websocket"
+)
+
+// readOne serves one WebSocket connection over the msgpack subprotocol, sends
+// it the frame and returns what the client's ReadJSON made of it
+func readOne(t *testing.T, messageType int, frame []byte) error {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{subprotocolMsgpack}}
+	result := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			result <- err
+			return
+		}
+		client := newClient(ws)
+		defer client.Close()
+
+		var message models.WSMessage
+		result <- client.ReadJSON(&message)
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocolMsgpack}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The server may close the connection before an oversized frame is written
+	conn.WriteMessage(messageType, frame)
+	return <-result
+}
+
+func TestClientReadsMsgpack(t *testing.T) {
+	frame, err := msgpack.Encode(map[string]interface{}{"type": "join_queue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := readOne(t, websocket.BinaryMessage, frame); err != nil {
+		t.Errorf("ReadJSON of a msgpack message: %v", err)
+	}
+}
+
+func TestClientRejectsDeepMsgpack(t *testing.T) {
+	frame := bytes.Repeat([]byte{0x91}, clientMaxMessageSize/2)
+	if err := readOne(t, websocket.BinaryMessage, frame); !errors.Is(err, msgpack.ErrTooDeep) {
+		t.Errorf("ReadJSON of deeply nested msgpack = %v, want %v", err, msgpack.ErrTooDeep)
+	}
+}
+
+func TestClientReadLimit(t *testing.T) {
+	frame := bytes.Repeat([]byte{0x91}, 6<<20)
+	if err := readOne(t, websocket.BinaryMessage, frame); !errors.Is(err, websocket.ErrReadLimit) {
+		t.Errorf("ReadJSON of a 6MB frame = %v, want %v", err, websocket.ErrReadLimit)
+	}
+}
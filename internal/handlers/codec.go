@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"connect-four-backend/internal/msgpack"
+)
+
+// WebSocket subprotocols offered to clients. Clients asking for msgpack get
+// every message as a binary MessagePack frame with the same fields as the
+// JSON one, anything else gets JSON.
+const (
+	subprotocolMsgpack = "connect-four.msgpack"
+	subprotocolJSON    = "connect-four.json"
+)
+
+// jsonToMsgpack re-encodes a JSON message as MessagePack
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return msgpack.Encode(value)
+}
+
+// msgpackToJSON re-encodes a MessagePack message as JSON for decoding into the models
+func msgpackToJSON(data []byte) ([]byte, error) {
+	value, err := msgpack.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// DrainStatus is how far a drain has got
+type DrainStatus struct {
+	Draining      bool `json:"draining"`
+	ActiveGames   int  `json:"active_games"`   // games this instance hosts that are still being played
+	PausedGames   int  `json:"paused_games"`   // not waited for, saved for the restart
+	QueuedPlayers int  `json:"queued_players"` // kept queued and saved for the restart
+	Connections   int  `json:"connections"`
+}
+
+// RequestDrain asks for the server to drain and shut down, as a SIGTERM does.
+// It reports whether this was the first request.
+func (h *GameHandler) RequestDrain() bool {
+	requested := false
+	h.drainOnce.Do(func() {
+		close(h.drainRequested)
+		requested = true
+	})
+	return requested
+}
+
+// DrainRequested is closed once a drain is requested through RequestDrain
+func (h *GameHandler) DrainRequested() <-chan struct{} {
+	return h.drainRequested
+}
+
+// Draining reports whether the server stopped taking new games
+func (h *GameHandler) Draining() bool {
+	return h.draining.Load()
+}
+
+// DrainStatus returns whether the server is draining and what it waits on
+func (h *GameHandler) DrainStatus() DrainStatus {
+	open, _ := h.hub.counts()
+	playing, paused := h.gameManager.DrainCounts()
+	return DrainStatus{
+		Draining:      h.Draining(),
+		ActiveGames:   playing,
+		PausedGames:   paused,
+		QueuedPlayers: h.matchmaker.GetQueueStats().CurrentSize,
+		Connections:   open,
+	}
+}
+
+// Drain gets the server ready for a restart without cutting games short. The
+// matchmaker stops making matches, tournaments start no games, and no queue
+// joins, private games or tournament entries are taken, while the games in
+// progress are played out. Every client is told, and Drain waits until the
+// last game ends or ctx is done. Paused games aren't waited for, Shutdown
+// saves them. Connections stay open, so players can still reconnect to their
+// games.
+func (h *GameHandler) Drain(ctx context.Context) error {
+	if h.draining.CompareAndSwap(false, true) {
+		h.matchmaker.Drain()
+		h.tournaments.Drain()
+
+		payload := models.ServerDrainingPayload{
+			Message: "The server is restarting soon, games in progress can be finished but no new ones started",
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			payload.Deadline = &deadline
+		}
+		sent := h.hub.broadcast(models.NewWSMessage(models.MsgServerDraining, payload))
+		log.Printf("Draining, told %d connections", sent)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		active, paused := h.gameManager.DrainCounts()
+		if active == 0 {
+			log.Printf("Drained, no games in progress and %d paused", paused)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Stopped draining with %d games in progress", active)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// refuseWhileDraining tells the client no new games are started while the
+// server drains, reporting whether it did
+func (h *GameHandler) refuseWhileDraining(conn *Client) bool {
+	if !h.Draining() {
+		return false
+	}
+
+	h.sendError(conn, "SERVER_DRAINING", "The server is restarting soon and isn't starting new games, try again in a moment", "")
+	return true
+}
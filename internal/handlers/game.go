@@ -1,53 +1,183 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"connect-four-backend/internal/accounts"
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/auth"
+	"connect-four-backend/internal/chat"
+	"connect-four-backend/internal/database"
 	"connect-four-backend/internal/game"
 	"connect-four-backend/internal/kafka"
+	"connect-four-backend/internal/logging"
 	"connect-four-backend/internal/matchmaking"
+	"connect-four-backend/internal/metrics"
 	"connect-four-backend/internal/models"
+	"connect-four-backend/internal/tournament"
+	"connect-four-backend/internal/tracing"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
 
 type GameHandler struct {
 	gameManager      *game.Manager
-	matchmaker       *matchmaking.Matchmaker
+	matchmaker       *matchmaking.MatchmakingService
+	tournaments      *tournament.Service
 	analyticsService *kafka.AnalyticsService
+	sessions         *auth.Sessions
+	accounts         *accounts.Service
+	chat             *chat.Service
+	rateLimits       RateLimitConfig
 	upgrader         websocket.Upgrader
+
+	// Every open connection, for announcements and shutdown
+	hub *hub
+
+	// Set once the server stops taking new games ahead of a restart.
+	// drainRequested is closed when an admin asks for one.
+	draining       atomic.Bool
+	drainRequested chan struct{}
+	drainOnce      sync.Once
+
+	// Closed to end every Server-Sent Events game stream
+	streamsClosed    chan struct{}
+	closeStreamsOnce sync.Once
+
+	// Finished games kept after the server forgets them, for replays
+	history GameHistory
 }
 
-func NewGameHandler(gameManager *game.Manager, matchmaker *matchmaking.Matchmaker, analyticsService *kafka.AnalyticsService) *GameHandler {
-	return &GameHandler{
+// GameHistory looks up finished games with their move history
+type GameHistory interface {
+	// GetFinishedGame returns nil if the game isn't kept
+	GetFinishedGame(gameID uuid.UUID) (*models.Game, error)
+
+	// FindFinishedGames returns a page of the finished games the query picks
+	FindFinishedGames(query database.GameQuery) (*database.GamePage, error)
+}
+
+func NewGameHandler(gameManager *game.Manager, matchmaker *matchmaking.MatchmakingService, tournaments *tournament.Service, analyticsService *kafka.AnalyticsService, sessions *auth.Sessions, accountService *accounts.Service, chatService *chat.Service) *GameHandler {
+	h := &GameHandler{
 		gameManager:      gameManager,
 		matchmaker:       matchmaker,
+		tournaments:      tournaments,
 		analyticsService: analyticsService,
+		sessions:         sessions,
+		accounts:         accountService,
+		chat:             chatService,
+		rateLimits:       DefaultRateLimitConfig(),
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // TODO: Add proper origin checking for production
-			},
+			// MessagePack is preferred when a client offers both
+			Subprotocols: []string{subprotocolMsgpack, subprotocolJSON},
+
+			// Only the server's own pages until SetAllowedOrigins says otherwise
+			CheckOrigin: newOriginChecker(nil, false).check,
 		},
+		hub: newHub(),
+
+		drainRequested: make(chan struct{}),
+		streamsClosed:  make(chan struct{}),
 	}
+
+	// Analyze every finished game for post-game review
+	gameManager.OnGameEnd(h.analyzeFinishedGame)
+
+	// Let everyone know when a scheduled tournament opens registration
+	tournaments.OnEvent(h.announceTournament)
+
+	return h
+}
+
+// SetAllowedOrigins lets pages on the given origins open WebSockets, on top
+// of the server's own. allowAll accepts any origin and is meant for development.
+func (h *GameHandler) SetAllowedOrigins(origins []string, allowAll bool) {
+	h.upgrader.CheckOrigin = newOriginChecker(origins, allowAll).check
+}
+
+// SetGameHistory sets where replays of games the server no longer holds are found
+func (h *GameHandler) SetGameHistory(history GameHistory) {
+	h.history = history
+}
+
+// SetRateLimitConfig changes the message rate limits of new connections
+func (h *GameHandler) SetRateLimitConfig(config RateLimitConfig) {
+	h.rateLimits = config
+}
+
+// RegisterMetrics exposes the WebSocket connections, the games being played
+// and the matchmaking queue
+func (h *GameHandler) RegisterMetrics(registry *metrics.Registry) {
+	registry.GaugeFunc("connect_four_websocket_connections", "WebSocket connections open",
+		func() float64 { open, _ := h.hub.counts(); return float64(open) })
+	registry.CounterFunc("connect_four_websocket_connections_opened_total", "WebSocket connections opened",
+		func() float64 { _, opened := h.hub.counts(); return float64(opened) })
+	registry.GaugeFunc("connect_four_active_games", "Games being played",
+		func() float64 { return float64(h.gameManager.ActiveGameCount()) })
+
+	registry.GaugeFunc("connect_four_matchmaking_queue_depth", "Players waiting in the matchmaking queue",
+		func() float64 { return float64(h.matchmaker.GetQueueStats().CurrentSize) })
+	registry.CounterFunc("connect_four_matchmaking_joined_total", "Players who joined the matchmaking queue",
+		func() float64 { return float64(h.matchmaker.GetQueueStats().TotalJoined) })
+	registry.CounterFunc("connect_four_matchmaking_left_total", "Players who left the matchmaking queue",
+		func() float64 { return float64(h.matchmaker.GetQueueStats().TotalLeft) })
+	registry.CounterFunc("connect_four_matchmaking_matched_total", "Games matched between players",
+		func() float64 { return float64(h.matchmaker.GetQueueStats().TotalMatched) })
+	registry.CounterFunc("connect_four_matchmaking_bot_matches_total", "Games matched against a bot",
+		func() float64 { return float64(h.matchmaker.GetQueueStats().TotalBotMatches) })
 }
 
 func (h *GameHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if h.hub.isClosing() {
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Server is shutting down")
+		return
+	}
+
+	ws, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
+
+	// All writes to the connection go through the client's write pump
+	conn := newClient(ws)
+	conn.sessionID = uuid.NewString()
+	conn.traceID = requestTraceID(r)
 	defer conn.Close()
 
-	log.Printf("New WebSocket connection established from %s", r.RemoteAddr)
+	if !h.hub.add(conn) {
+		conn.Kick(websocket.CloseServiceRestart, "server is shutting down")
+		return
+	}
+	defer h.hub.remove(conn)
+
+	logging.Infof("New WebSocket connection established from %s", r.RemoteAddr)
 
 	var playerID uuid.UUID
+	var sessionPlayerID uuid.UUID // player the connection last received a session token for
+	var spectator *spectatorSession
+
+	// Clients with a session, from logging in or an earlier connection, keep
+	// their player ID. Logged in players play as their account.
+	if token := r.URL.Query().Get("token"); token != "" {
+		playerID = h.authenticate(conn, token)
+	}
+
+	limiter := newConnectionLimiter(h.rateLimits)
 
 	// Main message loop
+	disconnectReason := "connection_closed"
 	for {
 		var msg models.WSMessage
 		if err := conn.ReadJSON(&msg); err != nil {
@@ -55,78 +185,346 @@ func (h *GameHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
 				log.Printf("WebSocket unexpected close: %v", err)
 			}
+			// The read deadline passes when the client stops answering pings
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				log.Printf("WebSocket connection from %s stopped responding", r.RemoteAddr)
+				disconnectReason = "connection_timeout"
+			}
 			// For normal closes (1001 going away, 1000 normal), just break silently
 			break
 		}
 
+		if allowed, abusive := limiter.allow(msg.Type); !allowed {
+			if abusive {
+				log.Printf("Disconnecting %s for exceeding message rate limits", r.RemoteAddr)
+				disconnectReason = "rate_limited"
+				conn.Kick(websocket.ClosePolicyViolation, "rate limit exceeded")
+				break
+			}
+			h.sendError(conn, "RATE_LIMITED", "Too many messages, slow down", string(msg.Type))
+			continue
+		}
+
+		// Each message is a trace of its own, tagged with the connection's
+		// trace ID to find a player's messages together
+		ctx, span := tracing.Start(context.Background(), "ws "+string(msg.Type), tracing.KindServer,
+			tracing.String("ws.message_type", string(msg.Type)),
+			tracing.String("session.id", conn.sessionID),
+			tracing.String("connect_four.trace_id", conn.traceID))
+
 		switch msg.Type {
 		case models.MsgJoinQueue:
-			playerID, _ = h.handleJoinQueue(conn, msg.Payload)
+			playerID, _ = h.handleJoinQueue(conn, playerID, msg.Payload)
+
+		case models.MsgQueueStatus:
+			h.handleQueueStatus(conn, playerID)
 
 		case models.MsgLeaveQueue:
 			h.handleLeaveQueue(playerID)
 
+		case models.MsgCreatePrivateGame:
+			playerID = h.handleCreatePrivateGame(conn, msg.Payload)
+
+		case models.MsgJoinPrivateGame:
+			playerID = h.handleJoinPrivateGame(conn, msg.Payload)
+
+		case models.MsgJoinTournament:
+			playerID = h.handleJoinTournament(conn, playerID, msg.Payload)
+
+		case models.MsgLeaveTournament:
+			h.handleLeaveTournament(conn, playerID, msg.Payload)
+
+		case models.MsgGetTournament:
+			h.handleGetTournament(conn, msg.Payload)
+
+		case models.MsgSpectateGame:
+			spectator = h.handleSpectateGame(conn, playerID, spectator, msg.Payload)
+
+		case models.MsgStopSpectating:
+			if spectator != nil {
+				h.gameManager.RemoveSpectator(spectator.gameID, conn)
+				spectator = nil
+			}
+
+		case models.MsgChat:
+			h.handleChat(conn, playerID, spectator, msg.Payload)
+
+		case models.MsgEmote:
+			h.handleEmote(conn, playerID, spectator, msg.Payload)
+
+		case models.MsgGetGameState:
+			h.handleGetGameState(conn, msg.Payload)
+
 		case models.MsgMakeMove:
-			h.handleMakeMove(conn, playerID, msg.Payload)
+			h.handleMakeMove(ctx, conn, playerID, msg.Payload)
 
 		case models.MsgReconnect:
 			playerID, _ = h.handleReconnect(conn, msg.Payload)
 
+		case models.MsgTakeControl:
+			h.handleTakeControl(conn, playerID, msg.Payload)
+
 		case models.MsgHeartbeat:
-			h.handleHeartbeat(conn, playerID)
+			h.handleHeartbeat(conn, playerID, msg.Payload)
 
 		default:
 			h.sendError(conn, "UNKNOWN_MESSAGE", "Unknown message type", "")
 		}
+
+		if playerID != uuid.Nil {
+			span.SetAttributes(tracing.String("player.id", playerID.String()))
+		}
+		span.End()
+
+		// Hand out a session token whenever the connection gets a player ID
+		if playerID != uuid.Nil && playerID != sessionPlayerID {
+			h.sendSession(conn, playerID)
+			h.hub.setPlayer(conn, playerID)
+			sessionPlayerID = playerID
+		}
 	}
 
-	// Clean up when player disconnects
-	if playerID != uuid.Nil {
-		h.gameManager.RemovePlayerConnection(playerID)
-		h.matchmaker.LeaveQueue(playerID)
-		log.Printf("Player %s disconnected cleanly", playerID)
+	if spectator != nil {
+		h.gameManager.RemoveSpectator(spectator.gameID, conn)
+	}
+
+	// Clean up when player disconnects. During a shutdown their game and
+	// queue spot are kept for when they reconnect after the restart.
+	if h.hub.isClosing() {
+		log.Printf("WebSocket connection from %s closed for shutdown", r.RemoteAddr)
+	} else if playerID != uuid.Nil {
+		if gameInstance, player := h.gameManager.RemovePlayerConnection(playerID, conn); gameInstance != nil {
+			h.announceDisconnect(gameInstance, player, disconnectReason, eventMetadata(conn))
+		}
+
+		// The player's other devices keep their game going
+		if _, stillConnected := h.gameManager.GetPlayerConnection(playerID); stillConnected {
+			logging.Infof("Player %s closed one of their devices", playerID)
+		} else {
+			h.matchmaker.LeaveQueue(playerID)
+			h.matchmaker.CancelPrivateRoom(playerID)
+			h.tournaments.Disconnect(playerID)
+			logging.Infof("Player %s disconnected cleanly", playerID)
+		}
 	} else {
-		log.Printf("WebSocket connection closed from %s", r.RemoteAddr)
+		logging.Infof("WebSocket connection closed from %s", r.RemoteAddr)
 	}
 }
 
-func (h *GameHandler) handleJoinQueue(conn *websocket.Conn, payload interface{}) (uuid.UUID, uuid.UUID) {
+func (h *GameHandler) handleJoinQueue(conn *Client, currentPlayerID uuid.UUID, payload interface{}) (uuid.UUID, uuid.UUID) {
+	if h.refuseWhileDraining(conn) {
+		return currentPlayerID, uuid.Nil
+	}
+
 	var joinPayload models.JoinQueuePayload
 	if err := h.parsePayload(payload, &joinPayload); err != nil {
 		h.sendError(conn, "INVALID_PAYLOAD", "Invalid join queue payload", "")
-		return uuid.Nil, uuid.Nil
+		return currentPlayerID, uuid.Nil
 	}
 
-	player := h.matchmaker.JoinQueue(joinPayload.PlayerName, conn)
+	playerName, ok := h.resolvePlayerName(conn, joinPayload.PlayerName)
+	if !ok {
+		return currentPlayerID, uuid.Nil
+	}
 
-	// Send analytics event
-	h.analyticsService.SendEvent("player_joined_queue", map[string]interface{}{
-		"player_id":   player.ID.String(),
-		"player_name": player.Name,
+	if joinPayload.MaxWaitTime < 0 {
+		h.sendError(conn, "INVALID_PAYLOAD", "max_wait_time must not be negative", strconv.Itoa(joinPayload.MaxWaitTime))
+		return currentPlayerID, uuid.Nil
+	}
+
+	// Bot fallback follows the player's choice, 0 keeps the server default wait
+	preferences := matchmaking.DefaultMatchPreferences()
+	preferences.MaxWaitTime = joinPayload.MaxWaitTime
+	queueType := models.QueueType(joinPayload.QueueType)
+	if queueType == "" && joinPayload.PartyID != "" {
+		queueType = models.QueueTypeTeam
+	}
+	switch queueType {
+	case "", models.QueueTypeCasual:
+		preferences.QueueType = models.QueueTypeCasual
+	case models.QueueTypeRanked, models.QueueTypeTeam:
+		preferences.QueueType = queueType
+	default:
+		h.sendError(conn, "INVALID_QUEUE_TYPE", "Queue type must be casual, ranked or team", joinPayload.QueueType)
+		return currentPlayerID, uuid.Nil
+	}
+	if joinPayload.PartyID != "" && preferences.QueueType != models.QueueTypeTeam {
+		h.sendError(conn, "INVALID_PARTY", "Parties can only join the team queue", joinPayload.PartyID)
+		return currentPlayerID, uuid.Nil
+	}
+	preferences.PartyID = joinPayload.PartyID
+	if joinPayload.AllowBots != nil {
+		preferences.AllowBots = *joinPayload.AllowBots
+	}
+	if joinPayload.SkillLevel > 0 {
+		preferences.SkillLevel = joinPayload.SkillLevel
+	}
+
+	// Keep the same player ID for every queue join on this connection
+	playerID := currentPlayerID
+	if playerID == uuid.Nil {
+		playerID = uuid.New()
+	}
+
+	response, err := h.matchmaker.JoinQueue(playerID, playerName, conn, preferences)
+	switch err {
+	case nil:
+	case matchmaking.ErrPlayerAlreadyInQueue:
+		// Already queued from this connection, just report where they stand
+		h.sendQueueStatus(conn, &matchmaking.QueueStatus{
+			PlayerID:      response.PlayerID,
+			QueueType:     preferences.QueueType,
+			Position:      response.Position,
+			QueueSize:     response.QueueSize,
+			EstimatedWait: response.EstimatedWait,
+		})
+		return response.PlayerID, uuid.Nil
+	case matchmaking.ErrUsernameTaken:
+		h.sendError(conn, "NAME_TAKEN", "That name is already waiting in the queue", playerName)
+		return currentPlayerID, uuid.Nil
+	case matchmaking.ErrQueueCooldown:
+		seconds := int(response.Cooldown.Seconds()) + 1
+		h.sendError(conn, "QUEUE_COOLDOWN", fmt.Sprintf("You left a recent game early, you can queue again in %d seconds", seconds), strconv.Itoa(seconds))
+		return currentPlayerID, uuid.Nil
+	case matchmaking.ErrPartyFull:
+		h.sendError(conn, "PARTY_FULL", "Both members of this party are already queued", joinPayload.PartyID)
+		return currentPlayerID, uuid.Nil
+	case matchmaking.ErrServiceDraining:
+		h.refuseWhileDraining(conn)
+		return currentPlayerID, uuid.Nil
+	default:
+		h.sendError(conn, "JOIN_QUEUE_FAILED", "Failed to join matchmaking queue", err.Error())
+		return currentPlayerID, uuid.Nil
+	}
+
+	// A player restored after a server restart gets their old ID back
+	playerID = response.PlayerID
+
+	h.sendQueueStatus(conn, &matchmaking.QueueStatus{
+		PlayerID:      playerID,
+		QueueType:     preferences.QueueType,
+		Position:      response.Position,
+		QueueSize:     response.QueueSize,
+		EstimatedWait: response.EstimatedWait,
 	})
 
-	return player.ID, uuid.Nil
+	return playerID, uuid.Nil
+}
+
+// handleQueueStatus tells the client their queue position and estimated wait
+func (h *GameHandler) handleQueueStatus(conn *Client, playerID uuid.UUID) {
+	status, err := h.matchmaker.GetQueueStatus(playerID)
+	if err != nil {
+		h.sendError(conn, "NOT_IN_QUEUE", "Player is not in the matchmaking queue", "")
+		return
+	}
+
+	h.sendQueueStatus(conn, status)
+}
+
+func (h *GameHandler) sendQueueStatus(conn *Client, status *matchmaking.QueueStatus) {
+	conn.WriteJSON(models.NewWSMessage(models.MsgQueueStatus, status.ToPayload()))
 }
 
 func (h *GameHandler) handleLeaveQueue(playerID uuid.UUID) {
 	if playerID != uuid.Nil {
 		h.matchmaker.LeaveQueue(playerID)
+	}
+}
 
-		// Send analytics event
-		h.analyticsService.SendEvent("player_left_queue", map[string]interface{}{
-			"player_id": playerID.String(),
-		})
+// handleCreatePrivateGame opens a private room and sends its invite code to the host
+func (h *GameHandler) handleCreatePrivateGame(conn *Client, payload interface{}) uuid.UUID {
+	if h.refuseWhileDraining(conn) {
+		return uuid.Nil
+	}
+
+	var createPayload models.CreatePrivateGamePayload
+	if err := h.parsePayload(payload, &createPayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid create private game payload", "")
+		return uuid.Nil
+	}
+
+	playerName, ok := h.resolvePlayerName(conn, createPayload.PlayerName)
+	if !ok {
+		return uuid.Nil
+	}
+
+	playerID := h.privateGamePlayerID(conn)
+	room, err := h.matchmaker.CreatePrivateRoom(playerID, playerName, conn)
+	if err != nil {
+		h.sendError(conn, "CREATE_PRIVATE_GAME_FAILED", "Failed to create private game", err.Error())
+		return uuid.Nil
 	}
+
+	conn.WriteJSON(models.NewWSMessage(models.MsgPrivateGameCreated, models.PrivateGameCreatedPayload{
+		Code:      room.Code,
+		PlayerID:  playerID,
+		ExpiresAt: room.ExpiresAt,
+	}))
+
+	// Send analytics event
+	h.analyticsService.SendEvent("private_game_created", map[string]interface{}{
+		"player_id":   playerID.String(),
+		"player_name": playerName,
+		"private":     true,
+	}, eventMetadata(conn))
+
+	return playerID
 }
 
-func (h *GameHandler) handleMakeMove(conn *websocket.Conn, playerID uuid.UUID, payload interface{}) {
+// handleJoinPrivateGame joins a friend's private room by invite code
+func (h *GameHandler) handleJoinPrivateGame(conn *Client, payload interface{}) uuid.UUID {
+	if h.refuseWhileDraining(conn) {
+		return uuid.Nil
+	}
+
+	var joinPayload models.JoinPrivateGamePayload
+	if err := h.parsePayload(payload, &joinPayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid join private game payload", "")
+		return uuid.Nil
+	}
+
+	playerName, ok := h.resolvePlayerName(conn, joinPayload.PlayerName)
+	if !ok {
+		return uuid.Nil
+	}
+
+	playerID := h.privateGamePlayerID(conn)
+	match, err := h.matchmaker.JoinPrivateRoom(joinPayload.Code, playerID, playerName, conn)
+	if err != nil {
+		if err == matchmaking.ErrRoomNotFound {
+			h.sendError(conn, "ROOM_NOT_FOUND", "No private game with that code", joinPayload.Code)
+		} else {
+			h.sendError(conn, "JOIN_PRIVATE_GAME_FAILED", "Failed to join private game", err.Error())
+		}
+		return uuid.Nil
+	}
+
+	// Send analytics event
+	h.analyticsService.SendEvent("private_game_joined", map[string]interface{}{
+		"game_id":     match.GameID.String(),
+		"player_id":   playerID.String(),
+		"player_name": playerName,
+		"host_id":     match.Player1.ID.String(),
+		"private":     true,
+	}, eventMetadata(conn))
+
+	return playerID
+}
+
+func (h *GameHandler) handleMakeMove(ctx context.Context, conn *Client, playerID uuid.UUID, payload interface{}) {
 	var movePayload models.MakeMovePayload
 	if err := h.parsePayload(payload, &movePayload); err != nil {
 		h.sendError(conn, "INVALID_PAYLOAD", "Invalid move payload", "")
 		return
 	}
 
-	move, err := h.gameManager.MakeMove(movePayload.GameID, playerID, movePayload.Column)
+	if h.gameManager.IsFollower(playerID, conn) {
+		h.sendError(conn, "READ_ONLY", "Another of your devices controls this game, take control to play here", movePayload.GameID.String())
+		return
+	}
+
+	delta, err := h.playMove(ctx, movePayload.GameID, playerID, movePayload.Column)
 	if err != nil {
 		// Get current game state for error response
 		gameInstance, _ := h.gameManager.GetGame(movePayload.GameID)
@@ -140,34 +538,47 @@ func (h *GameHandler) handleMakeMove(conn *websocket.Conn, playerID uuid.UUID, p
 		return
 	}
 
-	// Get updated game state
-	gameInstance, _ := h.gameManager.GetGame(movePayload.GameID)
+	h.announceMove(ctx, playerID, delta, eventMetadata(conn))
+}
 
-	// Prepare move result payload
-	moveResult := models.MoveResultPayload{
-		Success:    true,
-		Move:       move,
-		GameState:  gameInstance,
-		IsGameOver: gameInstance.State == models.GameStateFinished,
-		NextTurn:   int(gameInstance.CurrentTurn),
-	}
+// playMove plays a move over WebSocket or REST, in a span of its own. Games
+// hosted by another instance include the round trip to it.
+func (h *GameHandler) playMove(ctx context.Context, gameID, playerID uuid.UUID, column int) (*models.GameDeltaPayload, error) {
+	_, span := tracing.Start(ctx, "game.play_move", tracing.KindInternal,
+		tracing.String("game.id", gameID.String()),
+		tracing.String("player.id", playerID.String()),
+		tracing.Int("game.column", column))
+	defer span.End()
 
-	// Add win result if game is finished
-	if gameInstance.State == models.GameStateFinished {
-		// Note: WinResult is not available in models.Game, would need to be added or calculated
-		// moveResult.WinResult = gameInstance.WinResult
+	delta, err := h.gameManager.PlayMove(gameID, playerID, column)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
 	}
 
-	// Send move result to all players
-	h.gameManager.BroadcastToGame(movePayload.GameID, models.NewWSMessage(models.MsgMoveResult, moveResult))
+	span.SetAttributes(tracing.Int("game.version", delta.Version), tracing.String("game.state", delta.State.String()))
+	return delta, nil
+}
+
+// announceMove broadcasts a move made over WebSocket or REST and reports the
+// game's end if it was the last one
+func (h *GameHandler) announceMove(ctx context.Context, playerID uuid.UUID, delta *models.GameDeltaPayload, metadata kafka.Metadata) {
+	gameInstance, _ := h.gameManager.GetGame(delta.GameID)
+	move := delta.Move
+	metadata = withTraceParent(ctx, metadata)
+
+	// Players and spectators only need what changed, the full game follows at the end
+	_, span := tracing.Start(ctx, "game.broadcast", tracing.KindInternal, tracing.String("game.id", delta.GameID.String()))
+	h.gameManager.BroadcastToGame(delta.GameID, models.NewWSMessage(models.MsgGameDelta, delta))
+	span.End()
 
 	// Send analytics event
 	h.analyticsService.SendEvent("move_made", map[string]interface{}{
-		"game_id":   movePayload.GameID.String(),
+		"game_id":   delta.GameID.String(),
 		"player_id": playerID.String(),
-		"column":    movePayload.Column,
+		"column":    move.Column,
 		"row":       move.Row,
-	})
+	}, metadata)
 
 	// Check if game ended
 	if gameInstance.State == models.GameStateFinished {
@@ -189,7 +600,7 @@ func (h *GameHandler) handleMakeMove(conn *websocket.Conn, playerID uuid.UUID, p
 			}
 		}
 
-		h.gameManager.BroadcastToGame(movePayload.GameID, models.NewWSMessage(models.MsgGameEnd, gameEndPayload))
+		h.gameManager.BroadcastToGame(delta.GameID, models.NewWSMessage(models.MsgGameEnd, gameEndPayload))
 
 		// Send analytics event
 		reason := "draw"
@@ -198,21 +609,65 @@ func (h *GameHandler) handleMakeMove(conn *websocket.Conn, playerID uuid.UUID, p
 		}
 
 		h.analyticsService.SendEvent("game_ended", map[string]interface{}{
-			"game_id":  movePayload.GameID.String(),
-			"winner":   gameInstance.Winner,
-			"reason":   reason,
-			"duration": gameInstance.FinishedAt.Sub(gameInstance.CreatedAt).Seconds(),
-		})
+			"game_id":    delta.GameID.String(),
+			"winner":     gameInstance.Winner,
+			"reason":     reason,
+			"duration":   gameInstance.FinishedAt.Sub(gameInstance.CreatedAt).Seconds(),
+			"queue_type": string(gameInstance.QueueType),
+			"private":    gameInstance.QueueType == models.QueueTypePrivate,
+		}, metadata)
 	}
 }
 
-func (h *GameHandler) handleReconnect(conn *websocket.Conn, payload interface{}) (uuid.UUID, uuid.UUID) {
+// handleGetGameState sends the full game, clients use it to resync after a
+// gap in the deltas
+func (h *GameHandler) handleGetGameState(conn *Client, payload interface{}) {
+	var statePayload models.GetGameStatePayload
+	if err := h.parsePayload(payload, &statePayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid get game state payload", "")
+		return
+	}
+
+	gameInstance, exists := h.gameManager.GetGame(statePayload.GameID)
+	if !exists {
+		h.sendError(conn, "GAME_NOT_FOUND", "Game not found", statePayload.GameID.String())
+		return
+	}
+
+	conn.WriteJSON(models.NewWSMessage(models.MsgGameState, models.GameStatePayload{
+		GameState: gameInstance,
+	}))
+}
+
+func (h *GameHandler) handleReconnect(conn *Client, payload interface{}) (uuid.UUID, uuid.UUID) {
 	var reconnectPayload models.ReconnectPayload
 	if err := h.parsePayload(payload, &reconnectPayload); err != nil {
 		h.sendError(conn, "INVALID_PAYLOAD", "Invalid reconnect payload", "")
 		return uuid.Nil, uuid.Nil
 	}
 
+	// Only the client the player ID was issued to may reconnect as that player
+	if err := h.sessions.VerifyPlayer(reconnectPayload.Token, reconnectPayload.PlayerID); err != nil {
+		h.sendError(conn, "UNAUTHORIZED", "Invalid session token", err.Error())
+		return uuid.Nil, uuid.Nil
+	}
+
+	// Without a game the client is reconnecting to its queue spot, or to the
+	// game it lost track of, wherever that is hosted
+	if reconnectPayload.GameID == uuid.Nil {
+		status, err := h.matchmaker.ReattachQueueEntry(reconnectPayload.PlayerID, conn)
+		if err == nil {
+			h.sendQueueStatus(conn, status)
+			return reconnectPayload.PlayerID, uuid.Nil
+		}
+		gameID, playing := h.gameManager.PlayerGame(reconnectPayload.PlayerID)
+		if !playing {
+			h.sendError(conn, "NOT_IN_QUEUE", "No queue entry to reconnect to", err.Error())
+			return uuid.Nil, uuid.Nil
+		}
+		reconnectPayload.GameID = gameID
+	}
+
 	// Verify game and player exist
 	gameInstance, exists := h.gameManager.GetGame(reconnectPayload.GameID)
 	if !exists {
@@ -222,7 +677,7 @@ func (h *GameHandler) handleReconnect(conn *websocket.Conn, payload interface{})
 
 	// Verify player is in the game
 	var playerInGame bool
-	for _, player := range gameInstance.Players {
+	for _, player := range gameInstance.AllPlayers() {
 		if player.ID == reconnectPayload.PlayerID {
 			playerInGame = true
 			break
@@ -234,43 +689,559 @@ func (h *GameHandler) handleReconnect(conn *websocket.Conn, payload interface{})
 		return uuid.Nil, uuid.Nil
 	}
 
-	// Re-establish connection
-	h.gameManager.AddPlayerConnection(reconnectPayload.PlayerID, reconnectPayload.GameID, conn)
+	// Remember when the player dropped out to tell the opponent how long they were gone
+	var returning *models.Player
+	var disconnectTime time.Time
+	for _, player := range gameInstance.AllPlayers() {
+		if player.ID == reconnectPayload.PlayerID && !player.Connected {
+			returning = player
+			disconnectTime = player.LastSeen
+			break
+		}
+	}
 
-	// Send reconnect success message
-	conn.WriteJSON(models.NewWSMessage(models.MsgReconnectSuccess, models.ReconnectSuccessPayload{
-		GameID:         reconnectPayload.GameID,
-		PlayerID:       reconnectPayload.PlayerID,
-		GameState:      gameInstance,
-		QueuedMessages: 0, // TODO: Implement message queuing
-		Message:        "Successfully reconnected to game",
-	}))
+	// Re-establish connection, the success message is followed by whatever
+	// the player missed while they were away
+	h.gameManager.ReconnectPlayer(reconnectPayload.PlayerID, reconnectPayload.GameID, conn, func(missed int, readOnly bool) interface{} {
+		message := "Successfully reconnected to game"
+		if readOnly {
+			message = "Following the game played on your other device, take control to play here"
+		}
+		return models.NewWSMessage(models.MsgReconnectSuccess, models.ReconnectSuccessPayload{
+			GameID:         reconnectPayload.GameID,
+			PlayerID:       reconnectPayload.PlayerID,
+			GameState:      gameInstance,
+			QueuedMessages: missed,
+			ChatHistory:    h.chat.History(reconnectPayload.GameID),
+			Message:        message,
+			ReadOnly:       readOnly,
+		})
+	})
+
+	if returning != nil && gameInstance.State == models.GameStatePlaying {
+		h.announceReconnect(gameInstance, returning, disconnectTime, eventMetadata(conn))
+	}
 
 	// Send analytics event
 	h.analyticsService.SendEvent("player_reconnected", map[string]interface{}{
 		"game_id":   reconnectPayload.GameID.String(),
 		"player_id": reconnectPayload.PlayerID.String(),
-	})
+	}, eventMetadata(conn))
 
 	return reconnectPayload.PlayerID, reconnectPayload.GameID
 }
 
-func (h *GameHandler) handleHeartbeat(conn *websocket.Conn, playerID uuid.UUID) {
+// handleTakeControl moves control of the player's game to this device, the
+// device playing it until now follows it read-only
+func (h *GameHandler) handleTakeControl(conn *Client, playerID uuid.UUID, payload interface{}) {
+	var takeControlPayload models.TakeControlPayload
+	if err := h.parsePayload(payload, &takeControlPayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid take control payload", "")
+		return
+	}
+
+	if err := h.gameManager.TakeControl(playerID, takeControlPayload.GameID, conn); err != nil {
+		h.sendError(conn, "NOT_PLAYER_DEVICE", "This connection is not following your game, reconnect to it first", err.Error())
+	}
+}
+
+// spectatorSession is the game a connection is watching and who it chats as
+type spectatorSession struct {
+	gameID uuid.UUID
+	id     uuid.UUID
+	name   string
+}
+
+// handleSpectateGame subscribes the connection to a game's broadcasts and
+// sends the current state and chat history
+func (h *GameHandler) handleSpectateGame(conn *Client, playerID uuid.UUID, current *spectatorSession, payload interface{}) *spectatorSession {
+	var spectatePayload models.SpectateGamePayload
+	if err := h.parsePayload(payload, &spectatePayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid spectate game payload", "")
+		return current
+	}
+
+	name := "Spectator"
+	if conn.account != nil || spectatePayload.PlayerName != "" {
+		resolved, ok := h.resolvePlayerName(conn, spectatePayload.PlayerName)
+		if !ok {
+			return current
+		}
+		name = resolved
+	}
+
+	gameInstance, exists := h.gameManager.GetGame(spectatePayload.GameID)
+	if !exists {
+		h.sendError(conn, "GAME_NOT_FOUND", "Game not found", spectatePayload.GameID.String())
+		return current
+	}
+
+	// Subscribe before catching up so nothing broadcast in between is lost
+	if err := h.gameManager.AddSpectator(spectatePayload.GameID, conn); err != nil {
+		h.sendError(conn, "GAME_NOT_FOUND", "Game not found", spectatePayload.GameID.String())
+		return current
+	}
+	if current != nil && current.gameID != spectatePayload.GameID {
+		h.gameManager.RemoveSpectator(current.gameID, conn)
+	}
+
+	// Spectators without a player ID still need one for chat rate limits
+	spectatorID := playerID
+	if spectatorID == uuid.Nil && current != nil {
+		spectatorID = current.id
+	}
+	if spectatorID == uuid.Nil {
+		spectatorID = uuid.New()
+	}
+
+	conn.WriteJSON(models.NewWSMessage(models.MsgSpectating, models.SpectatingPayload{
+		GameState:   gameInstance,
+		ChatHistory: h.chat.History(spectatePayload.GameID),
+	}))
+
+	return &spectatorSession{
+		gameID: spectatePayload.GameID,
+		id:     spectatorID,
+		name:   name,
+	}
+}
+
+// handleChat posts a message to the chat of a game the connection plays or watches
+func (h *GameHandler) handleChat(conn *Client, playerID uuid.UUID, spectator *spectatorSession, payload interface{}) {
+	var chatPayload models.ChatPayload
+	if err := h.parsePayload(payload, &chatPayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid chat payload", "")
+		return
+	}
+
+	senderID, senderName, role, ok := h.chatSender(conn, playerID, spectator, chatPayload.GameID)
+	if !ok {
+		return
+	}
+
+	message, err := h.chat.Post(chatPayload.GameID, senderID, senderName, role, chatPayload.Text)
+	switch err {
+	case nil:
+	case chat.ErrEmptyMessage, chat.ErrMessageTooLong:
+		h.sendError(conn, "INVALID_CHAT_MESSAGE", "Chat message must not be empty or too long", err.Error())
+		return
+	case chat.ErrRateLimited:
+		h.sendError(conn, "CHAT_RATE_LIMITED", "You are sending messages too quickly", "")
+		return
+	case chat.ErrMessageRejected:
+		h.sendError(conn, "CHAT_REJECTED", "Your message was not sent", "")
+		return
+	default:
+		h.sendError(conn, "CHAT_FAILED", "Failed to send chat message", err.Error())
+		return
+	}
+
+	// Chat has its own history, so it isn't queued for disconnected players
+	h.gameManager.BroadcastToConnected(chatPayload.GameID, models.NewWSMessage(models.MsgChat, message))
+
+	if err := h.analyticsService.EmitChatMessage(message, eventMetadata(conn)); err != nil {
+		log.Printf("Failed to emit chat message event for game %s: %v", chatPayload.GameID, err)
+	}
+}
+
+// handleEmote sends a predefined quick reaction to a game the connection plays or watches
+func (h *GameHandler) handleEmote(conn *Client, playerID uuid.UUID, spectator *spectatorSession, payload interface{}) {
+	var emotePayload models.EmotePayload
+	if err := h.parsePayload(payload, &emotePayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid emote payload", "")
+		return
+	}
+
+	senderID, senderName, role, ok := h.chatSender(conn, playerID, spectator, emotePayload.GameID)
+	if !ok {
+		return
+	}
+
+	emote, err := h.chat.Emote(emotePayload.GameID, senderID, senderName, role, emotePayload.Emote)
+	switch err {
+	case nil:
+	case chat.ErrUnknownEmote:
+		h.sendError(conn, "UNKNOWN_EMOTE", "Unknown emote", emotePayload.Emote)
+		return
+	case chat.ErrEmoteCooldown:
+		h.sendError(conn, "EMOTE_COOLDOWN", "Wait a moment before sending another emote", "")
+		return
+	default:
+		h.sendError(conn, "EMOTE_FAILED", "Failed to send emote", err.Error())
+		return
+	}
+
+	// Emotes are only of interest as they happen
+	h.gameManager.BroadcastToConnected(emotePayload.GameID, models.NewWSMessage(models.MsgEmote, emote))
+
+	if err := h.analyticsService.EmitEmoteSent(emote, eventMetadata(conn)); err != nil {
+		log.Printf("Failed to emit emote event for game %s: %v", emotePayload.GameID, err)
+	}
+}
+
+// chatSender identifies who is chatting in a game: one of its players or the
+// connection's spectator session. It reports an error to the client otherwise.
+func (h *GameHandler) chatSender(conn *Client, playerID uuid.UUID, spectator *spectatorSession, gameID uuid.UUID) (uuid.UUID, string, models.ChatRole, bool) {
+	gameInstance, exists := h.gameManager.GetGame(gameID)
+	if !exists {
+		h.sendError(conn, "GAME_NOT_FOUND", "Game not found", gameID.String())
+		return uuid.Nil, "", "", false
+	}
+
 	if playerID != uuid.Nil {
+		for _, player := range gameInstance.AllPlayers() {
+			if player.ID == playerID {
+				if h.gameManager.IsFollower(playerID, conn) {
+					h.sendError(conn, "READ_ONLY", "Another of your devices controls this game, take control to chat here", gameID.String())
+					return uuid.Nil, "", "", false
+				}
+				return player.ID, player.Name, models.ChatRolePlayer, true
+			}
+		}
+	}
+
+	if spectator != nil && spectator.gameID == gameID {
+		return spectator.id, spectator.name, models.ChatRoleSpectator, true
+	}
+
+	h.sendError(conn, "NOT_IN_GAME", "Only players and spectators of a game can chat in it", gameID.String())
+	return uuid.Nil, "", "", false
+}
+
+// announceDisconnect tells the game a player dropped out and how long they have to return
+func (h *GameHandler) announceDisconnect(gameInstance *models.Game, player *models.Player, reason string, metadata kafka.Metadata) {
+	policy := h.gameManager.DisconnectPolicy(gameInstance.QueueType)
+	gracePeriod := int(policy.GracePeriod.Seconds())
+
+	h.gameManager.BroadcastToGame(gameInstance.ID, models.NewWSMessage(models.MsgPlayerDisconnected, models.PlayerDisconnectedPayload{
+		Player:             player,
+		DisconnectTime:     player.LastSeen,
+		Reason:             reason,
+		GameState:          gameInstance.State.String(),
+		MoveNumber:         len(gameInstance.Moves),
+		GracePeriodSeconds: gracePeriod,
+		ReconnectDeadline:  player.LastSeen.Add(policy.GracePeriod),
+		Adjudication:       string(policy.Adjudication),
+	}))
+
+	if err := h.analyticsService.EmitPlayerDisconnected(gameInstance, player, reason, gracePeriod, metadata); err != nil {
+		log.Printf("Failed to emit player disconnected event for game %s: %v", gameInstance.ID, err)
+	}
+}
+
+// announceReconnect tells the game a disconnected player is back
+func (h *GameHandler) announceReconnect(gameInstance *models.Game, player *models.Player, disconnectTime time.Time, metadata kafka.Metadata) {
+	missedMoves := 0
+	for _, move := range gameInstance.Moves {
+		if move.Timestamp.After(disconnectTime) {
+			missedMoves++
+		}
+	}
+
+	now := time.Now()
+	h.gameManager.BroadcastToGame(gameInstance.ID, models.NewWSMessage(models.MsgPlayerReconnected, models.PlayerReconnectedPayload{
+		Player:            player,
+		ReconnectTime:     now,
+		DisconnectTime:    disconnectTime,
+		OfflineDurationMs: now.Sub(disconnectTime).Milliseconds(),
+		MissedMoves:       missedMoves,
+		GameState:         gameInstance.State.String(),
+	}))
+
+	if err := h.analyticsService.EmitPlayerReconnected(gameInstance, player, disconnectTime, missedMoves, metadata); err != nil {
+		log.Printf("Failed to emit player reconnected event for game %s: %v", gameInstance.ID, err)
+	}
+}
+
+// handleHeartbeat acknowledges a heartbeat with the connection's latency and
+// shares it with the player's game, reporting players whose connection starts
+// to lag
+func (h *GameHandler) handleHeartbeat(conn *Client, playerID uuid.UUID, payload interface{}) {
+	// The payload is optional, older clients send none
+	var heartbeatPayload models.HeartbeatPayload
+	if payload != nil {
+		h.parsePayload(payload, &heartbeatPayload)
+	}
+
+	latency := conn.Latency()
+
+	// Only the device playing the game speaks for the player's latency
+	if playerID != uuid.Nil && !h.gameManager.IsFollower(playerID, conn) {
 		if playerConn, exists := h.gameManager.GetPlayerConnection(playerID); exists {
 			// Update last seen time
 			playerConn.LastSeen = time.Now()
 		}
+
+		if latency > 0 {
+			gameInstance, player, previous := h.gameManager.UpdateLatency(playerID, latency)
+			if gameInstance != nil && latency >= game.HighLatency && previous < game.HighLatency {
+				if err := h.analyticsService.EmitHighLatency(gameInstance, player, latency, previous, game.HighLatency, eventMetadata(conn)); err != nil {
+					log.Printf("Failed to emit high latency event for game %s: %v", gameInstance.ID, err)
+				}
+			}
+		}
 	}
 
 	// Send heartbeat acknowledgment
-	conn.WriteJSON(models.NewWSMessage(models.MsgHeartbeatAck, map[string]interface{}{
-		"server_time":   time.Now(),
-		"connection_id": playerID.String(),
+	conn.WriteJSON(models.NewWSMessage(models.MsgHeartbeatAck, models.HeartbeatAckPayload{
+		ServerTime:   time.Now(),
+		ConnectionID: playerID.String(),
+		ClientTime:   heartbeatPayload.ClientTime,
+		LatencyMs:    int(latency.Milliseconds()),
+	}))
+}
+
+// handleJoinTournament registers the player for a tournament; bracket updates
+// and tournament games arrive on this connection
+func (h *GameHandler) handleJoinTournament(conn *Client, currentPlayerID uuid.UUID, payload interface{}) uuid.UUID {
+	if h.refuseWhileDraining(conn) {
+		return currentPlayerID
+	}
+
+	var joinPayload models.JoinTournamentPayload
+	if err := h.parsePayload(payload, &joinPayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid join tournament payload", "")
+		return currentPlayerID
+	}
+
+	playerName, ok := h.resolvePlayerName(conn, joinPayload.PlayerName)
+	if !ok {
+		return currentPlayerID
+	}
+
+	playerID := currentPlayerID
+	if playerID == uuid.Nil {
+		playerID = uuid.New()
+	}
+
+	if _, err := h.tournaments.Register(joinPayload.TournamentID, playerID, playerName, conn); err != nil {
+		switch err {
+		case tournament.ErrTournamentNotFound:
+			h.sendError(conn, "TOURNAMENT_NOT_FOUND", "Tournament not found", joinPayload.TournamentID.String())
+		case tournament.ErrRegistrationClosed, tournament.ErrTournamentFull:
+			h.sendError(conn, "REGISTRATION_CLOSED", "Tournament is not taking registrations", err.Error())
+		case tournament.ErrAlreadyRegistered:
+			h.sendError(conn, "ALREADY_REGISTERED", "You are already registered for a tournament", "")
+		case tournament.ErrEntryRequirements:
+			h.sendError(conn, "ENTRY_REQUIREMENTS", "Your rating does not meet the tournament entry requirements", "")
+		default:
+			h.sendError(conn, "JOIN_TOURNAMENT_FAILED", "Failed to join tournament", err.Error())
+		}
+		return currentPlayerID
+	}
+
+	// Send analytics event
+	h.analyticsService.SendEvent("player_joined_tournament", map[string]interface{}{
+		"player_id":     playerID.String(),
+		"player_name":   playerName,
+		"tournament_id": joinPayload.TournamentID.String(),
+	}, eventMetadata(conn))
+
+	return playerID
+}
+
+// handleLeaveTournament withdraws the player before the tournament starts
+func (h *GameHandler) handleLeaveTournament(conn *Client, playerID uuid.UUID, payload interface{}) {
+	var leavePayload models.TournamentPayload
+	if err := h.parsePayload(payload, &leavePayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid leave tournament payload", "")
+		return
+	}
+
+	if err := h.tournaments.Unregister(leavePayload.TournamentID, playerID); err != nil {
+		h.sendError(conn, "LEAVE_TOURNAMENT_FAILED", "Failed to leave tournament", err.Error())
+	}
+}
+
+// handleGetTournament sends the current bracket of a tournament
+func (h *GameHandler) handleGetTournament(conn *Client, payload interface{}) {
+	var getPayload models.TournamentPayload
+	if err := h.parsePayload(payload, &getPayload); err != nil {
+		h.sendError(conn, "INVALID_PAYLOAD", "Invalid get tournament payload", "")
+		return
+	}
+
+	t, err := h.tournaments.Get(getPayload.TournamentID)
+	if err != nil {
+		h.sendError(conn, "TOURNAMENT_NOT_FOUND", "Tournament not found", getPayload.TournamentID.String())
+		return
+	}
+
+	conn.WriteJSON(models.NewWSMessage(models.MsgTournamentUpdate, models.TournamentUpdatePayload{
+		Tournament: t,
+	}))
+}
+
+// announceTournament broadcasts scheduled tournaments to every connected player
+// when their registration opens
+func (h *GameHandler) announceTournament(event tournament.Event) {
+	if event.Type != tournament.EventCreated || event.Tournament.Schedule == "" {
+		return
+	}
+
+	h.hub.broadcast(models.NewWSMessage(models.MsgTournamentAnnounce, models.TournamentAnnouncePayload{
+		Tournament: event.Tournament,
+	}))
+}
+
+// Shutdown pauses and saves the games in progress, tells every client the
+// server is restarting and closes their connections, waiting until ctx is done
+func (h *GameHandler) Shutdown(ctx context.Context) error {
+	paused, err := h.gameManager.PauseGames()
+	if err != nil {
+		log.Printf("Failed to save games for shutdown: %v", err)
+	}
+
+	// Players whose game was saved are told they can pick it up again
+	inPausedGame := make(map[game.WSConnection]*models.Game)
+	for _, pausedGame := range paused {
+		for _, player := range pausedGame.AllPlayers() {
+			if playerConn, exists := h.gameManager.GetPlayerConnection(player.ID); exists {
+				for _, device := range playerConn.Devices() {
+					inPausedGame[device] = pausedGame
+				}
+			}
+		}
+	}
+
+	notice := func(conn *Client) interface{} {
+		pausedGame := inPausedGame[conn]
+		gamePaused := err == nil && pausedGame != nil
+
+		gracePeriod := game.DisconnectGracePeriod
+		if pausedGame != nil {
+			gracePeriod = h.gameManager.DisconnectPolicy(pausedGame.QueueType).GracePeriod
+		}
+
+		message := "The server is restarting, reconnect in a few seconds"
+		if gamePaused {
+			message = "The server is restarting, your game is saved and resumes when you reconnect"
+		}
+
+		return models.NewWSMessage(models.MsgServerShutdown, models.ServerShutdownPayload{
+			Message:               message,
+			ReconnectAfterSeconds: 5,
+			GracePeriodSeconds:    int(gracePeriod.Seconds()),
+			GamePaused:            gamePaused,
+		})
+	}
+
+	return h.hub.shutdown(ctx, notice, websocket.CloseServiceRestart, "server restarting")
+}
+
+// GetGameAnalysis returns the post-game move quality report for a game. Games
+// the server has forgotten are analyzed again from the game history.
+func (h *GameHandler) GetGameAnalysis(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid game ID")
+		return
+	}
+
+	analysis, exists := h.gameManager.GetAnalysis(gameID)
+	if !exists {
+		if _, live := h.gameManager.GetGame(gameID); live {
+			apierror.Write(w, http.StatusNotFound, "ANALYSIS_NOT_FOUND", "Analysis not found")
+			return
+		}
+		finished, err := h.finishedGame(gameID)
+		if err == game.ErrGameNotFound {
+			apierror.Write(w, http.StatusNotFound, "ANALYSIS_NOT_FOUND", "Analysis not found")
+			return
+		}
+		if err != nil {
+			status, code := gameError(err)
+			apierror.Write(w, status, code, err.Error())
+			return
+		}
+		analysis = game.AnalyzeGame(finished)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analysis)
+}
+
+// analyzeFinishedGame grades a finished game and publishes the report
+func (h *GameHandler) analyzeFinishedGame(finished *models.Game) {
+	analysis, err := h.gameManager.AnalyzeGame(finished.ID)
+	if err != nil {
+		log.Printf("Failed to analyze game %s: %v", finished.ID, err)
+		return
+	}
+
+	if err := h.analyticsService.EmitGameAnalysis(analysis, kafka.Metadata{}); err != nil {
+		log.Printf("Failed to emit game analysis for %s: %v", finished.ID, err)
+	}
+}
+
+// authenticate restores the player ID of a session token and attaches the
+// account it belongs to, if any. Invalid tokens leave the client a new guest.
+func (h *GameHandler) authenticate(conn *Client, token string) uuid.UUID {
+	claims, err := h.sessions.Verify(token)
+	if err != nil {
+		h.sendError(conn, "UNAUTHORIZED", "Invalid session token, continuing as a guest", err.Error())
+		return uuid.Nil
+	}
+
+	account, err := h.accounts.Get(claims.PlayerID)
+	switch err {
+	case nil:
+		conn.account = account
+	case accounts.ErrAccountNotFound:
+		// A guest session
+	default:
+		log.Printf("Failed to look up account %s: %v", claims.PlayerID, err)
+	}
+
+	return claims.PlayerID
+}
+
+// resolvePlayerName returns the name the connection plays under. Logged in
+// players always play as their account and guests can't use a registered name.
+func (h *GameHandler) resolvePlayerName(conn *Client, requested string) (string, bool) {
+	if conn.account != nil {
+		return conn.account.Username, true
+	}
+
+	registered, err := h.accounts.IsRegistered(requested)
+	if err != nil {
+		h.sendError(conn, "ACCOUNT_LOOKUP_FAILED", "Could not check the player name", err.Error())
+		return "", false
+	}
+	if registered {
+		h.sendError(conn, "NAME_REGISTERED", "That name belongs to a registered player, log in to use it", requested)
+		return "", false
+	}
+
+	return requested, true
+}
+
+// privateGamePlayerID returns the player ID for a private game, a new one for
+// guests so hosting and joining on one connection don't collide
+func (h *GameHandler) privateGamePlayerID(conn *Client) uuid.UUID {
+	if conn.account != nil {
+		return conn.account.ID
+	}
+	return uuid.New()
+}
+
+// sendSession issues a session token for the player's ID
+func (h *GameHandler) sendSession(conn *Client, playerID uuid.UUID) {
+	token, expiresAt, err := h.sessions.Issue(playerID)
+	if err != nil {
+		log.Printf("Failed to issue session token for %s: %v", playerID, err)
+		return
+	}
+
+	conn.WriteJSON(models.NewWSMessage(models.MsgSession, models.SessionPayload{
+		PlayerID:  playerID,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		TraceID:   conn.traceID,
 	}))
 }
 
-func (h *GameHandler) sendError(conn *websocket.Conn, code, message, details string) {
+func (h *GameHandler) sendError(conn *Client, code, message, details string) {
 	conn.WriteJSON(models.NewWSMessage(models.MsgError, models.ErrorPayload{
 		Code:    code,
 		Message: message,
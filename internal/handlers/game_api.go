@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/auth"
+	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/kafka"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// The REST game API serves clients that can't hold a WebSocket: polling
+// clients, bots and integration tests. It shares the game manager with the
+// WebSocket handler, so moves made either way reach everyone.
+
+type makeMoveRequest struct {
+	Column int `json:"column"`
+}
+
+// GetGame returns the whole game
+func (h *GameHandler) GetGame(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid game ID")
+		return
+	}
+
+	gameInstance, exists := h.gameManager.GetGame(gameID)
+	if !exists {
+		apierror.Write(w, http.StatusNotFound, "GAME_NOT_FOUND", "Game not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gameInstance)
+}
+
+// MakeMove plays a move for the authenticated player and returns the change
+// it made to the game
+func (h *GameHandler) MakeMove(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid game ID")
+		return
+	}
+
+	playerID, ok := auth.PlayerIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var request makeMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	delta, err := h.playMove(r.Context(), gameID, playerID, request.Column)
+	if err != nil {
+		status, code := gameError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	h.announceMove(r.Context(), playerID, delta, kafka.Metadata{TraceID: requestTraceID(r)})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(delta)
+}
+
+// GetGameEvents returns the changes to a game after the version in the since
+// query parameter, every change when it is omitted
+func (h *GameHandler) GetGameEvents(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid game ID")
+		return
+	}
+
+	since := 0
+	if value := r.URL.Query().Get("since"); value != "" {
+		if since, err = strconv.Atoi(value); err != nil || since < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid since version")
+			return
+		}
+	}
+
+	events, err := h.gameManager.GameEvents(gameID, since)
+	if err != nil {
+		status, code := gameError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// GetReplay returns a finished game as a replay document, or with
+// ?format=text in the compact text notation
+func (h *GameHandler) GetReplay(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid game ID")
+		return
+	}
+
+	finished, err := h.finishedGame(gameID)
+	if err != nil {
+		status, code := gameError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	replay := finished.Replay()
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, gameID))
+		json.NewEncoder(w).Encode(replay)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.txt"`, gameID))
+		io.WriteString(w, replay.Text())
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Unknown replay format, expected json or text")
+	}
+}
+
+// Pages of finished games listed by ListGames
+const (
+	defaultGamePageLimit = 20
+	maxGamePageLimit     = 100
+)
+
+// ListGames returns a page of the finished games kept in the history,
+// filtered by the player, the date range, the result, the win type and the
+// opponent type
+func (h *GameHandler) ListGames(w http.ResponseWriter, r *http.Request) {
+	if h.history == nil {
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Finished games aren't kept")
+		return
+	}
+
+	query, err := parseGameQuery(r.URL.Query())
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	page, err := h.history.FindFinishedGames(query)
+	if err != nil {
+		log.Printf("Failed to find finished games: %v", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch games")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseGameQuery reads the filters, order and page of ListGames
+func parseGameQuery(values url.Values) (database.GameQuery, error) {
+	query := database.GameQuery{
+		Player:     values.Get("player"),
+		Result:     values.Get("result"),
+		WinType:    values.Get("win_type"),
+		Opponent:   values.Get("opponent"),
+		Sort:       values.Get("sort"),
+		Descending: values.Get("order") != "asc",
+		Limit:      defaultGamePageLimit,
+	}
+
+	var err error
+	if query.From, err = parseDateParam(values.Get("from"), false); err != nil {
+		return query, errors.New("Invalid from, expected an RFC 3339 time or a date like 2024-01-31")
+	}
+	if query.To, err = parseDateParam(values.Get("to"), true); err != nil {
+		return query, errors.New("Invalid to, expected an RFC 3339 time or a date like 2024-01-31")
+	}
+
+	switch query.Result {
+	case "", database.GameResultDraw:
+	case database.GameResultWin, database.GameResultLoss:
+		if query.Player == "" {
+			return query, errors.New("A win or loss result needs a player")
+		}
+	default:
+		return query, errors.New("Unknown result, expected win, loss or draw")
+	}
+	switch query.WinType {
+	case "", models.WinTypeHorizontal, models.WinTypeVertical, models.WinTypeDiagonalPositive, models.WinTypeDiagonalNegative, models.WinTypeForfeit:
+	default:
+		return query, errors.New("Unknown win type, expected horizontal, vertical, diagonal_positive, diagonal_negative or forfeit")
+	}
+	switch query.Opponent {
+	case "", database.OpponentBot, database.OpponentHuman:
+	default:
+		return query, errors.New("Unknown opponent, expected bot or human")
+	}
+	switch query.Sort {
+	case "", database.GameSortFinishedAt, database.GameSortDuration, database.GameSortMoves:
+	default:
+		return query, errors.New("Unknown sort, expected finished_at, duration or moves")
+	}
+	if order := values.Get("order"); order != "" && order != "asc" && order != "desc" {
+		return query, errors.New("Unknown order, expected asc or desc")
+	}
+
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 || query.Limit > maxGamePageLimit {
+			return query, fmt.Errorf("Invalid limit, expected 1 to %d", maxGamePageLimit)
+		}
+	}
+	if value := values.Get("offset"); value != "" {
+		if query.Offset, err = strconv.Atoi(value); err != nil || query.Offset < 0 {
+			return query, errors.New("Invalid offset")
+		}
+	}
+	return query, nil
+}
+
+// parseDateParam reads an RFC 3339 time or a date, the zero time when it is
+// empty. A date is its start, or the end of it for the end of a range.
+func parseDateParam(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// finishedGame finds a finished game in memory or, once the server has
+// forgotten it, in the game history
+func (h *GameHandler) finishedGame(gameID uuid.UUID) (*models.Game, error) {
+	if gameInstance, exists := h.gameManager.GetGame(gameID); exists {
+		if gameInstance.State != models.GameStateFinished {
+			return nil, game.ErrGameNotFinished
+		}
+		return gameInstance, nil
+	}
+
+	if h.history == nil {
+		return nil, game.ErrGameNotFound
+	}
+
+	finished, err := h.history.GetFinishedGame(gameID)
+	if err != nil {
+		log.Printf("Failed to load finished game %s: %v", gameID, err)
+		return nil, err
+	}
+	if finished == nil {
+		return nil, game.ErrGameNotFound
+	}
+	return finished, nil
+}
+
+// gameError maps game manager errors to HTTP status and error codes
+func gameError(err error) (int, string) {
+	switch err {
+	case game.ErrGameNotFound:
+		return http.StatusNotFound, "GAME_NOT_FOUND"
+	case game.ErrPlayerNotInGame:
+		return http.StatusForbidden, "PLAYER_NOT_IN_GAME"
+	case game.ErrInvalidMove:
+		return http.StatusBadRequest, "INVALID_MOVE"
+	case game.ErrGameNotActive:
+		return http.StatusConflict, "GAME_NOT_ACTIVE"
+	case game.ErrNotPlayerTurn:
+		return http.StatusConflict, "NOT_YOUR_TURN"
+	case game.ErrGamePaused:
+		return http.StatusConflict, "GAME_PAUSED"
+	case game.ErrGameNotFinished:
+		return http.StatusConflict, "GAME_NOT_FINISHED"
+	default:
+		return http.StatusInternalServerError, apierror.CodeInternal
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// pieces counts the discs on a board
+func pieces(board [6][7]int) int {
+	count := 0
+	for _, row := range board {
+		for _, cell := range row {
+			if cell != 0 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// playGame plays the columns in turn until the game ends
+func playGame(m *game.Manager, gameID uuid.UUID, red, yellow *models.Player) {
+	players := []*models.Player{red, yellow}
+	for i := 0; ; i++ {
+		if _, err := m.PlayMove(gameID, players[i%2].ID, (i*3)%7); err != nil {
+			return
+		}
+	}
+}
+
+// Run with -race: the game is read for the response while moves change it
+func TestGetGameWhileMovesArePlayed(t *testing.T) {
+	m := game.NewManager()
+	h := &GameHandler{gameManager: m}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/games/{id}", h.GetGame)
+
+	for n := 0; n < 10; n++ {
+		red := &models.Player{ID: uuid.New(), Name: "red"}
+		yellow := &models.Player{ID: uuid.New(), Name: "yellow"}
+		g := m.CreateGame(red, yellow, models.QueueTypeCasual)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			playGame(m, g.ID, red, yellow)
+		}()
+
+		for i := 0; i < 20; i++ {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/games/"+g.ID.String(), nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("GET returned %d: %s", recorder.Code, recorder.Body)
+			}
+
+			var got models.Game
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			// A torn read would show a disc without its move or the other way round
+			if pieces(got.Board) != len(got.Moves) || got.Version < len(got.Moves) {
+				t.Fatalf("game has %d discs, %d moves and version %d", pieces(got.Board), len(got.Moves), got.Version)
+			}
+		}
+		wg.Wait()
+	}
+}
+
+func TestGetGameNotFound(t *testing.T) {
+	h := &GameHandler{gameManager: game.NewManager()}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/games/{id}", h.GetGame)
+
+	for path, want := range map[string]int{
+		"/api/games/" + uuid.New().String(): http.StatusNotFound,
+		"/api/games/not-a-uuid":             http.StatusBadRequest,
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != want {
+			t.Errorf("GET %s returned %d, want %d", path, recorder.Code, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// hub tracks every open WebSocket connection for server-wide messages and
+// closes them cleanly on shutdown
+type hub struct {
+	clients map[*Client]uuid.UUID // player ID of each connection, once it has one
+	opened  int64                 // connections added since the start
+	closing bool
+	mutex   sync.Mutex
+}
+
+func newHub() *hub {
+	return &hub{
+		clients: make(map[*Client]uuid.UUID),
+	}
+}
+
+// add registers a connection, refusing it once the hub is shutting down
+func (h *hub) add(conn *Client) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closing {
+		return false
+	}
+	h.clients[conn] = uuid.Nil
+	h.opened++
+	return true
+}
+
+// counts returns the connections open and those opened since the start
+func (h *hub) counts() (open int, opened int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.clients), h.opened
+}
+
+// setPlayer records which player a connection plays as
+func (h *hub) setPlayer(conn *Client, playerID uuid.UUID) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, exists := h.clients[conn]; exists {
+		h.clients[conn] = playerID
+	}
+}
+
+// playerClients returns every open connection of a player
+func (h *hub) playerClients(playerID uuid.UUID) []*Client {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var clients []*Client
+	for conn, connPlayerID := range h.clients {
+		if connPlayerID == playerID {
+			clients = append(clients, conn)
+		}
+	}
+	return clients
+}
+
+func (h *hub) remove(conn *Client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.clients, conn)
+}
+
+// isClosing reports whether the hub is shutting down
+func (h *hub) isClosing() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.closing
+}
+
+// snapshot returns the open connections
+func (h *hub) snapshot() []*Client {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	clients := make([]*Client, 0, len(h.clients))
+	for conn := range h.clients {
+		clients = append(clients, conn)
+	}
+	return clients
+}
+
+// broadcast sends a message to every open connection, returning how many it reached
+func (h *hub) broadcast(message interface{}) int {
+	sent := 0
+	for _, conn := range h.snapshot() {
+		if err := conn.WriteJSON(message); err != nil {
+			log.Printf("Failed to send to %s: %v", conn.conn.RemoteAddr(), err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// shutdown stops accepting connections, sends each one the notice built for
+// it and closes it with the given close code. It waits for the connections to
+// finish until ctx is done, then drops the rest.
+func (h *hub) shutdown(ctx context.Context, notice func(conn *Client) interface{}, code int, reason string) error {
+	h.mutex.Lock()
+	h.closing = true
+	h.mutex.Unlock()
+
+	clients := h.snapshot()
+	for _, conn := range clients {
+		conn.WriteJSON(notice(conn))
+		conn.CloseAfterPending(code, reason)
+	}
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		h.mutex.Lock()
+		remaining := len(h.clients)
+		h.mutex.Unlock()
+
+		if remaining == 0 {
+			log.Printf("Closed %d WebSocket connections", len(clients))
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Dropping %d WebSocket connections that didn't close in time", remaining)
+			for _, conn := range h.snapshot() {
+				conn.conn.Close()
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,26 +1,105 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
+	"connect-four-backend/internal/apierror"
 	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/season"
 )
 
 type LeaderboardHandler struct {
-	db *database.PostgresDB
+	db      database.Store
+	seasons *season.Service // nil when playing without seasons
+
+	// Rebuilds the leaderboard in the background once started
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-func NewLeaderboardHandler(db *database.PostgresDB) *LeaderboardHandler {
+func NewLeaderboardHandler(db database.Store) *LeaderboardHandler {
 	return &LeaderboardHandler{
 		db: db,
 	}
 }
 
+// SetSeasons sets the season service whose current season and rewards are served
+func (h *LeaderboardHandler) SetSeasons(seasons *season.Service) {
+	h.seasons = seasons
+}
+
+// StartRefresh rebuilds the leaderboard every interval, until Stop. The games
+// trigger keeps it current, the rebuild catches it up with what the trigger
+// doesn't see, like guest games merged into an account.
+func (h *LeaderboardHandler) StartRefresh(interval time.Duration) {
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := h.db.RefreshLeaderboard(); err != nil {
+					log.Printf("Failed to refresh leaderboard: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the refresh, waiting for a rebuild in progress
+func (h *LeaderboardHandler) Stop() {
+	if h.cancel == nil {
+		return
+	}
+	h.cancel()
+	h.wg.Wait()
+}
+
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 100
+)
+
+// GetLeaderboard returns a page of a leaderboard, all time or over a period,
+// by win rate or by rating, optionally searched by name. With around, it
+// returns the page around a player instead.
 func (h *LeaderboardHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
-	leaderboard, err := h.db.GetLeaderboard(50) // Top 50 players
+	query, err := parseLeaderboardQuery(r.URL.Query())
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	var leaderboard []database.LeaderboardEntry
+	around := r.URL.Query().Get("around")
+	if around != "" {
+		leaderboard, err = h.db.GetLeaderboardAround(query, around)
+	} else {
+		leaderboard, err = h.db.GetLeaderboard(query)
+	}
 	if err != nil {
-		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch leaderboard")
+		return
+	}
+	if around != "" && len(leaderboard) == 0 {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Player isn't on the leaderboard")
 		return
 	}
 
@@ -28,16 +107,61 @@ func (h *LeaderboardHandler) GetLeaderboard(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(leaderboard)
 }
 
+// parseLeaderboardQuery reads the leaderboard, search and page of GetLeaderboard
+func parseLeaderboardQuery(values url.Values) (database.LeaderboardQuery, error) {
+	query := database.LeaderboardQuery{
+		Period: values.Get("period"),
+		Sort:   values.Get("sort"),
+		Search: values.Get("search"),
+		Limit:  defaultLeaderboardLimit,
+	}
+	if query.Period == "all" {
+		query.Period = ""
+	}
+
+	var err error
+	if query.At, err = parseDateParam(values.Get("at"), false); err != nil {
+		return query, errors.New("Invalid at, expected an RFC 3339 time or a date like 2024-01-31")
+	}
+
+	switch query.Period {
+	case "", database.LeaderboardDay, database.LeaderboardWeek, database.LeaderboardMonth, database.LeaderboardSeason:
+	default:
+		return query, errors.New("Unknown period, expected day, week, month, season or all")
+	}
+	switch query.Sort {
+	case "", database.LeaderboardSortWinRate:
+	case database.LeaderboardSortRating:
+		if query.Period != "" {
+			return query, errors.New("The rating leaderboard is all time only")
+		}
+	default:
+		return query, errors.New("Unknown sort, expected win_rate or rating")
+	}
+
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 || query.Limit > maxLeaderboardLimit {
+			return query, fmt.Errorf("Invalid limit, expected 1 to %d", maxLeaderboardLimit)
+		}
+	}
+	if value := values.Get("offset"); value != "" {
+		if query.Offset, err = strconv.Atoi(value); err != nil || query.Offset < 0 {
+			return query, errors.New("Invalid offset")
+		}
+	}
+	return query, nil
+}
+
 func (h *LeaderboardHandler) GetPlayerStats(w http.ResponseWriter, r *http.Request) {
 	playerName := r.URL.Query().Get("name")
 	if playerName == "" {
-		http.Error(w, "Player name is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Player name is required")
 		return
 	}
 
 	stats, err := h.db.GetPlayerStats(playerName)
 	if err != nil {
-		http.Error(w, "Failed to fetch player stats", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch player stats")
 		return
 	}
 
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/config"
+	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/models"
+	"connect-four-backend/internal/openapi"
+
+	"github.com/gorilla/mux"
+)
+
+// apiOperation documents one route. Paths, path parameters and whether a
+// session is required come from the router itself.
+type apiOperation struct {
+	id          string
+	summary     string
+	tag         string
+	query       []openapi.Parameter
+	request     interface{} // JSON body, nil for none
+	response    interface{} // JSON body of the success response, nil for none
+	status      int         // success status, 200 when unset
+	contentType string      // success content type when it isn't JSON
+	errors      []int       // besides 401 and 403, which come from the middleware
+}
+
+func queryParam(name, description string, required bool, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Required: required, Schema: schema}
+}
+
+// apiOperations documents the REST routes by "METHOD /path"
+var apiOperations = map[string]apiOperation{
+	"GET /api/openapi.json": {id: "getOpenAPI", summary: "This document", tag: "meta", response: nil},
+	"GET /health":           {id: "getHealth", summary: "Health check", tag: "meta", contentType: "text/plain"},
+	"GET /metrics":          {id: "getMetrics", summary: "Metrics in the Prometheus text format", tag: "meta", contentType: "text/plain"},
+
+	"POST /api/accounts/register":    {id: "register", summary: "Create an account and start a session", tag: "accounts", request: registerRequest{}, response: sessionResponse{}, status: http.StatusCreated, errors: []int{400, 401, 409}},
+	"POST /api/accounts/login":       {id: "login", summary: "Start a session", tag: "accounts", request: credentialsRequest{}, response: sessionResponse{}, errors: []int{400, 401}},
+	"GET /api/accounts/me":           {id: "getProfile", summary: "The logged in account with its rating and stats", tag: "accounts", response: profileResponse{}, errors: []int{404}},
+	"POST /api/accounts/claim-guest": {id: "claimGuest", summary: "Move a guest's games and rating to the logged in account", tag: "accounts", request: claimGuestRequest{}, response: models.GuestClaim{}, errors: []int{400, 404, 409}},
+	"POST /api/accounts/me/erase":    {id: "erasePlayer", summary: "Rename the logged in player's games to an alias and delete their stats, and their account in delete mode", tag: "accounts", request: eraseRequest{}, response: models.PlayerErasure{}, errors: []int{400, 404, 500}},
+
+	"GET /api/leaderboard": {id: "getLeaderboard", summary: "A page of a leaderboard, or the page around a player", tag: "leaderboard", response: []database.LeaderboardEntry{}, errors: []int{400, 404, 500},
+		query: []openapi.Parameter{
+			queryParam("sort", "rating to rank by rating instead of win rate, all time only", false, &openapi.Schema{Type: "string", Enum: []string{"win_rate", "rating"}}),
+			queryParam("period", "rank by the games of one day, week, month or season (a quarter) in UTC, all time by default", false, &openapi.Schema{Type: "string", Enum: []string{"day", "week", "month", "season", "all"}}),
+			queryParam("at", "an RFC 3339 time or a date in the period, the current one by default", false, &openapi.Schema{Type: "string"}),
+			queryParam("search", "players whose names contain it, ignoring case, with their ranks on the whole leaderboard", false, &openapi.Schema{Type: "string"}),
+			queryParam("around", "a player to return the page around, starting half of it above them, instead of searching and offset; 404 when they aren't on the leaderboard", false, &openapi.Schema{Type: "string"}),
+			queryParam("limit", "players per page, 50 when omitted and at most 100", false, &openapi.Schema{Type: "integer"}),
+			queryParam("offset", "players to skip", false, &openapi.Schema{Type: "integer"}),
+		}},
+	"GET /api/players/{name}": {id: "getPlayerProfile", summary: "A player's profile: account, rating history, stats and streaks, opening columns and latest games", tag: "leaderboard", response: playerProfileResponse{}, errors: []int{400, 404, 500},
+		query: []openapi.Parameter{
+			queryParam("limit", "latest games per page, 10 when omitted and at most 100", false, &openapi.Schema{Type: "integer"}),
+			queryParam("offset", "latest games to skip", false, &openapi.Schema{Type: "integer"}),
+		}},
+	"GET /api/seasons": {id: "listSeasons", summary: "The current season, every season and the rewards earned in one", tag: "leaderboard", response: seasonsResponse{}, errors: []int{500}},
+	"GET /api/seasons/{number}/standings": {id: "getSeasonStandings", summary: "Where players finished a season, best first", tag: "leaderboard", response: []models.SeasonStanding{}, errors: []int{400, 500},
+		query: []openapi.Parameter{
+			queryParam("limit", "players per page, 50 when omitted and at most 100", false, &openapi.Schema{Type: "integer"}),
+			queryParam("offset", "players to skip", false, &openapi.Schema{Type: "integer"}),
+		}},
+	"GET /api/player/stats": {id: "getPlayerStats", summary: "A player's game statistics", tag: "leaderboard", response: database.PlayerStats{}, errors: []int{400, 500},
+		query: []openapi.Parameter{queryParam("name", "player name", true, &openapi.Schema{Type: "string"})}},
+
+	"GET /api/games": {id: "listGames", summary: "A page of finished games, filtered and sorted", tag: "games", response: database.GamePage{}, errors: []int{400, 500, 503},
+		query: []openapi.Parameter{
+			queryParam("player", "games the player played in", false, &openapi.Schema{Type: "string"}),
+			queryParam("from", "finished at or after, an RFC 3339 time or a date", false, &openapi.Schema{Type: "string"}),
+			queryParam("to", "finished before, an RFC 3339 time or a date that is included", false, &openapi.Schema{Type: "string"}),
+			queryParam("result", "the player's result, draw needs no player", false, &openapi.Schema{Type: "string", Enum: []string{"win", "loss", "draw"}}),
+			queryParam("win_type", "how the game was won", false, &openapi.Schema{Type: "string", Enum: []string{"horizontal", "vertical", "diagonal_positive", "diagonal_negative", "forfeit"}}),
+			queryParam("opponent", "games with a bot or between humans", false, &openapi.Schema{Type: "string", Enum: []string{"bot", "human"}}),
+			queryParam("sort", "finished_at when omitted", false, &openapi.Schema{Type: "string", Enum: []string{"finished_at", "duration", "moves"}}),
+			queryParam("order", "desc when omitted", false, &openapi.Schema{Type: "string", Enum: []string{"asc", "desc"}}),
+			queryParam("limit", "games per page, 20 when omitted and at most 100", false, &openapi.Schema{Type: "integer"}),
+			queryParam("offset", "games to skip", false, &openapi.Schema{Type: "integer"}),
+		}},
+	"GET /api/games/{id}":        {id: "getGame", summary: "The whole game", tag: "games", response: models.Game{}, errors: []int{400, 404}},
+	"POST /api/games/{id}/moves": {id: "makeMove", summary: "Play a move", tag: "games", request: makeMoveRequest{}, response: models.GameDeltaPayload{}, status: http.StatusCreated, errors: []int{400, 403, 404, 409}},
+	"GET /api/games/{id}/events": {id: "getGameEvents", summary: "Moves and game changes after a version, for polling clients", tag: "games", response: models.GameEvents{}, errors: []int{400, 404},
+		query: []openapi.Parameter{queryParam("since", "version already seen, 0 for everything", false, &openapi.Schema{Type: "integer"})}},
+	"GET /api/games/{id}/replay": {id: "getReplay", summary: "A finished game as a replay document", tag: "games", response: models.Replay{}, errors: []int{400, 404, 409},
+		query: []openapi.Parameter{queryParam("format", "text for the compact notation", false, &openapi.Schema{Type: "string", Enum: []string{"json", "text"}})}},
+	"GET /api/games/{id}/analysis": {id: "getGameAnalysis", summary: "Move quality report of a finished game", tag: "games", response: models.GameAnalysis{}, errors: []int{400, 404}},
+	"GET /api/games/{id}/stream":   {id: "streamGame", summary: "Server-Sent Events stream of the game's broadcasts", tag: "games", contentType: "text/event-stream", errors: []int{400, 404, 503}},
+
+	"GET /api/tournaments":                    {id: "listTournaments", summary: "Every tournament, newest first", tag: "tournaments", response: []*models.Tournament{}},
+	"POST /api/admin/tournaments":             {id: "createTournament", summary: "Open a tournament for registration", tag: "tournaments", request: createTournamentRequest{}, response: models.Tournament{}, status: http.StatusCreated, errors: []int{400}},
+	"GET /api/tournaments/scheduled":          {id: "listScheduledTournaments", summary: "Upcoming recurring tournaments", tag: "tournaments", response: []*models.ScheduledTournament{}},
+	"GET /api/tournaments/{id}":               {id: "getTournament", summary: "A tournament with its bracket", tag: "tournaments", response: models.Tournament{}, errors: []int{400, 404}},
+	"POST /api/admin/tournaments/{id}/start":  {id: "startTournament", summary: "Close registration and start the first round", tag: "tournaments", response: models.Tournament{}, errors: []int{400, 404, 409, 503}},
+	"POST /api/admin/tournaments/{id}/cancel": {id: "cancelTournament", summary: "Stop a tournament that hasn't finished", tag: "tournaments", status: http.StatusNoContent, errors: []int{400, 404, 409}},
+
+	"GET /api/admin/games":              {id: "adminListGames", summary: "Every game being played", tag: "admin", response: []adminGameSummary{}},
+	"GET /api/admin/games/{id}":         {id: "adminGetGame", summary: "A live game with its connections", tag: "admin", response: adminGameResponse{}, errors: []int{400, 404}},
+	"POST /api/admin/games/{id}/end":    {id: "adminEndGame", summary: "End a game, awarding it to a player or as a draw", tag: "admin", request: endGameRequest{}, response: models.Game{}, errors: []int{400, 404, 409}},
+	"POST /api/admin/players/{id}/kick": {id: "adminKickPlayer", summary: "Close every connection of a player", tag: "admin", request: kickRequest{}, status: http.StatusNoContent, errors: []int{400, 404}},
+	"POST /api/admin/announcements":     {id: "adminAnnounce", summary: "Send a message to every connected player", tag: "admin", request: announcementRequest{}, response: map[string]int{}, errors: []int{400}},
+	"GET /api/admin/drain":              {id: "adminGetDrain", summary: "Whether the server is draining and the games it waits on", tag: "admin", response: DrainStatus{}},
+	"POST /api/admin/drain":             {id: "adminDrain", summary: "Stop taking new games, play out those in progress and shut down", tag: "admin", response: DrainStatus{}, status: http.StatusAccepted},
+	"GET /api/admin/webhooks":           {id: "adminListWebhooks", summary: "Registered webhooks, without their secrets", tag: "admin", response: []*models.Webhook{}},
+	"POST /api/admin/webhooks":          {id: "adminCreateWebhook", summary: "Register a webhook, the only response showing its secret", tag: "admin", request: webhookRequest{}, response: models.Webhook{}, status: http.StatusCreated, errors: []int{400}},
+	"GET /api/admin/webhooks/dead-letters": {id: "adminListWebhookDeadLetters", summary: "Recent deliveries that failed every attempt", tag: "admin", response: []*models.WebhookDeadLetter{}, errors: []int{400, 500},
+		query: []openapi.Parameter{queryParam("limit", "at most 500, 50 by default", false, &openapi.Schema{Type: "integer"})}},
+	"DELETE /api/admin/webhooks/{id}": {id: "adminDeleteWebhook", summary: "Remove a webhook", tag: "admin", status: http.StatusNoContent, errors: []int{400, 404}},
+	"GET /api/admin/analytics":        {id: "adminGetAnalytics", summary: "Whether analytics events are emitted, their sample rates and dropped events", tag: "admin", response: analyticsSettings{}},
+	"PUT /api/admin/analytics":        {id: "adminUpdateAnalytics", summary: "Turn analytics on or off and change sample rates", tag: "admin", request: analyticsSettingsRequest{}, response: analyticsSettings{}, errors: []int{400}},
+	"GET /api/admin/config":           {id: "adminGetConfig", summary: "The settings that can be reloaded and the last reload", tag: "admin", response: config.ReloadStatus{}, errors: []int{404}},
+	"POST /api/admin/config/reload":   {id: "adminReloadConfig", summary: "Reload the config file and environment, as SIGHUP does", tag: "admin", response: configReloadResponse{}, errors: []int{400, 404}},
+}
+
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// OpenAPIHandler serves the OpenAPI document of the router's REST routes. The
+// document is built on the first request, once every route is registered.
+type OpenAPIHandler struct {
+	router *mux.Router
+
+	once     sync.Once
+	document []byte
+	err      error
+}
+
+func NewOpenAPIHandler(router *mux.Router) *OpenAPIHandler {
+	return &OpenAPIHandler{router: router}
+}
+
+func (h *OpenAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(func() {
+		var document *openapi.Document
+		if document, h.err = BuildOpenAPI(h.router); h.err == nil {
+			if missing := undocumentedRoutes(document); len(missing) > 0 {
+				log.Printf("OpenAPI document has no description for %s", strings.Join(missing, ", "))
+			}
+			h.document, h.err = json.Marshal(document)
+		}
+	})
+	if h.err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to build the API document")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.document)
+}
+
+// BuildOpenAPI describes every route of the router that has methods. Routes
+// registered on a subrouter sit behind the session middleware, those on the
+// admin subrouter also need an admin account.
+func BuildOpenAPI(router *mux.Router) (*openapi.Document, error) {
+	schemas := openapi.NewGenerator()
+	errorSchema := schemas.Schema(apierror.ErrorResponse{})
+
+	document := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Connect Four API",
+			Version:     "1",
+			Description: "Errors are returned as {\"error\": {\"code\", \"message\"}, \"status\"}, codes match the WebSocket error codes.",
+		},
+		Paths: make(map[string]openapi.PathItem),
+		Components: openapi.Components{
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"session": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Session token from login, registration or the WebSocket session message",
+				},
+			},
+		},
+	}
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // prefixes, the WebSocket and static files
+		}
+
+		for _, method := range methods {
+			doc := apiOperations[method+" "+path]
+			operation := &openapi.Operation{
+				OperationID: doc.id,
+				Summary:     doc.summary,
+				Parameters:  doc.query,
+				Responses:   make(map[string]*openapi.Response),
+			}
+			if doc.tag != "" {
+				operation.Tags = []string{doc.tag}
+			}
+
+			for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+				schema := &openapi.Schema{Type: "string", Format: "uuid"}
+				switch match[1] {
+				case "name":
+					schema = &openapi.Schema{Type: "string"}
+				case "number":
+					schema = &openapi.Schema{Type: "integer"}
+				}
+				operation.Parameters = append([]openapi.Parameter{{
+					Name:     match[1],
+					In:       "path",
+					Required: true,
+					Schema:   schema,
+				}}, operation.Parameters...)
+			}
+
+			if doc.request != nil {
+				operation.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSON(schemas.Schema(doc.request))}
+			}
+
+			status := doc.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			success := &openapi.Response{Description: http.StatusText(status)}
+			switch {
+			case status == http.StatusNoContent:
+			case doc.contentType != "":
+				success.Content = map[string]openapi.MediaType{doc.contentType: {Schema: &openapi.Schema{Type: "string"}}}
+			default:
+				success.Content = openapi.JSON(schemas.Schema(doc.response))
+			}
+			operation.Responses[strconv.Itoa(status)] = success
+
+			errors := append([]int(nil), doc.errors...)
+			if len(ancestors) > 0 {
+				operation.Security = []map[string][]string{{"session": {}}}
+				errors = append(errors, http.StatusUnauthorized)
+			}
+			if len(ancestors) > 1 {
+				errors = append(errors, http.StatusForbidden)
+			}
+			for _, code := range errors {
+				operation.Responses[strconv.Itoa(code)] = &openapi.Response{
+					Description: http.StatusText(code),
+					Content:     openapi.JSON(errorSchema),
+				}
+			}
+
+			if document.Paths[path] == nil {
+				document.Paths[path] = make(openapi.PathItem)
+			}
+			document.Paths[path][strings.ToLower(method)] = operation
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	document.Components.Schemas = schemas.Schemas()
+	return document, nil
+}
+
+// undocumentedRoutes lists routes missing from apiOperations, for start-up warnings
+func undocumentedRoutes(document *openapi.Document) []string {
+	var missing []string
+	for path, item := range document.Paths {
+		for method, operation := range item {
+			if operation.OperationID == "" {
+				missing = append(missing, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
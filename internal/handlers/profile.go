@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultProfileGamesLimit = 10
+	profileRatingHistory     = 100 // latest ratings on a profile
+)
+
+// playerProfileResponse is what anyone can see of a player
+type playerProfileResponse struct {
+	Name                  string                        `json:"name"`
+	Registered            bool                          `json:"registered"`
+	MemberSince           *time.Time                    `json:"member_since,omitempty"`
+	Rating                *models.PlayerRating          `json:"rating,omitempty"` // nil until the first rated game
+	RatingHistory         []database.RatingHistoryPoint `json:"rating_history"`
+	Stats                 *database.LeaderboardEntry    `json:"stats,omitempty"` // rank, results and streaks, nil until the first game
+	OpeningColumns        database.OpeningColumns       `json:"opening_columns"`
+	FavoriteOpeningColumn *int                          `json:"favorite_opening_column,omitempty"`
+	RecentGames           *database.GamePage            `json:"recent_games"`
+}
+
+// GetPlayerProfile returns a player's account, rating and its history, stats
+// and streaks, the columns they open in and a page of their latest games,
+// taken by limit and offset
+func (h *LeaderboardHandler) GetPlayerProfile(w http.ResponseWriter, r *http.Request) {
+	profile := playerProfileResponse{Name: mux.Vars(r)["name"]}
+	games := database.GameQuery{Descending: true, Limit: defaultProfileGamesLimit}
+
+	var err error
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if games.Limit, err = strconv.Atoi(value); err != nil || games.Limit < 1 || games.Limit > maxGamePageLimit {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("Invalid limit, expected 1 to %d", maxGamePageLimit))
+			return
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if games.Offset, err = strconv.Atoi(value); err != nil || games.Offset < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid offset")
+			return
+		}
+	}
+
+	if err := h.loadPlayerProfile(&profile, games); err != nil {
+		log.Printf("Failed to load profile of %s: %v", profile.Name, err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch player profile")
+		return
+	}
+	if !profile.Registered && profile.Rating == nil && profile.Stats == nil && profile.RecentGames.Total == 0 {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Player not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// loadPlayerProfile fills in the profile of the player it is named for, under
+// their account's name when they have one
+func (h *LeaderboardHandler) loadPlayerProfile(profile *playerProfileResponse, games database.GameQuery) error {
+	account, err := h.db.GetAccountByUsername(profile.Name)
+	if err != nil {
+		return err
+	}
+	if account != nil {
+		profile.Name = account.Username
+		profile.Registered = true
+		profile.MemberSince = &account.CreatedAt
+	}
+
+	if profile.Rating, err = h.db.GetPlayerRating(profile.Name); err != nil {
+		return err
+	}
+	if profile.RatingHistory, err = h.db.GetRatingHistory(profile.Name, profileRatingHistory); err != nil {
+		return err
+	}
+
+	// The player's row alone, a page of one starting at them
+	entries, err := h.db.GetLeaderboardAround(database.LeaderboardQuery{Limit: 1}, profile.Name)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		profile.Stats = &entries[0]
+	}
+
+	if profile.OpeningColumns, err = h.db.GetOpeningColumns(profile.Name); err != nil {
+		return err
+	}
+	if column, ok := profile.OpeningColumns.Favorite(); ok {
+		profile.FavoriteOpeningColumn = &column
+	}
+
+	games.Player = profile.Name
+	profile.RecentGames, err = h.db.FindFinishedGames(games)
+	return err
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"math"
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// RateLimit is a token bucket: PerSecond tokens are added up to Burst and
+// every message takes one
+type RateLimit struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
+
+// RateLimitConfig limits how fast a WebSocket client may send messages
+type RateLimitConfig struct {
+	Connection RateLimit                        `json:"connection"` // every message
+	Messages   map[models.MessageType]RateLimit `json:"messages"`   // stricter limits per message type
+
+	// Clients rejected more than MaxViolations times within ViolationWindow are disconnected
+	MaxViolations   int           `json:"max_violations"`
+	ViolationWindow time.Duration `json:"violation_window"`
+}
+
+// DefaultRateLimitConfig returns the limits used by the game server
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Connection: RateLimit{PerSecond: 10, Burst: 20},
+		Messages: map[models.MessageType]RateLimit{
+			models.MsgMakeMove:          {PerSecond: 2, Burst: 4},
+			models.MsgJoinQueue:         {PerSecond: 0.5, Burst: 3},
+			models.MsgCreatePrivateGame: {PerSecond: 0.5, Burst: 3},
+			models.MsgJoinPrivateGame:   {PerSecond: 0.5, Burst: 3},
+			models.MsgJoinTournament:    {PerSecond: 0.5, Burst: 3},
+		},
+		MaxViolations:   20,
+		ViolationWindow: time.Minute,
+	}
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   limit.PerSecond,
+		burst:  float64(limit.Burst),
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// take refills the bucket for the time passed and takes a token if one is left
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// connectionLimiter applies the rate limits to one connection. It is only
+// used by the connection's read loop and needs no locking.
+type connectionLimiter struct {
+	config     RateLimitConfig
+	connection *tokenBucket
+	messages   map[models.MessageType]*tokenBucket
+	violations *tokenBucket
+}
+
+func newConnectionLimiter(config RateLimitConfig) *connectionLimiter {
+	now := time.Now()
+	return &connectionLimiter{
+		config:     config,
+		connection: newTokenBucket(config.Connection, now),
+		messages:   make(map[models.MessageType]*tokenBucket),
+		violations: newTokenBucket(RateLimit{
+			PerSecond: float64(config.MaxViolations) / config.ViolationWindow.Seconds(),
+			Burst:     config.MaxViolations,
+		}, now),
+	}
+}
+
+// allow reports whether a message of the given type may be handled and, for
+// rejected messages, whether the client has been rejected too often to keep
+func (l *connectionLimiter) allow(msgType models.MessageType) (allowed bool, abusive bool) {
+	now := time.Now()
+
+	allowed = l.connection.take(now)
+	if allowed {
+		if limit, limited := l.config.Messages[msgType]; limited {
+			bucket, exists := l.messages[msgType]
+			if !exists {
+				bucket = newTokenBucket(limit, now)
+				l.messages[msgType] = bucket
+			}
+			allowed = bucket.take(now)
+		}
+	}
+
+	if allowed {
+		return true, false
+	}
+	return false, !l.violations.take(now)
+}
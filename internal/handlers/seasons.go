@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// seasonsResponse lists the seasons with the one being played and what can be
+// earned in it
+type seasonsResponse struct {
+	Current *models.Season        `json:"current,omitempty"` // nil when playing without seasons
+	Seasons []*models.Season      `json:"seasons"`           // latest first
+	Rewards []models.SeasonReward `json:"rewards"`           // best first
+}
+
+// ListSeasons returns the current season, every season and the rewards
+func (h *LeaderboardHandler) ListSeasons(w http.ResponseWriter, r *http.Request) {
+	seasons, err := h.db.ListSeasons()
+	if err != nil {
+		log.Printf("Failed to list seasons: %v", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch seasons")
+		return
+	}
+
+	response := seasonsResponse{Seasons: seasons, Rewards: []models.SeasonReward{}}
+	if h.seasons != nil {
+		response.Current = h.seasons.Current()
+		response.Rewards = h.seasons.Rewards()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSeasonStandings returns a page of where players finished a season, taken
+// by limit and offset
+func (h *LeaderboardHandler) GetSeasonStandings(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(mux.Vars(r)["number"])
+	if err != nil || number < 1 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid season number")
+		return
+	}
+
+	limit, offset := defaultLeaderboardLimit, 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxLeaderboardLimit {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, fmt.Sprintf("Invalid limit, expected 1 to %d", maxLeaderboardLimit))
+			return
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid offset")
+			return
+		}
+	}
+
+	standings, err := h.db.GetSeasonStandings(number, limit, offset)
+	if err != nil {
+		log.Printf("Failed to fetch season %d standings: %v", number, err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch season standings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(standings)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Broadcasts queued for a stream before the reader is considered too slow
+	streamSendBuffer = 64
+
+	// Comment lines sent while a game is quiet so proxies keep the stream open
+	streamKeepAlivePeriod = 15 * time.Second
+)
+
+// gameStream relays a game's broadcasts to a Server-Sent Events response. It
+// joins the game as a spectator, so it gets exactly what WebSocket spectators get.
+type gameStream struct {
+	events    chan streamEvent
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type streamEvent struct {
+	name string
+	data []byte
+}
+
+func newGameStream() *gameStream {
+	return &gameStream{
+		events: make(chan streamEvent, streamSendBuffer),
+		done:   make(chan struct{}),
+	}
+}
+
+// WriteJSON queues a broadcast, named after its message type. Like Client it
+// never blocks, a stream that falls behind is closed.
+func (s *gameStream) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	name := "message"
+	if message, ok := v.(models.WSMessage); ok {
+		name = string(message.Type)
+	}
+
+	select {
+	case <-s.done:
+		return errClientClosed
+	default:
+	}
+
+	select {
+	case s.events <- streamEvent{name: name, data: data}:
+		return nil
+	default:
+		s.Close()
+		return errSlowClient
+	}
+}
+
+func (s *gameStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// StreamGame relays a game's broadcasts as Server-Sent Events, for read-only
+// consumers such as stream overlays and dashboards. The first event is the
+// whole game, every event's data is the message WebSocket clients receive.
+func (h *GameHandler) StreamGame(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid game ID")
+		return
+	}
+
+	select {
+	case <-h.streamsClosed:
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Server is shutting down")
+		return
+	default:
+	}
+
+	gameInstance, exists := h.gameManager.GetGame(gameID)
+	if !exists {
+		apierror.Write(w, http.StatusNotFound, "GAME_NOT_FOUND", "Game not found")
+		return
+	}
+
+	stream := newGameStream()
+	if err := h.gameManager.AddSpectator(gameID, stream); err != nil {
+		status, code := gameError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+	defer h.gameManager.RemoveSpectator(gameID, stream)
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to lift write deadline for game stream %s: %v", gameID, err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Start consumers off with the whole game, deltas follow
+	if err := stream.WriteJSON(models.NewWSMessage(models.MsgGameState, models.GameStatePayload{
+		GameState: gameInstance,
+	})); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlivePeriod)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-stream.events:
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data); err != nil {
+				return
+			}
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+		case <-stream.done:
+			return
+		case <-h.streamsClosed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// CloseStreams ends every game stream and refuses new ones. The HTTP server
+// waits for open requests when shutting down, so it must be called first.
+func (h *GameHandler) CloseStreams() {
+	h.closeStreamsOnce.Do(func() {
+		close(h.streamsClosed)
+	})
+}
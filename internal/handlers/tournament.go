@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"connect-four-backend/internal/apierror"
+	"connect-four-backend/internal/models"
+	"connect-four-backend/internal/tournament"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// TournamentHandler lists tournaments for everyone. Creating, starting and
+// cancelling them are admin routes, behind AdminHandler.RequireAdmin.
+type TournamentHandler struct {
+	tournaments *tournament.Service
+	scheduler   *tournament.Scheduler
+}
+
+func NewTournamentHandler(tournaments *tournament.Service, scheduler *tournament.Scheduler) *TournamentHandler {
+	return &TournamentHandler{
+		tournaments: tournaments,
+		scheduler:   scheduler,
+	}
+}
+
+type createTournamentRequest struct {
+	Name       string                  `json:"name"`
+	Format     models.TournamentFormat `json:"format,omitempty"` // single_elimination (default), swiss or round_robin
+	MaxPlayers int                     `json:"max_players,omitempty"`
+}
+
+// ListTournaments returns every tournament, newest first
+func (h *TournamentHandler) ListTournaments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.tournaments.List())
+}
+
+// ListScheduledTournaments returns the next occurrence of every recurring tournament
+func (h *TournamentHandler) ListScheduledTournaments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.scheduler.Upcoming())
+}
+
+// CreateTournament opens registration for a new tournament
+func (h *TournamentHandler) CreateTournament(w http.ResponseWriter, r *http.Request) {
+	var request createTournamentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	t, err := h.tournaments.Create(request.Name, request.Format, request.MaxPlayers)
+	if err != nil {
+		status, code := tournamentError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+	log.Printf("Admin %s created tournament %s (%s)", adminName(r), t.ID, t.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// GetTournament returns the tournament with its bracket
+func (h *TournamentHandler) GetTournament(w http.ResponseWriter, r *http.Request) {
+	tournamentID, ok := parseTournamentID(w, r)
+	if !ok {
+		return
+	}
+
+	t, err := h.tournaments.Get(tournamentID)
+	if err != nil {
+		status, code := tournamentError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// StartTournament closes registration and starts the first round
+func (h *TournamentHandler) StartTournament(w http.ResponseWriter, r *http.Request) {
+	tournamentID, ok := parseTournamentID(w, r)
+	if !ok {
+		return
+	}
+
+	t, err := h.tournaments.Start(tournamentID)
+	if err != nil {
+		status, code := tournamentError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+	log.Printf("Admin %s started tournament %s", adminName(r), tournamentID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// CancelTournament stops a tournament that hasn't finished
+func (h *TournamentHandler) CancelTournament(w http.ResponseWriter, r *http.Request) {
+	tournamentID, ok := parseTournamentID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.tournaments.Cancel(tournamentID); err != nil {
+		status, code := tournamentError(err)
+		apierror.Write(w, status, code, err.Error())
+		return
+	}
+	log.Printf("Admin %s cancelled tournament %s", adminName(r), tournamentID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseTournamentID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	tournamentID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid tournament ID")
+		return uuid.Nil, false
+	}
+	return tournamentID, true
+}
+
+// tournamentError maps tournament errors to HTTP status and error codes
+func tournamentError(err error) (int, string) {
+	switch err {
+	case tournament.ErrTournamentNotFound:
+		return http.StatusNotFound, "TOURNAMENT_NOT_FOUND"
+	case tournament.ErrInvalidName:
+		return http.StatusBadRequest, "INVALID_NAME"
+	case tournament.ErrInvalidMaxPlayers:
+		return http.StatusBadRequest, "INVALID_MAX_PLAYERS"
+	case tournament.ErrInvalidFormat:
+		return http.StatusBadRequest, "INVALID_FORMAT"
+	case tournament.ErrNotEnoughPlayers:
+		return http.StatusConflict, "NOT_ENOUGH_PLAYERS"
+	case tournament.ErrAlreadyStarted:
+		return http.StatusConflict, "ALREADY_STARTED"
+	case tournament.ErrAlreadyFinished:
+		return http.StatusConflict, "ALREADY_FINISHED"
+	case tournament.ErrRegistrationClosed:
+		return http.StatusConflict, "REGISTRATION_CLOSED"
+	case tournament.ErrTournamentFull:
+		return http.StatusConflict, "TOURNAMENT_FULL"
+	case tournament.ErrDraining:
+		return http.StatusServiceUnavailable, "SERVER_DRAINING"
+	default:
+		return http.StatusInternalServerError, apierror.CodeInternal
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/kafka"
+	"connect-four-backend/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Longest trace ID taken from a client, longer ones are replaced
+const maxTraceIDLength = 128
+
+// requestTraceID returns the trace ID the client sent, as a trace_id query
+// parameter (browsers can't set WebSocket headers), an X-Correlation-ID
+// header or a W3C traceparent, or a new one
+func requestTraceID(r *http.Request) string {
+	candidates := []string{
+		r.URL.Query().Get("trace_id"),
+		r.Header.Get("X-Correlation-ID"),
+	}
+	// version-traceid-parentid-flags
+	if parts := strings.Split(r.Header.Get("traceparent"), "-"); len(parts) == 4 {
+		candidates = append(candidates, parts[1])
+	}
+
+	for _, candidate := range candidates {
+		if validTraceID(candidate) {
+			return candidate
+		}
+	}
+	return uuid.NewString()
+}
+
+func validTraceID(id string) bool {
+	if id == "" || len(id) > maxTraceIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r == '-' || r == '_' || r == '.' || r == ':' ||
+			('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// eventMetadata ties the analytics events a connection caused to its session and trace
+func eventMetadata(conn *Client) kafka.Metadata {
+	return kafka.Metadata{SessionID: conn.sessionID, TraceID: conn.traceID}
+}
+
+// EventMetadata is eventMetadata for connections handed to other services,
+// such as the matchmaker's queue events. It is empty for other connections.
+func EventMetadata(conn game.WSConnection) kafka.Metadata {
+	if client, ok := conn.(*Client); ok && client != nil {
+		return eventMetadata(client)
+	}
+	return kafka.Metadata{}
+}
+
+// withTraceParent ties the event to the span ctx carries, so the consumer's
+// span for it joins the same trace
+func withTraceParent(ctx context.Context, metadata kafka.Metadata) kafka.Metadata {
+	metadata.TraceParent = tracing.TraceParent(ctx)
+	return metadata
+}
+
+// TraceRequests records a span for every REST request, named by its route
+// and continuing the caller's trace when it sends a traceparent. WebSocket
+// upgrades are left out, each of their messages is traced instead.
+func TraceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := tracing.ContextWithRemoteParent(r.Context(), r.Header.Get("traceparent"))
+		ctx, span := tracing.Start(ctx, r.Method+" "+route, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("http.route", route),
+			tracing.String("connect_four.trace_id", requestTraceID(r)))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(tracing.Int("http.response.status_code", recorder.status))
+	})
+}
+
+// statusRecorder remembers the status a handler answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps Server-Sent Events streaming through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
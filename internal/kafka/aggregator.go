@@ -4,21 +4,60 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/models"
 )
 
+// AggregateStore keeps the aggregated metrics across restarts
+type AggregateStore interface {
+	SaveAnalyticsAggregates(aggregates *database.AnalyticsAggregates) error
+	LoadAnalyticsAggregates(fromHour, fromDay string) (*database.AnalyticsAggregates, error)
+	SaveRetentionCohorts(cohorts []database.RetentionCohort) error
+	LoadPlayerStats(name string) (*database.AggregatedPlayerStats, error)
+}
+
 // MetricsAggregator handles real-time aggregation of game metrics
 type MetricsAggregator struct {
-	repo                *database.Repository
+	repo                database.Store
+	store               AggregateStore // nil to keep metrics in memory only
 	gameMetrics         *GameMetrics
-	playerMetrics       *PlayerMetrics
+	players             *playerShards
+	playerTotals        playerTotals
 	hourlyMetrics       *HourlyMetrics
 	dailyMetrics        *DailyMetrics
-	mu                  sync.RWMutex
+	queueMetrics        *QueueMetrics
+	columnMetrics       *columnAggregator
+	concurrency         *concurrencyTracker
+	gameDurations       *Histogram // seconds
+	moveTimes           *Histogram // seconds, human moves only
 	lastFlush           time.Time
 	flushInterval       time.Duration
+
+	// Events read-lock mu and update each metric under its own lock, so
+	// workers don't wait on each other. Flushing and restoring write-lock it.
+	mu sync.RWMutex
+
+	// Day the retention cohorts were last saved on
+	retentionSavedDay string
+
+	// Milestones announced when reached, guarded by mu
+	milestoneConfig    MilestoneConfig
+	milestonePublisher MilestonePublisher // nil to only log them
+
+	// Retention windows and player cap, guarded by mu. Players evicted over
+	// the cap are loaded again when seen, both counted with sync/atomic.
+	memory          MemoryConfig
+	evictedPlayers  int64
+	reloadedPlayers int64
+
+	// Shared counters this instance adds its counts to, and the counts added
+	// so far. Guarded by countersMu rather than mu, so pushes don't hold up events.
+	countersMu     sync.Mutex
+	counters       CounterStore // nil to keep counts per instance
+	countersPushed map[string]map[string]int64
 }
 
 // GameMetrics tracks game-related aggregated metrics
@@ -43,7 +82,6 @@ type PlayerMetrics struct {
 	TotalMoves          int64                   `json:"total_moves"`
 	TotalDisconnections int64                   `json:"total_disconnections"`
 	TotalReconnections  int64                   `json:"total_reconnections"`
-	mu                  sync.RWMutex
 }
 
 // PlayerStats tracks individual player statistics
@@ -63,6 +101,8 @@ type PlayerStats struct {
 	FirstSeen           time.Time     `json:"first_seen"`
 	LastSeen            time.Time     `json:"last_seen"`
 	IsActive            bool          `json:"is_active"`
+	CurrentStreak       int64         `json:"current_streak"` // games won in a row
+	LongestStreak       int64         `json:"longest_streak"`
 }
 
 // HourlyMetrics tracks hourly game statistics
@@ -86,17 +126,59 @@ type DailyMetrics struct {
 	mu                  sync.RWMutex
 }
 
-// NewMetricsAggregator creates a new metrics aggregator
-func NewMetricsAggregator(repo *database.Repository) (*MetricsAggregator, error) {
-	return &MetricsAggregator{
+// QueueMetrics tracks matchmaking queue depth and wait times by queue type
+type QueueMetrics struct {
+	Queues map[string]*QueueStats `json:"queues"` // key: queue type
+	mu     sync.RWMutex
+}
+
+// QueueSnapshot is a copy of the queue metrics, taken under their lock
+type QueueSnapshot struct {
+	Queues map[string]*QueueStats `json:"queues"` // key: queue type
+}
+
+// QueueStats tracks a single queue type. Wait times are in milliseconds, of
+// the players matched for AverageWaitTime and of those who gave up waiting
+// for AverageAbandonedWait.
+type QueueStats struct {
+	QueueType            string             `json:"queue_type"`
+	Depth                int                `json:"depth"` // as of the latest event
+	PeakDepth            int                `json:"peak_depth"`
+	Joins                int64              `json:"joins"`
+	Leaves               int64              `json:"leaves"`
+	Matches              int64              `json:"matches"`
+	BotMatches           int64              `json:"bot_matches"`
+	TotalWaitTime        int64              `json:"total_wait_time_ms"`
+	AverageWaitTime      float64            `json:"average_wait_time_ms"`
+	MaxWaitTime          int64              `json:"max_wait_time_ms"`
+	TotalAbandonedWait   int64              `json:"total_abandoned_wait_ms"`
+	AverageAbandonedWait float64            `json:"average_abandoned_wait_ms"`
+	PeakDepthPerHour     map[string]int     `json:"peak_depth_per_hour"` // key: "2024-01-01-15"
+	MatchesPerHour       map[string]int64   `json:"matches_per_hour"`
+	AverageWaitHour      map[string]float64 `json:"average_wait_hour_ms"`
+	LastUpdated          time.Time          `json:"last_updated"`
+}
+
+// NewMetricsAggregator creates a new metrics aggregator. With a repository
+// it carries on from the metrics saved there and saves them on every flush.
+func NewMetricsAggregator(repo database.Store) (*MetricsAggregator, error) {
+	var store AggregateStore
+	if repo != nil {
+		store = repo
+	}
+	return newMetricsAggregator(repo, store, DefaultMemoryConfig())
+}
+
+// newMetricsAggregator creates an aggregator saving to the store, loading
+// only the hours, days and players the memory config keeps
+func newMetricsAggregator(repo database.Store, store AggregateStore, memory MemoryConfig) (*MetricsAggregator, error) {
+	ma := &MetricsAggregator{
 		repo: repo,
 		gameMetrics: &GameMetrics{
 			WinnerFrequency:     make(map[string]int64),
 			WinTypeDistribution: make(map[string]int64),
 		},
-		playerMetrics: &PlayerMetrics{
-			ActivePlayers: make(map[string]*PlayerStats),
-		},
+		players: newPlayerShards(),
 		hourlyMetrics: &HourlyMetrics{
 			GamesPerHour:        make(map[string]int64),
 			MovesPerHour:        make(map[string]int64),
@@ -110,16 +192,48 @@ func NewMetricsAggregator(repo *database.Repository) (*MetricsAggregator, error)
 			AverageDurationDay: make(map[string]float64),
 			NewPlayersPerDay:   make(map[string]int64),
 		},
-		lastFlush:     time.Now(),
-		flushInterval: 5 * time.Minute,
-	}, nil
+		queueMetrics: &QueueMetrics{
+			Queues: make(map[string]*QueueStats),
+		},
+		columnMetrics:   newColumnAggregator(),
+		concurrency:     newConcurrencyTracker(),
+		milestoneConfig: DefaultMilestoneConfig(),
+		memory:          memory,
+		lastFlush:       time.Now(),
+		flushInterval:   5 * time.Minute,
+	}
+	ma.SetHistogramBuckets(DefaultHistogramConfig())
+
+	if store != nil {
+		ma.store = store
+		if err := ma.load(); err != nil {
+			return nil, fmt.Errorf("failed to load saved metrics: %w", err)
+		}
+	}
+	return ma, nil
 }
 
-// RecordGameStart processes a game started event
-func (ma *MetricsAggregator) RecordGameStart(event GameStartedEvent) error {
+// SetHistogramBuckets replaces the duration and move time histograms with
+// empty ones of the given buckets
+func (ma *MetricsAggregator) SetHistogramBuckets(config HistogramConfig) {
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
 
+	ma.gameDurations = NewHistogram(config.GameDurationBuckets)
+	ma.moveTimes = NewHistogram(config.MoveTimeBuckets)
+}
+
+// RecordGameStart processes a game started event
+func (ma *MetricsAggregator) RecordGameStart(event GameStartedEvent) error {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	if err := ma.reloadEvicted(getPlayerNames(event.Players)...); err != nil {
+		return err
+	}
+
+	ma.concurrency.gameStarted(event.GameID, event.Players, event.Timestamp)
+
 	// Update game metrics
 	ma.gameMetrics.mu.Lock()
 	ma.gameMetrics.TotalGames++
@@ -138,6 +252,7 @@ func (ma *MetricsAggregator) RecordGameStart(event GameStartedEvent) error {
 	} else {
 		ma.gameMetrics.HumanGames++
 	}
+	totalGames := ma.gameMetrics.TotalGames
 	ma.gameMetrics.mu.Unlock()
 
 	// Update hourly metrics
@@ -155,47 +270,57 @@ func (ma *MetricsAggregator) RecordGameStart(event GameStartedEvent) error {
 	ma.dailyMetrics.mu.Unlock()
 
 	// Update player metrics
-	ma.playerMetrics.mu.Lock()
 	uniquePlayers := make(map[string]bool)
+	var newPlayers int64
 	for _, player := range event.Players {
 		uniquePlayers[player.Name] = true
-		
-		if _, exists := ma.playerMetrics.ActivePlayers[player.Name]; !exists {
-			ma.playerMetrics.ActivePlayers[player.Name] = &PlayerStats{
+
+		created := ma.players.update(player.Name, func() *PlayerStats {
+			return &PlayerStats{
 				Name:      player.Name,
 				FirstSeen: event.Timestamp,
 				LastSeen:  event.Timestamp,
 				IsActive:  true,
 			}
-			ma.playerMetrics.TotalPlayers++
-			
+		}, func(stats *PlayerStats) {
+			stats.GamesPlayed++
+			stats.LastSeen = event.Timestamp
+			stats.IsActive = true
+		})
+		if created {
+			atomic.AddInt64(&ma.playerTotals.players, 1)
+
 			// Check if new player today
 			if event.Timestamp.Format("2006-01-02") == time.Now().Format("2006-01-02") {
-				ma.playerMetrics.NewPlayersToday++
-				ma.dailyMetrics.NewPlayersPerDay[dayKey]++
+				atomic.AddInt64(&ma.playerTotals.newToday, 1)
+				newPlayers++
 			}
 		}
-		
-		ma.playerMetrics.ActivePlayers[player.Name].GamesPlayed++
-		ma.playerMetrics.ActivePlayers[player.Name].LastSeen = event.Timestamp
-		ma.playerMetrics.ActivePlayers[player.Name].IsActive = true
 	}
-	
+
 	// Update unique players per hour/day
+	ma.hourlyMetrics.mu.Lock()
 	ma.hourlyMetrics.PlayersPerHour[hourKey] = int64(len(uniquePlayers))
+	ma.hourlyMetrics.mu.Unlock()
+	ma.dailyMetrics.mu.Lock()
 	ma.dailyMetrics.PlayersPerDay[dayKey] = int64(len(uniquePlayers))
-	ma.playerMetrics.mu.Unlock()
+	ma.dailyMetrics.NewPlayersPerDay[dayKey] += newPlayers
+	ma.dailyMetrics.mu.Unlock()
 
-	log.Printf("Aggregated game start: Total games: %d, Active players: %d", 
-		ma.gameMetrics.TotalGames, len(ma.playerMetrics.ActivePlayers))
+	log.Printf("Aggregated game start: Total games: %d, Active players: %d",
+		totalGames, atomic.LoadInt64(&ma.playerTotals.players))
 
 	return nil
 }
 
 // RecordMove processes a move played event
 func (ma *MetricsAggregator) RecordMove(event MovePlayedEvent) error {
-	ma.mu.Lock()
-	defer ma.mu.Unlock()
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	if err := ma.reloadEvicted(event.Player.Name); err != nil {
+		return err
+	}
 
 	// Update hourly metrics
 	hourKey := event.Timestamp.Format("2006-01-02-15")
@@ -210,22 +335,30 @@ func (ma *MetricsAggregator) RecordMove(event MovePlayedEvent) error {
 	ma.dailyMetrics.mu.Unlock()
 
 	// Update player metrics
-	ma.playerMetrics.mu.Lock()
-	ma.playerMetrics.TotalMoves++
-	
-	if player, exists := ma.playerMetrics.ActivePlayers[event.Player.Name]; exists {
+	ma.columnMetrics.recordMove(event)
+
+	// Bots answer instantly, so only human moves count as think time
+	if !event.Player.IsBot && event.TimeTaken > 0 {
+		ma.moveTimes.Observe(float64(event.TimeTaken) / 1000)
+	}
+
+	atomic.AddInt64(&ma.playerTotals.moves, 1)
+	ma.players.update(event.Player.Name, nil, func(player *PlayerStats) {
 		player.TotalMoves++
 		player.LastSeen = event.Timestamp
-	}
-	ma.playerMetrics.mu.Unlock()
+	})
 
 	return nil
 }
 
 // RecordGameEnd processes a game ended event
 func (ma *MetricsAggregator) RecordGameEnd(event GameEndedEvent) error {
-	ma.mu.Lock()
-	defer ma.mu.Unlock()
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	if err := ma.reloadEvicted(getPlayerNames(event.Players)...); err != nil {
+		return err
+	}
 
 	// Update game metrics
 	ma.gameMetrics.mu.Lock()
@@ -245,8 +378,13 @@ func (ma *MetricsAggregator) RecordGameEnd(event GameEndedEvent) error {
 	if event.WinType != "" {
 		ma.gameMetrics.WinTypeDistribution[event.WinType]++
 	}
+	completedGames, averageDuration := ma.gameMetrics.CompletedGames, ma.gameMetrics.AverageGameDuration
 	ma.gameMetrics.mu.Unlock()
 
+	ma.gameDurations.Observe(float64(event.Duration))
+	ma.columnMetrics.recordGameEnd(event)
+	ma.concurrency.gameEnded(event.GameID, event.Timestamp)
+
 	// Update hourly metrics
 	hourKey := event.Timestamp.Format("2006-01-02-15")
 	ma.hourlyMetrics.mu.Lock()
@@ -266,12 +404,12 @@ func (ma *MetricsAggregator) RecordGameEnd(event GameEndedEvent) error {
 	ma.dailyMetrics.mu.Unlock()
 
 	// Update player metrics
-	ma.playerMetrics.mu.Lock()
+	var milestones []PlayerMilestone
 	for _, player := range event.Players {
-		if playerStats, exists := ma.playerMetrics.ActivePlayers[player.Name]; exists {
+		ma.players.update(player.Name, nil, func(playerStats *PlayerStats) {
 			playerStats.TotalGameTime += event.Duration
 			playerStats.LastSeen = event.Timestamp
-			
+
 			if playerStats.GamesPlayed > 0 {
 				playerStats.AverageGameTime = float64(playerStats.TotalGameTime) / float64(playerStats.GamesPlayed)
 			}
@@ -289,53 +427,178 @@ func (ma *MetricsAggregator) RecordGameEnd(event GameEndedEvent) error {
 			if totalGames > 0 {
 				playerStats.WinRate = float64(playerStats.GamesWon) / float64(totalGames) * 100
 			}
-		}
+
+			won := !event.IsDraw && event.Winner != nil && event.Winner.Name == player.Name
+			reached := ma.recordStreak(playerStats, won, event)
+			if !player.IsBot {
+				milestones = append(milestones, reached...)
+			}
+		})
 	}
-	ma.playerMetrics.mu.Unlock()
+	ma.publishMilestones(milestones)
 
-	log.Printf("Aggregated game end: Completed games: %d, Average duration: %.1fs", 
-		ma.gameMetrics.CompletedGames, ma.gameMetrics.AverageGameDuration)
+	log.Printf("Aggregated game end: Completed games: %d, Average duration: %.1fs",
+		completedGames, averageDuration)
 
 	return nil
 }
 
 // RecordDisconnection processes a player disconnected event
 func (ma *MetricsAggregator) RecordDisconnection(event PlayerDisconnectedEvent) error {
-	ma.mu.Lock()
-	defer ma.mu.Unlock()
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
 
-	ma.playerMetrics.mu.Lock()
-	ma.playerMetrics.TotalDisconnections++
-	
-	if player, exists := ma.playerMetrics.ActivePlayers[event.Player.Name]; exists {
+	if err := ma.reloadEvicted(event.Player.Name); err != nil {
+		return err
+	}
+
+	ma.concurrency.setOffline(event.Player.Name, true, event.Timestamp)
+
+	atomic.AddInt64(&ma.playerTotals.disconnections, 1)
+	ma.players.update(event.Player.Name, nil, func(player *PlayerStats) {
 		player.Disconnections++
 		player.LastSeen = event.Timestamp
 		player.IsActive = false
-	}
-	ma.playerMetrics.mu.Unlock()
+	})
 
 	return nil
 }
 
 // RecordReconnection processes a player reconnected event
 func (ma *MetricsAggregator) RecordReconnection(event PlayerReconnectedEvent) error {
-	ma.mu.Lock()
-	defer ma.mu.Unlock()
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
 
-	ma.playerMetrics.mu.Lock()
-	ma.playerMetrics.TotalReconnections++
-	
-	if player, exists := ma.playerMetrics.ActivePlayers[event.Player.Name]; exists {
+	if err := ma.reloadEvicted(event.Player.Name); err != nil {
+		return err
+	}
+
+	ma.concurrency.setOffline(event.Player.Name, false, event.Timestamp)
+
+	atomic.AddInt64(&ma.playerTotals.reconnections, 1)
+	ma.players.update(event.Player.Name, nil, func(player *PlayerStats) {
 		player.Reconnections++
 		player.TotalOfflineTime += event.OfflineDuration
 		player.LastSeen = event.Timestamp
 		player.IsActive = true
+	})
+
+	return nil
+}
+
+// RecordQueueJoined processes a player joined queue event
+func (ma *MetricsAggregator) RecordQueueJoined(event QueueJoinedEvent) error {
+	ma.concurrency.setQueued([]PlayerInfo{event.Player}, true, event.Timestamp)
+
+	ma.queueMetrics.mu.Lock()
+	defer ma.queueMetrics.mu.Unlock()
+
+	queue := ma.queueStats(event.QueueType)
+	queue.Joins++
+	ma.updateQueueDepth(queue, event.QueueSize, event.Timestamp)
+
+	return nil
+}
+
+// RecordQueueLeft processes a player left queue event
+func (ma *MetricsAggregator) RecordQueueLeft(event QueueLeftEvent) error {
+	ma.concurrency.setQueued([]PlayerInfo{event.Player}, false, event.Timestamp)
+
+	ma.queueMetrics.mu.Lock()
+	defer ma.queueMetrics.mu.Unlock()
+
+	queue := ma.queueStats(event.QueueType)
+	queue.Leaves++
+	queue.TotalAbandonedWait += event.WaitTime
+	queue.AverageAbandonedWait = float64(queue.TotalAbandonedWait) / float64(queue.Leaves)
+	ma.updateQueueDepth(queue, event.QueueSize, event.Timestamp)
+
+	return nil
+}
+
+// RecordMatchFound processes a match found event, private matches never queued
+func (ma *MetricsAggregator) RecordMatchFound(event MatchFoundEvent) error {
+	ma.concurrency.setQueued(event.Players, false, event.Timestamp)
+
+	if event.QueueType == string(models.QueueTypePrivate) {
+		return nil
+	}
+
+	ma.queueMetrics.mu.Lock()
+	defer ma.queueMetrics.mu.Unlock()
+
+	queue := ma.queueStats(event.QueueType)
+	queue.Matches++
+	queue.TotalWaitTime += event.WaitTime
+	queue.AverageWaitTime = float64(queue.TotalWaitTime) / float64(queue.Matches)
+	if event.WaitTime > queue.MaxWaitTime {
+		queue.MaxWaitTime = event.WaitTime
 	}
-	ma.playerMetrics.mu.Unlock()
+
+	hourKey := event.Timestamp.Format("2006-01-02-15")
+	matches := queue.MatchesPerHour[hourKey]
+	queue.AverageWaitHour[hourKey] = (queue.AverageWaitHour[hourKey]*float64(matches) + float64(event.WaitTime)) / float64(matches+1)
+	queue.MatchesPerHour[hourKey] = matches + 1
+
+	ma.updateQueueDepth(queue, event.QueueSize, event.Timestamp)
 
 	return nil
 }
 
+// RecordBotActivated processes a bot activated event, its wait was counted with the match
+func (ma *MetricsAggregator) RecordBotActivated(event BotActivatedEvent) error {
+	ma.queueMetrics.mu.Lock()
+	defer ma.queueMetrics.mu.Unlock()
+
+	ma.queueStats(event.QueueType).BotMatches++
+
+	return nil
+}
+
+// ForgetPlayer drops an erased player's stats and wins, the games they played
+// stay counted in the totals
+func (ma *MetricsAggregator) ForgetPlayer(name string) {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	ma.players.remove(name)
+
+	ma.gameMetrics.mu.Lock()
+	delete(ma.gameMetrics.WinnerFrequency, name)
+	ma.gameMetrics.mu.Unlock()
+}
+
+// queueStats returns the stats of the queue type, queueMetrics.mu must be held
+func (ma *MetricsAggregator) queueStats(queueType string) *QueueStats {
+	queue, exists := ma.queueMetrics.Queues[queueType]
+	if !exists {
+		queue = &QueueStats{
+			QueueType:        queueType,
+			PeakDepthPerHour: make(map[string]int),
+			MatchesPerHour:   make(map[string]int64),
+			AverageWaitHour:  make(map[string]float64),
+		}
+		ma.queueMetrics.Queues[queueType] = queue
+	}
+	return queue
+}
+
+// updateQueueDepth records the depth an event reported. Events of different
+// players arrive out of order, only a newer one replaces the current depth.
+func (ma *MetricsAggregator) updateQueueDepth(queue *QueueStats, depth int, timestamp time.Time) {
+	if depth > queue.PeakDepth {
+		queue.PeakDepth = depth
+	}
+	hourKey := timestamp.Format("2006-01-02-15")
+	if depth > queue.PeakDepthPerHour[hourKey] {
+		queue.PeakDepthPerHour[hourKey] = depth
+	}
+	if !timestamp.Before(queue.LastUpdated) {
+		queue.Depth = depth
+		queue.LastUpdated = timestamp
+	}
+}
+
 // AggregateMetrics performs periodic aggregation and persistence
 func (ma *MetricsAggregator) AggregateMetrics() error {
 	ma.mu.Lock()
@@ -343,19 +606,26 @@ func (ma *MetricsAggregator) AggregateMetrics() error {
 
 	log.Println("Starting metrics aggregation...")
 
-	// Clean up old data (keep last 7 days for hourly, 30 days for daily)
+	// Clean up data older than the retention windows
 	ma.cleanupOldMetrics()
 
 	// Persist current metrics to database (if needed)
 	if err := ma.persistMetrics(); err != nil {
 		return fmt.Errorf("failed to persist metrics: %w", err)
 	}
+	ma.evictPlayers()
+	if err := ma.persistRetention(); err != nil {
+		return fmt.Errorf("failed to persist retention: %w", err)
+	}
+	if err := ma.PushCounters(); err != nil {
+		return err
+	}
 
 	// Update last flush time
 	ma.lastFlush = time.Now()
 
 	log.Printf("Metrics aggregation completed. Games: %d, Players: %d, Avg Duration: %.1fs",
-		ma.gameMetrics.TotalGames, ma.playerMetrics.TotalPlayers, ma.gameMetrics.AverageGameDuration)
+		ma.gameMetrics.TotalGames, atomic.LoadInt64(&ma.playerTotals.players), ma.gameMetrics.AverageGameDuration)
 
 	return nil
 }
@@ -383,19 +653,14 @@ func (ma *MetricsAggregator) GetGameMetrics() GameMetrics {
 
 // GetPlayerMetrics returns current player metrics
 func (ma *MetricsAggregator) GetPlayerMetrics() PlayerMetrics {
-	ma.playerMetrics.mu.RLock()
-	defer ma.playerMetrics.mu.RUnlock()
-	
-	// Create a copy to avoid race conditions
-	metrics := *ma.playerMetrics
-	metrics.ActivePlayers = make(map[string]*PlayerStats)
-	
-	for k, v := range ma.playerMetrics.ActivePlayers {
-		playerCopy := *v
-		metrics.ActivePlayers[k] = &playerCopy
+	return PlayerMetrics{
+		ActivePlayers:       ma.players.copy(),
+		TotalPlayers:        atomic.LoadInt64(&ma.playerTotals.players),
+		NewPlayersToday:     atomic.LoadInt64(&ma.playerTotals.newToday),
+		TotalMoves:          atomic.LoadInt64(&ma.playerTotals.moves),
+		TotalDisconnections: atomic.LoadInt64(&ma.playerTotals.disconnections),
+		TotalReconnections:  atomic.LoadInt64(&ma.playerTotals.reconnections),
 	}
-	
-	return metrics
 }
 
 // GetHourlyMetrics returns current hourly metrics
@@ -458,6 +723,66 @@ func (ma *MetricsAggregator) GetDailyMetrics() DailyMetrics {
 	return metrics
 }
 
+// GetColumnMetrics returns the column and board heatmaps
+func (ma *MetricsAggregator) GetColumnMetrics() ColumnMetrics {
+	return ma.columnMetrics.copy()
+}
+
+// GetOpeningMetrics returns the win rates by opening column and starting color
+func (ma *MetricsAggregator) GetOpeningMetrics() OpeningMetrics {
+	return ma.columnMetrics.openingCopy()
+}
+
+// GetConcurrencyMetrics returns the games and players online, their peaks and the per minute series
+func (ma *MetricsAggregator) GetConcurrencyMetrics() ConcurrencyMetrics {
+	return ma.concurrency.metrics(time.Now())
+}
+
+// Distributions are the game duration and move think time histograms
+type Distributions struct {
+	GameDuration HistogramSnapshot `json:"game_duration_seconds"`
+	MoveTime     HistogramSnapshot `json:"move_time_seconds"`
+}
+
+// GetDistributions returns the game duration and move time histograms with their percentiles
+func (ma *MetricsAggregator) GetDistributions() Distributions {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return Distributions{
+		GameDuration: ma.gameDurations.Snapshot(),
+		MoveTime:     ma.moveTimes.Snapshot(),
+	}
+}
+
+// GetQueueMetrics returns a snapshot of the current queue metrics
+func (ma *MetricsAggregator) GetQueueMetrics() QueueSnapshot {
+	ma.queueMetrics.mu.RLock()
+	defer ma.queueMetrics.mu.RUnlock()
+
+	// Create a copy to avoid race conditions
+	metrics := QueueSnapshot{Queues: make(map[string]*QueueStats)}
+	for queueType, queue := range ma.queueMetrics.Queues {
+		queueCopy := *queue
+		queueCopy.PeakDepthPerHour = make(map[string]int)
+		queueCopy.MatchesPerHour = make(map[string]int64)
+		queueCopy.AverageWaitHour = make(map[string]float64)
+
+		for k, v := range queue.PeakDepthPerHour {
+			queueCopy.PeakDepthPerHour[k] = v
+		}
+		for k, v := range queue.MatchesPerHour {
+			queueCopy.MatchesPerHour[k] = v
+		}
+		for k, v := range queue.AverageWaitHour {
+			queueCopy.AverageWaitHour[k] = v
+		}
+		metrics.Queues[queueType] = &queueCopy
+	}
+
+	return metrics
+}
+
 // GetTopWinners returns the most frequent winners
 func (ma *MetricsAggregator) GetTopWinners(limit int) []struct {
 	Name string
@@ -471,23 +796,16 @@ func (ma *MetricsAggregator) GetTopWinners(limit int) []struct {
 		Wins int64
 	}
 
-	winners := make([]winner, 0, len(ma.gameMetrics.WinnerFrequency))
-	for name, wins := range ma.gameMetrics.WinnerFrequency {
-		winners = append(winners, winner{Name: name, Wins: wins})
-	}
-
-	// Simple bubble sort by wins (descending)
-	for i := 0; i < len(winners)-1; i++ {
-		for j := 0; j < len(winners)-i-1; j++ {
-			if winners[j].Wins < winners[j+1].Wins {
-				winners[j], winners[j+1] = winners[j+1], winners[j]
-			}
+	top := newTopK(limit, func(a, b winner) bool {
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
 		}
+		return a.Name < b.Name
+	})
+	for name, wins := range ma.gameMetrics.WinnerFrequency {
+		top.offer(winner{Name: name, Wins: wins})
 	}
-
-	if len(winners) > limit {
-		winners = winners[:limit]
-	}
+	winners := top.sorted()
 
 	result := make([]struct {
 		Name string
@@ -513,8 +831,8 @@ func (ma *MetricsAggregator) Flush() error {
 func (ma *MetricsAggregator) cleanupOldMetrics() {
 	now := time.Now()
 	
-	// Clean hourly metrics (keep last 7 days)
-	cutoffHour := now.Add(-7 * 24 * time.Hour).Format("2006-01-02-15")
+	// Clean hourly metrics (keep the hourly retention)
+	cutoffHour := now.Add(-ma.memory.HourlyRetention).Format("2006-01-02-15")
 	ma.hourlyMetrics.mu.Lock()
 	for key := range ma.hourlyMetrics.GamesPerHour {
 		if key < cutoffHour {
@@ -526,8 +844,8 @@ func (ma *MetricsAggregator) cleanupOldMetrics() {
 	}
 	ma.hourlyMetrics.mu.Unlock()
 
-	// Clean daily metrics (keep last 30 days)
-	cutoffDay := now.Add(-30 * 24 * time.Hour).Format("2006-01-02")
+	// Clean daily metrics (keep the daily retention)
+	cutoffDay := now.Add(-ma.memory.DailyRetention).Format("2006-01-02")
 	ma.dailyMetrics.mu.Lock()
 	for key := range ma.dailyMetrics.GamesPerDay {
 		if key < cutoffDay {
@@ -540,30 +858,206 @@ func (ma *MetricsAggregator) cleanupOldMetrics() {
 	}
 	ma.dailyMetrics.mu.Unlock()
 
+	// Clean hourly queue metrics (keep the hourly retention)
+	ma.queueMetrics.mu.Lock()
+	for _, queue := range ma.queueMetrics.Queues {
+		for key := range queue.PeakDepthPerHour {
+			if key < cutoffHour {
+				delete(queue.PeakDepthPerHour, key)
+			}
+		}
+		for key := range queue.MatchesPerHour {
+			if key < cutoffHour {
+				delete(queue.MatchesPerHour, key)
+				delete(queue.AverageWaitHour, key)
+			}
+		}
+	}
+	ma.queueMetrics.mu.Unlock()
+
+	ma.columnMetrics.cleanup(now)
+	ma.concurrency.cleanup(now, ma.memory.DailyRetention)
+
 	// Mark inactive players (not seen in last 24 hours)
 	cutoffTime := now.Add(-24 * time.Hour)
-	ma.playerMetrics.mu.Lock()
-	for _, player := range ma.playerMetrics.ActivePlayers {
+	ma.players.eachLocked(func(player *PlayerStats) {
 		if player.LastSeen.Before(cutoffTime) {
 			player.IsActive = false
 		}
-	}
-	ma.playerMetrics.mu.Unlock()
+	})
 }
 
-// persistMetrics saves current metrics to database (optional implementation)
+// persistMetrics upserts the game totals, the hours and days still kept and
+// the players changed since the last flush
 func (ma *MetricsAggregator) persistMetrics() error {
-	// This could save aggregated metrics to a separate analytics table
-	// For now, we'll just log the current state
-	
+	if ma.store == nil {
+		return nil
+	}
+
 	gameMetrics := ma.GetGameMetrics()
-	playerMetrics := ma.GetPlayerMetrics()
-	
-	log.Printf("Persisting metrics: %d games, %d players, %.1fs avg duration",
-		gameMetrics.TotalGames, playerMetrics.TotalPlayers, gameMetrics.AverageGameDuration)
-	
-	// TODO: Implement actual database persistence if needed
-	// This could involve creating analytics tables and storing aggregated data
-	
+	hourly := ma.GetHourlyMetrics()
+	daily := ma.GetDailyMetrics()
+
+	aggregates := &database.AnalyticsAggregates{
+		Game: &database.GameTotals{
+			TotalGames:        gameMetrics.TotalGames,
+			CompletedGames:    gameMetrics.CompletedGames,
+			TotalGameDuration: gameMetrics.TotalGameDuration,
+			DrawCount:         gameMetrics.DrawCount,
+			BotGames:          gameMetrics.BotGames,
+			HumanGames:        gameMetrics.HumanGames,
+			WinTypes:          gameMetrics.WinTypeDistribution,
+		},
+	}
+
+	// Hours and days with moves but no game started in them count too
+	for _, hour := range metricKeys(hourly.GamesPerHour, hourly.MovesPerHour) {
+		aggregates.Hourly = append(aggregates.Hourly, database.HourlyStats{
+			Hour:            hour,
+			Games:           hourly.GamesPerHour[hour],
+			Moves:           hourly.MovesPerHour[hour],
+			Players:         hourly.PlayersPerHour[hour],
+			AverageDuration: hourly.AverageDurationHour[hour],
+		})
+	}
+	for _, day := range metricKeys(daily.GamesPerDay, daily.MovesPerDay) {
+		aggregates.Daily = append(aggregates.Daily, database.DailyStats{
+			Day:             day,
+			Games:           daily.GamesPerDay[day],
+			Moves:           daily.MovesPerDay[day],
+			Players:         daily.PlayersPerDay[day],
+			NewPlayers:      daily.NewPlayersPerDay[day],
+			AverageDuration: daily.AverageDurationDay[day],
+		})
+	}
+
+	dirty := ma.players.takeDirty()
+	names := make([]string, len(dirty))
+	for i, player := range dirty {
+		names[i] = player.Name
+		aggregates.Players = append(aggregates.Players, database.AggregatedPlayerStats{
+			Name:             player.Name,
+			GamesPlayed:      player.GamesPlayed,
+			GamesWon:         player.GamesWon,
+			GamesLost:        player.GamesLost,
+			GamesDrawn:       player.GamesDrawn,
+			TotalMoves:       player.TotalMoves,
+			TotalGameTime:    player.TotalGameTime,
+			Disconnections:   player.Disconnections,
+			Reconnections:    player.Reconnections,
+			TotalOfflineTime: player.TotalOfflineTime,
+			FirstSeen:        player.FirstSeen,
+			LastSeen:         player.LastSeen,
+			CurrentStreak:    player.CurrentStreak,
+			LongestStreak:    player.LongestStreak,
+		})
+	}
+
+	if err := ma.store.SaveAnalyticsAggregates(aggregates); err != nil {
+		// Saved with the next flush
+		ma.players.markDirty(names)
+		return err
+	}
+
+	log.Printf("Persisted metrics: %d games, %d hours, %d days, %d changed players",
+		gameMetrics.TotalGames, len(aggregates.Hourly), len(aggregates.Daily), len(aggregates.Players))
+
+	return nil
+}
+
+// load restores the metrics saved by a previous run
+func (ma *MetricsAggregator) load() error {
+	now := time.Now()
+	aggregates, err := ma.store.LoadAnalyticsAggregates(
+		now.Add(-ma.memory.HourlyRetention).Format("2006-01-02-15"),
+		now.Add(-ma.memory.DailyRetention).Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	if game := aggregates.Game; game != nil {
+		ma.gameMetrics.TotalGames = game.TotalGames
+		ma.gameMetrics.CompletedGames = game.CompletedGames
+		ma.gameMetrics.TotalGameDuration = game.TotalGameDuration
+		ma.gameMetrics.DrawCount = game.DrawCount
+		ma.gameMetrics.BotGames = game.BotGames
+		ma.gameMetrics.HumanGames = game.HumanGames
+		if game.CompletedGames > 0 {
+			ma.gameMetrics.AverageGameDuration = float64(game.TotalGameDuration) / float64(game.CompletedGames)
+		}
+		for winType, count := range game.WinTypes {
+			ma.gameMetrics.WinTypeDistribution[winType] = count
+		}
+	}
+
+	for _, hour := range aggregates.Hourly {
+		ma.hourlyMetrics.GamesPerHour[hour.Hour] = hour.Games
+		ma.hourlyMetrics.MovesPerHour[hour.Hour] = hour.Moves
+		ma.hourlyMetrics.PlayersPerHour[hour.Hour] = hour.Players
+		ma.hourlyMetrics.AverageDurationHour[hour.Hour] = hour.AverageDuration
+		if hour.Hour > ma.hourlyMetrics.CurrentHour {
+			ma.hourlyMetrics.CurrentHour = hour.Hour
+		}
+	}
+
+	for _, day := range aggregates.Daily {
+		ma.dailyMetrics.GamesPerDay[day.Day] = day.Games
+		ma.dailyMetrics.MovesPerDay[day.Day] = day.Moves
+		ma.dailyMetrics.PlayersPerDay[day.Day] = day.Players
+		ma.dailyMetrics.NewPlayersPerDay[day.Day] = day.NewPlayers
+		ma.dailyMetrics.AverageDurationDay[day.Day] = day.AverageDuration
+		if day.Day > ma.dailyMetrics.CurrentDay {
+			ma.dailyMetrics.CurrentDay = day.Day
+		}
+	}
+
+	// Only the players seen most recently are kept in memory, but the
+	// player totals are the sums of what was recorded for every player
+	today := now.Format("2006-01-02")
+	recent := newTopK(len(aggregates.Players), func(a, b database.AggregatedPlayerStats) bool {
+		return seenEarlier(seenPlayer{b.Name, b.LastSeen}, seenPlayer{a.Name, a.LastSeen})
+	})
+	if ma.memory.MaxPlayers > 0 && ma.memory.MaxPlayers < len(aggregates.Players) {
+		recent = newTopK(ma.memory.MaxPlayers, recent.better)
+	}
+	for _, saved := range aggregates.Players {
+		recent.offer(saved)
+
+		ma.playerTotals.players++
+		ma.playerTotals.moves += saved.TotalMoves
+		ma.playerTotals.disconnections += saved.Disconnections
+		ma.playerTotals.reconnections += saved.Reconnections
+		if saved.FirstSeen.Format("2006-01-02") == today {
+			ma.playerTotals.newToday++
+		}
+		if saved.GamesWon > 0 {
+			ma.gameMetrics.WinnerFrequency[saved.Name] = saved.GamesWon
+		}
+	}
+	players := make(map[string]*PlayerStats, len(recent.items))
+	for _, saved := range recent.items {
+		players[saved.Name] = playerFromSaved(saved, now)
+	}
+	ma.evictedPlayers = int64(len(aggregates.Players) - len(players))
+
+	ma.players.replace(players)
+
+	log.Printf("Loaded saved metrics: %d games, %d players (%d in memory), %d hours, %d days",
+		ma.gameMetrics.TotalGames, ma.playerTotals.players, len(players), len(aggregates.Hourly), len(aggregates.Daily))
 	return nil
-}
\ No newline at end of file
+}
+
+// metricKeys returns the keys of the maps, each once
+func metricKeys(maps ...map[string]int64) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run with -race: the snapshot is read while queue events update the metrics
+func TestGetQueueMetricsSnapshot(t *testing.T) {
+	ma, err := NewMetricsAggregator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hour := time.Date(2024, time.January, 1, 15, 0, 0, 0, time.UTC)
+	join := func(size int) {
+		event := QueueJoinedEvent{BaseEvent: BaseEvent{Timestamp: hour}, Player: PlayerInfo{Name: "alice"}, QueueType: "ranked", QueueSize: size}
+		if err := ma.RecordQueueJoined(event); err != nil {
+			t.Error(err)
+		}
+	}
+	join(3)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			join(i % 5)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		snapshot := ma.GetQueueMetrics()
+		if queue := snapshot.Queues["ranked"]; queue == nil || queue.Joins == 0 {
+			t.Fatalf("the snapshot has queues %v", snapshot.Queues)
+		}
+	}
+	wg.Wait()
+
+	// Changing the snapshot leaves the metrics as they were
+	snapshot := ma.GetQueueMetrics()
+	snapshot.Queues["ranked"].Joins = 0
+	snapshot.Queues["ranked"].PeakDepthPerHour["2024-01-01-15"] = 99
+	delete(snapshot.Queues, "ranked")
+
+	queue := ma.GetQueueMetrics().Queues["ranked"]
+	if queue == nil || queue.Joins != 101 || queue.PeakDepth != 4 || queue.PeakDepthPerHour["2024-01-01-15"] != 4 {
+		t.Errorf("after changing a snapshot the queue is %+v", queue)
+	}
+}
@@ -0,0 +1,437 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics alert rules watch. The counts and the error rate are over the
+// rule's window, the others are their value when evaluated.
+const (
+	AlertErrorRate    = "error_rate"    // share of the messages that failed, 0 to 1
+	AlertMessages     = "messages"      // messages processed
+	AlertDeadLettered = "dead_lettered" // messages sent to the dead-letter topic
+	AlertGamesStarted = "games_started"
+	AlertConsumerLag  = "consumer_lag" // total lag when last checked
+	AlertActiveGames  = "active_games"
+)
+
+// windowedAlertMetrics are the metrics measured over a window
+var windowedAlertMetrics = map[string]bool{
+	AlertErrorRate:    true,
+	AlertMessages:     true,
+	AlertDeadLettered: true,
+	AlertGamesStarted: true,
+}
+
+// defaultAlertWindow is the window of a rule on a windowed metric without one
+const defaultAlertWindow = 5 * time.Minute
+
+// Alert states
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertRule fires while its metric compares to the threshold as the
+// operator says, like "games_started < 1 over 30m"
+type AlertRule struct {
+	Name      string        `json:"name"`
+	Metric    string        `json:"metric"`
+	Operator  string        `json:"operator"` // >, >=, <, <= or ==
+	Threshold float64       `json:"threshold"`
+	Window    time.Duration `json:"window"` // 0 for the metrics that aren't windowed
+}
+
+// AlertConfig configures the rules, how often they're evaluated and where
+// alerts are sent when they fire and resolve
+type AlertConfig struct {
+	Rules           []AlertRule   `json:"rules"`
+	Interval        time.Duration `json:"interval"`
+	WebhookURL      string        `json:"webhook_url"`       // gets every alert as JSON, empty for none
+	SlackWebhookURL string        `json:"slack_webhook_url"` // a Slack incoming webhook, empty for none
+}
+
+// DefaultAlertConfig returns rules for a consumer that is failing, falling
+// behind or seeing no games, without notifications
+func DefaultAlertConfig() AlertConfig {
+	rules, _ := ParseAlertRules("error_rate > 0.05 over 5m, consumer_lag > 10000, games_started < 1 over 30m")
+	return AlertConfig{
+		Rules:    rules,
+		Interval: time.Minute,
+	}
+}
+
+// AlertConfigFromEnv reads ALERT_RULES (none for no rules), ALERT_INTERVAL,
+// ALERT_WEBHOOK_URL and ALERT_SLACK_WEBHOOK_URL over the defaults
+func AlertConfigFromEnv() (AlertConfig, error) {
+	config := DefaultAlertConfig()
+	switch value := strings.TrimSpace(os.Getenv("ALERT_RULES")); value {
+	case "":
+	case "none":
+		config.Rules = nil
+	default:
+		rules, err := ParseAlertRules(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid ALERT_RULES: %w", err)
+		}
+		config.Rules = rules
+	}
+	if value, err := time.ParseDuration(os.Getenv("ALERT_INTERVAL")); err == nil && value > 0 {
+		config.Interval = value
+	}
+	config.WebhookURL = os.Getenv("ALERT_WEBHOOK_URL")
+	config.SlackWebhookURL = os.Getenv("ALERT_SLACK_WEBHOOK_URL")
+	return config, nil
+}
+
+// ParseAlertRules parses comma separated rules like "error_rate > 0.05 over
+// 5m". Each rule is named after its text, with single spaces between its parts.
+func ParseAlertRules(value string) ([]AlertRule, error) {
+	var rules []AlertRule
+	names := make(map[string]bool)
+	for _, text := range strings.Split(value, ",") {
+		rule, err := parseAlertRule(text)
+		if err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %q is given twice", rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseAlertRule(text string) (AlertRule, error) {
+	text = strings.Join(strings.Fields(text), " ")
+	rule := AlertRule{Name: text}
+
+	condition, window, windowed := strings.Cut(text, " over ")
+	opAt := strings.IndexAny(condition, "<>=")
+	if opAt <= 0 {
+		return rule, fmt.Errorf("rule %q is not like \"metric > threshold\"", rule.Name)
+	}
+	rule.Metric = strings.TrimSpace(condition[:opAt])
+	rest := condition[opAt:]
+	for _, op := range []string{">=", "<=", "==", ">", "<"} {
+		if strings.HasPrefix(rest, op) {
+			rule.Operator = op
+			break
+		}
+	}
+	if rule.Operator == "" {
+		return rule, fmt.Errorf("rule %q has no operator >, >=, <, <= or ==", rule.Name)
+	}
+
+	thresholdText := strings.TrimSpace(rest[len(rule.Operator):])
+	threshold, err := strconv.ParseFloat(thresholdText, 64)
+	if err != nil {
+		return rule, fmt.Errorf("rule %q has no numeric threshold", rule.Name)
+	}
+	rule.Threshold = threshold
+	rule.Name = rule.Metric + " " + rule.Operator + " " + thresholdText
+	if windowed {
+		rule.Name += " over " + strings.TrimSpace(window)
+	}
+
+	switch {
+	case !windowedAlertMetrics[rule.Metric] && rule.Metric != AlertConsumerLag && rule.Metric != AlertActiveGames:
+		return rule, fmt.Errorf("rule %q watches unknown metric %q", rule.Name, rule.Metric)
+	case windowed && !windowedAlertMetrics[rule.Metric]:
+		return rule, fmt.Errorf("rule %q has a window, but %s isn't measured over one", rule.Name, rule.Metric)
+	case windowed:
+		if rule.Window, err = time.ParseDuration(strings.TrimSpace(window)); err != nil || rule.Window <= 0 {
+			return rule, fmt.Errorf("rule %q has an invalid window %q", rule.Name, strings.TrimSpace(window))
+		}
+	case windowedAlertMetrics[rule.Metric]:
+		rule.Window = defaultAlertWindow
+	}
+	return rule, nil
+}
+
+// holds reports whether the value breaks the rule
+func (r AlertRule) holds(value float64) bool {
+	switch r.Operator {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	default:
+		return value == r.Threshold
+	}
+}
+
+// Alert is a rule that fired, with the metric's last value
+type Alert struct {
+	Rule       string     `json:"rule"`
+	Metric     string     `json:"metric"`
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold"`
+	State      string     `json:"state"`
+	FiredAt    time.Time  `json:"fired_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// AlertRuleState is a rule's last evaluation. Value is nil until the
+// consumer has run for the rule's window.
+type AlertRuleState struct {
+	Rule   string   `json:"rule"`
+	Metric string   `json:"metric"`
+	Value  *float64 `json:"value"`
+	Firing bool     `json:"firing"`
+}
+
+// AlertStatus is the alerts firing and how every rule last evaluated
+type AlertStatus struct {
+	Active      []Alert          `json:"active"`
+	Rules       []AlertRuleState `json:"rules"`
+	EvaluatedAt time.Time        `json:"evaluated_at"`
+}
+
+// AlertNotifier is told when an alert fires and when it resolves
+type AlertNotifier interface {
+	NotifyAlert(ctx context.Context, alert Alert) error
+}
+
+// alertSample is what the rules are evaluated on, taken every interval.
+// The windowed metrics are the difference between two samples.
+type alertSample struct {
+	at           time.Time
+	processed    int64
+	errored      int64
+	deadLettered int64
+	gamesStarted int64
+	lag          int64
+	activeGames  int
+}
+
+// alertEngine evaluates the rules on samples of the consumer's metrics
+type alertEngine struct {
+	config    AlertConfig
+	notifiers []AlertNotifier
+	maxWindow time.Duration
+
+	mu          sync.RWMutex
+	samples     []alertSample // oldest first, going back the longest window
+	values      map[string]*float64
+	active      map[string]*Alert
+	evaluatedAt time.Time
+}
+
+func newAlertEngine(config AlertConfig) *alertEngine {
+	engine := &alertEngine{
+		config: config,
+		values: make(map[string]*float64),
+		active: make(map[string]*Alert),
+	}
+	for _, rule := range config.Rules {
+		if rule.Window > engine.maxWindow {
+			engine.maxWindow = rule.Window
+		}
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if config.WebhookURL != "" {
+		engine.notifiers = append(engine.notifiers, &webhookAlertNotifier{url: config.WebhookURL, client: client})
+	}
+	if config.SlackWebhookURL != "" {
+		engine.notifiers = append(engine.notifiers, &slackAlertNotifier{url: config.SlackWebhookURL, client: client})
+	}
+	return engine
+}
+
+// evaluate adds the sample and returns the alerts that fired or resolved
+func (e *alertEngine) evaluate(sample alertSample) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.samples = append(e.samples, sample)
+	keepFrom := sample.at.Add(-e.maxWindow - e.config.Interval)
+	for len(e.samples) > 1 && e.samples[1].at.Before(keepFrom) {
+		e.samples = e.samples[1:]
+	}
+	e.evaluatedAt = sample.at
+
+	var changed []Alert
+	for _, rule := range e.config.Rules {
+		value, ok := e.value(rule, sample)
+		if !ok {
+			e.values[rule.Name] = nil
+			continue
+		}
+		e.values[rule.Name] = &value
+
+		alert := e.active[rule.Name]
+		switch holds := rule.holds(value); {
+		case holds && alert == nil:
+			alert = &Alert{
+				Rule:      rule.Name,
+				Metric:    rule.Metric,
+				Value:     value,
+				Threshold: rule.Threshold,
+				State:     AlertFiring,
+				FiredAt:   sample.at,
+			}
+			e.active[rule.Name] = alert
+			changed = append(changed, *alert)
+		case holds:
+			alert.Value = value
+		case alert != nil:
+			resolvedAt := sample.at
+			alert.Value = value
+			alert.State = AlertResolved
+			alert.ResolvedAt = &resolvedAt
+			delete(e.active, rule.Name)
+			changed = append(changed, *alert)
+		}
+	}
+	return changed
+}
+
+// value returns the rule's metric, false for a windowed metric until the
+// samples go back the window. Half an interval of slack keeps the ticker's
+// jitter from pushing the baseline one sample further back.
+func (e *alertEngine) value(rule AlertRule, latest alertSample) (float64, bool) {
+	switch rule.Metric {
+	case AlertConsumerLag:
+		return float64(latest.lag), true
+	case AlertActiveGames:
+		return float64(latest.activeGames), true
+	}
+
+	cutoff := latest.at.Add(-rule.Window + e.config.Interval/2)
+	var base *alertSample
+	for i := range e.samples {
+		if e.samples[i].at.After(cutoff) {
+			break
+		}
+		base = &e.samples[i]
+	}
+	if base == nil {
+		return 0, false
+	}
+
+	switch rule.Metric {
+	case AlertErrorRate:
+		errored := counterDelta(base.errored, latest.errored)
+		total := counterDelta(base.processed, latest.processed) + errored
+		if total == 0 {
+			return 0, true
+		}
+		return float64(errored) / float64(total), true
+	case AlertMessages:
+		return float64(counterDelta(base.processed, latest.processed)), true
+	case AlertDeadLettered:
+		return float64(counterDelta(base.deadLettered, latest.deadLettered)), true
+	default:
+		return float64(counterDelta(base.gamesStarted, latest.gamesStarted)), true
+	}
+}
+
+// counterDelta is how much a counter grew, all of it when it was reset
+func counterDelta(from, to int64) int64 {
+	if to < from {
+		return to
+	}
+	return to - from
+}
+
+// notify tells every notifier about the alerts, logging those it couldn't
+func (e *alertEngine) notify(ctx context.Context, alerts []Alert) {
+	for _, alert := range alerts {
+		log.Printf("Alert %s: %s (value %g)", alert.State, alert.Rule, alert.Value)
+		for _, notifier := range e.notifiers {
+			if err := notifier.NotifyAlert(ctx, alert); err != nil {
+				log.Printf("Failed to send alert %q: %v", alert.Rule, err)
+			}
+		}
+	}
+}
+
+// status returns the active alerts, oldest first, and the rules' last values
+func (e *alertEngine) status() AlertStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	status := AlertStatus{
+		Active:      make([]Alert, 0, len(e.active)),
+		Rules:       make([]AlertRuleState, 0, len(e.config.Rules)),
+		EvaluatedAt: e.evaluatedAt,
+	}
+	for _, rule := range e.config.Rules {
+		alert := e.active[rule.Name]
+		if alert != nil {
+			status.Active = append(status.Active, *alert)
+		}
+		status.Rules = append(status.Rules, AlertRuleState{
+			Rule:   rule.Name,
+			Metric: rule.Metric,
+			Value:  e.values[rule.Name],
+			Firing: alert != nil,
+		})
+	}
+	return status
+}
+
+// webhookAlertNotifier POSTs each alert as JSON
+type webhookAlertNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookAlertNotifier) NotifyAlert(ctx context.Context, alert Alert) error {
+	return postAlertJSON(ctx, n.client, n.url, alert)
+}
+
+// slackAlertNotifier posts each alert as a message to a Slack incoming webhook
+type slackAlertNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// slackEscaper escapes the characters Slack reads as markup in message text
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (n *slackAlertNotifier) NotifyAlert(ctx context.Context, alert Alert) error {
+	text := fmt.Sprintf("[FIRING] %s: %s is %g", alert.Rule, alert.Metric, alert.Value)
+	if alert.State == AlertResolved {
+		text = fmt.Sprintf("[RESOLVED] %s, after %s", alert.Rule, alert.ResolvedAt.Sub(alert.FiredAt).Round(time.Second))
+	}
+	return postAlertJSON(ctx, n.client, n.url, map[string]string{"text": slackEscaper.Replace(text)})
+}
+
+func postAlertJSON(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,497 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Why a player was flagged
+const (
+	FlagSolverAccuracy   = "solver_accuracy"    // plays the solver's best move too often
+	FlagRoboticTiming    = "robotic_timing"     // takes about the same time over every move
+	FlagSameOpponentWins = "same_opponent_wins" // wins nearly only against one opponent
+)
+
+// Review states of a flag
+const (
+	FlagOpen      = "open"
+	FlagDismissed = "dismissed"
+	FlagConfirmed = "confirmed"
+)
+
+var (
+	ErrFlagNotFound      = errors.New("flag not found")
+	ErrInvalidFlagStatus = errors.New("flag status must be open, dismissed or confirmed")
+)
+
+// AnomalyConfig sets how much play the detector needs before judging a
+// player and what it finds implausible
+type AnomalyConfig struct {
+	// Share of solver-graded moves matching the solver's best move
+	MinSolvedMoves    int     `json:"min_solved_moves"`
+	MaxSolverAccuracy float64 `json:"max_solver_accuracy"`
+
+	// Standard deviation of the think time relative to its mean
+	MinTimedMoves        int     `json:"min_timed_moves"`
+	MinMoveTimeVariation float64 `json:"min_move_time_variation"`
+
+	// Share of a player's wins against their most beaten opponent
+	MinWins              int     `json:"min_wins"`
+	MaxSameOpponentShare float64 `json:"max_same_opponent_share"`
+}
+
+// DefaultAnomalyConfig returns thresholds a strong human rarely crosses
+func DefaultAnomalyConfig() AnomalyConfig {
+	return AnomalyConfig{
+		MinSolvedMoves:       50,
+		MaxSolverAccuracy:    0.95,
+		MinTimedMoves:        50,
+		MinMoveTimeVariation: 0.1,
+		MinWins:              10,
+		MaxSameOpponentShare: 0.9,
+	}
+}
+
+// PlayerFlag is a player suspected of cheating, for a moderator to review
+type PlayerFlag struct {
+	ID         string     `json:"id"`
+	Player     string     `json:"player"`
+	Reason     string     `json:"reason"`
+	Detail     string     `json:"detail"`
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold"`
+	GameID     string     `json:"game_id,omitempty"` // the game that tipped the detector off
+	Status     string     `json:"status"`
+	FlaggedAt  time.Time  `json:"flagged_at"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	ReviewNote string     `json:"review_note,omitempty"`
+}
+
+// FlagPublisher emits player_flagged events, the AnalyticsService is one
+type FlagPublisher interface {
+	EmitPlayerFlagged(flag PlayerFlag) error
+}
+
+// FlagStore keeps flags for review across restarts, the repository is one
+type FlagStore interface {
+	SavePlayerFlag(flag *database.PlayerFlag) error
+	LoadPlayerFlags() ([]database.PlayerFlag, error)
+}
+
+// playerSignals is what the detector knows of a player's play
+type playerSignals struct {
+	SolvedMoves int64 `json:"solved_moves"`
+	BestMoves   int64 `json:"best_moves"`
+
+	// Think time in ms, mean and sum of squared deviations kept with Welford's method
+	TimedMoves   int64   `json:"timed_moves"`
+	MoveTimeMean float64 `json:"move_time_mean"`
+	MoveTimeM2   float64 `json:"move_time_m2"`
+
+	Wins           int64            `json:"wins"`
+	WinsByOpponent map[string]int64 `json:"wins_by_opponent"`
+}
+
+// anomalyState is the detector's state, kept in snapshots
+type anomalyState struct {
+	Players map[string]*playerSignals `json:"players"`
+	Bots    map[string]bool           `json:"bots"`
+	Flags   []PlayerFlag              `json:"flags"`
+}
+
+// AnomalyDetector flags players whose play looks assisted or arranged. Each
+// player is flagged at most once per reason.
+type AnomalyDetector struct {
+	config    AnomalyConfig
+	store     FlagStore     // nil to keep flags in memory only
+	publisher FlagPublisher // nil to not emit player_flagged events
+
+	mu      sync.Mutex
+	players map[string]*playerSignals
+	bots    map[string]bool // names seen playing as bots, never flagged
+	flags   []*PlayerFlag
+	flagged map[string]bool // player and reason
+}
+
+// NewAnomalyDetector creates a detector, with a store it carries on from the flags saved there
+func NewAnomalyDetector(config AnomalyConfig, repo database.Store) (*AnomalyDetector, error) {
+	ad := &AnomalyDetector{
+		config:  config,
+		players: make(map[string]*playerSignals),
+		bots:    make(map[string]bool),
+		flagged: make(map[string]bool),
+	}
+
+	if repo != nil {
+		ad.store = repo
+		saved, err := ad.store.LoadPlayerFlags()
+		if err != nil {
+			return nil, err
+		}
+		for _, flag := range saved {
+			ad.addFlag(&PlayerFlag{
+				ID:         flag.ID,
+				Player:     flag.PlayerName,
+				Reason:     flag.Reason,
+				Detail:     flag.Detail,
+				Value:      flag.Value,
+				Threshold:  flag.Threshold,
+				Status:     flag.Status,
+				FlaggedAt:  flag.FlaggedAt,
+				ReviewedAt: flag.ReviewedAt,
+				ReviewNote: flag.ReviewNote,
+			})
+		}
+	}
+	return ad, nil
+}
+
+// SetConfig replaces the thresholds
+func (ad *AnomalyDetector) SetConfig(config AnomalyConfig) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+	ad.config = config
+}
+
+// SetPublisher emits a player_flagged event for every new flag
+func (ad *AnomalyDetector) SetPublisher(publisher FlagPublisher) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+	ad.publisher = publisher
+}
+
+// RecordMove adds a human move's think time
+func (ad *AnomalyDetector) RecordMove(event MovePlayedEvent) {
+	ad.update(func() []*PlayerFlag {
+		if event.Player.IsBot {
+			ad.bots[event.Player.Name] = true
+			return nil
+		}
+		if event.TimeTaken <= 0 {
+			return nil
+		}
+
+		signals := ad.signals(event.Player.Name)
+		signals.TimedMoves++
+		delta := float64(event.TimeTaken) - signals.MoveTimeMean
+		signals.MoveTimeMean += delta / float64(signals.TimedMoves)
+		signals.MoveTimeM2 += delta * (float64(event.TimeTaken) - signals.MoveTimeMean)
+
+		return ad.check(event.Player.Name, event.GameID)
+	})
+}
+
+// RecordGameEnd credits the winner of a game between two humans with a win
+// against the loser
+func (ad *AnomalyDetector) RecordGameEnd(event GameEndedEvent) {
+	ad.update(func() []*PlayerFlag {
+		for _, player := range event.Players {
+			if player.IsBot {
+				ad.bots[player.Name] = true
+				return nil
+			}
+		}
+		if event.Winner == nil || len(event.Players) != 2 {
+			return nil
+		}
+
+		loser := event.Players[0].Name
+		if loser == event.Winner.Name {
+			loser = event.Players[1].Name
+		}
+		signals := ad.signals(event.Winner.Name)
+		signals.Wins++
+		signals.WinsByOpponent[loser]++
+
+		return ad.check(event.Winner.Name, event.GameID)
+	})
+}
+
+// RecordAnalysis counts the solver-graded moves of each player and how many
+// were the solver's best
+func (ad *AnomalyDetector) RecordAnalysis(event GameAnalysisEvent) {
+	ad.update(func() []*PlayerFlag {
+		names := make(map[uuid.UUID]string, len(event.Players))
+		for _, player := range event.Players {
+			names[player.PlayerID] = player.PlayerName
+		}
+
+		graded := make(map[string]bool)
+		for _, move := range event.Moves {
+			name, known := names[move.PlayerID]
+			if !known || !move.Solved || ad.bots[name] {
+				continue
+			}
+			signals := ad.signals(name)
+			signals.SolvedMoves++
+			if move.Quality == models.MoveQualityBest {
+				signals.BestMoves++
+			}
+			graded[name] = true
+		}
+
+		var raised []*PlayerFlag
+		for name := range graded {
+			raised = append(raised, ad.check(name, event.GameID)...)
+		}
+		return raised
+	})
+}
+
+// update applies a change and publishes the flags it raised once unlocked
+func (ad *AnomalyDetector) update(change func() []*PlayerFlag) {
+	ad.mu.Lock()
+	raised := change()
+	publisher := ad.publisher
+	ad.mu.Unlock()
+
+	if publisher == nil {
+		return
+	}
+	for _, flag := range raised {
+		if err := publisher.EmitPlayerFlagged(*flag); err != nil {
+			log.Printf("Failed to emit flag of %s: %v", flag.Player, err)
+		}
+	}
+}
+
+func (ad *AnomalyDetector) signals(name string) *playerSignals {
+	signals, exists := ad.players[name]
+	if !exists {
+		signals = &playerSignals{WinsByOpponent: make(map[string]int64)}
+		ad.players[name] = signals
+	}
+	return signals
+}
+
+// check raises the flags the player's play now calls for
+func (ad *AnomalyDetector) check(name, gameID string) []*PlayerFlag {
+	if ad.bots[name] {
+		return nil
+	}
+	signals := ad.players[name]
+	var raised []*PlayerFlag
+
+	if signals.SolvedMoves >= int64(ad.config.MinSolvedMoves) && signals.SolvedMoves > 0 {
+		accuracy := float64(signals.BestMoves) / float64(signals.SolvedMoves)
+		if accuracy > ad.config.MaxSolverAccuracy {
+			raised = append(raised, ad.raise(name, FlagSolverAccuracy, gameID, accuracy, ad.config.MaxSolverAccuracy,
+				fmt.Sprintf("%d of %d solver-graded moves were the best move", signals.BestMoves, signals.SolvedMoves))...)
+		}
+	}
+
+	if signals.TimedMoves >= int64(ad.config.MinTimedMoves) && signals.TimedMoves > 1 && signals.MoveTimeMean > 0 {
+		variation := math.Sqrt(signals.MoveTimeM2/float64(signals.TimedMoves-1)) / signals.MoveTimeMean
+		if variation < ad.config.MinMoveTimeVariation {
+			raised = append(raised, ad.raise(name, FlagRoboticTiming, gameID, variation, ad.config.MinMoveTimeVariation,
+				fmt.Sprintf("%d moves averaging %.0fms varied by only %.1f%%", signals.TimedMoves, signals.MoveTimeMean, variation*100))...)
+		}
+	}
+
+	if signals.Wins >= int64(ad.config.MinWins) && signals.Wins > 0 {
+		opponent, wins := "", int64(0)
+		for name, count := range signals.WinsByOpponent {
+			if count > wins || (count == wins && name < opponent) {
+				opponent, wins = name, count
+			}
+		}
+		share := float64(wins) / float64(signals.Wins)
+		if share >= ad.config.MaxSameOpponentShare {
+			raised = append(raised, ad.raise(name, FlagSameOpponentWins, gameID, share, ad.config.MaxSameOpponentShare,
+				fmt.Sprintf("%d of %d wins were against %s", wins, signals.Wins, opponent))...)
+		}
+	}
+
+	return raised
+}
+
+// raise flags the player for the reason, unless they already were
+func (ad *AnomalyDetector) raise(name, reason, gameID string, value, threshold float64, detail string) []*PlayerFlag {
+	if ad.flagged[name+"/"+reason] {
+		return nil
+	}
+
+	flag := &PlayerFlag{
+		ID:        uuid.New().String(),
+		Player:    name,
+		Reason:    reason,
+		Detail:    detail,
+		Value:     value,
+		Threshold: threshold,
+		GameID:    gameID,
+		Status:    FlagOpen,
+		FlaggedAt: time.Now(),
+	}
+	ad.addFlag(flag)
+	ad.save(flag)
+	log.Printf("Flagged %s for %s: %s", name, reason, detail)
+	return []*PlayerFlag{flag}
+}
+
+func (ad *AnomalyDetector) addFlag(flag *PlayerFlag) {
+	ad.flags = append(ad.flags, flag)
+	ad.flagged[flag.Player+"/"+flag.Reason] = true
+}
+
+// save stores the flag, a failure only loses it on restart so processing goes on
+func (ad *AnomalyDetector) save(flag *PlayerFlag) {
+	if ad.store == nil {
+		return
+	}
+	err := ad.store.SavePlayerFlag(&database.PlayerFlag{
+		ID:         flag.ID,
+		PlayerName: flag.Player,
+		Reason:     flag.Reason,
+		Detail:     flag.Detail,
+		Value:      flag.Value,
+		Threshold:  flag.Threshold,
+		Status:     flag.Status,
+		FlaggedAt:  flag.FlaggedAt,
+		ReviewedAt: flag.ReviewedAt,
+		ReviewNote: flag.ReviewNote,
+	})
+	if err != nil {
+		log.Printf("Failed to save flag of %s: %v", flag.Player, err)
+	}
+}
+
+// Flags returns the flags with the status, or every flag for an empty one, newest first
+func (ad *AnomalyDetector) Flags(status string) []PlayerFlag {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	flags := make([]PlayerFlag, 0, len(ad.flags))
+	for i := len(ad.flags) - 1; i >= 0; i-- {
+		if status == "" || ad.flags[i].Status == status {
+			flags = append(flags, *ad.flags[i])
+		}
+	}
+	return flags
+}
+
+// Forget drops an erased player's signals and flags, and their wins counted
+// against them by others
+func (ad *AnomalyDetector) Forget(name string) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	delete(ad.players, name)
+	delete(ad.bots, name)
+	for _, signals := range ad.players {
+		delete(signals.WinsByOpponent, name)
+	}
+
+	kept := ad.flags[:0]
+	for _, flag := range ad.flags {
+		if flag.Player == name {
+			delete(ad.flagged, flag.Player+"/"+flag.Reason)
+			continue
+		}
+		kept = append(kept, flag)
+	}
+	for i := len(kept); i < len(ad.flags); i++ {
+		ad.flags[i] = nil
+	}
+	ad.flags = kept
+}
+
+// Review records a moderator's decision on a flag
+func (ad *AnomalyDetector) Review(id, status, note string) (PlayerFlag, error) {
+	if status != FlagOpen && status != FlagDismissed && status != FlagConfirmed {
+		return PlayerFlag{}, ErrInvalidFlagStatus
+	}
+
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	for _, flag := range ad.flags {
+		if flag.ID != id {
+			continue
+		}
+		now := time.Now()
+		flag.Status = status
+		flag.ReviewedAt = &now
+		flag.ReviewNote = note
+		if ad.store != nil {
+			err := ad.store.SavePlayerFlag(&database.PlayerFlag{
+				ID:         flag.ID,
+				PlayerName: flag.Player,
+				Reason:     flag.Reason,
+				Detail:     flag.Detail,
+				Value:      flag.Value,
+				Threshold:  flag.Threshold,
+				Status:     flag.Status,
+				FlaggedAt:  flag.FlaggedAt,
+				ReviewedAt: flag.ReviewedAt,
+				ReviewNote: flag.ReviewNote,
+			})
+			if err != nil {
+				return *flag, fmt.Errorf("failed to save review: %w", err)
+			}
+		}
+		return *flag, nil
+	}
+	return PlayerFlag{}, ErrFlagNotFound
+}
+
+// state returns a copy of what the detector knows
+func (ad *AnomalyDetector) state() *anomalyState {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	state := &anomalyState{
+		Players: make(map[string]*playerSignals, len(ad.players)),
+		Bots:    make(map[string]bool, len(ad.bots)),
+		Flags:   make([]PlayerFlag, len(ad.flags)),
+	}
+	for name, signals := range ad.players {
+		signalsCopy := *signals
+		signalsCopy.WinsByOpponent = make(map[string]int64, len(signals.WinsByOpponent))
+		for opponent, wins := range signals.WinsByOpponent {
+			signalsCopy.WinsByOpponent[opponent] = wins
+		}
+		state.Players[name] = &signalsCopy
+	}
+	for name := range ad.bots {
+		state.Bots[name] = true
+	}
+	for i, flag := range ad.flags {
+		state.Flags[i] = *flag
+	}
+	return state
+}
+
+// restore replaces what the detector knows with the snapshot's. With a store
+// the flags loaded from it are kept, they hold reviews newer than the snapshot.
+func (ad *AnomalyDetector) restore(state *anomalyState) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	ad.players = orEmpty(state.Players)
+	for _, signals := range ad.players {
+		signals.WinsByOpponent = orEmpty(signals.WinsByOpponent)
+	}
+	ad.bots = orEmpty(state.Bots)
+
+	if ad.store == nil {
+		ad.flags = nil
+		ad.flagged = make(map[string]bool)
+		sort.SliceStable(state.Flags, func(i, j int) bool {
+			return state.Flags[i].FlaggedAt.Before(state.Flags[j].FlaggedAt)
+		})
+		for i := range state.Flags {
+			flag := state.Flags[i]
+			ad.addFlag(&flag)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// ArchiveConfig configures archiving the raw events to long-term storage, so
+// history outlives the topics' retention
+type ArchiveConfig struct {
+	// URL is where files go: a directory (file:///var/lib/events or a plain
+	// path), s3://bucket/prefix or gs://bucket/prefix. Empty to not archive.
+	URL string `json:"url"`
+
+	// A file is uploaded once it holds MaxEvents events or is FlushInterval old.
+	// Uploads that fail are retried on the next flush, up to MaxPending files.
+	MaxEvents     int           `json:"max_events"`
+	FlushInterval time.Duration `json:"flush_interval"`
+	MaxPending    int           `json:"max_pending"`
+
+	// S3 and GCS credentials, GCS takes HMAC keys. Endpoint overrides the
+	// AWS endpoint for S3 compatible stores.
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+	AccessKeyID     string `json:"-"`
+	SecretAccessKey string `json:"-"`
+	SessionToken    string `json:"-"`
+}
+
+// DefaultArchiveConfig returns the archive limits, archiving is off until URL is set
+func DefaultArchiveConfig() ArchiveConfig {
+	return ArchiveConfig{
+		MaxEvents:     50000,
+		FlushInterval: 10 * time.Minute,
+		MaxPending:    100,
+		Region:        "us-east-1",
+	}
+}
+
+// ArchiveConfigFromEnv reads the archive settings from the ARCHIVE_* and AWS_* variables
+func ArchiveConfigFromEnv() ArchiveConfig {
+	config := DefaultArchiveConfig()
+	config.URL = os.Getenv("ARCHIVE_URL")
+	if value, err := strconv.Atoi(os.Getenv("ARCHIVE_MAX_EVENTS")); err == nil {
+		config.MaxEvents = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("ARCHIVE_FLUSH_INTERVAL")); err == nil {
+		config.FlushInterval = value
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		config.Region = region
+	}
+	config.Endpoint = os.Getenv("ARCHIVE_ENDPOINT")
+	config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	return config
+}
+
+// ArchiveStore keeps finished archive files under their key
+type ArchiveStore interface {
+	Put(ctx context.Context, key string, body []byte) error
+}
+
+// OpenArchiveStore returns the store the config's URL points to
+func OpenArchiveStore(config ArchiveConfig) (ArchiveStore, error) {
+	if !strings.Contains(config.URL, "://") {
+		return &LocalArchiveStore{Dir: config.URL}, nil
+	}
+
+	location, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive URL: %w", err)
+	}
+	prefix := strings.Trim(location.Path, "/")
+
+	switch location.Scheme {
+	case "file":
+		return &LocalArchiveStore{Dir: location.Path}, nil
+	case "s3":
+		return NewS3ArchiveStore(config, location.Host, prefix)
+	case "gs":
+		// GCS's XML API takes S3 signatures made with its HMAC keys
+		if config.Endpoint == "" {
+			config.Endpoint = "https://storage.googleapis.com"
+		}
+		config.Region = "auto"
+		return NewS3ArchiveStore(config, location.Host, prefix)
+	default:
+		return nil, fmt.Errorf("unsupported archive URL scheme %q, expected file, s3 or gs", location.Scheme)
+	}
+}
+
+// LocalArchiveStore writes archive files under a directory
+type LocalArchiveStore struct {
+	Dir string
+}
+
+func (s *LocalArchiveStore) Put(ctx context.Context, key string, body []byte) error {
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	// Written aside and renamed so a half written file never looks finished
+	partial := path + ".partial"
+	if err := os.WriteFile(partial, body, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return os.Rename(partial, path)
+}
+
+func (s *LocalArchiveStore) String() string {
+	return s.Dir
+}
+
+func joinArchiveKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// ArchiverStats tracks what the archiver wrote
+type ArchiverStats struct {
+	EventsArchived int64     `json:"events_archived"`
+	EventsDropped  int64     `json:"events_dropped"`
+	FilesUploaded  int64     `json:"files_uploaded"`
+	UploadErrors   int64     `json:"upload_errors"`
+	PendingFiles   int       `json:"pending_files"`
+	LastUploadTime time.Time `json:"last_upload_time"`
+	LastError      string    `json:"last_error"`
+}
+
+// Archiver batches raw events into gzipped JSON lines files, one per day
+// they were written, and uploads them as dt=YYYY-MM-DD/events-*.jsonl.gz.
+// The files are event archives ReadArchive and the event replayer read back.
+//
+// Events are held in memory until their file is uploaded, a crash loses at
+// most the last FlushInterval of them.
+type Archiver struct {
+	store    ArchiveStore
+	config   ArchiveConfig
+	files    map[string]*archiveFile // open files by day
+	pending  []*archiveFile          // finished files waiting to be uploaded
+	flush    chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	uploadMu sync.Mutex
+	stats    ArchiverStats
+}
+
+type archiveFile struct {
+	day     string
+	opened  time.Time
+	events  int
+	buffer  bytes.Buffer
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+	key     string // set once finished
+}
+
+func NewArchiver(config ArchiveConfig) (*Archiver, error) {
+	store, err := OpenArchiveStore(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewArchiverWithStore(config, store), nil
+}
+
+// NewArchiverWithStore creates an archiver uploading to the given store
+func NewArchiverWithStore(config ArchiveConfig, store ArchiveStore) *Archiver {
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = DefaultArchiveConfig().MaxEvents
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultArchiveConfig().FlushInterval
+	}
+	return &Archiver{
+		store:    store,
+		config:   config,
+		files:    make(map[string]*archiveFile),
+		flush:    make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start uploads finished files in the background until Close
+func (a *Archiver) Start() {
+	a.wg.Add(1)
+	go a.run()
+	log.Printf("Archiving events to %v", a.store)
+}
+
+// Add archives the messages, it only fails if one can't be encoded
+func (a *Archiver) Add(messages []kafka.Message) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, message := range messages {
+		day := message.Time.UTC().Format("2006-01-02")
+		file := a.files[day]
+		if file == nil {
+			file = &archiveFile{day: day, opened: time.Now()}
+			file.gzip = gzip.NewWriter(&file.buffer)
+			file.encoder = json.NewEncoder(file.gzip)
+			a.files[day] = file
+		}
+
+		if err := file.encoder.Encode(newArchivedEvent(message)); err != nil {
+			return fmt.Errorf("failed to archive %s@%d: %w", message.Topic, message.Offset, err)
+		}
+		file.events++
+		a.stats.EventsArchived++
+
+		if file.events >= a.config.MaxEvents {
+			a.finish(file)
+			select {
+			case a.flush <- struct{}{}:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// finish closes the file and queues it for upload, a.mu must be held
+func (a *Archiver) finish(file *archiveFile) {
+	delete(a.files, file.day)
+	if err := file.gzip.Close(); err != nil {
+		log.Printf("Failed to compress archive of %s: %v", file.day, err)
+		a.stats.EventsDropped += int64(file.events)
+		return
+	}
+	file.key = fmt.Sprintf("dt=%s/events-%s-%s.jsonl.gz",
+		file.day, time.Now().UTC().Format("20060102T150405Z"), uuid.NewString()[:8])
+	a.pending = append(a.pending, file)
+
+	if a.config.MaxPending > 0 && len(a.pending) > a.config.MaxPending {
+		dropped := a.pending[0]
+		a.pending = a.pending[1:]
+		a.stats.EventsDropped += int64(dropped.events)
+		log.Printf("⚠ Archive upload backlog full, dropped %s with %d events", dropped.key, dropped.events)
+	}
+}
+
+func (a *Archiver) run() {
+	defer a.wg.Done()
+
+	// Files are checked more often than they expire so none is kept much
+	// longer than FlushInterval
+	ticker := time.NewTicker(a.config.FlushInterval / 10)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopChan:
+			return
+		case <-a.flush:
+			a.upload(context.Background())
+		case <-ticker.C:
+			a.mu.Lock()
+			for _, file := range a.files {
+				if time.Since(file.opened) >= a.config.FlushInterval {
+					a.finish(file)
+				}
+			}
+			a.mu.Unlock()
+			a.upload(context.Background())
+		}
+	}
+}
+
+// upload puts the pending files in the store, keeping those that failed
+func (a *Archiver) upload(ctx context.Context) {
+	a.uploadMu.Lock()
+	defer a.uploadMu.Unlock()
+
+	a.mu.Lock()
+	files := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	var failed []*archiveFile
+	for _, file := range files {
+		err := a.store.Put(ctx, file.key, file.buffer.Bytes())
+
+		a.mu.Lock()
+		if err != nil {
+			a.stats.UploadErrors++
+			a.stats.LastError = err.Error()
+			failed = append(failed, file)
+			log.Printf("Failed to archive %d events: %v", file.events, err)
+		} else {
+			a.stats.FilesUploaded++
+			a.stats.LastUploadTime = time.Now()
+		}
+		a.mu.Unlock()
+	}
+
+	if len(failed) > 0 {
+		a.mu.Lock()
+		a.pending = append(failed, a.pending...)
+		a.mu.Unlock()
+	}
+}
+
+// Close finishes the open files and uploads everything still pending
+func (a *Archiver) Close(ctx context.Context) error {
+	close(a.stopChan)
+	a.wg.Wait()
+
+	a.mu.Lock()
+	for _, file := range a.files {
+		a.finish(file)
+	}
+	a.mu.Unlock()
+	a.upload(ctx)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.pending) > 0 {
+		events := 0
+		for _, file := range a.pending {
+			events += file.events
+		}
+		return fmt.Errorf("%d archive files with %d events were not uploaded", len(a.pending), events)
+	}
+	return nil
+}
+
+// GetStats returns the archiver's statistics
+func (a *Archiver) GetStats() ArchiverStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := a.stats
+	stats.PendingFiles = len(a.pending)
+	return stats
+}
@@ -0,0 +1,646 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// avroNamespace is the namespace of the records generated for events
+const avroNamespace = "connect_four.events"
+
+var errAvroShortBuffer = errors.New("avro: unexpected end of data")
+
+// avroSchema is a parsed Avro schema. Named types are resolved while parsing,
+// so records referenced by name point at their definition.
+type avroSchema struct {
+	Type        string // primitive name, "record", "enum", "fixed", "array", "map" or "union"
+	Name        string // full name of records, enums and fixed
+	LogicalType string
+	Fields      []*avroField
+	Symbols     []string      // enum
+	Size        int           // fixed
+	Items       *avroSchema   // array
+	Values      *avroSchema   // map
+	Branches    []*avroSchema // union
+}
+
+type avroField struct {
+	Name       string
+	Type       *avroSchema
+	Default    interface{}
+	HasDefault bool
+}
+
+// avroSchemaFor generates the record schema of an event struct the way
+// encoding/json sees it: fields are named by their json tags, pointers are
+// nullable and every field has a default so later versions can add fields.
+func avroSchemaFor(t reflect.Type) (*avroSchema, error) {
+	return avroTypeSchema(t, make(map[reflect.Type]*avroSchema))
+}
+
+func avroTypeSchema(t reflect.Type, records map[reflect.Type]*avroSchema) (*avroSchema, error) {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return &avroSchema{Type: "long", LogicalType: "timestamp-micros"}, nil
+	case reflect.TypeOf(uuid.UUID{}):
+		return &avroSchema{Type: "string", LogicalType: "uuid"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem, err := avroTypeSchema(t.Elem(), records)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{Type: "union", Branches: []*avroSchema{{Type: "null"}, elem}}, nil
+	case reflect.Bool:
+		return &avroSchema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &avroSchema{Type: "long"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &avroSchema{Type: "double"}, nil
+	case reflect.String:
+		return &avroSchema{Type: "string"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &avroSchema{Type: "bytes"}, nil
+		}
+		items, err := avroTypeSchema(t.Elem(), records)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("avro: map key of %s is not a string", t)
+		}
+		values, err := avroTypeSchema(t.Elem(), records)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{Type: "map", Values: values}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return nil, fmt.Errorf("avro: anonymous struct %s has no record name", t)
+		}
+		if record, ok := records[t]; ok {
+			return record, nil
+		}
+		record := &avroSchema{Type: "record", Name: avroNamespace + "." + t.Name()}
+		records[t] = record
+		if err := addAvroFields(record, t, records); err != nil {
+			return nil, err
+		}
+		return record, nil
+	default:
+		return nil, fmt.Errorf("avro: unsupported type %s", t)
+	}
+}
+
+func addAvroFields(record *avroSchema, t reflect.Type, records map[reflect.Type]*avroSchema) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := addAvroFields(record, field.Type, records); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema, err := avroTypeSchema(field.Type, records)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+		record.Fields = append(record.Fields, &avroField{
+			Name:       name,
+			Type:       schema,
+			Default:    avroZero(schema, make(map[*avroSchema]bool)),
+			HasDefault: true,
+		})
+	}
+	return nil
+}
+
+// avroZero is the default of a generated field, the value encoding/json
+// would decode when the field is missing
+func avroZero(schema *avroSchema, seen map[*avroSchema]bool) interface{} {
+	switch schema.Type {
+	case "null", "union":
+		return nil
+	case "boolean":
+		return false
+	case "int", "long", "float", "double":
+		return 0
+	case "string", "bytes":
+		return ""
+	case "array":
+		return []interface{}{}
+	case "map":
+		return map[string]interface{}{}
+	case "enum":
+		return schema.Symbols[0]
+	case "record":
+		if seen[schema] {
+			return nil
+		}
+		seen[schema] = true
+		defer delete(seen, schema)
+
+		record := make(map[string]interface{}, len(schema.Fields))
+		for _, field := range schema.Fields {
+			record[field.Name] = avroZero(field.Type, seen)
+		}
+		return record
+	default:
+		return nil
+	}
+}
+
+// String returns the schema as JSON, defining each named type on first use
+func (s *avroSchema) String() string {
+	data, _ := json.Marshal(s.jsonValue(make(map[string]bool)))
+	return string(data)
+}
+
+func (s *avroSchema) jsonValue(defined map[string]bool) interface{} {
+	switch s.Type {
+	case "union":
+		branches := make([]interface{}, len(s.Branches))
+		for i, branch := range s.Branches {
+			branches[i] = branch.jsonValue(defined)
+		}
+		return branches
+	case "record", "enum", "fixed":
+		if defined[s.Name] {
+			return s.Name
+		}
+		defined[s.Name] = true
+	}
+
+	value := map[string]interface{}{"type": s.Type}
+	if s.LogicalType != "" {
+		value["logicalType"] = s.LogicalType
+	}
+	switch s.Type {
+	case "record":
+		value["name"] = s.Name
+		fields := make([]interface{}, len(s.Fields))
+		for i, field := range s.Fields {
+			f := map[string]interface{}{"name": field.Name, "type": field.Type.jsonValue(defined)}
+			if field.HasDefault {
+				f["default"] = field.Default
+			}
+			fields[i] = f
+		}
+		value["fields"] = fields
+	case "enum":
+		value["name"] = s.Name
+		value["symbols"] = s.Symbols
+	case "fixed":
+		value["name"] = s.Name
+		value["size"] = s.Size
+	case "array":
+		value["items"] = s.Items.jsonValue(defined)
+	case "map":
+		value["values"] = s.Values.jsonValue(defined)
+	default:
+		if s.LogicalType == "" {
+			return s.Type
+		}
+	}
+	return value
+}
+
+// parseAvroSchema parses a schema fetched from the registry
+func parseAvroSchema(data string) (*avroSchema, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil, fmt.Errorf("avro: invalid schema: %w", err)
+	}
+	return parseAvroValue(value, "", make(map[string]*avroSchema))
+}
+
+func parseAvroValue(value interface{}, namespace string, named map[string]*avroSchema) (*avroSchema, error) {
+	switch v := value.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroSchema{Type: v}, nil
+		}
+		if schema, ok := named[avroFullName(v, namespace)]; ok {
+			return schema, nil
+		}
+		if schema, ok := named[v]; ok {
+			return schema, nil
+		}
+		return nil, fmt.Errorf("avro: unknown type %q", v)
+	case []interface{}:
+		union := &avroSchema{Type: "union"}
+		for _, branch := range v {
+			schema, err := parseAvroValue(branch, namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			union.Branches = append(union.Branches, schema)
+		}
+		return union, nil
+	case map[string]interface{}:
+		return parseAvroObject(v, namespace, named)
+	default:
+		return nil, fmt.Errorf("avro: invalid schema %v", value)
+	}
+}
+
+func parseAvroObject(v map[string]interface{}, namespace string, named map[string]*avroSchema) (*avroSchema, error) {
+	typeName, _ := v["type"].(string)
+	logicalType, _ := v["logicalType"].(string)
+
+	switch typeName {
+	case "record", "error", "enum", "fixed":
+		name, _ := v["name"].(string)
+		if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		fullName := avroFullName(name, namespace)
+		if i := strings.LastIndex(fullName, "."); i >= 0 {
+			namespace = fullName[:i]
+		}
+
+		schema := &avroSchema{Type: typeName, Name: fullName, LogicalType: logicalType}
+		if typeName == "error" {
+			schema.Type = "record"
+		}
+		named[fullName] = schema
+
+		switch schema.Type {
+		case "record":
+			fields, _ := v["fields"].([]interface{})
+			for _, raw := range fields {
+				f, _ := raw.(map[string]interface{})
+				fieldName, _ := f["name"].(string)
+				fieldType, err := parseAvroValue(f["type"], namespace, named)
+				if err != nil {
+					return nil, fmt.Errorf("avro: field %s.%s: %w", fullName, fieldName, err)
+				}
+				def, hasDefault := f["default"]
+				schema.Fields = append(schema.Fields, &avroField{Name: fieldName, Type: fieldType, Default: def, HasDefault: hasDefault})
+			}
+		case "enum":
+			symbols, _ := v["symbols"].([]interface{})
+			for _, symbol := range symbols {
+				s, _ := symbol.(string)
+				schema.Symbols = append(schema.Symbols, s)
+			}
+		case "fixed":
+			size, _ := v["size"].(float64)
+			schema.Size = int(size)
+		}
+		return schema, nil
+	case "array":
+		items, err := parseAvroValue(v["items"], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{Type: "array", Items: items, LogicalType: logicalType}, nil
+	case "map":
+		values, err := parseAvroValue(v["values"], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		return &avroSchema{Type: "map", Values: values, LogicalType: logicalType}, nil
+	default:
+		schema, err := parseAvroValue(v["type"], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		if logicalType != "" {
+			annotated := *schema
+			annotated.LogicalType = logicalType
+			return &annotated, nil
+		}
+		return schema, nil
+	}
+}
+
+func avroFullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// avroEncode writes a value decoded from JSON (with UseNumber) in Avro's
+// binary encoding. Missing values are written as the type's zero value, like
+// the omitempty fields they come from.
+func avroEncode(buf *bytes.Buffer, schema *avroSchema, value interface{}) error {
+	switch schema.Type {
+	case "null":
+		return nil
+	case "boolean":
+		b, _ := value.(bool)
+		if b {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		return nil
+	case "int", "long":
+		n, err := avroLong(schema, value)
+		if err != nil {
+			return err
+		}
+		writeAvroLong(buf, n)
+		return nil
+	case "float", "double":
+		var f float64
+		if number, ok := value.(json.Number); ok {
+			var err error
+			if f, err = number.Float64(); err != nil {
+				return fmt.Errorf("avro: invalid number %s", number)
+			}
+		}
+		if schema.Type == "float" {
+			binary.Write(buf, binary.LittleEndian, math.Float32bits(float32(f)))
+		} else {
+			binary.Write(buf, binary.LittleEndian, math.Float64bits(f))
+		}
+		return nil
+	case "string":
+		s, _ := value.(string)
+		writeAvroLong(buf, int64(len(s)))
+		buf.WriteString(s)
+		return nil
+	case "bytes", "fixed":
+		s, _ := value.(string)
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("avro: bytes are not base64: %w", err)
+		}
+		if schema.Type == "bytes" {
+			writeAvroLong(buf, int64(len(data)))
+		}
+		buf.Write(data)
+		return nil
+	case "enum":
+		s, _ := value.(string)
+		for i, symbol := range schema.Symbols {
+			if symbol == s {
+				writeAvroLong(buf, int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("avro: %q is not a symbol of %s", s, schema.Name)
+	case "array":
+		items, _ := value.([]interface{})
+		if len(items) > 0 {
+			writeAvroLong(buf, int64(len(items)))
+			for _, item := range items {
+				if err := avroEncode(buf, schema.Items, item); err != nil {
+					return err
+				}
+			}
+		}
+		writeAvroLong(buf, 0)
+		return nil
+	case "map":
+		entries, _ := value.(map[string]interface{})
+		if len(entries) > 0 {
+			writeAvroLong(buf, int64(len(entries)))
+			for key, entry := range entries {
+				writeAvroLong(buf, int64(len(key)))
+				buf.WriteString(key)
+				if err := avroEncode(buf, schema.Values, entry); err != nil {
+					return err
+				}
+			}
+		}
+		writeAvroLong(buf, 0)
+		return nil
+	case "record":
+		fields, _ := value.(map[string]interface{})
+		for _, field := range schema.Fields {
+			if err := avroEncode(buf, field.Type, fields[field.Name]); err != nil {
+				return fmt.Errorf("%s: %w", field.Name, err)
+			}
+		}
+		return nil
+	case "union":
+		for i, branch := range schema.Branches {
+			if (value == nil) == (branch.Type == "null") {
+				writeAvroLong(buf, int64(i))
+				return avroEncode(buf, branch, value)
+			}
+		}
+		return fmt.Errorf("avro: no union branch for %v", value)
+	default:
+		return fmt.Errorf("avro: unsupported type %s", schema.Type)
+	}
+}
+
+// avroLong converts a JSON number, or a timestamp string for timestamp
+// logical types, to a long
+func avroLong(schema *avroSchema, value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("avro: invalid number %s", v)
+		}
+		return int64(f), nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return 0, fmt.Errorf("avro: %q is not a number", v)
+		}
+		switch schema.LogicalType {
+		case "timestamp-micros":
+			if t.IsZero() {
+				return 0, nil
+			}
+			return t.UnixMicro(), nil
+		case "timestamp-millis":
+			if t.IsZero() {
+				return 0, nil
+			}
+			return t.UnixMilli(), nil
+		}
+		return 0, fmt.Errorf("avro: %q is not a number", v)
+	default:
+		return 0, fmt.Errorf("avro: %v is not a number", value)
+	}
+}
+
+func writeAvroLong(buf *bytes.Buffer, n int64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutVarint(scratch[:], n)])
+}
+
+// avroDecode reads a value written with the schema into the generic values
+// encoding/json produces, timestamps as time.Time, so it can be re-encoded
+// as JSON for the event structs
+func avroDecode(r *bytes.Reader, schema *avroSchema) (interface{}, error) {
+	switch schema.Type {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errAvroShortBuffer
+		}
+		return b != 0, nil
+	case "int", "long":
+		n, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, errAvroShortBuffer
+		}
+		switch schema.LogicalType {
+		case "timestamp-micros":
+			if n == 0 {
+				return time.Time{}, nil
+			}
+			return time.UnixMicro(n).UTC(), nil
+		case "timestamp-millis":
+			if n == 0 {
+				return time.Time{}, nil
+			}
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return n, nil
+	case "float":
+		var bits uint32
+		if err := binary.Read(r, binary.LittleEndian, &bits); err != nil {
+			return nil, errAvroShortBuffer
+		}
+		return float64(math.Float32frombits(bits)), nil
+	case "double":
+		var bits uint64
+		if err := binary.Read(r, binary.LittleEndian, &bits); err != nil {
+			return nil, errAvroShortBuffer
+		}
+		return math.Float64frombits(bits), nil
+	case "string", "bytes":
+		data, err := readAvroBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if schema.Type == "string" {
+			return string(data), nil
+		}
+		return data, nil
+	case "fixed":
+		data := make([]byte, schema.Size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, errAvroShortBuffer
+		}
+		return data, nil
+	case "enum":
+		i, err := binary.ReadVarint(r)
+		if err != nil || i < 0 || int(i) >= len(schema.Symbols) {
+			return nil, fmt.Errorf("avro: invalid symbol of %s", schema.Name)
+		}
+		return schema.Symbols[i], nil
+	case "array":
+		items := []interface{}{}
+		err := readAvroBlocks(r, func() error {
+			item, err := avroDecode(r, schema.Items)
+			items = append(items, item)
+			return err
+		})
+		return items, err
+	case "map":
+		entries := map[string]interface{}{}
+		err := readAvroBlocks(r, func() error {
+			key, err := readAvroBytes(r)
+			if err != nil {
+				return err
+			}
+			entries[string(key)], err = avroDecode(r, schema.Values)
+			return err
+		})
+		return entries, err
+	case "record":
+		record := make(map[string]interface{}, len(schema.Fields))
+		for _, field := range schema.Fields {
+			value, err := avroDecode(r, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.Name, err)
+			}
+			record[field.Name] = value
+		}
+		return record, nil
+	case "union":
+		i, err := binary.ReadVarint(r)
+		if err != nil || i < 0 || int(i) >= len(schema.Branches) {
+			return nil, errors.New("avro: invalid union branch")
+		}
+		return avroDecode(r, schema.Branches[i])
+	default:
+		return nil, fmt.Errorf("avro: unsupported type %s", schema.Type)
+	}
+}
+
+func readAvroBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadVarint(r)
+	if err != nil || n < 0 || n > int64(r.Len()) {
+		return nil, errAvroShortBuffer
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errAvroShortBuffer
+	}
+	return data, nil
+}
+
+// readAvroBlocks reads the blocks of an array or map, a negative count is
+// followed by the block's size in bytes
+func readAvroBlocks(r *bytes.Reader, item func() error) error {
+	for {
+		count, err := binary.ReadVarint(r)
+		if err != nil {
+			return errAvroShortBuffer
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			count = -count
+			if _, err := binary.ReadVarint(r); err != nil {
+				return errAvroShortBuffer
+			}
+		}
+		for ; count > 0; count-- {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
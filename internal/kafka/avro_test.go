@@ -0,0 +1,455 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteAvroLong(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{-1, []byte{0x01}},
+		{1, []byte{0x02}},
+		{-64, []byte{0x7f}},
+		{64, []byte{0x80, 0x01}},
+		{-65, []byte{0x81, 0x01}},
+		{1 << 20, []byte{0x80, 0x80, 0x80, 0x01}},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeAvroLong(&buf, tt.n)
+		if !bytes.Equal(buf.Bytes(), tt.want) {
+			t.Errorf("writeAvroLong(%d) = % x, want % x", tt.n, buf.Bytes(), tt.want)
+		}
+	}
+}
+
+// decodeJSON decodes a value the way AvroSerializer does before encoding it
+func decodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   string // when decoding doesn't give the value back
+	}{
+		{name: "boolean", schema: `"boolean"`, value: `true`},
+		{name: "long", schema: `"long"`, value: `-1234567890123`},
+		{name: "int", schema: `"int"`, value: `42`},
+		{name: "double", schema: `"double"`, value: `2.5`},
+		{name: "float", schema: `"float"`, value: `0.25`},
+		{name: "string", schema: `"string"`, value: `"héllo"`},
+		{name: "bytes", schema: `"bytes"`, value: `"AAEC/w=="`},
+		{name: "missing long", schema: `"long"`, value: `null`, want: `0`},
+		{name: "enum", schema: `{"type":"enum","name":"Color","symbols":["red","yellow"]}`, value: `"yellow"`},
+		{name: "array", schema: `{"type":"array","items":"long"}`, value: `[1,2,3]`},
+		{name: "empty array", schema: `{"type":"array","items":"long"}`, value: `[]`},
+		{name: "nested array", schema: `{"type":"array","items":{"type":"array","items":"long"}}`, value: `[[1,0],[],[2]]`},
+		{name: "map", schema: `{"type":"map","values":"string"}`, value: `{"a":"x","b":"y"}`},
+		{name: "null branch", schema: `["null","string"]`, value: `null`},
+		{name: "value branch", schema: `["null","string"]`, value: `"x"`},
+		{
+			name:   "timestamp",
+			schema: `{"type":"long","logicalType":"timestamp-micros"}`,
+			value:  `"2024-03-01T12:30:00.123456Z"`,
+		},
+		{
+			name:   "zero timestamp",
+			schema: `{"type":"long","logicalType":"timestamp-micros"}`,
+			value:  `"0001-01-01T00:00:00Z"`,
+		},
+		{
+			name:   "record",
+			schema: `{"type":"record","name":"Move","namespace":"test","fields":[{"name":"column","type":"long"},{"name":"player","type":["null",{"type":"record","name":"Player","fields":[{"name":"name","type":"string"}]}]},{"name":"next","type":["null","Player"]}]}`,
+			value:  `{"column":3,"player":{"name":"red"},"next":null}`,
+		},
+		{
+			name:   "record with missing fields",
+			schema: `{"type":"record","name":"Move","fields":[{"name":"column","type":"long"},{"name":"tags","type":{"type":"array","items":"string"}}]}`,
+			value:  `{}`,
+			want:   `{"column":0,"tags":[]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := parseAvroSchema(tt.schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := avroEncode(&buf, schema, decodeJSON(t, tt.value)); err != nil {
+				t.Fatal(err)
+			}
+			r := bytes.NewReader(buf.Bytes())
+			decoded, err := avroDecode(r, schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Len() != 0 {
+				t.Errorf("%d bytes left after decoding", r.Len())
+			}
+
+			got, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.value
+			}
+			if string(got) != string(mustMarshal(t, decodeJSON(t, want))) {
+				t.Errorf("round trip = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, value interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAvroEncodeRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+	}{
+		{"string as long", `"long"`, `"three"`},
+		{"unknown symbol", `{"type":"enum","name":"Color","symbols":["red"]}`, `"blue"`},
+		{"bytes not base64", `"bytes"`, `"not base64!"`},
+		{"null for non-null union", `["string","long"]`, `null`},
+	}
+
+	for _, tt := range tests {
+		schema, err := parseAvroSchema(tt.schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := avroEncode(&bytes.Buffer{}, schema, decodeJSON(t, tt.value)); err == nil {
+			t.Errorf("%s: encoded %s", tt.name, tt.value)
+		}
+	}
+}
+
+func TestAvroDecodeShortBuffer(t *testing.T) {
+	schema, err := parseAvroSchema(`{"type":"record","name":"Move","fields":[{"name":"name","type":"string"},{"name":"scores","type":{"type":"array","items":"double"}}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := avroEncode(&buf, schema, decodeJSON(t, `{"name":"red","scores":[1.5,2]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	for n := 0; n < len(data); n++ {
+		if _, err := avroDecode(bytes.NewReader(data[:n]), schema); !errors.Is(err, errAvroShortBuffer) {
+			t.Errorf("decoding %d of %d bytes: err = %v, want %v", n, len(data), err, errAvroShortBuffer)
+		}
+	}
+}
+
+func TestAvroDecodeNegativeBlockCount(t *testing.T) {
+	schema, err := parseAvroSchema(`{"type":"array","items":"long"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A block of -2 items is followed by its size in bytes
+	var buf bytes.Buffer
+	writeAvroLong(&buf, -2)
+	writeAvroLong(&buf, 2)
+	writeAvroLong(&buf, 5)
+	writeAvroLong(&buf, 7)
+	writeAvroLong(&buf, 0)
+
+	decoded, err := avroDecode(bytes.NewReader(buf.Bytes()), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{int64(5), int64(7)}; !reflect.DeepEqual(decoded, want) {
+		t.Errorf("decoded %v, want %v", decoded, want)
+	}
+}
+
+func TestAvroSchemaFor(t *testing.T) {
+	schema, err := avroSchemaFor(reflect.TypeOf(GameEndedEvent{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Name != avroNamespace+".GameEndedEvent" {
+		t.Errorf("record name = %s", schema.Name)
+	}
+
+	fields := make(map[string]*avroField)
+	for _, field := range schema.Fields {
+		fields[field.Name] = field
+		if !field.HasDefault {
+			t.Errorf("field %s has no default", field.Name)
+		}
+	}
+	// BaseEvent's fields are flattened into the record under their json names
+	for name, want := range map[string]string{
+		"event_type":       "string",
+		"timestamp":        "long",
+		"metadata":         "record",
+		"players":          "array",
+		"winner":           "union",
+		"duration_seconds": "long",
+		"final_board":      "array",
+	} {
+		field, ok := fields[name]
+		if !ok {
+			t.Errorf("no field %s", name)
+			continue
+		}
+		if field.Type.Type != want {
+			t.Errorf("field %s is %s, want %s", name, field.Type.Type, want)
+		}
+	}
+	if fields["timestamp"].Type.LogicalType != "timestamp-micros" {
+		t.Errorf("timestamp logical type = %q", fields["timestamp"].Type.LogicalType)
+	}
+	// The winner is the same record as the players, defined once
+	if winner := fields["winner"].Type.Branches[1]; winner != fields["players"].Type.Items {
+		t.Errorf("winner and players have different records")
+	}
+
+	parsed, err := parseAvroSchema(schema.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.String() != schema.String() {
+		t.Errorf("parsed schema differs:\n%s\n%s", parsed, schema)
+	}
+}
+
+func TestAvroSchemaForRejects(t *testing.T) {
+	type withIntKeys struct {
+		Counts map[int]int `json:"counts"`
+	}
+	type withChannel struct {
+		Updates chan int `json:"updates"`
+	}
+
+	for _, v := range []interface{}{withIntKeys{}, withChannel{}, struct{ A int }{}} {
+		if _, err := avroSchemaFor(reflect.TypeOf(v)); err == nil {
+			t.Errorf("generated a schema for %T", v)
+		}
+	}
+}
+
+// fakeRegistry serves the parts of the Confluent Schema Registry API the
+// serializer and decoder use
+type fakeRegistry struct {
+	mu       sync.Mutex
+	schemas  []string
+	subjects []string
+	auth     []string
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	username, password, _ := r.BasicAuth()
+	f.auth = append(f.auth, username+":"+password)
+	w.Header().Set("Content-Type", registryContentType)
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/subjects/") && strings.HasSuffix(r.URL.Path, "/versions"):
+		var request struct {
+			Schema string `json:"schema"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"error_code":42201,"message":"Invalid schema"}`)
+			return
+		}
+		f.subjects = append(f.subjects, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/subjects/"), "/versions"))
+		f.schemas = append(f.schemas, request.Schema)
+		fmt.Fprintf(w, `{"id":%d}`, len(f.schemas))
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/schemas/ids/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/schemas/ids/"))
+		if id < 1 || id > len(f.schemas) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error_code":40403,"message":"Schema not found"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"schema": f.schemas[id-1]})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestAvroSerializerRoundTrip(t *testing.T) {
+	fake := &fakeRegistry{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	registryURL := strings.Replace(server.URL, "http://", "http://key:secret@", 1)
+
+	router := TopicRouter{Default: "game-events", Routes: map[EventType]string{EventGameEnded: "game-lifecycle"}}
+	serializer, err := NewSerializer(SerializationConfig{Format: FormatAvro, SchemaRegistryURL: registryURL}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serializer.ContentType() != contentTypeAvro {
+		t.Errorf("content type = %s", serializer.ContentType())
+	}
+
+	winner := PlayerInfo{ID: "p1", Name: "red", Number: 1, Connected: true}
+	event := GameEndedEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventGameEnded,
+			SchemaVersion: 1,
+			EventID:       "e1",
+			Timestamp:     time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC),
+			GameID:        "g1",
+			Metadata:      Metadata{ServerID: "s1", Custom: map[string]string{"region": "eu"}},
+		},
+		Players:    []PlayerInfo{winner, {ID: "p2", Name: "yellow", Number: 2, IsBot: true}},
+		Winner:     &winner,
+		WinType:    "diagonal",
+		TotalMoves: 11,
+		Duration:   95,
+		EndReason:  "win",
+		FinalBoard: [][]int{{0, 1}, {2, 1}},
+	}
+
+	var values [][]byte
+	for i := 0; i < 2; i++ {
+		value, err := serializer.Serialize(EventGameEnded, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, value)
+	}
+	if len(fake.subjects) != 1 {
+		t.Fatalf("registered %d schemas, want the first event's only", len(fake.subjects))
+	}
+	if want := "game-lifecycle-" + avroNamespace + ".GameEndedEvent"; fake.subjects[0] != want {
+		t.Errorf("subject = %s, want %s", fake.subjects[0], want)
+	}
+	if fake.auth[0] != "key:secret" {
+		t.Errorf("registry credentials = %q", fake.auth[0])
+	}
+
+	value := values[0]
+	if value[0] != 0 || binary.BigEndian.Uint32(value[1:5]) != 1 {
+		t.Fatalf("wire header = % x, want magic byte 0 and schema ID 1", value[:5])
+	}
+
+	// A separate decoder has to fetch the schema from the registry
+	decoder, err := NewEventDecoder(registryURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := decoder.Decode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded GameEndedEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, event) {
+		t.Errorf("decoded %+v\nwant %+v", decoded, event)
+	}
+}
+
+func TestEventDecoder(t *testing.T) {
+	fake := &fakeRegistry{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	jsonOnly, err := NewEventDecoder("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := []byte(`{"event_type":"game_started"}`)
+	if data, err := jsonOnly.Decode(event); err != nil || !bytes.Equal(data, event) {
+		t.Errorf("JSON event decoded to %s, %v", data, err)
+	}
+	if _, err := jsonOnly.Decode([]byte{0, 0, 0, 0, 1, 2}); err == nil {
+		t.Error("decoded an Avro event without a registry")
+	}
+
+	decoder, err := NewEventDecoder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoder.Decode([]byte{0, 0, 0}); !errors.Is(err, errAvroShortBuffer) {
+		t.Errorf("truncated header: err = %v, want %v", err, errAvroShortBuffer)
+	}
+	if _, err := decoder.Decode([]byte{0, 0, 0, 0, 9, 2}); err == nil || !strings.Contains(err.Error(), "Schema not found") {
+		t.Errorf("unknown schema: err = %v", err)
+	}
+
+	if _, err := NewEventDecoder("ftp://registry"); err == nil {
+		t.Error("accepted a registry URL that isn't http")
+	}
+}
+
+func TestNewSerializer(t *testing.T) {
+	tests := []struct {
+		config  SerializationConfig
+		want    string
+		wantErr bool
+	}{
+		{config: SerializationConfig{}, want: contentTypeJSON},
+		{config: SerializationConfig{Format: FormatJSON}, want: contentTypeJSON},
+		{config: SerializationConfig{Format: FormatAvro, SchemaRegistryURL: "http://registry:8081"}, want: contentTypeAvro},
+		{config: SerializationConfig{Format: FormatAvro}, wantErr: true},
+		{config: SerializationConfig{Format: "protobuf"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		serializer, err := NewSerializer(tt.config, TopicRouter{Default: "game-events"})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewSerializer(%+v) succeeded", tt.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewSerializer(%+v): %v", tt.config, err)
+			continue
+		}
+		if serializer.ContentType() != tt.want {
+			t.Errorf("NewSerializer(%+v) content type = %s, want %s", tt.config, serializer.ContentType(), tt.want)
+		}
+	}
+}
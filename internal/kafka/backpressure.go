@@ -0,0 +1,174 @@
+package kafka
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/bus"
+)
+
+// BackpressureConfig keeps a slow or failing message bus off the game's
+// request path. Events wait in a queue of QueueSize, the oldest dropped when
+// it is full, and emission stops for BreakerCooldown once BreakerThreshold
+// publishes fail within BreakerWindow.
+type BackpressureConfig struct {
+	QueueSize        int           `json:"queue_size"`
+	BreakerThreshold int           `json:"breaker_threshold"` // 0 to never stop emitting
+	BreakerWindow    time.Duration `json:"breaker_window"`
+	BreakerCooldown  time.Duration `json:"breaker_cooldown"`
+}
+
+// DefaultBackpressureConfig returns the queue and circuit breaker limits
+func DefaultBackpressureConfig() BackpressureConfig {
+	return BackpressureConfig{
+		QueueSize:        10000,
+		BreakerThreshold: 20,
+		BreakerWindow:    10 * time.Second,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// AnalyticsStats tracks the events the analytics service queued, published
+// and dropped
+type AnalyticsStats struct {
+	EventsQueued       int64     `json:"events_queued"`
+	EventsPublished    int64     `json:"events_published"`
+	PublishErrors      int64     `json:"publish_errors"`
+	DroppedQueueFull   int64     `json:"dropped_queue_full"`
+	DroppedCircuitOpen int64     `json:"dropped_circuit_open"`
+	QueueLength        int       `json:"queue_length"`
+	CircuitOpen        bool      `json:"circuit_open"`
+	CircuitOpenedAt    time.Time `json:"circuit_opened_at"`
+	CircuitTrips       int64     `json:"circuit_trips"`
+}
+
+// eventQueue is a bounded FIFO that drops its oldest message to make room
+type eventQueue struct {
+	mu       sync.Mutex
+	messages []bus.Message
+	size     int
+	ready    chan struct{} // signalled when messages are pushed
+}
+
+func newEventQueue(size int) *eventQueue {
+	if size <= 0 {
+		size = DefaultBackpressureConfig().QueueSize
+	}
+	return &eventQueue{size: size, ready: make(chan struct{}, 1)}
+}
+
+// push appends the message, reporting whether the oldest one was dropped for it
+func (q *eventQueue) push(message bus.Message) bool {
+	q.mu.Lock()
+	dropped := len(q.messages) >= q.size
+	if dropped {
+		q.messages[0] = bus.Message{}
+		q.messages = q.messages[1:]
+	}
+	q.messages = append(q.messages, message)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// take removes and returns every queued message
+func (q *eventQueue) take() []bus.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	messages := q.messages
+	q.messages = nil
+	return messages
+}
+
+func (q *eventQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+// circuitBreaker opens after threshold failures within window. Once cooldown
+// passes it lets events through again: the next success closes it, the next
+// failure opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  []time.Time
+	openedAt  time.Time // zero while closed
+	openUntil time.Time
+	trips     int64
+}
+
+func newCircuitBreaker(config BackpressureConfig) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: config.BreakerThreshold,
+		window:    config.BreakerWindow,
+		cooldown:  config.BreakerCooldown,
+	}
+}
+
+// allow reports whether an event may be published now
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openedAt.IsZero() || !time.Now().Before(b.openUntil)
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.openedAt.IsZero() && !time.Now().Before(b.openUntil) {
+		log.Printf("Analytics circuit breaker closed, emitting events again after %v", time.Since(b.openedAt).Round(time.Second))
+		b.openedAt = time.Time{}
+		b.failures = nil
+	}
+}
+
+func (b *circuitBreaker) failure(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+
+	if !b.openedAt.IsZero() {
+		// A failure while letting events through again reopens it at once
+		if !now.Before(b.openUntil) {
+			b.openUntil = now.Add(b.cooldown)
+			log.Printf("⚠ Analytics circuit breaker reopened for %v: %v", b.cooldown, err)
+		}
+		return
+	}
+
+	recent := b.failures[:0]
+	for _, failed := range b.failures {
+		if now.Sub(failed) < b.window {
+			recent = append(recent, failed)
+		}
+	}
+	b.failures = append(recent, now)
+
+	if len(b.failures) >= b.threshold {
+		b.openedAt = now
+		b.openUntil = now.Add(b.cooldown)
+		b.trips++
+		log.Printf("⚠ Analytics circuit breaker opened after %d failures in %v, dropping events for %v: %v",
+			len(b.failures), b.window, b.cooldown, err)
+	}
+}
+
+// state returns whether the breaker is open, since when and how often it opened
+func (b *circuitBreaker) state() (bool, time.Time, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openedAt.IsZero(), b.openedAt, b.trips
+}
@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"connect-four-backend/internal/bus"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Bus is the Kafka implementation of bus.MessageBus. Publishing goes through
+// the producer, so it is asynchronous and spooled like any other event.
+type Bus struct {
+	producer *Producer
+	config   ConsumerConfig
+}
+
+// NewBus publishes with the producer and subscribes with the consumer
+// settings, its topics and group are the ones passed to Subscribe
+func NewBus(producer *Producer, config ConsumerConfig) *Bus {
+	return &Bus{producer: producer, config: config}
+}
+
+func (b *Bus) Publish(ctx context.Context, message bus.Message) error {
+	return b.producer.Publish(ctx, message)
+}
+
+// Subscribe reads the topics as a consumer group, committing each message
+// once handled. Kafka can't redeliver a single message, so a failed one is
+// logged and skipped, the Consumer dead-letters them instead.
+func (b *Bus) Subscribe(ctx context.Context, group string, topics []string, handler bus.Handler) error {
+	dialer, err := b.config.Security.Dialer()
+	if err != nil {
+		return err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Dialer:      dialer,
+		Brokers:     b.config.Brokers,
+		GroupID:     group,
+		GroupTopics: topics,
+		MinBytes:    b.config.MinBytes,
+		MaxBytes:    b.config.MaxBytes,
+		MaxWait:     b.config.MaxWait,
+		StartOffset: b.config.StartOffset,
+		ErrorLogger: kafka.LoggerFunc(log.Printf),
+	})
+	defer reader.Close()
+
+	for {
+		message, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to fetch message: %w", err)
+		}
+
+		headers := make(map[string]string, len(message.Headers))
+		for _, header := range message.Headers {
+			headers[header.Key] = string(header.Value)
+		}
+		if err := handler(ctx, bus.Message{
+			Topic:   message.Topic,
+			Key:     string(message.Key),
+			Value:   message.Value,
+			Headers: headers,
+		}); err != nil {
+			log.Printf("Kafka bus: skipping %s message %s: %v", message.Topic, string(message.Key), err)
+		}
+
+		if err := reader.CommitMessages(context.Background(), message); err != nil {
+			return fmt.Errorf("failed to commit message: %w", err)
+		}
+	}
+}
+
+func (b *Bus) Close() error {
+	return b.producer.Close()
+}
+
+// Publish sends a bus message, so the producer can stand in for any bus.Publisher
+func (p *Producer) Publish(ctx context.Context, message bus.Message) error {
+	headers := make([]kafka.Header, 0, len(message.Headers))
+	for key, value := range message.Headers {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return p.SendMessageTo(message.Topic, message.Key, message.Value, headers...)
+}
+
+// Handle processes an event delivered by a message bus
+func (ep *EventProcessor) Handle(ctx context.Context, message bus.Message) error {
+	headers := make([]kafka.Header, 0, len(message.Headers))
+	for key, value := range message.Headers {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return ep.ProcessMessage(kafka.Message{
+		Topic:   message.Topic,
+		Key:     []byte(message.Key),
+		Value:   message.Value,
+		Headers: headers,
+	})
+}
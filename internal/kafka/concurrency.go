@@ -0,0 +1,343 @@
+package kafka
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Per minute samples are kept this long
+	concurrencySeriesRetention = 24 * time.Hour
+
+	// Games and queued players not heard of for this long are dropped, their
+	// end or leave event was lost
+	concurrencyStaleAfter = 24 * time.Hour
+)
+
+// ConcurrencySample is the load during one minute. Games and Players are
+// the counts at the end of the minute, the peaks the highest within it.
+type ConcurrencySample struct {
+	Minute      time.Time `json:"minute"`
+	Games       int       `json:"games"`
+	Players     int       `json:"players"`
+	PeakGames   int       `json:"peak_games"`
+	PeakPlayers int       `json:"peak_players"`
+}
+
+// ConcurrencyPeak is the highest count seen and when
+type ConcurrencyPeak struct {
+	Value int       `json:"value"`
+	At    time.Time `json:"at"`
+}
+
+// DailyConcurrencyPeak are a day's peaks
+type DailyConcurrencyPeak struct {
+	Games   ConcurrencyPeak `json:"games"`
+	Players ConcurrencyPeak `json:"players"`
+}
+
+// ConcurrencyMetrics are the games in progress and the players online, a
+// player being online while queued or in a game they are connected to. Bots
+// don't count as players.
+type ConcurrencyMetrics struct {
+	Games       int                             `json:"games"`
+	Players     int                             `json:"players"`
+	PeakGames   ConcurrencyPeak                 `json:"peak_games"`
+	PeakPlayers ConcurrencyPeak                 `json:"peak_players"`
+	DailyPeaks  map[string]DailyConcurrencyPeak `json:"daily_peaks"` // key: "2024-01-01"
+	Series      []ConcurrencySample             `json:"series"`      // per minute for the last day, oldest first
+}
+
+// concurrencyState is what the tracker knows, kept in snapshots
+type concurrencyState struct {
+	Games       map[string]concurrentGame       `json:"games"`
+	InGame      map[string]string               `json:"in_game"` // player to their game
+	Offline     map[string]bool                 `json:"offline"` // disconnected from their game
+	Queued      map[string]time.Time            `json:"queued"`  // player to when they joined
+	Minutes     map[int64]ConcurrencySample     `json:"minutes"` // key: unix minute
+	PeakGames   ConcurrencyPeak                 `json:"peak_games"`
+	PeakPlayers ConcurrencyPeak                 `json:"peak_players"`
+	DailyPeaks  map[string]DailyConcurrencyPeak `json:"daily_peaks"`
+}
+
+type concurrentGame struct {
+	Players []string  `json:"players"`
+	Started time.Time `json:"started"`
+}
+
+// concurrencyTracker follows game starts and ends, disconnections and the
+// queue to count what is going on at once
+type concurrencyTracker struct {
+	mu    sync.Mutex
+	state concurrencyState
+}
+
+func newConcurrencyTracker() *concurrencyTracker {
+	return &concurrencyTracker{state: concurrencyState{
+		Games:      make(map[string]concurrentGame),
+		InGame:     make(map[string]string),
+		Offline:    make(map[string]bool),
+		Queued:     make(map[string]time.Time),
+		Minutes:    make(map[int64]ConcurrencySample),
+		DailyPeaks: make(map[string]DailyConcurrencyPeak),
+	}}
+}
+
+func (ct *concurrencyTracker) gameStarted(gameID string, players []PlayerInfo, at time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	game := concurrentGame{Started: at}
+	for _, player := range players {
+		if player.IsBot {
+			continue
+		}
+		game.Players = append(game.Players, player.Name)
+		ct.state.InGame[player.Name] = gameID
+		delete(ct.state.Offline, player.Name)
+		delete(ct.state.Queued, player.Name)
+	}
+	ct.state.Games[gameID] = game
+	ct.sample(at)
+}
+
+func (ct *concurrencyTracker) gameEnded(gameID string, at time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	game, exists := ct.state.Games[gameID]
+	if !exists {
+		return
+	}
+	ct.endGame(gameID, game)
+	ct.sample(at)
+}
+
+func (ct *concurrencyTracker) endGame(gameID string, game concurrentGame) {
+	delete(ct.state.Games, gameID)
+	for _, name := range game.Players {
+		// The player may have moved on to another game already
+		if ct.state.InGame[name] == gameID {
+			delete(ct.state.InGame, name)
+			delete(ct.state.Offline, name)
+		}
+	}
+}
+
+func (ct *concurrencyTracker) setOffline(name string, offline bool, at time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if _, playing := ct.state.InGame[name]; !playing {
+		return
+	}
+	if offline {
+		ct.state.Offline[name] = true
+	} else {
+		delete(ct.state.Offline, name)
+	}
+	ct.sample(at)
+}
+
+func (ct *concurrencyTracker) setQueued(players []PlayerInfo, queued bool, at time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	for _, player := range players {
+		if player.IsBot {
+			continue
+		}
+		if queued {
+			ct.state.Queued[player.Name] = at
+		} else {
+			delete(ct.state.Queued, player.Name)
+		}
+	}
+	ct.sample(at)
+}
+
+// online counts the distinct players queued or connected to their game
+func (ct *concurrencyTracker) online() int {
+	players := len(ct.state.InGame) - len(ct.state.Offline)
+	for name := range ct.state.Queued {
+		if _, playing := ct.state.InGame[name]; !playing {
+			players++
+		}
+	}
+	return players
+}
+
+// sample records the current counts in the minute and the peaks
+func (ct *concurrencyTracker) sample(at time.Time) {
+	games, players := len(ct.state.Games), ct.online()
+
+	minute := at.Truncate(time.Minute)
+	sample, exists := ct.state.Minutes[minute.Unix()]
+	if !exists {
+		sample = ConcurrencySample{Minute: minute}
+	}
+	sample.Games, sample.Players = games, players
+	if games > sample.PeakGames {
+		sample.PeakGames = games
+	}
+	if players > sample.PeakPlayers {
+		sample.PeakPlayers = players
+	}
+	ct.state.Minutes[minute.Unix()] = sample
+
+	dayKey := at.Format("2006-01-02")
+	daily := ct.state.DailyPeaks[dayKey]
+	raisePeak(&daily.Games, games, at)
+	raisePeak(&daily.Players, players, at)
+	ct.state.DailyPeaks[dayKey] = daily
+
+	raisePeak(&ct.state.PeakGames, games, at)
+	raisePeak(&ct.state.PeakPlayers, players, at)
+}
+
+func raisePeak(peak *ConcurrencyPeak, value int, at time.Time) {
+	if value > peak.Value {
+		peak.Value = value
+		peak.At = at
+	}
+}
+
+// metrics returns the counts and the per minute series, minutes without
+// events carrying the previous minute's counts
+func (ct *concurrencyTracker) metrics(now time.Time) ConcurrencyMetrics {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	metrics := ConcurrencyMetrics{
+		Games:       len(ct.state.Games),
+		Players:     ct.online(),
+		PeakGames:   ct.state.PeakGames,
+		PeakPlayers: ct.state.PeakPlayers,
+		DailyPeaks:  make(map[string]DailyConcurrencyPeak, len(ct.state.DailyPeaks)),
+	}
+	for day, peak := range ct.state.DailyPeaks {
+		metrics.DailyPeaks[day] = peak
+	}
+
+	minutes := make([]int64, 0, len(ct.state.Minutes))
+	for minute := range ct.state.Minutes {
+		minutes = append(minutes, minute)
+	}
+	if len(minutes) == 0 {
+		return metrics
+	}
+	sort.Slice(minutes, func(i, j int) bool { return minutes[i] < minutes[j] })
+
+	last := now.Truncate(time.Minute).Unix()
+	if newest := minutes[len(minutes)-1]; newest > last {
+		last = newest
+	}
+	first := minutes[0]
+	if floor := last - int64(concurrencySeriesRetention/time.Second); first < floor {
+		first = floor
+	}
+
+	var previous ConcurrencySample
+	next := 0
+	for next < len(minutes) && minutes[next] < first {
+		previous = ct.state.Minutes[minutes[next]]
+		next++
+	}
+	for minute := first; minute <= last; minute += 60 {
+		if next < len(minutes) && minutes[next] == minute {
+			previous = ct.state.Minutes[minute]
+			next++
+			metrics.Series = append(metrics.Series, previous)
+			continue
+		}
+		metrics.Series = append(metrics.Series, ConcurrencySample{
+			Minute:      time.Unix(minute, 0).In(previous.Minute.Location()),
+			Games:       previous.Games,
+			Players:     previous.Players,
+			PeakGames:   previous.Games,
+			PeakPlayers: previous.Players,
+		})
+	}
+	return metrics
+}
+
+// cleanup drops old minutes, days past the daily retention, and games and
+// queued players whose end was never heard of
+func (ct *concurrencyTracker) cleanup(now time.Time, dailyRetention time.Duration) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	cutoffMinute := now.Add(-concurrencySeriesRetention).Unix()
+	for minute := range ct.state.Minutes {
+		if minute < cutoffMinute {
+			delete(ct.state.Minutes, minute)
+		}
+	}
+
+	cutoffDay := now.Add(-dailyRetention).Format("2006-01-02")
+	for day := range ct.state.DailyPeaks {
+		if day < cutoffDay {
+			delete(ct.state.DailyPeaks, day)
+		}
+	}
+
+	stale := now.Add(-concurrencyStaleAfter)
+	for gameID, game := range ct.state.Games {
+		if game.Started.Before(stale) {
+			ct.endGame(gameID, game)
+		}
+	}
+	for name, joined := range ct.state.Queued {
+		if joined.Before(stale) {
+			delete(ct.state.Queued, name)
+		}
+	}
+}
+
+// copyState returns a copy of the tracker's state
+func (ct *concurrencyTracker) copyState() *concurrencyState {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	state := ct.state
+	state.Games = make(map[string]concurrentGame, len(ct.state.Games))
+	for gameID, game := range ct.state.Games {
+		game.Players = append([]string(nil), game.Players...)
+		state.Games[gameID] = game
+	}
+	state.InGame = make(map[string]string, len(ct.state.InGame))
+	for name, gameID := range ct.state.InGame {
+		state.InGame[name] = gameID
+	}
+	state.Offline = make(map[string]bool, len(ct.state.Offline))
+	for name := range ct.state.Offline {
+		state.Offline[name] = true
+	}
+	state.Queued = make(map[string]time.Time, len(ct.state.Queued))
+	for name, joined := range ct.state.Queued {
+		state.Queued[name] = joined
+	}
+	state.Minutes = make(map[int64]ConcurrencySample, len(ct.state.Minutes))
+	for minute, sample := range ct.state.Minutes {
+		state.Minutes[minute] = sample
+	}
+	state.DailyPeaks = make(map[string]DailyConcurrencyPeak, len(ct.state.DailyPeaks))
+	for day, peak := range ct.state.DailyPeaks {
+		state.DailyPeaks[day] = peak
+	}
+	return &state
+}
+
+func (ct *concurrencyTracker) restore(state *concurrencyState) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.state = *state
+	ct.state.Games = orEmpty(state.Games)
+	ct.state.InGame = orEmpty(state.InGame)
+	ct.state.Offline = orEmpty(state.Offline)
+	ct.state.Queued = orEmpty(state.Queued)
+	ct.state.Minutes = orEmpty(state.Minutes)
+	ct.state.DailyPeaks = orEmpty(state.DailyPeaks)
+}
@@ -4,68 +4,198 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"connect-four-backend/internal/database"
+	"connect-four-backend/internal/metrics"
+	"connect-four-backend/internal/tracing"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/segmentio/kafka-go"
 )
 
 // Consumer handles Kafka message consumption and analytics processing
 type Consumer struct {
 	reader      *kafka.Reader
+	lag         *lagMonitor // nil without a consumer group, the reader knows its lag then
+	topics      []string
+	config      ConsumerConfig
 	processor   *EventProcessor
+	deadLetters *DeadLetterQueue // nil when failed messages are only logged
+	archiver    *Archiver        // nil when events aren't archived
+	alerts      *alertEngine     // nil without alert rules
 	stopChan    chan struct{}
+
+	// With snapshots, the offsets processed and the last message of every
+	// partition processed since the last snapshot, to be committed with the
+	// next. Only the processing goroutine uses them.
+	offsets      snapshotOffsets // nil without snapshots
+	uncommitted  map[topicPartition]kafka.Message
+	lastSnapshot time.Time
+
 	wg          sync.WaitGroup
 	isRunning   bool
 	mu          sync.RWMutex
 	stats       ConsumerStats
+	latency     prometheus.Histogram // time to process each message
 }
 
 // ConsumerStats tracks consumer performance metrics
 type ConsumerStats struct {
-	MessagesProcessed int64     `json:"messages_processed"`
-	MessagesErrored   int64     `json:"messages_errored"`
-	LastMessageTime   time.Time `json:"last_message_time"`
-	LastErrorTime     time.Time `json:"last_error_time"`
-	LastError         string    `json:"last_error"`
-	StartTime         time.Time `json:"start_time"`
-	Uptime            time.Duration `json:"uptime"`
+	MessagesProcessed    int64         `json:"messages_processed"`
+	MessagesErrored      int64         `json:"messages_errored"`
+	MessagesDeadLettered int64         `json:"messages_dead_lettered"`
+	BatchesCommitted     int64         `json:"batches_committed"`
+	LastMessageTime      time.Time     `json:"last_message_time"`
+	LastErrorTime        time.Time     `json:"last_error_time"`
+	LastError            string        `json:"last_error"`
+	StartTime            time.Time     `json:"start_time"`
+	Uptime               time.Duration `json:"uptime"`
+
+	// Offsets and lag as of LagCheckedAt. LagExceeded is set while the total
+	// lag is above the configured warning threshold.
+	Partitions   []PartitionLag `json:"partitions"`
+	TotalLag     int64          `json:"total_lag"`
+	LagCheckedAt time.Time      `json:"lag_checked_at"`
+	LagExceeded  bool           `json:"lag_exceeded"`
+
+	// Archive is set when the raw events are archived
+	Archive *ArchiverStats `json:"archive,omitempty"`
+
+	// With snapshots, when the last one was written and the messages skipped
+	// after a restart because the restored snapshot already held them
+	LastSnapshotTime time.Time `json:"last_snapshot_time"`
+	MessagesSkipped  int64     `json:"messages_skipped"`
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
 }
 
 // ConsumerConfig holds configuration for the Kafka consumer
 type ConsumerConfig struct {
 	Brokers       []string      `json:"brokers"`
 	Topic         string        `json:"topic"`
+	Topics        []string      `json:"topics"` // to read several topics, Topic is used when empty
 	GroupID       string        `json:"group_id"`
 	MinBytes      int           `json:"min_bytes"`
 	MaxBytes      int           `json:"max_bytes"`
 	MaxWait       time.Duration `json:"max_wait"`
 	StartOffset   int64         `json:"start_offset"`
 	CommitInterval time.Duration `json:"commit_interval"`
+
+	// Messages are fetched in batches of up to BatchSize, waiting at most
+	// BatchTimeout to fill one, and processed by Workers goroutines. A game's
+	// events are keyed by its ID, so on each topic they share a partition and
+	// reach the same worker in order. Events routed to different topics are
+	// fetched in no set order. Offsets are committed once the whole batch is
+	// processed.
+	BatchSize    int           `json:"batch_size"`
+	BatchTimeout time.Duration `json:"batch_timeout"`
+	Workers      int           `json:"workers"`
+
+	// Recently processed event IDs kept in memory to skip redelivered events,
+	// the database catches older ones until they are DedupRetention old
+	DedupCacheSize int           `json:"dedup_cache_size"`
+	DedupRetention time.Duration `json:"dedup_retention"`
+
+	// How often offsets and lag are read from the brokers, and the total lag
+	// above which the consumer reports itself degraded, 0 to never
+	LagCheckInterval    time.Duration `json:"lag_check_interval"`
+	LagWarningThreshold int64         `json:"lag_warning_threshold"`
+
+	// How often the aggregates and player stats are saved to the database
+	FlushInterval time.Duration `json:"flush_interval"`
+
+	// Security configures SASL and TLS, plain connections by default
+	Security SecurityConfig `json:"security"`
+
+	// Needed to read Avro events, JSON events are read without it
+	SchemaRegistryURL string `json:"schema_registry_url"`
+
+	// Messages that fail to process are forwarded here, empty to only log them
+	DeadLetterTopic string `json:"dead_letter_topic"`
+
+	// Raw events are archived before their batch is committed, when Archive.URL is set
+	Archive ArchiveConfig `json:"archive"`
+
+	// The processor's state is snapshotted when Snapshot.Path is set, offsets
+	// are then committed with every snapshot rather than every batch
+	Snapshot SnapshotConfig `json:"snapshot"`
+
+	// Buckets of the game duration and move time histograms
+	Histograms HistogramConfig `json:"histograms"`
+
+	// Thresholds past which players are flagged for cheating
+	Anomalies AnomalyConfig `json:"anomalies"`
+
+	// Win streaks and game counts announced with player_milestone events
+	Milestones MilestoneConfig `json:"milestones"`
+
+	// Retention of hours and days and the cap on players held in memory
+	Memory MemoryConfig `json:"memory"`
+
+	// Counters every instance adds to, so a consumer group reports global
+	// metrics. The database then no longer keeps this instance's aggregates.
+	SharedCounters SharedCountersConfig `json:"shared_counters"`
+
+	// Rules evaluated on the consumer's metrics and where their alerts go
+	Alerts AlertConfig `json:"alerts"`
 }
 
 // DefaultConsumerConfig returns a production-ready consumer configuration
 func DefaultConsumerConfig(brokers []string) ConsumerConfig {
 	return ConsumerConfig{
-		Brokers:        brokers,
-		Topic:          "connect-four-events",
-		GroupID:        "analytics-processor",
-		MinBytes:       10e3,  // 10KB
-		MaxBytes:       10e6,  // 10MB
-		MaxWait:        1 * time.Second,
-		StartOffset:    kafka.LastOffset,
-		CommitInterval: 1 * time.Second,
+		Brokers:             brokers,
+		Topic:               "connect-four-events",
+		GroupID:             "analytics-processor",
+		MinBytes:            10e3,  // 10KB
+		MaxBytes:            10e6,  // 10MB
+		MaxWait:             1 * time.Second,
+		StartOffset:         kafka.LastOffset,
+		CommitInterval:      1 * time.Second,
+		BatchSize:           100,
+		BatchTimeout:        500 * time.Millisecond,
+		Workers:             8,
+		DedupCacheSize:      100000,
+		DedupRetention:      7 * 24 * time.Hour,
+		LagCheckInterval:    30 * time.Second,
+		LagWarningThreshold: 10000,
+		FlushInterval:       5 * time.Minute,
+		DeadLetterTopic:     "connect-four-events-dlq",
+		Archive:             DefaultArchiveConfig(),
+		Snapshot:            DefaultSnapshotConfig(),
+		Histograms:          DefaultHistogramConfig(),
+		Anomalies:           DefaultAnomalyConfig(),
+		Milestones:          DefaultMilestoneConfig(),
+		Memory:              DefaultMemoryConfig(),
+		SharedCounters:      DefaultSharedCountersConfig(),
+		Alerts:              DefaultAlertConfig(),
 	}
 }
 
 // NewConsumer creates a new Kafka consumer with analytics processing
-func NewConsumer(config ConsumerConfig, repo *database.Repository) (*Consumer, error) {
-	reader := kafka.NewReader(kafka.ReaderConfig{
+func NewConsumer(config ConsumerConfig, repo database.Store) (*Consumer, error) {
+	topics := config.Topics
+	if len(topics) == 0 {
+		topics = []string{config.Topic}
+	}
+
+	dialer, err := config.Security.Dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	readerConfig := kafka.ReaderConfig{
+		Dialer:         dialer,
 		Brokers:        config.Brokers,
-		Topic:          config.Topic,
 		GroupID:        config.GroupID,
 		MinBytes:       config.MinBytes,
 		MaxBytes:       config.MaxBytes,
@@ -73,25 +203,145 @@ func NewConsumer(config ConsumerConfig, repo *database.Repository) (*Consumer, e
 		StartOffset:    config.StartOffset,
 		CommitInterval: config.CommitInterval,
 		ErrorLogger:    kafka.LoggerFunc(log.Printf),
-	})
+	}
+	if len(topics) == 1 {
+		readerConfig.Topic = topics[0]
+	} else {
+		// Only a consumer group can read several topics
+		if config.GroupID == "" {
+			return nil, fmt.Errorf("reading topics %s needs a consumer group", strings.Join(topics, ", "))
+		}
+		readerConfig.GroupTopics = topics
+	}
+	reader := kafka.NewReader(readerConfig)
 
-	processor, err := NewEventProcessor(repo)
+	processor, err := NewConfiguredEventProcessor(config, repo)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create event processor: %w", err)
+		return nil, err
+	}
+
+	var lag *lagMonitor
+	if config.GroupID != "" {
+		if lag, err = newLagMonitor(config, topics); err != nil {
+			return nil, err
+		}
 	}
 
 	consumer := &Consumer{
 		reader:    reader,
+		lag:       lag,
+		topics:    topics,
+		config:    config,
 		processor: processor,
 		stopChan:  make(chan struct{}),
 		stats: ConsumerStats{
 			StartTime: time.Now(),
 		},
+		latency: metrics.NewHistogram("connect_four_consumer_processing_seconds", "Time to process a message", metrics.DefaultLatencyBuckets),
+	}
+	if config.DeadLetterTopic != "" {
+		consumer.deadLetters, err = NewDeadLetterQueue(config.Brokers, config.DeadLetterTopic, config.Security)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Archive.URL != "" {
+		consumer.archiver, err = NewArchiver(config.Archive)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(config.Alerts.Rules) > 0 && config.Alerts.Interval > 0 {
+		consumer.alerts = newAlertEngine(config.Alerts)
+	}
+	if config.Snapshot.Path != "" {
+		if err := consumer.restoreSnapshot(); err != nil {
+			return nil, err
+		}
 	}
 
 	return consumer, nil
 }
 
+// restoreSnapshot carries on from the last snapshot, if there is one
+func (c *Consumer) restoreSnapshot() error {
+	c.offsets = make(snapshotOffsets)
+	c.uncommitted = make(map[topicPartition]kafka.Message)
+	c.lastSnapshot = time.Now()
+
+	snapshot, err := readSnapshot(c.config.Snapshot.Path)
+	if err != nil || snapshot == nil {
+		return err
+	}
+
+	c.processor.restore(snapshot)
+	c.offsets = snapshot.Offsets
+
+	// Events processed after the snapshot are read again and have to count again
+	if c.processor.dedup != nil {
+		if _, err := c.processor.dedup.ForgetAfter(snapshot.TakenAt); err != nil {
+			return fmt.Errorf("failed to forget events processed after the snapshot: %w", err)
+		}
+	}
+
+	log.Printf("Restored snapshot of %s, taken %s", c.config.Snapshot.Path, snapshot.TakenAt.Format(time.RFC3339))
+	return nil
+}
+
+// NewConfiguredEventProcessor creates a processor decoding and deduplicating
+// events as the consumer config says, for reading events off another bus
+func NewConfiguredEventProcessor(config ConsumerConfig, repo database.Store) (*EventProcessor, error) {
+	memory := config.Memory
+	if memory == (MemoryConfig{}) {
+		memory = DefaultMemoryConfig()
+	}
+	counters, err := OpenCounterStore(config.SharedCounters, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shared counters: %w", err)
+	}
+	// Each instance saving its own aggregates would overwrite the others'
+	var aggregates AggregateStore
+	if repo != nil && counters == nil {
+		aggregates = repo
+	}
+	processor, err := newEventProcessor(repo, aggregates, memory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event processor: %w", err)
+	}
+	if config.FlushInterval > 0 {
+		processor.flushInterval = config.FlushInterval
+	}
+	if counters != nil {
+		processor.aggregator.SetCounterStore(counters)
+		processor.counterInterval = config.SharedCounters.Interval
+	}
+
+	decoder, err := NewEventDecoder(config.SchemaRegistryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event decoder: %w", err)
+	}
+	processor.decoder = decoder
+
+	var store ProcessedEventStore
+	if repo != nil {
+		store = repo
+	}
+	processor.dedup = NewEventDeduplicator(store, config.DedupCacheSize)
+	processor.dedupRetention = config.DedupRetention
+
+	if len(config.Histograms.GameDurationBuckets) > 0 && len(config.Histograms.MoveTimeBuckets) > 0 {
+		processor.aggregator.SetHistogramBuckets(config.Histograms)
+	}
+	if config.Anomalies != (AnomalyConfig{}) {
+		processor.anomalies.SetConfig(config.Anomalies)
+	}
+	if len(config.Milestones.WinStreaks) > 0 || len(config.Milestones.Games) > 0 {
+		processor.aggregator.SetMilestones(config.Milestones)
+	}
+
+	return processor, nil
+}
+
 // Start begins consuming messages from Kafka
 func (c *Consumer) Start(ctx context.Context) error {
 	c.mu.Lock()
@@ -102,7 +352,7 @@ func (c *Consumer) Start(ctx context.Context) error {
 	c.isRunning = true
 	c.mu.Unlock()
 
-	log.Printf("Starting Kafka consumer for topic: %s", c.reader.Config().Topic)
+	log.Printf("Starting Kafka consumer for topics: %s", strings.Join(c.topics, ", "))
 
 	// Start message processing goroutine
 	c.wg.Add(1)
@@ -112,9 +362,19 @@ func (c *Consumer) Start(ctx context.Context) error {
 	c.wg.Add(1)
 	go c.processor.StartAggregation(ctx, &c.wg)
 
-	// Start periodic statistics reporting
-	c.wg.Add(1)
-	go c.reportStatistics(ctx)
+	if c.config.LagCheckInterval > 0 {
+		c.wg.Add(1)
+		go c.monitorLag(ctx)
+	}
+
+	if c.alerts != nil {
+		c.wg.Add(1)
+		go c.evaluateAlerts(ctx)
+	}
+
+	if c.archiver != nil {
+		c.archiver.Start()
+	}
 
 	return nil
 }
@@ -137,11 +397,27 @@ func (c *Consumer) Stop() error {
 	// Wait for all goroutines to finish
 	c.wg.Wait()
 
+	if c.lag != nil {
+		c.lag.close()
+	}
+
 	// Close reader
 	if err := c.reader.Close(); err != nil {
 		return fmt.Errorf("failed to close reader: %w", err)
 	}
 
+	if c.deadLetters != nil {
+		if err := c.deadLetters.Close(); err != nil {
+			log.Printf("Failed to close dead letter queue: %v", err)
+		}
+	}
+
+	if c.archiver != nil {
+		if err := c.archiver.Close(context.Background()); err != nil {
+			log.Printf("Failed to archive events: %v", err)
+		}
+	}
+
 	// Stop processor
 	if err := c.processor.Stop(); err != nil {
 		return fmt.Errorf("failed to stop processor: %w", err)
@@ -158,61 +434,373 @@ func (c *Consumer) GetStats() ConsumerStats {
 	
 	stats := c.stats
 	stats.Uptime = time.Since(stats.StartTime)
+	if c.archiver != nil {
+		archive := c.archiver.GetStats()
+		stats.Archive = &archive
+	}
 	return stats
 }
 
-// processMessages is the main message processing loop
+// GetQueueMetrics returns the matchmaking queue metrics aggregated so far
+func (c *Consumer) GetQueueMetrics() QueueSnapshot {
+	return c.processor.GetQueueMetrics()
+}
+
+// GetColumnMetrics returns the column and board heatmaps aggregated so far
+func (c *Consumer) GetColumnMetrics() ColumnMetrics {
+	return c.processor.GetColumnMetrics()
+}
+
+// GetOpeningMetrics returns the win rates by opening column and starting color
+func (c *Consumer) GetOpeningMetrics() OpeningMetrics {
+	return c.processor.GetOpeningMetrics()
+}
+
+// GetRetentionMetrics returns the players' retention cohorts
+func (c *Consumer) GetRetentionMetrics() RetentionMetrics {
+	return c.processor.GetRetentionMetrics()
+}
+
+// GetConcurrencyMetrics returns the concurrent games and online players over time
+func (c *Consumer) GetConcurrencyMetrics() ConcurrencyMetrics {
+	return c.processor.GetConcurrencyMetrics()
+}
+
+// GetDistributions returns the game duration and move time histograms
+func (c *Consumer) GetDistributions() Distributions {
+	return c.processor.GetDistributions()
+}
+
+// GetAlerts returns the alerts firing and how every rule last evaluated
+func (c *Consumer) GetAlerts() AlertStatus {
+	if c.alerts == nil {
+		return AlertStatus{Active: []Alert{}, Rules: []AlertRuleState{}}
+	}
+	return c.alerts.status()
+}
+
+// GetPlayerFlags returns the players flagged for cheating with the status, every one for an empty status
+func (c *Consumer) GetPlayerFlags(status string) []PlayerFlag {
+	return c.processor.GetPlayerFlags(status)
+}
+
+// ReviewPlayerFlag records a moderator's decision on a flag
+func (c *Consumer) ReviewPlayerFlag(id, status, note string) (PlayerFlag, error) {
+	return c.processor.ReviewPlayerFlag(id, status, note)
+}
+
+// SetFlagPublisher emits a player_flagged event whenever a player is flagged
+func (c *Consumer) SetFlagPublisher(publisher FlagPublisher) {
+	c.processor.anomalies.SetPublisher(publisher)
+}
+
+// GetStreakLeaderboard returns the players on the longest win streaks
+func (c *Consumer) GetStreakLeaderboard(limit int) StreakLeaderboard {
+	return c.processor.GetStreakLeaderboard(limit)
+}
+
+// GetMemoryStats returns how much the processor holds in memory
+func (c *Consumer) GetMemoryStats() MemoryStats {
+	return c.processor.GetMemoryStats()
+}
+
+// GetGlobalMetrics returns the counts of every consumer instance sharing the counters
+func (c *Consumer) GetGlobalMetrics() (GlobalMetrics, error) {
+	return c.processor.GetGlobalMetrics()
+}
+
+// SetMilestonePublisher emits a player_milestone event whenever a player reaches a milestone
+func (c *Consumer) SetMilestonePublisher(publisher MilestonePublisher) {
+	c.processor.aggregator.SetMilestonePublisher(publisher)
+}
+
+// processMessages is the main message processing loop. It fetches a batch,
+// processes it on the worker pool and commits it, so a message is only
+// committed once it was processed or dead-lettered. With snapshots, batches
+// are committed once a snapshot holds them, and a last snapshot is taken when
+// stopping.
 func (c *Consumer) processMessages(ctx context.Context) {
 	defer c.wg.Done()
 
-	for {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
 		select {
-		case <-ctx.Done():
-			return
 		case <-c.stopChan:
-			return
-		default:
-			// Read message with timeout
-			message, err := c.reader.ReadMessage(ctx)
-			if err != nil {
-				if err == context.Canceled {
-					return
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	pool := newWorkerPool(c.config.Workers, c.processMessage)
+	defer pool.stop()
+
+	for {
+		fetchCtx, cancelFetch := c.snapshotDeadline(ctx)
+		batch, err := c.fetchBatch(fetchCtx)
+		cancelFetch()
+
+		if len(batch) > 0 {
+			processed := batch
+			if c.offsets != nil {
+				processed = c.unsnapshotted(batch)
+			}
+			pool.run(processed)
+
+			if c.archiver != nil {
+				if err := c.archiver.Add(processed); err != nil {
+					log.Printf("Error archiving messages: %v", err)
 				}
-				c.updateStats(false, err)
-				log.Printf("Error reading message: %v", err)
-				continue
 			}
 
-			// Process message
-			if err := c.processor.ProcessMessage(message); err != nil {
-				c.updateStats(false, err)
-				log.Printf("Error processing message: %v", err)
+			if c.offsets != nil {
+				c.offsets.advance(batch)
+				for _, message := range batch {
+					c.uncommitted[topicPartition{message.Topic, message.Partition}] = kafka.Message{
+						Topic: message.Topic, Partition: message.Partition, Offset: message.Offset,
+					}
+				}
 			} else {
-				c.updateStats(true, nil)
+				// Not the cancelled context, the batch was processed and its offsets should be kept
+				c.commit(batch)
 			}
 		}
+
+		if c.offsets != nil && (ctx.Err() != nil || time.Since(c.lastSnapshot) >= c.config.Snapshot.Interval) {
+			c.snapshotAndCommit()
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if fetchCtx.Err() != nil {
+				continue // time for a snapshot
+			}
+			c.updateStats(false, err)
+			log.Printf("Error reading message: %v", err)
+		}
+	}
+}
+
+// snapshotDeadline bounds the wait for messages by when the next snapshot is
+// due, while processed messages wait to be committed with it
+func (c *Consumer) snapshotDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.offsets == nil || len(c.uncommitted) == 0 {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, c.lastSnapshot.Add(c.config.Snapshot.Interval))
+}
+
+// unsnapshotted drops the messages the restored snapshot already holds,
+// read again when the consumer stopped between a snapshot and its commit
+func (c *Consumer) unsnapshotted(batch []kafka.Message) []kafka.Message {
+	var messages []kafka.Message
+	for _, message := range batch {
+		if !c.offsets.covers(message) {
+			messages = append(messages, message)
+		}
 	}
+	if skipped := len(batch) - len(messages); skipped > 0 {
+		c.mu.Lock()
+		c.stats.MessagesSkipped += int64(skipped)
+		c.mu.Unlock()
+	}
+	return messages
 }
 
-// reportStatistics periodically reports consumer statistics
-func (c *Consumer) reportStatistics(ctx context.Context) {
+// snapshotAndCommit writes a snapshot and commits the messages it holds. A
+// snapshot that fails to write is retried an interval later, its messages
+// stay uncommitted until then.
+func (c *Consumer) snapshotAndCommit() {
+	c.lastSnapshot = time.Now()
+	if len(c.uncommitted) == 0 {
+		return
+	}
+
+	if err := writeSnapshot(c.config.Snapshot.Path, c.processor.snapshot(c.offsets)); err != nil {
+		c.updateStats(false, err)
+		log.Printf("Error writing snapshot: %v", err)
+		return
+	}
+	c.mu.Lock()
+	c.stats.LastSnapshotTime = c.lastSnapshot
+	c.mu.Unlock()
+
+	messages := make([]kafka.Message, 0, len(c.uncommitted))
+	for _, message := range c.uncommitted {
+		messages = append(messages, message)
+	}
+	c.uncommitted = make(map[topicPartition]kafka.Message)
+	c.commit(messages)
+}
+
+// commit commits the messages' offsets
+func (c *Consumer) commit(messages []kafka.Message) {
+	if err := c.reader.CommitMessages(context.Background(), messages...); err != nil {
+		c.updateStats(false, err)
+		log.Printf("Error committing messages: %v", err)
+	} else {
+		c.mu.Lock()
+		c.stats.BatchesCommitted++
+		c.mu.Unlock()
+	}
+}
+
+// fetchBatch waits for a message, then collects more until the batch is full
+// or the batch timeout passes
+func (c *Consumer) fetchBatch(ctx context.Context) ([]kafka.Message, error) {
+	message, err := c.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	batch := []kafka.Message{message}
+
+	batchCtx, cancel := context.WithTimeout(ctx, c.config.BatchTimeout)
+	defer cancel()
+
+	for len(batch) < c.config.BatchSize {
+		message, err := c.reader.FetchMessage(batchCtx)
+		if err != nil {
+			if batchCtx.Err() != nil && ctx.Err() == nil {
+				break // batch timeout
+			}
+			return batch, err
+		}
+		batch = append(batch, message)
+	}
+
+	return batch, nil
+}
+
+// processMessage processes one message, dead-lettering it when it fails
+func (c *Consumer) processMessage(message kafka.Message) {
+	start := time.Now()
+	err := c.processor.ProcessMessage(message)
+	c.latency.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		c.updateStats(false, err)
+		log.Printf("Error processing message: %v", err)
+
+		// The message is committed with its batch, so it's forwarded even while stopping
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		c.deadLetter(ctx, message, err)
+		cancel()
+	} else {
+		c.updateStats(true, nil)
+	}
+}
+
+// deadLetter keeps a message that failed to process so it can be replayed
+func (c *Consumer) deadLetter(ctx context.Context, message kafka.Message, cause error) {
+	if c.deadLetters == nil {
+		return
+	}
+
+	if err := c.deadLetters.Forward(ctx, message, cause); err != nil {
+		log.Printf("Dropping message %s@%d: %v", message.Topic, message.Offset, err)
+		return
+	}
+
+	c.mu.Lock()
+	c.stats.MessagesDeadLettered++
+	c.mu.Unlock()
+}
+
+// monitorLag periodically reads the offsets and lag of the consumer's partitions
+func (c *Consumer) monitorLag(ctx context.Context) {
 	defer c.wg.Done()
 
-	ticker := time.NewTicker(60 * time.Second) // Report every minute
+	ticker := time.NewTicker(c.config.LagCheckInterval)
 	defer ticker.Stop()
 
 	for {
+		c.checkLag(ctx)
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-c.stopChan:
 			return
 		case <-ticker.C:
-			c.logStatistics()
 		}
 	}
 }
 
+// evaluateAlerts evaluates the alert rules every interval and sends the
+// alerts that fired or resolved
+func (c *Consumer) evaluateAlerts(ctx context.Context) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.config.Alerts.Interval)
+	defer ticker.Stop()
+
+	for {
+		stats := c.GetStats()
+		sample := alertSample{
+			at:           time.Now(),
+			processed:    stats.MessagesProcessed,
+			errored:      stats.MessagesErrored,
+			deadLettered: stats.MessagesDeadLettered,
+			gamesStarted: c.processor.GetGameSummary().TotalGames,
+			lag:          stats.TotalLag,
+			activeGames:  c.processor.GetLiveMetrics().ActiveGames,
+		}
+		c.alerts.notify(ctx, c.alerts.evaluate(sample))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Consumer) checkLag(ctx context.Context) {
+	var partitions []PartitionLag
+	if c.lag != nil {
+		checkCtx, cancel := context.WithTimeout(ctx, c.config.LagCheckInterval)
+		defer cancel()
+
+		var err error
+		if partitions, err = c.lag.check(checkCtx); err != nil {
+			log.Printf("Failed to check consumer lag: %v", err)
+			return
+		}
+	} else {
+		stats := c.reader.Stats()
+		partition, _ := strconv.Atoi(stats.Partition)
+		partitions = []PartitionLag{{
+			Topic:           stats.Topic,
+			Partition:       partition,
+			CurrentOffset:   stats.Offset + stats.Lag,
+			CommittedOffset: stats.Offset,
+			Lag:             stats.Lag,
+		}}
+	}
+
+	var total int64
+	for _, partition := range partitions {
+		total += partition.Lag
+	}
+	exceeded := c.config.LagWarningThreshold > 0 && total > c.config.LagWarningThreshold
+
+	c.mu.Lock()
+	if exceeded && !c.stats.LagExceeded {
+		log.Printf("⚠ Consumer lag %d is above the warning threshold %d", total, c.config.LagWarningThreshold)
+	} else if !exceeded && c.stats.LagExceeded {
+		log.Printf("Consumer lag %d is back under the warning threshold %d", total, c.config.LagWarningThreshold)
+	}
+	c.stats.Partitions = partitions
+	c.stats.TotalLag = total
+	c.stats.LagCheckedAt = time.Now()
+	c.stats.LagExceeded = exceeded
+	c.mu.Unlock()
+}
+
 // updateStats updates consumer statistics
 func (c *Consumer) updateStats(success bool, err error) {
 	c.mu.Lock()
@@ -230,39 +818,20 @@ func (c *Consumer) updateStats(success bool, err error) {
 	}
 }
 
-// logStatistics logs current consumer statistics
-func (c *Consumer) logStatistics() {
-	stats := c.GetStats()
-	
-	log.Printf("=== Consumer Statistics ===")
-	log.Printf("Uptime: %v", stats.Uptime.Round(time.Second))
-	log.Printf("Messages Processed: %d", stats.MessagesProcessed)
-	log.Printf("Messages Errored: %d", stats.MessagesErrored)
-	
-	if stats.MessagesProcessed > 0 {
-		rate := float64(stats.MessagesProcessed) / stats.Uptime.Seconds()
-		log.Printf("Processing Rate: %.2f messages/sec", rate)
-	}
-	
-	if stats.LastError != "" {
-		log.Printf("Last Error: %s (at %v)", stats.LastError, stats.LastErrorTime)
-	}
-
-	// Get processor statistics
-	processorStats := c.processor.GetStats()
-	log.Printf("Active Games: %d", processorStats.ActiveGames)
-	log.Printf("Total Players: %d", processorStats.TotalPlayers)
-	log.Printf("Games Completed Today: %d", processorStats.GamesToday)
-	log.Printf("===========================")
-}
-
 // EventProcessor handles the processing and aggregation of game events
 type EventProcessor struct {
-	repo            *database.Repository
+	repo            database.Store
 	aggregator      *MetricsAggregator
 	gameTracker     *GameTracker
 	playerTracker   *PlayerTracker
 	hourlyTracker   *HourlyTracker
+	anomalies       *AnomalyDetector
+	decoder         *EventDecoder
+	dedup           *EventDeduplicator // nil to process every delivery
+	dedupRetention  time.Duration
+	counterInterval time.Duration // how often shared counters are pushed, 0 when not shared
+	flushInterval   time.Duration // how often the aggregates are saved
+	duplicates      int64
 	mu              sync.RWMutex
 	stopChan        chan struct{}
 	isRunning       bool
@@ -270,26 +839,45 @@ type EventProcessor struct {
 
 // ProcessorStats tracks event processor statistics
 type ProcessorStats struct {
-	ActiveGames   int `json:"active_games"`
-	TotalPlayers  int `json:"total_players"`
-	GamesToday    int `json:"games_today"`
-	GamesThisHour int `json:"games_this_hour"`
+	ActiveGames       int   `json:"active_games"`
+	TotalPlayers      int   `json:"total_players"`
+	GamesToday        int   `json:"games_today"`
+	GamesThisHour     int   `json:"games_this_hour"`
+	DuplicatesSkipped int64 `json:"duplicates_skipped"`
 }
 
 // NewEventProcessor creates a new event processor
-func NewEventProcessor(repo *database.Repository) (*EventProcessor, error) {
-	aggregator, err := NewMetricsAggregator(repo)
+func NewEventProcessor(repo database.Store) (*EventProcessor, error) {
+	var aggregates AggregateStore
+	if repo != nil {
+		aggregates = repo
+	}
+	return newEventProcessor(repo, aggregates, DefaultMemoryConfig())
+}
+
+// newEventProcessor creates an event processor saving its aggregates to the
+// store and keeping what the memory config says in memory
+func newEventProcessor(repo database.Store, aggregates AggregateStore, memory MemoryConfig) (*EventProcessor, error) {
+	aggregator, err := newMetricsAggregator(repo, aggregates, memory)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create metrics aggregator: %w", err)
 	}
 
+	anomalies, err := NewAnomalyDetector(DefaultAnomalyConfig(), repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anomaly detector: %w", err)
+	}
+
 	return &EventProcessor{
 		repo:          repo,
 		aggregator:    aggregator,
 		gameTracker:   NewGameTracker(),
 		playerTracker: NewPlayerTracker(),
 		hourlyTracker: NewHourlyTracker(),
+		anomalies:     anomalies,
+		decoder:       &EventDecoder{},
 		stopChan:      make(chan struct{}),
+		flushInterval: 5 * time.Minute,
 	}, nil
 }
 
@@ -301,20 +889,38 @@ func (ep *EventProcessor) StartAggregation(ctx context.Context, wg *sync.WaitGro
 	ep.isRunning = true
 	ep.mu.Unlock()
 
-	// Start aggregation ticker (every 5 minutes)
-	ticker := time.NewTicker(5 * time.Minute)
+	// Start aggregation ticker
+	ticker := time.NewTicker(ep.flushInterval)
 	defer ticker.Stop()
 
+	// Shared counters are pushed more often, so global metrics stay fresh
+	var pushes <-chan time.Time
+	if ep.counterInterval > 0 {
+		pushTicker := time.NewTicker(ep.counterInterval)
+		defer pushTicker.Stop()
+		pushes = pushTicker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ep.stopChan:
 			return
+		case <-pushes:
+			if err := ep.aggregator.PushCounters(); err != nil {
+				log.Printf("Error pushing shared counters: %v", err)
+			}
 		case <-ticker.C:
 			if err := ep.aggregator.AggregateMetrics(); err != nil {
 				log.Printf("Error aggregating metrics: %v", err)
 			}
+			ep.cleanupTrackers()
+			if ep.dedup != nil && ep.dedupRetention > 0 {
+				if _, err := ep.dedup.Prune(time.Now().Add(-ep.dedupRetention)); err != nil {
+					log.Printf("Error pruning processed events: %v", err)
+				}
+			}
 		}
 	}
 }
@@ -338,26 +944,107 @@ func (ep *EventProcessor) ProcessMessage(message kafka.Message) error {
 	// Log the raw event
 	log.Printf("Processing event: %s", string(message.Key))
 
+	// Tombstones only tell compaction to drop their key's earlier events
+	if len(message.Value) == 0 {
+		return nil
+	}
+
+	// Avro events are turned into the same JSON the processors read
+	data, err := ep.decoder.Decode(message.Value)
+	if err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+
 	// Parse base event to determine type
 	var baseEvent BaseEvent
-	if err := json.Unmarshal(message.Value, &baseEvent); err != nil {
+	if err := json.Unmarshal(data, &baseEvent); err != nil {
 		return fmt.Errorf("failed to parse base event: %w", err)
 	}
 
-	// Process based on event type
-	switch baseEvent.EventType {
+	// Continue the trace of the publisher, or of whatever emitted the event
+	// when the bus dropped the headers
+	traceParent := baseEvent.Metadata.TraceParent
+	for _, header := range message.Headers {
+		if header.Key == traceParentHeader {
+			traceParent = string(header.Value)
+		}
+	}
+	_, span := tracing.Start(tracing.ContextWithRemoteParent(context.Background(), traceParent),
+		"process "+string(baseEvent.EventType), tracing.KindConsumer,
+		tracing.String("messaging.destination.name", message.Topic),
+		tracing.String("event.type", string(baseEvent.EventType)),
+		tracing.String("event.id", baseEvent.EventID),
+		tracing.String("game.id", baseEvent.GameID))
+	defer span.End()
+
+	// Events from a newer server may have changed shape, keep them for an upgraded consumer rather than misread them
+	if baseEvent.SchemaVersion > SchemaVersion(baseEvent.EventType) {
+		span.SetAttributes(tracing.Bool("event.newer_schema", true))
+		return fmt.Errorf("%w: %s event %s has version %d, this consumer reads up to %d", ErrNewerSchemaVersion,
+			baseEvent.EventType, baseEvent.EventID, baseEvent.SchemaVersion, SchemaVersion(baseEvent.EventType))
+	}
+
+	// Redelivered events would be counted twice
+	if ep.dedup != nil && baseEvent.EventID != "" {
+		seen, err := ep.dedup.Seen(baseEvent.EventID)
+		if err != nil {
+			return fmt.Errorf("failed to check event %s: %w", baseEvent.EventID, err)
+		}
+		if seen {
+			span.SetAttributes(tracing.Bool("event.duplicate", true))
+			log.Printf("Skipping duplicate %s event %s", baseEvent.EventType, baseEvent.EventID)
+			atomic.AddInt64(&ep.duplicates, 1)
+			return nil
+		}
+	}
+
+	if err := ep.processEvent(baseEvent.EventType, data); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if ep.dedup != nil && baseEvent.EventID != "" {
+		if err := ep.dedup.Mark(baseEvent.EventID, baseEvent.EventType, time.Now()); err != nil {
+			// Processed already, at worst a redelivery counts it again
+			log.Printf("Failed to mark event %s as processed: %v", baseEvent.EventID, err)
+		}
+	}
+	return nil
+}
+
+// processEvent hands the event to the processor for its type
+func (ep *EventProcessor) processEvent(eventType EventType, data []byte) error {
+	switch eventType {
 	case EventGameStarted:
-		return ep.processGameStarted(message.Value)
+		return ep.processGameStarted(data)
 	case EventMovePlayed:
-		return ep.processMovePlayed(message.Value)
+		return ep.processMovePlayed(data)
 	case EventGameEnded:
-		return ep.processGameEnded(message.Value)
+		return ep.processGameEnded(data)
 	case EventPlayerDisconnected:
-		return ep.processPlayerDisconnected(message.Value)
+		return ep.processPlayerDisconnected(data)
 	case EventPlayerReconnected:
-		return ep.processPlayerReconnected(message.Value)
+		return ep.processPlayerReconnected(data)
+	case EventGameAnalysis:
+		return ep.processGameAnalysis(data)
+	case EventMatchFound:
+		return ep.processMatchFound(data)
+	case EventPlayerJoinedQueue:
+		return ep.processQueueJoined(data)
+	case EventPlayerLeftQueue:
+		return ep.processQueueLeft(data)
+	case EventBotActivated:
+		return ep.processBotActivated(data)
+	case EventTournamentCreated, EventTournamentStarted, EventTournamentMatchFinished,
+		EventTournamentFinished, EventTournamentCancelled:
+		return ep.processTournamentEvent(data)
+	case EventPlayerFlagged, EventPlayerMilestone:
+		// Raised by this processor, nothing more to track
+		return nil
+	case EventPlayerErased:
+		return ep.processPlayerErased(data)
 	default:
-		log.Printf("Unknown event type: %s", baseEvent.EventType)
+		log.Printf("Unknown event type: %s", eventType)
 		return nil
 	}
 }
@@ -368,13 +1055,90 @@ func (ep *EventProcessor) GetStats() ProcessorStats {
 	defer ep.mu.RUnlock()
 
 	return ProcessorStats{
-		ActiveGames:   ep.gameTracker.GetActiveGameCount(),
-		TotalPlayers:  ep.playerTracker.GetPlayerCount(),
-		GamesToday:    ep.hourlyTracker.GetGamesToday(),
-		GamesThisHour: ep.hourlyTracker.GetGamesThisHour(),
+		ActiveGames:       ep.gameTracker.GetActiveGameCount(),
+		TotalPlayers:      ep.playerTracker.GetPlayerCount(),
+		GamesToday:        ep.hourlyTracker.GetGamesToday(),
+		GamesThisHour:     ep.hourlyTracker.GetGamesThisHour(),
+		DuplicatesSkipped: atomic.LoadInt64(&ep.duplicates),
 	}
 }
 
+// WriteAggregates writes the aggregated game, player, hourly, daily, queue, distribution, column and opening metrics as JSON
+func (ep *EventProcessor) WriteAggregates(w io.Writer) error {
+	games := ep.aggregator.GetGameMetrics()
+	players := ep.aggregator.GetPlayerMetrics()
+	hourly := ep.aggregator.GetHourlyMetrics()
+	daily := ep.aggregator.GetDailyMetrics()
+	queues := ep.aggregator.GetQueueMetrics()
+	distributions := ep.aggregator.GetDistributions()
+	columns := ep.aggregator.GetColumnMetrics()
+	openings := ep.aggregator.GetOpeningMetrics()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Games   *GameMetrics   `json:"games"`
+		Players *PlayerMetrics `json:"players"`
+		Hourly  *HourlyMetrics `json:"hourly"`
+		Daily   *DailyMetrics  `json:"daily"`
+		Queues  *QueueSnapshot `json:"queues"`
+
+		Distributions *Distributions  `json:"distributions"`
+		Columns       *ColumnMetrics  `json:"columns"`
+		Openings      *OpeningMetrics `json:"openings"`
+	}{&games, &players, &hourly, &daily, &queues, &distributions, &columns, &openings})
+}
+
+// GetQueueMetrics returns the matchmaking queue depth and wait times by queue type
+func (ep *EventProcessor) GetQueueMetrics() QueueSnapshot {
+	return ep.aggregator.GetQueueMetrics()
+}
+
+// GetColumnMetrics returns how often each column and cell is played
+func (ep *EventProcessor) GetColumnMetrics() ColumnMetrics {
+	return ep.aggregator.GetColumnMetrics()
+}
+
+// GetOpeningMetrics returns how the player moving first fares by opening column and color
+func (ep *EventProcessor) GetOpeningMetrics() OpeningMetrics {
+	return ep.aggregator.GetOpeningMetrics()
+}
+
+// GetRetentionMetrics returns the D1, D7 and D30 return rates of each day's new players
+func (ep *EventProcessor) GetRetentionMetrics() RetentionMetrics {
+	return ep.aggregator.GetRetentionMetrics()
+}
+
+// GetConcurrencyMetrics returns the games in progress and players online, per minute and at their peaks
+func (ep *EventProcessor) GetConcurrencyMetrics() ConcurrencyMetrics {
+	return ep.aggregator.GetConcurrencyMetrics()
+}
+
+// GetDistributions returns the game duration and move time histograms with their percentiles
+func (ep *EventProcessor) GetDistributions() Distributions {
+	return ep.aggregator.GetDistributions()
+}
+
+// GetPlayerFlags returns the players flagged for cheating, newest first
+func (ep *EventProcessor) GetPlayerFlags(status string) []PlayerFlag {
+	return ep.anomalies.Flags(status)
+}
+
+// ReviewPlayerFlag sets a flag's status to dismissed, confirmed or back to open
+func (ep *EventProcessor) ReviewPlayerFlag(id, status, note string) (PlayerFlag, error) {
+	return ep.anomalies.Review(id, status, note)
+}
+
+// GetStreakLeaderboard returns the top players by current and longest win streak
+func (ep *EventProcessor) GetStreakLeaderboard(limit int) StreakLeaderboard {
+	return ep.aggregator.GetStreakLeaderboard(limit)
+}
+
+// GetGlobalMetrics returns the shared counters' totals, ErrSharedCountersDisabled when counts aren't shared
+func (ep *EventProcessor) GetGlobalMetrics() (GlobalMetrics, error) {
+	return ep.aggregator.GetGlobalMetrics()
+}
+
 // Event processing methods
 
 func (ep *EventProcessor) processGameStarted(data []byte) error {
@@ -413,6 +1177,9 @@ func (ep *EventProcessor) processMovePlayed(data []byte) error {
 	ep.gameTracker.RecordMove(event.GameID, event.Player.Name, event.Timestamp)
 	ep.playerTracker.RecordMove(event.Player.Name, event.Timestamp)
 
+	// Look for robotic move timing
+	ep.anomalies.RecordMove(event)
+
 	// Update aggregated metrics
 	return ep.aggregator.RecordMove(event)
 }
@@ -443,6 +1210,9 @@ func (ep *EventProcessor) processGameEnded(data []byte) error {
 	// Track hourly metrics
 	ep.hourlyTracker.RecordGameEnd(event.Timestamp, event.Duration)
 
+	// Look for wins arranged with one opponent
+	ep.anomalies.RecordGameEnd(event)
+
 	// Update aggregated metrics
 	return ep.aggregator.RecordGameEnd(event)
 }
@@ -478,6 +1248,114 @@ func (ep *EventProcessor) processPlayerReconnected(data []byte) error {
 	return ep.aggregator.RecordReconnection(event)
 }
 
+func (ep *EventProcessor) processGameAnalysis(data []byte) error {
+	var event GameAnalysisEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	for _, player := range event.Players {
+		log.Printf("Game Analysis: %s, Player %s, Accuracy %.1f%%, Blunders %d",
+			event.GameID, player.PlayerName, player.Accuracy, player.Blunder)
+	}
+
+	// Look for play matching the solver too well
+	ep.anomalies.RecordAnalysis(event)
+
+	return nil
+}
+
+func (ep *EventProcessor) processMatchFound(data []byte) error {
+	var event MatchFoundEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	log.Printf("Match Found: %s, Queue %s, Rating gap %d (range ±%d), Waited %dms",
+		event.GameID, event.QueueType, event.RatingGap, event.RatingRange, event.WaitTime)
+
+	return ep.aggregator.RecordMatchFound(event)
+}
+
+func (ep *EventProcessor) processQueueJoined(data []byte) error {
+	var event QueueJoinedEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	log.Printf("Queue Joined: %s, Queue %s, Depth %d", event.Player.Name, event.QueueType, event.QueueSize)
+
+	return ep.aggregator.RecordQueueJoined(event)
+}
+
+func (ep *EventProcessor) processQueueLeft(data []byte) error {
+	var event QueueLeftEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	log.Printf("Queue Left: %s, Queue %s, %s after %dms, Depth %d",
+		event.Player.Name, event.QueueType, event.Reason, event.WaitTime, event.QueueSize)
+
+	return ep.aggregator.RecordQueueLeft(event)
+}
+
+func (ep *EventProcessor) processBotActivated(data []byte) error {
+	var event BotActivatedEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	log.Printf("Bot Activated: %s for %s, Queue %s, Waited %dms",
+		event.BotName, event.Player.Name, event.QueueType, event.WaitTime)
+
+	return ep.aggregator.RecordBotActivated(event)
+}
+
+// processPlayerErased forgets everything kept about an erased player, in
+// memory and in the analytics tables
+func (ep *EventProcessor) processPlayerErased(data []byte) error {
+	var event PlayerErasedEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	log.Printf("Player Erased: %s", event.Player)
+
+	ep.aggregator.ForgetPlayer(event.Player)
+	ep.playerTracker.Forget(event.Player)
+	ep.anomalies.Forget(event.Player)
+
+	if ep.repo != nil {
+		return ep.repo.DeletePlayerAnalytics(event.Player)
+	}
+	return nil
+}
+
+func (ep *EventProcessor) processTournamentEvent(data []byte) error {
+	var event TournamentEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+
+	switch event.EventType {
+	case EventTournamentMatchFinished:
+		if event.IsDraw {
+			log.Printf("Tournament %s: round %d match drawn", event.Name, event.Round)
+		} else {
+			log.Printf("Tournament %s: round %d match won by %s (bye: %t)",
+				event.Name, event.Round, event.WinnerName, event.Bye)
+		}
+	case EventTournamentFinished:
+		log.Printf("Tournament %s finished, winner %s (%d players)",
+			event.Name, event.WinnerName, event.PlayerCount)
+	default:
+		log.Printf("Tournament %s: %s (%d players)", event.Name, event.EventType, event.PlayerCount)
+	}
+
+	return nil
+}
+
 // Helper functions
 
 func getPlayerNames(players []PlayerInfo) []string {
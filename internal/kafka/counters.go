@@ -0,0 +1,267 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"connect-four-backend/internal/database"
+)
+
+// ErrSharedCountersDisabled is returned for global metrics when the consumer
+// keeps its counts to itself
+var ErrSharedCountersDisabled = errors.New("shared counters are not enabled")
+
+// Names of the shared counters, each holding fields by key
+const (
+	counterGames        = "games" // total, completed, draws, bot, human and duration
+	counterWinTypes     = "win_types"
+	counterPlayers      = "players" // moves, disconnections and reconnections
+	counterGamesPerHour = "games_per_hour"
+	counterMovesPerHour = "moves_per_hour"
+	counterGamesPerDay  = "games_per_day"
+	counterMovesPerDay  = "moves_per_day"
+)
+
+var counterNames = []string{
+	counterGames, counterWinTypes, counterPlayers,
+	counterGamesPerHour, counterMovesPerHour, counterGamesPerDay, counterMovesPerDay,
+}
+
+// SharedCountersConfig has every consumer instance add what it counted to
+// counters kept in Postgres or Redis, so the members of a consumer group,
+// each reading some of the partitions, report the same global metrics
+type SharedCountersConfig struct {
+	// URL is "postgres" for the consumer's database or
+	// redis://[:password@]host:6379[/db], empty to keep counts per instance
+	URL string `json:"url"`
+
+	// Prefix of the Redis keys, one hash per counter
+	Prefix string `json:"prefix"`
+
+	// How often an instance adds what it counted since the last time
+	Interval time.Duration `json:"interval"`
+}
+
+// DefaultSharedCountersConfig returns the counter settings, sharing is off until URL is set
+func DefaultSharedCountersConfig() SharedCountersConfig {
+	return SharedCountersConfig{
+		Prefix:   "connect-four:counters",
+		Interval: 10 * time.Second,
+	}
+}
+
+// SharedCountersConfigFromEnv reads SHARED_COUNTERS, SHARED_COUNTERS_PREFIX
+// and SHARED_COUNTERS_INTERVAL
+func SharedCountersConfigFromEnv() SharedCountersConfig {
+	config := DefaultSharedCountersConfig()
+	config.URL = os.Getenv("SHARED_COUNTERS")
+	if prefix := os.Getenv("SHARED_COUNTERS_PREFIX"); prefix != "" {
+		config.Prefix = prefix
+	}
+	if value, err := time.ParseDuration(os.Getenv("SHARED_COUNTERS_INTERVAL")); err == nil && value > 0 {
+		config.Interval = value
+	}
+	return config
+}
+
+// CounterStore adds to counters shared by every consumer instance. Deltas
+// and counters are by counter name, then field.
+type CounterStore interface {
+	AddCounters(deltas map[string]map[string]int64) error
+	LoadCounters(names []string) (map[string]map[string]int64, error)
+}
+
+// OpenCounterStore returns the store the config's URL points to, nil when
+// counts aren't shared
+func OpenCounterStore(config SharedCountersConfig, repo database.Store) (CounterStore, error) {
+	switch {
+	case config.URL == "":
+		return nil, nil
+	case config.URL == "postgres":
+		if repo == nil {
+			return nil, fmt.Errorf("shared counters in postgres need a database")
+		}
+		return repo, nil
+	case strings.HasPrefix(config.URL, "redis://"):
+		return NewRedisCounterStore(config.URL, config.Prefix)
+	default:
+		return nil, fmt.Errorf("unsupported shared counters %q, expected postgres or a redis:// URL", config.URL)
+	}
+}
+
+// GlobalMetrics are the counts every consumer instance added to the shared
+// counters, as of their last push
+type GlobalMetrics struct {
+	TotalGames          int64            `json:"total_games"`
+	CompletedGames      int64            `json:"completed_games"`
+	DrawCount           int64            `json:"draw_count"`
+	BotGames            int64            `json:"bot_games"`
+	HumanGames          int64            `json:"human_games"`
+	AverageGameDuration float64          `json:"average_game_duration"`
+	WinTypeDistribution map[string]int64 `json:"win_type_distribution"`
+	TotalMoves          int64            `json:"total_moves"`
+	TotalDisconnections int64            `json:"total_disconnections"`
+	TotalReconnections  int64            `json:"total_reconnections"`
+	GamesPerHour        map[string]int64 `json:"games_per_hour"`
+	MovesPerHour        map[string]int64 `json:"moves_per_hour"`
+	GamesPerDay         map[string]int64 `json:"games_per_day"`
+	MovesPerDay         map[string]int64 `json:"moves_per_day"`
+}
+
+// SetCounterStore adds the aggregator's counts to the store from now on,
+// what was counted before isn't added
+func (ma *MetricsAggregator) SetCounterStore(store CounterStore) {
+	ma.countersMu.Lock()
+	defer ma.countersMu.Unlock()
+	ma.counters = store
+	ma.countersPushed = ma.localCounters()
+}
+
+// PushCounters adds what was counted since the last push to the shared
+// counters. Each metric is read under its own lock, so workers carry on
+// while the counters are read and sent.
+func (ma *MetricsAggregator) PushCounters() error {
+	ma.countersMu.Lock()
+	defer ma.countersMu.Unlock()
+	if ma.counters == nil {
+		return nil
+	}
+
+	current := ma.localCounters()
+	deltas := make(map[string]map[string]int64)
+	for name, fields := range current {
+		for field, value := range fields {
+			delta := value - ma.countersPushed[name][field]
+			if delta == 0 {
+				continue
+			}
+			if deltas[name] == nil {
+				deltas[name] = make(map[string]int64)
+			}
+			deltas[name][field] = delta
+		}
+	}
+
+	if len(deltas) > 0 {
+		if err := ma.counters.AddCounters(deltas); err != nil {
+			// Added with the next push
+			return fmt.Errorf("failed to add to shared counters: %w", err)
+		}
+	}
+	ma.countersPushed = current
+	return nil
+}
+
+// localCounters returns this instance's counts as shared counters
+func (ma *MetricsAggregator) localCounters() map[string]map[string]int64 {
+	counters := make(map[string]map[string]int64, len(counterNames))
+
+	ma.gameMetrics.mu.RLock()
+	counters[counterGames] = map[string]int64{
+		"total":     ma.gameMetrics.TotalGames,
+		"completed": ma.gameMetrics.CompletedGames,
+		"draws":     ma.gameMetrics.DrawCount,
+		"bot":       ma.gameMetrics.BotGames,
+		"human":     ma.gameMetrics.HumanGames,
+		"duration":  ma.gameMetrics.TotalGameDuration,
+	}
+	counters[counterWinTypes] = copyCounts(ma.gameMetrics.WinTypeDistribution)
+	ma.gameMetrics.mu.RUnlock()
+
+	counters[counterPlayers] = map[string]int64{
+		"moves":          atomic.LoadInt64(&ma.playerTotals.moves),
+		"disconnections": atomic.LoadInt64(&ma.playerTotals.disconnections),
+		"reconnections":  atomic.LoadInt64(&ma.playerTotals.reconnections),
+	}
+
+	ma.hourlyMetrics.mu.RLock()
+	counters[counterGamesPerHour] = copyCounts(ma.hourlyMetrics.GamesPerHour)
+	counters[counterMovesPerHour] = copyCounts(ma.hourlyMetrics.MovesPerHour)
+	ma.hourlyMetrics.mu.RUnlock()
+
+	ma.dailyMetrics.mu.RLock()
+	counters[counterGamesPerDay] = copyCounts(ma.dailyMetrics.GamesPerDay)
+	counters[counterMovesPerDay] = copyCounts(ma.dailyMetrics.MovesPerDay)
+	ma.dailyMetrics.mu.RUnlock()
+
+	return counters
+}
+
+// pushedCounters returns a copy of the counts added to the shared counters so far
+func (ma *MetricsAggregator) pushedCounters() map[string]map[string]int64 {
+	ma.countersMu.Lock()
+	defer ma.countersMu.Unlock()
+	if ma.counters == nil {
+		return nil
+	}
+	pushed := make(map[string]map[string]int64, len(ma.countersPushed))
+	for name, fields := range ma.countersPushed {
+		pushed[name] = copyCounts(fields)
+	}
+	return pushed
+}
+
+// GetGlobalMetrics returns the counts of every instance sharing the counters,
+// the hours and days within the retention windows
+func (ma *MetricsAggregator) GetGlobalMetrics() (GlobalMetrics, error) {
+	ma.countersMu.Lock()
+	store := ma.counters
+	ma.countersMu.Unlock()
+	if store == nil {
+		return GlobalMetrics{}, ErrSharedCountersDisabled
+	}
+
+	counters, err := store.LoadCounters(counterNames)
+	if err != nil {
+		return GlobalMetrics{}, fmt.Errorf("failed to load shared counters: %w", err)
+	}
+
+	games, players := counters[counterGames], counters[counterPlayers]
+	global := GlobalMetrics{
+		TotalGames:          games["total"],
+		CompletedGames:      games["completed"],
+		DrawCount:           games["draws"],
+		BotGames:            games["bot"],
+		HumanGames:          games["human"],
+		WinTypeDistribution: copyCounts(counters[counterWinTypes]),
+		TotalMoves:          players["moves"],
+		TotalDisconnections: players["disconnections"],
+		TotalReconnections:  players["reconnections"],
+	}
+	if global.CompletedGames > 0 {
+		global.AverageGameDuration = float64(games["duration"]) / float64(global.CompletedGames)
+	}
+
+	memory := ma.memoryConfig()
+	now := time.Now()
+	cutoffHour := now.Add(-memory.HourlyRetention).Format("2006-01-02-15")
+	cutoffDay := now.Add(-memory.DailyRetention).Format("2006-01-02")
+	global.GamesPerHour = countsFrom(counters[counterGamesPerHour], cutoffHour)
+	global.MovesPerHour = countsFrom(counters[counterMovesPerHour], cutoffHour)
+	global.GamesPerDay = countsFrom(counters[counterGamesPerDay], cutoffDay)
+	global.MovesPerDay = countsFrom(counters[counterMovesPerDay], cutoffDay)
+	return global, nil
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	copied := make(map[string]int64, len(counts))
+	for key, count := range counts {
+		copied[key] = count
+	}
+	return copied
+}
+
+// countsFrom returns the counts of the keys from the cutoff key on
+func countsFrom(counts map[string]int64, cutoff string) map[string]int64 {
+	kept := make(map[string]int64)
+	for key, count := range counts {
+		if key >= cutoff {
+			kept[key] = count
+		}
+	}
+	return kept
+}
@@ -0,0 +1,214 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to dead-lettered messages, next to the original headers
+const (
+	HeaderDLQError           = "dlq_error"
+	HeaderDLQSourceTopic     = "dlq_source_topic"
+	HeaderDLQSourcePartition = "dlq_source_partition"
+	HeaderDLQSourceOffset    = "dlq_source_offset"
+	HeaderDLQFailedAt        = "dlq_failed_at"
+	HeaderDLQAttempts        = "dlq_attempts" // times the message failed, replays included
+)
+
+// ErrNewerSchemaVersion is returned for events written by a newer server
+// than this consumer understands. They are dead-lettered to be replayed once
+// the consumer is upgraded.
+var ErrNewerSchemaVersion = errors.New("event schema version is newer than this consumer reads")
+
+// DeadLetterQueue forwards messages the consumer couldn't process to a
+// separate topic, with the error and where they came from in their headers
+type DeadLetterQueue struct {
+	writer *kafka.Writer
+	topic  string
+}
+
+// NewDeadLetterQueue creates a writer for the DLQ topic. Writes are
+// synchronous so the message is known to be kept before the consumer moves on.
+func NewDeadLetterQueue(brokers []string, topic string, security SecurityConfig) (*DeadLetterQueue, error) {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		ErrorLogger:  kafka.LoggerFunc(log.Printf),
+	}
+
+	transport, err := security.Transport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		writer.Transport = transport
+	}
+
+	return &DeadLetterQueue{writer: writer, topic: topic}, nil
+}
+
+// Forward writes the failed message to the DLQ
+func (q *DeadLetterQueue) Forward(ctx context.Context, message kafka.Message, cause error) error {
+	attempts := 1
+	var headers []kafka.Header
+	for _, header := range message.Headers {
+		switch header.Key {
+		case HeaderDLQAttempts:
+			if n, err := strconv.Atoi(string(header.Value)); err == nil {
+				attempts = n + 1
+			}
+		case HeaderDLQError, HeaderDLQSourceTopic, HeaderDLQSourcePartition, HeaderDLQSourceOffset, HeaderDLQFailedAt:
+			// replaced below
+		default:
+			headers = append(headers, header)
+		}
+	}
+
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQSourceTopic, Value: []byte(message.Topic)},
+		kafka.Header{Key: HeaderDLQSourcePartition, Value: []byte(strconv.Itoa(message.Partition))},
+		kafka.Header{Key: HeaderDLQSourceOffset, Value: []byte(strconv.FormatInt(message.Offset, 10))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	err := q.writer.WriteMessages(ctx, kafka.Message{
+		Key:     message.Key,
+		Value:   message.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to forward message to %s: %w", q.topic, err)
+	}
+	return nil
+}
+
+func (q *DeadLetterQueue) Close() error {
+	return q.writer.Close()
+}
+
+// ReplayConfig holds the settings of a DLQ replay
+type ReplayConfig struct {
+	Brokers     []string      `json:"brokers"`
+	Topic       string        `json:"topic"`    // the DLQ topic
+	GroupID     string        `json:"group_id"` // remembers which messages were replayed
+	IdleTimeout time.Duration `json:"idle_timeout"`
+	MaxMessages int           `json:"max_messages"` // 0 for no limit
+	DryRun      bool          `json:"dry_run"`      // only log the messages
+
+	Security SecurityConfig `json:"security"`
+}
+
+// DefaultReplayConfig returns the settings of the replay command
+func DefaultReplayConfig(brokers []string, topic string) ReplayConfig {
+	return ReplayConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     "analytics-dlq-replay",
+		IdleTimeout: 10 * time.Second,
+	}
+}
+
+// ReplayStats summarises a replay
+type ReplayStats struct {
+	Replayed int `json:"replayed"`
+	Failed   int `json:"failed"`
+}
+
+// ReplayDeadLetters publishes dead-lettered messages back to the topics they
+// came from, for the consumer to process again. Messages that fail again are
+// dead-lettered again with one more attempt. The replay stops once the DLQ
+// has been idle for the idle timeout. A dry run lists the messages without
+// replaying them or committing the group's offsets.
+func ReplayDeadLetters(ctx context.Context, config ReplayConfig) (ReplayStats, error) {
+	var stats ReplayStats
+
+	dialer, err := config.Security.Dialer()
+	if err != nil {
+		return stats, err
+	}
+	transport, err := config.Security.Transport()
+	if err != nil {
+		return stats, err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Dialer:      dialer,
+		Brokers:     config.Brokers,
+		Topic:       config.Topic,
+		GroupID:     config.GroupID,
+		StartOffset: kafka.FirstOffset,
+		ErrorLogger: kafka.LoggerFunc(log.Printf),
+	})
+	defer reader.Close()
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(config.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		ErrorLogger:  kafka.LoggerFunc(log.Printf),
+	}
+	if transport != nil {
+		writer.Transport = transport
+	}
+	defer writer.Close()
+
+	for config.MaxMessages == 0 || stats.Replayed+stats.Failed < config.MaxMessages {
+		fetchCtx, cancel := context.WithTimeout(ctx, config.IdleTimeout)
+		message, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read %s: %w", config.Topic, err)
+		}
+
+		source := deadLetterHeader(message, HeaderDLQSourceTopic)
+		log.Printf("Dead letter %s@%d from %s (attempts %s): %s", message.Topic, message.Offset,
+			source, deadLetterHeader(message, HeaderDLQAttempts), deadLetterHeader(message, HeaderDLQError))
+		if config.DryRun {
+			stats.Replayed++
+			continue
+		}
+		if source == "" {
+			log.Printf("Dead letter %s@%d has no source topic, skipping it", message.Topic, message.Offset)
+			stats.Failed++
+		} else {
+			err := writer.WriteMessages(ctx, kafka.Message{
+				Topic:   source,
+				Key:     message.Key,
+				Value:   message.Value,
+				Headers: message.Headers, // keeps the attempt count for the next failure
+			})
+			if err != nil {
+				return stats, fmt.Errorf("failed to replay to %s: %w", source, err)
+			}
+			stats.Replayed++
+		}
+
+		if err := reader.CommitMessages(ctx, message); err != nil {
+			return stats, fmt.Errorf("failed to commit replayed message: %w", err)
+		}
+	}
+
+	return stats, nil
+}
+
+func deadLetterHeader(message kafka.Message, key string) string {
+	for _, header := range message.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
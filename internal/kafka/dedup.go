@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+)
+
+// ProcessedEventStore keeps the IDs of processed events beyond the in-memory
+// cache, so duplicates are caught after a restart or rebalance
+type ProcessedEventStore interface {
+	EventProcessed(eventID string) (bool, error)
+	MarkEventProcessed(eventID, eventType string, processedAt time.Time) error
+	DeleteProcessedEventsBefore(cutoff time.Time) (int64, error)
+	DeleteProcessedEventsAfter(cutoff time.Time) (int64, error)
+}
+
+// EventDeduplicator skips events that were already processed, which Kafka's
+// at-least-once delivery hands out again after a rebalance or a crash before
+// the commit. Recently seen IDs are answered from memory, older ones from the
+// store. Events are marked only once processed, so one that failed is still
+// processed when it is replayed from the dead-letter topic.
+type EventDeduplicator struct {
+	store ProcessedEventStore // nil to only remember recent events
+
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []string // ring of the cached IDs, the oldest is evicted first
+	next  int
+}
+
+// NewEventDeduplicator creates a deduplicator remembering up to cacheSize
+// event IDs in memory
+func NewEventDeduplicator(store ProcessedEventStore, cacheSize int) *EventDeduplicator {
+	if cacheSize < 1 {
+		cacheSize = 1
+	}
+	return &EventDeduplicator{
+		store: store,
+		seen:  make(map[string]struct{}, cacheSize),
+		order: make([]string, cacheSize),
+	}
+}
+
+// Seen reports whether the event was already processed
+func (d *EventDeduplicator) Seen(eventID string) (bool, error) {
+	d.mu.Lock()
+	_, ok := d.seen[eventID]
+	d.mu.Unlock()
+	if ok || d.store == nil {
+		return ok, nil
+	}
+
+	processed, err := d.store.EventProcessed(eventID)
+	if err != nil {
+		return false, err
+	}
+	if processed {
+		d.remember(eventID)
+	}
+	return processed, nil
+}
+
+// Mark records the event as processed
+func (d *EventDeduplicator) Mark(eventID string, eventType EventType, processedAt time.Time) error {
+	if d.store != nil {
+		if err := d.store.MarkEventProcessed(eventID, string(eventType), processedAt); err != nil {
+			return err
+		}
+	}
+	d.remember(eventID)
+	return nil
+}
+
+// ForgetAfter forgets stored events processed after the cutoff, so they are
+// processed again when the consumer rewinds to a snapshot taken at the cutoff
+func (d *EventDeduplicator) ForgetAfter(cutoff time.Time) (int64, error) {
+	if d.store == nil {
+		return 0, nil
+	}
+	return d.store.DeleteProcessedEventsAfter(cutoff)
+}
+
+// Prune forgets stored events processed before the cutoff. Kafka doesn't
+// redeliver events that old, so keeping them only costs space.
+func (d *EventDeduplicator) Prune(cutoff time.Time) (int64, error) {
+	if d.store == nil {
+		return 0, nil
+	}
+	return d.store.DeleteProcessedEventsBefore(cutoff)
+}
+
+func (d *EventDeduplicator) remember(eventID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.seen[eventID]; ok {
+		return
+	}
+	if evicted := d.order[d.next]; evicted != "" {
+		delete(d.seen, evicted)
+	}
+	d.order[d.next] = eventID
+	d.next = (d.next + 1) % len(d.order)
+	d.seen[eventID] = struct{}{}
+}
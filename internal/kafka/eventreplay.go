@@ -0,0 +1,274 @@
+package kafka
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// EventRangeConfig selects the historical events to read back from Kafka
+type EventRangeConfig struct {
+	Brokers  []string       `json:"brokers"`
+	Topics   []string       `json:"topics"`
+	Start    time.Time      `json:"start"` // zero for the oldest retained event
+	End      time.Time      `json:"end"`   // zero for the newest event when the read starts
+	Security SecurityConfig `json:"security"`
+}
+
+// partitionCursor reads one partition up to the offset it had when the read started
+type partitionCursor struct {
+	reader *kafka.Reader
+	end    int64 // offset after the partition's newest message
+	head   *kafka.Message
+}
+
+// ReadEventRange hands the events written between Start and End to handle,
+// merged across topics and partitions in the order they were written. It
+// stops at the first error handle returns.
+func ReadEventRange(ctx context.Context, config EventRangeConfig, handle func(kafka.Message) error) error {
+	cursors, err := openPartitionCursors(ctx, config)
+	defer func() {
+		for _, cursor := range cursors {
+			cursor.reader.Close()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	for _, cursor := range cursors {
+		if err := cursor.advance(ctx, config.End); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var next *partitionCursor
+		for _, cursor := range cursors {
+			if cursor.head != nil && (next == nil || cursor.head.Time.Before(next.head.Time)) {
+				next = cursor
+			}
+		}
+		if next == nil {
+			return nil
+		}
+
+		if err := handle(*next.head); err != nil {
+			return err
+		}
+		if err := next.advance(ctx, config.End); err != nil {
+			return err
+		}
+	}
+}
+
+func openPartitionCursors(ctx context.Context, config EventRangeConfig) ([]*partitionCursor, error) {
+	dialer, err := config.Security.Dialer()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := config.Security.Transport()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(config.Brokers...), Timeout: 10 * time.Second}
+	if transport != nil {
+		client.Transport = transport
+	}
+
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: config.Topics})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch topic metadata: %w", err)
+	}
+	requests := make(map[string][]kafka.OffsetRequest)
+	for _, topic := range metadata.Topics {
+		if topic.Error != nil {
+			return nil, fmt.Errorf("failed to fetch metadata of %s: %w", topic.Name, topic.Error)
+		}
+		for _, partition := range topic.Partitions {
+			requests[topic.Name] = append(requests[topic.Name], kafka.LastOffsetOf(partition.ID))
+		}
+	}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: requests})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	var cursors []*partitionCursor
+	for topic, partitions := range offsets.Topics {
+		for _, partition := range partitions {
+			if partition.Error != nil {
+				return cursors, fmt.Errorf("failed to list offsets of %s/%d: %w", topic, partition.Partition, partition.Error)
+			}
+			if partition.LastOffset <= partition.FirstOffset {
+				continue // empty
+			}
+
+			reader := kafka.NewReader(kafka.ReaderConfig{
+				Dialer:      dialer,
+				Brokers:     config.Brokers,
+				Topic:       topic,
+				Partition:   partition.Partition,
+				MaxWait:     time.Second,
+				ErrorLogger: kafka.LoggerFunc(log.Printf),
+			})
+			cursor := &partitionCursor{reader: reader, end: partition.LastOffset}
+			cursors = append(cursors, cursor)
+
+			if config.Start.IsZero() {
+				err = reader.SetOffset(kafka.FirstOffset)
+			} else {
+				err = reader.SetOffsetAt(ctx, config.Start)
+			}
+			if err != nil {
+				return cursors, fmt.Errorf("failed to seek %s/%d: %w", topic, partition.Partition, err)
+			}
+		}
+	}
+	return cursors, nil
+}
+
+// advance reads the partition's next message, leaving head nil past the end
+func (c *partitionCursor) advance(ctx context.Context, end time.Time) error {
+	c.head = nil
+	if offset := c.reader.Offset(); offset >= 0 && offset >= c.end {
+		return nil
+	}
+
+	message, err := c.reader.ReadMessage(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", c.reader.Config().Topic, err)
+	}
+	if message.Offset >= c.end || (!end.IsZero() && message.Time.After(end)) {
+		return nil
+	}
+	c.head = &message
+	return nil
+}
+
+// archivedEvent is one line of an event archive
+type archivedEvent struct {
+	Topic     string            `json:"topic"`
+	Partition int               `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Time      time.Time         `json:"time"`
+	Key       string            `json:"key"`
+	Value     []byte            `json:"value"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+func newArchivedEvent(message kafka.Message) archivedEvent {
+	event := archivedEvent{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Time:      message.Time,
+		Key:       string(message.Key),
+		Value:     message.Value,
+	}
+	if len(message.Headers) > 0 {
+		event.Headers = make(map[string]string, len(message.Headers))
+		for _, header := range message.Headers {
+			event.Headers[header.Key] = string(header.Value)
+		}
+	}
+	return event
+}
+
+// ArchiveWriter exports events to a file of JSON lines, gzipped when its name ends in .gz
+type ArchiveWriter struct {
+	file    *os.File
+	gzip    *gzip.Writer // nil for an uncompressed archive
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func NewArchiveWriter(path string) (*ArchiveWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	archive := &ArchiveWriter{file: file}
+	var out io.Writer = file
+	if strings.HasSuffix(path, ".gz") {
+		archive.gzip = gzip.NewWriter(file)
+		out = archive.gzip
+	}
+	archive.buffer = bufio.NewWriter(out)
+	archive.encoder = json.NewEncoder(archive.buffer)
+	return archive, nil
+}
+
+func (a *ArchiveWriter) Write(message kafka.Message) error {
+	return a.encoder.Encode(newArchivedEvent(message))
+}
+
+// Close flushes the archive, it is incomplete until closed
+func (a *ArchiveWriter) Close() error {
+	err := a.buffer.Flush()
+	if a.gzip != nil {
+		if gzipErr := a.gzip.Close(); err == nil {
+			err = gzipErr
+		}
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ReadArchive hands the events of an archive written by ArchiveWriter to
+// handle, in the order they were archived
+func ReadArchive(path string, handle func(kafka.Message) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(in))
+	for line := 1; ; line++ {
+		var event archivedEvent
+		if err := decoder.Decode(&event); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read archived event %d: %w", line, err)
+		}
+
+		message := kafka.Message{
+			Topic:     event.Topic,
+			Partition: event.Partition,
+			Offset:    event.Offset,
+			Time:      event.Time,
+			Key:       []byte(event.Key),
+			Value:     event.Value,
+		}
+		for key, value := range event.Headers {
+			message.Headers = append(message.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+		if err := handle(message); err != nil {
+			return err
+		}
+	}
+}
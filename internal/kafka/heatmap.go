@@ -0,0 +1,324 @@
+package kafka
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// The board's size, as models.Game.Board
+const (
+	boardRows    = 6
+	boardColumns = 7
+)
+
+// Moves of games that never report their end are dropped after this long.
+// A game's end can be read before its last moves when moves are routed to
+// another topic, it waits this long for them before the game is counted with
+// the moves that came.
+const (
+	pendingColumnsTimeout = 24 * time.Hour
+	pendingEndTimeout     = 10 * time.Minute
+)
+
+// ColumnCounts counts moves per column, leftmost first
+type ColumnCounts [boardColumns]int64
+
+// ColumnMetrics aggregates where moves are played, laid out for heatmaps
+type ColumnMetrics struct {
+	Moves         int64                          `json:"moves"`
+	Columns       ColumnCounts                   `json:"columns"`
+	ByMoveNumber  map[int]ColumnCounts           `json:"by_move_number"` // columns played at each move number, from 1
+	FirstMoves    ColumnCounts                   `json:"first_moves"`    // opening move of each game
+	WinnerColumns ColumnCounts                   `json:"winner_columns"` // moves of players who went on to win
+	LoserColumns  ColumnCounts                   `json:"loser_columns"`  // moves of players who went on to lose
+	Cells         [boardRows][boardColumns]int64 `json:"cells"`          // moves landing on each cell, by row as on the board
+}
+
+// WinRate is how the player who made an opening fared
+type WinRate struct {
+	Games   int64   `json:"games"`
+	Wins    int64   `json:"wins"`
+	Losses  int64   `json:"losses"`
+	Draws   int64   `json:"draws"`
+	WinRate float64 `json:"win_rate"`
+}
+
+func (wr *WinRate) record(won, drawn bool) {
+	wr.Games++
+	switch {
+	case drawn:
+		wr.Draws++
+	case won:
+		wr.Wins++
+	default:
+		wr.Losses++
+	}
+	wr.WinRate = float64(wr.Wins) / float64(wr.Games)
+}
+
+// OpeningMetrics are the win rates of the player who moved first, by the
+// column of the opening move and by their color
+type OpeningMetrics struct {
+	ByColumn        [boardColumns]WinRate `json:"by_column"`
+	ByStartingColor map[string]WinRate    `json:"by_starting_color"`
+}
+
+// columnAggregator keeps the column and opening metrics, holding the moves
+// of unfinished games until the game's outcome is known and, for an outcome
+// read before the game's last moves, until they arrive
+type columnAggregator struct {
+	mu       sync.RWMutex
+	metrics  ColumnMetrics
+	openings OpeningMetrics
+	pending  map[string]*pendingColumns
+}
+
+// pendingColumns are the columns each player of an unfinished game played,
+// and the game's end if it was read before all of them
+type pendingColumns struct {
+	Players  map[string]*ColumnCounts `json:"players"`
+	Opening  *openingMove             `json:"opening,omitempty"`
+	LastMove time.Time                `json:"last_move"`
+	End      *pendingEnd              `json:"end,omitempty"`
+}
+
+// moves returns how many of the game's moves were recorded
+func (pc *pendingColumns) moves() int {
+	total := 0
+	for _, counts := range pc.Players {
+		for _, count := range counts {
+			total += int(count)
+		}
+	}
+	return total
+}
+
+// pendingEnd is a game's outcome waiting for the game's last moves
+type pendingEnd struct {
+	Winner     string    `json:"winner,omitempty"`
+	IsDraw     bool      `json:"is_draw"`
+	TotalMoves int       `json:"total_moves"`
+	ReadAt     time.Time `json:"read_at"`
+}
+
+// openingMove is a game's first move
+type openingMove struct {
+	Player string `json:"player"`
+	Color  string `json:"color"`
+	Column int    `json:"column"`
+}
+
+func newColumnAggregator() *columnAggregator {
+	return &columnAggregator{
+		metrics:  ColumnMetrics{ByMoveNumber: make(map[int]ColumnCounts)},
+		openings: OpeningMetrics{ByStartingColor: make(map[string]WinRate)},
+		pending:  make(map[string]*pendingColumns),
+	}
+}
+
+// colorName names a player's color as PlayerInfo.Number carries it
+func colorName(number int) string {
+	switch models.PlayerColor(number) {
+	case models.PlayerRed:
+		return "red"
+	case models.PlayerYellow:
+		return "yellow"
+	default:
+		return strconv.Itoa(number)
+	}
+}
+
+// recordMove counts a move's column and cell, and holds it until the game's winner is known
+func (ca *columnAggregator) recordMove(event MovePlayedEvent) {
+	if event.Column < 0 || event.Column >= boardColumns {
+		return
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	ca.metrics.Moves++
+	ca.metrics.Columns[event.Column]++
+	if event.Row >= 0 && event.Row < boardRows {
+		ca.metrics.Cells[event.Row][event.Column]++
+	}
+	if event.MoveNumber > 0 {
+		counts := ca.metrics.ByMoveNumber[event.MoveNumber]
+		counts[event.Column]++
+		ca.metrics.ByMoveNumber[event.MoveNumber] = counts
+	}
+	if event.MoveNumber == 1 {
+		ca.metrics.FirstMoves[event.Column]++
+	}
+
+	game, exists := ca.pending[event.GameID]
+	if !exists {
+		game = &pendingColumns{Players: make(map[string]*ColumnCounts)}
+		ca.pending[event.GameID] = game
+	}
+	player, exists := game.Players[event.Player.Name]
+	if !exists {
+		player = &ColumnCounts{}
+		game.Players[event.Player.Name] = player
+	}
+	player[event.Column]++
+	if event.MoveNumber == 1 {
+		game.Opening = &openingMove{
+			Player: event.Player.Name,
+			Color:  colorName(event.Player.Number),
+			Column: event.Column,
+		}
+	}
+	if event.Timestamp.After(game.LastMove) {
+		game.LastMove = event.Timestamp
+	}
+	if game.End != nil && game.moves() >= game.End.TotalMoves {
+		ca.settle(event.GameID, game)
+	}
+}
+
+// recordGameEnd credits the game's moves to its winner and loser, drawn
+// games count in neither, and the outcome to the game's opening. Games whose
+// moves haven't all been read keep the outcome until they are.
+func (ca *columnAggregator) recordGameEnd(event GameEndedEvent) {
+	if !event.IsDraw && event.Winner == nil {
+		ca.mu.Lock()
+		delete(ca.pending, event.GameID)
+		ca.mu.Unlock()
+		return
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	game, exists := ca.pending[event.GameID]
+	if !exists {
+		game = &pendingColumns{Players: make(map[string]*ColumnCounts)}
+		ca.pending[event.GameID] = game
+	}
+	game.End = &pendingEnd{IsDraw: event.IsDraw, TotalMoves: event.TotalMoves, ReadAt: time.Now()}
+	if event.Winner != nil {
+		game.End.Winner = event.Winner.Name
+	}
+	if game.moves() >= event.TotalMoves {
+		ca.settle(event.GameID, game)
+	}
+}
+
+// settle counts an ended game's moves and opening by its outcome
+func (ca *columnAggregator) settle(gameID string, game *pendingColumns) {
+	delete(ca.pending, gameID)
+	end := game.End
+
+	if opening := game.Opening; opening != nil {
+		won := !end.IsDraw && end.Winner == opening.Player
+		ca.openings.ByColumn[opening.Column].record(won, end.IsDraw)
+		byColor := ca.openings.ByStartingColor[opening.Color]
+		byColor.record(won, end.IsDraw)
+		ca.openings.ByStartingColor[opening.Color] = byColor
+	}
+
+	if end.IsDraw {
+		return
+	}
+	for name, counts := range game.Players {
+		target := &ca.metrics.LoserColumns
+		if name == end.Winner {
+			target = &ca.metrics.WinnerColumns
+		}
+		for column, count := range counts {
+			target[column] += count
+		}
+	}
+}
+
+// cleanup counts the ended games that waited too long for their last moves
+// with the moves that came, and drops the moves of games not heard of in
+// a day
+func (ca *columnAggregator) cleanup(now time.Time) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	for gameID, game := range ca.pending {
+		switch {
+		case game.End != nil:
+			if game.End.ReadAt.Before(now.Add(-pendingEndTimeout)) {
+				ca.settle(gameID, game)
+			}
+		case game.LastMove.Before(now.Add(-pendingColumnsTimeout)):
+			delete(ca.pending, gameID)
+		}
+	}
+}
+
+// copy returns the counts, without the unfinished games
+func (ca *columnAggregator) copy() ColumnMetrics {
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+
+	metrics := ca.metrics
+	metrics.ByMoveNumber = make(map[int]ColumnCounts, len(ca.metrics.ByMoveNumber))
+	for moveNumber, counts := range ca.metrics.ByMoveNumber {
+		metrics.ByMoveNumber[moveNumber] = counts
+	}
+	return metrics
+}
+
+// openingCopy returns the opening win rates
+func (ca *columnAggregator) openingCopy() OpeningMetrics {
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+
+	openings := ca.openings
+	openings.ByStartingColor = make(map[string]WinRate, len(ca.openings.ByStartingColor))
+	for color, winRate := range ca.openings.ByStartingColor {
+		openings.ByStartingColor[color] = winRate
+	}
+	return openings
+}
+
+// pendingState returns a copy of the unfinished games' columns
+func (ca *columnAggregator) pendingState() map[string]*pendingColumns {
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+
+	games := make(map[string]*pendingColumns, len(ca.pending))
+	for gameID, game := range ca.pending {
+		gameCopy := &pendingColumns{
+			Players:  make(map[string]*ColumnCounts, len(game.Players)),
+			LastMove: game.LastMove,
+		}
+		if game.Opening != nil {
+			opening := *game.Opening
+			gameCopy.Opening = &opening
+		}
+		if game.End != nil {
+			end := *game.End
+			gameCopy.End = &end
+		}
+		for name, counts := range game.Players {
+			countsCopy := *counts
+			gameCopy.Players[name] = &countsCopy
+		}
+		games[gameID] = gameCopy
+	}
+	return games
+}
+
+// restore replaces the counts, win rates and unfinished games with the
+// snapshot's, win rates are left alone by snapshots taken without them
+func (ca *columnAggregator) restore(metrics *ColumnMetrics, openings *OpeningMetrics, pending map[string]*pendingColumns) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	ca.metrics = *metrics
+	ca.metrics.ByMoveNumber = orEmpty(metrics.ByMoveNumber)
+	if openings != nil {
+		ca.openings = *openings
+		ca.openings.ByStartingColor = orEmpty(openings.ByStartingColor)
+	}
+	ca.pending = orEmpty(pending)
+}
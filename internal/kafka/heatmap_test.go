@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	heatmapRed    = PlayerInfo{Name: "red", Number: 0}
+	heatmapYellow = PlayerInfo{Name: "yellow", Number: 1}
+)
+
+// heatmapMoves are a game's moves, red playing column 3 and yellow column 4
+func heatmapMoves(gameID string, count int) []MovePlayedEvent {
+	var moves []MovePlayedEvent
+	for i := 0; i < count; i++ {
+		player, column := heatmapRed, 3
+		if i%2 == 1 {
+			player, column = heatmapYellow, 4
+		}
+		moves = append(moves, MovePlayedEvent{
+			BaseEvent:  BaseEvent{GameID: gameID, Timestamp: time.Now()},
+			Player:     player,
+			Column:     column,
+			Row:        5 - i/2,
+			MoveNumber: i + 1,
+		})
+	}
+	return moves
+}
+
+func redWins(gameID string, totalMoves int) GameEndedEvent {
+	winner := heatmapRed
+	return GameEndedEvent{
+		BaseEvent:  BaseEvent{GameID: gameID, Timestamp: time.Now()},
+		Winner:     &winner,
+		TotalMoves: totalMoves,
+	}
+}
+
+func TestHeatmapCountsEndedGame(t *testing.T) {
+	ca := newColumnAggregator()
+	for _, move := range heatmapMoves("game", 7) {
+		ca.recordMove(move)
+	}
+	ca.recordGameEnd(redWins("game", 7))
+
+	metrics := ca.copy()
+	if metrics.WinnerColumns[3] != 4 || metrics.LoserColumns[4] != 3 {
+		t.Errorf("winner columns %v and loser columns %v, want red's 4 moves in 3 and yellow's 3 in 4",
+			metrics.WinnerColumns, metrics.LoserColumns)
+	}
+	if opening := ca.openingCopy(); opening.ByColumn[3].Wins != 1 {
+		t.Errorf("opening in column 3 has %+v, want a win", opening.ByColumn[3])
+	}
+	if len(ca.pending) != 0 {
+		t.Errorf("%d games still pending after the game ended", len(ca.pending))
+	}
+}
+
+func TestHeatmapEndBeforeMoves(t *testing.T) {
+	ca := newColumnAggregator()
+	moves := heatmapMoves("game", 7)
+	for _, move := range moves[:5] {
+		ca.recordMove(move)
+	}
+
+	// The end, read from the lifecycle topic, overtakes the last two moves
+	ca.recordGameEnd(redWins("game", 7))
+	if metrics := ca.copy(); metrics.WinnerColumns[3] != 0 || metrics.LoserColumns[4] != 0 {
+		t.Fatal("the game was counted with 5 of its 7 moves")
+	}
+
+	for _, move := range moves[5:] {
+		ca.recordMove(move)
+	}
+	metrics := ca.copy()
+	if metrics.WinnerColumns[3] != 4 || metrics.LoserColumns[4] != 3 {
+		t.Errorf("winner columns %v and loser columns %v, want all 7 moves counted",
+			metrics.WinnerColumns, metrics.LoserColumns)
+	}
+	if len(ca.pending) != 0 {
+		t.Errorf("%d games still pending after their last move", len(ca.pending))
+	}
+}
+
+func TestHeatmapEndWithoutAnyMoves(t *testing.T) {
+	ca := newColumnAggregator()
+	ca.recordGameEnd(redWins("game", 3))
+	for _, move := range heatmapMoves("game", 3) {
+		ca.recordMove(move)
+	}
+
+	metrics := ca.copy()
+	if metrics.WinnerColumns[3] != 2 || metrics.LoserColumns[4] != 1 {
+		t.Errorf("winner columns %v and loser columns %v, want the moves read after the end counted",
+			metrics.WinnerColumns, metrics.LoserColumns)
+	}
+	if opening := ca.openingCopy(); opening.ByColumn[3].Games != 1 {
+		t.Errorf("opening in column 3 has %+v, want the game", opening.ByColumn[3])
+	}
+}
+
+func TestHeatmapEndWaitsForMissingMoves(t *testing.T) {
+	ca := newColumnAggregator()
+	for _, move := range heatmapMoves("game", 5) {
+		ca.recordMove(move)
+	}
+	// Two of the game's moves were sampled away and never come
+	ca.recordGameEnd(redWins("game", 7))
+
+	ca.cleanup(time.Now())
+	if len(ca.pending) != 1 {
+		t.Fatal("the ended game stopped waiting for its moves at once")
+	}
+
+	ca.cleanup(time.Now().Add(pendingEndTimeout + time.Minute))
+	metrics := ca.copy()
+	if metrics.WinnerColumns[3] != 3 || metrics.LoserColumns[4] != 2 {
+		t.Errorf("winner columns %v and loser columns %v, want the 5 moves that came",
+			metrics.WinnerColumns, metrics.LoserColumns)
+	}
+	if len(ca.pending) != 0 {
+		t.Errorf("%d games still pending after waiting", len(ca.pending))
+	}
+}
+
+func TestHeatmapDropsUnendedGames(t *testing.T) {
+	ca := newColumnAggregator()
+	for _, move := range heatmapMoves("game", 3) {
+		ca.recordMove(move)
+	}
+
+	ca.cleanup(time.Now().Add(pendingEndTimeout + time.Minute))
+	if len(ca.pending) != 1 {
+		t.Fatal("a game without an end was dropped before a day")
+	}
+	ca.cleanup(time.Now().Add(pendingColumnsTimeout + time.Minute))
+	if len(ca.pending) != 0 {
+		t.Error("a game without an end was kept past a day")
+	}
+	if metrics := ca.copy(); metrics.WinnerColumns != (ColumnCounts{}) || metrics.Moves != 3 {
+		t.Errorf("dropped game counted as %+v", metrics)
+	}
+}
+
+func TestHeatmapSnapshotKeepsWaitingEnd(t *testing.T) {
+	ca := newColumnAggregator()
+	moves := heatmapMoves("game", 7)
+	for _, move := range moves[:6] {
+		ca.recordMove(move)
+	}
+	ca.recordGameEnd(redWins("game", 7))
+
+	restored := newColumnAggregator()
+	metrics, openings := ca.copy(), ca.openingCopy()
+	restored.restore(&metrics, &openings, ca.pendingState())
+	restored.recordMove(moves[6])
+
+	if metrics := restored.copy(); metrics.WinnerColumns[3] != 4 || metrics.LoserColumns[4] != 3 {
+		t.Errorf("restored aggregator counted winner columns %v and loser columns %v",
+			metrics.WinnerColumns, metrics.LoserColumns)
+	}
+}
@@ -0,0 +1,176 @@
+package kafka
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HistogramConfig sets the bucket upper bounds, in seconds, of the game
+// duration and move think time histograms
+type HistogramConfig struct {
+	GameDurationBuckets []float64 `json:"game_duration_buckets"`
+	MoveTimeBuckets     []float64 `json:"move_time_buckets"`
+}
+
+// DefaultHistogramConfig returns buckets covering quick bot games to long
+// human ones, and instant moves to the move timeout
+func DefaultHistogramConfig() HistogramConfig {
+	return HistogramConfig{
+		GameDurationBuckets: []float64{30, 60, 120, 180, 300, 600, 900, 1800},
+		MoveTimeBuckets:     []float64{0.5, 1, 2, 5, 10, 15, 20, 30, 60},
+	}
+}
+
+// HistogramConfigFromEnv reads the buckets from GAME_DURATION_BUCKETS and
+// MOVE_TIME_BUCKETS, comma separated seconds
+func HistogramConfigFromEnv() (HistogramConfig, error) {
+	config := DefaultHistogramConfig()
+	if value := os.Getenv("GAME_DURATION_BUCKETS"); value != "" {
+		buckets, err := ParseBuckets(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid GAME_DURATION_BUCKETS: %w", err)
+		}
+		config.GameDurationBuckets = buckets
+	}
+	if value := os.Getenv("MOVE_TIME_BUCKETS"); value != "" {
+		buckets, err := ParseBuckets(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid MOVE_TIME_BUCKETS: %w", err)
+		}
+		config.MoveTimeBuckets = buckets
+	}
+	return config, nil
+}
+
+// ParseBuckets parses comma separated, increasing bucket upper bounds
+func ParseBuckets(value string) ([]float64, error) {
+	var buckets []float64
+	for _, field := range strings.Split(value, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %q is not a number", strings.TrimSpace(field))
+		}
+		if len(buckets) > 0 && bound <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("buckets must increase, %g follows %g", bound, buckets[len(buckets)-1])
+		}
+		buckets = append(buckets, bound)
+	}
+	return buckets, nil
+}
+
+// Histogram counts observations into buckets, like a Prometheus histogram
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // per bucket, the last one above every bound
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates a histogram with the given increasing upper bounds
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: append([]float64(nil), bounds...),
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe records a value
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[sort.SearchFloat64s(h.bounds, value)]++
+	h.count++
+	h.sum += value
+}
+
+// HistogramBucket is the number of observations up to UpperBound
+type HistogramBucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// HistogramSnapshot is a histogram's cumulative buckets and percentiles.
+// Observations above the last bucket are only in Count.
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+	P50     float64           `json:"p50"`
+	P90     float64           `json:"p90"`
+	P99     float64           `json:"p99"`
+}
+
+// Snapshot returns the histogram's current state
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := HistogramSnapshot{
+		Buckets: make([]HistogramBucket, len(h.bounds)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		snapshot.Buckets[i] = HistogramBucket{UpperBound: bound, Count: cumulative}
+	}
+	snapshot.P50 = snapshot.Quantile(0.5)
+	snapshot.P90 = snapshot.Quantile(0.9)
+	snapshot.P99 = snapshot.Quantile(0.99)
+	return snapshot
+}
+
+// restore replaces the counts with the snapshot's, if it has the same buckets
+func (h *Histogram) restore(snapshot HistogramSnapshot) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(snapshot.Buckets) != len(h.bounds) {
+		return false
+	}
+	for i, bucket := range snapshot.Buckets {
+		if bucket.UpperBound != h.bounds[i] {
+			return false
+		}
+	}
+
+	var previous uint64
+	for i, bucket := range snapshot.Buckets {
+		h.counts[i] = bucket.Count - previous
+		previous = bucket.Count
+	}
+	h.counts[len(h.bounds)] = snapshot.Count - previous
+	h.count = snapshot.Count
+	h.sum = snapshot.Sum
+	return true
+}
+
+// Quantile estimates the q-quantile the way Prometheus' histogram_quantile
+// does, interpolating linearly within its bucket. Quantiles above the last
+// bucket are reported as its bound.
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 || len(s.Buckets) == 0 {
+		return 0
+	}
+
+	rank := q * float64(s.Count)
+	lower, below := 0.0, uint64(0)
+	for _, bucket := range s.Buckets {
+		if float64(bucket.Count) >= rank {
+			inBucket := bucket.Count - below
+			if inBucket == 0 {
+				return bucket.UpperBound
+			}
+			return lower + (bucket.UpperBound-lower)*(rank-float64(below))/float64(inBucket)
+		}
+		lower, below = bucket.UpperBound, bucket.Count
+	}
+	return lower
+}
@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// PartitionLag is how far the consumer is behind on one partition
+type PartitionLag struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+
+	// CurrentOffset is where the next message written to the partition goes,
+	// CommittedOffset where the consumer resumes, -1 before its first commit
+	CurrentOffset   int64 `json:"current_offset"`
+	CommittedOffset int64 `json:"committed_offset"`
+	Lag             int64 `json:"lag"`
+}
+
+// lagMonitor reads the partitions' end offsets and the group's committed
+// offsets from the brokers
+type lagMonitor struct {
+	client      *kafka.Client
+	groupID     string
+	topics      []string
+	startOffset int64 // where the group starts on partitions it never committed
+}
+
+func newLagMonitor(config ConsumerConfig, topics []string) (*lagMonitor, error) {
+	transport, err := config.Security.Transport()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &kafka.Client{
+		Addr:    kafka.TCP(config.Brokers...),
+		Timeout: 10 * time.Second,
+	}
+	if transport != nil {
+		client.Transport = transport
+	}
+
+	return &lagMonitor{
+		client:      client,
+		groupID:     config.GroupID,
+		topics:      topics,
+		startOffset: config.StartOffset,
+	}, nil
+}
+
+// check returns the lag of every partition of the topics
+func (m *lagMonitor) check(ctx context.Context) ([]PartitionLag, error) {
+	metadata, err := m.client.Metadata(ctx, &kafka.MetadataRequest{Topics: m.topics})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch topic metadata: %w", err)
+	}
+
+	ends := make(map[string][]kafka.OffsetRequest)
+	partitions := make(map[string][]int)
+	for _, topic := range metadata.Topics {
+		if topic.Error != nil {
+			return nil, fmt.Errorf("failed to fetch metadata of %s: %w", topic.Name, topic.Error)
+		}
+		for _, partition := range topic.Partitions {
+			ends[topic.Name] = append(ends[topic.Name], kafka.LastOffsetOf(partition.ID))
+			partitions[topic.Name] = append(partitions[topic.Name], partition.ID)
+		}
+	}
+
+	offsets, err := m.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: ends})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	committed, err := m.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: m.groupID, Topics: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	if committed.Error != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", committed.Error)
+	}
+
+	committedOffsets := make(map[string]map[int]int64)
+	for topic, topicPartitions := range committed.Topics {
+		committedOffsets[topic] = make(map[int]int64)
+		for _, partition := range topicPartitions {
+			if partition.Error == nil {
+				committedOffsets[topic][partition.Partition] = partition.CommittedOffset
+			}
+		}
+	}
+
+	var lags []PartitionLag
+	for topic, topicOffsets := range offsets.Topics {
+		for _, partition := range topicOffsets {
+			if partition.Error != nil {
+				return nil, fmt.Errorf("failed to list offsets of %s/%d: %w", topic, partition.Partition, partition.Error)
+			}
+
+			lag := PartitionLag{
+				Topic:           topic,
+				Partition:       partition.Partition,
+				CurrentOffset:   partition.LastOffset,
+				CommittedOffset: -1,
+			}
+			if offset, ok := committedOffsets[topic][partition.Partition]; ok && offset >= 0 {
+				lag.CommittedOffset = offset
+				lag.Lag = partition.LastOffset - offset
+			} else if m.startOffset == kafka.FirstOffset {
+				lag.Lag = partition.LastOffset - partition.FirstOffset
+			}
+			lags = append(lags, lag)
+		}
+	}
+
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags, nil
+}
+
+func (m *lagMonitor) close() {
+	if transport, ok := m.client.Transport.(*kafka.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,77 @@
+package kafka
+
+import "time"
+
+// liveHours is how many hours back LiveMetrics lists games and moves for
+const liveHours = 12
+
+// LiveMetrics is what a dashboard shows updating: the games, players and
+// queue right now, and the games and moves of the last hours
+type LiveMetrics struct {
+	ActiveGames       int        `json:"active_games"`
+	OnlinePlayers     int        `json:"online_players"`
+	QueuedPlayers     int        `json:"queued_players"`
+	GamesThisHour     int64      `json:"games_this_hour"`
+	MovesThisHour     int64      `json:"moves_this_hour"`
+	GamesToday        int64      `json:"games_today"`
+	RecentHours       []LiveHour `json:"recent_hours"` // oldest first, this hour last
+	MessagesProcessed int64      `json:"messages_processed"`
+	TotalLag          int64      `json:"total_lag"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// LiveHour is an hour's games and moves
+type LiveHour struct {
+	Hour  string `json:"hour"` // "2024-01-01-13"
+	Games int64  `json:"games"`
+	Moves int64  `json:"moves"`
+}
+
+// counts returns the games in progress, the players online and those queued
+func (ct *concurrencyTracker) counts() (games, online, queued int) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return len(ct.state.Games), ct.online(), len(ct.state.Queued)
+}
+
+// GetLiveMetrics returns the current games and players and the recent hours,
+// cheap enough to take every few seconds
+func (ma *MetricsAggregator) GetLiveMetrics() LiveMetrics {
+	now := time.Now()
+	live := LiveMetrics{UpdatedAt: now}
+	live.ActiveGames, live.OnlinePlayers, live.QueuedPlayers = ma.concurrency.counts()
+
+	ma.hourlyMetrics.mu.RLock()
+	for i := liveHours - 1; i >= 0; i-- {
+		hour := now.Add(-time.Duration(i) * time.Hour).Format("2006-01-02-15")
+		live.RecentHours = append(live.RecentHours, LiveHour{
+			Hour:  hour,
+			Games: ma.hourlyMetrics.GamesPerHour[hour],
+			Moves: ma.hourlyMetrics.MovesPerHour[hour],
+		})
+	}
+	ma.hourlyMetrics.mu.RUnlock()
+	current := live.RecentHours[len(live.RecentHours)-1]
+	live.GamesThisHour, live.MovesThisHour = current.Games, current.Moves
+
+	ma.dailyMetrics.mu.RLock()
+	live.GamesToday = ma.dailyMetrics.GamesPerDay[now.Format("2006-01-02")]
+	ma.dailyMetrics.mu.RUnlock()
+
+	return live
+}
+
+// GetLiveMetrics returns the aggregator's live metrics
+func (ep *EventProcessor) GetLiveMetrics() LiveMetrics {
+	return ep.aggregator.GetLiveMetrics()
+}
+
+// GetLiveMetrics returns the live metrics with the messages processed and the lag
+func (c *Consumer) GetLiveMetrics() LiveMetrics {
+	live := c.processor.GetLiveMetrics()
+	c.mu.RLock()
+	live.MessagesProcessed = c.stats.MessagesProcessed
+	live.TotalLag = c.stats.TotalLag
+	c.mu.RUnlock()
+	return live
+}
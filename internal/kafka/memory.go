@@ -0,0 +1,267 @@
+package kafka
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"connect-four-backend/internal/database"
+)
+
+// MemoryConfig bounds what the processor keeps in memory. Hours and days
+// older than their retention are dropped, and past MaxPlayers the players
+// seen least recently are dropped after being saved, to be loaded again
+// from the database when they next play.
+type MemoryConfig struct {
+	HourlyRetention        time.Duration `json:"hourly_retention"`
+	DailyRetention         time.Duration `json:"daily_retention"`
+	CompletedGameRetention time.Duration `json:"completed_game_retention"`
+	MaxPlayers             int           `json:"max_players"` // 0 for no cap, the aggregator's only applies with a database
+}
+
+// DefaultMemoryConfig keeps a week of hours, a month of days and 100k players
+func DefaultMemoryConfig() MemoryConfig {
+	return MemoryConfig{
+		HourlyRetention:        7 * 24 * time.Hour,
+		DailyRetention:         30 * 24 * time.Hour,
+		CompletedGameRetention: time.Hour,
+		MaxPlayers:             100000,
+	}
+}
+
+// MemoryConfigFromEnv reads HOURLY_RETENTION, DAILY_RETENTION,
+// COMPLETED_GAME_RETENTION and MAX_PLAYERS_IN_MEMORY over the defaults
+func MemoryConfigFromEnv() (MemoryConfig, error) {
+	config := DefaultMemoryConfig()
+	durations := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"HOURLY_RETENTION", &config.HourlyRetention},
+		{"DAILY_RETENTION", &config.DailyRetention},
+		{"COMPLETED_GAME_RETENTION", &config.CompletedGameRetention},
+	}
+	for _, duration := range durations {
+		value := os.Getenv(duration.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return config, fmt.Errorf("invalid %s %q: must be a positive duration", duration.name, value)
+		}
+		*duration.value = parsed
+	}
+	if value := os.Getenv("MAX_PLAYERS_IN_MEMORY"); value != "" {
+		maxPlayers, err := strconv.Atoi(value)
+		if err != nil || maxPlayers < 0 {
+			return config, fmt.Errorf("invalid MAX_PLAYERS_IN_MEMORY %q: must be a count", value)
+		}
+		config.MaxPlayers = maxPlayers
+	}
+	return config, nil
+}
+
+// MemoryStats are the sizes of what the processor holds in memory
+type MemoryStats struct {
+	Players         int       `json:"players"`
+	MaxPlayers      int       `json:"max_players"`
+	EvictedPlayers  int64     `json:"evicted_players"`
+	ReloadedPlayers int64     `json:"reloaded_players"`
+	HourlyBuckets   int       `json:"hourly_buckets"`
+	DailyBuckets    int       `json:"daily_buckets"`
+	TrackedPlayers  int       `json:"tracked_players"`
+	TrackedGames    int       `json:"tracked_games"`
+	TrackedHours    int       `json:"tracked_hours"`
+	HeapAllocBytes  uint64    `json:"heap_alloc_bytes"`
+	HeapObjects     uint64    `json:"heap_objects"`
+	Goroutines      int       `json:"goroutines"`
+	CollectedAt     time.Time `json:"collected_at"`
+}
+
+// seenPlayer is a player's name and when they were last seen, for evicting
+type seenPlayer struct {
+	name     string
+	lastSeen time.Time
+}
+
+// seenEarlier ranks the player seen longest ago first
+func seenEarlier(a, b seenPlayer) bool {
+	if !a.lastSeen.Equal(b.lastSeen) {
+		return a.lastSeen.Before(b.lastSeen)
+	}
+	return a.name < b.name
+}
+
+// evictOldest drops the players seen least recently until at most max are
+// left, keeping those changed since the last flush, and returns how many it dropped
+func (ps *playerShards) evictOldest(max int) int {
+	excess := ps.count() - max
+	if excess <= 0 {
+		return 0
+	}
+
+	oldest := newTopK(excess, seenEarlier)
+	ps.each(func(player *PlayerStats) {
+		oldest.offer(seenPlayer{name: player.Name, lastSeen: player.LastSeen})
+	})
+
+	evicted := 0
+	for _, candidate := range oldest.items {
+		shard := ps.shard(candidate.name)
+		shard.mu.Lock()
+		if _, dirty := shard.dirty[candidate.name]; !dirty {
+			delete(shard.players, candidate.name)
+			evicted++
+		}
+		shard.mu.Unlock()
+	}
+	return evicted
+}
+
+// add puts the player in unless they already are, not marking them changed
+func (ps *playerShards) add(player *PlayerStats) {
+	shard := ps.shard(player.Name)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, exists := shard.players[player.Name]; !exists {
+		shard.players[player.Name] = player
+	}
+}
+
+func (ps *playerShards) contains(name string) bool {
+	shard := ps.shard(name)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	_, exists := shard.players[name]
+	return exists
+}
+
+// reloadEvicted loads the players evicted earlier back from the database,
+// so their stats carry on rather than starting over as a new player's
+func (ma *MetricsAggregator) reloadEvicted(names ...string) error {
+	if ma.store == nil || atomic.LoadInt64(&ma.evictedPlayers) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		if ma.players.contains(name) {
+			continue
+		}
+		saved, err := ma.store.LoadPlayerStats(name)
+		if err != nil {
+			return fmt.Errorf("failed to reload player %s: %w", name, err)
+		}
+		if saved == nil {
+			continue
+		}
+		ma.players.add(playerFromSaved(*saved, now))
+		atomic.AddInt64(&ma.reloadedPlayers, 1)
+	}
+	return nil
+}
+
+// evictPlayers drops the players over the cap once they are saved, ma.mu
+// must be write-locked so none changes while they are dropped
+func (ma *MetricsAggregator) evictPlayers() {
+	if ma.store == nil || ma.memory.MaxPlayers <= 0 {
+		return
+	}
+	if evicted := ma.players.evictOldest(ma.memory.MaxPlayers); evicted > 0 {
+		atomic.AddInt64(&ma.evictedPlayers, int64(evicted))
+		log.Printf("Evicted %d players seen least recently, %d kept in memory", evicted, ma.memory.MaxPlayers)
+	}
+}
+
+// playerFromSaved rebuilds a player's stats from their saved counters
+func playerFromSaved(saved database.AggregatedPlayerStats, now time.Time) *PlayerStats {
+	player := &PlayerStats{
+		Name:             saved.Name,
+		GamesPlayed:      saved.GamesPlayed,
+		GamesWon:         saved.GamesWon,
+		GamesLost:        saved.GamesLost,
+		GamesDrawn:       saved.GamesDrawn,
+		TotalMoves:       saved.TotalMoves,
+		TotalGameTime:    saved.TotalGameTime,
+		Disconnections:   saved.Disconnections,
+		Reconnections:    saved.Reconnections,
+		TotalOfflineTime: saved.TotalOfflineTime,
+		FirstSeen:        saved.FirstSeen,
+		LastSeen:         saved.LastSeen,
+		CurrentStreak:    saved.CurrentStreak,
+		LongestStreak:    saved.LongestStreak,
+		IsActive:         now.Sub(saved.LastSeen) < 24*time.Hour,
+	}
+	if player.GamesPlayed > 0 {
+		player.AverageGameTime = float64(player.TotalGameTime) / float64(player.GamesPlayed)
+	}
+	if finished := player.GamesWon + player.GamesLost + player.GamesDrawn; finished > 0 {
+		player.WinRate = float64(player.GamesWon) / float64(finished) * 100
+	}
+	return player
+}
+
+// memoryConfig returns the retention windows and player cap
+func (ma *MetricsAggregator) memoryConfig() MemoryConfig {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+	return ma.memory
+}
+
+// GetMemoryStats returns how many players, hours and days the aggregator holds
+func (ma *MetricsAggregator) GetMemoryStats() MemoryStats {
+	ma.mu.RLock()
+	maxPlayers := ma.memory.MaxPlayers
+	if ma.store == nil {
+		maxPlayers = 0
+	}
+	ma.mu.RUnlock()
+
+	stats := MemoryStats{
+		Players:         ma.players.count(),
+		MaxPlayers:      maxPlayers,
+		EvictedPlayers:  atomic.LoadInt64(&ma.evictedPlayers),
+		ReloadedPlayers: atomic.LoadInt64(&ma.reloadedPlayers),
+	}
+	ma.hourlyMetrics.mu.RLock()
+	stats.HourlyBuckets = len(ma.hourlyMetrics.GamesPerHour)
+	ma.hourlyMetrics.mu.RUnlock()
+	ma.dailyMetrics.mu.RLock()
+	stats.DailyBuckets = len(ma.dailyMetrics.GamesPerDay)
+	ma.dailyMetrics.mu.RUnlock()
+	return stats
+}
+
+// GetMemoryStats returns the sizes of the aggregates and trackers and the
+// Go runtime's heap
+func (ep *EventProcessor) GetMemoryStats() MemoryStats {
+	stats := ep.aggregator.GetMemoryStats()
+	stats.TrackedPlayers = ep.playerTracker.GetPlayerCount()
+	stats.TrackedGames = ep.gameTracker.GetGameCount()
+	stats.TrackedHours = ep.hourlyTracker.GetHourCount()
+
+	var runtimeStats runtime.MemStats
+	runtime.ReadMemStats(&runtimeStats)
+	stats.HeapAllocBytes = runtimeStats.HeapAlloc
+	stats.HeapObjects = runtimeStats.HeapObjects
+	stats.Goroutines = runtime.NumGoroutine()
+	stats.CollectedAt = time.Now()
+	return stats
+}
+
+// cleanupTrackers drops finished games, old hours and the players seen
+// least recently past the cap from the processor's own trackers
+func (ep *EventProcessor) cleanupTrackers() {
+	memory := ep.aggregator.memoryConfig()
+	ep.gameTracker.CleanupCompletedGames(memory.CompletedGameRetention)
+	ep.hourlyTracker.CleanupOldStats(memory.HourlyRetention)
+	ep.playerTracker.UpdatePlayerActivity(24 * time.Hour)
+	if memory.MaxPlayers > 0 {
+		ep.playerTracker.EvictOldest(memory.MaxPlayers)
+	}
+}
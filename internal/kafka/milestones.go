@@ -0,0 +1,189 @@
+package kafka
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of milestone a player reaches
+const (
+	MilestoneWinStreak   = "win_streak"   // won this many games in a row
+	MilestoneGamesPlayed = "games_played" // finished this many games
+)
+
+// MilestoneConfig lists the win streaks and finished game counts announced
+// with a player_milestone event
+type MilestoneConfig struct {
+	WinStreaks []int64 `json:"win_streaks"`
+	Games      []int64 `json:"games"`
+}
+
+// DefaultMilestoneConfig returns milestones worth a notification
+func DefaultMilestoneConfig() MilestoneConfig {
+	return MilestoneConfig{
+		WinStreaks: []int64{5, 10, 20},
+		Games:      []int64{100, 500, 1000},
+	}
+}
+
+// MilestoneConfigFromEnv reads MILESTONE_WIN_STREAKS and MILESTONE_GAMES over the defaults
+func MilestoneConfigFromEnv() (MilestoneConfig, error) {
+	config := DefaultMilestoneConfig()
+	if value := os.Getenv("MILESTONE_WIN_STREAKS"); value != "" {
+		streaks, err := parseMilestones(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid MILESTONE_WIN_STREAKS: %w", err)
+		}
+		config.WinStreaks = streaks
+	}
+	if value := os.Getenv("MILESTONE_GAMES"); value != "" {
+		games, err := parseMilestones(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid MILESTONE_GAMES: %w", err)
+		}
+		config.Games = games
+	}
+	return config, nil
+}
+
+// parseMilestones parses comma separated positive counts
+func parseMilestones(value string) ([]int64, error) {
+	var milestones []int64
+	for _, field := range strings.Split(value, ",") {
+		count, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("milestone %q is not a positive count", strings.TrimSpace(field))
+		}
+		milestones = append(milestones, count)
+	}
+	return milestones, nil
+}
+
+// PlayerMilestone is a milestone a player reached in a game
+type PlayerMilestone struct {
+	Player    string    `json:"player"`
+	Kind      string    `json:"kind"`
+	Value     int64     `json:"value"`
+	GameID    string    `json:"game_id"`
+	ReachedAt time.Time `json:"reached_at"`
+}
+
+// MilestonePublisher emits player_milestone events, the AnalyticsService is one
+type MilestonePublisher interface {
+	EmitPlayerMilestone(milestone PlayerMilestone) error
+}
+
+// StreakEntry is a player's place on a streak leaderboard
+type StreakEntry struct {
+	Player      string `json:"player"`
+	Streak      int64  `json:"streak"`
+	GamesPlayed int64  `json:"games_played"`
+}
+
+// StreakLeaderboard ranks players by the win streak they are on and by
+// their longest one
+type StreakLeaderboard struct {
+	Current []StreakEntry `json:"current"`
+	Longest []StreakEntry `json:"longest"`
+}
+
+// SetMilestones replaces the milestones announced
+func (ma *MetricsAggregator) SetMilestones(config MilestoneConfig) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.milestoneConfig = config
+}
+
+// SetMilestonePublisher emits a player_milestone event for every milestone reached
+func (ma *MetricsAggregator) SetMilestonePublisher(publisher MilestonePublisher) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.milestonePublisher = publisher
+}
+
+// recordStreak extends or ends the player's win streak after a finished game
+// and returns the milestones reached, the player's shard must be locked
+func (ma *MetricsAggregator) recordStreak(player *PlayerStats, won bool, event GameEndedEvent) []PlayerMilestone {
+	if won {
+		player.CurrentStreak++
+		if player.CurrentStreak > player.LongestStreak {
+			player.LongestStreak = player.CurrentStreak
+		}
+	} else {
+		player.CurrentStreak = 0
+	}
+
+	var reached []PlayerMilestone
+	milestone := func(kind string, value int64) {
+		reached = append(reached, PlayerMilestone{
+			Player:    player.Name,
+			Kind:      kind,
+			Value:     value,
+			GameID:    event.GameID,
+			ReachedAt: event.Timestamp,
+		})
+	}
+	if won {
+		for _, streak := range ma.milestoneConfig.WinStreaks {
+			if player.CurrentStreak == streak {
+				milestone(MilestoneWinStreak, streak)
+			}
+		}
+	}
+	finished := player.GamesWon + player.GamesLost + player.GamesDrawn
+	for _, games := range ma.milestoneConfig.Games {
+		if finished == games {
+			milestone(MilestoneGamesPlayed, games)
+		}
+	}
+	return reached
+}
+
+// publishMilestones emits the milestones, a failure only loses the notification
+func (ma *MetricsAggregator) publishMilestones(milestones []PlayerMilestone) {
+	for _, milestone := range milestones {
+		log.Printf("Milestone: %s reached %s %d in game %s",
+			milestone.Player, milestone.Kind, milestone.Value, milestone.GameID)
+		if ma.milestonePublisher == nil {
+			continue
+		}
+		if err := ma.milestonePublisher.EmitPlayerMilestone(milestone); err != nil {
+			log.Printf("Failed to emit milestone of %s: %v", milestone.Player, err)
+		}
+	}
+}
+
+// GetStreakLeaderboard returns the players on the longest win streaks now and ever
+func (ma *MetricsAggregator) GetStreakLeaderboard(limit int) StreakLeaderboard {
+	current, longest := newTopK(limit, longerStreak), newTopK(limit, longerStreak)
+	ma.players.each(func(player *PlayerStats) {
+		if player.CurrentStreak > 0 {
+			current.offer(StreakEntry{
+				Player:      player.Name,
+				Streak:      player.CurrentStreak,
+				GamesPlayed: player.GamesPlayed,
+			})
+		}
+		if player.LongestStreak > 0 {
+			longest.offer(StreakEntry{
+				Player:      player.Name,
+				Streak:      player.LongestStreak,
+				GamesPlayed: player.GamesPlayed,
+			})
+		}
+	})
+
+	return StreakLeaderboard{Current: current.sorted(), Longest: longest.sorted()}
+}
+
+// longerStreak ranks the longer streak first, then the name first in order
+func longerStreak(a, b StreakEntry) bool {
+	if a.Streak != b.Streak {
+		return a.Streak > b.Streak
+	}
+	return a.Player < b.Player
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// playerShardCount spreads the players over this many locks, so workers
+// processing different players' events rarely wait on each other
+const playerShardCount = 64
+
+// playerShard holds the stats of the players whose name hashes to it
+type playerShard struct {
+	mu      sync.RWMutex
+	players map[string]*PlayerStats
+	dirty   map[string]struct{} // changed since the last flush
+}
+
+// playerShards are every player's stats, locked by shard rather than as a whole
+type playerShards struct {
+	shards [playerShardCount]*playerShard
+}
+
+// playerTotals are the sums over every player, updated with sync/atomic
+type playerTotals struct {
+	players        int64
+	newToday       int64
+	moves          int64
+	disconnections int64
+	reconnections  int64
+}
+
+func newPlayerShards() *playerShards {
+	ps := &playerShards{}
+	for i := range ps.shards {
+		ps.shards[i] = &playerShard{
+			players: make(map[string]*PlayerStats),
+			dirty:   make(map[string]struct{}),
+		}
+	}
+	return ps
+}
+
+func (ps *playerShards) shard(name string) *playerShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	return ps.shards[hash.Sum32()%playerShardCount]
+}
+
+// update changes the player's stats and marks them for the next flush. The
+// player is created first when create is set, update reports whether it was.
+func (ps *playerShards) update(name string, create func() *PlayerStats, change func(player *PlayerStats)) bool {
+	shard := ps.shard(name)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	player, exists := shard.players[name]
+	created := false
+	if !exists {
+		if create == nil {
+			return false
+		}
+		player = create()
+		shard.players[name] = player
+		created = true
+	}
+	change(player)
+	shard.dirty[name] = struct{}{}
+	return created
+}
+
+// each calls fn with every player, holding one shard's read lock at a time
+func (ps *playerShards) each(fn func(player *PlayerStats)) {
+	for _, shard := range ps.shards {
+		shard.mu.RLock()
+		for _, player := range shard.players {
+			fn(player)
+		}
+		shard.mu.RUnlock()
+	}
+}
+
+// eachLocked calls fn with every player, holding one shard's write lock at a time
+func (ps *playerShards) eachLocked(fn func(player *PlayerStats)) {
+	for _, shard := range ps.shards {
+		shard.mu.Lock()
+		for _, player := range shard.players {
+			fn(player)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+func (ps *playerShards) count() int {
+	count := 0
+	for _, shard := range ps.shards {
+		shard.mu.RLock()
+		count += len(shard.players)
+		shard.mu.RUnlock()
+	}
+	return count
+}
+
+// copy returns a copy of every player's stats
+func (ps *playerShards) copy() map[string]*PlayerStats {
+	players := make(map[string]*PlayerStats)
+	ps.each(func(player *PlayerStats) {
+		playerCopy := *player
+		players[player.Name] = &playerCopy
+	})
+	return players
+}
+
+// takeDirty returns copies of the players changed since the last call
+func (ps *playerShards) takeDirty() []PlayerStats {
+	var changed []PlayerStats
+	for _, shard := range ps.shards {
+		shard.mu.Lock()
+		for name := range shard.dirty {
+			if player, exists := shard.players[name]; exists {
+				changed = append(changed, *player)
+			}
+		}
+		shard.dirty = make(map[string]struct{})
+		shard.mu.Unlock()
+	}
+	return changed
+}
+
+// markDirty has the players saved with the next flush again
+func (ps *playerShards) markDirty(names []string) {
+	for _, name := range names {
+		shard := ps.shard(name)
+		shard.mu.Lock()
+		shard.dirty[name] = struct{}{}
+		shard.mu.Unlock()
+	}
+}
+
+// remove drops the player, reporting whether they were kept
+func (ps *playerShards) remove(name string) bool {
+	shard := ps.shard(name)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	_, exists := shard.players[name]
+	delete(shard.players, name)
+	delete(shard.dirty, name)
+	return exists
+}
+
+// replace swaps every player for the given ones, none dirty
+func (ps *playerShards) replace(players map[string]*PlayerStats) {
+	for _, shard := range ps.shards {
+		shard.mu.Lock()
+		shard.players = make(map[string]*PlayerStats)
+		shard.dirty = make(map[string]struct{})
+		shard.mu.Unlock()
+	}
+	for name, player := range players {
+		shard := ps.shard(name)
+		shard.mu.Lock()
+		shard.players[name] = player
+		shard.mu.Unlock()
+	}
+}
@@ -5,12 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"connect-four-backend/internal/bus"
+	"connect-four-backend/internal/metrics"
 	"connect-four-backend/internal/models"
+	"connect-four-backend/internal/tracing"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -26,44 +32,102 @@ const (
 	EventPlayerJoinedQueue  EventType = "player_joined_queue"
 	EventPlayerLeftQueue    EventType = "player_left_queue"
 	EventBotActivated       EventType = "bot_activated"
+	EventGameAnalysis       EventType = "game_analysis"
+	EventMatchFound         EventType = "match_found"
+	EventChatMessage        EventType = "chat_message"
+	EventEmoteSent          EventType = "emote_sent"
+	EventHighLatency        EventType = "high_latency"
+	EventPlayerFlagged      EventType = "player_flagged"
+	EventPlayerMilestone    EventType = "player_milestone"
+	EventPlayerErased       EventType = "player_erased"
+
+	// Tournament lifecycle events
+	EventTournamentCreated       EventType = "tournament_created"
+	EventTournamentStarted       EventType = "tournament_started"
+	EventTournamentMatchFinished EventType = "tournament_match_finished"
+	EventTournamentFinished      EventType = "tournament_finished"
+	EventTournamentCancelled     EventType = "tournament_cancelled"
 )
 
 // Producer handles Kafka message production with async capabilities
 type Producer struct {
 	writer      *kafka.Writer
-	errorChan   chan error
+	serializer  Serializer
+	spool       *spool        // nil unless spooling is configured
+	flushWriter *kafka.Writer // synchronous, so a segment is only removed once delivered
+	router      TopicRouter
+	brokers     []string
 	stopChan    chan struct{}
 	wg          sync.WaitGroup
 	isRunning   bool
 	mu          sync.RWMutex
 	stats       ProducerStats
+
+	failureListeners []func(DeliveryFailure) // guarded by mu
+	backpressure     BackpressureConfig      // for the analytics service
 }
 
-// ProducerStats tracks producer performance metrics
+// ProducerStats tracks producer performance metrics. Writes are asynchronous,
+// so a queued message is counted as sent or errored once Kafka answers.
 type ProducerStats struct {
+	MessagesQueued   int64     `json:"messages_queued"`
 	MessagesSent     int64     `json:"messages_sent"`
 	MessagesErrored  int64     `json:"messages_errored"`
 	LastMessageTime  time.Time `json:"last_message_time"`
 	LastErrorTime    time.Time `json:"last_error_time"`
 	LastError        string    `json:"last_error"`
+
+	// Spool is set when spooling is configured
+	Spool *SpoolStats `json:"spool,omitempty"`
+}
+
+// DeliveryFailure is a message Kafka didn't accept after every retry
+type DeliveryFailure struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Err     error
+	Spooled bool // kept in the spool to be sent again
 }
 
-// AnalyticsService provides high-level game event emission
+// AnalyticsService provides high-level game event emission. Events are
+// queued and published on a goroutine of their own, so a slow bus never
+// holds up a move.
 type AnalyticsService struct {
-	producer *Producer
+	publisher  bus.Publisher
+	serializer Serializer
+	router     TopicRouter
+	queue      *eventQueue
+	breaker    *circuitBreaker
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+
+	// Both can be changed at runtime from the admin API
+	mu       sync.RWMutex
 	enabled  bool
+	sampling SamplingConfig
+	instance Metadata // stamped on every event
+
+	statsMu sync.Mutex
+	stats   AnalyticsStats
+	latency prometheus.Histogram // time to publish each event
 }
 
 // BaseEvent represents the common structure for all game events
 type BaseEvent struct {
-	EventType EventType `json:"event_type"`
-	EventID   string    `json:"event_id"`
-	Timestamp time.Time `json:"timestamp"`
-	GameID    string    `json:"game_id"`
-	Metadata  Metadata  `json:"metadata"`
+	EventType     EventType `json:"event_type"`
+	SchemaVersion int       `json:"schema_version"` // see SchemaVersion, 0 for events written before versioning
+	EventID       string    `json:"event_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	GameID        string    `json:"game_id"`
+	Metadata      Metadata  `json:"metadata"`
 }
 
-// Metadata contains additional context for events
+// Metadata contains additional context for events. The analytics service
+// stamps the server's ServerID, Version and Environment on every event, the
+// WebSocket handler fills SessionID and TraceID for events a connection caused.
+// TraceParent is the W3C traceparent of the span that emitted the event, the
+// consumer's span for it continues that trace.
 type Metadata struct {
 	ServerID    string            `json:"server_id,omitempty"`
 	Version     string            `json:"version,omitempty"`
@@ -71,9 +135,16 @@ type Metadata struct {
 	UserAgent   string            `json:"user_agent,omitempty"`
 	IPAddress   string            `json:"ip_address,omitempty"`
 	SessionID   string            `json:"session_id,omitempty"`
+	TraceID     string            `json:"trace_id,omitempty"`
+	TraceParent string            `json:"traceparent,omitempty"`
 	Custom      map[string]string `json:"custom,omitempty"`
 }
 
+// traceParent lets sendEvent read the traceparent of any event embedding BaseEvent
+func (e BaseEvent) traceParent() string {
+	return e.Metadata.TraceParent
+}
+
 // PlayerInfo represents player information in events
 type PlayerInfo struct {
 	ID        string `json:"id"`
@@ -101,7 +172,7 @@ type MovePlayedEvent struct {
 	Row          int        `json:"row"`
 	MoveNumber   int        `json:"move_number"`
 	TimeTaken    int64      `json:"time_taken_ms"`
-	BoardState   [][]int    `json:"board_state"`
+	BoardState   [][]int    `json:"board_state"` // nil unless the move's board was sampled
 	ValidMoves   []int      `json:"valid_moves"`
 	BotReasoning string     `json:"bot_reasoning,omitempty"`
 }
@@ -141,6 +212,132 @@ type PlayerReconnectedEvent struct {
 	GameState        string        `json:"game_state"`
 }
 
+// GameAnalysisEvent carries the post-game move quality report
+type GameAnalysisEvent struct {
+	BaseEvent
+	Moves   []models.MoveAnalysis          `json:"moves"`
+	Players []models.PlayerAnalysisSummary `json:"players"`
+}
+
+// MatchFoundEvent records how a match was made so the rating range curve can be tuned
+type MatchFoundEvent struct {
+	BaseEvent
+	Players     []PlayerInfo `json:"players"`
+	Ratings     []int        `json:"ratings"`
+	QueueType   string       `json:"queue_type"`
+	RatingGap   int          `json:"rating_gap"`
+	RatingRange int          `json:"rating_range"`
+	WaitTime    int64        `json:"wait_time_ms"`
+	QueueSize   int          `json:"queue_size"` // players left waiting in the queue type
+}
+
+// QueueJoinedEvent records a player joining a matchmaking queue. QueueSize is
+// the queue type's depth after the player joined.
+type QueueJoinedEvent struct {
+	BaseEvent
+	Player    PlayerInfo `json:"player"`
+	QueueType string     `json:"queue_type"`
+	Rating    int        `json:"rating"`
+	QueueSize int        `json:"queue_size"`
+}
+
+// QueueLeftEvent records a player leaving a queue without a match. QueueSize
+// is the queue type's depth after the player left.
+type QueueLeftEvent struct {
+	BaseEvent
+	Player    PlayerInfo `json:"player"`
+	QueueType string     `json:"queue_type"`
+	Rating    int        `json:"rating"`
+	QueueSize int        `json:"queue_size"`
+	WaitTime  int64      `json:"wait_time_ms"`
+	Reason    string     `json:"reason"` // cancelled or expired
+}
+
+// BotActivatedEvent records a player matched against a bot after waiting for a human
+type BotActivatedEvent struct {
+	BaseEvent
+	Player    PlayerInfo `json:"player"`
+	BotName   string     `json:"bot_name"`
+	QueueType string     `json:"queue_type"`
+	WaitTime  int64      `json:"wait_time_ms"`
+}
+
+// PlayerFlaggedEvent records the analytics consumer suspecting a player of
+// cheating, GameID is the game that tipped it off
+type PlayerFlaggedEvent struct {
+	BaseEvent
+	FlagID    string  `json:"flag_id"`
+	Player    string  `json:"player"`
+	Reason    string  `json:"reason"`
+	Detail    string  `json:"detail"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+}
+
+// PlayerMilestoneEvent records a player reaching a win streak or a number of
+// finished games, for notifications to pick up
+type PlayerMilestoneEvent struct {
+	BaseEvent
+	Player    string `json:"player"`
+	Milestone string `json:"milestone"`
+	Value     int64  `json:"value"`
+}
+
+// PlayerErasedEvent tells downstream readers to forget a player whose data
+// was erased at their request
+type PlayerErasedEvent struct {
+	BaseEvent
+	Player string `json:"player"`
+}
+
+// TournamentEvent represents a tournament lifecycle change. GameID is set to
+// the match's game for match events.
+type TournamentEvent struct {
+	BaseEvent
+	TournamentID string `json:"tournament_id"`
+	Name         string `json:"name"`
+	Format       string `json:"format"`
+	Status       string `json:"status"`
+	PlayerCount  int    `json:"player_count"`
+	Rounds       int    `json:"rounds"`
+	Round        int    `json:"round,omitempty"`
+	MatchID      string `json:"match_id,omitempty"`
+	WinnerName   string `json:"winner_name,omitempty"`
+	IsDraw       bool   `json:"is_draw,omitempty"`
+	Bye          bool   `json:"bye,omitempty"`
+}
+
+// ChatMessageEvent records a chat message without its text
+type ChatMessageEvent struct {
+	BaseEvent
+	SenderID   string `json:"sender_id"`
+	SenderName string `json:"sender_name"`
+	Role       string `json:"role"`
+	Length     int    `json:"length"`
+	Filtered   bool   `json:"filtered"`
+}
+
+// EmoteSentEvent records a quick reaction sent in a game
+type EmoteSentEvent struct {
+	BaseEvent
+	SenderID   string `json:"sender_id"`
+	SenderName string `json:"sender_name"`
+	Role       string `json:"role"`
+	Emote      string `json:"emote"`
+}
+
+// HighLatencyEvent records a player's connection starting to lag during a
+// game, to look into lag-related disputes
+type HighLatencyEvent struct {
+	BaseEvent
+	Player      PlayerInfo `json:"player"`
+	LatencyMs   int        `json:"latency_ms"`
+	PreviousMs  int        `json:"previous_ms"`
+	ThresholdMs int        `json:"threshold_ms"`
+	MoveNumber  int        `json:"move_number"`
+	GameState   string     `json:"game_state"`
+}
+
 // ProducerConfig holds configuration for the Kafka producer
 type ProducerConfig struct {
 	Brokers         []string      `json:"brokers"`
@@ -152,6 +349,23 @@ type ProducerConfig struct {
 	Compression     string        `json:"compression"`
 	Retries         int           `json:"retries"`
 	RetryBackoff    time.Duration `json:"retry_backoff"`
+
+	// Security configures SASL and TLS, plain connections by default
+	Security SecurityConfig `json:"security"`
+
+	// Routes sends event types to their own topics, the rest go to Topic
+	Routes map[EventType]string `json:"routes"`
+
+	// Serialization defaults to JSON
+	Serialization SerializationConfig `json:"serialization"`
+
+	// Spool buffers events on disk while the brokers are unreachable, off
+	// when its directory is empty
+	Spool SpoolConfig `json:"spool"`
+
+	// Backpressure bounds the analytics service's queue and stops emitting
+	// while the bus keeps failing
+	Backpressure BackpressureConfig `json:"backpressure"`
 }
 
 // DefaultProducerConfig returns a production-ready configuration
@@ -166,6 +380,7 @@ func DefaultProducerConfig(brokers []string) ProducerConfig {
 		Compression:     "snappy",
 		Retries:         3,
 		RetryBackoff:    100 * time.Millisecond,
+		Backpressure:    DefaultBackpressureConfig(),
 	}
 }
 
@@ -186,9 +401,9 @@ func NewProducer(config ProducerConfig) (*Producer, error) {
 		compression = kafka.Snappy // Default to snappy
 	}
 
+	// Every message names its topic, see TopicRouter
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(config.Brokers...),
-		Topic:        config.Topic,
 		Balancer:     &kafka.Hash{}, // Use hash balancer for consistent partitioning
 		RequiredAcks: kafka.RequiredAcks(config.RequiredAcks),
 		Async:        true, // Enable async mode for better performance
@@ -200,16 +415,62 @@ func NewProducer(config ProducerConfig) (*Producer, error) {
 		ErrorLogger:  kafka.LoggerFunc(log.Printf),
 	}
 
+	transport, err := config.Security.Transport()
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		writer.Transport = transport
+	}
+
+	router := TopicRouter{Default: config.Topic, Routes: config.Routes}
+	serializer, err := NewSerializer(config.Serialization, router)
+	if err != nil {
+		return nil, err
+	}
+
 	producer := &Producer{
-		writer:    writer,
-		errorChan: make(chan error, 100), // Buffered channel for errors
-		stopChan:  make(chan struct{}),
-		stats:     ProducerStats{},
+		writer:       writer,
+		serializer:   serializer,
+		router:       router,
+		brokers:      config.Brokers,
+		backpressure: config.Backpressure,
+		stopChan:     make(chan struct{}),
+		stats:        ProducerStats{},
 	}
 
-	// Start error handling goroutine
-	producer.wg.Add(1)
-	go producer.handleErrors()
+	// Async writes only succeed or fail once the writer is done with the batch
+	writer.Completion = producer.completed
+
+	if config.Spool.Dir != "" {
+		if config.Spool.FlushInterval <= 0 {
+			config.Spool.FlushInterval = DefaultSpoolConfig(config.Spool.Dir).FlushInterval
+		}
+		producer.spool, err = openSpool(config.Spool)
+		if err != nil {
+			return nil, err
+		}
+		producer.flushWriter = &kafka.Writer{
+			Addr:         kafka.TCP(config.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequiredAcks(config.RequiredAcks),
+			BatchSize:    config.BatchSize,
+			BatchTimeout: config.BatchTimeout,
+			Compression:  compression,
+			MaxAttempts:  config.Retries,
+			BatchBytes:   int64(config.MaxMessageBytes),
+			ErrorLogger:  kafka.LoggerFunc(log.Printf),
+		}
+		if transport != nil {
+			producer.flushWriter.Transport = transport
+		}
+		if backlog := producer.spool.backlog(); backlog > 0 {
+			log.Printf("Kafka spool has %d events from a previous run", backlog)
+		}
+
+		producer.wg.Add(1)
+		go producer.flushSpool(config.Spool.FlushInterval)
+	}
 
 	producer.mu.Lock()
 	producer.isRunning = true
@@ -232,15 +493,26 @@ func (p *Producer) Close() error {
 	close(p.stopChan)
 	p.wg.Wait()
 
-	// Close error channel
-	close(p.errorChan)
+	// Close writer, batches it fails to deliver are spooled by completed
+	err := p.writer.Close()
+
+	if p.spool != nil {
+		p.flushWriter.Close()
+		if spoolErr := p.spool.close(); err == nil {
+			err = spoolErr
+		}
+	}
+
+	return err
+}
 
-	// Close writer
-	return p.writer.Close()
+// SendMessage sends a message to the default topic asynchronously
+func (p *Producer) SendMessage(key string, value []byte, headers ...kafka.Header) error {
+	return p.SendMessageTo(p.router.Default, key, value, headers...)
 }
 
-// SendMessage sends a message to Kafka asynchronously
-func (p *Producer) SendMessage(key string, value []byte) error {
+// SendMessageTo sends a message to the topic asynchronously
+func (p *Producer) SendMessageTo(topic, key string, value []byte, headers ...kafka.Header) error {
 	p.mu.RLock()
 	if !p.isRunning {
 		p.mu.RUnlock()
@@ -249,12 +521,19 @@ func (p *Producer) SendMessage(key string, value []byte) error {
 	p.mu.RUnlock()
 
 	message := kafka.Message{
-		Key:   []byte(key),
-		Value: value,
-		Time:  time.Now(),
+		Topic:   topic,
+		Key:     []byte(key),
+		Value:   value,
+		Headers: headers,
+		Time:    time.Now(),
+	}
+
+	// Keep events in order behind the ones already spooled
+	if p.spool != nil && p.spool.backlog() > 0 {
+		return p.spool.append(message)
 	}
 
-	// Send message asynchronously
+	// Send message asynchronously, completed reports how the delivery went
 	err := p.writer.WriteMessages(context.Background(), message)
 	
 	p.mu.Lock()
@@ -263,35 +542,111 @@ func (p *Producer) SendMessage(key string, value []byte) error {
 		p.stats.LastErrorTime = time.Now()
 		p.stats.LastError = err.Error()
 	} else {
-		p.stats.MessagesSent++
-		p.stats.LastMessageTime = time.Now()
+		p.stats.MessagesQueued++
 	}
 	p.mu.Unlock()
 
 	return err
 }
 
+// OnDeliveryFailure registers a listener called for every message that fails
+// to be delivered. It runs on the writer's goroutine, so it must not block.
+func (p *Producer) OnDeliveryFailure(listener func(DeliveryFailure)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failureListeners = append(p.failureListeners, listener)
+}
+
 // GetStats returns current producer statistics
 func (p *Producer) GetStats() ProducerStats {
 	p.mu.RLock()
-	defer p.mu.RUnlock()
-	return p.stats
+	stats := p.stats
+	p.mu.RUnlock()
+
+	if p.spool != nil {
+		spoolStats := p.spool.getStats()
+		stats.Spool = &spoolStats
+	}
+	return stats
 }
 
-// handleErrors processes async errors from the Kafka writer
-func (p *Producer) handleErrors() {
+// completed is called by the async writer for every batch it finishes. Failed
+// batches are spooled when spooling is configured, and lost otherwise.
+func (p *Producer) completed(messages []kafka.Message, err error) {
+	if err == nil {
+		p.mu.Lock()
+		p.stats.MessagesSent += int64(len(messages))
+		p.stats.LastMessageTime = time.Now()
+		p.mu.Unlock()
+		return
+	}
+
+	spooled := false
+	if p.spool != nil {
+		if spoolErr := p.spool.append(messages...); spoolErr != nil {
+			log.Printf("Failed to spool %d Kafka events: %v", len(messages), spoolErr)
+		} else {
+			spooled = true
+			log.Printf("Spooled %d Kafka events after delivery failed: %v", len(messages), err)
+		}
+	}
+	if !spooled {
+		log.Printf("Kafka producer failed to deliver %d messages to %s: %v", len(messages), messages[0].Topic, err)
+	}
+
+	p.mu.Lock()
+	p.stats.MessagesErrored += int64(len(messages))
+	p.stats.LastErrorTime = time.Now()
+	p.stats.LastError = err.Error()
+	listeners := p.failureListeners
+	p.mu.Unlock()
+
+	for _, message := range messages {
+		failure := DeliveryFailure{
+			Topic:   message.Topic,
+			Key:     string(message.Key),
+			Value:   message.Value,
+			Err:     err,
+			Spooled: spooled,
+		}
+		for _, listener := range listeners {
+			listener(failure)
+		}
+	}
+}
+
+// flushSpool sends spooled events once the brokers can be reached again.
+// Segments are removed only after all their events were written, so a flush
+// cut short sends some events twice rather than losing them.
+func (p *Producer) flushSpool(interval time.Duration) {
 	defer p.wg.Done()
 
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case err := <-p.errorChan:
+		case <-ticker.C:
+			if p.spool.backlog() == 0 || !p.brokersReachable() {
+				continue
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				select {
+				case <-p.stopChan:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			flushed, err := p.flushSegments(ctx)
+			cancel()
+
+			if flushed > 0 {
+				log.Printf("Flushed %d spooled Kafka events, %d still spooled", flushed, p.spool.backlog())
+			}
 			if err != nil {
-				log.Printf("Kafka producer error: %v", err)
-				p.mu.Lock()
-				p.stats.MessagesErrored++
-				p.stats.LastErrorTime = time.Now()
-				p.stats.LastError = err.Error()
-				p.mu.Unlock()
+				log.Printf("Failed to flush Kafka spool: %v", err)
 			}
 		case <-p.stopChan:
 			return
@@ -299,56 +654,320 @@ func (p *Producer) handleErrors() {
 	}
 }
 
+func (p *Producer) flushSegments(ctx context.Context) (int, error) {
+	names, err := p.spool.seal()
+	if err != nil {
+		return 0, err
+	}
+
+	var flushed int
+	for _, name := range names {
+		messages, err := p.spool.read(name)
+		if err != nil {
+			return flushed, err
+		}
+		for i := range messages {
+			// Spooled before events were routed
+			if messages[i].Topic == "" {
+				messages[i].Topic = p.router.Default
+			}
+		}
+		if len(messages) > 0 {
+			if err := p.flushWriter.WriteMessages(ctx, messages...); err != nil {
+				return flushed, err
+			}
+		}
+		if err := p.spool.flushed(name); err != nil {
+			return flushed, err
+		}
+		flushed += len(messages)
+
+		p.mu.Lock()
+		p.stats.MessagesSent += int64(len(messages))
+		p.stats.LastMessageTime = time.Now()
+		p.mu.Unlock()
+	}
+
+	return flushed, nil
+}
+
+// brokersReachable checks that any broker accepts a connection, so the spool
+// isn't read while Kafka is still down
+func (p *Producer) brokersReachable() bool {
+	for _, broker := range p.brokers {
+		conn, err := net.DialTimeout("tcp", broker, 5*time.Second)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+	}
+	return false
+}
+
 // NewAnalyticsService creates a new analytics service
 func NewAnalyticsService(producer *Producer, enabled bool) *AnalyticsService {
-	return &AnalyticsService{
-		producer: producer,
-		enabled:  enabled,
+	service := newAnalyticsService(producer, producer.serializer, producer.router, producer.backpressure, enabled)
+
+	// Writes are asynchronous, most failures only show once the writer gives
+	// up on a batch. Spooled events aren't lost, so they don't count.
+	producer.OnDeliveryFailure(func(failure DeliveryFailure) {
+		if !failure.Spooled {
+			service.breaker.failure(failure.Err)
+		}
+	})
+	return service
+}
+
+// NewBusAnalyticsService emits events on another message bus, routed and
+// serialized as the producer config says
+func NewBusAnalyticsService(publisher bus.Publisher, config ProducerConfig, enabled bool) (*AnalyticsService, error) {
+	router := TopicRouter{Default: config.Topic, Routes: config.Routes}
+	serializer, err := NewSerializer(config.Serialization, router)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAnalyticsService(publisher, serializer, router, config.Backpressure, enabled), nil
+}
+
+func newAnalyticsService(publisher bus.Publisher, serializer Serializer, router TopicRouter, backpressure BackpressureConfig, enabled bool) *AnalyticsService {
+	service := &AnalyticsService{
+		publisher:  publisher,
+		serializer: serializer,
+		router:     router,
+		queue:      newEventQueue(backpressure.QueueSize),
+		breaker:    newCircuitBreaker(backpressure),
+		stopChan:   make(chan struct{}),
+		enabled:    enabled,
+		sampling:   DefaultSamplingConfig(),
+		latency:    metrics.NewHistogram("connect_four_analytics_publish_seconds", "Time to hand an analytics event to the bus", metrics.DefaultLatencyBuckets),
+	}
+
+	service.wg.Add(1)
+	go service.publishQueued()
+	return service
+}
+
+// Close publishes the events still queued, giving up when ctx is done
+func (a *AnalyticsService) Close(ctx context.Context) error {
+	close(a.stopChan)
+	a.wg.Wait()
+
+	for _, message := range a.queue.take() {
+		if ctx.Err() != nil {
+			return fmt.Errorf("analytics events left unpublished: %w", ctx.Err())
+		}
+		a.publish(ctx, message)
+	}
+	return nil
+}
+
+// GetStats returns how many events were published and dropped
+func (a *AnalyticsService) GetStats() AnalyticsStats {
+	a.statsMu.Lock()
+	stats := a.stats
+	a.statsMu.Unlock()
+
+	stats.QueueLength = a.queue.len()
+	stats.CircuitOpen, stats.CircuitOpenedAt, stats.CircuitTrips = a.breaker.state()
+	return stats
+}
+
+// enqueue hands the message to the publishing goroutine, dropping it while
+// the circuit breaker is open
+func (a *AnalyticsService) enqueue(message bus.Message) {
+	if !a.breaker.allow() {
+		a.statsMu.Lock()
+		a.stats.DroppedCircuitOpen++
+		a.statsMu.Unlock()
+		return
+	}
+
+	dropped := a.queue.push(message)
+
+	a.statsMu.Lock()
+	a.stats.EventsQueued++
+	if dropped {
+		a.stats.DroppedQueueFull++
+	}
+	a.statsMu.Unlock()
+}
+
+func (a *AnalyticsService) publishQueued() {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case <-a.queue.ready:
+			for _, message := range a.queue.take() {
+				if !a.breaker.allow() {
+					a.statsMu.Lock()
+					a.stats.DroppedCircuitOpen++
+					a.statsMu.Unlock()
+					continue
+				}
+				a.publish(context.Background(), message)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *AnalyticsService) publish(ctx context.Context, message bus.Message) {
+	// The span continues the trace of whatever emitted the event, and the
+	// consumer's span continues this one
+	ctx, span := tracing.Start(tracing.ContextWithRemoteParent(ctx, message.Headers[traceParentHeader]),
+		"publish "+message.Topic, tracing.KindProducer,
+		tracing.String("messaging.destination.name", message.Topic),
+		tracing.String("messaging.message.key", message.Key))
+	defer span.End()
+	if traceParent := span.TraceParent(); traceParent != "" {
+		headers := make(map[string]string, len(message.Headers))
+		for key, value := range message.Headers {
+			headers[key] = value
+		}
+		headers[traceParentHeader] = traceParent
+		message.Headers = headers
+	}
+
+	start := time.Now()
+	err := a.publisher.Publish(ctx, message)
+	a.latency.Observe(time.Since(start).Seconds())
+	span.RecordError(err)
+
+	a.statsMu.Lock()
+	if err != nil {
+		a.stats.PublishErrors++
+	} else {
+		a.stats.EventsPublished++
+	}
+	a.statsMu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to publish %s analytics event: %v", message.Topic, err)
+		a.breaker.failure(err)
+	} else {
+		a.breaker.success()
 	}
 }
 
 // IsEnabled returns whether analytics is enabled
 func (a *AnalyticsService) IsEnabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	return a.enabled
 }
 
 // SetEnabled enables or disables analytics
 func (a *AnalyticsService) SetEnabled(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.enabled = enabled
 }
 
+// Sampling returns the current sample rates
+func (a *AnalyticsService) Sampling() SamplingConfig {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	sampling := SamplingConfig{Rates: make(map[EventType]float64), BoardSnapshots: a.sampling.BoardSnapshots}
+	for eventType, rate := range a.sampling.Rates {
+		sampling.Rates[eventType] = rate
+	}
+	return sampling
+}
+
+// SetSampling replaces the sample rates
+func (a *AnalyticsService) SetSampling(sampling SamplingConfig) error {
+	if err := sampling.Validate(); err != nil {
+		return err
+	}
+
+	rates := make(map[EventType]float64, len(sampling.Rates))
+	for eventType, rate := range sampling.Rates {
+		rates[eventType] = rate
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sampling = SamplingConfig{Rates: rates, BoardSnapshots: sampling.BoardSnapshots}
+	return nil
+}
+
+// SetInstance sets the server instance, build version and environment
+// stamped on every event
+func (a *AnalyticsService) SetInstance(serverID, version, environment string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.instance = Metadata{ServerID: serverID, Version: version, Environment: environment}
+}
+
+// stamp fills in the instance fields the event's metadata leaves empty
+func (a *AnalyticsService) stamp(metadata Metadata) Metadata {
+	a.mu.RLock()
+	instance := a.instance
+	a.mu.RUnlock()
+
+	if metadata.ServerID == "" {
+		metadata.ServerID = instance.ServerID
+	}
+	if metadata.Version == "" {
+		metadata.Version = instance.Version
+	}
+	if metadata.Environment == "" {
+		metadata.Environment = instance.Environment
+	}
+	return metadata
+}
+
+// sample picks whether an event of the type is emitted
+func (a *AnalyticsService) sample(eventType EventType) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return sampled(a.sampling.rate(eventType))
+}
+
+// sampleBoard picks whether a move_played event carries the board
+func (a *AnalyticsService) sampleBoard() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return sampled(a.sampling.BoardSnapshots)
+}
+
 // EmitGameStarted emits a game started event
 func (a *AnalyticsService) EmitGameStarted(game *models.Game, metadata Metadata) error {
-	if !a.enabled {
+	if !a.IsEnabled() {
 		return nil
 	}
 
 	event := GameStartedEvent{
 		BaseEvent: BaseEvent{
-			EventType: EventGameStarted,
-			EventID:   uuid.New().String(),
-			Timestamp: time.Now(),
-			GameID:    game.ID.String(),
-			Metadata:  metadata,
+			EventType:     EventGameStarted,
+			SchemaVersion: SchemaVersion(EventGameStarted),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        game.ID.String(),
+			Metadata:      a.stamp(metadata),
 		},
-		Players:     convertPlayersToInfo(game.Players[:]),
+		Players:     convertPlayersToInfo(game.AllPlayers()),
 		GameMode:    "1v1",
 		BoardSize:   "7x6",
 		StartPlayer: int(game.CurrentTurn),
 	}
 
-	return a.sendEvent(string(EventGameStarted), game.ID.String(), event)
+	return a.sendEvent(EventGameStarted, game.ID.String(), event)
 }
 
 // EmitMovePlayed emits a move played event
 func (a *AnalyticsService) EmitMovePlayed(game *models.Game, move *models.Move, timeTaken time.Duration, botReasoning string, metadata Metadata) error {
-	if !a.enabled {
+	if !a.IsEnabled() {
 		return nil
 	}
 
 	// Find the player who made the move
 	var player *models.Player
-	for _, p := range game.Players {
+	for _, p := range game.AllPlayers() {
 		if p.ID == move.PlayerID {
 			player = p
 			break
@@ -358,39 +977,41 @@ func (a *AnalyticsService) EmitMovePlayed(game *models.Game, move *models.Move,
 		return fmt.Errorf("player not found for move")
 	}
 
-	// Convert board grid for JSON
-	boardState := make([][]int, 6)
-	for i := range boardState {
-		boardState[i] = make([]int, 7)
-		for j := range boardState[i] {
-			boardState[i][j] = game.Board[i][j]
-		}
-	}
-
 	event := MovePlayedEvent{
 		BaseEvent: BaseEvent{
-			EventType: EventMovePlayed,
-			EventID:   uuid.New().String(),
-			Timestamp: time.Now(),
-			GameID:    game.ID.String(),
-			Metadata:  metadata,
+			EventType:     EventMovePlayed,
+			SchemaVersion: SchemaVersion(EventMovePlayed),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        game.ID.String(),
+			Metadata:      a.stamp(metadata),
 		},
 		Player:       convertPlayerToInfo(player),
 		Column:       move.Column,
 		Row:          move.Row,
 		MoveNumber:   a.countMovesOnBoard(game.Board), // Use current move count
 		TimeTaken:    timeTaken.Milliseconds(),
-		BoardState:   boardState,
 		ValidMoves:   a.getValidMoves(game), // Helper function to get valid moves
 		BotReasoning: botReasoning,
 	}
 
-	return a.sendEvent(string(EventMovePlayed), game.ID.String(), event)
+	// Only sampled moves carry the board
+	if a.sampleBoard() {
+		event.BoardState = make([][]int, 6)
+		for i := range event.BoardState {
+			event.BoardState[i] = make([]int, 7)
+			for j := range event.BoardState[i] {
+				event.BoardState[i][j] = game.Board[i][j]
+			}
+		}
+	}
+
+	return a.sendEvent(EventMovePlayed, game.ID.String(), event)
 }
 
 // EmitGameEnded emits a game ended event
 func (a *AnalyticsService) EmitGameEnded(game *models.Game, endReason string, metadata Metadata) error {
-	if !a.enabled {
+	if !a.IsEnabled() {
 		return nil
 	}
 
@@ -424,13 +1045,14 @@ func (a *AnalyticsService) EmitGameEnded(game *models.Game, endReason string, me
 
 	event := GameEndedEvent{
 		BaseEvent: BaseEvent{
-			EventType: EventGameEnded,
-			EventID:   uuid.New().String(),
-			Timestamp: time.Now(),
-			GameID:    game.ID.String(),
-			Metadata:  metadata,
+			EventType:     EventGameEnded,
+			SchemaVersion: SchemaVersion(EventGameEnded),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        game.ID.String(),
+			Metadata:      a.stamp(metadata),
 		},
-		Players:    convertPlayersToInfo(game.Players[:]),
+		Players:    convertPlayersToInfo(game.AllPlayers()),
 		Winner:     winner,
 		IsDraw:     game.Winner == nil && game.State == models.GameStateFinished,
 		WinType:    winType,
@@ -440,37 +1062,38 @@ func (a *AnalyticsService) EmitGameEnded(game *models.Game, endReason string, me
 		FinalBoard: finalBoard,
 	}
 
-	return a.sendEvent(string(EventGameEnded), game.ID.String(), event)
+	return a.sendEvent(EventGameEnded, game.ID.String(), event)
 }
 
 // EmitPlayerDisconnected emits a player disconnected event
 func (a *AnalyticsService) EmitPlayerDisconnected(game *models.Game, player *models.Player, reason string, gracePeriod int, metadata Metadata) error {
-	if !a.enabled {
+	if !a.IsEnabled() {
 		return nil
 	}
 
 	event := PlayerDisconnectedEvent{
 		BaseEvent: BaseEvent{
-			EventType: EventPlayerDisconnected,
-			EventID:   uuid.New().String(),
-			Timestamp: time.Now(),
-			GameID:    game.ID.String(),
-			Metadata:  metadata,
+			EventType:     EventPlayerDisconnected,
+			SchemaVersion: SchemaVersion(EventPlayerDisconnected),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        game.ID.String(),
+			Metadata:      a.stamp(metadata),
 		},
 		Player:         convertPlayerToInfo(player),
 		DisconnectTime: time.Now(),
 		Reason:         reason,
-		GameState:      string(game.State),
+		GameState:      game.State.String(),
 		MoveNumber:     a.countMovesOnBoard(game.Board),
 		GracePeriod:    gracePeriod,
 	}
 
-	return a.sendEvent(string(EventPlayerDisconnected), game.ID.String(), event)
+	return a.sendEvent(EventPlayerDisconnected, game.ID.String(), event)
 }
 
 // EmitPlayerReconnected emits a player reconnected event
 func (a *AnalyticsService) EmitPlayerReconnected(game *models.Game, player *models.Player, disconnectTime time.Time, missedMoves int, metadata Metadata) error {
-	if !a.enabled {
+	if !a.IsEnabled() {
 		return nil
 	}
 
@@ -479,34 +1102,388 @@ func (a *AnalyticsService) EmitPlayerReconnected(game *models.Game, player *mode
 
 	event := PlayerReconnectedEvent{
 		BaseEvent: BaseEvent{
-			EventType: EventPlayerReconnected,
-			EventID:   uuid.New().String(),
-			Timestamp: reconnectTime,
-			GameID:    game.ID.String(),
-			Metadata:  metadata,
+			EventType:     EventPlayerReconnected,
+			SchemaVersion: SchemaVersion(EventPlayerReconnected),
+			EventID:       uuid.New().String(),
+			Timestamp:     reconnectTime,
+			GameID:        game.ID.String(),
+			Metadata:      a.stamp(metadata),
 		},
 		Player:          convertPlayerToInfo(player),
 		ReconnectTime:   reconnectTime,
 		DisconnectTime:  disconnectTime,
 		OfflineDuration: offlineDuration,
 		MissedMoves:     missedMoves,
-		GameState:       string(game.State),
+		GameState:       game.State.String(),
 	}
 
-	return a.sendEvent(string(EventPlayerReconnected), game.ID.String(), event)
+	return a.sendEvent(EventPlayerReconnected, game.ID.String(), event)
 }
 
-// sendEvent is a helper method to send events to Kafka
-func (a *AnalyticsService) sendEvent(eventType, gameID string, event interface{}) error {
-	eventJSON, err := json.Marshal(event)
+// EmitGameAnalysis emits a post-game move quality analysis event
+func (a *AnalyticsService) EmitGameAnalysis(analysis *models.GameAnalysis, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := GameAnalysisEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventGameAnalysis,
+			SchemaVersion: SchemaVersion(EventGameAnalysis),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        analysis.GameID.String(),
+			Metadata:      a.stamp(metadata),
+		},
+		Moves:   analysis.Moves,
+		Players: analysis.Players,
+	}
+
+	return a.sendEvent(EventGameAnalysis, analysis.GameID.String(), event)
+}
+
+// EmitMatchFound emits a match found event with the final rating gap
+func (a *AnalyticsService) EmitMatchFound(game *models.Game, ratings [2]int, ratingGap, ratingRange int, waitTime time.Duration, queueSize int, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := MatchFoundEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventMatchFound,
+			SchemaVersion: SchemaVersion(EventMatchFound),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        game.ID.String(),
+			Metadata:      a.stamp(metadata),
+		},
+		Players:     convertPlayersToInfo(game.AllPlayers()),
+		Ratings:     ratings[:],
+		QueueType:   string(game.QueueType),
+		RatingGap:   ratingGap,
+		RatingRange: ratingRange,
+		WaitTime:    waitTime.Milliseconds(),
+		QueueSize:   queueSize,
+	}
+
+	return a.sendEvent(EventMatchFound, game.ID.String(), event)
+}
+
+// EmitQueueJoined emits a player joined queue event
+func (a *AnalyticsService) EmitQueueJoined(playerID uuid.UUID, username string, queueType models.QueueType, rating, queueSize int, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := QueueJoinedEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventPlayerJoinedQueue,
+			SchemaVersion: SchemaVersion(EventPlayerJoinedQueue),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			Metadata:      a.stamp(metadata),
+		},
+		Player:    PlayerInfo{ID: playerID.String(), Name: username, IsActive: true, Connected: true},
+		QueueType: string(queueType),
+		Rating:    rating,
+		QueueSize: queueSize,
+	}
+
+	return a.sendEvent(EventPlayerJoinedQueue, playerID.String(), event)
+}
+
+// EmitQueueLeft emits a player left queue event
+func (a *AnalyticsService) EmitQueueLeft(playerID uuid.UUID, username string, queueType models.QueueType, rating, queueSize int, waitTime time.Duration, reason string, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := QueueLeftEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventPlayerLeftQueue,
+			SchemaVersion: SchemaVersion(EventPlayerLeftQueue),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			Metadata:      a.stamp(metadata),
+		},
+		Player:    PlayerInfo{ID: playerID.String(), Name: username},
+		QueueType: string(queueType),
+		Rating:    rating,
+		QueueSize: queueSize,
+		WaitTime:  waitTime.Milliseconds(),
+		Reason:    reason,
+	}
+
+	return a.sendEvent(EventPlayerLeftQueue, playerID.String(), event)
+}
+
+// EmitBotActivated emits a bot activated event for a game against a bot
+func (a *AnalyticsService) EmitBotActivated(game *models.Game, waitTime time.Duration, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := BotActivatedEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventBotActivated,
+			SchemaVersion: SchemaVersion(EventBotActivated),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        game.ID.String(),
+			Metadata:      a.stamp(metadata),
+		},
+		QueueType: string(game.QueueType),
+		WaitTime:  waitTime.Milliseconds(),
+	}
+	for _, player := range game.AllPlayers() {
+		if player.IsBot {
+			event.BotName = player.Name
+		} else {
+			event.Player = convertPlayerToInfo(player)
+		}
+	}
+
+	return a.sendEvent(EventBotActivated, game.ID.String(), event)
+}
+
+// EmitChatMessage emits a chat message event
+func (a *AnalyticsService) EmitChatMessage(message *models.ChatMessage, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := ChatMessageEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventChatMessage,
+			SchemaVersion: SchemaVersion(EventChatMessage),
+			EventID:       uuid.New().String(),
+			Timestamp:     message.SentAt,
+			GameID:        message.GameID.String(),
+			Metadata:      a.stamp(metadata),
+		},
+		SenderID:   message.SenderID.String(),
+		SenderName: message.SenderName,
+		Role:       string(message.Role),
+		Length:     utf8.RuneCountInString(message.Text),
+		Filtered:   message.Filtered,
+	}
+
+	return a.sendEvent(EventChatMessage, message.GameID.String(), event)
+}
+
+// EmitEmoteSent emits an emote event
+func (a *AnalyticsService) EmitEmoteSent(emote *models.Emote, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := EmoteSentEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventEmoteSent,
+			SchemaVersion: SchemaVersion(EventEmoteSent),
+			EventID:       uuid.New().String(),
+			Timestamp:     emote.SentAt,
+			GameID:        emote.GameID.String(),
+			Metadata:      a.stamp(metadata),
+		},
+		SenderID:   emote.SenderID.String(),
+		SenderName: emote.SenderName,
+		Role:       string(emote.Role),
+		Emote:      emote.Emote,
+	}
+
+	return a.sendEvent(EventEmoteSent, emote.GameID.String(), event)
+}
+
+// EmitHighLatency emits an event when a player's latency rises above the threshold
+func (a *AnalyticsService) EmitHighLatency(game *models.Game, player *models.Player, latency, previous, threshold time.Duration, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := HighLatencyEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventHighLatency,
+			SchemaVersion: SchemaVersion(EventHighLatency),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        game.ID.String(),
+			Metadata:      a.stamp(metadata),
+		},
+		Player:      convertPlayerToInfo(player),
+		LatencyMs:   int(latency.Milliseconds()),
+		PreviousMs:  int(previous.Milliseconds()),
+		ThresholdMs: int(threshold.Milliseconds()),
+		MoveNumber:  a.countMovesOnBoard(game.Board),
+		GameState:   game.State.String(),
+	}
+
+	return a.sendEvent(EventHighLatency, game.ID.String(), event)
+}
+
+// EmitPlayerFlagged emits an event for a player the anomaly detector flagged
+func (a *AnalyticsService) EmitPlayerFlagged(flag PlayerFlag) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := PlayerFlaggedEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventPlayerFlagged,
+			SchemaVersion: SchemaVersion(EventPlayerFlagged),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        flag.GameID,
+			Metadata:      a.stamp(Metadata{}),
+		},
+		FlagID:    flag.ID,
+		Player:    flag.Player,
+		Reason:    flag.Reason,
+		Detail:    flag.Detail,
+		Value:     flag.Value,
+		Threshold: flag.Threshold,
+	}
+
+	return a.sendEvent(EventPlayerFlagged, flag.Player, event)
+}
+
+// EmitPlayerMilestone emits an event for a milestone the analytics consumer saw a player reach
+func (a *AnalyticsService) EmitPlayerMilestone(milestone PlayerMilestone) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := PlayerMilestoneEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventPlayerMilestone,
+			SchemaVersion: SchemaVersion(EventPlayerMilestone),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			GameID:        milestone.GameID,
+			Metadata:      a.stamp(Metadata{}),
+		},
+		Player:    milestone.Player,
+		Milestone: milestone.Kind,
+		Value:     milestone.Value,
+	}
+
+	return a.sendEvent(EventPlayerMilestone, milestone.Player, event)
+}
+
+// EmitPlayerErased emits an event for a player whose data was erased, and
+// tombstones for the keys naming them, so compacted topics drop their
+// flagged and milestone events
+func (a *AnalyticsService) EmitPlayerErased(playerName string) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := PlayerErasedEvent{
+		BaseEvent: BaseEvent{
+			EventType:     EventPlayerErased,
+			SchemaVersion: SchemaVersion(EventPlayerErased),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			Metadata:      a.stamp(Metadata{}),
+		},
+		Player: playerName,
+	}
+	if err := a.sendEvent(EventPlayerErased, playerName, event); err != nil {
+		return err
+	}
+
+	for _, eventType := range []EventType{EventPlayerFlagged, EventPlayerMilestone} {
+		a.enqueue(bus.Message{
+			Topic: a.router.Topic(eventType),
+			Key:   messageKey(eventType, playerName),
+		})
+	}
+	return nil
+}
+
+// EmitTournamentEvent emits a tournament lifecycle event. Match is nil for
+// events about the tournament as a whole.
+func (a *AnalyticsService) EmitTournamentEvent(eventType EventType, tournament *models.Tournament, match *models.TournamentMatch, metadata Metadata) error {
+	if !a.IsEnabled() {
+		return nil
+	}
+
+	event := TournamentEvent{
+		BaseEvent: BaseEvent{
+			EventType:     eventType,
+			SchemaVersion: SchemaVersion(eventType),
+			EventID:       uuid.New().String(),
+			Timestamp:     time.Now(),
+			Metadata:      a.stamp(metadata),
+		},
+		TournamentID: tournament.ID.String(),
+		Name:         tournament.Name,
+		Format:       string(tournament.Format),
+		Status:       string(tournament.Status),
+		PlayerCount:  len(tournament.Players),
+		Rounds:       len(tournament.Rounds),
+	}
+
+	winnerID := tournament.WinnerID
+	if match != nil {
+		if match.GameID != nil {
+			event.GameID = match.GameID.String()
+		}
+		event.Round = match.Round
+		event.MatchID = match.ID.String()
+		event.IsDraw = match.Draw
+		event.Bye = match.Bye
+		winnerID = match.WinnerID
+	}
+	if winnerID != nil {
+		if winner := tournament.GetPlayer(*winnerID); winner != nil {
+			event.WinnerName = winner.Name
+		}
+	}
+
+	// Key by tournament so its events stay in order
+	return a.sendEvent(eventType, tournament.ID.String(), event)
+}
+
+// sendEvent is a helper method to send events to the message bus, keyed by
+// the game, tournament or player they belong to
+func (a *AnalyticsService) sendEvent(eventType EventType, id string, event interface{}) error {
+	if !a.sample(eventType) {
+		return nil
+	}
+
+	value, err := a.serializer.Serialize(eventType, event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return fmt.Errorf("failed to serialize event: %w", err)
 	}
 
-	// Use gameID as key for consistent partitioning
-	key := fmt.Sprintf("%s:%s", eventType, gameID)
-	
-	return a.producer.SendMessage(key, eventJSON)
+	headers := make(map[string]string)
+	for _, header := range eventHeaders(eventType, a.serializer.ContentType()) {
+		headers[header.Key] = string(header.Value)
+	}
+	if traced, ok := event.(interface{ traceParent() string }); ok && traced.traceParent() != "" {
+		headers[traceParentHeader] = traced.traceParent()
+	}
+	a.enqueue(bus.Message{
+		Topic:   a.router.Topic(eventType),
+		Key:     messageKey(eventType, id),
+		Value:   value,
+		Headers: headers,
+	})
+	return nil
+}
+
+// messageKey returns the key an event is written with. The hash balancer puts
+// every event with a key on the same partition, so keying a game's events by
+// the game alone keeps its moves, start and end in order. Flags and
+// milestones keep their type in the key: compacted topics keep the last of
+// each for a player, and erasing the player tombstones both.
+func messageKey(eventType EventType, id string) string {
+	switch eventType {
+	case EventPlayerFlagged, EventPlayerMilestone:
+		return fmt.Sprintf("%s:%s", eventType, id)
+	}
+	return id
 }
 
 // Helper functions to convert engine types to event types
@@ -533,8 +1510,8 @@ func convertPlayersToInfo(players []*models.Player) []PlayerInfo {
 }
 
 // Legacy method for backward compatibility
-func (a *AnalyticsService) SendEvent(eventType string, data map[string]interface{}) {
-	if !a.enabled {
+func (a *AnalyticsService) SendEvent(eventType string, data map[string]interface{}, metadata Metadata) {
+	if !a.IsEnabled() || !a.sample(EventType(eventType)) {
 		return
 	}
 
@@ -543,6 +1520,7 @@ func (a *AnalyticsService) SendEvent(eventType string, data map[string]interface
 		"event_id":   uuid.New().String(),
 		"timestamp":  time.Now(),
 		"data":       data,
+		"metadata":   a.stamp(metadata),
 	}
 
 	eventJSON, err := json.Marshal(event)
@@ -551,9 +1529,11 @@ func (a *AnalyticsService) SendEvent(eventType string, data map[string]interface
 		return
 	}
 
-	if err := a.producer.SendMessage(eventType, eventJSON); err != nil {
-		log.Printf("Failed to send legacy analytics event: %v", err)
+	message := bus.Message{Topic: a.router.Default, Key: eventType, Value: eventJSON}
+	if metadata.TraceParent != "" {
+		message.Headers = map[string]string{traceParentHeader: metadata.TraceParent}
 	}
+	a.enqueue(message)
 }
 
 // Helper function to count moves on the board
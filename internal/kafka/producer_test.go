@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/bus"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// recordingPublisher keeps the messages it is handed
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages []bus.Message
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, message bus.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+// publishEvents runs emit against an analytics service and returns the
+// messages it published
+func publishEvents(t *testing.T, emit func(a *AnalyticsService)) []bus.Message {
+	t.Helper()
+	publisher := &recordingPublisher{}
+	service, err := NewBusAnalyticsService(publisher, DefaultProducerConfig(nil), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emit(service)
+	if err := service.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return publisher.messages
+}
+
+func TestGameEventsKeyedByGame(t *testing.T) {
+	red := &models.Player{ID: uuid.New(), Name: "red"}
+	yellow := &models.Player{ID: uuid.New(), Name: "yellow", Color: models.PlayerYellow}
+	game := &models.Game{ID: uuid.New(), Players: [2]*models.Player{red, yellow}, State: models.GameStatePlaying, CreatedAt: time.Now()}
+
+	messages := publishEvents(t, func(a *AnalyticsService) {
+		a.EmitGameStarted(game, Metadata{})
+		move := game.MakeMove(3, models.PlayerRed)
+		move.PlayerID = red.ID
+		a.EmitMovePlayed(game, move, time.Second, "", Metadata{})
+		finishedAt := time.Now()
+		game.State, game.FinishedAt = models.GameStateFinished, &finishedAt
+		a.EmitGameEnded(game, "admin", Metadata{})
+	})
+
+	if len(messages) != 3 {
+		t.Fatalf("published %d messages, want 3", len(messages))
+	}
+	for _, message := range messages {
+		if message.Key != game.ID.String() {
+			t.Errorf("event keyed %q, want the game ID %s", message.Key, game.ID)
+		}
+	}
+}
+
+func TestPlayerEventKeys(t *testing.T) {
+	messages := publishEvents(t, func(a *AnalyticsService) {
+		a.EmitPlayerFlagged(PlayerFlag{ID: "flag-1", Player: "alice", Reason: "win_rate"})
+		a.EmitPlayerErased("alice")
+	})
+
+	want := []string{"player_flagged:alice", "alice", "player_flagged:alice", "player_milestone:alice"}
+	if len(messages) != len(want) {
+		t.Fatalf("published %d messages, want %d", len(messages), len(want))
+	}
+	for i, message := range messages {
+		if message.Key != want[i] {
+			t.Errorf("message %d keyed %q, want %q", i, message.Key, want[i])
+		}
+	}
+	// The erasure's tombstones are the last two
+	for _, tombstone := range messages[2:] {
+		if len(tombstone.Value) != 0 {
+			t.Errorf("tombstone for %q has a value", tombstone.Key)
+		}
+	}
+}
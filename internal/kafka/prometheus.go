@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"strconv"
+
+	"connect-four-backend/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterMetrics exposes the events queued, published and dropped, the
+// publish latency and, when publishing to Kafka, the producer's messages
+func (a *AnalyticsService) RegisterMetrics(registry *metrics.Registry) {
+	registry.CounterFunc("connect_four_analytics_events_queued_total", "Analytics events queued for publishing",
+		func() float64 { return float64(a.GetStats().EventsQueued) })
+	registry.CounterFunc("connect_four_analytics_events_published_total", "Analytics events published",
+		func() float64 { return float64(a.GetStats().EventsPublished) })
+	registry.CounterFunc("connect_four_analytics_publish_errors_total", "Analytics events the bus failed to take",
+		func() float64 { return float64(a.GetStats().PublishErrors) })
+	registry.LabeledFunc("connect_four_analytics_events_dropped_total", "Analytics events dropped, by reason", metrics.KindCounter,
+		func() []metrics.Sample {
+			stats := a.GetStats()
+			return []metrics.Sample{
+				{Labels: []metrics.Label{{Name: "reason", Value: "queue_full"}}, Value: float64(stats.DroppedQueueFull)},
+				{Labels: []metrics.Label{{Name: "reason", Value: "circuit_open"}}, Value: float64(stats.DroppedCircuitOpen)},
+			}
+		})
+	registry.GaugeFunc("connect_four_analytics_queue_length", "Analytics events waiting to be published",
+		func() float64 { return float64(a.GetStats().QueueLength) })
+	registry.GaugeFunc("connect_four_analytics_circuit_open", "1 while the circuit breaker drops analytics events",
+		func() float64 { return boolValue(a.GetStats().CircuitOpen) })
+	registry.CounterFunc("connect_four_analytics_circuit_trips_total", "Times the circuit breaker opened",
+		func() float64 { return float64(a.GetStats().CircuitTrips) })
+	registry.Register(a.latency)
+
+	producer, ok := a.publisher.(*Producer)
+	if !ok {
+		return
+	}
+	registry.CounterFunc("connect_four_producer_messages_queued_total", "Messages given to the Kafka writer",
+		func() float64 { return float64(producer.GetStats().MessagesQueued) })
+	registry.CounterFunc("connect_four_producer_messages_sent_total", "Messages Kafka accepted",
+		func() float64 { return float64(producer.GetStats().MessagesSent) })
+	registry.CounterFunc("connect_four_producer_messages_errored_total", "Messages Kafka didn't accept after every retry",
+		func() float64 { return float64(producer.GetStats().MessagesErrored) })
+	if producer.spool == nil {
+		return
+	}
+	registry.GaugeFunc("connect_four_producer_spool_backlog_messages", "Messages spooled to disk waiting for the brokers",
+		func() float64 { return float64(producer.spool.getStats().BacklogMessages) })
+	registry.GaugeFunc("connect_four_producer_spool_backlog_bytes", "Bytes spooled to disk waiting for the brokers",
+		func() float64 { return float64(producer.spool.getStats().BacklogBytes) })
+}
+
+// RegisterMetrics exposes the messages processed, the processing latency,
+// the lag per partition and the games and players the events tell of
+func (c *Consumer) RegisterMetrics(registry *metrics.Registry) {
+	registry.CounterFunc("connect_four_consumer_messages_processed_total", "Messages processed",
+		func() float64 { return float64(c.GetStats().MessagesProcessed) })
+	registry.CounterFunc("connect_four_consumer_messages_errored_total", "Messages that failed to read or process",
+		func() float64 { return float64(c.GetStats().MessagesErrored) })
+	registry.CounterFunc("connect_four_consumer_messages_dead_lettered_total", "Messages forwarded to the dead-letter topic",
+		func() float64 { return float64(c.GetStats().MessagesDeadLettered) })
+	registry.CounterFunc("connect_four_consumer_messages_skipped_total", "Messages skipped as already in the restored snapshot",
+		func() float64 { return float64(c.GetStats().MessagesSkipped) })
+	registry.CounterFunc("connect_four_consumer_duplicates_skipped_total", "Events skipped as already processed",
+		func() float64 { return float64(c.processor.GetStats().DuplicatesSkipped) })
+	registry.CounterFunc("connect_four_consumer_batches_committed_total", "Batches of offsets committed",
+		func() float64 { return float64(c.GetStats().BatchesCommitted) })
+	registry.Register(c.latency)
+
+	registry.GaugeFunc("connect_four_consumer_lag", "Messages behind the end of every partition, as of the last check",
+		func() float64 { return float64(c.GetStats().TotalLag) })
+	registry.LabeledFunc("connect_four_consumer_partition_lag", "Messages behind the end of the partition, as of the last check", metrics.KindGauge,
+		func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, partition := range c.GetStats().Partitions {
+				samples = append(samples, metrics.Sample{
+					Labels: []metrics.Label{
+						{Name: "topic", Value: partition.Topic},
+						{Name: "partition", Value: strconv.Itoa(partition.Partition)},
+					},
+					Value: float64(partition.Lag),
+				})
+			}
+			return samples
+		})
+
+	registry.Register(
+		newSnapshotCollector("connect_four_game_duration_seconds", "Duration of finished games",
+			func() HistogramSnapshot { return c.GetDistributions().GameDuration }),
+		newSnapshotCollector("connect_four_move_time_seconds", "Think time of human moves",
+			func() HistogramSnapshot { return c.GetDistributions().MoveTime }),
+	)
+
+	concurrency := c.processor.aggregator.concurrency
+	registry.GaugeFunc("connect_four_active_games", "Games in progress",
+		func() float64 { games, _, _ := concurrency.counts(); return float64(games) })
+	registry.GaugeFunc("connect_four_online_players", "Human players queued or in a game they are connected to",
+		func() float64 { _, online, _ := concurrency.counts(); return float64(online) })
+	registry.GaugeFunc("connect_four_queued_players", "Players waiting in the matchmaking queue",
+		func() float64 { _, _, queued := concurrency.counts(); return float64(queued) })
+}
+
+// snapshotCollector exposes a histogram the aggregator keeps, with its
+// percentiles as a <name>_quantile gauge
+type snapshotCollector struct {
+	snapshot  func() HistogramSnapshot
+	histogram *prometheus.Desc
+	quantile  *prometheus.Desc
+}
+
+func newSnapshotCollector(name, help string, snapshot func() HistogramSnapshot) *snapshotCollector {
+	return &snapshotCollector{
+		snapshot:  snapshot,
+		histogram: prometheus.NewDesc(name, help, nil, nil),
+		quantile:  prometheus.NewDesc(name+"_quantile", help+", estimated percentiles", []string{"quantile"}, nil),
+	}
+}
+
+func (c *snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.histogram
+	ch <- c.quantile
+}
+
+func (c *snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshot := c.snapshot()
+	buckets := make(map[float64]uint64, len(snapshot.Buckets))
+	for _, bucket := range snapshot.Buckets {
+		buckets[bucket.UpperBound] = bucket.Count
+	}
+	ch <- prometheus.MustNewConstHistogram(c.histogram, snapshot.Count, snapshot.Sum, buckets)
+	ch <- prometheus.MustNewConstMetric(c.quantile, prometheus.GaugeValue, snapshot.P50, "0.5")
+	ch <- prometheus.MustNewConstMetric(c.quantile, prometheus.GaugeValue, snapshot.P90, "0.9")
+	ch <- prometheus.MustNewConstMetric(c.quantile, prometheus.GaugeValue, snapshot.P99, "0.99")
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connect-four-backend/internal/metrics"
+)
+
+func TestSnapshotCollector(t *testing.T) {
+	histogram := NewHistogram([]float64{30, 60})
+	for _, seconds := range []float64{20, 45, 50, 300} {
+		histogram.Observe(seconds)
+	}
+	registry := metrics.NewRegistry()
+	registry.Register(newSnapshotCollector("test_game_duration_seconds", "Duration of finished games", histogram.Snapshot))
+
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	for _, line := range []string{
+		"# TYPE test_game_duration_seconds histogram",
+		`test_game_duration_seconds_bucket{le="30"} 1`,
+		`test_game_duration_seconds_bucket{le="60"} 3`,
+		`test_game_duration_seconds_bucket{le="+Inf"} 4`,
+		"test_game_duration_seconds_sum 415",
+		"test_game_duration_seconds_count 4",
+		"# TYPE test_game_duration_seconds_quantile gauge",
+		`test_game_duration_seconds_quantile{quantile="0.5"} 45`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("scrape is missing %q", line)
+		}
+	}
+}
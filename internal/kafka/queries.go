@@ -0,0 +1,411 @@
+package kafka
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// GameSummary is the game metrics without the per winner counts, which grow
+// with every player who ever won
+type GameSummary struct {
+	TotalGames          int64            `json:"total_games"`
+	CompletedGames      int64            `json:"completed_games"`
+	AverageGameDuration float64          `json:"average_game_duration"`
+	DrawCount           int64            `json:"draw_count"`
+	BotGames            int64            `json:"bot_games"`
+	HumanGames          int64            `json:"human_games"`
+	WinTypeDistribution map[string]int64 `json:"win_type_distribution"`
+}
+
+// WinnerCount is how many games a player won
+type WinnerCount struct {
+	Name string `json:"name"`
+	Wins int64  `json:"wins"`
+}
+
+// WinnerPage is a page of the players ranked by games won
+type WinnerPage struct {
+	Winners []WinnerCount `json:"winners"`
+	Total   int           `json:"total"` // players who won a game
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+}
+
+// PlayerPage is a page of the players ranked by games won, then win rate,
+// unless a filter orders them otherwise
+type PlayerPage struct {
+	Players []PlayerStats `json:"players"`
+	Total   int           `json:"total"` // players in memory matching the filter
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+}
+
+// PlayerOrder is what FindPlayers ranks players by, best first
+type PlayerOrder string
+
+const (
+	OrderByWins          PlayerOrder = "wins" // then win rate
+	OrderByWinRate       PlayerOrder = "win_rate"
+	OrderByGamesPlayed   PlayerOrder = "games_played"
+	OrderByLongestStreak PlayerOrder = "longest_streak"
+	OrderByLastSeen      PlayerOrder = "last_seen"
+)
+
+// PlayerFilter picks the players FindPlayers returns and how they're ranked.
+// The zero value picks every player, ranked by wins.
+type PlayerFilter struct {
+	NamePrefix string
+	MinGames   int64
+	Active     *bool // only the active, or only the inactive, players
+	OrderBy    PlayerOrder
+}
+
+func (f PlayerFilter) matches(player *PlayerStats) bool {
+	return strings.HasPrefix(player.Name, f.NamePrefix) &&
+		player.GamesPlayed >= f.MinGames &&
+		(f.Active == nil || player.IsActive == *f.Active)
+}
+
+// GameFilter picks the games FindGames returns. The zero value picks every
+// game still tracked.
+type GameFilter struct {
+	Player    string // games the player is in
+	Completed *bool  // only the completed, or only the ongoing, games
+}
+
+// GamePage is a page of the games tracked, the latest started first
+type GamePage struct {
+	Games  []*ActiveGame `json:"games"`
+	Total  int           `json:"total"` // games tracked matching the filter
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// PlayerSummary is the player totals without the players themselves
+type PlayerSummary struct {
+	TotalPlayers        int64 `json:"total_players"`
+	ActivePlayers       int64 `json:"active_players"` // seen in the last day
+	NewPlayersToday     int64 `json:"new_players_today"`
+	TotalMoves          int64 `json:"total_moves"`
+	TotalDisconnections int64 `json:"total_disconnections"`
+	TotalReconnections  int64 `json:"total_reconnections"`
+}
+
+// HourlyPoint is an hour's games, moves, players and average game duration
+type HourlyPoint struct {
+	Hour            string  `json:"hour"` // "2024-01-01-15"
+	Games           int64   `json:"games"`
+	Moves           int64   `json:"moves"`
+	Players         int64   `json:"players"`
+	AverageDuration float64 `json:"average_duration"`
+}
+
+// DailyPoint is a day's games, moves, players and average game duration
+type DailyPoint struct {
+	Day             string  `json:"day"` // "2024-01-01"
+	Games           int64   `json:"games"`
+	Moves           int64   `json:"moves"`
+	Players         int64   `json:"players"`
+	NewPlayers      int64   `json:"new_players"`
+	AverageDuration float64 `json:"average_duration"`
+}
+
+// GetGameSummary returns the game totals and win types
+func (ma *MetricsAggregator) GetGameSummary() GameSummary {
+	ma.gameMetrics.mu.RLock()
+	defer ma.gameMetrics.mu.RUnlock()
+
+	return GameSummary{
+		TotalGames:          ma.gameMetrics.TotalGames,
+		CompletedGames:      ma.gameMetrics.CompletedGames,
+		AverageGameDuration: ma.gameMetrics.AverageGameDuration,
+		DrawCount:           ma.gameMetrics.DrawCount,
+		BotGames:            ma.gameMetrics.BotGames,
+		HumanGames:          ma.gameMetrics.HumanGames,
+		WinTypeDistribution: copyCounts(ma.gameMetrics.WinTypeDistribution),
+	}
+}
+
+// GetWinners returns the page of winners after offset, most wins first
+func (ma *MetricsAggregator) GetWinners(limit, offset int) WinnerPage {
+	ma.gameMetrics.mu.RLock()
+	top := newTopK(offset+limit, func(a, b WinnerCount) bool {
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.Name < b.Name
+	})
+	for name, wins := range ma.gameMetrics.WinnerFrequency {
+		top.offer(WinnerCount{Name: name, Wins: wins})
+	}
+	total := len(ma.gameMetrics.WinnerFrequency)
+	ma.gameMetrics.mu.RUnlock()
+
+	return WinnerPage{
+		Winners: pageOf(top.sorted(), offset),
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+}
+
+// GetTopPlayers returns the page of players after offset, ranked by games
+// won, then win rate
+func (ma *MetricsAggregator) GetTopPlayers(limit, offset int) PlayerPage {
+	return ma.FindPlayers(PlayerFilter{}, limit, offset)
+}
+
+// FindPlayers returns the page after offset of the players matching the
+// filter, in its order. Only the players ranked up to the page are copied.
+func (ma *MetricsAggregator) FindPlayers(filter PlayerFilter, limit, offset int) PlayerPage {
+	top := newTopK(offset+limit, playerRanking(filter.OrderBy))
+	total := 0
+	ma.players.each(func(player *PlayerStats) {
+		if filter.matches(player) {
+			top.offer(*player)
+			total++
+		}
+	})
+
+	return PlayerPage{
+		Players: pageOf(top.sorted(), offset),
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+}
+
+// GetPlayerStats returns a copy of the player's stats, false for a player
+// not in memory
+func (ma *MetricsAggregator) GetPlayerStats(name string) (PlayerStats, bool) {
+	shard := ma.players.shard(name)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	player, exists := shard.players[name]
+	if !exists {
+		return PlayerStats{}, false
+	}
+	return *player, true
+}
+
+// GetPlayerSummary returns the player totals, counting the active players
+// without copying them
+func (ma *MetricsAggregator) GetPlayerSummary() PlayerSummary {
+	summary := PlayerSummary{
+		TotalPlayers:        atomic.LoadInt64(&ma.playerTotals.players),
+		NewPlayersToday:     atomic.LoadInt64(&ma.playerTotals.newToday),
+		TotalMoves:          atomic.LoadInt64(&ma.playerTotals.moves),
+		TotalDisconnections: atomic.LoadInt64(&ma.playerTotals.disconnections),
+		TotalReconnections:  atomic.LoadInt64(&ma.playerTotals.reconnections),
+	}
+	ma.players.each(func(player *PlayerStats) {
+		if player.IsActive {
+			summary.ActivePlayers++
+		}
+	})
+	return summary
+}
+
+// GetHourlySeries returns every hour from from to to, newest first. Hours
+// before the hourly retention aren't kept, so the series starts after it.
+func (ma *MetricsAggregator) GetHourlySeries(from, to time.Time) []HourlyPoint {
+	if oldest := time.Now().Add(-ma.memoryConfig().HourlyRetention); from.Before(oldest) {
+		from = oldest
+	}
+	from, to = from.Truncate(time.Hour), to.Truncate(time.Hour)
+
+	ma.hourlyMetrics.mu.RLock()
+	defer ma.hourlyMetrics.mu.RUnlock()
+
+	series := []HourlyPoint{}
+	for hour := to; !hour.Before(from); hour = hour.Add(-time.Hour) {
+		key := hour.Format("2006-01-02-15")
+		series = append(series, HourlyPoint{
+			Hour:            key,
+			Games:           ma.hourlyMetrics.GamesPerHour[key],
+			Moves:           ma.hourlyMetrics.MovesPerHour[key],
+			Players:         ma.hourlyMetrics.PlayersPerHour[key],
+			AverageDuration: ma.hourlyMetrics.AverageDurationHour[key],
+		})
+	}
+	return series
+}
+
+// GetDailySeries returns every day from from to to, newest first, starting
+// after the daily retention
+func (ma *MetricsAggregator) GetDailySeries(from, to time.Time) []DailyPoint {
+	if oldest := time.Now().Add(-ma.memoryConfig().DailyRetention); from.Before(oldest) {
+		from = oldest
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+
+	ma.dailyMetrics.mu.RLock()
+	defer ma.dailyMetrics.mu.RUnlock()
+
+	series := []DailyPoint{}
+	for day := to; !day.Before(from); day = day.AddDate(0, 0, -1) {
+		key := day.Format("2006-01-02")
+		series = append(series, DailyPoint{
+			Day:             key,
+			Games:           ma.dailyMetrics.GamesPerDay[key],
+			Moves:           ma.dailyMetrics.MovesPerDay[key],
+			Players:         ma.dailyMetrics.PlayersPerDay[key],
+			NewPlayers:      ma.dailyMetrics.NewPlayersPerDay[key],
+			AverageDuration: ma.dailyMetrics.AverageDurationDay[key],
+		})
+	}
+	return series
+}
+
+// playerRanking returns whether a ranks above b in the order, ties going to
+// the player with more wins, then to the name first alphabetically
+func playerRanking(order PlayerOrder) func(a, b PlayerStats) bool {
+	return func(a, b PlayerStats) bool {
+		switch order {
+		case OrderByWinRate:
+			if a.WinRate != b.WinRate {
+				return a.WinRate > b.WinRate
+			}
+		case OrderByGamesPlayed:
+			if a.GamesPlayed != b.GamesPlayed {
+				return a.GamesPlayed > b.GamesPlayed
+			}
+		case OrderByLongestStreak:
+			if a.LongestStreak != b.LongestStreak {
+				return a.LongestStreak > b.LongestStreak
+			}
+		case OrderByLastSeen:
+			if !a.LastSeen.Equal(b.LastSeen) {
+				return a.LastSeen.After(b.LastSeen)
+			}
+		}
+		if a.GamesWon != b.GamesWon {
+			return a.GamesWon > b.GamesWon
+		}
+		if a.WinRate != b.WinRate {
+			return a.WinRate > b.WinRate
+		}
+		return a.Name < b.Name
+	}
+}
+
+// pageOf returns the ranked items after offset
+func pageOf[T any](ranked []T, offset int) []T {
+	if offset >= len(ranked) {
+		return []T{}
+	}
+	return ranked[offset:]
+}
+
+// GetGameSummary returns the aggregator's game totals
+func (ep *EventProcessor) GetGameSummary() GameSummary {
+	return ep.aggregator.GetGameSummary()
+}
+
+// GetWinners returns a page of the players with the most wins
+func (ep *EventProcessor) GetWinners(limit, offset int) WinnerPage {
+	return ep.aggregator.GetWinners(limit, offset)
+}
+
+// GetTopPlayers returns a page of the aggregator's players ranked by wins
+func (ep *EventProcessor) GetTopPlayers(limit, offset int) PlayerPage {
+	return ep.aggregator.GetTopPlayers(limit, offset)
+}
+
+// FindPlayers returns a page of the aggregator's players matching the filter
+func (ep *EventProcessor) FindPlayers(filter PlayerFilter, limit, offset int) PlayerPage {
+	return ep.aggregator.FindPlayers(filter, limit, offset)
+}
+
+// GetPlayerStats returns the aggregator's stats of the player
+func (ep *EventProcessor) GetPlayerStats(name string) (PlayerStats, bool) {
+	return ep.aggregator.GetPlayerStats(name)
+}
+
+// GetPlayerSummary returns the aggregator's player totals
+func (ep *EventProcessor) GetPlayerSummary() PlayerSummary {
+	return ep.aggregator.GetPlayerSummary()
+}
+
+// GetHourlySeries returns the hours in the range, newest first
+func (ep *EventProcessor) GetHourlySeries(from, to time.Time) []HourlyPoint {
+	return ep.aggregator.GetHourlySeries(from, to)
+}
+
+// GetDailySeries returns the days in the range, newest first
+func (ep *EventProcessor) GetDailySeries(from, to time.Time) []DailyPoint {
+	return ep.aggregator.GetDailySeries(from, to)
+}
+
+// GetRecentGames returns the last games completed, the latest first
+func (ep *EventProcessor) GetRecentGames(limit int) []*ActiveGame {
+	return ep.gameTracker.GetRecentlyCompleted(limit)
+}
+
+// FindGames returns a page of the tracked games matching the filter
+func (ep *EventProcessor) FindGames(filter GameFilter, limit, offset int) GamePage {
+	return ep.gameTracker.FindGames(filter, limit, offset)
+}
+
+// GetGame returns the tracked game
+func (ep *EventProcessor) GetGame(gameID string) (*ActiveGame, bool) {
+	return ep.gameTracker.GetGame(gameID)
+}
+
+// GetGameSummary returns the game totals and win types
+func (c *Consumer) GetGameSummary() GameSummary {
+	return c.processor.GetGameSummary()
+}
+
+// GetWinners returns the players with the most wins, limit of them after offset
+func (c *Consumer) GetWinners(limit, offset int) WinnerPage {
+	return c.processor.GetWinners(limit, offset)
+}
+
+// GetTopPlayers returns the players ranked by wins, limit of them after offset
+func (c *Consumer) GetTopPlayers(limit, offset int) PlayerPage {
+	return c.processor.GetTopPlayers(limit, offset)
+}
+
+// FindPlayers returns the players matching the filter, limit of them after offset
+func (c *Consumer) FindPlayers(filter PlayerFilter, limit, offset int) PlayerPage {
+	return c.processor.FindPlayers(filter, limit, offset)
+}
+
+// GetPlayerStats returns the player's stats, false when they aren't in memory
+func (c *Consumer) GetPlayerStats(name string) (PlayerStats, bool) {
+	return c.processor.GetPlayerStats(name)
+}
+
+// GetPlayerSummary returns the player totals
+func (c *Consumer) GetPlayerSummary() PlayerSummary {
+	return c.processor.GetPlayerSummary()
+}
+
+// GetHourlySeries returns the games, moves and players of each hour in the range
+func (c *Consumer) GetHourlySeries(from, to time.Time) []HourlyPoint {
+	return c.processor.GetHourlySeries(from, to)
+}
+
+// GetDailySeries returns the games, moves and players of each day in the range
+func (c *Consumer) GetDailySeries(from, to time.Time) []DailyPoint {
+	return c.processor.GetDailySeries(from, to)
+}
+
+// GetRecentGames returns the last games completed
+func (c *Consumer) GetRecentGames(limit int) []*ActiveGame {
+	return c.processor.GetRecentGames(limit)
+}
+
+// FindGames returns the games still tracked matching the filter, limit of
+// them after offset
+func (c *Consumer) FindGames(filter GameFilter, limit, offset int) GamePage {
+	return c.processor.FindGames(filter, limit, offset)
+}
+
+// GetGame returns the game, false when it isn't tracked or was cleaned up
+func (c *Consumer) GetGame(gameID string) (*ActiveGame, bool) {
+	return c.processor.GetGame(gameID)
+}
@@ -0,0 +1,87 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCounterStore keeps the shared counters in Redis, one hash per counter
+// under prefix:name. Deltas are added with HINCRBY in a MULTI/EXEC
+// transaction.
+type RedisCounterStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCounterStore connects to the server in the URL, given as
+// redis[s]://[user:password@]host:6379[/db]. Commands share the client's pool
+// of connections, which are opened again when they drop.
+func NewRedisCounterStore(rawURL, prefix string) (*RedisCounterStore, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(options)
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", options.Addr, err)
+	}
+	return &RedisCounterStore{client: client, prefix: prefix}, nil
+}
+
+func (rs *RedisCounterStore) key(name string) string {
+	return rs.prefix + ":" + name
+}
+
+// AddCounters adds the deltas with HINCRBY, all of them or none
+func (rs *RedisCounterStore) AddCounters(deltas map[string]map[string]int64) error {
+	ctx := context.Background()
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for name, fields := range deltas {
+			for field, delta := range fields {
+				pipe.HIncrBy(ctx, rs.key(name), field, delta)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// LoadCounters returns the fields of the named counters with HGETALL
+func (rs *RedisCounterStore) LoadCounters(names []string) (map[string]map[string]int64, error) {
+	ctx := context.Background()
+	replies := make([]*redis.MapStringStringCmd, len(names))
+	_, err := rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, name := range names {
+			replies[i] = pipe.HGetAll(ctx, rs.key(name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]map[string]int64, len(names))
+	for i, name := range names {
+		values := replies[i].Val()
+		fields := make(map[string]int64, len(values))
+		for field, value := range values {
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("redis counter %s %s is not a number: %q", name, field, value)
+			}
+			fields[field] = count
+		}
+		counters[name] = fields
+	}
+	return counters, nil
+}
+
+// Close closes the client's connections
+func (rs *RedisCounterStore) Close() error {
+	return rs.client.Close()
+}
@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestCounterStore(t *testing.T) (*RedisCounterStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store, err := NewRedisCounterStore("redis://"+server.Addr(), "connect-four:counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestRedisCounterStore(t *testing.T) {
+	store, _ := newTestCounterStore(t)
+
+	for i := 0; i < 2; i++ {
+		err := store.AddCounters(map[string]map[string]int64{
+			"games":    {"total": 3, "draws": 1},
+			"win_type": {"horizontal": 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counters, err := store.LoadCounters([]string{"games", "win_type", "moves"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]int64{
+		"games":    {"total": 6, "draws": 2},
+		"win_type": {"horizontal": 4},
+		"moves":    {},
+	}
+	if !reflect.DeepEqual(counters, want) {
+		t.Errorf("LoadCounters = %v, want %v", counters, want)
+	}
+}
+
+func TestRedisCounterStoreRejectsNonNumbers(t *testing.T) {
+	store, server := newTestCounterStore(t)
+	server.HSet("connect-four:counters:games", "total", "many")
+
+	if _, err := store.LoadCounters([]string{"games"}); err == nil || !strings.Contains(err.Error(), "is not a number") {
+		t.Errorf("LoadCounters = %v, want a counter that is not a number", err)
+	}
+}
+
+func TestRedisCounterStoreReconnects(t *testing.T) {
+	store, server := newTestCounterStore(t)
+	if err := store.AddCounters(map[string]map[string]int64{"games": {"total": 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	if err := store.AddCounters(map[string]map[string]int64{"games": {"total": 1}}); err == nil {
+		t.Fatal("AddCounters succeeded with Redis down")
+	}
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddCounters(map[string]map[string]int64{"games": {"total": 1}}); err != nil {
+		t.Fatalf("AddCounters after Redis came back: %v", err)
+	}
+	counters, err := store.LoadCounters([]string{"games"})
+	if err != nil || counters["games"]["total"] != 2 {
+		t.Errorf("LoadCounters = %v, %v, want 2 games", counters, err)
+	}
+}
+
+func TestNewRedisCounterStoreFails(t *testing.T) {
+	if _, err := NewRedisCounterStore("http://localhost:6379", "c"); err == nil {
+		t.Error("a URL that isn't redis:// was accepted")
+	}
+	server := miniredis.RunT(t)
+	addr := server.Addr()
+	server.Close()
+	if _, err := NewRedisCounterStore("redis://"+addr, "c"); err == nil {
+		t.Error("connecting to a stopped server succeeded")
+	}
+}
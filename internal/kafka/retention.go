@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"connect-four-backend/internal/database"
+)
+
+const (
+	// A player not seen for this long counts as churned
+	churnAfter = 7 * 24 * time.Hour
+
+	// Cohorts first seen longer ago than this are left out of the metrics
+	retentionCohortDays = 90
+)
+
+// RetentionMetrics are the players grouped by the day they were first seen,
+// with how many of them came back
+type RetentionMetrics struct {
+	Cohorts      []RetentionCohort `json:"cohorts"` // newest first
+	TotalPlayers int64             `json:"total_players"`
+	Churned      int64             `json:"churned"` // players not seen for a week
+	ComputedAt   time.Time         `json:"computed_at"`
+}
+
+// RetentionCohort counts the players first seen on Day who were seen again
+// on or after the Nth day since. A rate is left out until its day has begun.
+type RetentionCohort struct {
+	Day         string   `json:"day"`
+	Players     int64    `json:"players"`
+	ReturnedD1  int64    `json:"returned_d1"`
+	ReturnedD7  int64    `json:"returned_d7"`
+	ReturnedD30 int64    `json:"returned_d30"`
+	D1          *float64 `json:"d1,omitempty"`
+	D7          *float64 `json:"d7,omitempty"`
+	D30         *float64 `json:"d30,omitempty"`
+	Churned     int64    `json:"churned"`
+}
+
+// GetRetentionMetrics computes the retention cohorts from every player's
+// first and last seen times
+func (ma *MetricsAggregator) GetRetentionMetrics() RetentionMetrics {
+	return ma.computeRetention(time.Now())
+}
+
+func (ma *MetricsAggregator) computeRetention(now time.Time) RetentionMetrics {
+	metrics := RetentionMetrics{ComputedAt: now}
+	oldest := now.AddDate(0, 0, -retentionCohortDays).Format("2006-01-02")
+	churnCutoff := now.Add(-churnAfter)
+	cohorts := make(map[string]*RetentionCohort)
+	dayStarts := make(map[string]time.Time)
+
+	ma.players.each(func(player *PlayerStats) {
+		metrics.TotalPlayers++
+		churned := player.LastSeen.Before(churnCutoff)
+		if churned {
+			metrics.Churned++
+		}
+
+		day := player.FirstSeen.Format("2006-01-02")
+		if day < oldest {
+			return
+		}
+		first := player.FirstSeen
+		dayStart := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, first.Location())
+		cohort, exists := cohorts[day]
+		if !exists {
+			cohort = &RetentionCohort{Day: day}
+			cohorts[day] = cohort
+			dayStarts[day] = dayStart
+		}
+		cohort.Players++
+		if churned {
+			cohort.Churned++
+		}
+
+		if !player.LastSeen.Before(dayStart.AddDate(0, 0, 1)) {
+			cohort.ReturnedD1++
+		}
+		if !player.LastSeen.Before(dayStart.AddDate(0, 0, 7)) {
+			cohort.ReturnedD7++
+		}
+		if !player.LastSeen.Before(dayStart.AddDate(0, 0, 30)) {
+			cohort.ReturnedD30++
+		}
+	})
+
+	for day, cohort := range cohorts {
+		dayStart := dayStarts[day]
+		cohort.D1 = returnRate(cohort.ReturnedD1, cohort.Players, dayStart.AddDate(0, 0, 1), now)
+		cohort.D7 = returnRate(cohort.ReturnedD7, cohort.Players, dayStart.AddDate(0, 0, 7), now)
+		cohort.D30 = returnRate(cohort.ReturnedD30, cohort.Players, dayStart.AddDate(0, 0, 30), now)
+		metrics.Cohorts = append(metrics.Cohorts, *cohort)
+	}
+	sort.Slice(metrics.Cohorts, func(i, j int) bool {
+		return metrics.Cohorts[i].Day > metrics.Cohorts[j].Day
+	})
+
+	return metrics
+}
+
+// returnRate is the share of players who returned, nil before the return day
+func returnRate(returned, players int64, returnDay, now time.Time) *float64 {
+	if players == 0 || now.Before(returnDay) {
+		return nil
+	}
+	rate := float64(returned) / float64(players)
+	return &rate
+}
+
+// persistRetention saves the cohorts once a day, on the first flush of the day
+func (ma *MetricsAggregator) persistRetention() error {
+	if ma.store == nil {
+		return nil
+	}
+
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	if ma.retentionSavedDay == today {
+		return nil
+	}
+
+	retention := ma.computeRetention(now)
+	cohorts := make([]database.RetentionCohort, len(retention.Cohorts))
+	for i, cohort := range retention.Cohorts {
+		cohorts[i] = database.RetentionCohort{
+			Day:         cohort.Day,
+			Players:     cohort.Players,
+			ReturnedD1:  cohort.ReturnedD1,
+			ReturnedD7:  cohort.ReturnedD7,
+			ReturnedD30: cohort.ReturnedD30,
+			Churned:     cohort.Churned,
+		}
+	}
+	if err := ma.store.SaveRetentionCohorts(cohorts); err != nil {
+		return fmt.Errorf("failed to save retention cohorts: %w", err)
+	}
+
+	ma.retentionSavedDay = today
+	return nil
+}
@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// eventGroups names sets of event types so related events can be routed together
+var eventGroups = map[string][]EventType{
+	"moves": {EventMovePlayed},
+	"lifecycle": {
+		EventGameStarted, EventGameEnded, EventPlayerDisconnected, EventPlayerReconnected,
+		EventBotActivated, EventGameAnalysis, EventHighLatency,
+	},
+	"matchmaking": {EventPlayerJoinedQueue, EventPlayerLeftQueue, EventMatchFound},
+	"social":      {EventChatMessage, EventEmoteSent},
+	"moderation":  {EventPlayerFlagged},
+	"milestones":  {EventPlayerMilestone},
+	"privacy":     {EventPlayerErased},
+	"tournaments": {
+		EventTournamentCreated, EventTournamentStarted, EventTournamentMatchFinished,
+		EventTournamentFinished, EventTournamentCancelled,
+	},
+}
+
+// TopicRouter picks the topic each event type is written to. Events without
+// a route go to the default topic.
+type TopicRouter struct {
+	Default string               `json:"default"`
+	Routes  map[EventType]string `json:"routes"`
+}
+
+// Topic returns the topic for the event type
+func (r TopicRouter) Topic(eventType EventType) string {
+	if topic, ok := r.Routes[eventType]; ok {
+		return topic
+	}
+	return r.Default
+}
+
+// Topics returns every topic events can be written to, the default first
+func (r TopicRouter) Topics() []string {
+	seen := map[string]bool{r.Default: true}
+	var routed []string
+	for _, topic := range r.Routes {
+		if !seen[topic] {
+			seen[topic] = true
+			routed = append(routed, topic)
+		}
+	}
+	sort.Strings(routed)
+	return append([]string{r.Default}, routed...)
+}
+
+// ParseTopicRoutes parses routes written as "move_played=game-moves,lifecycle=game-lifecycle".
+// Keys are event types or the groups moves, lifecycle, matchmaking, social,
+// moderation, milestones, privacy and tournaments. An event type routed on its own wins over its group.
+func ParseTopicRoutes(spec string) (map[EventType]string, error) {
+	routes := make(map[EventType]string)
+	explicit := make(map[EventType]bool)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, topic, ok := strings.Cut(entry, "=")
+		key, topic = strings.TrimSpace(key), strings.TrimSpace(topic)
+		if !ok || key == "" || topic == "" {
+			return nil, fmt.Errorf("invalid topic route %q, expected <event type or group>=<topic>", entry)
+		}
+
+		if group, ok := eventGroups[key]; ok {
+			for _, eventType := range group {
+				if !explicit[eventType] {
+					routes[eventType] = topic
+				}
+			}
+			continue
+		}
+		if !isKnownEventType(EventType(key)) {
+			return nil, fmt.Errorf("unknown event type or group %q in topic route", key)
+		}
+		routes[EventType(key)] = topic
+		explicit[EventType(key)] = true
+	}
+
+	return routes, nil
+}
+
+func isKnownEventType(eventType EventType) bool {
+	for _, group := range eventGroups {
+		for _, known := range group {
+			if known == eventType {
+				return true
+			}
+		}
+	}
+	return false
+}
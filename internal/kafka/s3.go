@@ -0,0 +1,178 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3ArchiveStore uploads archive files to an S3 bucket, or to any store that
+// speaks the S3 API with AWS Signature Version 4: GCS through its HMAC keys,
+// MinIO, R2. Objects are addressed path-style, endpoint/bucket/key.
+type S3ArchiveStore struct {
+	endpoint     string // scheme and host
+	region       string
+	bucket       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// NewS3ArchiveStore creates a store for the bucket, the endpoint defaults to
+// AWS's for the region
+func NewS3ArchiveStore(config ArchiveConfig, bucket, prefix string) (*S3ArchiveStore, error) {
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("archiving to %s needs an access key", bucket)
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	return &S3ArchiveStore{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		region:       config.Region,
+		bucket:       bucket,
+		prefix:       prefix,
+		accessKey:    config.AccessKeyID,
+		secretKey:    config.SecretAccessKey,
+		sessionToken: config.SessionToken,
+		client:       &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (s *S3ArchiveStore) Put(ctx context.Context, key string, body []byte) error {
+	objectURL := s.endpoint + "/" + s.bucket + "/" + joinArchiveKey(s.prefix, key)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/gzip")
+	if s.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	signS3Request(request, body, s.accessKey, s.secretKey, s.region, time.Now())
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("failed to upload %s: %s: %s", key, response.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (s *S3ArchiveStore) String() string {
+	return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, s.prefix)
+}
+
+// signS3Request adds the x-amz-date, x-amz-content-sha256 and Authorization
+// headers of AWS Signature Version 4, signing every header already set
+func signS3Request(request *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		s3EscapePath(request.URL.Path),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath percent-encodes everything but unreserved characters and slashes
+func s3EscapePath(path string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(path) {
+		if b == '/' || b == '-' || b == '_' || b == '.' || b == '~' ||
+			('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3EscapePath(key)+"="+strings.ReplaceAll(s3EscapePath(value), "/", "%2F"))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
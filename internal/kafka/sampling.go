@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// boardSnapshotsKey sets SamplingConfig.BoardSnapshots in a sampling spec
+const boardSnapshotsKey = "board_snapshots"
+
+// SamplingConfig thins out high-volume analytics events under load. Rates is
+// the share of each event type's events that are emitted, from 0 to 1, types
+// without a rate are all emitted. BoardSnapshots is the share of move_played
+// events carrying the board, the others are emitted without it.
+type SamplingConfig struct {
+	Rates          map[EventType]float64 `json:"rates"`
+	BoardSnapshots float64               `json:"board_snapshots"`
+}
+
+// DefaultSamplingConfig emits every event with its board
+func DefaultSamplingConfig() SamplingConfig {
+	return SamplingConfig{
+		Rates:          make(map[EventType]float64),
+		BoardSnapshots: 1,
+	}
+}
+
+// Validate checks the event types and that the rates are between 0 and 1
+func (c SamplingConfig) Validate() error {
+	for eventType, rate := range c.Rates {
+		if !isKnownEventType(eventType) {
+			return fmt.Errorf("unknown event type %q in sampling", eventType)
+		}
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("sample rate %v of %s isn't between 0 and 1", rate, eventType)
+		}
+	}
+	if c.BoardSnapshots < 0 || c.BoardSnapshots > 1 {
+		return fmt.Errorf("board snapshot rate %v isn't between 0 and 1", c.BoardSnapshots)
+	}
+	return nil
+}
+
+// rate returns the share of the event type's events that are emitted
+func (c SamplingConfig) rate(eventType EventType) float64 {
+	if rate, ok := c.Rates[eventType]; ok {
+		return rate
+	}
+	return 1
+}
+
+// ParseSamplingConfig parses rates written as "move_played=0.5,social=0.2,board_snapshots=0.1".
+// Keys are event types, the groups of ParseTopicRoutes or board_snapshots. An
+// event type given on its own wins over its group.
+func ParseSamplingConfig(spec string) (SamplingConfig, error) {
+	config := DefaultSamplingConfig()
+	explicit := make(map[EventType]bool)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || key == "" || err != nil {
+			return SamplingConfig{}, fmt.Errorf("invalid sample rate %q, expected <event type or group>=<rate>", entry)
+		}
+
+		switch group, isGroup := eventGroups[key]; {
+		case key == boardSnapshotsKey:
+			config.BoardSnapshots = rate
+		case isGroup:
+			for _, eventType := range group {
+				if !explicit[eventType] {
+					config.Rates[eventType] = rate
+				}
+			}
+		default:
+			config.Rates[EventType(key)] = rate
+			explicit[EventType(key)] = true
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return SamplingConfig{}, err
+	}
+	return config, nil
+}
+
+// sampled picks whether an event sampled at the rate is kept
+func sampled(rate float64) bool {
+	return rate >= 1 || rand.Float64() < rate
+}
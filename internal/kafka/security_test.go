@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/xdg-go/scram"
+)
+
+// authenticate runs the mechanism's exchange against a SCRAM server that
+// knows the user's password, and reports whether both sides accepted it
+func authenticate(t *testing.T, mechanism sasl.Mechanism, hash scram.HashGeneratorFcn, username, password string) bool {
+	t.Helper()
+	client, err := hash.NewClient(username, password, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := client.GetStoredCredentials(scram.KeyFactors{Salt: "connect-four-salt", Iters: 4096})
+	server, err := hash.NewServer(func(string) (scram.StoredCredentials, error) { return credentials, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	conversation := server.NewConversation()
+
+	ctx := context.Background()
+	session, message, err := mechanism.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		challenge, err := conversation.Step(string(message))
+		if err != nil {
+			return false
+		}
+		done, response, err := session.Next(ctx, []byte(challenge))
+		if err != nil {
+			return false
+		}
+		if done {
+			return conversation.Valid()
+		}
+		message = response
+	}
+}
+
+func TestScramMechanisms(t *testing.T) {
+	tests := []struct {
+		mechanism string
+		hash      scram.HashGeneratorFcn
+	}{
+		{SASLScramSHA256, scram.SHA256},
+		{SASLScramSHA512, scram.SHA512},
+	}
+	for _, tt := range tests {
+		config := SecurityConfig{SASLMechanism: tt.mechanism, SASLUsername: "analytics", SASLPassword: "s3cret"}
+		mechanism, err := config.mechanism()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.mechanism, err)
+		}
+		if mechanism.Name() != tt.mechanism {
+			t.Errorf("%s mechanism is named %s", tt.mechanism, mechanism.Name())
+		}
+		if !authenticate(t, mechanism, tt.hash, "analytics", "s3cret") {
+			t.Errorf("%s: the broker rejected the right password", tt.mechanism)
+		}
+		if authenticate(t, mechanism, tt.hash, "analytics", "other") {
+			t.Errorf("%s: the broker accepted the wrong password", tt.mechanism)
+		}
+	}
+}
+
+func TestSecurityConfigMechanism(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SecurityConfig
+		want    string
+		wantErr bool
+	}{
+		{"none", SecurityConfig{}, "", false},
+		{"plain", SecurityConfig{SASLMechanism: SASLPlain, SASLUsername: "analytics"}, SASLPlain, false},
+		{"no username", SecurityConfig{SASLMechanism: SASLScramSHA256}, "", true},
+		{"unknown", SecurityConfig{SASLMechanism: "GSSAPI", SASLUsername: "analytics"}, "", true},
+	}
+	for _, tt := range tests {
+		mechanism, err := tt.config.mechanism()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		name := ""
+		if mechanism != nil {
+			name = mechanism.Name()
+		}
+		if name != tt.want {
+			t.Errorf("%s: mechanism = %q, want %q", tt.name, name, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Event serialization formats
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+// Content types set in the content-type header of every message
+const (
+	contentTypeJSON = "application/json"
+	contentTypeAvro = "application/vnd.confluent.avro"
+)
+
+// schemaVersions is the current shape of each event. Bump an event's version
+// whenever a field changes meaning or is removed, adding fields doesn't need
+// one. Events written before versioning carry no version and read as 0,
+// which has the same shape as 1.
+var schemaVersions = map[EventType]int{}
+
+// SchemaVersion returns the schema version events of the type are written with
+func SchemaVersion(eventType EventType) int {
+	if version, ok := schemaVersions[eventType]; ok {
+		return version
+	}
+	return 1
+}
+
+// SerializationConfig picks how events are encoded on the topic. Avro needs a
+// schema registry, JSON doesn't use one.
+type SerializationConfig struct {
+	Format            string `json:"format"`
+	SchemaRegistryURL string `json:"schema_registry_url"`
+}
+
+// Serializer encodes events into message values
+type Serializer interface {
+	Serialize(eventType EventType, event interface{}) ([]byte, error)
+	ContentType() string
+}
+
+// NewSerializer creates the serializer for the topics events are routed to
+func NewSerializer(config SerializationConfig, router TopicRouter) (Serializer, error) {
+	switch config.Format {
+	case "", FormatJSON:
+		return jsonSerializer{}, nil
+	case FormatAvro:
+		if config.SchemaRegistryURL == "" {
+			return nil, fmt.Errorf("avro serialization needs a schema registry URL")
+		}
+		registry, err := NewSchemaRegistry(config.SchemaRegistryURL)
+		if err != nil {
+			return nil, err
+		}
+		return NewAvroSerializer(registry, router), nil
+	default:
+		return nil, fmt.Errorf("unknown serialization format %q, expected json or avro", config.Format)
+	}
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Serialize(eventType EventType, event interface{}) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func (jsonSerializer) ContentType() string {
+	return contentTypeJSON
+}
+
+// AvroSerializer writes events in the Confluent wire format: a zero byte, the
+// registry's schema ID as a big-endian uint32, then the Avro encoded event.
+// Each event struct is registered on first use under "<topic>-<record name>",
+// with the topic the event is routed to, so events can share a topic.
+type AvroSerializer struct {
+	registry *SchemaRegistry
+	router   TopicRouter
+
+	mu      sync.Mutex
+	schemas map[schemaKey]*registeredSchema
+}
+
+type schemaKey struct {
+	topic string
+	t     reflect.Type
+}
+
+type registeredSchema struct {
+	id     int
+	schema *avroSchema
+}
+
+func NewAvroSerializer(registry *SchemaRegistry, router TopicRouter) *AvroSerializer {
+	return &AvroSerializer{
+		registry: registry,
+		router:   router,
+		schemas:  make(map[schemaKey]*registeredSchema),
+	}
+}
+
+func (s *AvroSerializer) Serialize(eventType EventType, event interface{}) ([]byte, error) {
+	registered, err := s.schemaFor(s.router.Topic(eventType), reflect.TypeOf(event))
+	if err != nil {
+		return nil, err
+	}
+
+	// Go through JSON so the Avro record matches the JSON event field for field
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.BigEndian, uint32(registered.id))
+	if err := avroEncode(&buf, registered.schema, value); err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *AvroSerializer) ContentType() string {
+	return contentTypeAvro
+}
+
+func (s *AvroSerializer) schemaFor(topic string, t reflect.Type) (*registeredSchema, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := schemaKey{topic: topic, t: t}
+	if registered, ok := s.schemas[key]; ok {
+		return registered, nil
+	}
+
+	schema, err := avroSchemaFor(t)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.registry.Register(topic+"-"+schema.Name, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := &registeredSchema{id: id, schema: schema}
+	s.schemas[key] = registered
+	return registered, nil
+}
+
+// traceParentHeader carries the W3C traceparent of the span that published
+// the message
+const traceParentHeader = "traceparent"
+
+// eventHeaders describe a message for consumers that don't look inside it
+func eventHeaders(eventType EventType, contentType string) []kafka.Header {
+	return []kafka.Header{
+		{Key: "content-type", Value: []byte(contentType)},
+		{Key: "event_type", Value: []byte(eventType)},
+		{Key: "schema_version", Value: []byte(strconv.Itoa(SchemaVersion(eventType)))},
+	}
+}
+
+// EventDecoder turns message values back into JSON events, whichever format
+// they were written in. JSON values are returned as they are.
+type EventDecoder struct {
+	registry *SchemaRegistry // nil when only JSON events are expected
+}
+
+// NewEventDecoder creates a decoder, the registry URL is only needed for Avro events
+func NewEventDecoder(schemaRegistryURL string) (*EventDecoder, error) {
+	decoder := &EventDecoder{}
+	if schemaRegistryURL != "" {
+		registry, err := NewSchemaRegistry(schemaRegistryURL)
+		if err != nil {
+			return nil, err
+		}
+		decoder.registry = registry
+	}
+	return decoder, nil
+}
+
+// Decode returns the event as JSON. Avro events are read with the schema they
+// were written with, so old messages still decode after the event changes.
+func (d *EventDecoder) Decode(value []byte) ([]byte, error) {
+	// JSON never starts with a zero byte
+	if len(value) == 0 || value[0] != 0 {
+		return value, nil
+	}
+	if d.registry == nil {
+		return nil, fmt.Errorf("avro event but no schema registry is configured")
+	}
+	if len(value) < 5 {
+		return nil, errAvroShortBuffer
+	}
+
+	id := int(binary.BigEndian.Uint32(value[1:5]))
+	schema, err := d.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := avroDecode(bytes.NewReader(value[5:]), schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode event with schema %d: %w", id, err)
+	}
+	return json.Marshal(event)
+}
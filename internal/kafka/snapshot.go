@@ -0,0 +1,370 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Written into snapshots, a snapshot of another version isn't restored
+const snapshotVersion = 1
+
+// SnapshotConfig configures snapshots of the event processor's whole state,
+// aggregates and trackers, together with the offsets they cover. With
+// snapshots the consumer commits offsets only once a snapshot holds them, so
+// after a crash it restores the last snapshot and reads on from there instead
+// of starting from empty aggregates.
+type SnapshotConfig struct {
+	Path     string        `json:"path"` // empty to not snapshot
+	Interval time.Duration `json:"interval"`
+}
+
+// DefaultSnapshotConfig returns the snapshot interval, snapshots are off until Path is set
+func DefaultSnapshotConfig() SnapshotConfig {
+	return SnapshotConfig{
+		Interval: time.Minute,
+	}
+}
+
+// SnapshotConfigFromEnv reads the snapshot settings from SNAPSHOT_PATH and SNAPSHOT_INTERVAL
+func SnapshotConfigFromEnv() SnapshotConfig {
+	config := DefaultSnapshotConfig()
+	config.Path = os.Getenv("SNAPSHOT_PATH")
+	if value, err := time.ParseDuration(os.Getenv("SNAPSHOT_INTERVAL")); err == nil && value > 0 {
+		config.Interval = value
+	}
+	return config
+}
+
+// processorSnapshot is the event processor's state once every message up to
+// Offsets was processed
+type processorSnapshot struct {
+	Version int                      `json:"version"`
+	TakenAt time.Time                `json:"taken_at"`
+	Offsets map[string]map[int]int64 `json:"offsets"` // next offset to read, by topic and partition
+
+	Games   *GameMetrics   `json:"games"`
+	Players *PlayerMetrics `json:"players"`
+	Hourly  *HourlyMetrics `json:"hourly"`
+	Daily   *DailyMetrics  `json:"daily"`
+	Queues  *QueueSnapshot `json:"queues"`
+
+	Distributions  *Distributions             `json:"distributions"`
+	Columns        *ColumnMetrics             `json:"columns"`
+	Openings       *OpeningMetrics            `json:"openings"`
+	PendingColumns map[string]*pendingColumns `json:"pending_columns"`
+	Concurrency    *concurrencyState          `json:"concurrency"`
+	Anomalies      *anomalyState              `json:"anomalies"`
+
+	// Counts already added to the shared counters, nil when not shared
+	SharedCounters map[string]map[string]int64 `json:"shared_counters,omitempty"`
+
+	ActiveGames    map[string]*ActiveGame    `json:"active_games"`
+	TrackedPlayers map[string]*TrackedPlayer `json:"tracked_players"`
+	HourlyStats    map[string]*HourlyStats   `json:"hourly_stats"`
+}
+
+// snapshotOffsets tracks the next offset to read of every partition
+type snapshotOffsets map[string]map[int]int64
+
+// covers reports whether the message is already part of the snapshot
+func (o snapshotOffsets) covers(message kafka.Message) bool {
+	next, ok := o[message.Topic][message.Partition]
+	return ok && message.Offset < next
+}
+
+func (o snapshotOffsets) advance(messages []kafka.Message) {
+	for _, message := range messages {
+		partitions := o[message.Topic]
+		if partitions == nil {
+			partitions = make(map[int]int64)
+			o[message.Topic] = partitions
+		}
+		if message.Offset+1 > partitions[message.Partition] {
+			partitions[message.Partition] = message.Offset + 1
+		}
+	}
+}
+
+func (o snapshotOffsets) copy() map[string]map[int]int64 {
+	offsets := make(map[string]map[int]int64, len(o))
+	for topic, partitions := range o {
+		offsets[topic] = make(map[int]int64, len(partitions))
+		for partition, offset := range partitions {
+			offsets[topic][partition] = offset
+		}
+	}
+	return offsets
+}
+
+// snapshot captures the processor's state, no message may be processing
+func (ep *EventProcessor) snapshot(offsets snapshotOffsets) *processorSnapshot {
+	games := ep.aggregator.GetGameMetrics()
+	players := ep.aggregator.GetPlayerMetrics()
+	hourly := ep.aggregator.GetHourlyMetrics()
+	daily := ep.aggregator.GetDailyMetrics()
+	queues := ep.aggregator.GetQueueMetrics()
+	distributions := ep.aggregator.GetDistributions()
+	columns := ep.aggregator.GetColumnMetrics()
+	openings := ep.aggregator.GetOpeningMetrics()
+
+	return &processorSnapshot{
+		Version:        snapshotVersion,
+		TakenAt:        time.Now(),
+		Offsets:        offsets.copy(),
+		Games:          &games,
+		Players:        &players,
+		Hourly:         &hourly,
+		Daily:          &daily,
+		Queues:         &queues,
+		Distributions:  &distributions,
+		Columns:        &columns,
+		Openings:       &openings,
+		PendingColumns: ep.aggregator.columnMetrics.pendingState(),
+		Concurrency:    ep.aggregator.concurrency.copyState(),
+		Anomalies:      ep.anomalies.state(),
+		SharedCounters: ep.aggregator.pushedCounters(),
+		ActiveGames:    ep.gameTracker.state(),
+		TrackedPlayers: ep.playerTracker.state(),
+		HourlyStats:    ep.hourlyTracker.state(),
+	}
+}
+
+// restore replaces the processor's state with the snapshot's
+func (ep *EventProcessor) restore(snapshot *processorSnapshot) {
+	ep.aggregator.restore(snapshot)
+	ep.gameTracker.restore(snapshot.ActiveGames)
+	ep.playerTracker.restore(snapshot.TrackedPlayers)
+	ep.hourlyTracker.restore(snapshot.HourlyStats)
+	if snapshot.Anomalies != nil {
+		ep.anomalies.restore(snapshot.Anomalies)
+	}
+}
+
+// writeSnapshot writes the snapshot aside and renames it over the last one,
+// so a crash while writing leaves the last snapshot intact
+func writeSnapshot(path string, snapshot *processorSnapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	partial := path + ".partial"
+	file, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	if err := json.NewEncoder(writer).Encode(snapshot); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return os.Rename(partial, path)
+}
+
+// readSnapshot returns the snapshot at path, or nil if there is none yet
+func readSnapshot(path string) (*processorSnapshot, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	var snapshot processorSnapshot
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", path, err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot %s has version %d, this consumer reads %d", path, snapshot.Version, snapshotVersion)
+	}
+	return &snapshot, nil
+}
+
+// restore replaces the aggregates with the snapshot's
+func (ma *MetricsAggregator) restore(snapshot *processorSnapshot) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	if games := snapshot.Games; games != nil {
+		ma.gameMetrics.mu.Lock()
+		ma.gameMetrics.TotalGames = games.TotalGames
+		ma.gameMetrics.CompletedGames = games.CompletedGames
+		ma.gameMetrics.AverageGameDuration = games.AverageGameDuration
+		ma.gameMetrics.TotalGameDuration = games.TotalGameDuration
+		ma.gameMetrics.WinnerFrequency = orEmpty(games.WinnerFrequency)
+		ma.gameMetrics.WinTypeDistribution = orEmpty(games.WinTypeDistribution)
+		ma.gameMetrics.DrawCount = games.DrawCount
+		ma.gameMetrics.BotGames = games.BotGames
+		ma.gameMetrics.HumanGames = games.HumanGames
+		ma.gameMetrics.mu.Unlock()
+	}
+
+	if players := snapshot.Players; players != nil {
+		ma.players.replace(players.ActivePlayers)
+		atomic.StoreInt64(&ma.playerTotals.players, players.TotalPlayers)
+		atomic.StoreInt64(&ma.playerTotals.newToday, players.NewPlayersToday)
+		atomic.StoreInt64(&ma.playerTotals.moves, players.TotalMoves)
+		atomic.StoreInt64(&ma.playerTotals.disconnections, players.TotalDisconnections)
+		atomic.StoreInt64(&ma.playerTotals.reconnections, players.TotalReconnections)
+	}
+
+	if hourly := snapshot.Hourly; hourly != nil {
+		ma.hourlyMetrics.mu.Lock()
+		ma.hourlyMetrics.GamesPerHour = orEmpty(hourly.GamesPerHour)
+		ma.hourlyMetrics.MovesPerHour = orEmpty(hourly.MovesPerHour)
+		ma.hourlyMetrics.PlayersPerHour = orEmpty(hourly.PlayersPerHour)
+		ma.hourlyMetrics.AverageDurationHour = orEmpty(hourly.AverageDurationHour)
+		ma.hourlyMetrics.CurrentHour = hourly.CurrentHour
+		ma.hourlyMetrics.mu.Unlock()
+	}
+
+	if daily := snapshot.Daily; daily != nil {
+		ma.dailyMetrics.mu.Lock()
+		ma.dailyMetrics.GamesPerDay = orEmpty(daily.GamesPerDay)
+		ma.dailyMetrics.MovesPerDay = orEmpty(daily.MovesPerDay)
+		ma.dailyMetrics.PlayersPerDay = orEmpty(daily.PlayersPerDay)
+		ma.dailyMetrics.AverageDurationDay = orEmpty(daily.AverageDurationDay)
+		ma.dailyMetrics.NewPlayersPerDay = orEmpty(daily.NewPlayersPerDay)
+		ma.dailyMetrics.CurrentDay = daily.CurrentDay
+		ma.dailyMetrics.mu.Unlock()
+	}
+
+	if queues := snapshot.Queues; queues != nil {
+		ma.queueMetrics.mu.Lock()
+		ma.queueMetrics.Queues = orEmpty(queues.Queues)
+		for _, queue := range ma.queueMetrics.Queues {
+			queue.PeakDepthPerHour = orEmpty(queue.PeakDepthPerHour)
+			queue.MatchesPerHour = orEmpty(queue.MatchesPerHour)
+			queue.AverageWaitHour = orEmpty(queue.AverageWaitHour)
+		}
+		ma.queueMetrics.mu.Unlock()
+	}
+
+	// Histograms start over when their buckets were reconfigured
+	if distributions := snapshot.Distributions; distributions != nil {
+		if !ma.gameDurations.restore(distributions.GameDuration) {
+			log.Printf("Game duration buckets changed since the snapshot, starting the histogram over")
+		}
+		if !ma.moveTimes.restore(distributions.MoveTime) {
+			log.Printf("Move time buckets changed since the snapshot, starting the histogram over")
+		}
+	}
+
+	if columns := snapshot.Columns; columns != nil {
+		ma.columnMetrics.restore(columns, snapshot.Openings, snapshot.PendingColumns)
+	}
+
+	if concurrency := snapshot.Concurrency; concurrency != nil {
+		ma.concurrency.restore(concurrency)
+	}
+
+	// Counts not added yet when the snapshot was taken are added with the
+	// next push. Those of a snapshot taken without sharing never are.
+	ma.countersMu.Lock()
+	if ma.counters != nil {
+		ma.countersPushed = snapshot.SharedCounters
+		if ma.countersPushed == nil {
+			ma.countersPushed = ma.localCounters()
+		}
+	}
+	ma.countersMu.Unlock()
+}
+
+// orEmpty returns the map, or an empty one for a nil map
+func orEmpty[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return make(map[K]V)
+	}
+	return m
+}
+
+// state returns a copy of every tracked game
+func (gt *GameTracker) state() map[string]*ActiveGame {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+
+	games := make(map[string]*ActiveGame, len(gt.activeGames))
+	for gameID, game := range gt.activeGames {
+		gameCopy := *game
+		gameCopy.Players = append([]string(nil), game.Players...)
+		games[gameID] = &gameCopy
+	}
+	return games
+}
+
+func (gt *GameTracker) restore(games map[string]*ActiveGame) {
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+	gt.activeGames = orEmpty(games)
+	gt.inProgress = 0
+	for _, game := range gt.activeGames {
+		if !game.IsCompleted {
+			gt.inProgress++
+		}
+	}
+}
+
+// state returns a copy of every tracked player
+func (pt *PlayerTracker) state() map[string]*TrackedPlayer {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	players := make(map[string]*TrackedPlayer, len(pt.players))
+	for name, player := range pt.players {
+		playerCopy := *player
+		players[name] = &playerCopy
+	}
+	return players
+}
+
+func (pt *PlayerTracker) restore(players map[string]*TrackedPlayer) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.players = orEmpty(players)
+	pt.online = 0
+	for _, player := range pt.players {
+		if player.IsOnline {
+			pt.online++
+		}
+	}
+}
+
+// state returns a copy of every tracked hour
+func (ht *HourlyTracker) state() map[string]*HourlyStats {
+	ht.mu.RLock()
+	defer ht.mu.RUnlock()
+
+	stats := make(map[string]*HourlyStats, len(ht.hourlyStats))
+	for hour, hourStats := range ht.hourlyStats {
+		statsCopy := *hourStats
+		stats[hour] = &statsCopy
+	}
+	return stats
+}
+
+func (ht *HourlyTracker) restore(stats map[string]*HourlyStats) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	ht.hourlyStats = orEmpty(stats)
+}
@@ -0,0 +1,314 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const spoolExtension = ".spool"
+
+// ErrSpoolFull is returned when a message would take the spool past its size cap
+var ErrSpoolFull = errors.New("kafka spool is full")
+
+// SpoolConfig enables the producer's disk buffer. Messages that can't be
+// delivered are appended to segment files in Dir, and later messages join
+// them until the brokers are reachable again, so events keep their order.
+type SpoolConfig struct {
+	Dir           string        `json:"dir"`            // empty disables spooling
+	MaxBytes      int64         `json:"max_bytes"`      // messages past this are dropped
+	FlushInterval time.Duration `json:"flush_interval"` // how often the brokers are tried while messages are spooled
+}
+
+// DefaultSpoolConfig returns the spool settings used when a directory is configured
+func DefaultSpoolConfig(dir string) SpoolConfig {
+	return SpoolConfig{
+		Dir:           dir,
+		MaxBytes:      256 << 20, // 256MB
+		FlushInterval: 5 * time.Second,
+	}
+}
+
+// SpoolStats reports the spooled backlog
+type SpoolStats struct {
+	BacklogMessages int64     `json:"backlog_messages"`
+	BacklogBytes    int64     `json:"backlog_bytes"`
+	Spooled         int64     `json:"spooled"`
+	Flushed         int64     `json:"flushed"`
+	Dropped         int64     `json:"dropped"`
+	LastFlushTime   time.Time `json:"last_flush_time"`
+}
+
+// spoolRecord is a message as it is kept on disk
+type spoolRecord struct {
+	Topic   string         `json:"topic,omitempty"`
+	Key     []byte         `json:"key"`
+	Value   []byte         `json:"value"`
+	Headers []kafka.Header `json:"headers,omitempty"`
+	Time    time.Time      `json:"time"`
+}
+
+// spool is an append-only log of undelivered messages, split in segments so
+// a segment can be flushed while new messages go to the next one. Each record
+// is a big-endian uint32 length followed by the JSON record.
+type spool struct {
+	config SpoolConfig
+
+	mu         sync.Mutex
+	active     *os.File
+	activeName string
+	sequence   int
+	segments   map[string]int64 // record count of each segment
+	stats      SpoolStats
+}
+
+// openSpool opens the spool directory, messages left by a previous run count
+// as backlog and are flushed like any other
+func openSpool(config SpoolConfig) (*spool, error) {
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &spool{
+		config:   config,
+		segments: make(map[string]int64),
+	}
+
+	names, err := s.segmentNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		records, size, err := countSpoolRecords(name)
+		if err != nil {
+			return nil, err
+		}
+		s.segments[name] = records
+		s.stats.BacklogMessages += records
+		s.stats.BacklogBytes += size
+
+		if n, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(name), spoolExtension)); err == nil && n > s.sequence {
+			s.sequence = n
+		}
+	}
+
+	return s, nil
+}
+
+// backlog returns the number of spooled messages
+func (s *spool) backlog() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats.BacklogMessages
+}
+
+// append adds messages to the active segment, dropping those past the size cap
+func (s *spool) append(messages ...kafka.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		s.sequence++
+		s.activeName = filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", s.sequence, spoolExtension))
+		file, err := os.OpenFile(s.activeName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open spool segment: %w", err)
+		}
+		s.active = file
+		s.segments[s.activeName] = 0
+	}
+
+	writer := bufio.NewWriter(s.active)
+	var dropped int
+	for _, message := range messages {
+		data, err := json.Marshal(spoolRecord{
+			Topic:   message.Topic,
+			Key:     message.Key,
+			Value:   message.Value,
+			Headers: message.Headers,
+			Time:    message.Time,
+		})
+		if err != nil {
+			return err
+		}
+
+		size := int64(4 + len(data))
+		if s.config.MaxBytes > 0 && s.stats.BacklogBytes+size > s.config.MaxBytes {
+			dropped++
+			continue
+		}
+
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+		writer.Write(length[:])
+		writer.Write(data)
+
+		s.segments[s.activeName]++
+		s.stats.BacklogMessages++
+		s.stats.BacklogBytes += size
+		s.stats.Spooled++
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	// The spool is only worth having if it survives the process
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+
+	if dropped > 0 {
+		s.stats.Dropped += int64(dropped)
+		return fmt.Errorf("%w, dropped %d messages", ErrSpoolFull, dropped)
+	}
+	return nil
+}
+
+// seal closes the active segment and returns every segment waiting to be
+// flushed, oldest first
+func (s *spool) seal() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close spool segment: %w", err)
+		}
+		s.active = nil
+	}
+
+	return s.segmentNames()
+}
+
+// read returns the messages of a segment. A record cut short by a crash ends the segment.
+func (s *spool) read(name string) ([]kafka.Message, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var messages []kafka.Message
+	reader := bufio.NewReader(file)
+	for {
+		record, err := readSpoolRecord(reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return messages, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corrupt spool segment %s: %w", name, err)
+		}
+
+		messages = append(messages, kafka.Message{
+			Topic:   record.Topic,
+			Key:     record.Key,
+			Value:   record.Value,
+			Headers: record.Headers,
+			Time:    record.Time,
+		})
+	}
+}
+
+// flushed removes a segment once its messages were delivered
+func (s *spool) flushed(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.segments[name]
+	delete(s.segments, name)
+	s.stats.BacklogMessages -= records
+	s.stats.BacklogBytes -= info.Size()
+	s.stats.Flushed += records
+	s.stats.LastFlushTime = time.Now()
+	return nil
+}
+
+func (s *spool) getStats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *spool) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// segmentNames lists the segment files, oldest first
+func (s *spool) segmentNames() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(s.config.Dir, "*"+spoolExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func countSpoolRecords(name string) (int64, int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var records int64
+	reader := bufio.NewReader(file)
+	for {
+		if _, err := readSpoolRecord(reader); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return records, info.Size(), nil
+			}
+			return 0, 0, fmt.Errorf("corrupt spool segment %s: %w", name, err)
+		}
+		records++
+	}
+}
+
+func readSpoolRecord(reader *bufio.Reader) (*spoolRecord, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(reader, length[:]); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+
+	var record spoolRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
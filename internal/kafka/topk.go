@@ -0,0 +1,67 @@
+package kafka
+
+import "sort"
+
+// topK keeps the k best items offered to it in a heap whose root is the
+// worst kept, so ranking n items takes O(n log k) and holds only k of them
+type topK[T any] struct {
+	k      int
+	better func(a, b T) bool // a ranks above b, ties must be broken for a stable ranking
+	items  []T
+}
+
+func newTopK[T any](k int, better func(a, b T) bool) *topK[T] {
+	if k < 0 {
+		k = 0
+	}
+	return &topK[T]{k: k, better: better}
+}
+
+// offer keeps the item if it ranks among the k best so far
+func (t *topK[T]) offer(item T) {
+	if len(t.items) < t.k {
+		t.items = append(t.items, item)
+		t.up(len(t.items) - 1)
+		return
+	}
+	if t.k == 0 || !t.better(item, t.items[0]) {
+		return
+	}
+	t.items[0] = item
+	t.down(0)
+}
+
+// sorted returns the kept items, best first
+func (t *topK[T]) sorted() []T {
+	items := make([]T, len(t.items))
+	copy(items, t.items)
+	sort.Slice(items, func(i, j int) bool { return t.better(items[i], items[j]) })
+	return items
+}
+
+func (t *topK[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !t.better(t.items[parent], t.items[i]) {
+			return
+		}
+		t.items[parent], t.items[i] = t.items[i], t.items[parent]
+		i = parent
+	}
+}
+
+func (t *topK[T]) down(i int) {
+	for {
+		worst := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(t.items) && t.better(t.items[worst], t.items[child]) {
+				worst = child
+			}
+		}
+		if worst == i {
+			return
+		}
+		t.items[worst], t.items[i] = t.items[i], t.items[worst]
+		i = worst
+	}
+}
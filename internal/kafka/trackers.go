@@ -8,6 +8,7 @@ import (
 // GameTracker tracks active games and their states
 type GameTracker struct {
 	activeGames map[string]*ActiveGame
+	inProgress  int // games not completed, kept so counting them doesn't scan every game
 	mu          sync.RWMutex
 }
 
@@ -41,6 +42,9 @@ func (gt *GameTracker) StartGame(gameID string, players []PlayerInfo, startTime
 		playerNames[i] = player.Name
 	}
 
+	if game, exists := gt.activeGames[gameID]; !exists || game.IsCompleted {
+		gt.inProgress++
+	}
 	gt.activeGames[gameID] = &ActiveGame{
 		GameID:      gameID,
 		Players:     playerNames,
@@ -67,6 +71,9 @@ func (gt *GameTracker) EndGame(gameID, winner string, duration int64, endTime ti
 	defer gt.mu.Unlock()
 
 	if game, exists := gt.activeGames[gameID]; exists {
+		if !game.IsCompleted {
+			gt.inProgress--
+		}
 		game.Winner = winner
 		game.Duration = duration
 		game.EndTime = &endTime
@@ -78,14 +85,14 @@ func (gt *GameTracker) EndGame(gameID, winner string, duration int64, endTime ti
 func (gt *GameTracker) GetActiveGameCount() int {
 	gt.mu.RLock()
 	defer gt.mu.RUnlock()
+	return gt.inProgress
+}
 
-	count := 0
-	for _, game := range gt.activeGames {
-		if !game.IsCompleted {
-			count++
-		}
-	}
-	return count
+// GetGameCount returns the number of games tracked, completed ones included
+func (gt *GameTracker) GetGameCount() int {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+	return len(gt.activeGames)
 }
 
 // GetActiveGames returns all active games
@@ -103,6 +110,86 @@ func (gt *GameTracker) GetActiveGames() []*ActiveGame {
 	return activeGames
 }
 
+// GetRecentlyCompleted returns copies of the last completed games still
+// tracked, the latest first
+func (gt *GameTracker) GetRecentlyCompleted(limit int) []*ActiveGame {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+
+	top := newTopK(limit, func(a, b *ActiveGame) bool {
+		if !a.EndTime.Equal(*b.EndTime) {
+			return a.EndTime.After(*b.EndTime)
+		}
+		return a.GameID < b.GameID
+	})
+	for _, game := range gt.activeGames {
+		if game.IsCompleted && game.EndTime != nil {
+			top.offer(game)
+		}
+	}
+
+	games := top.sorted()
+	for i, game := range games {
+		gameCopy := *game
+		games[i] = &gameCopy
+	}
+	return games
+}
+
+// FindGames returns the page after offset of the games matching the filter,
+// the latest started first
+func (gt *GameTracker) FindGames(filter GameFilter, limit, offset int) GamePage {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+
+	top := newTopK(offset+limit, func(a, b *ActiveGame) bool {
+		if !a.StartTime.Equal(b.StartTime) {
+			return a.StartTime.After(b.StartTime)
+		}
+		return a.GameID < b.GameID
+	})
+	total := 0
+	for _, game := range gt.activeGames {
+		if filter.Completed != nil && game.IsCompleted != *filter.Completed {
+			continue
+		}
+		if filter.Player != "" && !containsPlayer(game.Players, filter.Player) {
+			continue
+		}
+		top.offer(game)
+		total++
+	}
+
+	games := pageOf(top.sorted(), offset)
+	for i, game := range games {
+		gameCopy := *game
+		games[i] = &gameCopy
+	}
+	return GamePage{Games: games, Total: total, Limit: limit, Offset: offset}
+}
+
+// GetGame returns a copy of the game, false when it isn't tracked
+func (gt *GameTracker) GetGame(gameID string) (*ActiveGame, bool) {
+	gt.mu.RLock()
+	defer gt.mu.RUnlock()
+
+	game, exists := gt.activeGames[gameID]
+	if !exists {
+		return nil, false
+	}
+	gameCopy := *game
+	return &gameCopy, true
+}
+
+func containsPlayer(players []string, name string) bool {
+	for _, player := range players {
+		if player == name {
+			return true
+		}
+	}
+	return false
+}
+
 // CleanupCompletedGames removes completed games older than the specified duration
 func (gt *GameTracker) CleanupCompletedGames(maxAge time.Duration) {
 	gt.mu.Lock()
@@ -119,6 +206,7 @@ func (gt *GameTracker) CleanupCompletedGames(maxAge time.Duration) {
 // PlayerTracker tracks player activities and statistics
 type PlayerTracker struct {
 	players map[string]*TrackedPlayer
+	online  int // players online, kept so counting them doesn't scan every player
 	mu      sync.RWMutex
 }
 
@@ -162,10 +250,12 @@ func (pt *PlayerTracker) TrackPlayer(playerName string, timestamp time.Time) {
 			IsOnline:         true,
 			SessionStartTime: timestamp,
 		}
+		pt.online++
 	} else {
 		player := pt.players[playerName]
 		player.LastSeen = timestamp
 		if !player.IsOnline {
+			pt.online++
 			player.IsOnline = true
 			player.SessionStartTime = timestamp
 		}
@@ -211,6 +301,9 @@ func (pt *PlayerTracker) RecordDisconnection(playerName string, timestamp time.T
 
 	if player, exists := pt.players[playerName]; exists {
 		player.Disconnections++
+		if player.IsOnline {
+			pt.online--
+		}
 		player.IsOnline = false
 		player.LastSeen = timestamp
 		
@@ -229,6 +322,9 @@ func (pt *PlayerTracker) RecordReconnection(playerName string, offlineDuration t
 	if player, exists := pt.players[playerName]; exists {
 		player.Reconnections++
 		player.TotalOfflineTime += offlineDuration
+		if !player.IsOnline {
+			pt.online++
+		}
 		player.IsOnline = true
 		player.LastSeen = timestamp
 		player.SessionStartTime = timestamp
@@ -242,18 +338,45 @@ func (pt *PlayerTracker) GetPlayerCount() int {
 	return len(pt.players)
 }
 
-// GetOnlinePlayerCount returns the number of online players
-func (pt *PlayerTracker) GetOnlinePlayerCount() int {
-	pt.mu.RLock()
-	defer pt.mu.RUnlock()
+// EvictOldest stops tracking the players seen least recently until at most
+// max are left and returns how many it dropped
+func (pt *PlayerTracker) EvictOldest(max int) int {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
 
-	count := 0
+	excess := len(pt.players) - max
+	if excess <= 0 {
+		return 0
+	}
+	oldest := newTopK(excess, seenEarlier)
 	for _, player := range pt.players {
-		if player.IsOnline {
-			count++
+		oldest.offer(seenPlayer{name: player.Name, lastSeen: player.LastSeen})
+	}
+	for _, candidate := range oldest.items {
+		if pt.players[candidate.name].IsOnline {
+			pt.online--
 		}
+		delete(pt.players, candidate.name)
 	}
-	return count
+	return len(oldest.items)
+}
+
+// Forget stops tracking an erased player
+func (pt *PlayerTracker) Forget(playerName string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if player, exists := pt.players[playerName]; exists && player.IsOnline {
+		pt.online--
+	}
+	delete(pt.players, playerName)
+}
+
+// GetOnlinePlayerCount returns the number of online players
+func (pt *PlayerTracker) GetOnlinePlayerCount() int {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return pt.online
 }
 
 // GetTopPlayers returns the top players by games won
@@ -261,25 +384,22 @@ func (pt *PlayerTracker) GetTopPlayers(limit int) []*TrackedPlayer {
 	pt.mu.RLock()
 	defer pt.mu.RUnlock()
 
-	players := make([]*TrackedPlayer, 0, len(pt.players))
-	for _, player := range pt.players {
-		playerCopy := *player
-		players = append(players, &playerCopy)
-	}
-
-	// Simple bubble sort by games won (descending)
-	for i := 0; i < len(players)-1; i++ {
-		for j := 0; j < len(players)-i-1; j++ {
-			if players[j].GamesWon < players[j+1].GamesWon {
-				players[j], players[j+1] = players[j+1], players[j]
-			}
+	// Only the top players are copied, ties go to the name first in order
+	top := newTopK(limit, func(a, b *TrackedPlayer) bool {
+		if a.GamesWon != b.GamesWon {
+			return a.GamesWon > b.GamesWon
 		}
+		return a.Name < b.Name
+	})
+	for _, player := range pt.players {
+		top.offer(player)
 	}
 
-	if len(players) > limit {
-		players = players[:limit]
+	players := top.sorted()
+	for i, player := range players {
+		playerCopy := *player
+		players[i] = &playerCopy
 	}
-
 	return players
 }
 
@@ -303,6 +423,7 @@ func (pt *PlayerTracker) UpdatePlayerActivity(inactiveThreshold time.Duration) {
 	cutoff := time.Now().Add(-inactiveThreshold)
 	for _, player := range pt.players {
 		if player.IsOnline && player.LastSeen.Before(cutoff) {
+			pt.online--
 			player.IsOnline = false
 			// Add final session time
 			if !player.SessionStartTime.IsZero() {
@@ -458,6 +579,13 @@ func (ht *HourlyTracker) CleanupOldStats(maxAge time.Duration) {
 	}
 }
 
+// GetHourCount returns the number of hours tracked
+func (ht *HourlyTracker) GetHourCount() int {
+	ht.mu.RLock()
+	defer ht.mu.RUnlock()
+	return len(ht.hourlyStats)
+}
+
 // GetDailyTotals returns daily totals from hourly data
 func (ht *HourlyTracker) GetDailyTotals(days int) map[string]*DailyTotals {
 	ht.mu.RLock()
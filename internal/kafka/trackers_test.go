@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+// trackedPlayers is a tracker of n players, player i having won i%1000 games
+func trackedPlayers(n int) *PlayerTracker {
+	pt := NewPlayerTracker()
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("player%d", i)
+		pt.players[name] = &TrackedPlayer{Name: name, FirstSeen: now, LastSeen: now, GamesWon: i % 1000}
+	}
+	return pt
+}
+
+func TestGetTopPlayers(t *testing.T) {
+	pt := trackedPlayers(5000)
+
+	var want []*TrackedPlayer
+	for _, player := range pt.players {
+		want = append(want, player)
+	}
+	sort.Slice(want, func(i, j int) bool {
+		if want[i].GamesWon != want[j].GamesWon {
+			return want[i].GamesWon > want[j].GamesWon
+		}
+		return want[i].Name < want[j].Name
+	})
+
+	for _, limit := range []int{0, 1, 10, 4999, 5000, 6000} {
+		top := pt.GetTopPlayers(limit)
+		expected := want
+		if limit < len(expected) {
+			expected = expected[:limit]
+		}
+		if len(top) != len(expected) {
+			t.Errorf("GetTopPlayers(%d) returned %d players, want %d", limit, len(top), len(expected))
+			continue
+		}
+		for i := range top {
+			if top[i].Name != expected[i].Name {
+				t.Errorf("GetTopPlayers(%d)[%d] is %s with %d wins, want %s with %d",
+					limit, i, top[i].Name, top[i].GamesWon, expected[i].Name, expected[i].GamesWon)
+				break
+			}
+			if top[i] == pt.players[top[i].Name] {
+				t.Errorf("GetTopPlayers(%d) returned the tracked player, not a copy", limit)
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkGetTopPlayers(b *testing.B) {
+	pt := trackedPlayers(1000000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pt.GetTopPlayers(10)
+	}
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// workerPool processes messages in parallel while keeping each game's events
+// in order: all messages of a game go to the same worker, which handles them
+// one at a time in the order they were fetched
+type workerPool struct {
+	queues  []chan poolJob
+	process func(kafka.Message)
+	wg      sync.WaitGroup
+}
+
+type poolJob struct {
+	message kafka.Message
+	done    *sync.WaitGroup
+}
+
+func newWorkerPool(workers int, process func(kafka.Message)) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	pool := &workerPool{
+		queues:  make([]chan poolJob, workers),
+		process: process,
+	}
+	for i := range pool.queues {
+		pool.queues[i] = make(chan poolJob, 64)
+		pool.wg.Add(1)
+		go pool.work(pool.queues[i])
+	}
+	return pool
+}
+
+// run processes the batch and returns once every message is done
+func (p *workerPool) run(batch []kafka.Message) {
+	var done sync.WaitGroup
+	done.Add(len(batch))
+	for _, message := range batch {
+		p.queues[p.worker(message)] <- poolJob{message: message, done: &done}
+	}
+	done.Wait()
+}
+
+func (p *workerPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+func (p *workerPool) work(queue chan poolJob) {
+	defer p.wg.Done()
+
+	for job := range queue {
+		p.process(job.message)
+		job.done.Done()
+	}
+}
+
+func (p *workerPool) worker(message kafka.Message) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(messageGameID(message)))
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// messageGameID returns the game an event belongs to from its key, the game
+// ID. Tournament and queue events are keyed by tournament and player, so
+// their events stay in order the same way. Flags and milestones, and events
+// written before keys were only IDs, have their type in front of the ID.
+func messageGameID(message kafka.Message) string {
+	key := string(message.Key)
+	if eventType, id, ok := strings.Cut(key, ":"); ok && isKnownEventType(EventType(eventType)) {
+		return id
+	}
+	return key
+}
@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestMessageGameID(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"0b7c1b0e-4a59-4c51-9a4b-2f3f2a1d9c11", "0b7c1b0e-4a59-4c51-9a4b-2f3f2a1d9c11"},
+		{"move_played:0b7c1b0e-4a59-4c51-9a4b-2f3f2a1d9c11", "0b7c1b0e-4a59-4c51-9a4b-2f3f2a1d9c11"},
+		{"player_flagged:alice", "alice"},
+		{"not_an_event:alice", "not_an_event:alice"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := messageGameID(kafka.Message{Key: []byte(test.key)}); got != test.want {
+			t.Errorf("messageGameID(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestWorkerPoolKeepsGameOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]int64)
+	pool := newWorkerPool(4, func(message kafka.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		gameID := messageGameID(message)
+		seen[gameID] = append(seen[gameID], message.Offset)
+	})
+	defer pool.stop()
+
+	// Old and new keys of one game interleave with other games' events
+	games := []string{"game-a", "game-b", "game-c", "game-d", "game-e"}
+	var batch []kafka.Message
+	for offset := int64(0); offset < 200; offset++ {
+		key := games[offset%int64(len(games))]
+		if offset%3 == 0 {
+			key = "move_played:" + key
+		}
+		batch = append(batch, kafka.Message{Key: []byte(key), Offset: offset})
+	}
+	pool.run(batch)
+
+	for _, game := range games {
+		offsets := seen[game]
+		if len(offsets) != 40 {
+			t.Errorf("%s had %d events processed, want 40", game, len(offsets))
+		}
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Errorf("%s's events were processed out of order: %v", game, offsets)
+				break
+			}
+		}
+	}
+}
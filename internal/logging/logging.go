@@ -0,0 +1,77 @@
+// Package logging adds a level to the standard logger, which can be changed
+// while the server runs. Only the messages logged through this package have
+// a level: debug for the detail of every move, info for the activity of
+// players, connections and matches. Failures and lifecycle messages go
+// through the log package directly and are always logged.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is how much is logged, each level includes the ones above it
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel reads a level by name, as debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(strings.TrimSpace(name), levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("log level %q isn't debug, info, warn or error", name)
+}
+
+var current atomic.Int32
+
+func init() {
+	current.Store(int32(LevelInfo))
+}
+
+// SetLevel changes the level, info until it is set
+func SetLevel(level Level) {
+	current.Store(int32(level))
+}
+
+// CurrentLevel returns the level messages are logged at
+func CurrentLevel() Level {
+	return Level(current.Load())
+}
+
+// Enabled reports whether messages of the level are logged
+func Enabled(level Level) bool {
+	return level >= CurrentLevel()
+}
+
+// Debugf logs at the debug level
+func Debugf(format string, args ...interface{}) {
+	if Enabled(LevelDebug) {
+		log.Output(2, fmt.Sprintf(format, args...))
+	}
+}
+
+// Infof logs at the info level
+func Infof(format string, args ...interface{}) {
+	if Enabled(LevelInfo) {
+		log.Output(2, fmt.Sprintf(format, args...))
+	}
+}
@@ -7,11 +7,16 @@ var (
 	ErrServiceAlreadyRunning = errors.New("matchmaking service is already running")
 	ErrServiceNotRunning     = errors.New("matchmaking service is not running")
 	ErrServiceShuttingDown   = errors.New("matchmaking service is shutting down")
+	ErrServiceDraining       = errors.New("matchmaking service is draining")
+	ErrInvalidBotTimeout     = errors.New("bot match timeout must be positive")
 	
 	// Queue errors
 	ErrQueueFull         = errors.New("matchmaking queue is full")
 	ErrPlayerNotInQueue  = errors.New("player is not in queue")
 	ErrPlayerAlreadyInQueue = errors.New("player is already in queue")
+	ErrUsernameTaken        = errors.New("username is already queued by another player")
+	ErrPartyFull            = errors.New("party already has two players queued")
+	ErrQueueCooldown        = errors.New("player is on a queue cooldown")
 	
 	// Request errors
 	ErrRequestTimeout    = errors.New("request timeout")
@@ -19,6 +24,11 @@ var (
 	ErrInvalidPlayerID   = errors.New("invalid player ID")
 	ErrInvalidUsername   = errors.New("invalid username")
 	
+	// Private room errors
+	ErrRoomNotFound        = errors.New("private room not found")
+	ErrPlayerAlreadyInRoom = errors.New("player already has a private room")
+	ErrRoomCodeExhausted   = errors.New("could not allocate a private room code")
+
 	// Match errors
 	ErrMatchCreationFailed = errors.New("failed to create match")
 	ErrBotCreationFailed   = errors.New("failed to create bot")
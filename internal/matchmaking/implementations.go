@@ -5,31 +5,198 @@ import (
 	"log"
 	"time"
 
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/models"
+
 	"github.com/google/uuid"
 )
 
-// DefaultGameCreator implements GameCreator interface
-type DefaultGameCreator struct{}
+// GameManagerCreator implements GameCreator on top of the in-memory game manager
+type GameManagerCreator struct {
+	gameManager *game.Manager
+}
+
+// NewGameManagerCreator creates a game creator backed by the given game manager
+func NewGameManagerCreator(gameManager *game.Manager) *GameManagerCreator {
+	return &GameManagerCreator{
+		gameManager: gameManager,
+	}
+}
 
-// CreateGame creates a new game between two players
-func (gc *DefaultGameCreator) CreateGame(player1, player2 *Player) (*Match, error) {
+// CreateGame creates a new game between two players and notifies them
+func (gc *GameManagerCreator) CreateGame(player1, player2 *Player, queueType models.QueueType) (*Match, error) {
 	if player1 == nil || player2 == nil {
 		return nil, ErrInvalidRequest
 	}
-	
-	gameID := uuid.New()
-	
+
+	gamePlayer1 := gc.toGamePlayer(player1)
+	gamePlayer2 := gc.toGamePlayer(player2)
+
+	gameInstance := gc.gameManager.CreateGame(gamePlayer1, gamePlayer2, queueType)
+	if gameInstance == nil {
+		return nil, ErrGameCreationFailed
+	}
+
+	gc.notifyPlayers(gameInstance, player1, player2)
+
+	// Start bot AI routine for bot opponents
+	for _, player := range []*Player{player1, player2} {
+		if player.IsBot {
+			go gc.runBotAI(gameInstance.ID, player.ID)
+		}
+	}
+
 	match := &Match{
-		GameID:    gameID,
+		GameID:    gameInstance.ID,
 		Player1:   player1,
 		Player2:   player2,
+		QueueType: queueType,
 		CreatedAt: time.Now(),
-		IsBot:     player2.IsBot,
+		IsBot:     player1.IsBot || player2.IsBot,
 	}
-	
+
+	return match, nil
+}
+
+// CreateTeamGame creates a 2v2 game between two teams and notifies all players
+func (gc *GameManagerCreator) CreateTeamGame(team1, team2 [2]*Player) (*Match, error) {
+	for _, player := range []*Player{team1[0], team1[1], team2[0], team2[1]} {
+		if player == nil {
+			return nil, ErrInvalidRequest
+		}
+	}
+
+	gameInstance := gc.gameManager.CreateTeamGame(
+		[2]*models.Player{gc.toGamePlayer(team1[0]), gc.toGamePlayer(team1[1])},
+		[2]*models.Player{gc.toGamePlayer(team2[0]), gc.toGamePlayer(team2[1])},
+	)
+	if gameInstance == nil {
+		return nil, ErrGameCreationFailed
+	}
+
+	gc.notifyPlayers(gameInstance, team1[0], team1[1], team2[0], team2[1])
+
+	match := &Match{
+		GameID:    gameInstance.ID,
+		Player1:   team1[0],
+		Player2:   team2[0],
+		Teammate1: team1[1],
+		Teammate2: team2[1],
+		QueueType: models.QueueTypeTeam,
+		CreatedAt: time.Now(),
+	}
+
 	return match, nil
 }
 
+// ResumeGame restarts the bots of a game restored after a server restart
+func (gc *GameManagerCreator) ResumeGame(gameInstance *models.Game) {
+	for _, player := range gameInstance.Players {
+		if player != nil && player.IsBot {
+			go gc.runBotAI(gameInstance.ID, player.ID)
+		}
+	}
+}
+
+// notifyPlayers registers the human players' connections and lets them know the game is ready
+func (gc *GameManagerCreator) notifyPlayers(gameInstance *models.Game, players ...*Player) {
+	for _, player := range players {
+		if player.IsBot || player.Conn == nil {
+			continue
+		}
+
+		gc.gameManager.AddPlayerConnection(player.ID, gameInstance.ID, player.Conn)
+		player.Conn.WriteJSON(models.WSMessage{
+			Type: models.MsgGameFound,
+			Payload: models.GameFoundPayload{
+				Game:     gameInstance,
+				PlayerID: player.ID,
+			},
+		})
+	}
+}
+
+// toGamePlayer converts a matched player into a game player
+func (gc *GameManagerCreator) toGamePlayer(player *Player) *models.Player {
+	return &models.Player{
+		ID:        player.ID,
+		Name:      player.Username,
+		IsBot:     player.IsBot,
+		Connected: true,
+		LastSeen:  time.Now(),
+	}
+}
+
+// runBotAI plays the bot's moves until the game is over
+func (gc *GameManagerCreator) runBotAI(gameID, botID uuid.UUID) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		gameInstance, exists := gc.gameManager.GetGame(gameID)
+		if !exists || gameInstance.State != models.GameStatePlaying {
+			return
+		}
+
+		// Check if it's bot's turn
+		var botColor models.PlayerColor
+		var isBot bool
+		for _, player := range gameInstance.Players {
+			if player.ID == botID {
+				botColor = player.Color
+				isBot = true
+				break
+			}
+		}
+
+		if !isBot || gameInstance.CurrentTurn != botColor {
+			continue
+		}
+
+		// Add small delay for realism
+		time.Sleep(500 * time.Millisecond)
+
+		// Get best move
+		decision := game.DecideMove(gameInstance, botColor, game.DefaultBotDifficulty)
+		if decision.Column == -1 {
+			continue
+		}
+
+		// Make the move
+		delta, err := gc.gameManager.PlayMove(gameID, botID, decision.Column)
+		if err != nil {
+			continue
+		}
+
+		// Broadcast what changed
+		gc.gameManager.BroadcastToGame(gameID, models.NewWSMessage(models.MsgGameDelta, delta))
+
+		// Share the bot's reasoning (including solver results in the endgame)
+		gc.gameManager.BroadcastToGame(gameID, models.NewWSMessage(models.MsgBotMove, models.BotMovePayload{
+			GameID:     gameID,
+			Move:       delta.Move,
+			Reasoning:  decision.Reasoning,
+			Confidence: decision.Confidence,
+		}))
+
+		// Check if game ended
+		if gameInstance.State == models.GameStateFinished {
+			gc.gameManager.BroadcastToGame(gameID, models.WSMessage{
+				Type: models.MsgGameEnd,
+				Payload: models.GameEndPayload{
+					GameID:    gameID,
+					GameState: gameInstance,
+					Winner:    nil, // Will need to convert from PlayerColor to Player
+					Reason:    "Game completed",
+					Duration:  0,     // Calculate if needed
+					IsDraw:    false, // Set based on game state
+				},
+			})
+			return
+		}
+	}
+}
+
 // DefaultBotProvider implements BotProvider interface
 type DefaultBotProvider struct {
 	botCounter int
@@ -56,16 +223,18 @@ func (bp *DefaultBotProvider) CreateBot() *Player {
 // DefaultEventPublisher implements EventPublisher interface
 type DefaultEventPublisher struct {
 	matchFoundHandlers    []func(*Match)
-	playerJoinedHandlers  []func(uuid.UUID, string)
-	playerLeftHandlers    []func(uuid.UUID, string)
+	playerJoinedHandlers  []func(QueueEvent)
+	playerLeftHandlers    []func(QueueEvent)
+	botActivatedHandlers  []func(*Match)
 }
 
 // NewDefaultEventPublisher creates a new default event publisher
 func NewDefaultEventPublisher() *DefaultEventPublisher {
 	return &DefaultEventPublisher{
 		matchFoundHandlers:   make([]func(*Match), 0),
-		playerJoinedHandlers: make([]func(uuid.UUID, string), 0),
-		playerLeftHandlers:   make([]func(uuid.UUID, string), 0),
+		playerJoinedHandlers: make([]func(QueueEvent), 0),
+		playerLeftHandlers:   make([]func(QueueEvent), 0),
+		botActivatedHandlers: make([]func(*Match), 0),
 	}
 }
 
@@ -82,22 +251,32 @@ func (ep *DefaultEventPublisher) PublishMatchFound(match *Match) error {
 }
 
 // PublishPlayerJoined publishes a player joined event
-func (ep *DefaultEventPublisher) PublishPlayerJoined(playerID uuid.UUID, username string) error {
-	log.Printf("Player joined queue: %s (%s)", username, playerID)
+func (ep *DefaultEventPublisher) PublishPlayerJoined(event QueueEvent) error {
+	log.Printf("Player joined %s queue: %s (%s)", event.QueueType, event.Username, event.PlayerID)
 	
 	for _, handler := range ep.playerJoinedHandlers {
-		go handler(playerID, username)
+		go handler(event)
 	}
 	
 	return nil
 }
 
 // PublishPlayerLeft publishes a player left event
-func (ep *DefaultEventPublisher) PublishPlayerLeft(playerID uuid.UUID, username string) error {
-	log.Printf("Player left queue: %s (%s)", username, playerID)
+func (ep *DefaultEventPublisher) PublishPlayerLeft(event QueueEvent) error {
+	log.Printf("Player left %s queue: %s (%s, %s after %v)", event.QueueType, event.Username, event.PlayerID,
+		event.Reason, event.WaitTime.Round(time.Second))
 	
 	for _, handler := range ep.playerLeftHandlers {
-		go handler(playerID, username)
+		go handler(event)
+	}
+	
+	return nil
+}
+
+// PublishBotActivated publishes a bot activated event
+func (ep *DefaultEventPublisher) PublishBotActivated(match *Match) error {
+	for _, handler := range ep.botActivatedHandlers {
+		go handler(match)
 	}
 	
 	return nil
@@ -109,11 +288,16 @@ func (ep *DefaultEventPublisher) OnMatchFound(handler func(*Match)) {
 }
 
 // OnPlayerJoined registers a handler for player joined events
-func (ep *DefaultEventPublisher) OnPlayerJoined(handler func(uuid.UUID, string)) {
+func (ep *DefaultEventPublisher) OnPlayerJoined(handler func(QueueEvent)) {
 	ep.playerJoinedHandlers = append(ep.playerJoinedHandlers, handler)
 }
 
 // OnPlayerLeft registers a handler for player left events
-func (ep *DefaultEventPublisher) OnPlayerLeft(handler func(uuid.UUID, string)) {
+func (ep *DefaultEventPublisher) OnPlayerLeft(handler func(QueueEvent)) {
 	ep.playerLeftHandlers = append(ep.playerLeftHandlers, handler)
+}
+
+// OnBotActivated registers a handler for bot activated events
+func (ep *DefaultEventPublisher) OnBotActivated(handler func(*Match)) {
+	ep.botActivatedHandlers = append(ep.botActivatedHandlers, handler)
 }
\ No newline at end of file
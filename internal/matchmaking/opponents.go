@@ -0,0 +1,85 @@
+package matchmaking
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentOpponents remembers who each player was recently matched against so
+// the same pairing isn't repeated over and over
+type recentOpponents struct {
+	limit  int
+	window time.Duration
+
+	// Most recent last, keyed by lowercased username
+	opponents map[string][]recentOpponent
+	mutex     sync.Mutex
+}
+
+type recentOpponent struct {
+	username  string
+	matchedAt time.Time
+}
+
+func newRecentOpponents(limit int, window time.Duration) *recentOpponents {
+	return &recentOpponents{
+		limit:     limit,
+		window:    window,
+		opponents: make(map[string][]recentOpponent),
+	}
+}
+
+// record remembers that the two players were matched
+func (r *recentOpponents) record(username1, username2 string) {
+	if r.limit <= 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.add(username1, username2, now)
+	r.add(username2, username1, now)
+}
+
+// add appends an opponent, dropping the oldest beyond the limit; callers must hold the mutex
+func (r *recentOpponents) add(username, opponent string, now time.Time) {
+	key := strings.ToLower(username)
+	history := append(r.opponents[key], recentOpponent{username: strings.ToLower(opponent), matchedAt: now})
+	if len(history) > r.limit {
+		history = history[len(history)-r.limit:]
+	}
+	r.opponents[key] = history
+}
+
+// played reports whether the players met within the window
+func (r *recentOpponents) played(username1, username2 string) bool {
+	if r.limit <= 0 {
+		return false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	opponent := strings.ToLower(username2)
+	for _, recent := range r.opponents[strings.ToLower(username1)] {
+		if recent.username == opponent && time.Since(recent.matchedAt) < r.window {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanup forgets histories that are entirely outside the window
+func (r *recentOpponents) cleanup() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for key, history := range r.opponents {
+		if len(history) == 0 || time.Since(history[len(history)-1].matchedAt) >= r.window {
+			delete(r.opponents, key)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package matchmaking
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// PenaltyStore persists queue penalties so cooldowns survive restarts
+type PenaltyStore interface {
+	// GetQueuePenalty returns nil without an error for players with no offenses
+	GetQueuePenalty(playerName string) (*models.QueuePenalty, error)
+	SaveQueuePenalty(penalty *models.QueuePenalty) error
+}
+
+// DefaultPenaltyCooldowns escalates from 1 minute to 5 minutes to 30 minutes
+func DefaultPenaltyCooldowns() []time.Duration {
+	return []time.Duration{1 * time.Minute, 5 * time.Minute, 30 * time.Minute}
+}
+
+// SetPenaltyStore sets where queue penalties are persisted. Without a store
+// penalties are kept in memory only.
+func (s *MatchmakingService) SetPenaltyStore(store PenaltyStore) {
+	s.penaltiesMutex.Lock()
+	defer s.penaltiesMutex.Unlock()
+	s.penaltyStore = store
+}
+
+// RecordAbandon registers a game the player disconnected from or abandoned and
+// applies the next cooldown. Offenses are forgiven after PenaltyResetAfter
+// without a new one.
+func (s *MatchmakingService) RecordAbandon(playerName string) (*models.QueuePenalty, error) {
+	if len(s.config.PenaltyCooldowns) == 0 {
+		return nil, nil
+	}
+
+	s.penaltiesMutex.Lock()
+	defer s.penaltiesMutex.Unlock()
+
+	current, err := s.loadPenalty(playerName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next := *current
+	if !next.LastOffenseAt.IsZero() && now.Sub(next.LastOffenseAt) > s.config.PenaltyResetAfter {
+		next.Offenses = 0
+	}
+	next.Offenses++
+	next.LastOffenseAt = now
+
+	step := next.Offenses - 1
+	if step >= len(s.config.PenaltyCooldowns) {
+		step = len(s.config.PenaltyCooldowns) - 1
+	}
+	next.BannedUntil = now.Add(s.config.PenaltyCooldowns[step])
+
+	if s.penaltyStore != nil {
+		if err := s.penaltyStore.SaveQueuePenalty(&next); err != nil {
+			return nil, fmt.Errorf("failed to save queue penalty for %s: %w", playerName, err)
+		}
+	}
+	s.penalties[playerName] = &next
+
+	log.Printf("Player %s abandoned a game (offense %d), queue cooldown until %s",
+		playerName, next.Offenses, next.BannedUntil.Format(time.RFC3339))
+
+	copied := next
+	return &copied, nil
+}
+
+// GetCooldown returns how long the player still has to wait before queueing again
+func (s *MatchmakingService) GetCooldown(playerName string) time.Duration {
+	s.penaltiesMutex.Lock()
+	defer s.penaltiesMutex.Unlock()
+
+	penalty, err := s.loadPenalty(playerName)
+	if err != nil {
+		// Don't lock players out because the store is unavailable
+		log.Printf("Failed to load queue penalty for %s: %v", playerName, err)
+		return 0
+	}
+
+	remaining := time.Until(penalty.BannedUntil)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// loadPenalty returns the cached penalty of a player, callers must hold penaltiesMutex
+func (s *MatchmakingService) loadPenalty(playerName string) (*models.QueuePenalty, error) {
+	if penalty, exists := s.penalties[playerName]; exists {
+		return penalty, nil
+	}
+
+	var penalty *models.QueuePenalty
+	if s.penaltyStore != nil {
+		stored, err := s.penaltyStore.GetQueuePenalty(playerName)
+		if err != nil {
+			return nil, err
+		}
+		penalty = stored
+	}
+
+	if penalty == nil {
+		penalty = &models.QueuePenalty{PlayerName: playerName}
+	}
+
+	s.penalties[playerName] = penalty
+	return penalty, nil
+}
@@ -0,0 +1,168 @@
+package matchmaking
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/logging"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// QueueStore persists the queue while the server restarts
+type QueueStore interface {
+	SaveQueueSnapshot(players []*models.QueuedPlayer) error
+	// LoadQueueSnapshot returns the saved queue and clears it
+	LoadQueueSnapshot() ([]*models.QueuedPlayer, error)
+}
+
+// SetQueueStore sets where the queue is saved on Stop and restored from on Start
+func (s *MatchmakingService) SetQueueStore(store QueueStore) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queueStore = store
+}
+
+// saveQueue writes every queued player to the store, callers must hold s.mutex
+func (s *MatchmakingService) saveQueue() error {
+	if s.queueStore == nil {
+		return nil
+	}
+
+	entries := s.queue.GetAllEntries()
+	players := make([]*models.QueuedPlayer, 0, len(entries))
+	for _, entry := range entries {
+		s.stopBotTimer(entry)
+		players = append(players, &models.QueuedPlayer{
+			PlayerID:    entry.PlayerID,
+			PlayerName:  entry.Username,
+			JoinedAt:    entry.JoinedAt,
+			QueueType:   entry.Preferences.QueueType,
+			PartyID:     entry.Preferences.PartyID,
+			AllowBots:   entry.Preferences.AllowBots,
+			SkillLevel:  entry.Preferences.SkillLevel,
+			MaxWaitTime: entry.Preferences.MaxWaitTime,
+			Rating:      entry.Rating,
+			Priority:    int(entry.Priority),
+		})
+	}
+
+	if err := s.queueStore.SaveQueueSnapshot(players); err != nil {
+		return fmt.Errorf("failed to save queue: %w", err)
+	}
+
+	log.Printf("Saved %d queued players", len(players))
+	return nil
+}
+
+// restoreQueue puts the players saved before a restart back in the queue,
+// callers must hold s.mutex. Restored players keep their join time but stay
+// detached until their client reconnects.
+func (s *MatchmakingService) restoreQueue() error {
+	if s.queueStore == nil {
+		return nil
+	}
+
+	players, err := s.queueStore.LoadQueueSnapshot()
+	if err != nil {
+		return fmt.Errorf("failed to restore queue: %w", err)
+	}
+
+	now := time.Now()
+	for _, player := range players {
+		s.queue.restore(&QueueEntry{
+			PlayerID: player.PlayerID,
+			Username: player.PlayerName,
+			JoinedAt: player.JoinedAt,
+			Preferences: &MatchPreferences{
+				QueueType:   player.QueueType,
+				PartyID:     player.PartyID,
+				AllowBots:   player.AllowBots,
+				SkillLevel:  player.SkillLevel,
+				MaxWaitTime: player.MaxWaitTime,
+			},
+			Rating:     player.Rating,
+			RestoredAt: now,
+		}, QueuePriority(player.Priority))
+	}
+
+	if len(players) > 0 {
+		log.Printf("Restored %d queued players", len(players))
+	}
+	return nil
+}
+
+// ReattachQueueEntry reconnects a restored queue entry to the player's new
+// connection and returns their queue status
+func (s *MatchmakingService) ReattachQueueEntry(playerID uuid.UUID, conn game.WSConnection) (*QueueStatus, error) {
+	if !s.isRunning() {
+		return nil, ErrServiceNotRunning
+	}
+
+	request := &ReattachRequest{
+		PlayerID:   playerID,
+		Conn:       conn,
+		ResponseCh: make(chan *ReattachResponse, 1),
+	}
+
+	select {
+	case s.reattachRequests <- request:
+		select {
+		case response := <-request.ResponseCh:
+			return response.Status, response.err
+		case <-s.ctx.Done():
+			return nil, ErrServiceShuttingDown
+		case <-time.After(5 * time.Second):
+			return nil, ErrRequestTimeout
+		}
+	case <-s.ctx.Done():
+		return nil, ErrServiceShuttingDown
+	}
+}
+
+// handleReattachRequest processes a reattach request
+func (s *MatchmakingService) handleReattachRequest(request *ReattachRequest) {
+	entry, exists := s.queue.GetEntry(request.PlayerID)
+	if !exists {
+		request.ResponseCh <- &ReattachResponse{err: ErrPlayerNotInQueue}
+		return
+	}
+
+	if !s.reattach(entry, request.Conn) {
+		request.ResponseCh <- &ReattachResponse{err: ErrPlayerAlreadyInQueue}
+		return
+	}
+	request.ResponseCh <- &ReattachResponse{Status: s.queueStatus(entry)}
+}
+
+// reattach connects a detached entry and starts its bot timer. It reports
+// false if the entry was already connected.
+func (s *MatchmakingService) reattach(entry *QueueEntry, conn game.WSConnection) bool {
+	if !s.queue.attach(entry.PlayerID, conn) {
+		return false
+	}
+
+	s.startBotTimer(entry)
+
+	logging.Infof("Player %s (%s) reconnected to the matchmaking queue", entry.Username, entry.PlayerID)
+	return true
+}
+
+// expireDetachedEntries drops restored players whose client never came back
+func (s *MatchmakingService) expireDetachedEntries() {
+	for _, entry := range s.queue.GetAllEntries() {
+		if !s.queue.isDetached(entry) || time.Since(entry.RestoredAt) < s.config.RestoredEntryTTL {
+			continue
+		}
+
+		if s.queue.Remove(entry.PlayerID) {
+			log.Printf("Dropped restored queue entry for %s, client did not reconnect", entry.Username)
+			if s.eventPublisher != nil {
+				s.eventPublisher.PublishPlayerLeft(s.leftEvent(entry, QueueLeftExpired))
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package matchmaking
+
+import (
+	"crypto/rand"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// privateRoomCodeLength is the number of characters in an invite code
+	privateRoomCodeLength = 6
+
+	// privateRoomCodeAlphabet leaves out characters that are easy to confuse (0/O, 1/I/L)
+	privateRoomCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+)
+
+// PrivateRoom is a pending private game waiting for the invited friend
+type PrivateRoom struct {
+	Code      string            `json:"code"`
+	HostID    uuid.UUID         `json:"host_id"`
+	HostName  string            `json:"host_name"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	HostConn  game.WSConnection `json:"-"`
+}
+
+// CreatePrivateRoom opens a private room for the host and returns its invite code.
+// Private games bypass the queue entirely.
+func (s *MatchmakingService) CreatePrivateRoom(playerID uuid.UUID, username string, conn game.WSConnection) (*PrivateRoom, error) {
+	if !s.isRunning() {
+		return nil, ErrServiceNotRunning
+	}
+	if s.isDraining() {
+		return nil, ErrServiceDraining
+	}
+
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	for _, room := range s.rooms {
+		if room.HostID == playerID {
+			return nil, ErrPlayerAlreadyInRoom
+		}
+	}
+
+	code, err := s.generateRoomCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	room := &PrivateRoom{
+		Code:      code,
+		HostID:    playerID,
+		HostName:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.PrivateRoomTTL),
+		HostConn:  conn,
+	}
+	s.rooms[code] = room
+
+	log.Printf("Player %s (%s) created private room %s", username, playerID, code)
+	return room, nil
+}
+
+// JoinPrivateRoom starts a private game between the room host and the joining player
+func (s *MatchmakingService) JoinPrivateRoom(code string, playerID uuid.UUID, username string, conn game.WSConnection) (*Match, error) {
+	if !s.isRunning() {
+		return nil, ErrServiceNotRunning
+	}
+	if s.isDraining() {
+		return nil, ErrServiceDraining
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	s.roomsMutex.Lock()
+	room, exists := s.rooms[code]
+	if !exists || time.Now().After(room.ExpiresAt) {
+		s.roomsMutex.Unlock()
+		return nil, ErrRoomNotFound
+	}
+	if room.HostID == playerID {
+		s.roomsMutex.Unlock()
+		return nil, ErrInvalidRequest
+	}
+	delete(s.rooms, code)
+	s.roomsMutex.Unlock()
+
+	host := &Player{
+		ID:       room.HostID,
+		Username: room.HostName,
+		Conn:     room.HostConn,
+	}
+
+	guest := &Player{
+		ID:       playerID,
+		Username: username,
+		Conn:     conn,
+	}
+
+	match, err := s.gameCreator.CreateGame(host, guest, models.QueueTypePrivate)
+	if err != nil {
+		log.Printf("Failed to create private game for room %s: %v", code, err)
+		return nil, ErrGameCreationFailed
+	}
+
+	// Publish match found event
+	if s.eventPublisher != nil {
+		s.eventPublisher.PublishMatchFound(match)
+	}
+
+	log.Printf("Private match created: %s vs %s (Room: %s, Game ID: %s)", host.Username, guest.Username, code, match.GameID)
+	return match, nil
+}
+
+// CancelPrivateRoom closes any private room hosted by the player
+func (s *MatchmakingService) CancelPrivateRoom(playerID uuid.UUID) bool {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	for code, room := range s.rooms {
+		if room.HostID == playerID {
+			delete(s.rooms, code)
+			return true
+		}
+	}
+	return false
+}
+
+// expirePrivateRooms drops rooms nobody joined in time
+func (s *MatchmakingService) expirePrivateRooms() {
+	s.roomsMutex.Lock()
+	defer s.roomsMutex.Unlock()
+
+	now := time.Now()
+	for code, room := range s.rooms {
+		if now.After(room.ExpiresAt) {
+			delete(s.rooms, code)
+			log.Printf("Private room %s hosted by %s expired", code, room.HostName)
+		}
+	}
+}
+
+// generateRoomCode returns an unused invite code; callers must hold roomsMutex
+func (s *MatchmakingService) generateRoomCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(privateRoomCodeAlphabet)))
+
+	for attempt := 0; attempt < 10; attempt++ {
+		var code strings.Builder
+		for i := 0; i < privateRoomCodeLength; i++ {
+			n, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return "", err
+			}
+			code.WriteByte(privateRoomCodeAlphabet[n.Int64()])
+		}
+
+		if _, taken := s.rooms[code.String()]; !taken {
+			return code.String(), nil
+		}
+	}
+
+	return "", ErrRoomCodeExhausted
+}
@@ -1,45 +1,93 @@
 package matchmaking
 
 import (
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"connect-four-backend/internal/game"
 	"connect-four-backend/internal/models"
+
 	"github.com/google/uuid"
 )
 
+// QueuePriority orders queue entries, higher priorities are matched first
+type QueuePriority int
+
+const (
+	PriorityNormal     QueuePriority = iota
+	PriorityRematch                  // players asking for a rematch
+	PriorityRecovery                 // players whose game failed to start because of a server error
+	PriorityTournament               // scheduled tournament games
+)
+
 // QueueEntry represents a player waiting in the matchmaking queue
 type QueueEntry struct {
-	PlayerID    uuid.UUID `json:"player_id"`
-	Username    string    `json:"username"`
-	JoinedAt    time.Time `json:"joined_at"`
-	BotTimer    *time.Timer `json:"-"`
+	PlayerID    uuid.UUID         `json:"player_id"`
+	Username    string            `json:"username"`
+	JoinedAt    time.Time         `json:"joined_at"`
+	BotTimer    *time.Timer       `json:"-"`
 	Preferences *MatchPreferences `json:"preferences,omitempty"`
-	
-	// Additional fields for compatibility with matchmaker
-	Player      *models.Player `json:"-"`
-	Conn        game.WSConnection `json:"-"`
+	Rating      int               `json:"rating,omitempty"` // 0 when no rating is known
+	Priority    QueuePriority     `json:"priority"`
+
+	// Connection used to notify the player once a match is found. Entries
+	// restored after a restart have none until the client reconnects.
+	Conn       game.WSConnection `json:"-"`
+	RestoredAt time.Time         `json:"-"`
 }
 
 // MatchPreferences holds player preferences for matchmaking
 type MatchPreferences struct {
-	AllowBots     bool `json:"allow_bots"`
-	SkillLevel    int  `json:"skill_level"`    // 1-10 scale
-	MaxWaitTime   int  `json:"max_wait_time"`  // seconds
+	QueueType   models.QueueType `json:"queue_type"`
+	PartyID     string           `json:"party_id,omitempty"` // team queue only, shared by both party members
+	AllowBots   bool             `json:"allow_bots"`         // ignored for ranked and team games
+	SkillLevel  int              `json:"skill_level"`        // 1-10 scale
+	MaxWaitTime int              `json:"max_wait_time"`      // seconds
+}
+
+// DefaultMatchPreferences returns the preferences used when a client sends none
+func DefaultMatchPreferences() *MatchPreferences {
+	return &MatchPreferences{
+		QueueType:   models.QueueTypeCasual,
+		AllowBots:   true,
+		SkillLevel:  5,
+		MaxWaitTime: 10,
+	}
 }
 
 // Queue manages the matchmaking queue with thread-safe operations
 type Queue struct {
 	entries map[uuid.UUID]*QueueEntry
 	mutex   sync.RWMutex
-	
-	// Channels for queue operations
-	addChan    chan *QueueEntry
-	removeChan chan uuid.UUID
-	
+
+	// Acceptable rating gap, widened the longer players wait
+	ratingRange RatingRange
+
 	// Queue statistics
-	stats QueueStats
+	stats      QueueStats
+	statsMutex sync.RWMutex
+}
+
+// RatingRange describes how the acceptable rating gap widens with wait time
+type RatingRange struct {
+	Initial  int           `json:"initial"` // gap accepted right after joining
+	Step     int           `json:"step"`    // added every Interval in the queue
+	Interval time.Duration `json:"interval"`
+	Max      int           `json:"max"` // the range never widens past this
+}
+
+// At returns the acceptable rating gap after waiting for the given duration
+func (r RatingRange) At(waited time.Duration) int {
+	gap := r.Initial
+	if r.Interval > 0 {
+		gap += r.Step * int(waited/r.Interval)
+	}
+	if r.Max > 0 && gap > r.Max {
+		gap = r.Max
+	}
+	return gap
 }
 
 // QueueStats holds queue statistics
@@ -50,26 +98,20 @@ type QueueStats struct {
 	TotalBotMatches int64         `json:"total_bot_matches"`
 	CurrentSize     int           `json:"current_size"`
 	AverageWaitTime time.Duration `json:"average_wait_time"`
-	mutex           sync.RWMutex
 }
 
 // NewQueue creates a new matchmaking queue
-func NewQueue() *Queue {
+func NewQueue(ratingRange RatingRange) *Queue {
 	return &Queue{
-		entries:    make(map[uuid.UUID]*QueueEntry),
-		addChan:    make(chan *QueueEntry, 100),
-		removeChan: make(chan uuid.UUID, 100),
+		entries:     make(map[uuid.UUID]*QueueEntry),
+		ratingRange: ratingRange,
 	}
 }
 
 // Add adds a player to the queue
-func (q *Queue) Add(playerID uuid.UUID, username string, preferences *MatchPreferences) *QueueEntry {
+func (q *Queue) Add(playerID uuid.UUID, username string, rating int, priority QueuePriority, conn game.WSConnection, preferences *MatchPreferences) *QueueEntry {
 	if preferences == nil {
-		preferences = &MatchPreferences{
-			AllowBots:   true,
-			SkillLevel:  5,
-			MaxWaitTime: 10,
-		}
+		preferences = DefaultMatchPreferences()
 	}
 
 	entry := &QueueEntry{
@@ -77,15 +119,40 @@ func (q *Queue) Add(playerID uuid.UUID, username string, preferences *MatchPrefe
 		Username:    username,
 		JoinedAt:    time.Now(),
 		Preferences: preferences,
+		Rating:      rating,
+		Priority:    priority,
+		Conn:        conn,
 	}
 
-	q.addChan <- entry
+	q.mutex.Lock()
+	q.entries[playerID] = entry
+	q.mutex.Unlock()
+
+	// Update statistics
+	q.statsMutex.Lock()
+	q.stats.TotalJoined++
+	q.statsMutex.Unlock()
+
 	return entry
 }
 
-// Remove removes a player from the queue
+// Remove removes a player who left the queue
 func (q *Queue) Remove(playerID uuid.UUID) bool {
-	q.removeChan <- playerID
+	entry, removed := q.take(playerID)
+	if !removed {
+		return false
+	}
+
+	// Cancel bot timer if it exists
+	if entry.BotTimer != nil {
+		entry.BotTimer.Stop()
+	}
+
+	// Update statistics
+	q.statsMutex.Lock()
+	q.stats.TotalLeft++
+	q.statsMutex.Unlock()
+
 	return true
 }
 
@@ -93,11 +160,41 @@ func (q *Queue) Remove(playerID uuid.UUID) bool {
 func (q *Queue) GetEntry(playerID uuid.UUID) (*QueueEntry, bool) {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
-	
+
 	entry, exists := q.entries[playerID]
 	return entry, exists
 }
 
+// GetEntryByConn gets the queue entry registered for a connection
+func (q *Queue) GetEntryByConn(conn game.WSConnection) (*QueueEntry, bool) {
+	if conn == nil {
+		return nil, false
+	}
+
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, entry := range q.entries {
+		if entry.Conn == conn {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// GetEntryByUsername gets a queue entry by username, ignoring case
+func (q *Queue) GetEntryByUsername(username string) (*QueueEntry, bool) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	for _, entry := range q.entries {
+		if strings.EqualFold(entry.Username, username) {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
 // GetSize returns the current queue size
 func (q *Queue) GetSize() int {
 	q.mutex.RLock()
@@ -119,24 +216,46 @@ func (q *Queue) GetOldestEntry() *QueueEntry {
 	return oldest
 }
 
-// GetCompatibleMatch finds a compatible match for the given entry
-func (q *Queue) GetCompatibleMatch(entry *QueueEntry) *QueueEntry {
+// GetCompatibleMatch finds a compatible match for the given entry, preferring
+// the highest priority and then the closest rated opponent. Candidates for
+// which skip returns true are passed over.
+func (q *Queue) GetCompatibleMatch(entry *QueueEntry, skip func(candidate *QueueEntry) bool) *QueueEntry {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
 
+	now := time.Now()
+	var best *QueueEntry
 	for _, candidate := range q.entries {
-		if candidate.PlayerID == entry.PlayerID {
+		if candidate.PlayerID == entry.PlayerID || candidate.Conn == nil {
 			continue
 		}
 
-		if q.areCompatible(entry, candidate) {
-			return candidate
+		if !q.areCompatible(entry, candidate, now) {
+			continue
+		}
+
+		if skip != nil && skip(candidate) {
+			continue
+		}
+
+		if best == nil || candidate.Priority > best.Priority {
+			best = candidate
+			continue
+		}
+		if candidate.Priority == best.Priority && abs(entry.Rating-candidate.Rating) < abs(entry.Rating-best.Rating) {
+			best = candidate
 		}
 	}
-	return nil
+	return best
+}
+
+// RatingRangeFor returns the rating gap the entry currently accepts
+func (q *Queue) RatingRangeFor(entry *QueueEntry) int {
+	return q.ratingRange.At(time.Since(entry.JoinedAt))
 }
 
-// GetAllEntries returns all queue entries (for debugging/monitoring)
+// GetAllEntries returns all queue entries in matching order: highest priority
+// first, then longest waiting
 func (q *Queue) GetAllEntries() []*QueueEntry {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -145,59 +264,180 @@ func (q *Queue) GetAllEntries() []*QueueEntry {
 	for _, entry := range q.entries {
 		entries = append(entries, entry)
 	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ahead(entries[j])
+	})
 	return entries
 }
 
+// GetPosition returns the 1-based position of the entry among players in the
+// same queue type, in matching order
+func (q *Queue) GetPosition(entry *QueueEntry) int {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	position := 1
+	for _, e := range q.entries {
+		if e.Preferences.QueueType == entry.Preferences.QueueType && e.ahead(entry) {
+			position++
+		}
+	}
+	return position
+}
+
 // GetStats returns queue statistics
 func (q *Queue) GetStats() QueueStats {
-	q.stats.mutex.RLock()
-	defer q.stats.mutex.RUnlock()
-	
+	q.statsMutex.RLock()
+	stats := q.stats
+	q.statsMutex.RUnlock()
+
+	stats.CurrentSize = q.GetSize()
+	return stats
+}
+
+// CountQueueType returns the number of players waiting in the given queue type
+func (q *Queue) CountQueueType(queueType models.QueueType) int {
 	q.mutex.RLock()
-	q.stats.CurrentSize = len(q.entries)
-	q.mutex.RUnlock()
-	
-	return q.stats
+	defer q.mutex.RUnlock()
+
+	count := 0
+	for _, entry := range q.entries {
+		if entry.Preferences.QueueType == queueType {
+			count++
+		}
+	}
+	return count
 }
 
-// processAdd handles adding entries to the queue
-func (q *Queue) processAdd(entry *QueueEntry) {
+// GetPartySize returns the number of queued players sharing a party ID
+func (q *Queue) GetPartySize(partyID string) int {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	size := 0
+	for _, entry := range q.entries {
+		if entry.Preferences.PartyID == partyID {
+			size++
+		}
+	}
+	return size
+}
+
+// takePair atomically removes two entries for a match. It fails without
+// touching the queue if either player already left or was matched.
+func (q *Queue) takePair(player1ID, player2ID uuid.UUID) (*QueueEntry, *QueueEntry, bool) {
+	entries, ok := q.takeEntries(player1ID, player2ID)
+	if !ok {
+		return nil, nil, false
+	}
+	return entries[0], entries[1], true
+}
+
+// takeEntries atomically removes all given entries, or none of them if any
+// player already left or was matched
+func (q *Queue) takeEntries(playerIDs ...uuid.UUID) ([]*QueueEntry, bool) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	q.entries[entry.PlayerID] = entry
-	
-	// Update statistics
-	q.stats.mutex.Lock()
-	q.stats.TotalJoined++
-	q.stats.mutex.Unlock()
+	entries := make([]*QueueEntry, 0, len(playerIDs))
+	for _, playerID := range playerIDs {
+		entry, exists := q.entries[playerID]
+		if !exists {
+			return nil, false
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, playerID := range playerIDs {
+		delete(q.entries, playerID)
+	}
+	return entries, true
 }
 
-// processRemove handles removing entries from the queue
-func (q *Queue) processRemove(playerID uuid.UUID) {
+// take removes an entry from the queue and returns it
+func (q *Queue) take(playerID uuid.UUID) (*QueueEntry, bool) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	if entry, exists := q.entries[playerID]; exists {
-		// Cancel bot timer if it exists
-		if entry.BotTimer != nil {
-			entry.BotTimer.Stop()
-		}
-		
+	entry, exists := q.entries[playerID]
+	if exists {
 		delete(q.entries, playerID)
-		
-		// Update statistics
-		q.stats.mutex.Lock()
-		q.stats.TotalLeft++
-		q.stats.mutex.Unlock()
 	}
+	return entry, exists
+}
+
+// restore puts a previously taken entry back, keeping its original join time.
+// The entry is raised to at least the given priority.
+func (q *Queue) restore(entry *QueueEntry, priority QueuePriority) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if priority > entry.Priority {
+		entry.Priority = priority
+	}
+	q.entries[entry.PlayerID] = entry
+}
+
+// attach sets the connection of a detached entry, reporting false if the
+// entry is gone or already connected
+func (q *Queue) attach(playerID uuid.UUID, conn game.WSConnection) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	entry, exists := q.entries[playerID]
+	if !exists || entry.Conn != nil {
+		return false
+	}
+	entry.Conn = conn
+	return true
+}
+
+// isDetached reports whether the entry is still waiting for its client to reconnect
+func (q *Queue) isDetached(entry *QueueEntry) bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return entry.Conn == nil
+}
+
+// ahead reports whether the entry is matched before the other one
+func (e *QueueEntry) ahead(other *QueueEntry) bool {
+	if e.Priority != other.Priority {
+		return e.Priority > other.Priority
+	}
+	if !e.JoinedAt.Equal(other.JoinedAt) {
+		return e.JoinedAt.Before(other.JoinedAt)
+	}
+	// Break ties deterministically so the order is stable between passes
+	return e.PlayerID.String() < other.PlayerID.String()
 }
 
 // areCompatible checks if two players are compatible for matching
-func (q *Queue) areCompatible(player1, player2 *QueueEntry) bool {
-	// Basic compatibility check - can be extended with more sophisticated logic
+func (q *Queue) areCompatible(player1, player2 *QueueEntry, now time.Time) bool {
+	// Ranked and casual players are never mixed
+	if player1.Preferences.QueueType != player2.Preferences.QueueType {
+		return false
+	}
+
+	// Team players are matched four at a time, never one against one
+	if player1.Preferences.QueueType == models.QueueTypeTeam {
+		return false
+	}
+
+	// Casual games accept any opponent
+	if player1.Preferences.QueueType != models.QueueTypeRanked {
+		return true
+	}
+
+	// Prefer real ratings, fall back to self-reported skill for unrated players.
+	// Both players have to accept the gap at their current wait time.
+	if player1.Rating > 0 && player2.Rating > 0 {
+		gap := abs(player1.Rating - player2.Rating)
+		return gap <= q.ratingRange.At(now.Sub(player1.JoinedAt)) &&
+			gap <= q.ratingRange.At(now.Sub(player2.JoinedAt))
+	}
+
 	skillDiff := abs(player1.Preferences.SkillLevel - player2.Preferences.SkillLevel)
-	
+
 	// Allow skill difference of up to 2 levels
 	if skillDiff > 2 {
 		return false
@@ -209,8 +449,8 @@ func (q *Queue) areCompatible(player1, player2 *QueueEntry) bool {
 
 // updateAverageWaitTime updates the average wait time statistic
 func (q *Queue) updateAverageWaitTime(waitTime time.Duration) {
-	q.stats.mutex.Lock()
-	defer q.stats.mutex.Unlock()
+	q.statsMutex.Lock()
+	defer q.statsMutex.Unlock()
 
 	// Simple moving average calculation
 	if q.stats.AverageWaitTime == 0 {
@@ -222,16 +462,16 @@ func (q *Queue) updateAverageWaitTime(waitTime time.Duration) {
 
 // incrementMatched increments the matched counter
 func (q *Queue) incrementMatched() {
-	q.stats.mutex.Lock()
+	q.statsMutex.Lock()
 	q.stats.TotalMatched++
-	q.stats.mutex.Unlock()
+	q.statsMutex.Unlock()
 }
 
 // incrementBotMatches increments the bot match counter
 func (q *Queue) incrementBotMatches() {
-	q.stats.mutex.Lock()
+	q.statsMutex.Lock()
 	q.stats.TotalBotMatches++
-	q.stats.mutex.Unlock()
+	q.statsMutex.Unlock()
 }
 
 // Helper function
@@ -240,4 +480,4 @@ func abs(x int) int {
 		return -x
 	}
 	return x
-}
\ No newline at end of file
+}
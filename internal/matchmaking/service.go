@@ -3,9 +3,14 @@ package matchmaking
 import (
 	"context"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/logging"
+	"connect-four-backend/internal/models"
+
 	"github.com/google/uuid"
 )
 
@@ -15,13 +20,30 @@ type MatchmakingService struct {
 	gameCreator     GameCreator
 	botProvider     BotProvider
 	eventPublisher  EventPublisher
+	ratingProvider  RatingProvider
+	queueStore      QueueStore
+	recentOpponents *recentOpponents
+
+	// Private rooms keyed by invite code
+	rooms      map[string]*PrivateRoom
+	roomsMutex sync.Mutex
+
+	// Queue penalties for players who abandon games, keyed by player name
+	penalties      map[string]*models.QueuePenalty
+	penaltyStore   PenaltyStore
+	penaltiesMutex sync.Mutex
 	
-	// Configuration
-	config MatchmakingConfig
+	// Configuration. The bot timeouts can change at runtime and are read
+	// under timeoutMutex, the queue restore holds s.mutex while reading them.
+	config       MatchmakingConfig
+	timeoutMutex sync.RWMutex
 	
-	// Channels for service operations
-	joinRequests  chan *JoinRequest
-	leaveRequests chan *LeaveRequest
+	// Channels for service operations. The queue is owned by the event loop,
+	// everything that changes it is sent there so players are matched at most once.
+	joinRequests     chan *JoinRequest
+	leaveRequests    chan *LeaveRequest
+	reattachRequests chan *ReattachRequest
+	botTimeouts      chan *QueueEntry
 	
 	// Context for graceful shutdown
 	ctx    context.Context
@@ -30,17 +52,36 @@ type MatchmakingService struct {
 	// Wait group for goroutines
 	wg sync.WaitGroup
 	
-	// Service state
-	running bool
-	mutex   sync.RWMutex
+	// Service state. A draining service keeps its queue but takes no joins
+	// and makes no matches.
+	running  bool
+	draining bool
+	mutex    sync.RWMutex
 }
 
 // MatchmakingConfig holds configuration for the matchmaking service
 type MatchmakingConfig struct {
-	BotMatchTimeout    time.Duration `json:"bot_match_timeout"`
-	MatchCheckInterval time.Duration `json:"match_check_interval"`
-	MaxQueueSize       int           `json:"max_queue_size"`
-	EnableBotMatches   bool          `json:"enable_bot_matches"`
+	BotMatchTimeout     time.Duration `json:"bot_match_timeout"`
+	MaxBotMatchTimeout  time.Duration `json:"max_bot_match_timeout"` // upper bound for the wait players can ask for
+	MatchCheckInterval  time.Duration `json:"match_check_interval"`
+	MaxQueueSize        int           `json:"max_queue_size"`
+	EnableBotMatches    bool          `json:"enable_bot_matches"`
+	RatingRange         RatingRange   `json:"rating_range"`
+	PrivateRoomTTL      time.Duration `json:"private_room_ttl"`
+	ReserveNames        bool          `json:"reserve_names"` // reject names already queued by another player
+	QueueUpdateInterval time.Duration `json:"queue_update_interval"`
+	RestoredEntryTTL    time.Duration `json:"restored_entry_ttl"` // how long restored players have to reconnect
+
+	// Avoid rematching any of a player's last RecentOpponents opponents within
+	// RecentOpponentWindow, unless at most RecentOpponentMinQueue players are
+	// waiting in that queue. A RecentOpponents of 0 disables the rule.
+	RecentOpponents        int           `json:"recent_opponents"`
+	RecentOpponentWindow   time.Duration `json:"recent_opponent_window"`
+	RecentOpponentMinQueue int           `json:"recent_opponent_min_queue"`
+
+	// Escalating queue cooldowns for players who abandon games, nil disables penalties
+	PenaltyCooldowns  []time.Duration `json:"penalty_cooldowns"`
+	PenaltyResetAfter time.Duration   `json:"penalty_reset_after"` // offenses are forgiven after this long without a new one
 }
 
 // JoinRequest represents a request to join the matchmaking queue
@@ -48,16 +89,44 @@ type JoinRequest struct {
 	PlayerID    uuid.UUID         `json:"player_id"`
 	Username    string            `json:"username"`
 	Preferences *MatchPreferences `json:"preferences,omitempty"`
+	Priority    QueuePriority      `json:"priority"`
+	Conn        game.WSConnection  `json:"-"`
 	ResponseCh  chan *JoinResponse `json:"-"`
 }
 
 // JoinResponse represents the response to a join request
 type JoinResponse struct {
-	Success   bool      `json:"success"`
-	Message   string    `json:"message"`
-	QueueSize int       `json:"queue_size"`
-	Position  int       `json:"position"`
-	PlayerID  uuid.UUID `json:"player_id"`
+	Success       bool          `json:"success"`
+	Message       string        `json:"message"`
+	QueueSize     int           `json:"queue_size"`
+	Position      int           `json:"position"`
+	PlayerID      uuid.UUID     `json:"player_id"`
+	EstimatedWait time.Duration `json:"estimated_wait"`
+	Cooldown      time.Duration `json:"cooldown,omitempty"` // remaining queue penalty when the join was refused
+
+	err error
+}
+
+// QueueStatus describes a queued player's position and expected wait
+type QueueStatus struct {
+	PlayerID      uuid.UUID        `json:"player_id"`
+	QueueType     models.QueueType `json:"queue_type"`
+	Position      int              `json:"position"`
+	QueueSize     int              `json:"queue_size"`
+	WaitedTime    time.Duration    `json:"waited_time"`
+	EstimatedWait time.Duration    `json:"estimated_wait"` // 0 when no estimate is available
+}
+
+// ToPayload converts the status into the WebSocket payload sent to clients
+func (qs *QueueStatus) ToPayload() models.QueueStatusPayload {
+	return models.QueueStatusPayload{
+		PlayerID:             qs.PlayerID,
+		QueueType:            string(qs.QueueType),
+		Position:             qs.Position,
+		QueueSize:            qs.QueueSize,
+		WaitedSeconds:        int(qs.WaitedTime.Seconds()),
+		EstimatedWaitSeconds: int(qs.EstimatedWait.Seconds()),
+	}
 }
 
 // LeaveRequest represents a request to leave the matchmaking queue
@@ -72,27 +141,72 @@ type LeaveResponse struct {
 	Message string `json:"message"`
 }
 
+// ReattachRequest represents a restored player reconnecting to their queue entry
+type ReattachRequest struct {
+	PlayerID   uuid.UUID
+	Conn       game.WSConnection
+	ResponseCh chan *ReattachResponse
+}
+
+// ReattachResponse represents the response to a reattach request
+type ReattachResponse struct {
+	Status *QueueStatus
+	err    error
+}
+
 // Match represents a successful match between players
 type Match struct {
-	GameID    uuid.UUID `json:"game_id"`
-	Player1   *Player   `json:"player1"`
-	Player2   *Player   `json:"player2"`
-	CreatedAt time.Time `json:"created_at"`
-	IsBot     bool      `json:"is_bot"`
+	GameID    uuid.UUID        `json:"game_id"`
+	Player1   *Player          `json:"player1"`
+	Player2   *Player          `json:"player2"`
+	QueueType models.QueueType `json:"queue_type"`
+	CreatedAt time.Time        `json:"created_at"`
+	IsBot     bool             `json:"is_bot"`
+
+	// Second team members, set for team games only
+	Teammate1 *Player `json:"teammate1,omitempty"`
+	Teammate2 *Player `json:"teammate2,omitempty"`
+
+	// Matchmaking diagnostics used to tune the rating range curve
+	RatingGap   int           `json:"rating_gap"`
+	RatingRange int           `json:"rating_range"` // gap both players accepted at match time
+	WaitTime    time.Duration `json:"wait_time"`    // longest wait of the matched players
+	QueueSize   int           `json:"queue_size"`   // players left waiting in the match's queue type
 }
 
+// QueueEvent is a player joining or leaving the queue
+type QueueEvent struct {
+	PlayerID  uuid.UUID
+	Username  string
+	QueueType models.QueueType
+	Rating    int
+	QueueSize int               // players waiting in the queue type after the change
+	WaitTime  time.Duration     // how long the player waited, when leaving
+	Reason    string            // why the player left, when leaving
+	Conn      game.WSConnection // nil for players restored after a restart
+}
+
+// Why players leave the queue without a match
+const (
+	QueueLeftCancelled = "cancelled" // left or disconnected
+	QueueLeftExpired   = "expired"   // restored after a restart and never reconnected
+)
+
 // Player represents a player in a match
 type Player struct {
-	ID       uuid.UUID `json:"id"`
-	Username string    `json:"username"`
-	IsBot    bool      `json:"is_bot"`
+	ID       uuid.UUID         `json:"id"`
+	Username string            `json:"username"`
+	IsBot    bool              `json:"is_bot"`
+	Rating   int               `json:"rating,omitempty"`
+	Conn     game.WSConnection `json:"-"`
 }
 
 // Interfaces for dependency injection
 
 // GameCreator interface for creating games
 type GameCreator interface {
-	CreateGame(player1, player2 *Player) (*Match, error)
+	CreateGame(player1, player2 *Player, queueType models.QueueType) (*Match, error)
+	CreateTeamGame(team1, team2 [2]*Player) (*Match, error)
 }
 
 // BotProvider interface for creating bot opponents
@@ -103,8 +217,48 @@ type BotProvider interface {
 // EventPublisher interface for publishing matchmaking events
 type EventPublisher interface {
 	PublishMatchFound(match *Match) error
-	PublishPlayerJoined(playerID uuid.UUID, username string) error
-	PublishPlayerLeft(playerID uuid.UUID, username string) error
+	PublishPlayerJoined(event QueueEvent) error
+	PublishPlayerLeft(event QueueEvent) error
+
+	// PublishBotActivated is called for matches against a bot, after
+	// PublishMatchFound, once a player's wait for a human ran out
+	PublishBotActivated(match *Match) error
+}
+
+// RatingProvider interface for looking up player skill ratings
+type RatingProvider interface {
+	CurrentRating(username string) int
+}
+
+// DefaultMatchmakingConfig returns the configuration used by the game server
+func DefaultMatchmakingConfig() MatchmakingConfig {
+	return MatchmakingConfig{
+		BotMatchTimeout:        10 * time.Second,
+		MaxBotMatchTimeout:     2 * time.Minute,
+		MatchCheckInterval:     1 * time.Second,
+		MaxQueueSize:           1000,
+		EnableBotMatches:       true,
+		RatingRange:            DefaultRatingRange(),
+		PrivateRoomTTL:         10 * time.Minute,
+		ReserveNames:           true,
+		QueueUpdateInterval:    3 * time.Second,
+		RestoredEntryTTL:       2 * time.Minute,
+		RecentOpponents:        3,
+		RecentOpponentWindow:   15 * time.Minute,
+		RecentOpponentMinQueue: 4,
+		PenaltyCooldowns:       DefaultPenaltyCooldowns(),
+		PenaltyResetAfter:      24 * time.Hour,
+	}
+}
+
+// DefaultRatingRange starts at ±100 rating and widens by 50 every 5 seconds up to ±400
+func DefaultRatingRange() RatingRange {
+	return RatingRange{
+		Initial:  100,
+		Step:     50,
+		Interval: 5 * time.Second,
+		Max:      400,
+	}
 }
 
 // NewMatchmakingService creates a new matchmaking service
@@ -115,26 +269,62 @@ func NewMatchmakingService(ctx context.Context, config MatchmakingConfig, gameCr
 	if config.BotMatchTimeout == 0 {
 		config.BotMatchTimeout = 10 * time.Second
 	}
+	if config.MaxBotMatchTimeout < config.BotMatchTimeout {
+		config.MaxBotMatchTimeout = 2 * time.Minute
+		if config.MaxBotMatchTimeout < config.BotMatchTimeout {
+			config.MaxBotMatchTimeout = config.BotMatchTimeout
+		}
+	}
 	if config.MatchCheckInterval == 0 {
 		config.MatchCheckInterval = 1 * time.Second
 	}
 	if config.MaxQueueSize == 0 {
 		config.MaxQueueSize = 1000
 	}
+	if config.RatingRange == (RatingRange{}) {
+		config.RatingRange = DefaultRatingRange()
+	}
+	if config.PrivateRoomTTL == 0 {
+		config.PrivateRoomTTL = 10 * time.Minute
+	}
+	if config.QueueUpdateInterval == 0 {
+		config.QueueUpdateInterval = 3 * time.Second
+	}
+	if config.RecentOpponentWindow == 0 {
+		config.RecentOpponentWindow = 15 * time.Minute
+	}
+	if config.RestoredEntryTTL == 0 {
+		config.RestoredEntryTTL = 2 * time.Minute
+	}
+	if config.PenaltyResetAfter == 0 {
+		config.PenaltyResetAfter = 24 * time.Hour
+	}
 	
 	return &MatchmakingService{
-		queue:           NewQueue(),
+		queue:           NewQueue(config.RatingRange),
+		rooms:           make(map[string]*PrivateRoom),
+		penalties:       make(map[string]*models.QueuePenalty),
+		recentOpponents: newRecentOpponents(config.RecentOpponents, config.RecentOpponentWindow),
 		gameCreator:     gameCreator,
 		botProvider:     botProvider,
 		eventPublisher:  eventPublisher,
 		config:          config,
-		joinRequests:    make(chan *JoinRequest, 100),
-		leaveRequests:   make(chan *LeaveRequest, 100),
-		ctx:             serviceCtx,
-		cancel:          cancel,
+		joinRequests:     make(chan *JoinRequest, 100),
+		leaveRequests:    make(chan *LeaveRequest, 100),
+		reattachRequests: make(chan *ReattachRequest, 100),
+		botTimeouts:      make(chan *QueueEntry, 100),
+		ctx:              serviceCtx,
+		cancel:           cancel,
 	}
 }
 
+// SetRatingProvider sets the source of player ratings used for matching
+func (s *MatchmakingService) SetRatingProvider(ratingProvider RatingProvider) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ratingProvider = ratingProvider
+}
+
 // Start starts the matchmaking service
 func (s *MatchmakingService) Start() error {
 	s.mutex.Lock()
@@ -144,13 +334,16 @@ func (s *MatchmakingService) Start() error {
 		return ErrServiceAlreadyRunning
 	}
 	
+	// Bring back players who were queued before a restart
+	if err := s.restoreQueue(); err != nil {
+		log.Printf("Starting with an empty queue: %v", err)
+	}
+	
 	s.running = true
 	
-	// Start worker goroutines
-	s.wg.Add(3)
-	go s.requestProcessor()
-	go s.matchProcessor()
-	go s.queueProcessor()
+	// The event loop owns the queue from here on
+	s.wg.Add(1)
+	go s.eventLoop()
 	
 	log.Println("Matchmaking service started")
 	return nil
@@ -159,47 +352,72 @@ func (s *MatchmakingService) Start() error {
 // Stop stops the matchmaking service
 func (s *MatchmakingService) Stop() error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	
 	if !s.running {
+		s.mutex.Unlock()
 		return ErrServiceNotRunning
 	}
 	
 	s.running = false
 	s.cancel()
+	s.mutex.Unlock()
 	
-	// Close channels
-	close(s.joinRequests)
-	close(s.leaveRequests)
-	
-	// Wait for goroutines to finish
+	// Wait for the event loop to finish, requests still in flight see the
+	// cancelled context and give up. The loop reads the service state, so
+	// s.mutex isn't held meanwhile.
 	s.wg.Wait()
 	
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	
+	// Keep queued players across the restart
+	if err := s.saveQueue(); err != nil {
+		log.Printf("Queued players will be dropped: %v", err)
+	}
+	
 	log.Println("Matchmaking service stopped")
 	return nil
 }
 
-// JoinQueue adds a player to the matchmaking queue
-func (s *MatchmakingService) JoinQueue(playerID uuid.UUID, username string, preferences *MatchPreferences) (*JoinResponse, error) {
+// Drain stops the service from taking joins and making matches, ahead of a
+// shutdown. Queued players stay queued and are saved by Stop.
+func (s *MatchmakingService) Drain() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.draining {
+		s.draining = true
+		log.Println("Matchmaking service draining, no new matches")
+	}
+}
+
+// JoinQueue adds a player to the matchmaking queue. The connection is used to
+// notify the player once a game has been created for them.
+func (s *MatchmakingService) JoinQueue(playerID uuid.UUID, username string, conn game.WSConnection, preferences *MatchPreferences) (*JoinResponse, error) {
+	return s.JoinQueueWithPriority(playerID, username, conn, preferences, PriorityNormal)
+}
+
+// JoinQueueWithPriority adds a player to the queue ahead of lower priority
+// entries, e.g. for rematches or tournament games
+func (s *MatchmakingService) JoinQueueWithPriority(playerID uuid.UUID, username string, conn game.WSConnection, preferences *MatchPreferences, priority QueuePriority) (*JoinResponse, error) {
 	if !s.isRunning() {
 		return &JoinResponse{
 			Success: false,
 			Message: "Matchmaking service is not running",
 		}, ErrServiceNotRunning
 	}
-	
-	// Check queue size limit
-	if s.queue.GetSize() >= s.config.MaxQueueSize {
+	if s.isDraining() {
 		return &JoinResponse{
 			Success: false,
-			Message: "Queue is full",
-		}, ErrQueueFull
+			Message: "Matchmaking service is draining",
+		}, ErrServiceDraining
 	}
 	
 	request := &JoinRequest{
 		PlayerID:    playerID,
 		Username:    username,
 		Preferences: preferences,
+		Priority:    priority,
+		Conn:        conn,
 		ResponseCh:  make(chan *JoinResponse, 1),
 	}
 	
@@ -208,7 +426,7 @@ func (s *MatchmakingService) JoinQueue(playerID uuid.UUID, username string, pref
 		// Wait for response
 		select {
 		case response := <-request.ResponseCh:
-			return response, nil
+			return response, response.err
 		case <-s.ctx.Done():
 			return &JoinResponse{
 				Success: false,
@@ -267,109 +485,208 @@ func (s *MatchmakingService) LeaveQueue(playerID uuid.UUID) (*LeaveResponse, err
 	}
 }
 
+// GetQueueStatus returns the position and estimated wait of a queued player
+func (s *MatchmakingService) GetQueueStatus(playerID uuid.UUID) (*QueueStatus, error) {
+	entry, exists := s.queue.GetEntry(playerID)
+	if !exists {
+		return nil, ErrPlayerNotInQueue
+	}
+
+	return s.queueStatus(entry), nil
+}
+
+// queueStatus builds the live status of a queue entry
+func (s *MatchmakingService) queueStatus(entry *QueueEntry) *QueueStatus {
+	return &QueueStatus{
+		PlayerID:      entry.PlayerID,
+		QueueType:     entry.Preferences.QueueType,
+		Position:      s.calculatePosition(entry),
+		QueueSize:     s.queue.GetSize(),
+		WaitedTime:    time.Since(entry.JoinedAt),
+		EstimatedWait: s.estimateWait(entry),
+	}
+}
+
 // GetQueueStats returns queue statistics
 func (s *MatchmakingService) GetQueueStats() QueueStats {
 	return s.queue.GetStats()
 }
 
-// requestProcessor processes join and leave requests
-func (s *MatchmakingService) requestProcessor() {
+// eventLoop owns the queue. Joins, leaves, reattaches, bot timeouts and match
+// passes all run here one at a time, so a player can't be matched by a bot
+// timer and a match pass at once, or matched after leaving.
+func (s *MatchmakingService) eventLoop() {
 	defer s.wg.Done()
 	
+	matchTicker := time.NewTicker(s.config.MatchCheckInterval)
+	defer matchTicker.Stop()
+	
+	updateTicker := time.NewTicker(s.config.QueueUpdateInterval)
+	defer updateTicker.Stop()
+	
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
 			
 		case request := <-s.joinRequests:
-			if request == nil {
-				return // Channel closed
-			}
 			s.handleJoinRequest(request)
 			
 		case request := <-s.leaveRequests:
-			if request == nil {
-				return // Channel closed
-			}
 			s.handleLeaveRequest(request)
-		}
-	}
-}
-
-// matchProcessor looks for matches between players
-func (s *MatchmakingService) matchProcessor() {
-	defer s.wg.Done()
-	
-	ticker := time.NewTicker(s.config.MatchCheckInterval)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
+			
+		case request := <-s.reattachRequests:
+			s.handleReattachRequest(request)
+			
+		case entry := <-s.botTimeouts:
+			s.handleBotTimeout(entry)
+			
+		case <-matchTicker.C:
 			s.processMatches()
+			s.expirePrivateRooms()
+			s.expireDetachedEntries()
+			s.recentOpponents.cleanup()
+			
+		case <-updateTicker.C:
+			s.pushQueueUpdates()
 		}
 	}
 }
 
-// queueProcessor handles queue operations
-func (s *MatchmakingService) queueProcessor() {
-	defer s.wg.Done()
-	
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case entry := <-s.queue.addChan:
-			s.queue.processAdd(entry)
-		case playerID := <-s.queue.removeChan:
-			s.queue.processRemove(playerID)
+// pushQueueUpdates sends every connected queued player a MsgQueueUpdate
+func (s *MatchmakingService) pushQueueUpdates() {
+	for _, entry := range s.queue.GetAllEntries() {
+		if entry.Conn == nil {
+			continue
+		}
+		
+		status := s.queueStatus(entry)
+		if err := entry.Conn.WriteJSON(models.NewWSMessage(models.MsgQueueUpdate, status.ToPayload())); err != nil {
+			log.Printf("Failed to send queue update to %s: %v", entry.Username, err)
 		}
 	}
 }
 
 // handleJoinRequest processes a join request
 func (s *MatchmakingService) handleJoinRequest(request *JoinRequest) {
-	// Check if player is already in queue
-	if _, exists := s.queue.GetEntry(request.PlayerID); exists {
+	if s.queue.GetSize() >= s.config.MaxQueueSize {
 		request.ResponseCh <- &JoinResponse{
 			Success: false,
-			Message: "Player already in queue",
+			Message: "Queue is full",
+			err:     ErrQueueFull,
 		}
 		return
 	}
 	
-	// Add player to queue
-	entry := s.queue.Add(request.PlayerID, request.Username, request.Preferences)
+	// Check if player or connection is already in queue
+	existing, exists := s.queue.GetEntry(request.PlayerID)
+	if !exists {
+		existing, exists = s.queue.GetEntryByConn(request.Conn)
+	}
+	if !exists {
+		// A player restored after a restart rejoining under the same name
+		if detached, found := s.queue.GetEntryByUsername(request.Username); found && s.queue.isDetached(detached) {
+			existing, exists = detached, true
+		}
+	}
+	if exists && s.reattach(existing, request.Conn) {
+		request.ResponseCh <- &JoinResponse{
+			Success:       true,
+			Message:       "Restored queue position",
+			QueueSize:     s.queue.GetSize(),
+			Position:      s.calculatePosition(existing),
+			PlayerID:      existing.PlayerID,
+			EstimatedWait: s.estimateWait(existing),
+		}
+		return
+	}
+	if exists {
+		request.ResponseCh <- &JoinResponse{
+			Success:       false,
+			Message:       "Player already in queue",
+			QueueSize:     s.queue.GetSize(),
+			Position:      s.calculatePosition(existing),
+			PlayerID:      existing.PlayerID,
+			EstimatedWait: s.estimateWait(existing),
+			err:           ErrPlayerAlreadyInQueue,
+		}
+		return
+	}
+
+	// Players who recently abandoned games sit out their cooldown
+	if cooldown := s.GetCooldown(request.Username); cooldown > 0 {
+		request.ResponseCh <- &JoinResponse{
+			Success:  false,
+			Message:  "Queue cooldown active",
+			Cooldown: cooldown,
+			err:      ErrQueueCooldown,
+		}
+		return
+	}
+
+	// Reserve names so two players can't queue under the same one
+	if s.config.ReserveNames {
+		if _, taken := s.queue.GetEntryByUsername(request.Username); taken {
+			request.ResponseCh <- &JoinResponse{
+				Success: false,
+				Message: "Username is already in the queue",
+				err:     ErrUsernameTaken,
+			}
+			return
+		}
+	}
 	
-	// Set up bot timer if enabled
-	if s.config.EnableBotMatches && entry.Preferences.AllowBots {
-		timeout := s.config.BotMatchTimeout
-		if entry.Preferences.MaxWaitTime > 0 {
-			timeout = time.Duration(entry.Preferences.MaxWaitTime) * time.Second
+	// Add player to queue
+	preferences := request.Preferences
+	if preferences == nil {
+		preferences = DefaultMatchPreferences()
+		preferences.AllowBots = s.config.EnableBotMatches
+		preferences.MaxWaitTime = 0
+	}
+	if preferences.QueueType == "" {
+		preferences.QueueType = models.QueueTypeCasual
+	}
+
+	// Ranked and team games are played against humans only
+	if preferences.QueueType == models.QueueTypeRanked || preferences.QueueType == models.QueueTypeTeam {
+		preferences.AllowBots = false
+	}
+
+	// A party is at most two players
+	if preferences.PartyID != "" && s.queue.GetPartySize(preferences.PartyID) >= 2 {
+		request.ResponseCh <- &JoinResponse{
+			Success: false,
+			Message: "Party is already full",
+			err:     ErrPartyFull,
 		}
-		
-		entry.BotTimer = time.AfterFunc(timeout, func() {
-			s.createBotMatch(entry)
-		})
+		return
 	}
+	entry := s.queue.Add(request.PlayerID, request.Username, s.lookupRating(request.Username), request.Priority, request.Conn, preferences)
+	s.startBotTimer(entry)
 	
 	// Publish event
 	if s.eventPublisher != nil {
-		s.eventPublisher.PublishPlayerJoined(request.PlayerID, request.Username)
+		s.eventPublisher.PublishPlayerJoined(QueueEvent{
+			PlayerID:  request.PlayerID,
+			Username:  request.Username,
+			QueueType: preferences.QueueType,
+			Rating:    entry.Rating,
+			QueueSize: s.queue.CountQueueType(preferences.QueueType),
+			Conn:      request.Conn,
+		})
 	}
 	
 	// Send response
 	request.ResponseCh <- &JoinResponse{
-		Success:   true,
-		Message:   "Successfully joined queue",
-		QueueSize: s.queue.GetSize(),
-		Position:  s.calculatePosition(entry),
-		PlayerID:  request.PlayerID,
+		Success:       true,
+		Message:       "Successfully joined queue",
+		QueueSize:     s.queue.GetSize(),
+		Position:      s.calculatePosition(entry),
+		PlayerID:      request.PlayerID,
+		EstimatedWait: s.estimateWait(entry),
 	}
 	
-	log.Printf("Player %s (%s) joined matchmaking queue", request.Username, request.PlayerID)
+	logging.Infof("Player %s (%s) joined matchmaking queue", request.Username, request.PlayerID)
 }
 
 // handleLeaveRequest processes a leave request
@@ -386,10 +703,11 @@ func (s *MatchmakingService) handleLeaveRequest(request *LeaveRequest) {
 	
 	// Remove player from queue
 	s.queue.Remove(request.PlayerID)
+	s.stopBotTimer(entry)
 	
 	// Publish event
 	if s.eventPublisher != nil {
-		s.eventPublisher.PublishPlayerLeft(request.PlayerID, entry.Username)
+		s.eventPublisher.PublishPlayerLeft(s.leftEvent(entry, QueueLeftCancelled))
 	}
 	
 	// Send response
@@ -398,11 +716,29 @@ func (s *MatchmakingService) handleLeaveRequest(request *LeaveRequest) {
 		Message: "Successfully left queue",
 	}
 	
-	log.Printf("Player %s (%s) left matchmaking queue", entry.Username, request.PlayerID)
+	logging.Infof("Player %s (%s) left matchmaking queue", entry.Username, request.PlayerID)
+}
+
+// leftEvent describes the entry leaving the queue, after it was removed
+func (s *MatchmakingService) leftEvent(entry *QueueEntry, reason string) QueueEvent {
+	return QueueEvent{
+		PlayerID:  entry.PlayerID,
+		Username:  entry.Username,
+		QueueType: entry.Preferences.QueueType,
+		Rating:    entry.Rating,
+		QueueSize: s.queue.CountQueueType(entry.Preferences.QueueType),
+		WaitTime:  time.Since(entry.JoinedAt),
+		Reason:    reason,
+		Conn:      entry.Conn,
+	}
 }
 
 // processMatches looks for and creates matches between players
 func (s *MatchmakingService) processMatches() {
+	if s.isDraining() {
+		return
+	}
+	
 	entries := s.queue.GetAllEntries()
 	
 	// Simple matching algorithm - can be improved with more sophisticated logic
@@ -414,85 +750,227 @@ func (s *MatchmakingService) processMatches() {
 			continue
 		}
 		
+		// Restored players can't be told about a match until they reconnect
+		if s.queue.isDetached(entry1) {
+			continue
+		}
+		
 		// Look for a compatible match
-		match := s.queue.GetCompatibleMatch(entry1)
+		match := s.queue.GetCompatibleMatch(entry1, s.avoidRecentOpponents(entry1))
 		if match != nil {
 			s.createPlayerMatch(entry1, match)
 		}
 	}
+	
+	s.processTeamMatches()
+}
+
+// processTeamMatches pairs up teams for 2v2 games. Complete parties play as a
+// team, solo players are teamed up in matching order.
+func (s *MatchmakingService) processTeamMatches() {
+	parties := make(map[string][]*QueueEntry)
+	var solos []*QueueEntry
+	
+	for _, entry := range s.queue.GetAllEntries() {
+		if entry.Preferences.QueueType != models.QueueTypeTeam || s.queue.isDetached(entry) {
+			continue
+		}
+		
+		if entry.Preferences.PartyID == "" {
+			solos = append(solos, entry)
+		} else {
+			parties[entry.Preferences.PartyID] = append(parties[entry.Preferences.PartyID], entry)
+		}
+	}
+	
+	sort.Slice(solos, func(i, j int) bool {
+		return solos[i].ahead(solos[j])
+	})
+	
+	// Parties wait until both members are queued
+	var teams [][2]*QueueEntry
+	for _, members := range parties {
+		if len(members) == 2 {
+			teams = append(teams, [2]*QueueEntry{members[0], members[1]})
+		}
+	}
+	for i := 0; i+1 < len(solos); i += 2 {
+		teams = append(teams, [2]*QueueEntry{solos[i], solos[i+1]})
+	}
+	
+	// Highest priority and longest waiting teams play first
+	sort.Slice(teams, func(i, j int) bool {
+		return teamLead(teams[i]).ahead(teamLead(teams[j]))
+	})
+	
+	for i := 0; i+1 < len(teams); i += 2 {
+		s.createTeamMatch(teams[i], teams[i+1])
+	}
+}
+
+// createTeamMatch creates a 2v2 match between two teams
+func (s *MatchmakingService) createTeamMatch(team1, team2 [2]*QueueEntry) {
+	entries := []*QueueEntry{team1[0], team1[1], team2[0], team2[1]}
+	
+	// Remove all four players from queue, bail out if anyone was matched or left meanwhile
+	if _, ok := s.queue.takeEntries(team1[0].PlayerID, team1[1].PlayerID, team2[0].PlayerID, team2[1].PlayerID); !ok {
+		return
+	}
+	
+	players := make([]*Player, len(entries))
+	for i, entry := range entries {
+		players[i] = &Player{
+			ID:       entry.PlayerID,
+			Username: entry.Username,
+			Rating:   entry.Rating,
+			Conn:     entry.Conn,
+		}
+	}
+	
+	match, err := s.gameCreator.CreateTeamGame([2]*Player{players[0], players[1]}, [2]*Player{players[2], players[3]})
+	if err != nil {
+		log.Printf("Failed to create team game: %v", err)
+		// Put players back in the queue on failure, ahead of ordinary entries
+		for _, entry := range entries {
+			s.requeue(entry)
+		}
+		return
+	}
+	
+	// Update statistics
+	s.queue.incrementMatched()
+	for _, entry := range entries {
+		waitTime := time.Since(entry.JoinedAt)
+		s.queue.updateAverageWaitTime(waitTime)
+		if waitTime > match.WaitTime {
+			match.WaitTime = waitTime
+		}
+	}
+	match.QueueSize = s.queue.CountQueueType(models.QueueTypeTeam)
+	
+	// Publish match found event
+	if s.eventPublisher != nil {
+		s.eventPublisher.PublishMatchFound(match)
+	}
+	
+	logging.Infof("Team match created: %s & %s vs %s & %s (Game ID: %s)",
+		players[0].Username, players[1].Username, players[2].Username, players[3].Username, match.GameID)
+}
+
+// teamLead returns the team member that comes first in matching order
+func teamLead(team [2]*QueueEntry) *QueueEntry {
+	if team[1].ahead(team[0]) {
+		return team[1]
+	}
+	return team[0]
 }
 
 // createPlayerMatch creates a match between two players
 func (s *MatchmakingService) createPlayerMatch(entry1, entry2 *QueueEntry) {
-	// Remove both players from queue
-	s.queue.Remove(entry1.PlayerID)
-	s.queue.Remove(entry2.PlayerID)
+	// Remove both players from queue, bail out if either was matched or left meanwhile
+	if _, _, ok := s.queue.takePair(entry1.PlayerID, entry2.PlayerID); !ok {
+		return
+	}
+	s.stopBotTimer(entry1)
+	s.stopBotTimer(entry2)
 	
 	// Create players
 	player1 := &Player{
 		ID:       entry1.PlayerID,
 		Username: entry1.Username,
 		IsBot:    false,
+		Rating:   entry1.Rating,
+		Conn:     entry1.Conn,
 	}
 	
 	player2 := &Player{
 		ID:       entry2.PlayerID,
 		Username: entry2.Username,
 		IsBot:    false,
+		Rating:   entry2.Rating,
+		Conn:     entry2.Conn,
 	}
 	
 	// Create match
-	match, err := s.gameCreator.CreateGame(player1, player2)
+	match, err := s.gameCreator.CreateGame(player1, player2, entry1.Preferences.QueueType)
 	if err != nil {
 		log.Printf("Failed to create game for players %s and %s: %v", entry1.Username, entry2.Username, err)
-		// Re-add players to queue on failure
-		s.queue.Add(entry1.PlayerID, entry1.Username, entry1.Preferences)
-		s.queue.Add(entry2.PlayerID, entry2.Username, entry2.Preferences)
+		// Put players back in the queue on failure, ahead of ordinary entries
+		s.requeue(entry1)
+		s.requeue(entry2)
 		return
 	}
 	
+	// Record how far the rating range had to widen for this match
+	match.RatingGap = abs(entry1.Rating - entry2.Rating)
+	match.RatingRange = s.queue.RatingRangeFor(entry1)
+	if ratingRange := s.queue.RatingRangeFor(entry2); ratingRange < match.RatingRange {
+		match.RatingRange = ratingRange
+	}
+	match.WaitTime = time.Since(entry1.JoinedAt)
+	if waitTime := time.Since(entry2.JoinedAt); waitTime > match.WaitTime {
+		match.WaitTime = waitTime
+	}
+	match.QueueSize = s.queue.CountQueueType(entry1.Preferences.QueueType)
+	
 	// Update statistics
 	s.queue.incrementMatched()
 	s.queue.updateAverageWaitTime(time.Since(entry1.JoinedAt))
 	s.queue.updateAverageWaitTime(time.Since(entry2.JoinedAt))
+	s.recentOpponents.record(entry1.Username, entry2.Username)
 	
 	// Publish match found event
 	if s.eventPublisher != nil {
 		s.eventPublisher.PublishMatchFound(match)
 	}
 	
-	log.Printf("Match created: %s vs %s (Game ID: %s)", player1.Username, player2.Username, match.GameID)
+	logging.Infof("Match created: %s vs %s (Game ID: %s, rating gap %d within ±%d)", player1.Username, player2.Username, match.GameID, match.RatingGap, match.RatingRange)
+}
+
+// handleBotTimeout matches a player with a bot once their wait runs out,
+// unless they were matched or left the queue before the timeout got here or
+// the service is draining
+func (s *MatchmakingService) handleBotTimeout(entry *QueueEntry) {
+	if s.isDraining() {
+		return
+	}
+	if current, exists := s.queue.GetEntry(entry.PlayerID); !exists || current != entry {
+		return
+	}
+	
+	s.createBotMatch(entry)
 }
 
 // createBotMatch creates a match between a player and a bot
 func (s *MatchmakingService) createBotMatch(entry *QueueEntry) {
-	// Check if player is still in queue
-	if _, exists := s.queue.GetEntry(entry.PlayerID); !exists {
+	// Remove player from queue, bail out if they were matched or left meanwhile
+	if _, exists := s.queue.take(entry.PlayerID); !exists {
 		return
 	}
 	
-	// Remove player from queue
-	s.queue.Remove(entry.PlayerID)
-	
 	// Create player and bot
 	player := &Player{
 		ID:       entry.PlayerID,
 		Username: entry.Username,
 		IsBot:    false,
+		Rating:   entry.Rating,
+		Conn:     entry.Conn,
 	}
 	
 	bot := s.botProvider.CreateBot()
 	
 	// Create match
-	match, err := s.gameCreator.CreateGame(player, bot)
+	match, err := s.gameCreator.CreateGame(player, bot, models.QueueTypeCasual)
 	if err != nil {
 		log.Printf("Failed to create bot game for player %s: %v", entry.Username, err)
-		// Re-add player to queue on failure
-		s.queue.Add(entry.PlayerID, entry.Username, entry.Preferences)
+		// Put player back in the queue on failure, ahead of ordinary entries
+		s.requeue(entry)
 		return
 	}
 	
 	match.IsBot = true
+	match.WaitTime = time.Since(entry.JoinedAt)
+	match.QueueSize = s.queue.CountQueueType(entry.Preferences.QueueType)
 	
 	// Update statistics
 	s.queue.incrementBotMatches()
@@ -501,23 +979,131 @@ func (s *MatchmakingService) createBotMatch(entry *QueueEntry) {
 	// Publish match found event
 	if s.eventPublisher != nil {
 		s.eventPublisher.PublishMatchFound(match)
+		s.eventPublisher.PublishBotActivated(match)
 	}
 	
-	log.Printf("Bot match created: %s vs Bot (Game ID: %s)", player.Username, match.GameID)
+	logging.Infof("Bot match created: %s vs Bot (Game ID: %s)", player.Username, match.GameID)
 }
 
-// calculatePosition calculates the position of a player in the queue
-func (s *MatchmakingService) calculatePosition(entry *QueueEntry) int {
-	entries := s.queue.GetAllEntries()
-	position := 1
-	
-	for _, e := range entries {
-		if e.JoinedAt.Before(entry.JoinedAt) {
-			position++
+// avoidRecentOpponents returns a filter that passes over the entry's recent
+// opponents, or nil when the queue is too small to be picky
+func (s *MatchmakingService) avoidRecentOpponents(entry *QueueEntry) func(*QueueEntry) bool {
+	if s.config.RecentOpponents <= 0 || s.queue.CountQueueType(entry.Preferences.QueueType) <= s.config.RecentOpponentMinQueue {
+		return nil
+	}
+
+	return func(candidate *QueueEntry) bool {
+		return s.recentOpponents.played(entry.Username, candidate.Username)
+	}
+}
+
+// lookupRating returns the player's rating, or 0 when no rating provider is set
+func (s *MatchmakingService) lookupRating(username string) int {
+	s.mutex.RLock()
+	ratingProvider := s.ratingProvider
+	s.mutex.RUnlock()
+
+	if ratingProvider == nil {
+		return 0
+	}
+	return ratingProvider.CurrentRating(username)
+}
+
+// botTimeout returns how long the player waits before being matched with a bot.
+// Players may ask for a longer or shorter wait, up to MaxBotMatchTimeout.
+func (s *MatchmakingService) botTimeout(entry *QueueEntry) time.Duration {
+	s.timeoutMutex.RLock()
+	defer s.timeoutMutex.RUnlock()
+
+	if entry.Preferences.MaxWaitTime <= 0 {
+		return s.config.BotMatchTimeout
+	}
+
+	timeout := time.Duration(entry.Preferences.MaxWaitTime) * time.Second
+	if timeout > s.config.MaxBotMatchTimeout {
+		return s.config.MaxBotMatchTimeout
+	}
+	return timeout
+}
+
+// SetBotMatchTimeout changes how long players wait for an opponent before a
+// bot takes the seat. Players already waiting keep the timer they got when
+// they joined. The longest wait players can ask for is raised to the timeout
+// if it was shorter.
+func (s *MatchmakingService) SetBotMatchTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return ErrInvalidBotTimeout
+	}
+
+	s.timeoutMutex.Lock()
+	defer s.timeoutMutex.Unlock()
+	s.config.BotMatchTimeout = timeout
+	if s.config.MaxBotMatchTimeout < timeout {
+		s.config.MaxBotMatchTimeout = timeout
+	}
+	return nil
+}
+
+// BotMatchTimeout returns how long players wait before a bot takes the seat
+func (s *MatchmakingService) BotMatchTimeout() time.Duration {
+	s.timeoutMutex.RLock()
+	defer s.timeoutMutex.RUnlock()
+	return s.config.BotMatchTimeout
+}
+
+// estimateWait estimates the remaining wait from the average wait time,
+// capped by the bot timer for players who accept bot opponents
+func (s *MatchmakingService) estimateWait(entry *QueueEntry) time.Duration {
+	waited := time.Since(entry.JoinedAt)
+	estimate := s.queue.GetStats().AverageWaitTime - waited
+
+	if s.config.EnableBotMatches && entry.Preferences.AllowBots {
+		if botWait := s.botTimeout(entry) - waited; estimate <= 0 || botWait < estimate {
+			estimate = botWait
 		}
 	}
+
+	if estimate < 0 {
+		return 0
+	}
+	return estimate
+}
+
+// startBotTimer hands the entry to the event loop once the player's bot wait
+// runs out, for players who accept bot opponents
+func (s *MatchmakingService) startBotTimer(entry *QueueEntry) {
+	if !s.config.EnableBotMatches || !entry.Preferences.AllowBots {
+		return
+	}
 	
-	return position
+	entry.BotTimer = time.AfterFunc(s.botTimeout(entry), func() {
+		select {
+		case s.botTimeouts <- entry:
+		case <-s.ctx.Done():
+		}
+	})
+}
+
+// stopBotTimer cancels the pending bot match for a matched player
+func (s *MatchmakingService) stopBotTimer(entry *QueueEntry) {
+	if entry.BotTimer != nil {
+		entry.BotTimer.Stop()
+	}
+}
+
+// requeue puts a player whose game couldn't be created back in the queue
+// with recovery priority. Their bot timer was stopped or has fired, so it
+// starts over unless they are still waiting to reconnect.
+func (s *MatchmakingService) requeue(entry *QueueEntry) {
+	s.queue.restore(entry, PriorityRecovery)
+	if !s.queue.isDetached(entry) {
+		s.startBotTimer(entry)
+	}
+}
+
+// calculatePosition calculates the position of a player in their queue
+func (s *MatchmakingService) calculatePosition(entry *QueueEntry) int {
+	return s.queue.GetPosition(entry)
 }
 
 // isRunning checks if the service is running
@@ -525,4 +1111,11 @@ func (s *MatchmakingService) isRunning() bool {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 	return s.running
-}
\ No newline at end of file
+}
+
+// isDraining checks if the service stopped making matches
+func (s *MatchmakingService) isDraining() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.draining
+}
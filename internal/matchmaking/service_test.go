@@ -0,0 +1,360 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// testCreator records the games it creates, failing the first failures ones
+type testCreator struct {
+	mu       sync.Mutex
+	failures int
+	games    map[uuid.UUID]int // games per player
+	bots     int
+}
+
+func newTestCreator() *testCreator {
+	return &testCreator{games: make(map[uuid.UUID]int)}
+}
+
+func (c *testCreator) CreateGame(player1, player2 *Player, queueType models.QueueType) (*Match, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return nil, ErrGameCreationFailed
+	}
+	for _, player := range []*Player{player1, player2} {
+		if player.IsBot {
+			c.bots++
+		} else {
+			c.games[player.ID]++
+		}
+	}
+	return &Match{GameID: uuid.New(), Player1: player1, Player2: player2, QueueType: queueType, CreatedAt: time.Now()}, nil
+}
+
+func (c *testCreator) CreateTeamGame(team1, team2 [2]*Player) (*Match, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, player := range []*Player{team1[0], team1[1], team2[0], team2[1]} {
+		c.games[player.ID]++
+	}
+	return &Match{GameID: uuid.New(), Player1: team1[0], Player2: team2[0], Teammate1: team1[1], Teammate2: team2[1], QueueType: models.QueueTypeTeam}, nil
+}
+
+// gamesOf returns how many games the player was put in
+func (c *testCreator) gamesOf(playerID uuid.UUID) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.games[playerID]
+}
+
+func (c *testCreator) botGames() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bots
+}
+
+// testConn is a queued player's connection, dropping what it is sent.
+// Players queued without one are taken for players restored after a restart.
+type testConn struct{ name string }
+
+func (*testConn) WriteJSON(v interface{}) error { return nil }
+func (*testConn) Close() error                  { return nil }
+
+type testBots struct{}
+
+func (testBots) CreateBot() *Player {
+	return &Player{ID: uuid.New(), Username: "bot", IsBot: true}
+}
+
+// startTestService runs a service with the config until the test ends
+func startTestService(t *testing.T, config MatchmakingConfig, creator *testCreator) *MatchmakingService {
+	t.Helper()
+	service := NewMatchmakingService(context.Background(), config, creator, testBots{}, NewDefaultEventPublisher())
+	if err := service.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.Stop() })
+	return service
+}
+
+// waitForEmptyQueue waits until every queued player was matched
+func waitForEmptyQueue(t *testing.T, service *MatchmakingService) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for service.GetQueueStats().CurrentSize > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d players still queued", service.GetQueueStats().CurrentSize)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPlayersAreMatchedOnce(t *testing.T) {
+	// Bot timers run out while match passes pair the same players
+	config := DefaultMatchmakingConfig()
+	config.BotMatchTimeout = time.Millisecond
+	config.MatchCheckInterval = time.Millisecond
+	creator := newTestCreator()
+	service := startTestService(t, config, creator)
+
+	players := make([]uuid.UUID, 200)
+	var wg sync.WaitGroup
+	for i := range players {
+		players[i] = uuid.New()
+		wg.Add(1)
+		go func(playerID uuid.UUID, name string) {
+			defer wg.Done()
+			if _, err := service.JoinQueue(playerID, name, &testConn{name}, nil); err != nil {
+				t.Errorf("%s couldn't join: %v", name, err)
+			}
+		}(players[i], fmt.Sprintf("player-%d", i))
+	}
+	wg.Wait()
+	waitForEmptyQueue(t, service)
+
+	for i, playerID := range players {
+		if games := creator.gamesOf(playerID); games != 1 {
+			t.Errorf("player-%d was put in %d games, want 1", i, games)
+		}
+	}
+}
+
+func TestLeavingCancelsBotMatch(t *testing.T) {
+	config := DefaultMatchmakingConfig()
+	config.BotMatchTimeout = 50 * time.Millisecond
+	creator := newTestCreator()
+	service := startTestService(t, config, creator)
+
+	playerID := uuid.New()
+	if _, err := service.JoinQueue(playerID, "alice", &testConn{"alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if response, err := service.LeaveQueue(playerID); err != nil || !response.Success {
+		t.Fatalf("LeaveQueue = %+v, %v", response, err)
+	}
+	time.Sleep(4 * config.BotMatchTimeout)
+
+	if games := creator.gamesOf(playerID); games != 0 {
+		t.Errorf("the player who left was put in %d games", games)
+	}
+	if response, _ := service.LeaveQueue(playerID); response.Success {
+		t.Error("left the queue twice")
+	}
+}
+
+func TestBotTakesTheSeat(t *testing.T) {
+	config := DefaultMatchmakingConfig()
+	config.BotMatchTimeout = 20 * time.Millisecond
+	creator := newTestCreator()
+	service := startTestService(t, config, creator)
+
+	playerID := uuid.New()
+	if _, err := service.JoinQueue(playerID, "alice", &testConn{"alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForEmptyQueue(t, service)
+	if creator.gamesOf(playerID) != 1 || creator.botGames() != 1 {
+		t.Errorf("%d games and %d bot games, want a game against a bot", creator.gamesOf(playerID), creator.botGames())
+	}
+	if stats := service.GetQueueStats(); stats.TotalBotMatches != 1 {
+		t.Errorf("stats = %+v, want one bot match", stats)
+	}
+}
+
+func TestRankedPlayersWaitForHumans(t *testing.T) {
+	config := DefaultMatchmakingConfig()
+	config.BotMatchTimeout = 10 * time.Millisecond
+	config.MatchCheckInterval = 10 * time.Millisecond
+	creator := newTestCreator()
+	service := startTestService(t, config, creator)
+
+	ranked := &MatchPreferences{QueueType: models.QueueTypeRanked, AllowBots: true, SkillLevel: 5}
+	alice := uuid.New()
+	if _, err := service.JoinQueue(alice, "alice", &testConn{"alice"}, ranked); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * config.BotMatchTimeout)
+	if creator.gamesOf(alice) != 0 {
+		t.Fatal("a ranked player was given a bot")
+	}
+
+	bob := uuid.New()
+	if _, err := service.JoinQueue(bob, "bob", &testConn{"bob"}, &MatchPreferences{QueueType: models.QueueTypeRanked, SkillLevel: 6}); err != nil {
+		t.Fatal(err)
+	}
+	waitForEmptyQueue(t, service)
+	if creator.gamesOf(alice) != 1 || creator.gamesOf(bob) != 1 || creator.botGames() != 0 {
+		t.Error("the ranked players weren't matched together")
+	}
+}
+
+func TestJoinQueueRejects(t *testing.T) {
+	config := DefaultMatchmakingConfig()
+	config.EnableBotMatches = false
+	config.MaxQueueSize = 3
+	service := startTestService(t, config, newTestCreator())
+
+	// Ranked players too far apart in skill stay queued
+	join := func(playerID uuid.UUID, name string, skill int) error {
+		_, err := service.JoinQueue(playerID, name, &testConn{name}, &MatchPreferences{QueueType: models.QueueTypeRanked, SkillLevel: skill})
+		return err
+	}
+	alice := uuid.New()
+	if err := join(alice, "alice", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := join(uuid.New(), "bob", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		playerID uuid.UUID
+		username string
+		want     error
+	}{
+		{"same player", alice, "alice", ErrPlayerAlreadyInQueue},
+		{"name taken", uuid.New(), "ALICE", ErrUsernameTaken},
+	}
+	for _, tt := range tests {
+		if err := join(tt.playerID, tt.username, 1); !errors.Is(err, tt.want) {
+			t.Errorf("%s: JoinQueue = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := join(uuid.New(), "carol", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := join(uuid.New(), "dave", 5); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("JoinQueue on a full queue = %v, want ErrQueueFull", err)
+	}
+
+	service.Drain()
+	if _, err := service.LeaveQueue(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := join(uuid.New(), "erin", 5); !errors.Is(err, ErrServiceDraining) {
+		t.Errorf("JoinQueue while draining = %v, want ErrServiceDraining", err)
+	}
+}
+
+func TestFailedGameRequeuesPlayers(t *testing.T) {
+	config := DefaultMatchmakingConfig()
+	config.EnableBotMatches = false
+	config.MatchCheckInterval = 10 * time.Millisecond
+	creator := newTestCreator()
+	creator.failures = 1
+	service := startTestService(t, config, creator)
+
+	alice, bob := uuid.New(), uuid.New()
+	for _, player := range []struct {
+		id   uuid.UUID
+		name string
+	}{{alice, "alice"}, {bob, "bob"}} {
+		if _, err := service.JoinQueue(player.id, player.name, &testConn{player.name}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForEmptyQueue(t, service)
+
+	if creator.gamesOf(alice) != 1 || creator.gamesOf(bob) != 1 {
+		t.Errorf("games %d and %d, want the players matched again after the failure", creator.gamesOf(alice), creator.gamesOf(bob))
+	}
+}
+
+func TestFailedGameRestartsBotTimers(t *testing.T) {
+	config := DefaultMatchmakingConfig()
+	config.BotMatchTimeout = 20 * time.Millisecond
+	creator := newTestCreator()
+	creator.failures = 1
+	// Not started, so expired bot timers wait in botTimeouts
+	service := NewMatchmakingService(context.Background(), config, creator, testBots{}, NewDefaultEventPublisher())
+
+	alice := service.queue.Add(uuid.New(), "alice", 0, PriorityNormal, &testConn{"alice"}, &MatchPreferences{QueueType: models.QueueTypeCasual, AllowBots: true})
+	bob := service.queue.Add(uuid.New(), "bob", 0, PriorityNormal, &testConn{"bob"}, &MatchPreferences{QueueType: models.QueueTypeCasual, AllowBots: true})
+	service.startBotTimer(alice)
+	service.startBotTimer(bob)
+
+	service.createPlayerMatch(alice, bob)
+	if service.queue.GetSize() != 2 || alice.Priority != PriorityRecovery || bob.Priority != PriorityRecovery {
+		t.Fatalf("after the failed game %d players are queued with priorities %v and %v", service.queue.GetSize(), alice.Priority, bob.Priority)
+	}
+
+	timedOut := map[*QueueEntry]bool{}
+	deadline := time.After(time.Second)
+	for len(timedOut) < 2 {
+		select {
+		case entry := <-service.botTimeouts:
+			timedOut[entry] = true
+		case <-deadline:
+			t.Fatal("the requeued players' bot timers never ran out")
+		}
+	}
+}
+
+func TestFailedBotGameIsRetried(t *testing.T) {
+	config := DefaultMatchmakingConfig()
+	config.BotMatchTimeout = 20 * time.Millisecond
+	creator := newTestCreator()
+	creator.failures = 1
+	service := startTestService(t, config, creator)
+
+	playerID := uuid.New()
+	if _, err := service.JoinQueue(playerID, "alice", &testConn{"alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The queue is briefly empty while the first bot game fails, so wait for the game
+	deadline := time.Now().Add(5 * time.Second)
+	for creator.botGames() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the player wasn't given another bot after the bot game failed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if creator.gamesOf(playerID) != 1 || service.GetQueueStats().CurrentSize != 0 {
+		t.Errorf("%d games and %d queued, want one bot game", creator.gamesOf(playerID), service.GetQueueStats().CurrentSize)
+	}
+}
+
+func TestTeamPlayersMatchedFourAtATime(t *testing.T) {
+	config := DefaultMatchmakingConfig()
+	config.MatchCheckInterval = 10 * time.Millisecond
+	creator := newTestCreator()
+	service := startTestService(t, config, creator)
+
+	party := []string{"alice", "bob"}
+	solos := []string{"carol", "dave"}
+	ids := make(map[string]uuid.UUID)
+	for _, name := range append(party, solos...) {
+		ids[name] = uuid.New()
+		preferences := &MatchPreferences{QueueType: models.QueueTypeTeam}
+		if name == "alice" || name == "bob" {
+			preferences.PartyID = "party-1"
+		}
+		if _, err := service.JoinQueue(ids[name], name, &testConn{name}, preferences); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := service.JoinQueue(uuid.New(), "erin", &testConn{"erin"}, &MatchPreferences{QueueType: models.QueueTypeTeam, PartyID: "party-1"}); !errors.Is(err, ErrPartyFull) {
+		t.Errorf("a third party member joined: %v", err)
+	}
+	waitForEmptyQueue(t, service)
+
+	for name, id := range ids {
+		if games := creator.gamesOf(id); games != 1 {
+			t.Errorf("%s was put in %d games, want 1", name, games)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import "database/sql"
+
+// DBStats registers the connection pool statistics returned by stats, such
+// as those of a *sql.DB
+func (r *Registry) DBStats(stats func() sql.DBStats) {
+	r.GaugeFunc("connect_four_db_max_open_connections", "Most connections the pool opens, 0 for no limit",
+		func() float64 { return float64(stats().MaxOpenConnections) })
+	r.GaugeFunc("connect_four_db_open_connections", "Connections open, in use or idle",
+		func() float64 { return float64(stats().OpenConnections) })
+	r.GaugeFunc("connect_four_db_in_use_connections", "Connections in use",
+		func() float64 { return float64(stats().InUse) })
+	r.GaugeFunc("connect_four_db_idle_connections", "Idle connections",
+		func() float64 { return float64(stats().Idle) })
+	r.CounterFunc("connect_four_db_wait_count_total", "Times a query waited for a connection",
+		func() float64 { return float64(stats().WaitCount) })
+	r.CounterFunc("connect_four_db_wait_seconds_total", "Time spent waiting for a connection",
+		func() float64 { return stats().WaitDuration.Seconds() })
+	r.CounterFunc("connect_four_db_closed_max_idle_total", "Connections closed as more than the idle limit",
+		func() float64 { return float64(stats().MaxIdleClosed) })
+	r.CounterFunc("connect_four_db_closed_max_lifetime_total", "Connections closed for reaching their lifetime",
+		func() float64 { return float64(stats().MaxLifetimeClosed) })
+}
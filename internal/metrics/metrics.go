@@ -0,0 +1,123 @@
+// Package metrics serves metrics to Prometheus through client_golang. Most
+// of the services already keep their counts in stats structs, so counters
+// and gauges are read from functions when scraped, and only latencies are
+// observed into histograms.
+package metrics
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Kinds of metric a LabeledFunc can be
+const (
+	KindCounter = prometheus.CounterValue
+	KindGauge   = prometheus.GaugeValue
+)
+
+// Label is a label's name and value
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a metric, told apart from the metric's other
+// samples by its labels
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Registry holds the metrics of a service, along with the Go runtime and
+// process metrics
+type Registry struct {
+	registry *prometheus.Registry
+}
+
+// NewRegistry creates a registry with the Go runtime and process collectors
+func NewRegistry() *Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return &Registry{registry: registry}
+}
+
+// Register adds collectors, such as histograms. A name registered twice is
+// a programming error and panics.
+func (r *Registry) Register(collectors ...prometheus.Collector) {
+	r.registry.MustRegister(collectors...)
+}
+
+// CounterFunc registers a counter read from fn, which must only increase
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, fn))
+}
+
+// GaugeFunc registers a gauge read from fn
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn))
+}
+
+// LabeledFunc registers a counter or gauge with a sample per label set, read
+// from fn
+func (r *Registry) LabeledFunc(name, help string, kind prometheus.ValueType, fn func() []Sample) {
+	r.Register(&sampleCollector{name: name, help: help, kind: kind, samples: fn})
+}
+
+// Gatherer returns what the registry collects, for tests and pushes
+func (r *Registry) Gatherer() prometheus.Gatherer {
+	return r.registry
+}
+
+// Handler serves the registry's metrics to Prometheus
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{ErrorLog: log.Default()})
+}
+
+// DefaultLatencyBuckets cover a millisecond to ten seconds, in seconds
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// NewHistogram creates a histogram with the increasing bucket upper bounds,
+// to be registered with Register
+func NewHistogram(name, help string, buckets []float64) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets})
+}
+
+// NewHistogramVec creates a histogram per value of the label, each created
+// when its value is first observed
+func NewHistogramVec(name, help, label string, buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, []string{label})
+}
+
+// sampleCollector collects the samples of a LabeledFunc. Their labels are
+// only known when read, so it is an unchecked collector and describes nothing.
+type sampleCollector struct {
+	name    string
+	help    string
+	kind    prometheus.ValueType
+	samples func() []Sample
+}
+
+func (c *sampleCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *sampleCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, sample := range c.samples() {
+		names := make([]string, len(sample.Labels))
+		values := make([]string, len(sample.Labels))
+		for i, label := range sample.Labels {
+			names[i], values[i] = label.Name, label.Value
+		}
+		desc := prometheus.NewDesc(c.name, c.help, names, nil)
+		metric, err := prometheus.NewConstMetric(desc, c.kind, sample.Value, values...)
+		if err != nil {
+			metric = prometheus.NewInvalidMetric(desc, err)
+		}
+		ch <- metric
+	}
+}
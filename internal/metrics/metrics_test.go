@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape returns what the registry's handler serves
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	r.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Code != 200 {
+		t.Fatalf("scrape answered %d", recorder.Code)
+	}
+	body, err := io.ReadAll(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func expectLines(t *testing.T, exposition string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(exposition, line+"\n") {
+			t.Errorf("scrape is missing %q", line)
+		}
+	}
+}
+
+func TestRegistryExposition(t *testing.T) {
+	r := NewRegistry()
+	joined := 0.0
+	r.CounterFunc("test_joined_total", "Players who joined", func() float64 { return joined })
+	r.GaugeFunc("test_queue_depth", "Players waiting", func() float64 { return 3 })
+	r.LabeledFunc("test_dropped_total", "Events dropped, by reason", KindCounter, func() []Sample {
+		return []Sample{
+			{Labels: []Label{{Name: "reason", Value: "queue_full"}}, Value: 2},
+			{Labels: []Label{{Name: "reason", Value: `say "hi"`}}, Value: 1},
+		}
+	})
+	latency := NewHistogram("test_publish_seconds", "Time to publish", []float64{0.01, 0.1})
+	latency.Observe(0.005)
+	latency.Observe(0.05)
+	latency.Observe(5)
+	durations := NewHistogramVec("test_query_seconds", "Time queries took", "query", []float64{1})
+	durations.WithLabelValues("SaveGame").Observe(0.5)
+	r.Register(latency, durations)
+
+	// Read when scraped
+	joined = 7
+	expectLines(t, scrape(t, r),
+		"# HELP test_joined_total Players who joined",
+		"# TYPE test_joined_total counter",
+		"test_joined_total 7",
+		"# TYPE test_queue_depth gauge",
+		"test_queue_depth 3",
+		"# TYPE test_dropped_total counter",
+		`test_dropped_total{reason="queue_full"} 2`,
+		`test_dropped_total{reason="say \"hi\""} 1`,
+		"# TYPE test_publish_seconds histogram",
+		`test_publish_seconds_bucket{le="0.01"} 1`,
+		`test_publish_seconds_bucket{le="0.1"} 2`,
+		`test_publish_seconds_bucket{le="+Inf"} 3`,
+		"test_publish_seconds_sum 5.055",
+		"test_publish_seconds_count 3",
+		`test_query_seconds_bucket{query="SaveGame",le="1"} 1`,
+	)
+}
+
+func TestRegistryRuntimeMetrics(t *testing.T) {
+	exposition := scrape(t, NewRegistry())
+	for _, name := range []string{"go_goroutines", "go_memstats_alloc_bytes"} {
+		if !strings.Contains(exposition, "\n"+name+" ") {
+			t.Errorf("scrape is missing %s", name)
+		}
+	}
+}
+
+func TestRegistryDBStats(t *testing.T) {
+	r := NewRegistry()
+	r.DBStats(func() sql.DBStats { return sql.DBStats{MaxOpenConnections: 25, OpenConnections: 4, InUse: 1, Idle: 3} })
+	expectLines(t, scrape(t, r),
+		"connect_four_db_max_open_connections 25",
+		"connect_four_db_in_use_connections 1",
+		"connect_four_db_idle_connections 3",
+	)
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	r := NewRegistry()
+	r.GaugeFunc("test_queue_depth", "Players waiting", func() float64 { return 0 })
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice didn't panic")
+		}
+	}()
+	r.GaugeFunc("test_queue_depth", "Players waiting", func() float64 { return 0 })
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account is a registered player. Its ID is used as the player ID in every
+// game so ratings, stats and match history stay with the account.
+type Account struct {
+	ID           uuid.UUID  `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+}
+
+// GuestClaim summarises a guest player's history merged into an account
+type GuestClaim struct {
+	GuestID           uuid.UUID `json:"guest_id"`
+	GuestNames        []string  `json:"guest_names"` // names the guest played under
+	GamesClaimed      int       `json:"games_claimed"`
+	RatingTransferred bool      `json:"rating_transferred"`
+}
+
+// NameHistory is what has been recorded under a player name. Ratings and
+// stats are kept by name, so a name with history is only registered by the
+// guest who built it.
+type NameHistory struct {
+	PlayerIDs []uuid.UUID `json:"player_ids"` // players who finished games under the name
+	Rated     bool        `json:"rated"`
+}
+
+// Empty reports whether nothing was recorded under the name
+func (h *NameHistory) Empty() bool {
+	return len(h.PlayerIDs) == 0 && !h.Rated
+}
+
+// Ways a player's data can be erased
+const (
+	ErasureAnonymize = "anonymize" // the account stays, its history doesn't
+	ErasureDelete    = "delete"    // the account goes too
+)
+
+// PlayerErasure summarises a player's data erased at their request. Their
+// finished games stay for their opponents under an alias naming nobody.
+type PlayerErasure struct {
+	PlayerName     string    `json:"player_name"`
+	Alias          string    `json:"alias"`
+	GamesRenamed   int       `json:"games_renamed"`
+	AccountDeleted bool      `json:"account_deleted"`
+	ErasedAt       time.Time `json:"erased_at"`
+}
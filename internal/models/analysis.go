@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MoveQuality string
+
+const (
+	MoveQualityBest       MoveQuality = "best"
+	MoveQualityGood       MoveQuality = "good"
+	MoveQualityInaccuracy MoveQuality = "inaccuracy"
+	MoveQualityBlunder    MoveQuality = "blunder"
+)
+
+type MoveAnalysis struct {
+	MoveNumber int         `json:"move_number"`
+	PlayerID   uuid.UUID   `json:"player_id"`
+	Color      PlayerColor `json:"color"`
+	Column     int         `json:"column"`
+	BestColumn int         `json:"best_column"`
+	Quality    MoveQuality `json:"quality"`
+	Solved     bool        `json:"solved"` // true when graded by the perfect-play solver
+	Comment    string      `json:"comment,omitempty"`
+}
+
+type PlayerAnalysisSummary struct {
+	PlayerID   uuid.UUID `json:"player_id"`
+	PlayerName string    `json:"player_name"`
+	Best       int       `json:"best"`
+	Good       int       `json:"good"`
+	Inaccuracy int       `json:"inaccuracy"`
+	Blunder    int       `json:"blunder"`
+	Accuracy   float64   `json:"accuracy"` // Percentage of best/good moves
+}
+
+type GameAnalysis struct {
+	GameID    uuid.UUID               `json:"game_id"`
+	Moves     []MoveAnalysis          `json:"moves"`
+	Players   []PlayerAnalysisSummary `json:"players"`
+	CreatedAt time.Time               `json:"created_at"`
+}
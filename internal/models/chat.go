@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatRole tells players and spectators apart in a game's chat
+type ChatRole string
+
+const (
+	ChatRolePlayer    ChatRole = "player"
+	ChatRoleSpectator ChatRole = "spectator"
+)
+
+// ChatMessage is a message sent to everyone in a game, players and spectators
+type ChatMessage struct {
+	ID         uuid.UUID `json:"id"`
+	GameID     uuid.UUID `json:"game_id"`
+	SenderID   uuid.UUID `json:"sender_id"`
+	SenderName string    `json:"sender_name"`
+	Role       ChatRole  `json:"role"`
+	Text       string    `json:"text"`
+	Filtered   bool      `json:"filtered,omitempty"` // the text was changed by a chat filter
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// Emote is a predefined quick reaction sent to everyone in a game
+type Emote struct {
+	GameID     uuid.UUID `json:"game_id"`
+	SenderID   uuid.UUID `json:"sender_id"`
+	SenderName string    `json:"sender_name"`
+	Role       ChatRole  `json:"role"`
+	Emote      string    `json:"emote"`
+	SentAt     time.Time `json:"sent_at"`
+}
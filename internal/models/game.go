@@ -14,6 +14,29 @@ const (
 	GameStateFinished
 )
 
+func (s GameState) String() string {
+	switch s {
+	case GameStateWaiting:
+		return "waiting"
+	case GameStatePlaying:
+		return "playing"
+	case GameStateFinished:
+		return "finished"
+	default:
+		return "unknown"
+	}
+}
+
+type QueueType string
+
+const (
+	QueueTypeCasual     QueueType = "casual"     // Unrated, bots allowed, relaxed matching
+	QueueTypeRanked     QueueType = "ranked"     // Rated, human opponents only, mandatory turn timer
+	QueueTypePrivate    QueueType = "private"    // Invite-code games between friends, unrated
+	QueueTypeTeam       QueueType = "team"       // 2v2, teammates alternate moves for their color
+	QueueTypeTournament QueueType = "tournament" // scheduled bracket games, unrated
+)
+
 type PlayerColor int
 
 const (
@@ -29,6 +52,7 @@ type Player struct {
 	IsBot    bool        `json:"is_bot"`
 	Connected bool       `json:"connected"`
 	LastSeen time.Time   `json:"last_seen"`
+	LatencyMs int        `json:"latency_ms,omitempty"` // round trip time to the player's device, from heartbeats
 }
 
 type Game struct {
@@ -42,8 +66,27 @@ type Game struct {
 	CreatedAt   time.Time   `json:"created_at"`
 	FinishedAt  *time.Time  `json:"finished_at,omitempty"`
 	LastMove    *Move       `json:"last_move,omitempty"`
+	Moves       []*Move     `json:"moves,omitempty"` // Ordered move history
+	QueueType   QueueType   `json:"queue_type"`
+	TurnTimeLimit int       `json:"turn_time_limit,omitempty"` // seconds per turn, 0 means unlimited
+	TurnStartedAt time.Time `json:"turn_started_at"`
+	Teammates   [2]*Player  `json:"teammates"` // second member of each color in team games
+	Version     int         `json:"version"`   // bumped on every move and when the game ends
+	Paused      bool        `json:"paused,omitempty"` // saved for a server restart, no moves until resumed
+	EndReason   EndReason   `json:"end_reason,omitempty"` // how a finished game ended
 }
 
+// EndReason is how a game finished
+type EndReason string
+
+const (
+	EndReasonConnectFour EndReason = "connect_four" // a player connected four
+	EndReasonBoardFull   EndReason = "board_full"   // drawn on a full board
+	EndReasonDisconnect  EndReason = "disconnect"   // a player didn't return within the grace period
+	EndReasonTurnTimer   EndReason = "turn_timer"   // a player ran out of time to move
+	EndReasonAdmin       EndReason = "admin"        // ended by an admin
+)
+
 type Move struct {
 	PlayerID uuid.UUID   `json:"player_id"`
 	Column   int         `json:"column"`
@@ -70,6 +113,131 @@ type WinResult struct {
 	GameState  *Game   `json:"game_state"`
 }
 
+// Delta describes the game's latest change for clients holding the previous version
+func (g *Game) Delta(move *Move) *GameDeltaPayload {
+	return &GameDeltaPayload{
+		GameID:            g.ID,
+		Version:           g.Version,
+		Move:              move,
+		State:             g.State,
+		CurrentTurn:       g.CurrentTurn,
+		CurrentTurnNumber: g.CurrentTurnNumber,
+		TurnStartedAt:     g.TurnStartedAt,
+		Winner:            g.Winner,
+		FinishedAt:        g.FinishedAt,
+		PlayerLatencies:   g.PlayerLatencies(),
+		Paused:            g.Paused,
+	}
+}
+
+// PlayerLatencies maps the players with a measured latency to it in milliseconds
+func (g *Game) PlayerLatencies() map[uuid.UUID]int {
+	var latencies map[uuid.UUID]int
+	for _, player := range g.AllPlayers() {
+		if player.LatencyMs == 0 {
+			continue
+		}
+		if latencies == nil {
+			latencies = make(map[uuid.UUID]int)
+		}
+		latencies[player.ID] = player.LatencyMs
+	}
+	return latencies
+}
+
+// GameEvents lists the changes to a game after a version, for clients that
+// poll instead of holding a WebSocket. Version is the game's current version.
+// When Complete is false the earliest changes are missing and the client
+// should fetch the whole game.
+type GameEvents struct {
+	GameID   uuid.UUID           `json:"game_id"`
+	Version  int                 `json:"version"`
+	Events   []*GameDeltaPayload `json:"events"`
+	Complete bool                `json:"complete"`
+}
+
+// Clone returns a deep copy of the game, sharing nothing with it, for use
+// outside the lock that guards the game
+func (g *Game) Clone() *Game {
+	clone := *g
+	for i, player := range g.Players {
+		clone.Players[i] = player.clone()
+	}
+	for i, player := range g.Teammates {
+		clone.Teammates[i] = player.clone()
+	}
+	if g.Winner != nil {
+		winner := *g.Winner
+		clone.Winner = &winner
+	}
+	if g.FinishedAt != nil {
+		finishedAt := *g.FinishedAt
+		clone.FinishedAt = &finishedAt
+	}
+	if g.LastMove != nil {
+		lastMove := *g.LastMove
+		clone.LastMove = &lastMove
+	}
+	if g.Moves != nil {
+		clone.Moves = make([]*Move, len(g.Moves))
+		for i, move := range g.Moves {
+			moveCopy := *move
+			clone.Moves[i] = &moveCopy
+		}
+	}
+	return &clone
+}
+
+func (p *Player) clone() *Player {
+	if p == nil {
+		return nil
+	}
+	clone := *p
+	return &clone
+}
+
+// IsTeamGame reports whether each color is played by a team of two
+func (g *Game) IsTeamGame() bool {
+	return g.Teammates[0] != nil && g.Teammates[1] != nil
+}
+
+// AllPlayers returns every player in the game, including teammates
+func (g *Game) AllPlayers() []*Player {
+	players := make([]*Player, 0, 4)
+	for _, player := range g.Players {
+		if player != nil {
+			players = append(players, player)
+		}
+	}
+	for _, player := range g.Teammates {
+		if player != nil {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+// PlayerToMove returns the player due to make the next move. In team games
+// the members of each team take turns playing their color.
+func (g *Game) PlayerToMove() *Player {
+	color := g.CurrentTurn
+	if !g.IsTeamGame() {
+		return g.Players[color]
+	}
+
+	colorMoves := 0
+	for _, move := range g.Moves {
+		if move.Color == color {
+			colorMoves++
+		}
+	}
+
+	if colorMoves%2 == 1 {
+		return g.Teammates[color]
+	}
+	return g.Players[color]
+}
+
 // Board methods
 func (g *Game) IsValidMove(column int) bool {
 	if column < 0 || column >= 7 {
@@ -160,6 +328,40 @@ func (g *Game) checkLine(startRow, startCol, deltaRow, deltaCol, player int) boo
 	return true
 }
 
+// Ways a game is won, see WinType
+const (
+	WinTypeHorizontal       = "horizontal"
+	WinTypeVertical         = "vertical"
+	WinTypeDiagonalPositive = "diagonal_positive" // rising to the right
+	WinTypeDiagonalNegative = "diagonal_negative" // falling to the right
+	WinTypeForfeit          = "forfeit"
+)
+
+// WinType returns the direction of the winner's four in a row, or forfeit
+// when the board has none. It is empty for a game without a winner.
+func (g *Game) WinType() string {
+	if g.Winner == nil {
+		return ""
+	}
+
+	player := int(*g.Winner) + 1
+	for row := 0; row < 6; row++ {
+		for col := 0; col < 7; col++ {
+			switch {
+			case g.checkLine(row, col, 0, 1, player):
+				return WinTypeHorizontal
+			case g.checkLine(row, col, 1, 0, player):
+				return WinTypeVertical
+			case g.checkLine(row, col, 1, -1, player):
+				return WinTypeDiagonalPositive
+			case g.checkLine(row, col, 1, 1, player):
+				return WinTypeDiagonalNegative
+			}
+		}
+	}
+	return WinTypeForfeit
+}
+
 func (g *Game) IsBoardFull() bool {
 	for col := 0; col < 7; col++ {
 		if g.Board[0][col] == 0 {
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// QueuePenalty tracks how often a player abandoned games and how long they are kept out of the queue
+type QueuePenalty struct {
+	PlayerName    string    `json:"player_name"`
+	Offenses      int       `json:"offenses"`
+	LastOffenseAt time.Time `json:"last_offense_at"`
+	BannedUntil   time.Time `json:"banned_until"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QueuedPlayer is a matchmaking queue entry saved across server restarts
+type QueuedPlayer struct {
+	PlayerID    uuid.UUID `json:"player_id"`
+	PlayerName  string    `json:"player_name"`
+	JoinedAt    time.Time `json:"joined_at"`
+	QueueType   QueueType `json:"queue_type"`
+	PartyID     string    `json:"party_id,omitempty"`
+	AllowBots   bool      `json:"allow_bots"`
+	SkillLevel  int       `json:"skill_level"`
+	MaxWaitTime int       `json:"max_wait_time"`
+	Rating      int       `json:"rating"`
+	Priority    int       `json:"priority"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+type PlayerRating struct {
+	PlayerName  string    `json:"player_name"`
+	Rating      float64   `json:"rating"`
+	PeakRating  float64   `json:"peak_rating"`
+	GamesPlayed int       `json:"games_played"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type RatingChange struct {
+	PlayerName string  `json:"player_name"`
+	OldRating  float64 `json:"old_rating"`
+	NewRating  float64 `json:"new_rating"`
+	Delta      float64 `json:"delta"`
+}
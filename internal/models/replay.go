@@ -0,0 +1,175 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReplayFormat identifies replay documents, ReplayFormatVersion changes when
+// their layout does
+const (
+	ReplayFormat        = "connect-four-replay"
+	ReplayFormatVersion = 1
+)
+
+// Replay is a self-contained record of a finished game, enough to play it
+// back without the server. Notation is the compact move string: the column of
+// every move in order, counted from 1.
+type Replay struct {
+	Format     string         `json:"format"`
+	Version    int            `json:"version"`
+	GameID     uuid.UUID      `json:"game_id"`
+	Settings   ReplaySettings `json:"settings"`
+	Players    []ReplayPlayer `json:"players"`
+	Moves      []ReplayMove   `json:"moves"`
+	Result     ReplayResult   `json:"result"`
+	Notation   string         `json:"notation"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+}
+
+type ReplaySettings struct {
+	Rows          int       `json:"rows"`
+	Columns       int       `json:"columns"`
+	QueueType     QueueType `json:"queue_type"`
+	TurnTimeLimit int       `json:"turn_time_limit,omitempty"` // seconds per turn
+	TeamGame      bool      `json:"team_game,omitempty"`
+}
+
+type ReplayPlayer struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Color string    `json:"color"` // "red" moves first
+	IsBot bool      `json:"is_bot"`
+}
+
+type ReplayMove struct {
+	Number    int       `json:"number"` // from 1
+	PlayerID  uuid.UUID `json:"player_id"`
+	Color     string    `json:"color"`
+	Column    int       `json:"column"` // from 0, like make_move
+	Row       int       `json:"row"`
+	PlayedAt  time.Time `json:"played_at"`
+	ThinkTime int64     `json:"think_time_ms"` // since the previous move or the start
+}
+
+type ReplayResult struct {
+	Winner   string     `json:"winner,omitempty"` // color, empty for a draw
+	WinnerID *uuid.UUID `json:"winner_id,omitempty"`
+	IsDraw   bool       `json:"is_draw"`
+	Method   string     `json:"method"` // "four_in_a_row", "board_full" or "forfeit"
+}
+
+// colorName is how replays write a color
+func colorName(color PlayerColor) string {
+	if color == PlayerRed {
+		return "red"
+	}
+	return "yellow"
+}
+
+// Replay records a finished game as a replay document
+func (g *Game) Replay() *Replay {
+	replay := &Replay{
+		Format:  ReplayFormat,
+		Version: ReplayFormatVersion,
+		GameID:  g.ID,
+		Settings: ReplaySettings{
+			Rows:          len(g.Board),
+			Columns:       len(g.Board[0]),
+			QueueType:     g.QueueType,
+			TurnTimeLimit: g.TurnTimeLimit,
+			TeamGame:      g.IsTeamGame(),
+		},
+		Players:   make([]ReplayPlayer, 0, 4),
+		Moves:     make([]ReplayMove, 0, len(g.Moves)),
+		StartedAt: g.CreatedAt,
+	}
+	if g.FinishedAt != nil {
+		replay.FinishedAt = *g.FinishedAt
+	}
+
+	for _, player := range g.AllPlayers() {
+		replay.Players = append(replay.Players, ReplayPlayer{
+			ID:    player.ID,
+			Name:  player.Name,
+			Color: colorName(player.Color),
+			IsBot: player.IsBot,
+		})
+	}
+
+	var notation strings.Builder
+	previous := g.CreatedAt
+	for i, move := range g.Moves {
+		replay.Moves = append(replay.Moves, ReplayMove{
+			Number:    i + 1,
+			PlayerID:  move.PlayerID,
+			Color:     colorName(move.Color),
+			Column:    move.Column,
+			Row:       move.Row,
+			PlayedAt:  move.Timestamp,
+			ThinkTime: move.Timestamp.Sub(previous).Milliseconds(),
+		})
+		previous = move.Timestamp
+		notation.WriteString(fmt.Sprint(move.Column + 1))
+	}
+	replay.Notation = notation.String()
+
+	switch {
+	case g.Winner != nil && g.CheckWinner() != nil:
+		replay.Result.Method = "four_in_a_row"
+	case g.Winner == nil && g.IsBoardFull():
+		replay.Result.Method = "board_full"
+	default:
+		replay.Result.Method = "forfeit"
+	}
+
+	if g.Winner == nil {
+		replay.Result.IsDraw = true
+	} else {
+		replay.Result.Winner = colorName(*g.Winner)
+		if winner := g.Players[*g.Winner]; winner != nil {
+			replay.Result.WinnerID = &winner.ID
+		}
+	}
+
+	return replay
+}
+
+// Text writes the replay in the compact text notation: tag lines for the
+// players and result, followed by the move string
+func (r *Replay) Text() string {
+	var text strings.Builder
+
+	tag := func(name, value string) {
+		fmt.Fprintf(&text, "[%s %q]\n", name, value)
+	}
+	tag("Game", r.GameID.String())
+	tag("Date", r.StartedAt.UTC().Format("2006-01-02"))
+	tag("Queue", string(r.Settings.QueueType))
+	for _, player := range r.Players {
+		name := "Yellow"
+		if player.Color == "red" {
+			name = "Red"
+		}
+		tag(name, player.Name)
+	}
+
+	result := "1/2-1/2"
+	switch r.Result.Winner {
+	case "red":
+		result = "1-0"
+	case "yellow":
+		result = "0-1"
+	}
+	tag("Result", result)
+	tag("Method", r.Result.Method)
+
+	text.WriteString("\n")
+	text.WriteString(r.Notation)
+	text.WriteString("\n")
+	return text.String()
+}
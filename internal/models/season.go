@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// Season is a stretch of rated play. When it ends its standings are kept and
+// ratings are pulled back toward the initial rating for the next one.
+type Season struct {
+	Number    int        `json:"number"`
+	StartedAt time.Time  `json:"started_at"`
+	EndsAt    time.Time  `json:"ends_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// SeasonReward is earned by finishing a season at or above a rating, with at
+// least a number of rated games played in it
+type SeasonReward struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	MinRating   float64 `json:"min_rating"`
+	MinGames    int     `json:"min_games"`
+}
+
+// SeasonStanding is where a player finished a season
+type SeasonStanding struct {
+	Season      int     `json:"season"`
+	Rank        int     `json:"rank"`
+	PlayerName  string  `json:"player_name"`
+	Rating      float64 `json:"rating"`
+	GamesPlayed int     `json:"games_played"`     // rated games in the season
+	Reward      string  `json:"reward,omitempty"` // the best reward earned
+}
+
+// RatingReset pulls every rating toward a rating, keeping a share of the
+// distance from it
+type RatingReset struct {
+	Toward    float64 `json:"toward"`
+	Carryover float64 `json:"carryover"`
+}
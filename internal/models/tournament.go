@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TournamentFormat string
+
+const (
+	TournamentSingleElimination TournamentFormat = "single_elimination"
+	TournamentSwiss             TournamentFormat = "swiss"       // rating-aware pairings between players on similar scores
+	TournamentRoundRobin        TournamentFormat = "round_robin" // everyone plays everyone once
+)
+
+type TournamentStatus string
+
+const (
+	TournamentRegistration TournamentStatus = "registration"
+	TournamentInProgress   TournamentStatus = "in_progress"
+	TournamentFinished     TournamentStatus = "finished"
+	TournamentCancelled    TournamentStatus = "cancelled"
+)
+
+type TournamentMatchStatus string
+
+const (
+	TournamentMatchPending  TournamentMatchStatus = "pending" // waiting for players from earlier rounds
+	TournamentMatchPlaying  TournamentMatchStatus = "playing"
+	TournamentMatchFinished TournamentMatchStatus = "finished"
+)
+
+type Tournament struct {
+	ID          uuid.UUID             `json:"id"`
+	Name        string                `json:"name"`
+	Format      TournamentFormat      `json:"format"`
+	Status      TournamentStatus      `json:"status"`
+	MaxPlayers  int                   `json:"max_players"`
+	Players     []*TournamentPlayer   `json:"players"`
+	Rounds      []*TournamentRound    `json:"rounds,omitempty"`
+	TotalRounds int                   `json:"total_rounds,omitempty"` // known once the tournament starts
+	Standings   []*TournamentStanding `json:"standings,omitempty"`    // Swiss and round-robin only
+	MinRating   int                   `json:"min_rating,omitempty"`   // entry requirements, 0 for no limit
+	MaxRating   int                   `json:"max_rating,omitempty"`
+	Schedule    string                `json:"schedule,omitempty"`  // recurring schedule that created the tournament
+	StartsAt    *time.Time            `json:"starts_at,omitempty"` // when a scheduled tournament starts
+	WinnerID    *uuid.UUID            `json:"winner_id,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+	StartedAt   *time.Time            `json:"started_at,omitempty"`
+	FinishedAt  *time.Time            `json:"finished_at,omitempty"`
+}
+
+type TournamentPlayer struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	Seed       int       `json:"seed,omitempty"` // 1 is the top seed, assigned when the tournament starts
+	Eliminated bool      `json:"eliminated"`
+}
+
+type TournamentRound struct {
+	Number  int                `json:"number"` // 1-based
+	Matches []*TournamentMatch `json:"matches"`
+}
+
+type TournamentMatch struct {
+	ID       uuid.UUID             `json:"id"`
+	Round    int                   `json:"round"`
+	Slot     int                   `json:"slot"`              // position within the round, top to bottom
+	Player1  *TournamentPlayer     `json:"player1,omitempty"` // nil until decided by an earlier round
+	Player2  *TournamentPlayer     `json:"player2,omitempty"`
+	Status   TournamentMatchStatus `json:"status"`
+	GameID   *uuid.UUID            `json:"game_id,omitempty"` // latest game, elimination draws are replayed
+	WinnerID *uuid.UUID            `json:"winner_id,omitempty"`
+	Draw     bool                  `json:"draw"` // Swiss and round-robin games can be drawn
+	Bye      bool                  `json:"bye"`  // player advanced or sat out without an opponent
+	Replays  int                   `json:"replays"`
+}
+
+// TournamentStanding is a player's score in a Swiss or round-robin tournament.
+// Wins count 1 point and draws half a point.
+type TournamentStanding struct {
+	Rank            int       `json:"rank"`
+	PlayerID        uuid.UUID `json:"player_id"`
+	Name            string    `json:"name"`
+	Score           float64   `json:"score"`
+	Wins            int       `json:"wins"`
+	Draws           int       `json:"draws"`
+	Losses          int       `json:"losses"`
+	Buchholz        float64   `json:"buchholz"`         // sum of the opponents' scores
+	SonnebornBerger float64   `json:"sonneborn_berger"` // scores of beaten opponents plus half of drawn ones
+}
+
+// ScheduledTournament is the next occurrence of a recurring tournament
+type ScheduledTournament struct {
+	Schedule            string           `json:"schedule"`
+	Format              TournamentFormat `json:"format"`
+	MaxPlayers          int              `json:"max_players"`
+	MinRating           int              `json:"min_rating,omitempty"`
+	MaxRating           int              `json:"max_rating,omitempty"`
+	RegistrationOpensAt time.Time        `json:"registration_opens_at"`
+	StartsAt            time.Time        `json:"starts_at"`
+	TournamentID        *uuid.UUID       `json:"tournament_id,omitempty"` // set once registration is open
+}
+
+// GetPlayer returns the registered player with the given ID
+func (t *Tournament) GetPlayer(playerID uuid.UUID) *TournamentPlayer {
+	for _, player := range t.Players {
+		if player.ID == playerID {
+			return player
+		}
+	}
+	return nil
+}
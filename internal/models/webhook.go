@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook is a URL registered to receive events. The secret signs every
+// delivery and is only shown when the webhook is registered.
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDeadLetter is a delivery that failed every attempt
+type WebhookDeadLetter struct {
+	ID        uuid.UUID       `json:"id"`
+	WebhookID uuid.UUID       `json:"webhook_id"`
+	URL       string          `json:"url"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
@@ -9,12 +9,23 @@ type MessageType string
 
 const (
 	// Client messages
-	MsgJoinQueue    MessageType = "join_queue"
-	MsgLeaveQueue   MessageType = "leave_queue"
-	MsgMakeMove     MessageType = "make_move"
-	MsgReconnect    MessageType = "reconnect"
-	MsgHeartbeat    MessageType = "heartbeat"
-	MsgGetGameState MessageType = "get_game_state"
+	MsgJoinQueue         MessageType = "join_queue"
+	MsgLeaveQueue        MessageType = "leave_queue"
+	MsgMakeMove          MessageType = "make_move"
+	MsgReconnect         MessageType = "reconnect"
+	MsgHeartbeat         MessageType = "heartbeat"
+	MsgGetGameState      MessageType = "get_game_state"
+	MsgCreatePrivateGame MessageType = "create_private_game"
+	MsgJoinPrivateGame   MessageType = "join_private_game"
+	MsgQueueStatus       MessageType = "queue_status" // also sent by the server with the current status
+	MsgJoinTournament    MessageType = "join_tournament"
+	MsgLeaveTournament   MessageType = "leave_tournament"
+	MsgGetTournament     MessageType = "get_tournament"
+	MsgSpectateGame      MessageType = "spectate_game"
+	MsgStopSpectating    MessageType = "stop_spectating"
+	MsgChat              MessageType = "chat"  // also sent by the server with each message
+	MsgEmote             MessageType = "emote" // also sent by the server with each emote
+	MsgTakeControl       MessageType = "take_control"
 
 	// Server messages
 	MsgGameFound          MessageType = "game_found"
@@ -30,6 +41,18 @@ const (
 	MsgReconnectSuccess   MessageType = "reconnect_success"
 	MsgPlayerDisconnected MessageType = "player_disconnected"
 	MsgPlayerReconnected  MessageType = "player_reconnected"
+	MsgPrivateGameCreated MessageType = "private_game_created"
+	MsgQueueUpdate        MessageType = "queue_update"
+	MsgTournamentUpdate   MessageType = "tournament_update"
+	MsgTournamentAnnounce MessageType = "tournament_announce"
+	MsgSession            MessageType = "session"
+	MsgSpectating         MessageType = "spectating"
+	MsgGameDelta          MessageType = "game_delta"
+	MsgServerShutdown     MessageType = "server_shutdown"
+	MsgServerDraining     MessageType = "server_draining"
+	MsgControlChanged     MessageType = "control_changed"
+	MsgAnnouncement       MessageType = "announcement"
+	MsgDisconnectTimer    MessageType = "disconnect_countdown"
 )
 
 type WSMessage struct {
@@ -41,25 +64,151 @@ type WSMessage struct {
 
 // Payload structs for different message types
 type JoinQueuePayload struct {
+	PlayerName  string `json:"player_name"`
+	QueueType   string `json:"queue_type,omitempty"` // "casual" (default), "ranked" or "team"
+	PartyID     string `json:"party_id,omitempty"`   // shared by two friends queueing together for team games
+	AllowBots   *bool  `json:"allow_bots,omitempty"` // false waits for a human opponent only
+	SkillLevel  int    `json:"skill_level,omitempty"`
+	MaxWaitTime int    `json:"max_wait_time,omitempty"` // seconds before a bot match, 0 uses the server default
+}
+
+type CreatePrivateGamePayload struct {
 	PlayerName string `json:"player_name"`
 }
 
+type JoinPrivateGamePayload struct {
+	PlayerName string `json:"player_name"`
+	Code       string `json:"code"`
+}
+
+type PrivateGameCreatedPayload struct {
+	Code      string    `json:"code"`
+	PlayerID  uuid.UUID `json:"player_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type QueueStatusPayload struct {
+	PlayerID             uuid.UUID `json:"player_id"`
+	QueueType            string    `json:"queue_type"`
+	Position             int       `json:"position"`
+	QueueSize            int       `json:"queue_size"`
+	WaitedSeconds        int       `json:"waited_seconds"`
+	EstimatedWaitSeconds int       `json:"estimated_wait_seconds"` // 0 when unknown
+}
+
+type JoinTournamentPayload struct {
+	TournamentID uuid.UUID `json:"tournament_id"`
+	PlayerName   string    `json:"player_name"`
+}
+
+// TournamentPayload identifies the tournament for leave and get requests
+type TournamentPayload struct {
+	TournamentID uuid.UUID `json:"tournament_id"`
+}
+
+type TournamentUpdatePayload struct {
+	Tournament *Tournament `json:"tournament"`
+}
+
+// TournamentAnnouncePayload is sent to every connected player when a
+// scheduled tournament opens registration
+type TournamentAnnouncePayload struct {
+	Tournament *Tournament `json:"tournament"`
+}
+
 type MakeMovePayload struct {
 	GameID uuid.UUID `json:"game_id"`
 	Column int       `json:"column"`
 }
 
 type ReconnectPayload struct {
-	GameID   uuid.UUID `json:"game_id"`
+	GameID   uuid.UUID `json:"game_id"` // empty to reconnect to a queue spot after a server restart, or to the game being played
 	PlayerID uuid.UUID `json:"player_id"`
+	Token    string    `json:"token"` // session token issued to the player
 	Username string    `json:"username"`
 	LastSeen time.Time `json:"last_seen,omitempty"`
 }
 
+// SessionPayload carries the session token issued once the server assigns a
+// player ID. It is required to reconnect and for REST calls.
+type SessionPayload struct {
+	PlayerID  uuid.UUID `json:"player_id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	TraceID   string    `json:"trace_id"` // pass back as ?trace_id= when reconnecting
+}
+
+// SpectateGamePayload starts watching a game. Logged in spectators chat as
+// their account, guests under the given name.
+type SpectateGamePayload struct {
+	GameID     uuid.UUID `json:"game_id"`
+	PlayerName string    `json:"player_name,omitempty"`
+}
+
+// SpectatingPayload catches a new spectator up with the game and its chat
+type SpectatingPayload struct {
+	GameState   *Game          `json:"game_state"`
+	ChatHistory []*ChatMessage `json:"chat_history"`
+}
+
+// ChatPayload is a chat message sent by a player or spectator of the game.
+// The server broadcasts it as a ChatMessage.
+type ChatPayload struct {
+	GameID uuid.UUID `json:"game_id"`
+	Text   string    `json:"text"`
+}
+
+// EmotePayload sends one of the predefined emotes to a game
+type EmotePayload struct {
+	GameID uuid.UUID `json:"game_id"`
+	Emote  string    `json:"emote"`
+}
+
 type GetGameStatePayload struct {
 	GameID uuid.UUID `json:"game_id"`
 }
 
+// GameStatePayload answers get_game_state, which clients also send to resync
+// after missing a delta
+type GameStatePayload struct {
+	GameState *Game `json:"game_state"`
+}
+
+// GameDeltaPayload is broadcast after every move instead of the whole game.
+// Clients apply it to version Version-1 of the game and ask for the full
+// state with get_game_state when they find a gap.
+type GameDeltaPayload struct {
+	GameID            uuid.UUID    `json:"game_id"`
+	Version           int          `json:"version"`
+	Move              *Move        `json:"move"`
+	State             GameState    `json:"state"`
+	CurrentTurn       PlayerColor  `json:"current_turn"`
+	CurrentTurnNumber int          `json:"current_turn_number"`
+	TurnStartedAt     time.Time    `json:"turn_started_at"`
+	Winner            *PlayerColor `json:"winner,omitempty"`
+	FinishedAt        *time.Time   `json:"finished_at,omitempty"`
+	PlayerLatencies   map[uuid.UUID]int `json:"player_latencies,omitempty"` // milliseconds, by player ID
+	Paused            bool         `json:"paused,omitempty"`
+}
+
+// ServerShutdownPayload is sent to every client before the server restarts.
+// Games in progress are paused and saved; players reconnect with their
+// session token once the server is back and have the grace period to do so.
+type ServerShutdownPayload struct {
+	Message               string `json:"message"`
+	ReconnectAfterSeconds int    `json:"reconnect_after_seconds"`
+	GracePeriodSeconds    int    `json:"grace_period_seconds"`
+	GamePaused            bool   `json:"game_paused"` // the client's game was saved
+}
+
+// ServerDrainingPayload is sent to every client when the server stops taking
+// new games ahead of a restart. Games in progress are played out until the
+// deadline, those still going then are paused and saved as on shutdown.
+type ServerDrainingPayload struct {
+	Message  string     `json:"message"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
 type GameFoundPayload struct {
 	Game     *Game     `json:"game"`
 	PlayerID uuid.UUID `json:"player_id"`
@@ -95,15 +244,53 @@ type BotMovePayload struct {
 	Move       *Move     `json:"move"`
 	Reasoning  string    `json:"reasoning"`
 	Confidence int       `json:"confidence"`
-	GameState  *Game     `json:"game_state"`
+	GameState  *Game     `json:"game_state,omitempty"` // the move itself arrives as a game_delta
 }
 
 type ReconnectSuccessPayload struct {
-	GameID         uuid.UUID `json:"game_id"`
-	PlayerID       uuid.UUID `json:"player_id"`
-	GameState      *Game     `json:"game_state"`
-	QueuedMessages int       `json:"queued_messages"`
-	Message        string    `json:"message"`
+	GameID         uuid.UUID      `json:"game_id"`
+	PlayerID       uuid.UUID      `json:"player_id"`
+	GameState      *Game          `json:"game_state"`
+	QueuedMessages int            `json:"queued_messages"`
+	ChatHistory    []*ChatMessage `json:"chat_history"`
+	Message        string         `json:"message"`
+	ReadOnly       bool           `json:"read_only"` // another of the player's devices controls the game
+}
+
+// HeartbeatPayload is optional. ClientTime, in milliseconds since the epoch,
+// is echoed in the acknowledgement so the client can time the round trip too.
+type HeartbeatPayload struct {
+	ClientTime int64 `json:"client_time,omitempty"`
+}
+
+// HeartbeatAckPayload answers a heartbeat with the latency the server measured
+// to the connection
+type HeartbeatAckPayload struct {
+	ServerTime   time.Time `json:"server_time"`
+	ConnectionID string    `json:"connection_id"`
+	ClientTime   int64     `json:"client_time,omitempty"`
+	LatencyMs    int       `json:"latency_ms"`
+}
+
+// AnnouncementPayload is a message from the operators to every connected player
+type AnnouncementPayload struct {
+	Message string    `json:"message"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// TakeControlPayload asks for one of the player's read-only devices to
+// control their game instead of the device playing it now
+type TakeControlPayload struct {
+	GameID uuid.UUID `json:"game_id"`
+}
+
+// ControlChangedPayload tells a device whether it now controls the player's
+// game or follows it read-only
+type ControlChangedPayload struct {
+	GameID     uuid.UUID `json:"game_id"`
+	PlayerID   uuid.UUID `json:"player_id"`
+	Controller bool      `json:"controller"`
+	Message    string    `json:"message"`
 }
 
 type PlayerDisconnectedPayload struct {
@@ -113,6 +300,17 @@ type PlayerDisconnectedPayload struct {
 	GameState            string    `json:"game_state"`
 	MoveNumber           int       `json:"move_number"`
 	GracePeriodSeconds   int       `json:"grace_period_seconds"`
+	ReconnectDeadline    time.Time `json:"reconnect_deadline"`
+	Adjudication         string    `json:"adjudication"` // "win", "draw" or "pause" once the grace period runs out
+}
+
+// DisconnectCountdownPayload counts down a disconnected player's grace
+// period for the players still connected
+type DisconnectCountdownPayload struct {
+	GameID           uuid.UUID `json:"game_id"`
+	Player           *Player   `json:"player"`
+	RemainingSeconds int       `json:"remaining_seconds"`
+	Adjudication     string    `json:"adjudication"`
 }
 
 type PlayerReconnectedPayload struct {
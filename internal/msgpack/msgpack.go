@@ -0,0 +1,333 @@
+// Package msgpack encodes and decodes MessagePack for the values JSON
+// decodes into: nil, bool, numbers, strings, []interface{} and
+// map[string]interface{}. The WebSocket binary protocol converts messages
+// through JSON, so the JSON tags on the models are the schema for both.
+package msgpack
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MaxDepth is how deeply arrays and maps may nest in decoded data. Messages
+// come from clients, and each level of nesting takes a level of recursion.
+const MaxDepth = 64
+
+var (
+	ErrTruncated   = errors.New("msgpack: data is truncated")
+	ErrUnsupported = errors.New("msgpack: unsupported type")
+	ErrTooDeep     = errors.New("msgpack: data is nested too deeply")
+)
+
+// Encode encodes a JSON-like value. Numbers may be json.Number, float64 or int.
+func Encode(v interface{}) ([]byte, error) {
+	return appendValue(nil, v)
+}
+
+// Decode decodes a single value. Integers decode as int64, floats as float64,
+// maps must have string keys. Arrays and maps nest at most MaxDepth levels.
+func Decode(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("msgpack: %d trailing bytes", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+func appendValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendInt(b, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("msgpack: invalid number %q", v)
+		}
+		return appendFloat(b, f), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return appendInt(b, int64(v)), nil
+		}
+		return appendFloat(b, v), nil
+	case int:
+		return appendInt(b, int64(v)), nil
+	case int64:
+		return appendInt(b, v), nil
+	case string:
+		return appendString(b, v), nil
+	case []interface{}:
+		b = appendLength(b, len(v), 0x90, 0xdc, 0xdd)
+		for _, item := range v {
+			var err error
+			if b, err = appendValue(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		// Sorted so equal messages encode identically
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b = appendLength(b, len(v), 0x80, 0xde, 0xdf)
+		for _, key := range keys {
+			b = appendString(b, key)
+			var err error
+			if b, err = appendValue(b, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupported, v)
+	}
+}
+
+func appendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(int32(i)))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func appendFloat(b []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+}
+
+func appendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendLength writes an array or map header using its fix, 16 and 32 bit forms
+func appendLength(b []byte, n int, fix, code16, code32 byte) []byte {
+	switch {
+	case n <= 15:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+	}
+}
+
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int // arrays and maps open around the value being decoded
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, ErrTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *decoder) value() (interface{}, error) {
+	header, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	code := header[0]
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xe0 == 0xa0:
+		return d.string(int(code & 0x1f))
+	case code&0xf0 == 0x90:
+		return d.array(int(code & 0x0f))
+	case code&0xf0 == 0x80:
+		return d.object(int(code & 0x0f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (code - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u > math.MaxInt64 {
+			return float64(u), nil
+		}
+		return int64(u), nil
+	case 0xd0:
+		u, err := d.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return int64(u), err
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		// Strings and binary both decode as strings
+		size := 1 << (code - 0xd9)
+		if code <= 0xc6 {
+			size = 1 << (code - 0xc4)
+		}
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		return d.string(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(int(n))
+	default:
+		return nil, fmt.Errorf("%w: code 0x%02x", ErrUnsupported, code)
+	}
+}
+
+func (d *decoder) string(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *decoder) array(n int) (interface{}, error) {
+	// Every item takes at least a byte, so a bogus length fails here
+	if n > len(d.data)-d.pos {
+		return nil, ErrTruncated
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
+	items := make([]interface{}, n)
+	for i := range items {
+		item, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func (d *decoder) object(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, ErrTruncated
+	}
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+
+	object := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: map key %T", ErrUnsupported, key)
+		}
+		if object[name], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	return object, nil
+}
+
+// enter opens an array or map, failing past MaxDepth
+func (d *decoder) enter() error {
+	if d.depth >= MaxDepth {
+		return ErrTooDeep
+	}
+	d.depth++
+	return nil
+}
+
+func (d *decoder) leave() {
+	d.depth--
+}
@@ -0,0 +1,135 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	values := []interface{}{
+		nil,
+		true,
+		false,
+		int64(0),
+		int64(127),
+		int64(-32),
+		int64(-129),
+		int64(70000),
+		int64(-1 << 40),
+		1.5,
+		"",
+		"connect four",
+		string(bytes.Repeat([]byte("x"), 300)),
+		[]interface{}{int64(1), "two", nil},
+		map[string]interface{}{"type": "make_move", "column": int64(3)},
+		map[string]interface{}{"board": []interface{}{[]interface{}{int64(0), int64(1)}}},
+	}
+
+	for _, value := range values {
+		data, err := Encode(value)
+		if err != nil {
+			t.Fatalf("Encode(%#v): %v", value, err)
+		}
+		decoded, err := Decode(data)
+		if err != nil {
+			t.Fatalf("Decode(Encode(%#v)): %v", value, err)
+		}
+		if !reflect.DeepEqual(decoded, value) {
+			t.Errorf("round trip of %#v gave %#v", value, decoded)
+		}
+	}
+}
+
+func TestEncodeJSONNumbers(t *testing.T) {
+	var message interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(`{"column": 3, "rating": 1512.5}`)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&message); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Encode(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"column": int64(3), "rating": 1512.5}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("got %#v, want %#v", decoded, want)
+	}
+}
+
+func TestEncodeSortsKeys(t *testing.T) {
+	// Equal maps encode to the same bytes whatever their iteration order
+	first, _ := Encode(map[string]interface{}{"a": int64(1), "b": int64(2), "c": int64(3)})
+	second, _ := Encode(map[string]interface{}{"c": int64(3), "a": int64(1), "b": int64(2)})
+	if !bytes.Equal(first, second) {
+		t.Errorf("equal maps encoded differently: %x and %x", first, second)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrTruncated},
+		{"truncated string", []byte{0xa5, 'a', 'b'}, ErrTruncated},
+		{"array longer than the data", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, ErrTruncated},
+		{"map longer than the data", []byte{0xdf, 0xff, 0xff, 0xff, 0xff}, ErrTruncated},
+		{"integer map key", []byte{0x81, 0x01, 0x02}, ErrUnsupported},
+		{"extension type", []byte{0xd4, 0x01, 0x02}, ErrUnsupported},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Decode(test.data); !errors.Is(err, test.want) {
+				t.Errorf("Decode(%x) = %v, want %v", test.data, err, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeTrailingBytes(t *testing.T) {
+	if _, err := Decode([]byte{0x01, 0x02}); err == nil {
+		t.Error("Decode accepted trailing bytes")
+	}
+}
+
+func TestDecodeDepth(t *testing.T) {
+	// MaxDepth arrays around a nil decode
+	nested := append(bytes.Repeat([]byte{0x91}, MaxDepth), 0xc0)
+	if _, err := Decode(nested); err != nil {
+		t.Fatalf("Decode of %d nested arrays: %v", MaxDepth, err)
+	}
+
+	tooDeep := append(bytes.Repeat([]byte{0x91}, MaxDepth+1), 0xc0)
+	if _, err := Decode(tooDeep); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("Decode of %d nested arrays = %v, want %v", MaxDepth+1, err, ErrTooDeep)
+	}
+
+	// Maps count towards the depth too
+	var maps []byte
+	for i := 0; i <= MaxDepth; i++ {
+		maps = append(maps, 0x81, 0xa1, 'k')
+	}
+	maps = append(maps, 0xc0)
+	if _, err := Decode(maps); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("Decode of %d nested maps = %v, want %v", MaxDepth+1, err, ErrTooDeep)
+	}
+}
+
+func TestDecodeHostileNesting(t *testing.T) {
+	// A frame of nothing but array headers used to overflow the stack
+	data := bytes.Repeat([]byte{0x91}, 6<<20)
+	if _, err := Decode(data); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("Decode of a 6MB nested frame = %v, want %v", err, ErrTooDeep)
+	}
+}
@@ -0,0 +1,47 @@
+package rating
+
+import (
+	"math"
+)
+
+// Config holds the parameters of the ELO rating system
+type Config struct {
+	InitialRating float64 `json:"initial_rating"`
+	KFactor       float64 `json:"k_factor"`
+
+	// New players move faster until their rating settles
+	ProvisionalKFactor float64 `json:"provisional_k_factor"`
+	ProvisionalGames   int     `json:"provisional_games"`
+
+	// Fixed rating used for bot opponents, bots themselves are never rated
+	BotRating float64 `json:"bot_rating"`
+}
+
+// DefaultConfig returns the default ELO configuration
+func DefaultConfig() Config {
+	return Config{
+		InitialRating:      1200,
+		KFactor:            32,
+		ProvisionalKFactor: 48,
+		ProvisionalGames:   20,
+		BotRating:          1200,
+	}
+}
+
+// ExpectedScore returns the expected score of a player rated ratingA against ratingB
+func ExpectedScore(ratingA, ratingB float64) float64 {
+	return 1 / (1 + math.Pow(10, (ratingB-ratingA)/400))
+}
+
+// kFactor returns the K-factor for a player with the given number of rated games
+func (c Config) kFactor(gamesPlayed int) float64 {
+	if gamesPlayed < c.ProvisionalGames {
+		return c.ProvisionalKFactor
+	}
+	return c.KFactor
+}
+
+// newRating applies a single game result (1 win, 0.5 draw, 0 loss) to a rating
+func (c Config) newRating(rating, opponentRating, score float64, gamesPlayed int) float64 {
+	return rating + c.kFactor(gamesPlayed)*(score-ExpectedScore(rating, opponentRating))
+}
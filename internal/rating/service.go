@@ -0,0 +1,206 @@
+package rating
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// Store persists player ratings
+type Store interface {
+	// GetPlayerRating returns nil without an error for unrated players
+	GetPlayerRating(playerName string) (*models.PlayerRating, error)
+	SavePlayerRating(rating *models.PlayerRating) error
+}
+
+// Service computes and caches player ratings
+type Service struct {
+	config Config
+	store  Store
+
+	ratings map[string]*models.PlayerRating
+	mutex   sync.Mutex
+}
+
+// NewService creates a new rating service. A nil store keeps ratings in memory only.
+func NewService(config Config, store Store) *Service {
+	return &Service{
+		config:  config,
+		store:   store,
+		ratings: make(map[string]*models.PlayerRating),
+	}
+}
+
+// GetRating returns the rating of a player, creating a provisional one for new players
+func (s *Service) GetRating(playerName string) (*models.PlayerRating, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rating, err := s.loadRating(playerName)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *rating
+	return &copied, nil
+}
+
+// CurrentRating returns the rounded rating of a player, falling back to the
+// initial rating when it cannot be loaded
+func (s *Service) CurrentRating(playerName string) int {
+	rating, err := s.GetRating(playerName)
+	if err != nil {
+		return int(math.Round(s.config.InitialRating))
+	}
+	return int(math.Round(rating.Rating))
+}
+
+// Forget drops cached ratings so they are reloaded from the store, used after
+// ratings change outside the service
+func (s *Service) Forget(playerNames ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, name := range playerNames {
+		delete(s.ratings, name)
+	}
+}
+
+// ChangeAll runs a change to every stored rating, such as a season's reset,
+// with no game recorded meanwhile, then drops the cached ratings
+func (s *Service) ChangeAll(change func() error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	defer func() { s.ratings = make(map[string]*models.PlayerRating) }()
+	return change()
+}
+
+// RecordGame updates the ratings of the human players in a finished ranked
+// game. Casual games leave ratings untouched and return no changes.
+func (s *Service) RecordGame(g *models.Game) ([]models.RatingChange, error) {
+	return s.RecordGameWith(g, func(ratings []*models.PlayerRating) error {
+		if s.store == nil {
+			return nil
+		}
+		for _, rating := range ratings {
+			if err := s.store.SavePlayerRating(rating); err != nil {
+				return fmt.Errorf("failed to save rating for %s: %w", rating.PlayerName, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RecordGameWith rates a finished game like RecordGame, but hands the new
+// ratings to save rather than the store, so they can be written in the same
+// transaction as the game. Casual games are saved with no ratings. The new
+// ratings are only used once save succeeds, no game is rated meanwhile.
+func (s *Service) RecordGameWith(g *models.Game, save func(ratings []*models.PlayerRating) error) ([]models.RatingChange, error) {
+	if g == nil || g.State != models.GameStateFinished {
+		return nil, fmt.Errorf("game is not finished")
+	}
+	if g.QueueType != models.QueueTypeRanked {
+		return nil, save(nil)
+	}
+	if g.Players[0] == nil || g.Players[1] == nil {
+		return nil, fmt.Errorf("game is missing players")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var current [2]*models.PlayerRating
+	for i, player := range g.Players {
+		if player.IsBot {
+			continue
+		}
+
+		rating, err := s.loadRating(player.Name)
+		if err != nil {
+			return nil, err
+		}
+		current[i] = rating
+	}
+
+	changes := make([]models.RatingChange, 0, 2)
+	updated := make([]*models.PlayerRating, 0, 2)
+
+	for i, player := range g.Players {
+		if current[i] == nil {
+			continue
+		}
+
+		opponentRating := s.config.BotRating
+		if current[1-i] != nil {
+			opponentRating = current[1-i].Rating
+		}
+
+		next := *current[i]
+		next.Rating = s.config.newRating(next.Rating, opponentRating, gameScore(g, player.Color), next.GamesPlayed)
+		next.GamesPlayed++
+		next.UpdatedAt = time.Now()
+		if next.Rating > next.PeakRating {
+			next.PeakRating = next.Rating
+		}
+
+		changes = append(changes, models.RatingChange{
+			PlayerName: player.Name,
+			OldRating:  current[i].Rating,
+			NewRating:  next.Rating,
+			Delta:      next.Rating - current[i].Rating,
+		})
+		updated = append(updated, &next)
+	}
+
+	if err := save(updated); err != nil {
+		return nil, err
+	}
+	for _, rating := range updated {
+		s.ratings[rating.PlayerName] = rating
+	}
+
+	return changes, nil
+}
+
+// loadRating returns the cached rating of a player, callers must hold the mutex
+func (s *Service) loadRating(playerName string) (*models.PlayerRating, error) {
+	if rating, exists := s.ratings[playerName]; exists {
+		return rating, nil
+	}
+
+	var rating *models.PlayerRating
+	if s.store != nil {
+		stored, err := s.store.GetPlayerRating(playerName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rating for %s: %w", playerName, err)
+		}
+		rating = stored
+	}
+
+	if rating == nil {
+		rating = &models.PlayerRating{
+			PlayerName: playerName,
+			Rating:     s.config.InitialRating,
+			PeakRating: s.config.InitialRating,
+			UpdatedAt:  time.Now(),
+		}
+	}
+
+	s.ratings[playerName] = rating
+	return rating, nil
+}
+
+// gameScore returns the ELO score (1 win, 0.5 draw, 0 loss) for the given color
+func gameScore(g *models.Game, color models.PlayerColor) float64 {
+	if g.Winner == nil {
+		return 0.5
+	}
+	if *g.Winner == color {
+		return 1
+	}
+	return 0
+}
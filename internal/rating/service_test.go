@@ -0,0 +1,275 @@
+package rating
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"connect-four-backend/internal/models"
+)
+
+// memoryStore keeps ratings in a map and counts what it is asked for
+type memoryStore struct {
+	mu      sync.Mutex
+	ratings map[string]*models.PlayerRating
+	loads   map[string]int
+	saves   int
+}
+
+func newMemoryStore(ratings ...*models.PlayerRating) *memoryStore {
+	m := &memoryStore{ratings: make(map[string]*models.PlayerRating), loads: make(map[string]int)}
+	for _, rating := range ratings {
+		m.ratings[rating.PlayerName] = rating
+	}
+	return m
+}
+
+func (m *memoryStore) GetPlayerRating(playerName string) (*models.PlayerRating, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads[playerName]++
+	if rating, ok := m.ratings[playerName]; ok {
+		copied := *rating
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryStore) SavePlayerRating(rating *models.PlayerRating) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saves++
+	copied := *rating
+	m.ratings[rating.PlayerName] = &copied
+	return nil
+}
+
+func human(name string) *models.Player { return &models.Player{Name: name} }
+
+func bot() *models.Player { return &models.Player{Name: "bot", IsBot: true} }
+
+// rankedGame is a finished ranked game, a draw when winner is nil
+func rankedGame(red, yellow *models.Player, winner *models.PlayerColor) *models.Game {
+	red.Color, yellow.Color = models.PlayerRed, models.PlayerYellow
+	return &models.Game{
+		State:     models.GameStateFinished,
+		Players:   [2]*models.Player{red, yellow},
+		Winner:    winner,
+		QueueType: models.QueueTypeRanked,
+	}
+}
+
+// change is a player's rating going from one value to another
+func change(playerName string, from, to float64) models.RatingChange {
+	return models.RatingChange{PlayerName: playerName, OldRating: from, NewRating: to, Delta: to - from}
+}
+
+func color(c models.PlayerColor) *models.PlayerColor { return &c }
+
+// closeTo reports whether two ratings are the same to a hundredth of a point
+func closeTo(a, b float64) bool { return math.Abs(a-b) < 0.01 }
+
+func TestRecordGameWith(t *testing.T) {
+	config := DefaultConfig()
+	config.BotRating = 1000
+
+	// Established players move by KFactor 32, new ones by 48. Against a
+	// 200 points weaker opponent the expected score is 0.7597.
+	tests := []struct {
+		name      string
+		stored    []*models.PlayerRating
+		game      *models.Game
+		want      []models.RatingChange
+		wantPeaks map[string]float64
+	}{
+		{
+			"new players, red wins", nil,
+			rankedGame(human("alice"), human("bob"), color(models.PlayerRed)),
+			[]models.RatingChange{change("alice", 1200, 1224), change("bob", 1200, 1176)},
+			map[string]float64{"alice": 1224, "bob": 1200},
+		},
+		{
+			"the underdog wins",
+			[]*models.PlayerRating{
+				{PlayerName: "alice", Rating: 1400, PeakRating: 1450, GamesPlayed: 30},
+				{PlayerName: "bob", Rating: 1200, PeakRating: 1210, GamesPlayed: 30},
+			},
+			rankedGame(human("alice"), human("bob"), color(models.PlayerYellow)),
+			[]models.RatingChange{change("alice", 1400, 1375.69), change("bob", 1200, 1224.31)},
+			map[string]float64{"alice": 1450, "bob": 1224.31},
+		},
+		{
+			"a draw moves the favorite down",
+			[]*models.PlayerRating{
+				{PlayerName: "alice", Rating: 1400, PeakRating: 1400, GamesPlayed: 30},
+				{PlayerName: "bob", Rating: 1200, PeakRating: 1300, GamesPlayed: 30},
+			},
+			rankedGame(human("alice"), human("bob"), nil),
+			[]models.RatingChange{change("alice", 1400, 1391.69), change("bob", 1200, 1208.31)},
+			map[string]float64{"alice": 1400, "bob": 1300},
+		},
+		{
+			"a new and an established player",
+			[]*models.PlayerRating{{PlayerName: "bob", Rating: 1200, PeakRating: 1200, GamesPlayed: 20}},
+			rankedGame(human("alice"), human("bob"), color(models.PlayerYellow)),
+			[]models.RatingChange{change("alice", 1200, 1176), change("bob", 1200, 1216)},
+			map[string]float64{"alice": 1200, "bob": 1216},
+		},
+		{
+			// Bots play at BotRating and aren't rated
+			"beating a bot", nil,
+			rankedGame(bot(), human("alice"), color(models.PlayerYellow)),
+			[]models.RatingChange{change("alice", 1200, 1211.53)},
+			map[string]float64{"alice": 1211.53},
+		},
+		{
+			"losing to a bot",
+			[]*models.PlayerRating{{PlayerName: "alice", Rating: 800, PeakRating: 900, GamesPlayed: 40}},
+			rankedGame(human("alice"), bot(), color(models.PlayerYellow)),
+			[]models.RatingChange{change("alice", 800, 792.31)},
+			map[string]float64{"alice": 900},
+		},
+	}
+	for _, tt := range tests {
+		store := newMemoryStore(tt.stored...)
+		s := NewService(config, store)
+
+		var saved []*models.PlayerRating
+		changes, err := s.RecordGameWith(tt.game, func(ratings []*models.PlayerRating) error {
+			saved = ratings
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: RecordGameWith = %v", tt.name, err)
+			continue
+		}
+
+		if len(changes) != len(tt.want) {
+			t.Errorf("%s: changes %+v, want %+v", tt.name, changes, tt.want)
+			continue
+		}
+		for i, got := range changes {
+			want := tt.want[i]
+			if got.PlayerName != want.PlayerName || !closeTo(got.OldRating, want.OldRating) ||
+				!closeTo(got.NewRating, want.NewRating) || !closeTo(got.Delta, want.Delta) {
+				t.Errorf("%s: change %+v, want %+v", tt.name, got, want)
+			}
+		}
+
+		// save gets the new ratings, which the service then uses
+		if len(saved) != len(tt.want) {
+			t.Errorf("%s: saved %d ratings, want %d", tt.name, len(saved), len(tt.want))
+			continue
+		}
+		for i, rating := range saved {
+			want := tt.want[i]
+			if rating.PlayerName != want.PlayerName || !closeTo(rating.Rating, want.NewRating) ||
+				!closeTo(rating.PeakRating, tt.wantPeaks[want.PlayerName]) || rating.UpdatedAt.IsZero() {
+				t.Errorf("%s: saved %+v", tt.name, rating)
+			}
+			current, err := s.GetRating(want.PlayerName)
+			if err != nil || *current != *rating {
+				t.Errorf("%s: GetRating(%s) = %+v, %v, want the saved rating", tt.name, want.PlayerName, current, err)
+			}
+		}
+		for _, stored := range tt.stored {
+			if rating, _ := s.GetRating(stored.PlayerName); rating.GamesPlayed != stored.GamesPlayed+1 {
+				t.Errorf("%s: %s played %d games, want %d", tt.name, stored.PlayerName, rating.GamesPlayed, stored.GamesPlayed+1)
+			}
+		}
+
+		// RecordGameWith leaves saving to its callback
+		if store.saves != 0 || store.loads["bot"] != 0 {
+			t.Errorf("%s: the store saved %d ratings and loaded the bot's %d times", tt.name, store.saves, store.loads["bot"])
+		}
+	}
+}
+
+func TestRecordGameWithFailedSave(t *testing.T) {
+	store := newMemoryStore(&models.PlayerRating{PlayerName: "alice", Rating: 1300, PeakRating: 1300, GamesPlayed: 25})
+	s := NewService(DefaultConfig(), store)
+	game := rankedGame(human("alice"), human("bob"), color(models.PlayerRed))
+
+	errSave := errors.New("transaction rolled back")
+	changes, err := s.RecordGameWith(game, func([]*models.PlayerRating) error { return errSave })
+	if err != errSave || changes != nil {
+		t.Fatalf("RecordGameWith = %+v, %v, want the save's error", changes, err)
+	}
+
+	// The ratings are as they were, so the game can be recorded again
+	for _, want := range []models.PlayerRating{{PlayerName: "alice", Rating: 1300, GamesPlayed: 25}, {PlayerName: "bob", Rating: 1200}} {
+		if rating, err := s.GetRating(want.PlayerName); err != nil || rating.Rating != want.Rating || rating.GamesPlayed != want.GamesPlayed {
+			t.Errorf("after the failed save %s is rated %+v, %v", want.PlayerName, rating, err)
+		}
+	}
+	changes, err = s.RecordGameWith(game, func([]*models.PlayerRating) error { return nil })
+	if err != nil || len(changes) != 2 || changes[0].OldRating != 1300 || changes[1].OldRating != 1200 {
+		t.Errorf("recording the game again = %+v, %v", changes, err)
+	}
+	if rating, _ := s.GetRating("alice"); rating.GamesPlayed != 26 {
+		t.Errorf("alice played %d games, want 26", rating.GamesPlayed)
+	}
+}
+
+func TestRecordGameWithUnrated(t *testing.T) {
+	errSave := errors.New("transaction rolled back")
+	casual := rankedGame(human("alice"), human("bob"), color(models.PlayerRed))
+	casual.QueueType = models.QueueTypeCasual
+	unfinished := rankedGame(human("alice"), human("bob"), nil)
+	unfinished.State = models.GameStatePlaying
+	missingPlayer := rankedGame(human("alice"), human("bob"), nil)
+	missingPlayer.Players[1] = nil
+
+	tests := []struct {
+		name      string
+		game      *models.Game
+		saveErr   error
+		wantSaved bool
+		wantErr   bool
+	}{
+		{"a casual game", casual, nil, true, false},
+		{"a casual game that fails to save", casual, errSave, true, true},
+		{"an unfinished game", unfinished, nil, false, true},
+		{"no game", nil, nil, false, true},
+		{"a missing player", missingPlayer, nil, false, true},
+	}
+	for _, tt := range tests {
+		store := newMemoryStore()
+		s := NewService(DefaultConfig(), store)
+
+		saved := false
+		changes, err := s.RecordGameWith(tt.game, func(ratings []*models.PlayerRating) error {
+			saved = true
+			if ratings != nil {
+				t.Errorf("%s: saved ratings %+v", tt.name, ratings)
+			}
+			return tt.saveErr
+		})
+		if (err != nil) != tt.wantErr || (tt.saveErr != nil && err != tt.saveErr) || changes != nil {
+			t.Errorf("%s: RecordGameWith = %+v, %v", tt.name, changes, err)
+		}
+		if saved != tt.wantSaved {
+			t.Errorf("%s: saved is %v, want %v", tt.name, saved, tt.wantSaved)
+		}
+		if len(store.loads) != 0 {
+			t.Errorf("%s: loaded ratings %v", tt.name, store.loads)
+		}
+	}
+}
+
+func TestRecordGameSavesToStore(t *testing.T) {
+	store := newMemoryStore()
+	s := NewService(DefaultConfig(), store)
+	if _, err := s.RecordGame(rankedGame(human("alice"), human("bob"), color(models.PlayerRed))); err != nil {
+		t.Fatal(err)
+	}
+	if store.saves != 2 || store.ratings["alice"].Rating != 1224 || store.ratings["bob"].Rating != 1176 {
+		t.Errorf("the store has %d saves and ratings %+v", store.saves, store.ratings)
+	}
+
+	// A new service reads them back
+	if rating, err := NewService(DefaultConfig(), store).GetRating("alice"); err != nil || rating.Rating != 1224 || rating.GamesPlayed != 1 {
+		t.Errorf("GetRating = %+v, %v", rating, err)
+	}
+}
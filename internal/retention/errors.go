@@ -0,0 +1,7 @@
+package retention
+
+import "errors"
+
+var (
+	ErrInvalidConfig = errors.New("invalid retention configuration")
+)
@@ -0,0 +1,142 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Store deletes the raw data kept about games
+type Store interface {
+	// DeleteGameMovesBefore deletes up to limit moves played before the
+	// cutoff, returning how many it deleted
+	DeleteGameMovesBefore(cutoff time.Time, limit int) (int64, error)
+}
+
+// Config holds how long raw move data is kept and how it is purged
+type Config struct {
+	MoveRetention time.Duration `json:"move_retention"`
+
+	// Moves are deleted BatchSize at a time, so a purge doesn't hold long locks
+	Interval  time.Duration `json:"interval"`
+	BatchSize int           `json:"batch_size"`
+}
+
+// DefaultConfig returns a purge of the moves older than the retention once an
+// hour, a thousand moves at a time
+func DefaultConfig(moveRetention time.Duration) Config {
+	return Config{
+		MoveRetention: moveRetention,
+		Interval:      time.Hour,
+		BatchSize:     1000,
+	}
+}
+
+// Purger deletes the moves of games played longer ago than the retention
+// period. Finished games, with their moves, stay in the game history.
+type Purger struct {
+	config Config
+	store  Store
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	running bool
+	mutex   sync.Mutex
+}
+
+// NewPurger creates a purger for the store
+func NewPurger(config Config, store Store) (*Purger, error) {
+	if config.MoveRetention <= 0 {
+		return nil, fmt.Errorf("%w: move retention %s", ErrInvalidConfig, config.MoveRetention)
+	}
+	if config.Interval <= 0 || config.BatchSize < 1 {
+		return nil, fmt.Errorf("%w: interval %s, batch size %d", ErrInvalidConfig, config.Interval, config.BatchSize)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Purger{
+		config: config,
+		store:  store,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Start purges the moves already past the retention period, then purges
+// again every interval
+func (p *Purger) Start() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.running {
+		return
+	}
+	p.running = true
+
+	p.wg.Add(1)
+	go p.purgeProcessor()
+
+	log.Printf("Move purger started, keeping moves for %s", p.config.MoveRetention)
+}
+
+// Stop stops purging, waiting for a purge in progress to finish its batch
+func (p *Purger) Stop() {
+	p.mutex.Lock()
+	if !p.running {
+		p.mutex.Unlock()
+		return
+	}
+	p.running = false
+	p.mutex.Unlock()
+
+	p.cancel()
+	p.wg.Wait()
+
+	log.Println("Move purger stopped")
+}
+
+// purgeProcessor purges at start and then periodically
+func (p *Purger) purgeProcessor() {
+	defer p.wg.Done()
+
+	p.purge(time.Now())
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.purge(now)
+		}
+	}
+}
+
+// purge deletes the moves played before the retention period, a batch at a
+// time until none are left. Failures are retried at the next purge.
+func (p *Purger) purge(now time.Time) {
+	cutoff := now.Add(-p.config.MoveRetention)
+
+	var purged int64
+	for p.ctx.Err() == nil {
+		deleted, err := p.store.DeleteGameMovesBefore(cutoff, p.config.BatchSize)
+		if err != nil {
+			log.Printf("Failed to purge game moves: %v", err)
+			break
+		}
+		purged += deleted
+		if deleted < int64(p.config.BatchSize) {
+			break
+		}
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d game moves older than %s", purged, cutoff.Format(time.RFC3339))
+	}
+}
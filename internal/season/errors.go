@@ -0,0 +1,7 @@
+package season
+
+import "errors"
+
+var (
+	ErrInvalidConfig = errors.New("invalid season configuration")
+)
@@ -0,0 +1,249 @@
+package season
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+)
+
+// Store persists seasons and ends them
+type Store interface {
+	// GetCurrentSeason returns nil without an error before the first season
+	GetCurrentSeason() (*models.Season, error)
+	StartSeason(season *models.Season) (bool, error)
+	EndSeason(ended, next *models.Season, rewards []models.SeasonReward, reset models.RatingReset) (bool, error)
+}
+
+// RatingChanger runs changes to every stored rating while no game is rated
+type RatingChanger interface {
+	ChangeAll(change func() error) error
+}
+
+// Config holds the length of a season, how far ratings are reset when one
+// ends and the rewards players earn in it
+type Config struct {
+	Length time.Duration `json:"length"`
+
+	// Ratings keep Carryover of their distance from ResetRating
+	ResetRating float64 `json:"reset_rating"`
+	Carryover   float64 `json:"carryover"`
+
+	// Best first, a player gets the first reward they earned
+	Rewards []models.SeasonReward `json:"rewards"`
+
+	CheckInterval time.Duration `json:"check_interval"`
+}
+
+// DefaultConfig returns seasons of the length that halve the distance of
+// every rating from the initial rating when they end, rewarding players who
+// played 10 rated games by their final rating
+func DefaultConfig(length time.Duration, initialRating float64) Config {
+	return Config{
+		Length:      length,
+		ResetRating: initialRating,
+		Carryover:   0.5,
+		Rewards: []models.SeasonReward{
+			{Name: "diamond", Description: "Finished the season rated 1800 or more", MinRating: 1800, MinGames: 10},
+			{Name: "gold", Description: "Finished the season rated 1500 or more", MinRating: 1500, MinGames: 10},
+			{Name: "silver", Description: "Finished the season rated 1300 or more", MinRating: 1300, MinGames: 10},
+			{Name: "bronze", Description: "Played 10 rated games in the season", MinGames: 10},
+		},
+		CheckInterval: time.Minute,
+	}
+}
+
+// Service starts seasons and ends them when they are due
+type Service struct {
+	config  Config
+	store   Store
+	ratings RatingChanger
+
+	current *models.Season // nil until loaded or started
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	running bool
+	mutex   sync.Mutex
+}
+
+// NewService creates a season service. Ratings are reset through the rating
+// changer so cached ratings don't outlive the reset.
+func NewService(config Config, store Store, ratings RatingChanger) (*Service, error) {
+	if config.Length <= 0 {
+		return nil, fmt.Errorf("%w: season length %s", ErrInvalidConfig, config.Length)
+	}
+	if config.Carryover < 0 || config.Carryover > 1 {
+		return nil, fmt.Errorf("%w: carryover %g", ErrInvalidConfig, config.Carryover)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		config:  config,
+		store:   store,
+		ratings: ratings,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Start loads the current season, starting the first if there is none, and
+// ends seasons as they become due
+func (s *Service) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.running {
+		return
+	}
+	s.running = true
+
+	s.processSeasons(time.Now())
+
+	s.wg.Add(1)
+	go s.seasonProcessor()
+
+	log.Printf("Season service started with %s seasons", s.config.Length)
+}
+
+// Stop stops ending seasons, the current one carries on at the next start
+func (s *Service) Stop() {
+	s.mutex.Lock()
+	if !s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = false
+	s.mutex.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+
+	log.Println("Season service stopped")
+}
+
+// Current returns the season being played, nil until it could be loaded
+func (s *Service) Current() *models.Season {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.current == nil {
+		return nil
+	}
+	current := *s.current
+	return &current
+}
+
+// Rewards returns the rewards players can earn in a season, best first
+func (s *Service) Rewards() []models.SeasonReward {
+	return s.config.Rewards
+}
+
+// seasonProcessor periodically ends the current season once it is due
+func (s *Service) seasonProcessor() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mutex.Lock()
+			s.processSeasons(now)
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// processSeasons loads or starts the current season and ends it when it is
+// due; callers must hold the mutex. Failures are retried at the next check.
+func (s *Service) processSeasons(now time.Time) {
+	if s.current == nil {
+		if err := s.loadCurrent(now); err != nil {
+			log.Printf("Failed to load the current season: %v", err)
+			return
+		}
+	}
+
+	if now.Before(s.current.EndsAt) {
+		return
+	}
+	if err := s.endCurrent(now); err != nil {
+		log.Printf("Failed to end season %d: %v", s.current.Number, err)
+	}
+}
+
+// loadCurrent reads the current season, starting the first when there has
+// been none; callers must hold the mutex
+func (s *Service) loadCurrent(now time.Time) error {
+	current, err := s.store.GetCurrentSeason()
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		s.current = current
+		return nil
+	}
+
+	first := &models.Season{Number: 1, StartedAt: now, EndsAt: now.Add(s.config.Length)}
+	started, err := s.store.StartSeason(first)
+	if err != nil {
+		return err
+	}
+	if !started {
+		// Another server started it first
+		if current, err = s.store.GetCurrentSeason(); err != nil {
+			return err
+		}
+		if current == nil {
+			return fmt.Errorf("season %d was not started", first.Number)
+		}
+		first = current
+	} else {
+		log.Printf("Season %d started, ending %s", first.Number, first.EndsAt.Format(time.RFC3339))
+	}
+
+	s.current = first
+	return nil
+}
+
+// endCurrent ends the current season and starts the next, which ends a
+// season length after the ended one was due; seasons missed while the server
+// was down are skipped. Callers must hold the mutex.
+func (s *Service) endCurrent(now time.Time) error {
+	ended := *s.current
+	ended.EndedAt = &now
+
+	next := &models.Season{Number: ended.Number + 1, StartedAt: now, EndsAt: ended.EndsAt.Add(s.config.Length)}
+	for !next.EndsAt.After(now) {
+		next.EndsAt = next.EndsAt.Add(s.config.Length)
+	}
+
+	reset := models.RatingReset{Toward: s.config.ResetRating, Carryover: s.config.Carryover}
+	var changed bool
+	err := s.ratings.ChangeAll(func() (err error) {
+		changed, err = s.store.EndSeason(&ended, next, s.config.Rewards, reset)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		// Another server ended it first
+		s.current = nil
+		return s.loadCurrent(now)
+	}
+
+	log.Printf("Season %d ended, season %d started", ended.Number, next.Number)
+	s.current = next
+	return nil
+}
@@ -3,8 +3,8 @@ package server
 import (
 	"context"
 	"net/http"
-	"time"
 
+	"connect-four-backend/internal/auth"
 	"connect-four-backend/internal/config"
 	"connect-four-backend/internal/handlers"
 
@@ -16,19 +16,79 @@ type Server struct {
 	config     *config.Config
 }
 
-func NewServer(cfg *config.Config, gameHandler *handlers.GameHandler, leaderboardHandler *handlers.LeaderboardHandler) *Server {
+func NewServer(cfg *config.Config, sessions *auth.Sessions, gameHandler *handlers.GameHandler, leaderboardHandler *handlers.LeaderboardHandler, tournamentHandler *handlers.TournamentHandler, accountHandler *handlers.AccountHandler, adminHandler *handlers.AdminHandler, metricsHandler http.Handler) *Server {
 	router := mux.NewRouter()
 
 	// WebSocket endpoint for game connections
 	router.HandleFunc("/ws", gameHandler.HandleWebSocket)
 
-	// REST API endpoints
-	api := router.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/leaderboard", leaderboardHandler.GetLeaderboard).Methods("GET")
-	api.HandleFunc("/player/stats", leaderboardHandler.GetPlayerStats).Methods("GET")
+	// Registration and login hand out the session token the rest of the API requires
+	router.HandleFunc("/api/accounts/register", accountHandler.Register).Methods("POST")
+	router.HandleFunc("/api/accounts/login", accountHandler.Login).Methods("POST")
+
+	// OpenAPI document of the REST endpoints
+	router.Handle("/api/openapi.json", handlers.NewOpenAPIHandler(router)).Methods("GET")
+
+	// Read-only game streams for overlays and dashboards, no session needed to watch
+	router.HandleFunc("/api/games/{id}/stream", gameHandler.StreamGame).Methods("GET")
 
-	// Health check endpoint
+	// Rankings, seasons and player profiles are public, the web client shows
+	// the leaderboard before anyone has a session
+	router.HandleFunc("/api/leaderboard", leaderboardHandler.GetLeaderboard).Methods("GET")
+	router.HandleFunc("/api/player/stats", leaderboardHandler.GetPlayerStats).Methods("GET")
+	router.HandleFunc("/api/players/{name}", leaderboardHandler.GetPlayerProfile).Methods("GET")
+	router.HandleFunc("/api/seasons", leaderboardHandler.ListSeasons).Methods("GET")
+	router.HandleFunc("/api/seasons/{number}/standings", leaderboardHandler.GetSeasonStandings).Methods("GET")
+
+	// REST API endpoints, clients authenticate with the session token from the WebSocket or login
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(sessions.RequireSession)
+	api.HandleFunc("/accounts/me", accountHandler.GetProfile).Methods("GET")
+	api.HandleFunc("/accounts/claim-guest", accountHandler.ClaimGuest).Methods("POST")
+	api.HandleFunc("/accounts/me/erase", accountHandler.Erase).Methods("POST")
+	api.HandleFunc("/games", gameHandler.ListGames).Methods("GET")
+	api.HandleFunc("/games/{id}", gameHandler.GetGame).Methods("GET")
+	api.HandleFunc("/games/{id}/moves", gameHandler.MakeMove).Methods("POST")
+	api.HandleFunc("/games/{id}/events", gameHandler.GetGameEvents).Methods("GET")
+	api.HandleFunc("/games/{id}/replay", gameHandler.GetReplay).Methods("GET")
+	api.HandleFunc("/games/{id}/analysis", gameHandler.GetGameAnalysis).Methods("GET")
+	api.HandleFunc("/tournaments", tournamentHandler.ListTournaments).Methods("GET")
+	api.HandleFunc("/tournaments/scheduled", tournamentHandler.ListScheduledTournaments).Methods("GET")
+	api.HandleFunc("/tournaments/{id}", tournamentHandler.GetTournament).Methods("GET")
+
+	// Operator endpoints, limited to the admin accounts
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(adminHandler.RequireAdmin)
+	admin.HandleFunc("/games", adminHandler.ListGames).Methods("GET")
+	admin.HandleFunc("/games/{id}", adminHandler.GetGame).Methods("GET")
+	admin.HandleFunc("/games/{id}/end", adminHandler.EndGame).Methods("POST")
+	admin.HandleFunc("/players/{id}/kick", adminHandler.KickPlayer).Methods("POST")
+	admin.HandleFunc("/announcements", adminHandler.Announce).Methods("POST")
+	admin.HandleFunc("/drain", adminHandler.GetDrain).Methods("GET")
+	admin.HandleFunc("/drain", adminHandler.Drain).Methods("POST")
+	admin.HandleFunc("/webhooks", adminHandler.ListWebhooks).Methods("GET")
+	admin.HandleFunc("/webhooks", adminHandler.CreateWebhook).Methods("POST")
+	admin.HandleFunc("/webhooks/dead-letters", adminHandler.ListWebhookDeadLetters).Methods("GET")
+	admin.HandleFunc("/webhooks/{id}", adminHandler.DeleteWebhook).Methods("DELETE")
+	admin.HandleFunc("/analytics", adminHandler.GetAnalytics).Methods("GET")
+	admin.HandleFunc("/analytics", adminHandler.UpdateAnalytics).Methods("PUT")
+	admin.HandleFunc("/config", adminHandler.GetConfig).Methods("GET")
+	admin.HandleFunc("/config/reload", adminHandler.ReloadConfig).Methods("POST")
+	admin.HandleFunc("/tournaments", tournamentHandler.CreateTournament).Methods("POST")
+	admin.HandleFunc("/tournaments/{id}/start", tournamentHandler.StartTournament).Methods("POST")
+	admin.HandleFunc("/tournaments/{id}/cancel", tournamentHandler.CancelTournament).Methods("POST")
+
+	// Prometheus scrapes the game, queue, connection, database and analytics metrics
+	router.Handle("/metrics", metricsHandler).Methods("GET")
+
+	// Health check endpoint, failing while the server drains so load balancers
+	// send new players elsewhere
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if gameHandler.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("DRAINING"))
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}).Methods("GET")
@@ -36,17 +96,23 @@ func NewServer(cfg *config.Config, gameHandler *handlers.GameHandler, leaderboar
 	// Serve static files (React frontend)
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./web/build/")))
 
+	// A span for every REST request, when tracing is on
+	router.Use(handlers.TraceRequests)
+
 	// CORS middleware
 	router.Use(corsMiddleware)
 
 	httpServer := &http.Server{
-		Addr:         ":" + cfg.Port,
+		Addr:         ":" + cfg.Server.Port,
 		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
+	// Shutdown waits for open requests, game streams would hold it up
+	httpServer.RegisterOnShutdown(gameHandler.CloseStreams)
+
 	return &Server{
 		httpServer: httpServer,
 		config:     cfg,
@@ -0,0 +1,89 @@
+package tournament
+
+import (
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// bracketSize returns the smallest power of two that fits all players
+func bracketSize(players int) int {
+	size := 2
+	for size < players {
+		size *= 2
+	}
+	return size
+}
+
+// seedOrder returns the seeds in bracket order so that the top seeds meet as
+// late as possible, e.g. [1 8 4 5 2 7 3 6] for eight players
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		n := len(order) * 2
+		next := make([]int, 0, n)
+		for _, seed := range order {
+			next = append(next, seed, n+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// buildBracket lays out every round of a single-elimination bracket for the
+// seeded players. Seeds without a player are byes, which only ever face the
+// top seeds in the first round.
+func buildBracket(players []*models.TournamentPlayer) []*models.TournamentRound {
+	size := bracketSize(len(players))
+	order := seedOrder(size)
+
+	var rounds []*models.TournamentRound
+	for matches, number := size/2, 1; matches >= 1; matches, number = matches/2, number+1 {
+		round := &models.TournamentRound{Number: number}
+		for slot := 0; slot < matches; slot++ {
+			round.Matches = append(round.Matches, &models.TournamentMatch{
+				ID:     uuid.New(),
+				Round:  number,
+				Slot:   slot,
+				Status: models.TournamentMatchPending,
+			})
+		}
+		rounds = append(rounds, round)
+	}
+
+	for slot, match := range rounds[0].Matches {
+		match.Player1 = seededPlayer(players, order[2*slot])
+		match.Player2 = seededPlayer(players, order[2*slot+1])
+	}
+
+	return rounds
+}
+
+// startBracket lays out a single-elimination bracket and plays its first
+// round; callers must hold the mutex
+func (s *Service) startBracket(t *models.Tournament, out *outbox) {
+	t.Rounds = buildBracket(t.Players)
+	t.TotalRounds = len(t.Rounds)
+
+	// Byes advance straight away, everyone else starts playing
+	for _, match := range t.Rounds[0].Matches {
+		switch {
+		case match.Player1 == nil:
+			match.Bye = true
+			s.advance(t, match, match.Player2, out)
+		case match.Player2 == nil:
+			match.Bye = true
+			s.advance(t, match, match.Player1, out)
+		default:
+			s.schedule(t, match, out)
+		}
+	}
+}
+
+// seededPlayer returns the player with the given seed, or nil for a bye
+func seededPlayer(players []*models.TournamentPlayer, seed int) *models.TournamentPlayer {
+	if seed > len(players) {
+		return nil
+	}
+	return players[seed-1]
+}
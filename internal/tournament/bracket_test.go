@@ -0,0 +1,81 @@
+package tournament
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// seededPlayers returns players seeded in order
+func seededPlayers(count int) []*models.TournamentPlayer {
+	players := make([]*models.TournamentPlayer, count)
+	for i := range players {
+		players[i] = &models.TournamentPlayer{ID: uuid.New(), Name: fmt.Sprintf("player%d", i+1), Seed: i + 1}
+	}
+	return players
+}
+
+func TestBracketSize(t *testing.T) {
+	tests := []struct{ players, want int }{
+		{2, 2}, {3, 4}, {4, 4}, {5, 8}, {16, 16}, {17, 32}, {64, 64},
+	}
+	for _, tt := range tests {
+		if got := bracketSize(tt.players); got != tt.want {
+			t.Errorf("bracketSize(%d) = %d, want %d", tt.players, got, tt.want)
+		}
+	}
+}
+
+func TestSeedOrder(t *testing.T) {
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{2, []int{1, 2}},
+		{4, []int{1, 4, 2, 3}},
+		{8, []int{1, 8, 4, 5, 2, 7, 3, 6}},
+	}
+	for _, tt := range tests {
+		if got := seedOrder(tt.size); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("seedOrder(%d) = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestBuildBracket(t *testing.T) {
+	players := seededPlayers(5)
+	rounds := buildBracket(players)
+
+	if len(rounds) != 3 {
+		t.Fatalf("%d rounds for 5 players, want 3", len(rounds))
+	}
+	for i, want := range []int{4, 2, 1} {
+		if got := len(rounds[i].Matches); got != want {
+			t.Errorf("round %d has %d matches, want %d", i+1, got, want)
+		}
+		for slot, match := range rounds[i].Matches {
+			if match.Round != i+1 || match.Slot != slot || match.Status != models.TournamentMatchPending {
+				t.Errorf("round %d slot %d is %+v", i+1, slot, match)
+			}
+			if i > 0 && (match.Player1 != nil || match.Player2 != nil) {
+				t.Errorf("round %d slot %d has players before the first round is played", i+1, slot)
+			}
+		}
+	}
+
+	// Seeds 1, 2 and 3 get the byes, 4 and 5 play
+	want := [][2]int{{1, 0}, {4, 5}, {2, 0}, {3, 0}}
+	for slot, match := range rounds[0].Matches {
+		got := [2]int{match.Player1.Seed, 0}
+		if match.Player2 != nil {
+			got[1] = match.Player2.Seed
+		}
+		if got != want[slot] {
+			t.Errorf("first round slot %d is seeds %v, want %v", slot, got, want[slot])
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package tournament
+
+import "errors"
+
+var (
+	ErrTournamentNotFound = errors.New("tournament not found")
+	ErrRegistrationClosed = errors.New("tournament registration is closed")
+	ErrTournamentFull     = errors.New("tournament is full")
+	ErrAlreadyRegistered  = errors.New("player is already registered for a tournament")
+	ErrNotRegistered      = errors.New("player is not registered for this tournament")
+	ErrNotEnoughPlayers   = errors.New("not enough players to start the tournament")
+	ErrAlreadyStarted     = errors.New("tournament has already started")
+	ErrAlreadyFinished    = errors.New("tournament has already finished")
+	ErrInvalidName        = errors.New("tournament name is required")
+	ErrInvalidMaxPlayers  = errors.New("invalid maximum number of players")
+	ErrInvalidFormat      = errors.New("unknown tournament format")
+	ErrEntryRequirements  = errors.New("player rating does not meet the tournament entry requirements")
+	ErrInvalidSchedule    = errors.New("invalid tournament schedule")
+	ErrDraining           = errors.New("tournaments are not started while the server drains")
+)
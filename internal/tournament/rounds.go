@@ -0,0 +1,230 @@
+package tournament
+
+import (
+	"log"
+	"math/bits"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// startRoundRobin lays out every round so each player meets every other
+// player once, then plays the first round; callers must hold the mutex
+func (s *Service) startRoundRobin(t *models.Tournament, out *outbox) {
+	t.Rounds = roundRobinRounds(t.Players)
+	t.TotalRounds = len(t.Rounds)
+	t.Standings = computeStandings(t)
+	s.startRound(t, t.Rounds[0], out)
+}
+
+// startSwiss plays the first Swiss round; later rounds are paired from the
+// standings as each round completes. Callers must hold the mutex.
+func (s *Service) startSwiss(t *models.Tournament, out *outbox) {
+	t.TotalRounds = s.config.SwissRounds
+	if t.TotalRounds <= 0 {
+		t.TotalRounds = swissRounds(len(t.Players))
+	}
+	// Nobody can play more distinct opponents than there are
+	if t.TotalRounds > len(t.Players)-1 {
+		t.TotalRounds = len(t.Players) - 1
+	}
+
+	t.Standings = computeStandings(t)
+	s.pairSwissRound(t, out)
+}
+
+// startRound plays the byes of a round and schedules its games; callers must hold the mutex
+func (s *Service) startRound(t *models.Tournament, round *models.TournamentRound, out *outbox) {
+	for _, match := range round.Matches {
+		if match.Player2 != nil {
+			s.schedule(t, match, out)
+			continue
+		}
+
+		// A Swiss bye scores a point, a round-robin bye is just a rest
+		match.Bye = true
+		var winner *models.TournamentPlayer
+		if t.Format == models.TournamentSwiss {
+			winner = match.Player1
+		}
+		s.recordResult(t, match, winner, out)
+	}
+}
+
+// recordResult stores the result of a Swiss or round-robin match and moves on
+// once every match of the round is done. A nil winner is a draw, or no result
+// for a round-robin bye. Callers must hold the mutex.
+func (s *Service) recordResult(t *models.Tournament, match *models.TournamentMatch, winner *models.TournamentPlayer, out *outbox) {
+	match.Status = models.TournamentMatchFinished
+	if winner != nil {
+		match.WinnerID = &winner.ID
+	} else if !match.Bye {
+		match.Draw = true
+	}
+
+	t.Standings = computeStandings(t)
+	out.event(EventMatchFinished, t, match)
+
+	for _, m := range t.Rounds[match.Round-1].Matches {
+		if m.Status != models.TournamentMatchFinished {
+			return
+		}
+	}
+
+	switch {
+	case match.Round == t.TotalRounds:
+		s.finish(t, t.GetPlayer(t.Standings[0].PlayerID), out)
+	case t.Format == models.TournamentSwiss:
+		s.pairSwissRound(t, out)
+	default:
+		s.startRound(t, t.Rounds[match.Round], out)
+	}
+}
+
+// pairSwissRound pairs the next Swiss round from the current standings.
+// Players meet opponents on the same score where possible, never someone they
+// already played, and the lowest ranked player without a bye sits out when the
+// number of players is odd. Callers must hold the mutex.
+func (s *Service) pairSwissRound(t *models.Tournament, out *outbox) {
+	played := make(map[[2]uuid.UUID]bool)
+	hadBye := make(map[uuid.UUID]bool)
+	for _, round := range t.Rounds {
+		for _, match := range round.Matches {
+			if match.Bye {
+				hadBye[match.Player1.ID] = true
+				continue
+			}
+			played[[2]uuid.UUID{match.Player1.ID, match.Player2.ID}] = true
+			played[[2]uuid.UUID{match.Player2.ID, match.Player1.ID}] = true
+		}
+	}
+
+	// Standings are ordered by score, tie-breaks and then seed, so neighbours
+	// are the closest in both score and rating
+	players := make([]*models.TournamentPlayer, 0, len(t.Standings))
+	for _, standing := range t.Standings {
+		players = append(players, t.GetPlayer(standing.PlayerID))
+	}
+
+	var bye *models.TournamentPlayer
+	if len(players)%2 == 1 {
+		index := len(players) - 1
+		for i := len(players) - 1; i >= 0; i-- {
+			if !hadBye[players[i].ID] {
+				index = i
+				break
+			}
+		}
+		bye = players[index]
+		players = append(players[:index:index], players[index+1:]...)
+	}
+
+	pairs := pairWithoutRepeats(players, played)
+	if pairs == nil {
+		// Every pairing repeats a game, fall back to neighbours in the standings
+		log.Printf("Tournament %s: no Swiss pairing without repeats, allowing rematches", t.Name)
+		for i := 0; i+1 < len(players); i += 2 {
+			pairs = append(pairs, [2]*models.TournamentPlayer{players[i], players[i+1]})
+		}
+	}
+
+	number := len(t.Rounds) + 1
+	round := &models.TournamentRound{Number: number}
+	for slot, pair := range pairs {
+		// Alternate who moves first from round to round
+		if number%2 == 0 {
+			pair[0], pair[1] = pair[1], pair[0]
+		}
+		round.Matches = append(round.Matches, &models.TournamentMatch{
+			ID:      uuid.New(),
+			Round:   number,
+			Slot:    slot,
+			Player1: pair[0],
+			Player2: pair[1],
+			Status:  models.TournamentMatchPending,
+		})
+	}
+	if bye != nil {
+		round.Matches = append(round.Matches, &models.TournamentMatch{
+			ID:      uuid.New(),
+			Round:   number,
+			Slot:    len(pairs),
+			Player1: bye,
+			Status:  models.TournamentMatchPending,
+		})
+	}
+
+	t.Rounds = append(t.Rounds, round)
+	s.startRound(t, round, out)
+}
+
+// pairWithoutRepeats pairs players in order, each with the nearest player they
+// haven't met yet, backtracking when that leaves someone without an opponent.
+// It returns nil if no such pairing exists.
+func pairWithoutRepeats(players []*models.TournamentPlayer, played map[[2]uuid.UUID]bool) [][2]*models.TournamentPlayer {
+	if len(players) == 0 {
+		return [][2]*models.TournamentPlayer{}
+	}
+
+	first := players[0]
+	for i := 1; i < len(players); i++ {
+		if played[[2]uuid.UUID{first.ID, players[i].ID}] {
+			continue
+		}
+
+		rest := make([]*models.TournamentPlayer, 0, len(players)-2)
+		rest = append(rest, players[1:i]...)
+		rest = append(rest, players[i+1:]...)
+
+		if pairs := pairWithoutRepeats(rest, played); pairs != nil {
+			return append([][2]*models.TournamentPlayer{{first, players[i]}}, pairs...)
+		}
+	}
+	return nil
+}
+
+// roundRobinRounds schedules everyone against everyone with the circle method.
+// With an odd number of players one player rests each round.
+func roundRobinRounds(players []*models.TournamentPlayer) []*models.TournamentRound {
+	circle := append([]*models.TournamentPlayer{}, players...)
+	if len(circle)%2 == 1 {
+		circle = append(circle, nil)
+	}
+	n := len(circle)
+
+	var rounds []*models.TournamentRound
+	for number := 1; number < n; number++ {
+		round := &models.TournamentRound{Number: number}
+		for slot := 0; slot < n/2; slot++ {
+			player1, player2 := circle[slot], circle[n-1-slot]
+			if player1 == nil || (number%2 == 0 && player2 != nil) {
+				// Rests go in Player1, and colors alternate between rounds
+				player1, player2 = player2, player1
+			}
+			round.Matches = append(round.Matches, &models.TournamentMatch{
+				ID:      uuid.New(),
+				Round:   number,
+				Slot:    slot,
+				Player1: player1,
+				Player2: player2,
+				Status:  models.TournamentMatchPending,
+			})
+		}
+		rounds = append(rounds, round)
+
+		// Keep the first player in place and rotate everyone else by one
+		rotated := append([]*models.TournamentPlayer{circle[0], circle[n-1]}, circle[1:n-1]...)
+		circle = rotated
+	}
+	return rounds
+}
+
+// swissRounds returns enough rounds to leave a single unbeaten player, log2 of
+// the player count rounded up
+func swissRounds(players int) int {
+	if players < 2 {
+		return 1
+	}
+	return bits.Len(uint(players - 1))
+}
@@ -0,0 +1,188 @@
+package tournament
+
+import (
+	"testing"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// pairKey identifies a pairing whichever player is first
+func pairKey(player1, player2 *models.TournamentPlayer) [2]uuid.UUID {
+	if player1.Seed > player2.Seed {
+		player1, player2 = player2, player1
+	}
+	return [2]uuid.UUID{player1.ID, player2.ID}
+}
+
+func TestRoundRobinRounds(t *testing.T) {
+	for count := 2; count <= 7; count++ {
+		players := seededPlayers(count)
+		rounds := roundRobinRounds(players)
+
+		wantRounds := count - 1
+		if count%2 == 1 {
+			wantRounds = count
+		}
+		if len(rounds) != wantRounds {
+			t.Errorf("%d players: %d rounds, want %d", count, len(rounds), wantRounds)
+			continue
+		}
+
+		met := make(map[[2]uuid.UUID]int)
+		rests := make(map[uuid.UUID]int)
+		for _, round := range rounds {
+			seen := make(map[uuid.UUID]bool)
+			for _, match := range round.Matches {
+				for _, player := range []*models.TournamentPlayer{match.Player1, match.Player2} {
+					if player == nil {
+						continue
+					}
+					if seen[player.ID] {
+						t.Errorf("%d players: %s plays twice in round %d", count, player.Name, round.Number)
+					}
+					seen[player.ID] = true
+				}
+				if match.Player1 == nil {
+					t.Errorf("%d players: round %d slot %d has no first player", count, round.Number, match.Slot)
+				} else if match.Player2 == nil {
+					rests[match.Player1.ID]++
+				} else {
+					met[pairKey(match.Player1, match.Player2)]++
+				}
+			}
+		}
+
+		// Everyone meets everyone once, and with an odd count rests once
+		if want := count * (count - 1) / 2; len(met) != want {
+			t.Errorf("%d players: %d pairings, want %d", count, len(met), want)
+		}
+		for pair, times := range met {
+			if times != 1 {
+				t.Errorf("%d players: %v met %d times", count, pair, times)
+			}
+		}
+		for _, player := range players {
+			if want := count % 2; rests[player.ID] != want {
+				t.Errorf("%d players: %s rests %d times, want %d", count, player.Name, rests[player.ID], want)
+			}
+		}
+	}
+}
+
+func TestSwissRounds(t *testing.T) {
+	tests := []struct{ players, want int }{
+		{2, 1}, {3, 2}, {4, 2}, {5, 3}, {8, 3}, {9, 4}, {64, 6},
+	}
+	for _, tt := range tests {
+		if got := swissRounds(tt.players); got != tt.want {
+			t.Errorf("swissRounds(%d) = %d, want %d", tt.players, got, tt.want)
+		}
+	}
+}
+
+func TestPairWithoutRepeats(t *testing.T) {
+	players := seededPlayers(4)
+	played := map[[2]uuid.UUID]bool{}
+	meet := func(i, j int) {
+		played[[2]uuid.UUID{players[i].ID, players[j].ID}] = true
+		played[[2]uuid.UUID{players[j].ID, players[i].ID}] = true
+	}
+
+	// Neighbours pair up when they haven't met
+	pairs := pairWithoutRepeats(players, played)
+	if len(pairs) != 2 || pairs[0] != [2]*models.TournamentPlayer{players[0], players[1]} || pairs[1] != [2]*models.TournamentPlayer{players[2], players[3]} {
+		t.Errorf("first pairing = %v, want 1-2 and 3-4", pairs)
+	}
+
+	// 1 already met 2 and 3, so it takes 4 and leaves 2 and 3 together
+	meet(0, 1)
+	meet(0, 2)
+	pairs = pairWithoutRepeats(players, played)
+	if len(pairs) != 2 || pairs[0] != [2]*models.TournamentPlayer{players[0], players[3]} || pairs[1] != [2]*models.TournamentPlayer{players[1], players[2]} {
+		t.Errorf("pairing = %v, want 1-4 and 2-3", pairs)
+	}
+
+	// Once 2 and 3 met too, every pairing repeats a game
+	meet(1, 2)
+	if pairs := pairWithoutRepeats(players, played); pairs != nil {
+		t.Errorf("pairing = %v, want none", pairs)
+	}
+}
+
+func TestSwissTournament(t *testing.T) {
+	s, m := newTestService(t)
+	created := newTournament(t, s, models.TournamentSwiss, 5)
+	if _, err := s.Start(created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := playOut(t, s, m, created.ID, redWins)
+	if finished.Status != models.TournamentFinished || finished.TotalRounds != 3 || len(finished.Rounds) != 3 {
+		t.Fatalf("tournament %s after %d of %d rounds", finished.Status, len(finished.Rounds), finished.TotalRounds)
+	}
+	if *finished.WinnerID != finished.Standings[0].PlayerID {
+		t.Errorf("won by %v, the standings lead with %s", *finished.WinnerID, finished.Standings[0].Name)
+	}
+
+	met := make(map[[2]uuid.UUID]bool)
+	byes := make(map[uuid.UUID]int)
+	for _, round := range finished.Rounds {
+		roundByes := 0
+		for _, match := range round.Matches {
+			if match.Bye {
+				roundByes++
+				byes[match.Player1.ID]++
+				if match.WinnerID == nil || *match.WinnerID != match.Player1.ID {
+					t.Errorf("round %d bye didn't score", round.Number)
+				}
+				continue
+			}
+			key := pairKey(match.Player1, match.Player2)
+			if met[key] {
+				t.Errorf("%s and %s met twice", match.Player1.Name, match.Player2.Name)
+			}
+			met[key] = true
+		}
+		if roundByes != 1 {
+			t.Errorf("round %d has %d byes, want 1", round.Number, roundByes)
+		}
+	}
+	for id, count := range byes {
+		if count > 1 {
+			t.Errorf("%s had %d byes", finished.GetPlayer(id).Name, count)
+		}
+	}
+
+	// Each round hands out two points for its games and one for the bye
+	total := 0.0
+	for _, standing := range finished.Standings {
+		total += standing.Score
+	}
+	if total != 9 {
+		t.Errorf("%v points handed out over 3 rounds, want 9", total)
+	}
+}
+
+func TestRoundRobinTournament(t *testing.T) {
+	s, m := newTestService(t)
+	created := newTournament(t, s, models.TournamentRoundRobin, 4)
+	if _, err := s.Start(created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every game is drawn, so the seeds settle the standings
+	finished := playOut(t, s, m, created.ID, func(*models.TournamentMatch) *models.PlayerColor { return nil })
+	if finished.Status != models.TournamentFinished || len(finished.Rounds) != 3 {
+		t.Fatalf("tournament %s after %d rounds, want finished after 3", finished.Status, len(finished.Rounds))
+	}
+	for i, standing := range finished.Standings {
+		if standing.Rank != i+1 || standing.Score != 1.5 || standing.Draws != 3 || standing.Name != finished.Players[i].Name {
+			t.Errorf("standing %d = %+v, want %s on 1.5 points", i+1, standing, finished.Players[i].Name)
+		}
+	}
+	if *finished.WinnerID != finished.Players[0].ID {
+		t.Error("the top seed didn't win a tournament of draws")
+	}
+}
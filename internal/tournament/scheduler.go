@@ -0,0 +1,293 @@
+package tournament
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Schedule describes a recurring tournament. Registration opens a while before
+// each start and the tournament starts on its own at the scheduled time.
+type Schedule struct {
+	Name         string                  `json:"name"`
+	Format       models.TournamentFormat `json:"format"`
+	MaxPlayers   int                     `json:"max_players"`
+	MinRating    int                     `json:"min_rating"` // 0 for no minimum
+	MaxRating    int                     `json:"max_rating"` // 0 for no maximum
+	StartTime    string                  `json:"start_time"` // "15:04" in UTC
+	Weekdays     []time.Weekday          `json:"weekdays"`   // empty runs every day
+	Registration time.Duration           `json:"registration"`
+}
+
+// SchedulerConfig holds the recurring tournaments run by the scheduler
+type SchedulerConfig struct {
+	Schedules     []Schedule    `json:"schedules"`
+	CheckInterval time.Duration `json:"check_interval"`
+}
+
+// DefaultSchedulerConfig returns the configuration used by the game server,
+// a daily Swiss tournament at 18:00 UTC
+func DefaultSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		Schedules: []Schedule{
+			{
+				Name:         "Daily Tournament",
+				Format:       models.TournamentSwiss,
+				MaxPlayers:   32,
+				StartTime:    "18:00",
+				Registration: time.Hour,
+			},
+		},
+		CheckInterval: 30 * time.Second,
+	}
+}
+
+// Scheduler creates and starts recurring tournaments on the tournament service
+type Scheduler struct {
+	service *Service
+	config  SchedulerConfig
+	runs    []*scheduledRun
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	running bool
+	mutex   sync.Mutex
+}
+
+// scheduledRun tracks the next occurrence of a schedule
+type scheduledRun struct {
+	schedule     Schedule
+	hour, minute int
+	startsAt     time.Time
+	tournamentID uuid.UUID // set while registration is open
+}
+
+// NewScheduler creates a scheduler for the configured schedules
+func NewScheduler(config SchedulerConfig, service *Service) (*Scheduler, error) {
+	runs := make([]*scheduledRun, 0, len(config.Schedules))
+	for _, schedule := range config.Schedules {
+		run, err := newScheduledRun(schedule)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		service: service,
+		config:  config,
+		runs:    runs,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+func newScheduledRun(schedule Schedule) (*scheduledRun, error) {
+	start, err := time.Parse("15:04", schedule.StartTime)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s start time %q", ErrInvalidSchedule, schedule.Name, schedule.StartTime)
+	}
+	if schedule.Registration <= 0 {
+		return nil, fmt.Errorf("%w: %s has no registration period", ErrInvalidSchedule, schedule.Name)
+	}
+	for _, weekday := range schedule.Weekdays {
+		if weekday < time.Sunday || weekday > time.Saturday {
+			return nil, fmt.Errorf("%w: %s weekday %d", ErrInvalidSchedule, schedule.Name, weekday)
+		}
+	}
+
+	return &scheduledRun{
+		schedule: schedule,
+		hour:     start.Hour(),
+		minute:   start.Minute(),
+	}, nil
+}
+
+// Start begins creating and starting scheduled tournaments
+func (s *Scheduler) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.running {
+		return
+	}
+	s.running = true
+
+	now := time.Now()
+	for _, run := range s.runs {
+		run.startsAt = run.next(now)
+	}
+
+	s.wg.Add(1)
+	go s.scheduleProcessor()
+
+	log.Printf("Tournament scheduler started with %d schedules", len(s.runs))
+}
+
+// Stop stops the scheduler. Tournaments it already created keep running.
+func (s *Scheduler) Stop() {
+	s.mutex.Lock()
+	if !s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = false
+	s.mutex.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+
+	log.Println("Tournament scheduler stopped")
+}
+
+// Upcoming returns the next occurrence of every schedule, soonest first
+func (s *Scheduler) Upcoming() []*models.ScheduledTournament {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upcoming := make([]*models.ScheduledTournament, 0, len(s.runs))
+	for _, run := range s.runs {
+		if run.startsAt.IsZero() {
+			continue
+		}
+
+		scheduled := &models.ScheduledTournament{
+			Schedule:            run.schedule.Name,
+			Format:              run.schedule.Format,
+			MaxPlayers:          run.schedule.MaxPlayers,
+			MinRating:           run.schedule.MinRating,
+			MaxRating:           run.schedule.MaxRating,
+			RegistrationOpensAt: run.startsAt.Add(-run.schedule.Registration),
+			StartsAt:            run.startsAt,
+		}
+		if run.tournamentID != uuid.Nil {
+			tournamentID := run.tournamentID
+			scheduled.TournamentID = &tournamentID
+		}
+		upcoming = append(upcoming, scheduled)
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].StartsAt.Before(upcoming[j].StartsAt)
+	})
+	return upcoming
+}
+
+// scheduleProcessor periodically opens registration and starts tournaments that are due
+func (s *Scheduler) scheduleProcessor() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.processSchedules(now)
+		}
+	}
+}
+
+// processSchedules moves every schedule along to the given time. Nothing is
+// opened or started while the service drains.
+func (s *Scheduler) processSchedules(now time.Time) {
+	if s.service.Draining() {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, run := range s.runs {
+		if run.tournamentID == uuid.Nil {
+			if now.Before(run.startsAt.Add(-run.schedule.Registration)) {
+				continue
+			}
+			s.openRegistration(run, now)
+			continue
+		}
+
+		if now.Before(run.startsAt) {
+			continue
+		}
+		s.startTournament(run)
+		run.tournamentID = uuid.Nil
+		run.startsAt = run.next(now)
+	}
+}
+
+// openRegistration creates the tournament for the run's next occurrence;
+// callers must hold the mutex
+func (s *Scheduler) openRegistration(run *scheduledRun, now time.Time) {
+	startsAt := run.startsAt
+	t, err := s.service.create(&models.Tournament{
+		Name:       fmt.Sprintf("%s %s", run.schedule.Name, startsAt.Format("2006-01-02")),
+		Format:     run.schedule.Format,
+		MaxPlayers: run.schedule.MaxPlayers,
+		MinRating:  run.schedule.MinRating,
+		MaxRating:  run.schedule.MaxRating,
+		Schedule:   run.schedule.Name,
+		StartsAt:   &startsAt,
+	})
+	if err != nil {
+		// Skip this occurrence, the schedule itself is broken
+		log.Printf("Failed to create scheduled tournament %s: %v", run.schedule.Name, err)
+		run.startsAt = run.next(now)
+		return
+	}
+
+	run.tournamentID = t.ID
+}
+
+// startTournament starts the run's tournament, cancelling it if too few
+// players registered; callers must hold the mutex
+func (s *Scheduler) startTournament(run *scheduledRun) {
+	_, err := s.service.Start(run.tournamentID)
+	switch err {
+	case nil:
+	case ErrNotEnoughPlayers:
+		log.Printf("Cancelling scheduled tournament %s: not enough players", run.schedule.Name)
+		if err := s.service.Cancel(run.tournamentID); err != nil {
+			log.Printf("Failed to cancel scheduled tournament %s: %v", run.schedule.Name, err)
+		}
+	case ErrTournamentNotFound, ErrAlreadyStarted, ErrAlreadyFinished:
+		// Started or cancelled by hand before the scheduled time
+	case ErrDraining:
+		log.Printf("Not starting scheduled tournament %s, the server is draining", run.schedule.Name)
+	default:
+		log.Printf("Failed to start scheduled tournament %s: %v", run.schedule.Name, err)
+	}
+}
+
+// next returns the first scheduled start after the given time
+func (r *scheduledRun) next(after time.Time) time.Time {
+	after = after.UTC()
+	startsAt := time.Date(after.Year(), after.Month(), after.Day(), r.hour, r.minute, 0, 0, time.UTC)
+	for !startsAt.After(after) || !r.runsOn(startsAt.Weekday()) {
+		startsAt = startsAt.AddDate(0, 0, 1)
+	}
+	return startsAt
+}
+
+func (r *scheduledRun) runsOn(weekday time.Weekday) bool {
+	if len(r.schedule.Weekdays) == 0 {
+		return true
+	}
+	for _, day := range r.schedule.Weekdays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
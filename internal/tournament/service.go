@@ -0,0 +1,653 @@
+package tournament
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// EventType identifies a tournament lifecycle event
+type EventType string
+
+const (
+	EventCreated       EventType = "tournament_created"
+	EventStarted       EventType = "tournament_started"
+	EventMatchFinished EventType = "tournament_match_finished"
+	EventFinished      EventType = "tournament_finished"
+	EventCancelled     EventType = "tournament_cancelled"
+)
+
+// Event describes a change in a tournament. Tournament and Match are snapshots
+// taken when the event happened.
+type Event struct {
+	Type       EventType
+	Tournament *models.Tournament
+	Match      *models.TournamentMatch // set for match events only
+}
+
+// Config holds tournament limits
+type Config struct {
+	MinPlayers        int `json:"min_players"`
+	MaxPlayers        int `json:"max_players"`
+	DefaultMaxPlayers int `json:"default_max_players"`
+	MaxReplays        int `json:"max_replays"`  // drawn elimination games replayed before the higher seed advances
+	SwissRounds       int `json:"swiss_rounds"` // 0 plays enough rounds to separate the players
+}
+
+// DefaultConfig returns tournaments of 2 to 64 players, 16 unless the
+// organizer sets another size, where a drawn elimination game is replayed
+// twice before the higher seed advances
+func DefaultConfig() Config {
+	return Config{
+		MinPlayers:        2,
+		MaxPlayers:        64,
+		DefaultMaxPlayers: 16,
+		MaxReplays:        2,
+	}
+}
+
+// RatingProvider interface for looking up player ratings used for seeding
+type RatingProvider interface {
+	CurrentRating(username string) int
+}
+
+// Service runs tournaments and schedules their games on the game manager
+type Service struct {
+	config         Config
+	gameManager    *game.Manager
+	ratingProvider RatingProvider
+
+	tournaments map[uuid.UUID]*models.Tournament
+	conns       map[uuid.UUID]game.WSConnection // registered players' connections
+	games       map[uuid.UUID]gameRef           // tournament games by game ID
+
+	listeners []func(Event)
+	draining  bool // no tournaments or games are started
+	mutex     sync.Mutex
+}
+
+// gameRef links a running game to its place in a bracket
+type gameRef struct {
+	tournament *models.Tournament
+	match      *models.TournamentMatch
+}
+
+// outbox collects messages and events while the mutex is held so they can be
+// delivered after it is released
+type outbox struct {
+	messages []outboundMessage
+	events   []Event
+}
+
+type outboundMessage struct {
+	conn    game.WSConnection
+	message models.WSMessage
+}
+
+// NewService creates a tournament service that advances brackets as games finish
+func NewService(config Config, gameManager *game.Manager) *Service {
+	s := &Service{
+		config:      config,
+		gameManager: gameManager,
+		tournaments: make(map[uuid.UUID]*models.Tournament),
+		conns:       make(map[uuid.UUID]game.WSConnection),
+		games:       make(map[uuid.UUID]gameRef),
+	}
+
+	gameManager.OnGameEnd(s.handleGameEnd)
+
+	return s
+}
+
+// SetRatingProvider sets the source of ratings used to seed players
+func (s *Service) SetRatingProvider(ratingProvider RatingProvider) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ratingProvider = ratingProvider
+}
+
+// OnEvent registers a listener that is called (asynchronously) for every lifecycle event
+func (s *Service) OnEvent(listener func(Event)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// Create opens registration for a new tournament. An empty format is single
+// elimination and a maxPlayers of 0 uses the default.
+func (s *Service) Create(name string, format models.TournamentFormat, maxPlayers int) (*models.Tournament, error) {
+	return s.create(&models.Tournament{
+		Name:       name,
+		Format:     format,
+		MaxPlayers: maxPlayers,
+	})
+}
+
+// create validates a new tournament and opens its registration
+func (s *Service) create(t *models.Tournament) (*models.Tournament, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return nil, ErrInvalidName
+	}
+	switch t.Format {
+	case "":
+		t.Format = models.TournamentSingleElimination
+	case models.TournamentSingleElimination, models.TournamentSwiss, models.TournamentRoundRobin:
+	default:
+		return nil, ErrInvalidFormat
+	}
+	if t.MaxPlayers == 0 {
+		t.MaxPlayers = s.config.DefaultMaxPlayers
+	}
+	if t.MaxPlayers < s.config.MinPlayers || t.MaxPlayers > s.config.MaxPlayers {
+		return nil, ErrInvalidMaxPlayers
+	}
+
+	t.ID = uuid.New()
+	t.Status = models.TournamentRegistration
+	t.Players = []*models.TournamentPlayer{}
+	t.CreatedAt = time.Now()
+
+	out := &outbox{}
+
+	s.mutex.Lock()
+	s.tournaments[t.ID] = t
+	out.event(EventCreated, t, nil)
+	snapshot := snapshotTournament(t)
+	s.mutex.Unlock()
+
+	s.flush(out)
+
+	log.Printf("Tournament %s (%s, %s) created, registration open for %d players", t.Name, t.ID, t.Format, t.MaxPlayers)
+	return snapshot, nil
+}
+
+// Get returns a snapshot of the tournament
+func (s *Service) Get(tournamentID uuid.UUID) (*models.Tournament, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t, exists := s.tournaments[tournamentID]
+	if !exists {
+		return nil, ErrTournamentNotFound
+	}
+	return snapshotTournament(t), nil
+}
+
+// List returns snapshots of all tournaments, newest first
+func (s *Service) List() []*models.Tournament {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tournaments := make([]*models.Tournament, 0, len(s.tournaments))
+	for _, t := range s.tournaments {
+		tournaments = append(tournaments, snapshotTournament(t))
+	}
+	sort.Slice(tournaments, func(i, j int) bool {
+		return tournaments[i].CreatedAt.After(tournaments[j].CreatedAt)
+	})
+	return tournaments
+}
+
+// Register signs a player up for a tournament. The connection receives bracket
+// updates and is attached to the player's tournament games.
+func (s *Service) Register(tournamentID, playerID uuid.UUID, name string, conn game.WSConnection) (*models.Tournament, error) {
+	out := &outbox{}
+
+	s.mutex.Lock()
+	t, exists := s.tournaments[tournamentID]
+	if !exists {
+		s.mutex.Unlock()
+		return nil, ErrTournamentNotFound
+	}
+	if t.Status != models.TournamentRegistration {
+		s.mutex.Unlock()
+		return nil, ErrRegistrationClosed
+	}
+	if _, registered := s.conns[playerID]; registered {
+		s.mutex.Unlock()
+		return nil, ErrAlreadyRegistered
+	}
+	if len(t.Players) >= t.MaxPlayers {
+		s.mutex.Unlock()
+		return nil, ErrTournamentFull
+	}
+	if (t.MinRating > 0 || t.MaxRating > 0) && s.ratingProvider != nil {
+		rating := s.ratingProvider.CurrentRating(name)
+		if (t.MinRating > 0 && rating < t.MinRating) || (t.MaxRating > 0 && rating > t.MaxRating) {
+			s.mutex.Unlock()
+			return nil, ErrEntryRequirements
+		}
+	}
+
+	t.Players = append(t.Players, &models.TournamentPlayer{ID: playerID, Name: name})
+	s.conns[playerID] = conn
+	s.broadcast(t, out)
+	snapshot := snapshotTournament(t)
+	s.mutex.Unlock()
+
+	s.flush(out)
+
+	log.Printf("Player %s (%s) registered for tournament %s", name, playerID, t.Name)
+	return snapshot, nil
+}
+
+// Unregister removes a player from a tournament that has not started yet
+func (s *Service) Unregister(tournamentID, playerID uuid.UUID) error {
+	out := &outbox{}
+
+	s.mutex.Lock()
+	t, exists := s.tournaments[tournamentID]
+	if !exists {
+		s.mutex.Unlock()
+		return ErrTournamentNotFound
+	}
+	if t.Status != models.TournamentRegistration {
+		s.mutex.Unlock()
+		return ErrAlreadyStarted
+	}
+	if !s.removePlayer(t, playerID) {
+		s.mutex.Unlock()
+		return ErrNotRegistered
+	}
+	delete(s.conns, playerID)
+	s.broadcast(t, out)
+	s.mutex.Unlock()
+
+	s.flush(out)
+	return nil
+}
+
+// Disconnect drops a player's connection. Players leave tournaments that are
+// still open for registration; in running tournaments their games are forfeited
+// by the game manager if they don't come back.
+func (s *Service) Disconnect(playerID uuid.UUID) {
+	out := &outbox{}
+
+	s.mutex.Lock()
+	if _, registered := s.conns[playerID]; !registered {
+		s.mutex.Unlock()
+		return
+	}
+	delete(s.conns, playerID)
+
+	for _, t := range s.tournaments {
+		if t.Status == models.TournamentRegistration && s.removePlayer(t, playerID) {
+			s.broadcast(t, out)
+		}
+	}
+	s.mutex.Unlock()
+
+	s.flush(out)
+}
+
+// Drain stops the service from starting tournaments and their games, ahead
+// of a shutdown. Games already being played are played out, matches that
+// become ready after them wait and aren't played on this server.
+func (s *Service) Drain() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.draining {
+		s.draining = true
+		log.Println("Tournament service draining, no new tournament games")
+	}
+}
+
+// Draining reports whether Drain was called
+func (s *Service) Draining() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.draining
+}
+
+// Start seeds the registered players, lays out the tournament for its format
+// and schedules the first round
+func (s *Service) Start(tournamentID uuid.UUID) (*models.Tournament, error) {
+	out := &outbox{}
+
+	s.mutex.Lock()
+	t, exists := s.tournaments[tournamentID]
+	if !exists {
+		s.mutex.Unlock()
+		return nil, ErrTournamentNotFound
+	}
+	if t.Status != models.TournamentRegistration {
+		s.mutex.Unlock()
+		return nil, ErrAlreadyStarted
+	}
+	if len(t.Players) < s.config.MinPlayers {
+		s.mutex.Unlock()
+		return nil, ErrNotEnoughPlayers
+	}
+	if s.draining {
+		s.mutex.Unlock()
+		return nil, ErrDraining
+	}
+
+	s.seedPlayers(t)
+	t.Status = models.TournamentInProgress
+	now := time.Now()
+	t.StartedAt = &now
+	out.event(EventStarted, t, nil)
+
+	switch t.Format {
+	case models.TournamentSwiss:
+		s.startSwiss(t, out)
+	case models.TournamentRoundRobin:
+		s.startRoundRobin(t, out)
+	default:
+		s.startBracket(t, out)
+	}
+
+	s.broadcast(t, out)
+	if t.Status == models.TournamentFinished {
+		s.releasePlayers(t)
+	}
+	snapshot := snapshotTournament(t)
+	s.mutex.Unlock()
+
+	s.flush(out)
+
+	log.Printf("Tournament %s started with %d players over %d rounds", t.Name, len(t.Players), t.TotalRounds)
+	return snapshot, nil
+}
+
+// Cancel stops a tournament. Games already being played finish normally but no
+// longer count.
+func (s *Service) Cancel(tournamentID uuid.UUID) error {
+	out := &outbox{}
+
+	s.mutex.Lock()
+	t, exists := s.tournaments[tournamentID]
+	if !exists {
+		s.mutex.Unlock()
+		return ErrTournamentNotFound
+	}
+	if t.Status == models.TournamentFinished || t.Status == models.TournamentCancelled {
+		s.mutex.Unlock()
+		return ErrAlreadyFinished
+	}
+
+	t.Status = models.TournamentCancelled
+	now := time.Now()
+	t.FinishedAt = &now
+	out.event(EventCancelled, t, nil)
+	s.broadcast(t, out)
+	s.releasePlayers(t)
+	s.mutex.Unlock()
+
+	s.flush(out)
+
+	log.Printf("Tournament %s cancelled", t.Name)
+	return nil
+}
+
+// handleGameEnd records the result when a tournament game finishes
+func (s *Service) handleGameEnd(g *models.Game) {
+	if g.QueueType != models.QueueTypeTournament {
+		return
+	}
+
+	out := &outbox{}
+
+	s.mutex.Lock()
+	ref, exists := s.games[g.ID]
+	if !exists {
+		s.mutex.Unlock()
+		return
+	}
+	delete(s.games, g.ID)
+
+	t, match := ref.tournament, ref.match
+	if t.Status != models.TournamentInProgress {
+		s.mutex.Unlock()
+		return
+	}
+
+	var winner *models.TournamentPlayer
+	if g.Winner != nil {
+		winner = match.Player1
+		if g.Players[*g.Winner].ID == match.Player2.ID {
+			winner = match.Player2
+		}
+	}
+
+	switch {
+	case t.Format != models.TournamentSingleElimination:
+		// Swiss and round-robin games count draws as they are
+		s.recordResult(t, match, winner, out)
+	case winner != nil:
+		s.advance(t, match, winner, out)
+	case match.Replays < s.config.MaxReplays:
+		// Drawn games are replayed, colors swap so nobody keeps the first move
+		match.Replays++
+		s.schedule(t, match, out)
+	default:
+		// Still level after the replays, the higher seed goes through
+		winner = match.Player1
+		if match.Player2.Seed < match.Player1.Seed {
+			winner = match.Player2
+		}
+		s.advance(t, match, winner, out)
+	}
+
+	s.broadcast(t, out)
+	if t.Status == models.TournamentFinished {
+		s.releasePlayers(t)
+	}
+	s.mutex.Unlock()
+
+	s.flush(out)
+}
+
+// schedule starts the game for a match whose players are both known, unless
+// the service is draining; callers must hold the mutex
+func (s *Service) schedule(t *models.Tournament, match *models.TournamentMatch, out *outbox) {
+	if s.draining {
+		log.Printf("Tournament %s round %d: not starting %s vs %s, the server is draining",
+			t.Name, match.Round, match.Player1.Name, match.Player2.Name)
+		return
+	}
+
+	first, second := match.Player1, match.Player2
+	if match.Replays%2 == 1 {
+		first, second = second, first
+	}
+
+	now := time.Now()
+	players := [2]*models.Player{}
+	for i, player := range []*models.TournamentPlayer{first, second} {
+		_, connected := s.conns[player.ID]
+		players[i] = &models.Player{
+			ID:        player.ID,
+			Name:      player.Name,
+			Connected: connected,
+			LastSeen:  now, // absent players forfeit after the usual grace period
+		}
+	}
+
+	gameInstance := s.gameManager.CreateGame(players[0], players[1], models.QueueTypeTournament)
+	match.GameID = &gameInstance.ID
+	match.Status = models.TournamentMatchPlaying
+	s.games[gameInstance.ID] = gameRef{tournament: t, match: match}
+
+	for _, player := range players {
+		conn, connected := s.conns[player.ID]
+		if !connected {
+			continue
+		}
+
+		s.gameManager.AddPlayerConnection(player.ID, gameInstance.ID, conn)
+		out.send(conn, models.NewWSMessage(models.MsgGameFound, models.GameFoundPayload{
+			Game:     gameInstance,
+			PlayerID: player.ID,
+		}))
+	}
+
+	log.Printf("Tournament %s round %d: %s vs %s (Game ID: %s)",
+		t.Name, match.Round, first.Name, second.Name, gameInstance.ID)
+}
+
+// advance records the match winner and moves them into the next round,
+// finishing the tournament after the final; callers must hold the mutex
+func (s *Service) advance(t *models.Tournament, match *models.TournamentMatch, winner *models.TournamentPlayer, out *outbox) {
+	match.WinnerID = &winner.ID
+	match.Status = models.TournamentMatchFinished
+	for _, player := range []*models.TournamentPlayer{match.Player1, match.Player2} {
+		if player != nil && player.ID != winner.ID {
+			player.Eliminated = true
+		}
+	}
+	out.event(EventMatchFinished, t, match)
+
+	if match.Round == len(t.Rounds) {
+		s.finish(t, winner, out)
+		return
+	}
+
+	next := t.Rounds[match.Round].Matches[match.Slot/2]
+	if match.Slot%2 == 0 {
+		next.Player1 = winner
+	} else {
+		next.Player2 = winner
+	}
+
+	if next.Player1 != nil && next.Player2 != nil {
+		s.schedule(t, next, out)
+	}
+}
+
+// finish ends the tournament with the given winner; callers must hold the mutex
+func (s *Service) finish(t *models.Tournament, winner *models.TournamentPlayer, out *outbox) {
+	t.WinnerID = &winner.ID
+	t.Status = models.TournamentFinished
+	now := time.Now()
+	t.FinishedAt = &now
+	out.event(EventFinished, t, nil)
+
+	log.Printf("Tournament %s won by %s", t.Name, winner.Name)
+}
+
+// seedPlayers orders players by rating, keeping registration order between
+// equal ratings; callers must hold the mutex
+func (s *Service) seedPlayers(t *models.Tournament) {
+	if s.ratingProvider != nil {
+		ratings := make(map[uuid.UUID]int, len(t.Players))
+		for _, player := range t.Players {
+			ratings[player.ID] = s.ratingProvider.CurrentRating(player.Name)
+		}
+		sort.SliceStable(t.Players, func(i, j int) bool {
+			return ratings[t.Players[i].ID] > ratings[t.Players[j].ID]
+		})
+	}
+
+	for i, player := range t.Players {
+		player.Seed = i + 1
+	}
+}
+
+// removePlayer drops a player from the registration list; callers must hold the mutex
+func (s *Service) removePlayer(t *models.Tournament, playerID uuid.UUID) bool {
+	for i, player := range t.Players {
+		if player.ID == playerID {
+			t.Players = append(t.Players[:i], t.Players[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// releasePlayers lets the players of a finished tournament register for another
+// one; callers must hold the mutex and broadcast the final bracket first
+func (s *Service) releasePlayers(t *models.Tournament) {
+	for _, player := range t.Players {
+		delete(s.conns, player.ID)
+	}
+}
+
+// broadcast queues the current bracket for every connected player; callers must hold the mutex
+func (s *Service) broadcast(t *models.Tournament, out *outbox) {
+	message := models.NewWSMessage(models.MsgTournamentUpdate, models.TournamentUpdatePayload{
+		Tournament: snapshotTournament(t),
+	})
+
+	for _, player := range t.Players {
+		if conn, connected := s.conns[player.ID]; connected {
+			out.send(conn, message)
+		}
+	}
+}
+
+// flush delivers queued messages and events; callers must not hold the mutex
+func (s *Service) flush(out *outbox) {
+	for _, outbound := range out.messages {
+		if err := outbound.conn.WriteJSON(outbound.message); err != nil {
+			log.Printf("Failed to send tournament message: %v", err)
+		}
+	}
+
+	if len(out.events) == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	listeners := s.listeners
+	s.mutex.Unlock()
+
+	for _, event := range out.events {
+		for _, listener := range listeners {
+			go listener(event)
+		}
+	}
+}
+
+func (o *outbox) send(conn game.WSConnection, message models.WSMessage) {
+	o.messages = append(o.messages, outboundMessage{conn: conn, message: message})
+}
+
+func (o *outbox) event(eventType EventType, t *models.Tournament, match *models.TournamentMatch) {
+	event := Event{Type: eventType, Tournament: snapshotTournament(t)}
+	if match != nil {
+		event.Match = snapshotMatch(match)
+	}
+	o.events = append(o.events, event)
+}
+
+// snapshotMatch copies a match and its players
+func snapshotMatch(match *models.TournamentMatch) *models.TournamentMatch {
+	copied := *match
+	if match.Player1 != nil {
+		player := *match.Player1
+		copied.Player1 = &player
+	}
+	if match.Player2 != nil {
+		player := *match.Player2
+		copied.Player2 = &player
+	}
+	return &copied
+}
+
+// snapshotTournament deep copies a tournament so it can be read without the mutex
+func snapshotTournament(t *models.Tournament) *models.Tournament {
+	data, err := json.Marshal(t)
+	if err != nil {
+		log.Printf("Failed to snapshot tournament %s: %v", t.ID, err)
+		return &models.Tournament{ID: t.ID, Name: t.Name, Status: t.Status}
+	}
+
+	var snapshot models.Tournament
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		log.Printf("Failed to snapshot tournament %s: %v", t.ID, err)
+		return &models.Tournament{ID: t.ID, Name: t.Name, Status: t.Status}
+	}
+	return &snapshot
+}
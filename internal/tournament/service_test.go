@@ -0,0 +1,419 @@
+package tournament
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/game"
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// testConn is a connection that drops what it is sent
+type testConn struct{}
+
+func (testConn) WriteJSON(v interface{}) error { return nil }
+func (testConn) Close() error                  { return nil }
+
+func newTestService(t *testing.T) (*Service, *game.Manager) {
+	t.Helper()
+	manager := game.NewManager()
+	return NewService(DefaultConfig(), manager), manager
+}
+
+// newTournament creates a tournament with the players registered
+func newTournament(t *testing.T, s *Service, format models.TournamentFormat, players int) *models.Tournament {
+	t.Helper()
+	created, err := s.Create("Test Cup", format, players)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < players; i++ {
+		if _, err := s.Register(created.ID, uuid.New(), fmt.Sprintf("player%d", i+1), testConn{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return created
+}
+
+// waitFor polls the tournament until done is true of it
+func waitFor(t *testing.T, s *Service, tournamentID uuid.UUID, done func(*models.Tournament) bool) *models.Tournament {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		current, err := s.Get(tournamentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done(current) {
+			return current
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tournament never got there, it is %+v", current)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// finishRound wins every game being played in the round for red
+func finishRound(t *testing.T, m *game.Manager, round *models.TournamentRound) {
+	t.Helper()
+	red := models.PlayerRed
+	for _, match := range round.Matches {
+		if match.GameID == nil || match.Status != models.TournamentMatchPlaying {
+			continue
+		}
+		if _, err := m.EndGame(*match.GameID, &red); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testRatings rates players by name
+type testRatings map[string]int
+
+func (r testRatings) CurrentRating(username string) int { return r[username] }
+
+// playOut plays every tournament game as it starts until the tournament is
+// over, with result picking each game's winning color, nil for a draw
+func playOut(t *testing.T, s *Service, m *game.Manager, tournamentID uuid.UUID, result func(*models.TournamentMatch) *models.PlayerColor) *models.Tournament {
+	t.Helper()
+	ended := make(map[uuid.UUID]bool)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current, err := s.Get(tournamentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current.Status != models.TournamentInProgress {
+			return current
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tournament never finished, it is %+v", current)
+		}
+
+		for _, round := range current.Rounds {
+			for _, match := range round.Matches {
+				if match.Status != models.TournamentMatchPlaying || ended[*match.GameID] {
+					continue
+				}
+				ended[*match.GameID] = true
+				if _, err := m.EndGame(*match.GameID, result(match)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// redWins wins every game for the player moving first
+func redWins(*models.TournamentMatch) *models.PlayerColor {
+	red := models.PlayerRed
+	return &red
+}
+
+// eventRecorder collects the service's events, which are delivered
+// asynchronously
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func recordEvents(s *Service) *eventRecorder {
+	recorder := &eventRecorder{}
+	s.OnEvent(func(event Event) {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		recorder.events = append(recorder.events, event)
+	})
+	return recorder
+}
+
+// count waits for the events to arrive and returns how many of each type came
+func (r *eventRecorder) count(t *testing.T, total int) map[EventType]int {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		events := append([]Event(nil), r.events...)
+		r.mu.Unlock()
+		if len(events) >= total || time.Now().After(deadline) {
+			counts := make(map[EventType]int)
+			for _, event := range events {
+				counts[event.Type]++
+			}
+			return counts
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCreateRejects(t *testing.T) {
+	s, _ := newTestService(t)
+	tests := []struct {
+		name       string
+		title      string
+		format     models.TournamentFormat
+		maxPlayers int
+		want       error
+	}{
+		{"no name", "  ", "", 8, ErrInvalidName},
+		{"unknown format", "Cup", "double_elimination", 8, ErrInvalidFormat},
+		{"too few players", "Cup", "", 1, ErrInvalidMaxPlayers},
+		{"too many players", "Cup", "", 65, ErrInvalidMaxPlayers},
+	}
+	for _, tt := range tests {
+		if _, err := s.Create(tt.title, tt.format, tt.maxPlayers); err != tt.want {
+			t.Errorf("%s: Create = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	created, err := s.Create(" Cup ", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "Cup" || created.Format != models.TournamentSingleElimination || created.MaxPlayers != DefaultConfig().DefaultMaxPlayers {
+		t.Errorf("Create with defaults = %+v", created)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	s, _ := newTestService(t)
+	created, err := s.Create("Cup", models.TournamentSingleElimination, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Create("Other Cup", models.TournamentSingleElimination, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := uuid.New()
+	if _, err := s.Start(created.ID); err != ErrNotEnoughPlayers {
+		t.Errorf("Start without players = %v, want %v", err, ErrNotEnoughPlayers)
+	}
+	if _, err := s.Register(created.ID, alice, "alice", testConn{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		tournamentID uuid.UUID
+		want         error
+	}{
+		{"twice", created.ID, ErrAlreadyRegistered},
+		{"in another tournament", other.ID, ErrAlreadyRegistered},
+		{"unknown tournament", uuid.New(), ErrTournamentNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := s.Register(tt.tournamentID, alice, "alice", testConn{}); err != tt.want {
+			t.Errorf("%s: Register = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := s.Unregister(created.ID, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Unregister(created.ID, alice); err != ErrNotRegistered {
+		t.Errorf("Unregister twice = %v, want %v", err, ErrNotRegistered)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := s.Register(created.ID, uuid.New(), name, testConn{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Register(created.ID, uuid.New(), "carol", testConn{}); err != ErrTournamentFull {
+		t.Errorf("Register in a full tournament = %v, want %v", err, ErrTournamentFull)
+	}
+
+	if _, err := s.Start(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Start(created.ID); err != ErrAlreadyStarted {
+		t.Errorf("Start twice = %v, want %v", err, ErrAlreadyStarted)
+	}
+	if _, err := s.Register(created.ID, uuid.New(), "dave", testConn{}); err != ErrRegistrationClosed {
+		t.Errorf("Register after the start = %v, want %v", err, ErrRegistrationClosed)
+	}
+}
+
+func TestEntryRequirements(t *testing.T) {
+	s, _ := newTestService(t)
+	s.SetRatingProvider(testRatings{"novice": 900, "expert": 1900})
+	created, err := s.create(&models.Tournament{Name: "Club Cup", MinRating: 1000, MaxRating: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"novice", "expert"} {
+		if _, err := s.Register(created.ID, uuid.New(), name, testConn{}); err != ErrEntryRequirements {
+			t.Errorf("Register %s = %v, want %v", name, err, ErrEntryRequirements)
+		}
+	}
+}
+
+func TestSingleEliminationToChampion(t *testing.T) {
+	s, m := newTestService(t)
+	// Seeded by rating, player5 first
+	s.SetRatingProvider(testRatings{"player1": 1100, "player2": 1200, "player3": 1300, "player4": 1400, "player5": 1500})
+	events := recordEvents(s)
+	created := newTournament(t, s, models.TournamentSingleElimination, 5)
+
+	started, err := s.Start(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started.TotalRounds != 3 || started.Players[0].Name != "player5" || started.Players[0].Seed != 1 {
+		t.Fatalf("started with %d rounds and %s seeded first", started.TotalRounds, started.Players[0].Name)
+	}
+	// The top three seeds have byes into the second round
+	byes := 0
+	for _, match := range started.Rounds[0].Matches {
+		if match.Bye {
+			byes++
+			if match.Status != models.TournamentMatchFinished || *match.WinnerID != match.Player1.ID {
+				t.Errorf("bye %+v didn't advance its player", match)
+			}
+		}
+	}
+	if byes != 3 {
+		t.Errorf("%d byes, want 3", byes)
+	}
+
+	// Red is the first player of each match, which is the higher seed
+	finished := playOut(t, s, m, created.ID, redWins)
+	if finished.Status != models.TournamentFinished || finished.WinnerID == nil || *finished.WinnerID != finished.Players[0].ID {
+		t.Fatalf("tournament %s won by %v, want the top seed", finished.Status, finished.WinnerID)
+	}
+	for _, player := range finished.Players {
+		if player.Eliminated == (player.Seed == 1) {
+			t.Errorf("seed %d eliminated: %v", player.Seed, player.Eliminated)
+		}
+	}
+	if final := finished.Rounds[2].Matches[0]; final.Player1.Seed != 1 || final.Player2.Seed != 2 {
+		t.Errorf("final between seeds %d and %d, want 1 and 2", final.Player1.Seed, final.Player2.Seed)
+	}
+
+	// Created, started, 3 byes and 4 games, finished
+	counts := events.count(t, 10)
+	want := map[EventType]int{EventCreated: 1, EventStarted: 1, EventMatchFinished: 7, EventFinished: 1}
+	for eventType, n := range want {
+		if counts[eventType] != n {
+			t.Errorf("%d %s events, want %d", counts[eventType], eventType, n)
+		}
+	}
+
+	// Players can enter another tournament once it is over
+	next, err := s.Create("Next Cup", models.TournamentSingleElimination, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Register(next.ID, finished.Players[0].ID, "player5", testConn{}); err != nil {
+		t.Errorf("the champion can't register again: %v", err)
+	}
+}
+
+func TestDrawnMatchReplayedThenHigherSeedAdvances(t *testing.T) {
+	s, m := newTestService(t)
+	s.SetRatingProvider(testRatings{"player1": 1000, "player2": 1200})
+	created := newTournament(t, s, models.TournamentSingleElimination, 2)
+	if _, err := s.Start(created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var firstMovers []string
+	finished := playOut(t, s, m, created.ID, func(match *models.TournamentMatch) *models.PlayerColor {
+		gameInstance, _ := m.GetGame(*match.GameID)
+		firstMovers = append(firstMovers, gameInstance.Players[models.PlayerRed].Name)
+		return nil
+	})
+
+	// Two replays with colors swapped each time, then the top seed goes through
+	if want := []string{"player2", "player1", "player2"}; fmt.Sprint(firstMovers) != fmt.Sprint(want) {
+		t.Errorf("first moves by %v, want %v", firstMovers, want)
+	}
+	final := finished.Rounds[0].Matches[0]
+	if final.Replays != DefaultConfig().MaxReplays || finished.WinnerID == nil || *finished.WinnerID != final.Player1.ID || final.Player1.Name != "player2" {
+		t.Errorf("final %+v won by %v, want player2 after %d replays", final, finished.WinnerID, DefaultConfig().MaxReplays)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s, m := newTestService(t)
+	created := newTournament(t, s, models.TournamentSingleElimination, 4)
+	started, err := s.Start(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Cancel(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cancel(created.ID); err != ErrAlreadyFinished {
+		t.Errorf("Cancel twice = %v, want %v", err, ErrAlreadyFinished)
+	}
+
+	// Games already being played no longer count
+	finishRound(t, m, started.Rounds[0])
+	time.Sleep(20 * time.Millisecond)
+	cancelled, err := s.Get(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != models.TournamentCancelled || cancelled.Rounds[1].Matches[0].Player1 != nil {
+		t.Errorf("cancelled tournament moved on: %s, final %+v", cancelled.Status, cancelled.Rounds[1].Matches[0])
+	}
+}
+
+func TestDrainRefusesStart(t *testing.T) {
+	s, _ := newTestService(t)
+	created := newTournament(t, s, models.TournamentSingleElimination, 2)
+
+	s.Drain()
+	if _, err := s.Start(created.ID); err != ErrDraining {
+		t.Errorf("Start while draining = %v, want %v", err, ErrDraining)
+	}
+}
+
+func TestDrainHoldsNextMatch(t *testing.T) {
+	s, m := newTestService(t)
+	created := newTournament(t, s, models.TournamentSingleElimination, 4)
+	started, err := s.Start(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playing, _ := m.DrainCounts(); playing != 2 {
+		t.Fatalf("%d games started for the first round, want 2", playing)
+	}
+
+	s.Drain()
+	finishRound(t, m, started.Rounds[0])
+
+	final := waitFor(t, s, created.ID, func(current *models.Tournament) bool {
+		match := current.Rounds[1].Matches[0]
+		return match.Player1 != nil && match.Player2 != nil
+	}).Rounds[1].Matches[0]
+	if final.GameID != nil || final.Status != models.TournamentMatchPending {
+		t.Errorf("the final was started while draining, it is %s with game %v", final.Status, final.GameID)
+	}
+	if playing, _ := m.DrainCounts(); playing != 0 {
+		t.Errorf("%d games are being played after the first round, want none", playing)
+	}
+}
+
+func TestSchedulerIdleWhileDraining(t *testing.T) {
+	s, _ := newTestService(t)
+	scheduler, err := NewScheduler(DefaultSchedulerConfig(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Drain()
+	scheduler.processSchedules(time.Now())
+	if tournaments := s.List(); len(tournaments) != 0 {
+		t.Errorf("the scheduler opened %d tournaments while draining", len(tournaments))
+	}
+}
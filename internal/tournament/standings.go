@@ -0,0 +1,107 @@
+package tournament
+
+import (
+	"sort"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// computeStandings scores every player and ranks them by points and then by
+// tie-breaks: Buchholz first in Swiss, where opponents differ, and
+// Sonneborn-Berger first in round-robin, where everyone meets the same field.
+// Seeds settle anything still level.
+func computeStandings(t *models.Tournament) []*models.TournamentStanding {
+	standings := make(map[uuid.UUID]*models.TournamentStanding, len(t.Players))
+	for _, player := range t.Players {
+		standings[player.ID] = &models.TournamentStanding{PlayerID: player.ID, Name: player.Name}
+	}
+
+	// Points each player took from each game, for the tie-breaks
+	type result struct {
+		opponent uuid.UUID
+		points   float64
+	}
+	results := make(map[uuid.UUID][]result)
+
+	for _, round := range t.Rounds {
+		for _, match := range round.Matches {
+			if match.Status != models.TournamentMatchFinished {
+				continue
+			}
+
+			if match.Bye {
+				if match.WinnerID != nil {
+					standings[match.Player1.ID].Score++
+				}
+				continue
+			}
+
+			points1, points2 := 0.5, 0.5
+			switch {
+			case match.Draw:
+				standings[match.Player1.ID].Draws++
+				standings[match.Player2.ID].Draws++
+			case *match.WinnerID == match.Player1.ID:
+				points1, points2 = 1, 0
+				standings[match.Player1.ID].Wins++
+				standings[match.Player2.ID].Losses++
+			default:
+				points1, points2 = 0, 1
+				standings[match.Player2.ID].Wins++
+				standings[match.Player1.ID].Losses++
+			}
+
+			standings[match.Player1.ID].Score += points1
+			standings[match.Player2.ID].Score += points2
+			results[match.Player1.ID] = append(results[match.Player1.ID], result{match.Player2.ID, points1})
+			results[match.Player2.ID] = append(results[match.Player2.ID], result{match.Player1.ID, points2})
+		}
+	}
+
+	seeds := make(map[uuid.UUID]int, len(t.Players))
+	ordered := make([]*models.TournamentStanding, 0, len(t.Players))
+	for _, player := range t.Players {
+		standing := standings[player.ID]
+		for _, r := range results[player.ID] {
+			opponentScore := standings[r.opponent].Score
+			standing.Buchholz += opponentScore
+			standing.SonnebornBerger += r.points * opponentScore
+		}
+		seeds[player.ID] = player.Seed
+		ordered = append(ordered, standing)
+	}
+
+	primary, secondary := byBuchholz, bySonnebornBerger
+	if t.Format == models.TournamentRoundRobin {
+		primary, secondary = bySonnebornBerger, byBuchholz
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if primary(a) != primary(b) {
+			return primary(a) > primary(b)
+		}
+		if secondary(a) != secondary(b) {
+			return secondary(a) > secondary(b)
+		}
+		return seeds[a.PlayerID] < seeds[b.PlayerID]
+	})
+
+	for i, standing := range ordered {
+		standing.Rank = i + 1
+	}
+	return ordered
+}
+
+func byBuchholz(standing *models.TournamentStanding) float64 {
+	return standing.Buchholz
+}
+
+func bySonnebornBerger(standing *models.TournamentStanding) float64 {
+	return standing.SonnebornBerger
+}
@@ -0,0 +1,121 @@
+package tournament
+
+import (
+	"testing"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// finishedMatch is a played match, won by winner or drawn when it is nil
+func finishedMatch(round int, player1, player2, winner *models.TournamentPlayer) *models.TournamentMatch {
+	match := &models.TournamentMatch{ID: uuid.New(), Round: round, Player1: player1, Player2: player2, Status: models.TournamentMatchFinished}
+	switch {
+	case player2 == nil:
+		match.Bye = true
+		if winner != nil {
+			match.WinnerID = &winner.ID
+		}
+	case winner == nil:
+		match.Draw = true
+	default:
+		match.WinnerID = &winner.ID
+	}
+	return match
+}
+
+func TestComputeStandings(t *testing.T) {
+	players := seededPlayers(4)
+	a, b, c, d := players[0], players[1], players[2], players[3]
+	tournament := &models.Tournament{
+		Format:  models.TournamentSwiss,
+		Players: players,
+		Rounds: []*models.TournamentRound{
+			{Number: 1, Matches: []*models.TournamentMatch{finishedMatch(1, a, b, a), finishedMatch(1, c, d, nil)}},
+			{Number: 2, Matches: []*models.TournamentMatch{finishedMatch(2, a, c, nil), finishedMatch(2, d, b, b)}},
+			// Games still being played don't count yet
+			{Number: 3, Matches: []*models.TournamentMatch{{Round: 3, Player1: a, Player2: d, Status: models.TournamentMatchPlaying}}},
+		},
+	}
+
+	// B and C are level on points and Buchholz, C drew with the leader and
+	// has the better Sonneborn-Berger
+	want := []models.TournamentStanding{
+		{Rank: 1, PlayerID: a.ID, Score: 1.5, Wins: 1, Draws: 1, Buchholz: 2, SonnebornBerger: 1.5},
+		{Rank: 2, PlayerID: c.ID, Score: 1, Draws: 2, Buchholz: 2, SonnebornBerger: 1},
+		{Rank: 3, PlayerID: b.ID, Score: 1, Wins: 1, Losses: 1, Buchholz: 2, SonnebornBerger: 0.5},
+		{Rank: 4, PlayerID: d.ID, Score: 0.5, Draws: 1, Losses: 1, Buchholz: 2, SonnebornBerger: 0.5},
+	}
+	standings := computeStandings(tournament)
+	if len(standings) != len(want) {
+		t.Fatalf("%d standings, want %d", len(standings), len(want))
+	}
+	for i, standing := range standings {
+		got := *standing
+		got.Name = ""
+		if got != want[i] {
+			t.Errorf("standing %d = %+v, want %+v", i+1, got, want[i])
+		}
+	}
+}
+
+func TestComputeStandingsTieBreakOrder(t *testing.T) {
+	players := seededPlayers(6)
+	a, b, c, d, e, f := players[0], players[1], players[2], players[3], players[4], players[5]
+	rounds := []*models.TournamentRound{
+		{Number: 1, Matches: []*models.TournamentMatch{finishedMatch(1, e, b, nil), finishedMatch(1, f, c, c), finishedMatch(1, a, d, d)}},
+		{Number: 2, Matches: []*models.TournamentMatch{finishedMatch(2, b, c, b), finishedMatch(2, a, e, nil), finishedMatch(2, d, f, f)}},
+		{Number: 3, Matches: []*models.TournamentMatch{finishedMatch(3, c, d, d), finishedMatch(3, b, a, b), finishedMatch(3, e, f, e)}},
+	}
+
+	// C and F both have a point. C met the stronger field, Buchholz 5.5 to
+	// 5, but F beat the stronger player, Sonneborn-Berger 2 to 1.
+	tests := []struct {
+		format        models.TournamentFormat
+		first, second *models.TournamentPlayer
+	}{
+		{models.TournamentSwiss, c, f},
+		{models.TournamentRoundRobin, f, c},
+	}
+	for _, tt := range tests {
+		standings := computeStandings(&models.Tournament{Format: tt.format, Players: players, Rounds: rounds})
+		rank := make(map[uuid.UUID]int)
+		for _, standing := range standings {
+			rank[standing.PlayerID] = standing.Rank
+		}
+		if rank[tt.first.ID] != 4 || rank[tt.second.ID] != 5 {
+			t.Errorf("%s: %s ranked %d and %s ranked %d, want 4 and 5",
+				tt.format, tt.first.Name, rank[tt.first.ID], tt.second.Name, rank[tt.second.ID])
+		}
+	}
+}
+
+func TestComputeStandingsByes(t *testing.T) {
+	players := seededPlayers(3)
+	a, b, c := players[0], players[1], players[2]
+
+	// A Swiss bye scores a point, a round-robin rest scores nothing. Neither
+	// counts towards the tie-breaks.
+	tests := []struct {
+		format    models.TournamentFormat
+		byeWinner *models.TournamentPlayer
+		want      float64
+	}{
+		{models.TournamentSwiss, c, 1},
+		{models.TournamentRoundRobin, nil, 0},
+	}
+	for _, tt := range tests {
+		rounds := []*models.TournamentRound{
+			{Number: 1, Matches: []*models.TournamentMatch{finishedMatch(1, a, b, a), finishedMatch(1, c, nil, tt.byeWinner)}},
+		}
+		for _, standing := range computeStandings(&models.Tournament{Format: tt.format, Players: players, Rounds: rounds}) {
+			if standing.PlayerID != c.ID {
+				continue
+			}
+			if standing.Score != tt.want || standing.Wins != 0 || standing.Buchholz != 0 || standing.SonnebornBerger != 0 {
+				t.Errorf("%s: player with the bye = %+v, want %v points and no tie-breaks", tt.format, standing, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Package tracing records spans of work across the server and the analytics
+// consumer with the OpenTelemetry SDK and exports them over OTLP/HTTP, to
+// Jaeger or any OpenTelemetry collector. Span contexts travel between
+// processes as W3C traceparent strings, in HTTP headers and in analytics
+// event metadata.
+//
+// A tracer is installed process-wide with SetTracer. Until one is, Start
+// returns nil spans, which do nothing, so instrumented code never checks
+// whether tracing is on.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"connect-four-backend/internal/metrics"
+)
+
+// SpanKind is the role of a span in the request
+type SpanKind = trace.SpanKind
+
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+	KindProducer = trace.SpanKindProducer
+	KindConsumer = trace.SpanKindConsumer
+)
+
+// Attribute is a key and a string, integer, float or boolean value
+type Attribute = attribute.KeyValue
+
+func String(key, value string) Attribute      { return attribute.String(key, value) }
+func Int(key string, value int) Attribute     { return attribute.Int(key, value) }
+func Int64(key string, value int64) Attribute { return attribute.Int64(key, value) }
+func Bool(key string, value bool) Attribute   { return attribute.Bool(key, value) }
+
+// traceContext reads and writes W3C traceparent headers
+var traceContext = propagation.TraceContext{}
+
+// Span is a timed piece of work. A nil span does nothing, every method can
+// be called on one.
+type Span struct {
+	span trace.Span
+}
+
+// TraceParent returns the span's W3C traceparent, empty for a nil span
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return TraceParent(trace.ContextWithSpan(context.Background(), s.span))
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attributes...)
+}
+
+// RecordError marks the span failed with the error, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span and hands it to the exporter if it was sampled.
+// Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// ContextWithRemoteParent returns a context whose spans continue the trace of
+// a span in another process, from its traceparent. Invalid traceparents
+// leave the context as it is.
+func ContextWithRemoteParent(ctx context.Context, traceParent string) context.Context {
+	return traceContext.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
+
+// TraceParent returns the traceparent of the span the context carries, empty
+// when it carries none. A remote parent alone isn't passed on, only spans
+// started here are.
+func TraceParent(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); !sc.IsValid() || sc.IsRemote() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// Config configures the tracer
+type Config struct {
+	// Names the process in the tracing backend
+	ServiceName    string
+	ServiceVersion string
+
+	// OTLP/HTTP endpoint spans are sent to, like http://jaeger:4318. Spans go
+	// to its /v1/traces.
+	Endpoint string
+
+	// Share of traces recorded, decided where the trace starts. Spans of a
+	// trace started elsewhere follow its decision.
+	SampleRate float64
+
+	// Spans waiting to be exported, later ones are dropped past it
+	QueueSize int
+
+	// Spans sent per request, and how long a span waits for a full batch
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// DefaultConfig returns the settings for a service exporting to the endpoint
+func DefaultConfig(serviceName, endpoint string) Config {
+	return Config{
+		ServiceName:   serviceName,
+		Endpoint:      endpoint,
+		SampleRate:    1,
+		QueueSize:     4096,
+		BatchSize:     512,
+		FlushInterval: 5 * time.Second,
+	}
+}
+
+// Validate checks the settings
+func (c Config) Validate() error {
+	if c.ServiceName == "" {
+		return errors.New("tracing service name is required")
+	}
+	if !strings.HasPrefix(c.Endpoint, "http://") && !strings.HasPrefix(c.Endpoint, "https://") {
+		return fmt.Errorf("tracing endpoint %q must be an http:// or https:// URL", c.Endpoint)
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("tracing sample rate %v must be between 0 and 1", c.SampleRate)
+	}
+	if c.QueueSize <= 0 || c.BatchSize <= 0 || c.FlushInterval <= 0 {
+		return errors.New("tracing queue size, batch size and flush interval must be positive")
+	}
+	return nil
+}
+
+// Tracer starts spans through an SDK tracer provider, whose batch processor
+// exports the finished ones on a goroutine of its own
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	exporter *countingExporter
+}
+
+// TracerStats counts the spans exported and lost
+type TracerStats struct {
+	SpansExported int64 `json:"spans_exported"`
+	SpansFailed   int64 `json:"spans_failed"` // the endpoint didn't take them
+}
+
+// NewTracer creates a tracer exporting to the config's endpoint over
+// OTLP/HTTP, in protobuf
+func NewTracer(config Config) (*Tracer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(config.Endpoint, "/")+"/v1/traces"),
+		otlptracehttp.WithTimeout(10*time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	return newTracer(config, exporter)
+}
+
+func newTracer(config Config, exporter sdktrace.SpanExporter) (*Tracer, error) {
+	attributes := []Attribute{String("service.name", config.ServiceName)}
+	if config.ServiceVersion != "" {
+		attributes = append(attributes, String("service.version", config.ServiceVersion))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attributes...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the service: %w", err)
+	}
+
+	counting := &countingExporter{SpanExporter: exporter}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRate))),
+		sdktrace.WithBatcher(counting,
+			sdktrace.WithMaxQueueSize(config.QueueSize),
+			sdktrace.WithMaxExportBatchSize(config.BatchSize),
+			sdktrace.WithBatchTimeout(config.FlushInterval),
+		),
+	)
+
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer("connect-four-backend"),
+		exporter: counting,
+	}, nil
+}
+
+var global atomic.Pointer[Tracer]
+
+// SetTracer installs the tracer Start uses, nil to stop tracing
+func SetTracer(tracer *Tracer) {
+	global.Store(tracer)
+}
+
+// Start starts a span as a child of the span or remote parent the context
+// carries, or of none, and returns a context carrying it. Without a tracer
+// it returns the context and a nil span.
+func Start(ctx context.Context, name string, kind SpanKind, attributes ...Attribute) (context.Context, *Span) {
+	tracer := global.Load()
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	ctx, span := tracer.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+	return ctx, &Span{span: span}
+}
+
+// Shutdown exports the spans still queued and stops the tracer, giving up
+// when ctx is done
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if err := t.provider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("spans left unexported: %w", err)
+	}
+	return nil
+}
+
+// GetStats returns how many spans were exported and lost
+func (t *Tracer) GetStats() TracerStats {
+	return TracerStats{
+		SpansExported: atomic.LoadInt64(&t.exporter.exported),
+		SpansFailed:   atomic.LoadInt64(&t.exporter.failed),
+	}
+}
+
+// RegisterMetrics exposes the spans exported and lost
+func (t *Tracer) RegisterMetrics(registry *metrics.Registry) {
+	registry.CounterFunc("connect_four_tracing_spans_exported_total", "Spans exported to the tracing backend",
+		func() float64 { return float64(t.GetStats().SpansExported) })
+	registry.CounterFunc("connect_four_tracing_spans_failed_total", "Spans the tracing backend didn't accept",
+		func() float64 { return float64(t.GetStats().SpansFailed) })
+}
+
+// countingExporter counts the spans its exporter sent and failed to send.
+// The SDK reports the errors themselves to its error handler, which logs them.
+type countingExporter struct {
+	sdktrace.SpanExporter
+
+	exported int64
+	failed   int64
+}
+
+func (e *countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		atomic.AddInt64(&e.failed, int64(len(spans)))
+	} else {
+		atomic.AddInt64(&e.exported, int64(len(spans)))
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	remoteTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	remoteSpanID  = "00f067aa0ba902b7"
+)
+
+// install sets a tracer exporting to memory until the test ends
+func install(t *testing.T, sampleRate float64) (*Tracer, *tracetest.InMemoryExporter) {
+	t.Helper()
+	config := DefaultConfig("connect-four-test", "http://localhost:4318")
+	config.SampleRate = sampleRate
+	exporter := tracetest.NewInMemoryExporter()
+	tracer, err := newTracer(config, exporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTracer(tracer)
+	t.Cleanup(func() { SetTracer(nil) })
+	return tracer, exporter
+}
+
+func TestStartWithoutTracer(t *testing.T) {
+	ctx := ContextWithRemoteParent(context.Background(), "00-"+remoteTraceID+"-"+remoteSpanID+"-01")
+	ctx, span := Start(ctx, "game.play_move", KindInternal, String("game.id", "game-1"))
+	if span != nil {
+		t.Fatalf("Start without a tracer returned %v, want a nil span", span)
+	}
+	span.SetAttributes(Int("game.column", 3))
+	span.RecordError(errors.New("column full"))
+	span.End()
+	if traceParent := span.TraceParent(); traceParent != "" {
+		t.Errorf("nil span's traceparent = %q, want none", traceParent)
+	}
+	// The caller's trace isn't passed on for it
+	if traceParent := TraceParent(ctx); traceParent != "" {
+		t.Errorf("TraceParent = %q with only a remote parent, want none", traceParent)
+	}
+}
+
+func TestSpansContinueRemoteTrace(t *testing.T) {
+	tracer, exporter := install(t, 1)
+
+	ctx := ContextWithRemoteParent(context.Background(), "00-"+remoteTraceID+"-"+remoteSpanID+"-01")
+	ctx, request := Start(ctx, "POST /api/games/{id}/moves", KindServer, String("http.route", "/api/games/{id}/moves"))
+	_, move := Start(ctx, "game.play_move", KindInternal)
+	move.SetAttributes(Int("game.column", 7))
+	move.RecordError(errors.New("column out of range"))
+	move.End()
+	request.End()
+
+	traceParent := TraceParent(ctx)
+	if traceParent != request.TraceParent() {
+		t.Errorf("TraceParent(ctx) = %q, the span's is %q", traceParent, request.TraceParent())
+	}
+	if !strings.HasPrefix(traceParent, "00-"+remoteTraceID+"-") || !strings.HasSuffix(traceParent, "-01") || len(traceParent) != 55 {
+		t.Errorf("traceparent = %q, want the remote trace, sampled", traceParent)
+	}
+
+	// Shutting down would empty the exporter
+	if err := tracer.provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	exportedMove, exportedRequest := spans[0], spans[1]
+
+	if got := exportedRequest.SpanContext.TraceID().String(); got != remoteTraceID {
+		t.Errorf("request span is in trace %s, want %s", got, remoteTraceID)
+	}
+	if got := exportedRequest.Parent.SpanID().String(); got != remoteSpanID {
+		t.Errorf("request span's parent is %s, want the remote %s", got, remoteSpanID)
+	}
+	if exportedRequest.SpanKind != trace.SpanKindServer {
+		t.Errorf("request span kind = %v, want server", exportedRequest.SpanKind)
+	}
+	if exportedMove.Parent.SpanID() != exportedRequest.SpanContext.SpanID() {
+		t.Error("move span isn't a child of the request span")
+	}
+	if exportedMove.Status.Code != codes.Error || exportedMove.Status.Description != "column out of range" {
+		t.Errorf("move span status = %+v, want the error", exportedMove.Status)
+	}
+	if len(exportedMove.Attributes) != 1 || exportedMove.Attributes[0] != Int("game.column", 7) {
+		t.Errorf("move span attributes = %v", exportedMove.Attributes)
+	}
+	if name, _ := exportedMove.Resource.Set().Value("service.name"); name.AsString() != "connect-four-test" {
+		t.Errorf("service.name = %q", name.AsString())
+	}
+
+	if stats := tracer.GetStats(); stats.SpansExported != 2 || stats.SpansFailed != 0 {
+		t.Errorf("stats = %+v, want 2 exported", stats)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	tracer, exporter := install(t, 0)
+
+	// A trace started here isn't kept, and says so downstream
+	ctx, root := Start(context.Background(), "ws move", KindServer)
+	root.End()
+	if traceParent := TraceParent(ctx); !strings.HasSuffix(traceParent, "-00") {
+		t.Errorf("unsampled traceparent = %q, want the flags cleared", traceParent)
+	}
+
+	// A trace the caller kept is kept here too
+	ctx = ContextWithRemoteParent(context.Background(), "00-"+remoteTraceID+"-"+remoteSpanID+"-01")
+	_, consumer := Start(ctx, "process move_played", KindConsumer)
+	consumer.End()
+
+	// Shutting down would empty the exporter
+	if err := tracer.provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "process move_played" {
+		t.Errorf("exported %d spans, want only the remote trace's", len(spans))
+	}
+}
+
+func TestContextWithRemoteParentIgnoresInvalid(t *testing.T) {
+	for _, traceParent := range []string{
+		"",
+		"00-" + remoteTraceID + "-" + remoteSpanID,
+		"00-00000000000000000000000000000000-" + remoteSpanID + "-01",
+		"00-" + remoteTraceID + "-0000000000000000-01",
+		"ff-" + remoteTraceID + "-" + remoteSpanID + "-01",
+		"00-" + remoteTraceID + "-zzf067aa0ba902b7-01",
+	} {
+		ctx := ContextWithRemoteParent(context.Background(), traceParent)
+		if trace.SpanContextFromContext(ctx).IsValid() {
+			t.Errorf("%q was taken as a parent", traceParent)
+		}
+	}
+}
+
+func TestExportOverOTLPHTTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		exported int64
+		failed   int64
+	}{
+		{"accepted", http.StatusOK, 1, 0},
+		{"rejected", http.StatusBadRequest, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" ||
+					r.Header.Get("Content-Type") != "application/x-protobuf" || len(body) == 0 {
+					t.Errorf("collector got %s %s (%s, %d bytes)", r.Method, r.URL.Path, r.Header.Get("Content-Type"), len(body))
+				}
+				atomic.AddInt32(&requests, 1)
+				w.WriteHeader(tt.status)
+			}))
+			defer collector.Close()
+
+			tracer, err := NewTracer(DefaultConfig("connect-four-test", collector.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			SetTracer(tracer)
+			defer SetTracer(nil)
+
+			_, span := Start(context.Background(), "publish connect-four-moves", KindProducer)
+			span.End()
+			tracer.Shutdown(context.Background())
+
+			if atomic.LoadInt32(&requests) != 1 {
+				t.Errorf("collector got %d requests, want 1", requests)
+			}
+			if stats := tracer.GetStats(); stats.SpansExported != tt.exported || stats.SpansFailed != tt.failed {
+				t.Errorf("stats = %+v, want %d exported and %d failed", stats, tt.exported, tt.failed)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		valid  bool
+	}{
+		{"default", func(c *Config) {}, true},
+		{"no service name", func(c *Config) { c.ServiceName = "" }, false},
+		{"grpc endpoint", func(c *Config) { c.Endpoint = "jaeger:4317" }, false},
+		{"sample rate above one", func(c *Config) { c.SampleRate = 1.5 }, false},
+		{"no queue", func(c *Config) { c.QueueSize = 0 }, false},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig("connect-four-test", "http://jaeger:4318")
+		tt.modify(&config)
+		if err := config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret, so receivers can
+// check the payload came from this server and reject replays.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// delivery is one event on its way to one webhook
+type delivery struct {
+	id        uuid.UUID
+	webhook   *models.Webhook
+	event     string
+	body      []byte
+	attempts  int
+	lastError string
+}
+
+// Sign returns the signature header value for a body sent at the timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// worker delivers queued events until the service stops
+func (s *Service) worker() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case d := <-s.queue:
+			s.attempt(d)
+		}
+	}
+}
+
+// attempt sends the delivery once, scheduling a retry or dead-lettering it
+// when it fails
+func (s *Service) attempt(d *delivery) {
+	d.attempts++
+
+	retry, err := s.send(d)
+	if err == nil {
+		return
+	}
+	d.lastError = err.Error()
+
+	if !retry || d.attempts >= s.config.MaxAttempts {
+		s.deadLetter(d)
+		return
+	}
+
+	backoff := s.config.RetryBackoff << (d.attempts - 1)
+	time.AfterFunc(backoff, func() {
+		select {
+		case <-s.stopChan:
+		case s.queue <- d:
+		default:
+			d.lastError = "delivery queue full"
+			s.deadLetter(d)
+		}
+	})
+}
+
+// send POSTs the delivery, reporting whether a failure is worth retrying
+func (s *Service) send(d *delivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.webhook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "connect-four-webhooks/1")
+	req.Header.Set(HeaderEvent, d.event)
+	req.Header.Set(HeaderID, d.id.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(d.webhook.Secret, timestamp, d.body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	// Client errors won't go away on their own, except timeouts and rate limits
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook responded %s", resp.Status)
+}
+
+// deadLetter records a delivery that won't be attempted again
+func (s *Service) deadLetter(d *delivery) {
+	log.Printf("Giving up on %s webhook %s to %s after %d attempts: %s", d.event, d.webhook.ID, d.webhook.URL, d.attempts, d.lastError)
+
+	letter := &models.WebhookDeadLetter{
+		ID:        uuid.New(),
+		WebhookID: d.webhook.ID,
+		URL:       d.webhook.URL,
+		Event:     d.event,
+		Payload:   d.body,
+		Attempts:  d.attempts,
+		LastError: d.lastError,
+		FailedAt:  time.Now(),
+	}
+	if err := s.store.SaveWebhookDeadLetter(letter); err != nil {
+		log.Printf("Failed to save dead letter for webhook %s: %v", d.webhook.ID, err)
+	}
+}
@@ -0,0 +1,276 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryStore keeps webhooks in a slice and sends each dead letter on a channel
+type memoryStore struct {
+	mu          sync.Mutex
+	webhooks    []*models.Webhook
+	deadLetters chan *models.WebhookDeadLetter
+}
+
+func newMemoryStore(webhooks ...*models.Webhook) *memoryStore {
+	return &memoryStore{webhooks: webhooks, deadLetters: make(chan *models.WebhookDeadLetter, 10)}
+}
+
+func (m *memoryStore) CreateWebhook(webhook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhooks = append(m.webhooks, webhook)
+	return nil
+}
+
+func (m *memoryStore) ListWebhooks() ([]*models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*models.Webhook(nil), m.webhooks...), nil
+}
+
+func (m *memoryStore) DeleteWebhook(webhookID uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (m *memoryStore) SaveWebhookDeadLetter(letter *models.WebhookDeadLetter) error {
+	m.deadLetters <- letter
+	return nil
+}
+
+func (m *memoryStore) ListWebhookDeadLetters(limit int) ([]*models.WebhookDeadLetter, error) {
+	return nil, nil
+}
+
+// receivedRequest is a delivery as the receiver saw it
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+// receiver answers deliveries with the statuses in turn, the last one for
+// every delivery after them
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	received []receivedRequest
+	done     chan struct{} // closed on the first 2xx answer
+}
+
+func newReceiver(statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, done: make(chan struct{})}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		status := r.statuses[len(r.statuses)-1]
+		if len(r.received) < len(r.statuses) {
+			status = r.statuses[len(r.received)]
+		}
+		r.received = append(r.received, receivedRequest{header: req.Header.Clone(), body: body, at: time.Now()})
+		w.WriteHeader(status)
+		if status >= 200 && status < 300 {
+			close(r.done)
+		}
+	}))
+	return r
+}
+
+func (r *receiver) requests() []receivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedRequest(nil), r.received...)
+}
+
+func testConfig() Config {
+	return Config{Timeout: 2 * time.Second, MaxAttempts: 3, RetryBackoff: 20 * time.Millisecond, QueueSize: 10, Workers: 1}
+}
+
+func testWebhook(url string) *models.Webhook {
+	return &models.Webhook{ID: uuid.New(), URL: url, Events: []string{EventGameEnded}, Secret: "whsec"}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"game_ended"}`)
+	tests := []struct {
+		secret    string
+		timestamp int64
+		want      string
+	}{
+		{"whsec", 1700000000, "sha256=77c7f3858a1cfd874edfe5f93d5e5b34112e312200bbd6752cb3bf31d9c7e60a"},
+		{"whsec", 1700000001, "sha256=42d701ddf14871c691125ee9bf5d363891967975a17aa72bb84466fd06150133"},
+		{"other", 1700000000, "sha256=40453a126377bfe2bb549b0537a80f007bd68eca770cb94157fd7592ca3bca1b"},
+	}
+	for _, tt := range tests {
+		if got := Sign(tt.secret, tt.timestamp, body); got != tt.want {
+			t.Errorf("Sign(%q, %d) = %s, want %s", tt.secret, tt.timestamp, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverySignedHeaders(t *testing.T) {
+	r := newReceiver(http.StatusNoContent)
+	defer r.Close()
+	webhook := testWebhook(r.URL)
+	s := NewService(testConfig(), newMemoryStore(webhook))
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	s.Publish(EventGameEnded, map[string]string{"winner": "alice"})
+
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delivery never arrived")
+	}
+	s.Stop()
+
+	received := r.requests()
+	if len(received) != 1 {
+		t.Fatalf("received %d deliveries, want 1", len(received))
+	}
+	got := received[0]
+
+	var envelope struct {
+		ID    uuid.UUID         `json:"id"`
+		Event string            `json:"event"`
+		Data  map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(got.body, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Event != EventGameEnded || envelope.Data["winner"] != "alice" {
+		t.Errorf("delivered %s", got.body)
+	}
+	if got.header.Get(HeaderEvent) != EventGameEnded || got.header.Get(HeaderID) != envelope.ID.String() ||
+		got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("delivered with headers %v", got.header)
+	}
+
+	timestamp, err := strconv.ParseInt(got.header.Get(HeaderTimestamp), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+		t.Errorf("%s is %q", HeaderTimestamp, got.header.Get(HeaderTimestamp))
+	}
+	if signature := got.header.Get(HeaderSignature); signature != Sign(webhook.Secret, timestamp, got.body) {
+		t.Errorf("%s is %q, which doesn't sign the body and timestamp with the webhook's secret", HeaderSignature, signature)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		wantSent   int
+		wantLetter string // the dead letter's last error, empty when delivered
+	}{
+		{"delivered first time", []int{http.StatusOK}, 1, ""},
+		{"server errors are retried", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusAccepted}, 3, ""},
+		{"rate limits are retried", []int{http.StatusTooManyRequests, http.StatusOK}, 2, ""},
+		{"timeouts are retried", []int{http.StatusRequestTimeout, http.StatusOK}, 2, ""},
+		{"client errors aren't retried", []int{http.StatusBadRequest}, 1, "webhook responded 400 Bad Request"},
+		{"a gone endpoint isn't retried", []int{http.StatusServiceUnavailable, http.StatusGone}, 2, "webhook responded 410 Gone"},
+		{"out of attempts", []int{http.StatusInternalServerError}, 3, "webhook responded 500 Internal Server Error"},
+	}
+	for _, tt := range tests {
+		r := newReceiver(tt.statuses...)
+		webhook := testWebhook(r.URL)
+		store := newMemoryStore(webhook)
+		s := NewService(testConfig(), store)
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		s.Publish(EventGameEnded, map[string]string{"winner": "alice"})
+
+		var letter *models.WebhookDeadLetter
+		select {
+		case <-r.done:
+		case letter = <-store.deadLetters:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the delivery neither arrived nor gave up", tt.name)
+		}
+		s.Stop()
+		r.Close()
+
+		received := r.requests()
+		if len(received) != tt.wantSent {
+			t.Errorf("%s: sent %d times, want %d", tt.name, len(received), tt.wantSent)
+		}
+		switch {
+		case tt.wantLetter == "" && letter != nil:
+			t.Errorf("%s: dead-lettered with %q", tt.name, letter.LastError)
+		case tt.wantLetter != "" && letter == nil:
+			t.Errorf("%s: delivered, want a dead letter", tt.name)
+		case letter != nil:
+			if letter.LastError != tt.wantLetter || letter.Attempts != tt.wantSent || letter.WebhookID != webhook.ID ||
+				letter.URL != r.URL || letter.Event != EventGameEnded || string(letter.Payload) != string(received[0].body) {
+				t.Errorf("%s: dead letter %+v", tt.name, letter)
+			}
+		}
+
+		// Each retry waits twice as long as the one before
+		for i := 1; i < len(received); i++ {
+			backoff := testConfig().RetryBackoff << (i - 1)
+			if gap := received[i].at.Sub(received[i-1].at); gap < backoff {
+				t.Errorf("%s: attempt %d came %v after the one before, want at least %v", tt.name, i+1, gap, backoff)
+			}
+		}
+	}
+}
+
+func TestDeliveryUnreachable(t *testing.T) {
+	r := newReceiver(http.StatusOK)
+	r.Close()
+	store := newMemoryStore(testWebhook(r.URL))
+	s := NewService(testConfig(), store)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	s.Publish(EventGameEnded, nil)
+
+	select {
+	case letter := <-store.deadLetters:
+		if letter.Attempts != testConfig().MaxAttempts || letter.LastError == "" {
+			t.Errorf("dead letter %+v, want every attempt used", letter)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("an unreachable webhook was never dead-lettered")
+	}
+}
+
+func TestPublishQueueFull(t *testing.T) {
+	first, second := testWebhook("http://first.example"), testWebhook("http://second.example")
+	store := newMemoryStore(first, second)
+	config := testConfig()
+	config.QueueSize = 1
+	s := NewService(config, store)
+	s.webhooks = []*models.Webhook{first, second}
+
+	// Without workers the first webhook's delivery fills the queue
+	s.Publish(EventGameEnded, nil)
+
+	select {
+	case letter := <-store.deadLetters:
+		if letter.WebhookID != second.ID || letter.Attempts != 0 || letter.LastError != "delivery queue full" {
+			t.Errorf("dead letter %+v, want the second webhook's delivery", letter)
+		}
+	default:
+		t.Fatal("a delivery that didn't fit the queue wasn't dead-lettered")
+	}
+	if len(store.deadLetters) != 0 || len(s.queue) != 1 {
+		t.Errorf("%d more dead letters and %d queued, want the first delivery queued", len(store.deadLetters), len(s.queue))
+	}
+}
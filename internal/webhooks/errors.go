@@ -0,0 +1,10 @@
+package webhooks
+
+import "errors"
+
+var (
+	ErrInvalidURL      = errors.New("webhook URL must be an absolute http or https URL")
+	ErrNoEvents        = errors.New("webhook must subscribe to at least one event")
+	ErrUnknownEvent    = errors.New("unknown webhook event")
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
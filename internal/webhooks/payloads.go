@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// GameEnded is the data sent with game_ended
+type GameEnded struct {
+	GameID     uuid.UUID             `json:"game_id"`
+	QueueType  models.QueueType      `json:"queue_type"`
+	Players    []models.ReplayPlayer `json:"players"`
+	Result     models.ReplayResult   `json:"result"`
+	TotalMoves int                   `json:"total_moves"`
+	Duration   int64                 `json:"duration_seconds"`
+	Notation   string                `json:"notation"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt time.Time             `json:"finished_at"`
+}
+
+// NewGameEnded builds the game_ended data for a finished game
+func NewGameEnded(game *models.Game) *GameEnded {
+	replay := game.Replay()
+	return &GameEnded{
+		GameID:     replay.GameID,
+		QueueType:  replay.Settings.QueueType,
+		Players:    replay.Players,
+		Result:     replay.Result,
+		TotalMoves: len(replay.Moves),
+		Duration:   int64(replay.FinishedAt.Sub(replay.StartedAt).Seconds()),
+		Notation:   replay.Notation,
+		StartedAt:  replay.StartedAt,
+		FinishedAt: replay.FinishedAt,
+	}
+}
+
+// TournamentUpdate is the data sent with tournament_started and tournament_finished
+type TournamentUpdate struct {
+	TournamentID uuid.UUID               `json:"tournament_id"`
+	Name         string                  `json:"name"`
+	Format       models.TournamentFormat `json:"format"`
+	Status       models.TournamentStatus `json:"status"`
+	Players      int                     `json:"players"`
+	WinnerID     *uuid.UUID              `json:"winner_id,omitempty"`
+	WinnerName   string                  `json:"winner_name,omitempty"`
+	StartedAt    *time.Time              `json:"started_at,omitempty"`
+	FinishedAt   *time.Time              `json:"finished_at,omitempty"`
+}
+
+// NewTournamentUpdate builds the tournament event data from a snapshot
+func NewTournamentUpdate(t *models.Tournament) *TournamentUpdate {
+	update := &TournamentUpdate{
+		TournamentID: t.ID,
+		Name:         t.Name,
+		Format:       t.Format,
+		Status:       t.Status,
+		Players:      len(t.Players),
+		WinnerID:     t.WinnerID,
+		StartedAt:    t.StartedAt,
+		FinishedAt:   t.FinishedAt,
+	}
+	if t.WinnerID != nil {
+		for _, player := range t.Players {
+			if player.ID == *t.WinnerID {
+				update.WinnerName = player.Name
+				break
+			}
+		}
+	}
+	return update
+}
@@ -0,0 +1,261 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"connect-four-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Events that webhooks can subscribe to
+const (
+	EventGameEnded          = "game_ended"
+	EventTournamentStarted  = "tournament_started"
+	EventTournamentFinished = "tournament_finished"
+)
+
+// Events lists every event webhooks can subscribe to
+var Events = []string{EventGameEnded, EventTournamentStarted, EventTournamentFinished}
+
+// Store persists webhooks and the deliveries that gave up
+type Store interface {
+	CreateWebhook(webhook *models.Webhook) error
+	ListWebhooks() ([]*models.Webhook, error)
+	// DeleteWebhook reports whether the webhook existed
+	DeleteWebhook(webhookID uuid.UUID) (bool, error)
+	SaveWebhookDeadLetter(letter *models.WebhookDeadLetter) error
+	ListWebhookDeadLetters(limit int) ([]*models.WebhookDeadLetter, error)
+}
+
+// Config holds delivery limits
+type Config struct {
+	Timeout      time.Duration `json:"timeout"`       // per delivery attempt
+	MaxAttempts  int           `json:"max_attempts"`  // before a delivery is dead-lettered
+	RetryBackoff time.Duration `json:"retry_backoff"` // wait before the first retry, doubled for each one after
+	QueueSize    int           `json:"queue_size"`
+	Workers      int           `json:"workers"`
+}
+
+// DefaultConfig returns deliveries by 4 workers, each tried up to 5 times
+// with a 10 second timeout before it is dead-lettered
+func DefaultConfig() Config {
+	return Config{
+		Timeout:      10 * time.Second,
+		MaxAttempts:  5,
+		RetryBackoff: 2 * time.Second,
+		QueueSize:    1000,
+		Workers:      4,
+	}
+}
+
+// Envelope is the JSON body POSTed to webhooks
+type Envelope struct {
+	ID        uuid.UUID   `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Service sends events to the registered webhooks. Deliveries are signed with
+// the webhook's secret, retried with backoff and dead-lettered once they run
+// out of attempts.
+type Service struct {
+	config Config
+	store  Store
+	client *http.Client
+
+	webhooks []*models.Webhook
+	mutex    sync.RWMutex
+
+	queue    chan *delivery
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewService creates a webhook service, Start loads the webhooks and begins delivering
+func NewService(config Config, store Store) *Service {
+	return &Service{
+		config:   config,
+		store:    store,
+		client:   &http.Client{Timeout: config.Timeout},
+		queue:    make(chan *delivery, config.QueueSize),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start loads the registered webhooks and starts the delivery workers
+func (s *Service) Start() error {
+	webhooks, err := s.store.ListWebhooks()
+	if err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	s.mutex.Lock()
+	s.webhooks = webhooks
+	s.mutex.Unlock()
+
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+
+	log.Printf("Webhook service started with %d webhooks", len(webhooks))
+	return nil
+}
+
+// Stop stops the workers. Deliveries still waiting for a retry are dropped.
+func (s *Service) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// Register adds a webhook for the given events and returns it with its secret
+func (s *Service) Register(rawURL string, events []string) (*models.Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	if len(events) == 0 {
+		return nil, ErrNoEvents
+	}
+	for _, event := range events {
+		if !knownEvent(event) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, event)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	webhook := &models.Webhook{
+		ID:        uuid.New(),
+		URL:       parsed.String(),
+		Events:    events,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now(),
+	}
+	if err := s.store.CreateWebhook(webhook); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.webhooks = append(s.webhooks, webhook)
+	s.mutex.Unlock()
+
+	return webhook, nil
+}
+
+// List returns the registered webhooks without their secrets
+func (s *Service) List() []*models.Webhook {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	webhooks := make([]*models.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		listed := *webhook
+		listed.Secret = ""
+		webhooks = append(webhooks, &listed)
+	}
+	return webhooks
+}
+
+// Delete removes a webhook, deliveries already queued for it still go out
+func (s *Service) Delete(webhookID uuid.UUID) error {
+	existed, err := s.store.DeleteWebhook(webhookID)
+	if err != nil {
+		return err
+	}
+	if !existed {
+		return ErrWebhookNotFound
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, webhook := range s.webhooks {
+		if webhook.ID == webhookID {
+			s.webhooks = append(s.webhooks[:i:i], s.webhooks[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// DeadLetters returns the most recent deliveries that gave up
+func (s *Service) DeadLetters(limit int) ([]*models.WebhookDeadLetter, error) {
+	return s.store.ListWebhookDeadLetters(limit)
+}
+
+// Publish queues the event for every webhook subscribed to it. It never
+// blocks: when the queue is full the delivery is dead-lettered straight away.
+func (s *Service) Publish(event string, data interface{}) {
+	s.mutex.RLock()
+	var subscribed []*models.Webhook
+	for _, webhook := range s.webhooks {
+		if subscribes(webhook, event) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	s.mutex.RUnlock()
+
+	if len(subscribed) == 0 {
+		return
+	}
+
+	envelope := Envelope{
+		ID:        uuid.New(),
+		Event:     event,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("Failed to encode %s webhook payload: %v", event, err)
+		return
+	}
+
+	for _, webhook := range subscribed {
+		d := &delivery{
+			id:      envelope.ID,
+			webhook: webhook,
+			event:   event,
+			body:    body,
+		}
+		select {
+		case s.queue <- d:
+		default:
+			d.lastError = "delivery queue full"
+			s.deadLetter(d)
+		}
+	}
+}
+
+func knownEvent(event string) bool {
+	for _, known := range Events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+func subscribes(webhook *models.Webhook, event string) bool {
+	for _, subscribed := range webhook.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
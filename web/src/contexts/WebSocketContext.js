@@ -19,6 +19,7 @@ const initialState = {
   // Game state
   gameState: GAME_STATES.MENU,
   currentGame: null,
+  resyncGameId: null, // set when a game delta was missed
   playerId: null,
   playerName: '',
   
@@ -41,6 +42,7 @@ const ACTION_TYPES = {
   SET_GAME_STATE: 'SET_GAME_STATE',
   SET_PLAYER_NAME: 'SET_PLAYER_NAME',
   SET_CURRENT_GAME: 'SET_CURRENT_GAME',
+  APPLY_GAME_DELTA: 'APPLY_GAME_DELTA',
   SET_PLAYER_ID: 'SET_PLAYER_ID',
   SET_MESSAGE: 'SET_MESSAGE',
   SET_ERROR: 'SET_ERROR',
@@ -73,8 +75,46 @@ const webSocketReducer = (state, action) => {
     case ACTION_TYPES.SET_CURRENT_GAME:
       return {
         ...state,
-        currentGame: action.payload
+        currentGame: action.payload,
+        resyncGameId: null
       };
+
+    case ACTION_TYPES.APPLY_GAME_DELTA: {
+      const game = state.currentGame;
+      const delta = action.payload;
+
+      // Deltas for other games and ones already applied are ignored
+      if (!game || game.id !== delta.game_id || delta.version <= game.version) {
+        return state;
+      }
+
+      // A gap means a delta was missed, fetch the whole game instead
+      if (delta.version !== game.version + 1) {
+        return { ...state, resyncGameId: delta.game_id };
+      }
+
+      const board = game.board.map(row => [...row]);
+      if (delta.move) {
+        board[delta.move.row][delta.move.column] = delta.move.color + 1;
+      }
+
+      return {
+        ...state,
+        currentGame: {
+          ...game,
+          board,
+          version: delta.version,
+          state: delta.state,
+          current_turn: delta.current_turn,
+          current_turn_number: delta.current_turn_number,
+          turn_started_at: delta.turn_started_at,
+          winner: delta.winner,
+          finished_at: delta.finished_at,
+          last_move: delta.move || game.last_move,
+          moves: delta.move ? [...(game.moves || []), delta.move] : game.moves
+        }
+      };
+    }
       
     case ACTION_TYPES.SET_PLAYER_ID:
       return {
@@ -176,42 +216,27 @@ export const WebSocketProvider = ({ children }) => {
       });
     });
 
-    // Move result handler
+    // Moves arrive as deltas against the current game
+    const unsubscribeGameDelta = webSocket.onMessage(MESSAGE_TYPES.GAME_DELTA, (message) => {
+      dispatch({ type: ACTION_TYPES.APPLY_GAME_DELTA, payload: message.payload });
+    });
+
+    // Full game state, sent in answer to a resync
+    const unsubscribeGameState = webSocket.onMessage(MESSAGE_TYPES.GAME_STATE, (message) => {
+      const { game_state } = message.payload;
+      if (game_state) {
+        dispatch({ type: ACTION_TYPES.SET_CURRENT_GAME, payload: game_state });
+      }
+    });
+
+    // Move result handler, only sent when a move is rejected
     const unsubscribeMoveResult = webSocket.onMessage(MESSAGE_TYPES.MOVE_RESULT, (message) => {
-      const { success, game_state, error, is_game_over, win_result } = message.payload;
+      const { success, game_state, error } = message.payload;
       
-      if (success) {
-        dispatch({ type: ACTION_TYPES.SET_CURRENT_GAME, payload: game_state });
-        
-        if (is_game_over) {
-          dispatch({ type: ACTION_TYPES.SET_GAME_STATE, payload: GAME_STATES.FINISHED });
-          
-          if (win_result && win_result.has_winner) {
-            const winnerPlayer = game_state.players.find(p => p.number === win_result.winner);
-            const isWinner = winnerPlayer && winnerPlayer.id === state.playerId;
-            const winnerColor = win_result.winner === 1 ? 'Red' : 'Yellow';
-            const winType = win_result.win_type;
-            
-            dispatch({
-              type: ACTION_TYPES.SET_MESSAGE,
-              payload: isWinner 
-                ? `🎉 You won with a ${winType} connection! (${winnerColor})`
-                : `😞 You lost! ${winnerPlayer?.name} won with ${winType} (${winnerColor})`
-            });
-          } else {
-            dispatch({
-              type: ACTION_TYPES.SET_MESSAGE,
-              payload: "🤝 It's a draw! Great game!"
-            });
-          }
-          
-          // Update games played stat
-          dispatch({
-            type: ACTION_TYPES.UPDATE_STATS,
-            payload: { gamesPlayed: state.stats.gamesPlayed + 1 }
-          });
+      if (!success) {
+        if (game_state) {
+          dispatch({ type: ACTION_TYPES.SET_CURRENT_GAME, payload: game_state });
         }
-      } else {
         dispatch({ type: ACTION_TYPES.SET_ERROR, payload: error });
         // Clear error after 3 seconds
         setTimeout(() => {
@@ -226,6 +251,10 @@ export const WebSocketProvider = ({ children }) => {
       
       dispatch({ type: ACTION_TYPES.SET_CURRENT_GAME, payload: game_state });
       dispatch({ type: ACTION_TYPES.SET_GAME_STATE, payload: GAME_STATES.FINISHED });
+      dispatch({
+        type: ACTION_TYPES.UPDATE_STATS,
+        payload: { gamesPlayed: state.stats.gamesPlayed + 1 }
+      });
       
       if (is_draw) {
         dispatch({
@@ -252,9 +281,24 @@ export const WebSocketProvider = ({ children }) => {
 
     // Player disconnected handler
     const unsubscribePlayerDisconnected = webSocket.onMessage(MESSAGE_TYPES.PLAYER_DISCONNECTED, (message) => {
+      const seconds = message.payload?.grace_period_seconds;
+      dispatch({
+        type: ACTION_TYPES.SET_MESSAGE,
+        payload: `⚠️ Opponent disconnected. Waiting for reconnection${seconds ? ` (${seconds}s)` : ''}...`
+      });
+    });
+
+    // Grace period countdown while the opponent is away
+    const unsubscribeDisconnectCountdown = webSocket.onMessage(MESSAGE_TYPES.DISCONNECT_COUNTDOWN, (message) => {
+      const { remaining_seconds, adjudication } = message.payload || {};
+      const outcome = {
+        win: 'you win',
+        draw: 'the game is a draw',
+        pause: 'the game pauses'
+      }[adjudication] || 'the game ends';
       dispatch({
         type: ACTION_TYPES.SET_MESSAGE,
-        payload: '⚠️ Opponent disconnected. Waiting for reconnection...'
+        payload: `⚠️ Opponent disconnected. ${remaining_seconds}s until ${outcome}...`
       });
     });
 
@@ -273,15 +317,37 @@ export const WebSocketProvider = ({ children }) => {
 
     // Bot move handler
     const unsubscribeBotMove = webSocket.onMessage(MESSAGE_TYPES.BOT_MOVE, (message) => {
-      const { game_state, reasoning, confidence } = message.payload;
-      
-      dispatch({ type: ACTION_TYPES.SET_CURRENT_GAME, payload: game_state });
+      const { reasoning, confidence } = message.payload;
       
       if (reasoning && process.env.NODE_ENV === 'development') {
         console.log(`🤖 Bot move: ${reasoning} (confidence: ${confidence}%)`);
       }
     });
 
+    // Server restart notice, games in progress are saved and resume on reconnect
+    const unsubscribeServerShutdown = webSocket.onMessage(MESSAGE_TYPES.SERVER_SHUTDOWN, (message) => {
+      dispatch({
+        type: ACTION_TYPES.SET_MESSAGE,
+        payload: `🔧 ${message.payload?.message || 'The server is restarting'}`
+      });
+    });
+
+    // Another of the player's devices took over the game, or handed it to this one
+    const unsubscribeControlChanged = webSocket.onMessage(MESSAGE_TYPES.CONTROL_CHANGED, (message) => {
+      dispatch({
+        type: ACTION_TYPES.SET_MESSAGE,
+        payload: `📱 ${message.payload?.message || 'Game control changed'}`
+      });
+    });
+
+    // Operator announcements
+    const unsubscribeAnnouncement = webSocket.onMessage(MESSAGE_TYPES.ANNOUNCEMENT, (message) => {
+      dispatch({
+        type: ACTION_TYPES.SET_MESSAGE,
+        payload: `📢 ${message.payload?.message}`
+      });
+    });
+
     // Error handler
     const unsubscribeError = webSocket.onMessage(MESSAGE_TYPES.ERROR, (message) => {
       const errorMsg = message.payload?.message || message.payload?.error || 'Unknown error';
@@ -312,16 +378,29 @@ export const WebSocketProvider = ({ children }) => {
     // Return cleanup functions
     return () => {
       unsubscribeGameFound();
+      unsubscribeGameDelta();
+      unsubscribeGameState();
       unsubscribeMoveResult();
       unsubscribeGameEnd();
       unsubscribePlayerDisconnected();
       unsubscribePlayerReconnected();
       unsubscribeBotMove();
+      unsubscribeServerShutdown();
+      unsubscribeControlChanged();
+      unsubscribeAnnouncement();
+      unsubscribeDisconnectCountdown();
       unsubscribeError();
       unsubscribeReconnectSuccess();
     };
   }, [webSocket, state.playerId, state.stats.gamesPlayed]);
 
+  // Fetch the whole game after missing a delta
+  useEffect(() => {
+    if (state.resyncGameId) {
+      webSocket.getGameState(state.resyncGameId);
+    }
+  }, [state.resyncGameId]);
+
   // Action creators
   const actions = {
     setPlayerName: (name) => {
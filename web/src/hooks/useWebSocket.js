@@ -19,10 +19,12 @@ export const MESSAGE_TYPES = {
   RECONNECT: 'reconnect',
   HEARTBEAT: 'heartbeat',
   GET_GAME_STATE: 'get_game_state',
+  TAKE_CONTROL: 'take_control',
 
   // Server to Client
   GAME_FOUND: 'game_found',
   GAME_STATE: 'game_state',
+  GAME_DELTA: 'game_delta',
   MOVE_RESULT: 'move_result',
   GAME_END: 'game_end',
   ERROR: 'error',
@@ -33,7 +35,12 @@ export const MESSAGE_TYPES = {
   BOT_MOVE: 'bot_move',
   RECONNECT_SUCCESS: 'reconnect_success',
   PLAYER_DISCONNECTED: 'player_disconnected',
-  PLAYER_RECONNECTED: 'player_reconnected'
+  PLAYER_RECONNECTED: 'player_reconnected',
+  SESSION: 'session',
+  SERVER_SHUTDOWN: 'server_shutdown',
+  CONTROL_CHANGED: 'control_changed',
+  ANNOUNCEMENT: 'announcement',
+  DISCONNECT_COUNTDOWN: 'disconnect_countdown'
 };
 
 // Default configuration
@@ -78,6 +85,8 @@ export const useWebSocket = (config = {}) => {
   const messageHandlersRef = useRef(new Map());
   const messageQueueRef = useRef([]);
   const isManualCloseRef = useRef(false);
+  const sessionTokenRef = useRef(null);
+  const traceIdRef = useRef(null);
 
   // Logging utility
   const log = useCallback((level, message, data = null) => {
@@ -134,7 +143,7 @@ export const useWebSocket = (config = {}) => {
 
     heartbeatIntervalRef.current = setInterval(() => {
       if (wsRef.current?.readyState === WebSocket.OPEN) {
-        const heartbeatMsg = createMessage(MESSAGE_TYPES.HEARTBEAT);
+        const heartbeatMsg = createMessage(MESSAGE_TYPES.HEARTBEAT, { client_time: Date.now() });
         wsRef.current.send(JSON.stringify(heartbeatMsg));
         log('debug', 'Heartbeat sent');
       }
@@ -152,7 +161,7 @@ export const useWebSocket = (config = {}) => {
       // Handle system messages
       switch (message.type) {
         case MESSAGE_TYPES.HEARTBEAT_ACK:
-          log('debug', 'Heartbeat acknowledged');
+          log('debug', `Heartbeat acknowledged, latency ${message.payload?.latency_ms ?? '?'}ms`);
           return;
         
         case MESSAGE_TYPES.ERROR:
@@ -160,6 +169,13 @@ export const useWebSocket = (config = {}) => {
           log('error', 'Server error', message.payload);
           break;
         
+        case MESSAGE_TYPES.SESSION:
+          // Needed to reconnect as the same player
+          sessionTokenRef.current = message.payload?.token || null;
+          // Sent back on reconnect so analytics can follow the session across connections
+          traceIdRef.current = message.payload?.trace_id || null;
+          break;
+
         case MESSAGE_TYPES.RECONNECT_SUCCESS:
           log('info', 'Reconnection successful', message.payload);
           setIsReconnecting(false);
@@ -206,7 +222,11 @@ export const useWebSocket = (config = {}) => {
     isManualCloseRef.current = false;
 
     try {
-      const ws = new WebSocket(finalConfig.url);
+      let url = finalConfig.url;
+      if (traceIdRef.current) {
+        url += (url.includes('?') ? '&' : '?') + 'trace_id=' + encodeURIComponent(traceIdRef.current);
+      }
+      const ws = new WebSocket(url);
       wsRef.current = ws;
 
       // Connection timeout
@@ -357,6 +377,7 @@ export const useWebSocket = (config = {}) => {
       return sendMessage(MESSAGE_TYPES.RECONNECT, {
         game_id: gameId,
         player_id: playerId,
+        token: sessionTokenRef.current,
         username: username,
         last_seen: new Date().toISOString()
       });